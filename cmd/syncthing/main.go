@@ -30,6 +30,7 @@ import (
 
 	"github.com/syncthing/syncthing/lib/build"
 	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/dialer"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
@@ -118,6 +119,11 @@ are mostly useful for developers. Use with care.
                    "h", "m" and "s" abbreviations for hours minutes and seconds.
                    Valid values are like "720h", "30s", etc.
 
+ STDBBACKEND       Select the database backend to use. Possible values are
+                   "leveldb" (the default) and "badger". The two use the same
+                   database directory and are not compatible; reset the
+                   database when switching.
+
  GOMAXPROCS        Set the maximum number of CPU cores to use. Defaults to all
                    available CPU cores.
 
@@ -144,6 +150,7 @@ type RuntimeOptions struct {
 	syncthing.Options
 	confDir          string
 	resetDatabase    bool
+	moveDatabase     string
 	showVersion      bool
 	showPaths        bool
 	showDeviceId     bool
@@ -167,6 +174,7 @@ type RuntimeOptions struct {
 	cpuProfile       bool
 	stRestarting     bool
 	logFlags         int
+	logFormat        string
 	showHelp         bool
 	allowNewerConfig bool
 }
@@ -182,6 +190,7 @@ func defaultRuntimeOptions() RuntimeOptions {
 		cpuProfile:   os.Getenv("STCPUPROFILE") != "",
 		stRestarting: os.Getenv("STRESTART") != "",
 		logFlags:     log.Ltime,
+		logFormat:    "text",
 		logMaxSize:   10 << 20, // 10 MiB
 		logMaxFiles:  3,        // plus the current one
 	}
@@ -209,10 +218,12 @@ func parseCommandLineOptions() RuntimeOptions {
 	flag.StringVar(&options.guiAPIKey, "gui-apikey", options.guiAPIKey, "Override GUI API key")
 	flag.StringVar(&options.confDir, "home", "", "Set configuration directory")
 	flag.IntVar(&options.logFlags, "logflags", options.logFlags, "Select information in log line prefix (see below)")
+	flag.StringVar(&options.logFormat, "log-format", options.logFormat, "Log line format (\"text\" or \"json\")")
 	flag.BoolVar(&options.noBrowser, "no-browser", false, "Do not start browser")
 	flag.BoolVar(&options.browserOnly, "browser-only", false, "Open GUI in browser")
 	flag.BoolVar(&options.noRestart, "no-restart", options.noRestart, "Disable monitor process, managed restarts and log file writing")
 	flag.BoolVar(&options.resetDatabase, "reset-database", false, "Reset the database, forcing a full rescan and resync")
+	flag.StringVar(&options.moveDatabase, "move-database", "", "Move the database to the specified directory, then exit")
 	flag.BoolVar(&options.ResetDeltaIdxs, "reset-deltas", false, "Reset delta index IDs, forcing a full index exchange")
 	flag.BoolVar(&options.doUpgrade, "upgrade", false, "Perform upgrade")
 	flag.BoolVar(&options.doUpgradeCheck, "upgrade-check", false, "Check for available upgrade")
@@ -250,6 +261,14 @@ func parseCommandLineOptions() RuntimeOptions {
 func main() {
 	options := parseCommandLineOptions()
 	l.SetFlags(options.logFlags)
+	switch options.logFormat {
+	case "text":
+	case "json":
+		l.SetFormat(logger.FormatJSON)
+	default:
+		l.Warnln("Unknown log format:", options.logFormat)
+		os.Exit(syncthing.ExitError.AsInt())
+	}
 
 	if options.guiAddress != "" {
 		// The config picks this up from the environment.
@@ -289,6 +308,9 @@ func main() {
 		}
 	}
 
+	// The config may point at a database outside the home directory.
+	setDatabaseLocation()
+
 	if options.logFile == "" {
 		// Blank means use the default logfile location. We must set this
 		// *after* expandLocations above.
@@ -374,10 +396,26 @@ func main() {
 	}
 
 	if options.resetDatabase {
-		if err := resetDB(); err != nil {
+		backup, err := resetDB(locations.Get(locations.Database))
+		if err != nil {
 			l.Warnln("Resetting database:", err)
 			os.Exit(syncthing.ExitError.AsInt())
 		}
+		if backup != "" {
+			l.Infoln("The old database was moved to", backup)
+			l.Infoln("It can be removed once Syncthing is running fine again.")
+		}
+		l.Infoln("The database was reset; the configuration is unchanged.")
+		l.Infoln("On the next start all folders are rescanned and the full index is exchanged with all devices. This may take a while for large folders.")
+		return
+	}
+
+	if options.moveDatabase != "" {
+		if err := moveDatabase(options.moveDatabase); err != nil {
+			l.Warnln("Moving database:", err)
+			os.Exit(syncthing.ExitError.AsInt())
+		}
+		l.Infoln("Moved database to", options.moveDatabase)
 		return
 	}
 
@@ -577,8 +615,15 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 		setPauseState(cfg, true)
 	}
 
-	dbFile := locations.Get(locations.Database)
-	ldb, err := syncthing.OpenDBBackend(dbFile, cfg.Options().DatabaseTuning)
+	var ldb backend.Backend
+	if storeURL := cfg.Options().DatabaseStoreURL; storeURL != "" {
+		// The local database is a cache of what's in the object store,
+		// restored from it on startup. It's kept apart from the regular
+		// database, which is left alone.
+		ldb, err = syncthing.OpenDBObjectStore(storeURL, locations.Get(locations.DatabaseCache), cfg.Options().DatabaseTuning)
+	} else {
+		ldb, err = syncthing.OpenDBBackend(locations.Get(locations.Database), cfg.Options().DatabaseTuning)
+	}
 	if err != nil {
 		l.Warnln("Error opening database:", err)
 		os.Exit(1)
@@ -685,6 +730,21 @@ func setupSignalHandling(app *syncthing.App) {
 	}()
 }
 
+// setDatabaseLocation makes the database location follow the config, when
+// it's set there. A config that can't be loaded here is reported later,
+// when loading it for real.
+func setDatabaseLocation() {
+	cfg, err := config.Load(locations.Get(locations.ConfigFile), protocol.EmptyDeviceID, events.NoopLogger)
+	if err != nil {
+		return
+	}
+	if dir := cfg.Options().DatabaseDir; dir != "" {
+		if err := locations.Set(locations.Database, dir); err != nil {
+			l.Warnln("Setting database location:", err)
+		}
+	}
+}
+
 func loadOrDefaultConfig(myID protocol.DeviceID, evLogger events.Logger) (config.Wrapper, error) {
 	cfgFile := locations.Get(locations.ConfigFile)
 	cfg, err := config.Load(cfgFile, myID, evLogger)
@@ -728,8 +788,38 @@ func auditWriter(auditFile string) io.Writer {
 	return fd
 }
 
-func resetDB() error {
-	return os.RemoveAll(locations.Get(locations.Database))
+// resetDB moves the database at the given location aside and creates a
+// fresh, empty one in its place. The configuration is not touched. The old
+// database is kept as a backup, and its new location is returned. The
+// database is only opened after it has been moved, so that no other
+// Syncthing instance can grab it between the check and the move; if it
+// turns out to be in use it is moved back.
+func resetDB(dbDir string) (string, error) {
+	backup := ""
+	if _, err := os.Stat(dbDir); err == nil {
+		backup = fmt.Sprintf("%s.reset-%s", dbDir, time.Now().Format("20060102-150405"))
+		if err := os.Rename(dbDir, backup); err != nil {
+			return "", errors.Wrap(err, "moving database aside (is another instance of Syncthing running?)")
+		}
+		db, err := syncthing.OpenDBBackend(backup, config.TuningAuto)
+		if err != nil {
+			if rerr := os.Rename(backup, dbDir); rerr != nil {
+				return "", errors.Wrapf(rerr, "moving database back from %s", backup)
+			}
+			return "", errors.Wrap(err, "opening database (is another instance of Syncthing running?)")
+		}
+		if err := db.Close(); err != nil {
+			return "", errors.Wrap(err, "closing database")
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	db, err := syncthing.OpenDBBackend(dbDir, config.TuningAuto)
+	if err != nil {
+		return backup, errors.Wrap(err, "creating new database")
+	}
+	return backup, db.Close()
 }
 
 func ensureDir(dir string, mode fs.FileMode) error {
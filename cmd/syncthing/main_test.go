@@ -0,0 +1,91 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/syncthing"
+)
+
+func TestResetDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.xml")
+	cfgData := []byte("<configuration version=\"30\"></configuration>\n")
+	if err := ioutil.WriteFile(cfgFile, cfgData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dbDir := filepath.Join(dir, "index.db")
+	db, err := syncthing.OpenDBBackend(dbDir, config.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resetting must fail while the database is in use.
+
+	if _, err := resetDB(dbDir); err == nil {
+		t.Fatal("unexpected nil error resetting a database in use")
+	}
+	if _, err := db.Get([]byte("key")); err != nil {
+		t.Fatal("database changed by failed reset:", err)
+	}
+	if matches, _ := filepath.Glob(dbDir + ".reset-*"); len(matches) != 0 {
+		t.Fatal("failed reset left a backup behind:", matches)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := resetDB(dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The config is untouched.
+
+	bs, err := ioutil.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, cfgData) {
+		t.Errorf("config changed by reset: %q", bs)
+	}
+
+	// The new database is empty, the old one kept as backup.
+
+	db, err = syncthing.OpenDBBackend(dbDir, config.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("key")); err == nil {
+		t.Error("reset database still contains old data")
+	}
+	db.Close()
+
+	db, err = syncthing.OpenDBBackend(backup, config.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := db.Get([]byte("key")); err != nil || string(val) != "value" {
+		t.Errorf("backup database lost data: %q, %v", val, err)
+	}
+	db.Close()
+}
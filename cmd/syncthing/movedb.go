@@ -0,0 +1,196 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/db/backend"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/locations"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/syncthing"
+
+	"github.com/pkg/errors"
+)
+
+// The number of keys copied between checkpoints of the write transaction,
+// to keep memory usage in check on large databases.
+const moveDBCheckpointKeys = 10000
+
+// Overridden in tests.
+var openDBBackend = syncthing.OpenDBBackend
+
+// moveDatabase moves the database to the given directory and points the
+// config at the new location. It's interrupted by SIGINT/SIGTERM, in which
+// case the database stays where it was.
+func moveDatabase(dstDir string) error {
+	dstDir, err := filepath.Abs(dstDir)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(locations.Get(locations.CertFile), locations.Get(locations.KeyFile))
+	if err != nil {
+		return errors.Wrap(err, "loading certificate")
+	}
+	cfg, err := config.Load(locations.Get(locations.ConfigFile), protocol.NewDeviceID(cert.Certificate[0]), events.NoopLogger)
+	if err != nil {
+		return errors.Wrap(err, "loading config")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopSign := make(chan os.Signal, 1)
+	signal.Notify(stopSign, os.Interrupt, syscall.Signal(15))
+	defer signal.Stop(stopSign)
+	go func() {
+		select {
+		case <-stopSign:
+			l.Infoln("Interrupted, cancelling database move")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return moveDB(ctx, locations.Get(locations.Database), dstDir, func() error {
+		opts := cfg.Options()
+		opts.DatabaseDir = dstDir
+		if _, err := cfg.SetOptions(opts); err != nil {
+			return err
+		}
+		return cfg.Save()
+	})
+}
+
+// moveDB copies the database in srcDir to dstDir, verifies the copy and
+// calls commit to start using the new location. Only when all of that
+// succeeded the old database is removed, otherwise the new one is. The
+// source database is kept open, and thus locked, throughout.
+func moveDB(ctx context.Context, srcDir, dstDir string, commit func() error) error {
+	if _, err := os.Stat(srcDir); err != nil {
+		return errors.Wrap(err, "no database to move")
+	}
+	if _, err := os.Stat(dstDir); err == nil {
+		return fmt.Errorf("%s already exists", dstDir)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	src, err := openDBBackend(srcDir, config.TuningAuto)
+	if err != nil {
+		return errors.Wrap(err, "opening database (is another instance of Syncthing running?)")
+	}
+
+	err = moveDBContents(ctx, src, dstDir)
+	if err == nil {
+		err = commit()
+	}
+	if err != nil {
+		src.Close()
+		if rerr := os.RemoveAll(dstDir); rerr != nil {
+			l.Warnln("Removing incomplete database copy:", rerr)
+		}
+		return err
+	}
+
+	if err := src.Close(); err != nil {
+		return errors.Wrap(err, "closing old database")
+	}
+	return errors.Wrap(os.RemoveAll(srcDir), "removing old database")
+}
+
+// moveDBContents creates a new database in dstDir with a verified copy of
+// everything in src.
+func moveDBContents(ctx context.Context, src backend.Backend, dstDir string) error {
+	dst, err := openDBBackend(dstDir, config.TuningAuto)
+	if err != nil {
+		return errors.Wrap(err, "creating new database")
+	}
+	err = copyDB(ctx, src, dst)
+	if err == nil {
+		err = verifyDB(ctx, src, dst)
+	}
+	if cerr := dst.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "closing new database")
+	}
+	return err
+}
+
+func copyDB(ctx context.Context, src, dst backend.Backend) error {
+	it, err := src.NewPrefixIterator(nil)
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	t, err := dst.NewWriteTransaction()
+	if err != nil {
+		return err
+	}
+	defer t.Release()
+
+	n := 0
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := t.Put(it.Key(), it.Value()); err != nil {
+			return errors.Wrap(err, "copying database")
+		}
+		if n++; n%moveDBCheckpointKeys == 0 {
+			if err := t.Checkpoint(); err != nil {
+				return errors.Wrap(err, "copying database")
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return errors.Wrap(err, "reading database")
+	}
+	return errors.Wrap(t.Commit(), "copying database")
+}
+
+// verifyDB checks that dst contains exactly the same keys and values as src.
+func verifyDB(ctx context.Context, src, dst backend.Backend) error {
+	srcIt, err := src.NewPrefixIterator(nil)
+	if err != nil {
+		return err
+	}
+	defer srcIt.Release()
+	dstIt, err := dst.NewPrefixIterator(nil)
+	if err != nil {
+		return err
+	}
+	defer dstIt.Release()
+
+	for srcIt.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !dstIt.Next() {
+			return fmt.Errorf("verifying copy: key %x missing", srcIt.Key())
+		}
+		if !bytes.Equal(srcIt.Key(), dstIt.Key()) || !bytes.Equal(srcIt.Value(), dstIt.Value()) {
+			return fmt.Errorf("verifying copy: key %x differs", srcIt.Key())
+		}
+	}
+	if dstIt.Next() {
+		return fmt.Errorf("verifying copy: unexpected key %x", dstIt.Key())
+	}
+	if err := srcIt.Error(); err != nil {
+		return errors.Wrap(err, "reading database")
+	}
+	return errors.Wrap(dstIt.Error(), "reading copied database")
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/db/backend"
+	"github.com/syncthing/syncthing/lib/syncthing"
+)
+
+const testDBKeys = 100
+
+func createTestDB(t *testing.T, dir string) {
+	t.Helper()
+	db, err := syncthing.OpenDBBackend(dir, config.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < testDBKeys; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkTestDB(t *testing.T, dir string) {
+	t.Helper()
+	db, err := syncthing.OpenDBBackend(dir, config.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < testDBKeys; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key%03d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("wrong value %q for key %d", val, i)
+		}
+	}
+}
+
+// failingBackend fails writes in transactions after a number of keys.
+type failingBackend struct {
+	backend.Backend
+	left int
+}
+
+func (b *failingBackend) NewWriteTransaction() (backend.WriteTransaction, error) {
+	t, err := b.Backend.NewWriteTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &failingTransaction{t, b}, nil
+}
+
+type failingTransaction struct {
+	backend.WriteTransaction
+	b *failingBackend
+}
+
+func (t *failingTransaction) Put(key, val []byte) error {
+	if t.b.left == 0 {
+		return errors.New("disk full")
+	}
+	t.b.left--
+	return t.WriteTransaction.Put(key, val)
+}
+
+func TestMoveDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "index.db")
+	dstDir := filepath.Join(dir, "other", "index.db")
+	createTestDB(t, srcDir)
+
+	committed := false
+	commit := func() error {
+		committed = true
+		return nil
+	}
+
+	// The copy fails midway.
+
+	openDBBackend = func(path string, tuning config.Tuning) (backend.Backend, error) {
+		db, err := syncthing.OpenDBBackend(path, tuning)
+		if err != nil || path != dstDir {
+			return db, err
+		}
+		return &failingBackend{db, testDBKeys / 2}, nil
+	}
+	defer func() { openDBBackend = syncthing.OpenDBBackend }()
+
+	if err := moveDB(context.Background(), srcDir, dstDir, commit); err == nil {
+		t.Fatal("unexpected nil error when copy fails")
+	}
+	if committed {
+		t.Error("failed move was committed")
+	}
+	if _, err := os.Stat(dstDir); !os.IsNotExist(err) {
+		t.Error("incomplete copy was not removed:", err)
+	}
+	checkTestDB(t, srcDir)
+
+	// An interrupted move leaves everything as it was.
+
+	openDBBackend = syncthing.OpenDBBackend
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := moveDB(ctx, srcDir, dstDir, commit); err == nil {
+		t.Fatal("unexpected nil error when interrupted")
+	}
+	if committed {
+		t.Error("interrupted move was committed")
+	}
+	if _, err := os.Stat(dstDir); !os.IsNotExist(err) {
+		t.Error("incomplete copy was not removed:", err)
+	}
+	checkTestDB(t, srcDir)
+
+	// A successful move.
+
+	if err := moveDB(context.Background(), srcDir, dstDir, commit); err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Error("move was not committed")
+	}
+	if _, err := os.Stat(srcDir); !os.IsNotExist(err) {
+		t.Error("old database was not removed:", err)
+	}
+	checkTestDB(t, dstDir)
+}
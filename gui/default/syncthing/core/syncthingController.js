@@ -122,6 +122,7 @@ angular.module('syncthing.core')
             refreshSystem();
             refreshDiscoveryCache();
             refreshConfig();
+            refreshFolderDefaults();
             refreshConnectionStats();
             refreshDeviceStats();
             refreshFolderStats();
@@ -580,6 +581,15 @@ angular.module('syncthing.core')
             }).error($scope.emitHTTPError);
         }
 
+        function refreshFolderDefaults() {
+            $http.get(urlbase + '/system/config/defaults').success(function (data) {
+                ['type', 'rescanIntervalS', 'fsWatcherEnabled', 'fsWatcherDelayS', 'minDiskFree', 'maxConflicts', 'order', 'autoNormalize'].forEach(function (key) {
+                    $scope.folderDefaults[key] = angular.copy(data.folder[key]);
+                });
+                console.log("refreshFolderDefaults", data);
+            }).error($scope.emitHTTPError);
+        }
+
         function refreshNeed(folder) {
             if (!$scope.neededFolder) {
                 return;
@@ -799,7 +809,7 @@ angular.module('syncthing.core')
             }
 
             var state = '' + folderInfo.state;
-            if (state === 'error') {
+            if (state === 'error' || state === 'marker-missing') {
                 return 'stopped'; // legacy, the state is called "stopped" in the GUI
             }
 
@@ -1496,20 +1506,33 @@ angular.module('syncthing.core')
                 });
         };
 
+        $scope.introducedDevices = function (deviceID) {
+            return $scope.devices.filter(function (n) {
+                return n.introducedBy === deviceID;
+            }).map(function (n) {
+                return n.deviceID;
+            });
+        };
+
         $scope.deleteDevice = function () {
             $('#editDevice').modal('hide');
             if (!$scope.editingExisting) {
                 return;
             }
 
+            var removed = [$scope.currentDevice.deviceID];
+            if ($scope.currentDevice._removeIntroduced) {
+                removed = removed.concat($scope.introducedDevices($scope.currentDevice.deviceID));
+            }
+
             $scope.devices = $scope.devices.filter(function (n) {
-                return n.deviceID !== $scope.currentDevice.deviceID;
+                return removed.indexOf(n.deviceID) === -1;
             });
             $scope.config.devices = $scope.devices;
 
             for (var id in $scope.folders) {
                 $scope.folders[id].devices = $scope.folders[id].devices.filter(function (n) {
-                    return n.deviceID !== $scope.currentDevice.deviceID;
+                    return removed.indexOf(n.deviceID) === -1;
                 });
             }
 
@@ -29,6 +29,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	stdsync "sync"
 	"time"
 
 	metrics "github.com/rcrowley/go-metrics"
@@ -59,11 +60,12 @@ import (
 var bcryptExpr = regexp.MustCompile(`^\$2[aby]\$\d+\$.{50,}`)
 
 const (
-	DefaultEventMask      = events.AllEvents &^ events.LocalChangeDetected &^ events.RemoteChangeDetected
-	DiskEventMask         = events.LocalChangeDetected | events.RemoteChangeDetected
-	EventSubBufferSize    = 1000
-	defaultEventTimeout   = time.Minute
-	httpsCertLifetimeDays = 820
+	DefaultEventMask        = events.AllEvents &^ events.LocalChangeDetected &^ events.RemoteChangeDetected
+	DiskEventMask           = events.LocalChangeDetected | events.RemoteChangeDetected
+	EventSubBufferSize      = 1000
+	defaultEventTimeout     = time.Minute
+	httpsCertLifetimeDays   = 820
+	connectivityTestTimeout = 30 * time.Second
 )
 
 type service struct {
@@ -81,6 +83,7 @@ type service struct {
 	fss                  model.FolderSummaryService
 	urService            *ur.Service
 	systemConfigMut      sync.Mutex // serializes posts to /rest/system/config
+	snapshotMut          sync.Mutex // serializes posts to /rest/system/snapshot
 	cpu                  Rater
 	contr                Controller
 	noUpgrade            bool
@@ -90,6 +93,10 @@ type service struct {
 	startedOnce          chan struct{} // the service has started successfully at least once
 	startupErr           error
 	listenerAddr         net.Addr
+	startupSub           events.Subscription // for the health check
+	startupComplete      chan struct{}       // the app has started, as far as the health check is concerned
+	stopping             chan struct{}
+	stopOnce             stdsync.Once
 
 	guiErrors logger.Recorder
 	systemLog logger.Recorder
@@ -128,6 +135,7 @@ func New(id protocol.DeviceID, cfg config.Wrapper, assetDir, tlsDefaultCommonNam
 		fss:                  fss,
 		urService:            urService,
 		systemConfigMut:      sync.NewMutex(),
+		snapshotMut:          sync.NewMutex(),
 		guiErrors:            errors,
 		systemLog:            systemLog,
 		cpu:                  cpu,
@@ -136,6 +144,9 @@ func New(id protocol.DeviceID, cfg config.Wrapper, assetDir, tlsDefaultCommonNam
 		tlsDefaultCommonName: tlsDefaultCommonName,
 		configChanged:        make(chan struct{}),
 		startedOnce:          make(chan struct{}),
+		startupSub:           evLogger.Subscribe(events.StartupComplete),
+		startupComplete:      make(chan struct{}),
+		stopping:             make(chan struct{}),
 	}
 	s.Service = util.AsService(s.serve, s.String())
 	return s
@@ -236,59 +247,71 @@ func (s *service) serve(ctx context.Context) {
 	s.listenerAddr = listener.Addr()
 	defer listener.Close()
 
+	startupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.awaitStartup(startupCtx)
+
 	s.cfg.Subscribe(s)
 	defer s.cfg.Unsubscribe(s)
 
 	// The GET handlers
 	getRestMux := http.NewServeMux()
-	getRestMux.HandleFunc("/rest/db/completion", s.getDBCompletion)              // device folder
-	getRestMux.HandleFunc("/rest/db/file", s.getDBFile)                          // folder file
-	getRestMux.HandleFunc("/rest/db/ignores", s.getDBIgnores)                    // folder
-	getRestMux.HandleFunc("/rest/db/need", s.getDBNeed)                          // folder [perpage] [page]
-	getRestMux.HandleFunc("/rest/db/remoteneed", s.getDBRemoteNeed)              // device folder [perpage] [page]
-	getRestMux.HandleFunc("/rest/db/localchanged", s.getDBLocalChanged)          // folder
-	getRestMux.HandleFunc("/rest/db/status", s.getDBStatus)                      // folder
-	getRestMux.HandleFunc("/rest/db/browse", s.getDBBrowse)                      // folder [prefix] [dirsonly] [levels]
-	getRestMux.HandleFunc("/rest/folder/versions", s.getFolderVersions)          // folder
-	getRestMux.HandleFunc("/rest/folder/errors", s.getFolderErrors)              // folder
-	getRestMux.HandleFunc("/rest/folder/pullerrors", s.getFolderErrors)          // folder (deprecated)
-	getRestMux.HandleFunc("/rest/events", s.getIndexEvents)                      // [since] [limit] [timeout] [events]
-	getRestMux.HandleFunc("/rest/events/disk", s.getDiskEvents)                  // [since] [limit] [timeout]
-	getRestMux.HandleFunc("/rest/stats/device", s.getDeviceStats)                // -
-	getRestMux.HandleFunc("/rest/stats/folder", s.getFolderStats)                // -
-	getRestMux.HandleFunc("/rest/svc/deviceid", s.getDeviceID)                   // id
-	getRestMux.HandleFunc("/rest/svc/lang", s.getLang)                           // -
-	getRestMux.HandleFunc("/rest/svc/report", s.getReport)                       // -
-	getRestMux.HandleFunc("/rest/svc/random/string", s.getRandomString)          // [length]
-	getRestMux.HandleFunc("/rest/system/browse", s.getSystemBrowse)              // current
-	getRestMux.HandleFunc("/rest/system/config", s.getSystemConfig)              // -
-	getRestMux.HandleFunc("/rest/system/config/insync", s.getSystemConfigInsync) // -
-	getRestMux.HandleFunc("/rest/system/connections", s.getSystemConnections)    // -
-	getRestMux.HandleFunc("/rest/system/discovery", s.getSystemDiscovery)        // -
-	getRestMux.HandleFunc("/rest/system/error", s.getSystemError)                // -
-	getRestMux.HandleFunc("/rest/system/ping", s.restPing)                       // -
-	getRestMux.HandleFunc("/rest/system/status", s.getSystemStatus)              // -
-	getRestMux.HandleFunc("/rest/system/upgrade", s.getSystemUpgrade)            // -
-	getRestMux.HandleFunc("/rest/system/version", s.getSystemVersion)            // -
-	getRestMux.HandleFunc("/rest/system/debug", s.getSystemDebug)                // -
-	getRestMux.HandleFunc("/rest/system/log", s.getSystemLog)                    // [since]
-	getRestMux.HandleFunc("/rest/system/log.txt", s.getSystemLogTxt)             // [since]
+	getRestMux.HandleFunc("/rest/db/completion", s.getDBCompletion)                  // device folder
+	getRestMux.HandleFunc("/rest/db/file", s.getDBFile)                              // folder file
+	getRestMux.HandleFunc("/rest/db/ignores", s.getDBIgnores)                        // folder
+	getRestMux.HandleFunc("/rest/db/need", s.getDBNeed)                              // folder [perpage] [page]
+	getRestMux.HandleFunc("/rest/db/remoteneed", s.getDBRemoteNeed)                  // device folder [perpage] [page]
+	getRestMux.HandleFunc("/rest/db/localchanged", s.getDBLocalChanged)              // folder
+	getRestMux.HandleFunc("/rest/db/status", s.getDBStatus)                          // folder
+	getRestMux.HandleFunc("/rest/db/browse", s.getDBBrowse)                          // folder [prefix] [dirsonly] [levels]
+	getRestMux.HandleFunc("/rest/folder/versions", s.getFolderVersions)              // folder
+	getRestMux.HandleFunc("/rest/folder/errors", s.getFolderErrors)                  // folder
+	getRestMux.HandleFunc("/rest/folder/pulldryrun", s.getFolderPullDryRun)          // folder
+	getRestMux.HandleFunc("/rest/folder/pullerrors", s.getFolderErrors)              // folder (deprecated)
+	getRestMux.HandleFunc("/rest/events", s.getIndexEvents)                          // [since] [limit] [timeout] [events] [folder] [device]
+	getRestMux.HandleFunc("/rest/events/disk", s.getDiskEvents)                      // [since] [limit] [timeout] [folder] [device]
+	getRestMux.HandleFunc("/rest/stats/device", s.getDeviceStats)                    // -
+	getRestMux.HandleFunc("/rest/stats/folder", s.getFolderStats)                    // -
+	getRestMux.HandleFunc("/rest/svc/deviceid", s.getDeviceID)                       // id
+	getRestMux.HandleFunc("/rest/svc/lang", s.getLang)                               // -
+	getRestMux.HandleFunc("/rest/svc/report", s.getReport)                           // -
+	getRestMux.HandleFunc("/rest/svc/random/string", s.getRandomString)              // [length]
+	getRestMux.HandleFunc("/rest/system/browse", s.getSystemBrowse)                  // current
+	getRestMux.HandleFunc("/rest/system/config", s.getSystemConfig)                  // -
+	getRestMux.HandleFunc("/rest/system/config/insync", s.getSystemConfigInsync)     // -
+	getRestMux.HandleFunc("/rest/system/config/defaults", s.getSystemConfigDefaults) // -
+	getRestMux.HandleFunc("/rest/system/connections", s.getSystemConnections)        // -
+	getRestMux.HandleFunc("/rest/system/connections/attempts", s.getConnAttempts)    // device
+	getRestMux.HandleFunc("/rest/system/discovery", s.getSystemDiscovery)            // -
+	getRestMux.HandleFunc("/rest/system/error", s.getSystemError)                    // -
+	getRestMux.HandleFunc("/rest/system/ping", s.restPing)                           // -
+	getRestMux.HandleFunc("/rest/system/status", s.getSystemStatus)                  // -
+	getRestMux.HandleFunc("/rest/system/upgrade", s.getSystemUpgrade)                // -
+	getRestMux.HandleFunc("/rest/system/version", s.getSystemVersion)                // -
+	getRestMux.HandleFunc("/rest/system/debug", s.getSystemDebug)                    // -
+	getRestMux.HandleFunc("/rest/system/log", s.getSystemLog)                        // [since]
+	getRestMux.HandleFunc("/rest/system/log.txt", s.getSystemLogTxt)                 // [since]
+	getRestMux.HandleFunc("/rest/noauth/health", s.getHealth)                        // -
 
 	// The POST handlers
 	postRestMux := http.NewServeMux()
 	postRestMux.HandleFunc("/rest/db/prio", s.postDBPrio)                          // folder file [perpage] [page]
 	postRestMux.HandleFunc("/rest/db/ignores", s.postDBIgnores)                    // folder
-	postRestMux.HandleFunc("/rest/db/override", s.postDBOverride)                  // folder
-	postRestMux.HandleFunc("/rest/db/revert", s.postDBRevert)                      // folder
+	postRestMux.HandleFunc("/rest/db/override", s.postDBOverride)                  // folder [sub...]
+	postRestMux.HandleFunc("/rest/db/revert", s.postDBRevert)                      // folder [sub...]
+	postRestMux.HandleFunc("/rest/db/reverttoglobal", s.postDBRevertToGlobal)      // folder file
 	postRestMux.HandleFunc("/rest/db/scan", s.postDBScan)                          // folder [sub...] [delay]
 	postRestMux.HandleFunc("/rest/folder/versions", s.postFolderVersionsRestore)   // folder <body>
+	postRestMux.HandleFunc("/rest/folder/errors/clear", s.postFolderErrorClear)    // folder file
 	postRestMux.HandleFunc("/rest/system/config", s.postSystemConfig)              // <body>
+	postRestMux.HandleFunc("/rest/system/connections/test", s.postConnTest)        // device
 	postRestMux.HandleFunc("/rest/system/error", s.postSystemError)                // <body>
 	postRestMux.HandleFunc("/rest/system/error/clear", s.postSystemErrorClear)     // -
 	postRestMux.HandleFunc("/rest/system/ping", s.restPing)                        // -
 	postRestMux.HandleFunc("/rest/system/reset", s.postSystemReset)                // [folder]
 	postRestMux.HandleFunc("/rest/system/restart", s.postSystemRestart)            // -
 	postRestMux.HandleFunc("/rest/system/shutdown", s.postSystemShutdown)          // -
+	postRestMux.HandleFunc("/rest/system/snapshot", s.postSystemSnapshot)          // -
 	postRestMux.HandleFunc("/rest/system/upgrade", s.postSystemUpgrade)            // -
 	postRestMux.HandleFunc("/rest/system/pause", s.makeDevicePauseHandler(true))   // [device]
 	postRestMux.HandleFunc("/rest/system/resume", s.makeDevicePauseHandler(false)) // [device]
@@ -312,6 +335,10 @@ func (s *service) serve(ctx context.Context) {
 	mux.Handle("/rest/", restMux)
 	mux.HandleFunc("/qr/", s.getQR)
 
+	// Metrics for Prometheus, outside of /rest as scrapers can't do the
+	// CSRF dance. They're only available with authentication, see below.
+	mux.Handle("/metrics", s.whenAuthenticated(s.prometheusHandler()))
+
 	// Serve compiled in assets unless an asset directory was set (for development)
 	mux.Handle("/", s.statics)
 
@@ -401,6 +428,26 @@ func (s *service) serve(ctx context.Context) {
 	srv.Close()
 }
 
+// Stop stops the API service. The health check fails from here on. It's
+// safe to call more than once.
+func (s *service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+		s.Service.Stop()
+		s.startupSub.Unsubscribe()
+	})
+}
+
+// awaitStartup waits for the app to have started all its services.
+func (s *service) awaitStartup(ctx context.Context) {
+	select {
+	case <-s.startupComplete:
+	case <-s.startupSub.C():
+		close(s.startupComplete)
+	case <-ctx.Done():
+	}
+}
+
 // Complete implements suture.IsCompletable, which signifies to the supervisor
 // whether to stop restarting the service.
 func (s *service) Complete() bool {
@@ -595,6 +642,43 @@ func (s *service) whenDebugging(h http.Handler) http.Handler {
 	})
 }
 
+// whenAuthenticated serves requests that either passed the GUI
+// authentication or carry the API key. Without either, anyone able to reach
+// the GUI would be let through.
+func (s *service) whenAuthenticated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guiCfg := s.cfg.GUI()
+		if guiCfg.IsAuthEnabled() || guiCfg.IsValidAPIKey(r.Header.Get("X-API-Key")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		http.Error(w, "Authentication required", http.StatusForbidden)
+	})
+}
+
+// getHealth is a cheap check, without authentication, of whether we're up
+// and running with a usable database.
+func (s *service) getHealth(w http.ResponseWriter, r *http.Request) {
+	status, code := "OK", http.StatusOK
+	select {
+	case <-s.stopping:
+		status, code = "stopping", http.StatusServiceUnavailable
+	default:
+		select {
+		case <-s.startupComplete:
+			if !s.model.DatabaseOpen() {
+				status, code = "database closed", http.StatusServiceUnavailable
+			}
+		default:
+			status, code = "starting", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
 func (s *service) restPing(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, map[string]string{"ping": "pong"})
 }
@@ -690,15 +774,34 @@ func (s *service) getDBStatus(w http.ResponseWriter, r *http.Request) {
 func (s *service) postDBOverride(w http.ResponseWriter, r *http.Request) {
 	var qs = r.URL.Query()
 	var folder = qs.Get("folder")
+	if subs := qs["sub"]; len(subs) > 0 {
+		if err := s.model.OverrideSubpaths(folder, subs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 	go s.model.Override(folder)
 }
 
 func (s *service) postDBRevert(w http.ResponseWriter, r *http.Request) {
 	var qs = r.URL.Query()
 	var folder = qs.Get("folder")
+	if subs := qs["sub"]; len(subs) > 0 {
+		if err := s.model.RevertSubpaths(folder, subs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 	go s.model.Revert(folder)
 }
 
+func (s *service) postDBRevertToGlobal(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if err := s.model.RevertToGlobal(qs.Get("folder"), qs.Get("file")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func getPagingParams(qs url.Values) (int, int) {
 	page, err := strconv.Atoi(qs.Get("page"))
 	if err != nil || page < 1 {
@@ -774,6 +877,31 @@ func (s *service) getSystemConnections(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, s.model.ConnectionStats())
 }
 
+func (s *service) getConnAttempts(w http.ResponseWriter, r *http.Request) {
+	deviceID, err := protocol.DeviceIDFromString(r.URL.Query().Get("device"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sendJSON(w, s.model.ConnectionAttempts(deviceID))
+}
+
+func (s *service) postConnTest(w http.ResponseWriter, r *http.Request) {
+	deviceID, err := protocol.DeviceIDFromString(r.URL.Query().Get("device"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), connectivityTestTimeout)
+	defer cancel()
+	res, err := s.model.TestDeviceConnectivity(ctx, deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sendJSON(w, res)
+}
+
 func (s *service) getDeviceStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := s.model.DeviceStatistics()
 	if err != nil {
@@ -864,6 +992,10 @@ func (s *service) getSystemConfigInsync(w http.ResponseWriter, r *http.Request)
 	sendJSON(w, map[string]bool{"configInSync": !s.cfg.RequiresRestart()})
 }
 
+func (s *service) getSystemConfigDefaults(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, config.Defaults())
+}
+
 func (s *service) postSystemRestart(w http.ResponseWriter, r *http.Request) {
 	s.flushResponse(`{"ok": "restarting"}`, w)
 	go s.contr.Restart()
@@ -933,6 +1065,7 @@ func (s *service) getSystemStatus(w http.ResponseWriter, r *http.Request) {
 
 	res["connectionServiceStatus"] = s.connectionsService.ListenerStatus()
 	res["lastDialStatus"] = s.connectionsService.ConnectionStatus()
+	res["dialBackoff"] = s.connectionsService.DialBackoff()
 	// cpuUsage.Rate() is in milliseconds per second, so dividing by ten
 	// gives us percent
 	res["cpuPercent"] = s.cpu.Rate() / 10 / float64(runtime.NumCPU())
@@ -1214,6 +1347,16 @@ func (s *service) getEvents(w http.ResponseWriter, r *http.Request, eventSub eve
 		timeout = time.Duration(timeoutSec) * time.Second
 	}
 
+	filter := eventFilter{folder: qs.Get("folder")}
+	if deviceStr := qs.Get("device"); deviceStr != "" {
+		device, err := protocol.DeviceIDFromString(deviceStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.device = device.String()
+	}
+
 	// Flush before blocking, to indicate that we've received the request and
 	// that it should not be retried. Must set Content-Type header before
 	// flushing.
@@ -1222,7 +1365,7 @@ func (s *service) getEvents(w http.ResponseWriter, r *http.Request, eventSub eve
 	f.Flush()
 
 	// If there are no events available return an empty slice, as this gets serialized as `[]`
-	evs := eventSub.Since(since, []events.Event{}, timeout)
+	evs := filter.since(eventSub, since, timeout)
 	if 0 < limit && limit < len(evs) {
 		evs = evs[len(evs)-limit:]
 	}
@@ -1230,6 +1373,71 @@ func (s *service) getEvents(w http.ResponseWriter, r *http.Request, eventSub eve
 	sendJSON(w, evs)
 }
 
+// eventFilter selects the events concerning the given folder and device.
+// Events that concern no folder or no device at all are always selected.
+type eventFilter struct {
+	folder string
+	device string
+}
+
+// since returns the selected events after the given one, waiting until
+// there are any or the timeout expires.
+func (f eventFilter) since(sub events.BufferedSubscription, since int, timeout time.Duration) []events.Event {
+	if f.folder == "" && f.device == "" {
+		return sub.Since(since, []events.Event{}, timeout)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		evs := sub.Since(since, nil, time.Until(deadline))
+		selected := make([]events.Event, 0, len(evs))
+		for _, ev := range evs {
+			if f.matches(ev) {
+				selected = append(selected, ev)
+			}
+		}
+		if len(selected) > 0 || len(evs) == 0 || !time.Now().Before(deadline) {
+			return selected
+		}
+		// Only events we're not interested in, keep waiting.
+		since = evs[len(evs)-1].SubscriptionID
+	}
+}
+
+func (f eventFilter) matches(ev events.Event) bool {
+	if f.folder != "" {
+		if folder, ok := eventDataString(ev.Data, "folder"); ok && folder != f.folder {
+			return false
+		}
+	}
+	if f.device != "" {
+		// Most events name the device "device", the connection events
+		// "id".
+		device, ok := eventDataString(ev.Data, "device")
+		if !ok && (ev.Type == events.DeviceConnected || ev.Type == events.DeviceDisconnected) {
+			device, ok = eventDataString(ev.Data, "id")
+		}
+		if ok && device != f.device {
+			return false
+		}
+	}
+	return true
+}
+
+// eventDataString returns the string value of the given key in the event
+// data, if there is one.
+func eventDataString(data interface{}, key string) (string, bool) {
+	switch data := data.(type) {
+	case map[string]string:
+		v, ok := data[key]
+		return v, ok
+	case map[string]interface{}:
+		v, ok := data[key].(string)
+		return v, ok
+	}
+	return "", false
+}
+
 func (s *service) getEventMask(evs string) events.EventType {
 	eventMask := DefaultEventMask
 	if evs != "" {
@@ -1387,7 +1595,10 @@ func (s *service) postDBPrio(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	folder := qs.Get("folder")
 	file := qs.Get("file")
-	s.model.BringToFront(folder, file)
+	if err := s.model.PrioritizeFile(folder, file); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	s.getDBNeed(w, r)
 }
 
@@ -1463,36 +1674,44 @@ func (s *service) postFolderVersionsRestore(w http.ResponseWriter, r *http.Reque
 	sendJSON(w, ferr)
 }
 
+func (s *service) getFolderPullDryRun(w http.ResponseWriter, r *http.Request) {
+	folder := r.URL.Query().Get("folder")
+	actions, err := s.model.DryRunPull(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, actions)
+}
+
 func (s *service) getFolderErrors(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	folder := qs.Get("folder")
 	page, perpage := getPagingParams(qs)
 
-	errors, err := s.model.FolderErrors(folder)
+	errors, total, err := s.model.FolderErrors(folder, (page-1)*perpage, perpage)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	start := (page - 1) * perpage
-	if start >= len(errors) {
-		errors = nil
-	} else {
-		errors = errors[start:]
-		if perpage < len(errors) {
-			errors = errors[:perpage]
-		}
-	}
-
 	sendJSON(w, map[string]interface{}{
 		"folder":  folder,
 		"errors":  errors,
+		"total":   total,
 		"page":    page,
 		"perpage": perpage,
 	})
 }
 
+func (s *service) postFolderErrorClear(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if err := s.model.ClearFolderError(qs.Get("folder"), qs.Get("file")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
 func (s *service) getSystemBrowse(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	current := qs.Get("current")
@@ -35,9 +35,15 @@ func emitLoginAttempt(success bool, username string, evLogger events.Logger) {
 	})
 }
 
+// isNoAuthPath returns true for the paths that are available without
+// authentication. They must not expose anything sensitive.
+func isNoAuthPath(path string) bool {
+	return strings.HasPrefix(path, "/rest/noauth/")
+}
+
 func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfiguration, ldapCfg config.LDAPConfiguration, next http.Handler, evLogger events.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if guiCfg.IsValidAPIKey(r.Header.Get("X-API-Key")) {
+		if guiCfg.IsValidAPIKey(r.Header.Get("X-API-Key")) || isNoAuthPath(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
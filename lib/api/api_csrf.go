@@ -66,6 +66,12 @@ func (m *csrfManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isNoAuthPath(r.URL.Path) {
+		// Meant for tools that can't authenticate
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/rest/debug") {
 		// Debugging functions are only available when explicitly
 		// enabled, and can be accessed without a CSRF token
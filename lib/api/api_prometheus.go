@@ -0,0 +1,181 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/model"
+)
+
+var (
+	promConnectedDevices = prometheus.NewDesc(
+		"syncthing_connections_connected_devices",
+		"Number of devices currently connected.",
+		nil, nil)
+	promDeviceConnected = prometheus.NewDesc(
+		"syncthing_connections_device_connected",
+		"Whether the device is currently connected.",
+		[]string{"device"}, nil)
+	promDeviceBytesReceived = prometheus.NewDesc(
+		"syncthing_connections_device_received_bytes_total",
+		"Bytes received from the device over the current connection.",
+		[]string{"device"}, nil)
+	promDeviceBytesSent = prometheus.NewDesc(
+		"syncthing_connections_device_sent_bytes_total",
+		"Bytes sent to the device over the current connection.",
+		[]string{"device"}, nil)
+	promBytesReceived = prometheus.NewDesc(
+		"syncthing_connections_received_bytes_total",
+		"Bytes received from all devices.",
+		nil, nil)
+	promBytesSent = prometheus.NewDesc(
+		"syncthing_connections_sent_bytes_total",
+		"Bytes sent to all devices.",
+		nil, nil)
+	promLastDialSuccess = prometheus.NewDesc(
+		"syncthing_connections_last_dial_success",
+		"Whether the latest dial of the address succeeded.",
+		[]string{"address"}, nil)
+	promLastDialTimestamp = prometheus.NewDesc(
+		"syncthing_connections_last_dial_timestamp_seconds",
+		"Time of the latest dial of the address.",
+		[]string{"address"}, nil)
+	promFolderCompletion = prometheus.NewDesc(
+		"syncthing_folder_completion_percent",
+		"Completion of the folder on the device, including the local device.",
+		[]string{"folder", "device"}, nil)
+	promFolderScanDuration = prometheus.NewDesc(
+		"syncthing_folder_last_scan_duration_seconds",
+		"Duration of the latest scan of the folder, among the recent events.",
+		[]string{"folder"}, nil)
+)
+
+// prometheusCollector exposes the statistics already kept by the model and
+// the connection service in the Prometheus format, gathered at the time of
+// the scrape.
+type prometheusCollector struct {
+	s *service
+}
+
+func (s *service) prometheusHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheusCollector{s})
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+func (c prometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- promConnectedDevices
+	ch <- promDeviceConnected
+	ch <- promDeviceBytesReceived
+	ch <- promDeviceBytesSent
+	ch <- promBytesReceived
+	ch <- promBytesSent
+	ch <- promLastDialSuccess
+	ch <- promLastDialTimestamp
+	ch <- promFolderCompletion
+	ch <- promFolderScanDuration
+}
+
+func (c prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collectConnections(ch)
+	c.collectDialStatus(ch)
+	c.collectFolders(ch)
+	c.collectScanDurations(ch)
+}
+
+func (c prometheusCollector) collectConnections(ch chan<- prometheus.Metric) {
+	stats := c.s.model.ConnectionStats()
+
+	conns, _ := stats["connections"].(map[string]model.ConnectionInfo)
+	connected := 0
+	for device, ci := range conns {
+		if !ci.Connected {
+			ch <- prometheus.MustNewConstMetric(promDeviceConnected, prometheus.GaugeValue, 0, device)
+			continue
+		}
+		connected++
+		ch <- prometheus.MustNewConstMetric(promDeviceConnected, prometheus.GaugeValue, 1, device)
+		ch <- prometheus.MustNewConstMetric(promDeviceBytesReceived, prometheus.CounterValue, float64(ci.InBytesTotal), device)
+		ch <- prometheus.MustNewConstMetric(promDeviceBytesSent, prometheus.CounterValue, float64(ci.OutBytesTotal), device)
+	}
+	ch <- prometheus.MustNewConstMetric(promConnectedDevices, prometheus.GaugeValue, float64(connected))
+
+	if total, ok := stats["total"].(model.ConnectionInfo); ok {
+		ch <- prometheus.MustNewConstMetric(promBytesReceived, prometheus.CounterValue, float64(total.InBytesTotal))
+		ch <- prometheus.MustNewConstMetric(promBytesSent, prometheus.CounterValue, float64(total.OutBytesTotal))
+	}
+}
+
+func (c prometheusCollector) collectDialStatus(ch chan<- prometheus.Metric) {
+	for addr, status := range c.s.connectionsService.ConnectionStatus() {
+		success := 1.0
+		if status.Error != nil {
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(promLastDialSuccess, prometheus.GaugeValue, success, addr)
+		ch <- prometheus.MustNewConstMetric(promLastDialTimestamp, prometheus.GaugeValue, float64(status.When.UnixNano())/1e9, addr)
+	}
+}
+
+func (c prometheusCollector) collectFolders(ch chan<- prometheus.Metric) {
+	for _, folder := range c.s.cfg.FolderList() {
+		if folder.Paused {
+			continue
+		}
+
+		// Our own completion is what we have of the global state.
+		local := 100.0
+		if global := c.s.model.GlobalSize(folder.ID); global.Bytes > 0 {
+			need := c.s.model.NeedSize(folder.ID)
+			local = 100 * (1 - float64(need.Bytes)/float64(global.Bytes))
+		}
+		ch <- prometheus.MustNewConstMetric(promFolderCompletion, prometheus.GaugeValue, local, folder.ID, c.s.id.String())
+
+		for _, device := range folder.DeviceIDs() {
+			if device == c.s.id {
+				continue
+			}
+			comp := c.s.model.Completion(device, folder.ID)
+			ch <- prometheus.MustNewConstMetric(promFolderCompletion, prometheus.GaugeValue, comp.CompletionPct, folder.ID, device.String())
+		}
+	}
+}
+
+// collectScanDurations takes the scan durations from the state changes in
+// the buffered events, as there is no other record of them.
+func (c prometheusCollector) collectScanDurations(ch chan<- prometheus.Metric) {
+	c.s.eventSubsMut.Lock()
+	sub, ok := c.s.eventSubs[DefaultEventMask]
+	c.s.eventSubsMut.Unlock()
+	if !ok {
+		return
+	}
+
+	durations := make(map[string]float64)
+	for _, ev := range sub.Since(0, nil, 0) {
+		if ev.Type != events.StateChanged {
+			continue
+		}
+		data, ok := ev.Data.(map[string]interface{})
+		if !ok || data["from"] != "scanning" {
+			continue
+		}
+		folder, _ := data["folder"].(string)
+		if duration, ok := data["duration"].(float64); ok {
+			// Events are in order, so the latest scan wins.
+			durations[folder] = duration
+		}
+	}
+	for folder, duration := range durations {
+		ch <- prometheus.MustNewConstMetric(promFolderScanDuration, prometheus.GaugeValue, duration, folder)
+	}
+}
@@ -7,8 +7,10 @@
 package api
 
 import (
+	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,7 +27,11 @@ import (
 	"time"
 
 	"github.com/d4l3k/messagediff"
+	"github.com/prometheus/common/expfmt"
 	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/connections"
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/locations"
@@ -34,6 +40,7 @@ import (
 	"github.com/syncthing/syncthing/lib/sync"
 	"github.com/syncthing/syncthing/lib/tlsutil"
 	"github.com/syncthing/syncthing/lib/ur"
+	"github.com/syncthing/syncthing/lib/util"
 	"github.com/thejerf/suture"
 )
 
@@ -336,6 +343,12 @@ func TestAPIServiceRequests(t *testing.T) {
 			Type:   "application/json",
 			Prefix: "{",
 		},
+		{
+			URL:    "/rest/system/config/defaults",
+			Code:   200,
+			Type:   "application/json",
+			Prefix: "{",
+		},
 		{
 			URL:    "/rest/system/connections",
 			Code:   200,
@@ -515,6 +528,10 @@ func TestHTTPLogin(t *testing.T) {
 }
 
 func startHTTP(cfg *mockedConfig) (string, *suture.Supervisor, error) {
+	return startHTTPWithEvents(cfg, events.NoopLogger)
+}
+
+func startHTTPWithEvents(cfg *mockedConfig, evLogger events.Logger) (string, *suture.Supervisor, error) {
 	m := new(mockedModel)
 	assetDir := "../../gui"
 	eventSub := new(mockedEventSub)
@@ -529,7 +546,7 @@ func startHTTP(cfg *mockedConfig) (string, *suture.Supervisor, error) {
 	// Instantiate the API service
 	urService := ur.New(cfg, m, connections, false)
 	summaryService := model.NewFolderSummaryService(cfg, m, protocol.LocalDeviceID, events.NoopLogger)
-	svc := New(protocol.LocalDeviceID, cfg, assetDir, "syncthing", m, eventSub, diskEventSub, events.NoopLogger, discoverer, connections, urService, summaryService, errorLog, systemLog, cpu, nil, false).(*service)
+	svc := New(protocol.LocalDeviceID, cfg, assetDir, "syncthing", m, eventSub, diskEventSub, evLogger, discoverer, connections, urService, summaryService, errorLog, systemLog, cpu, nil, false).(*service)
 	defer os.Remove(token)
 	svc.started = addrChan
 
@@ -557,6 +574,95 @@ func startHTTP(cfg *mockedConfig) (string, *suture.Supervisor, error) {
 	return baseURL, supervisor, nil
 }
 
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+
+	cfg := new(mockedConfig)
+	cfg.gui.APIKey = "foobarbaz"
+	cfg.gui.User = "user"
+	cfg.gui.Password = "$2a$10$IdIZTxTg/dCNuNEGlmLynOjqg4B1FvDKuIV5e0BB3pnWVHNb8.GSq"
+	baseURL, sup, err := startHTTPWithEvents(cfg, evLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sup.Stop()
+
+	cli := &http.Client{
+		Timeout: time.Minute,
+	}
+	health := func() (int, string) {
+		resp, err := cli.Get(baseURL + "/rest/noauth/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, res["status"]
+	}
+
+	// Neither authentication nor a CSRF token is needed, but it's not
+	// healthy until startup is complete.
+	if code, status := health(); code != http.StatusServiceUnavailable || status != "starting" {
+		t.Errorf("Expected 503 starting before startup, got %d %s", code, status)
+	}
+
+	// Other requests still need authentication.
+	resp, err := cli.Get(baseURL + "/rest/system/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unexpected status %d for an unauthenticated request", resp.StatusCode)
+	}
+
+	evLogger.Log(events.StartupComplete, map[string]string{"myID": protocol.LocalDeviceID.String()})
+	for i := 0; ; i++ {
+		code, status := health()
+		if code == http.StatusOK && status == "OK" {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("Expected 200 OK after startup, got %d %s", code, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Nor is it with the database closed.
+	ldb := db.NewLowlevel(backend.OpenMemory())
+	s := &service{
+		model:           snapshotTestModel{new(mockedModel), ldb},
+		startupComplete: make(chan struct{}),
+		startupSub:      evLogger.Subscribe(events.StartupComplete),
+		stopping:        make(chan struct{}),
+	}
+	s.Service = util.AsService(func(ctx context.Context) { <-ctx.Done() }, "health test")
+	close(s.startupComplete)
+	ldb.Close()
+	rec := httptest.NewRecorder()
+	s.getHealth(rec, httptest.NewRequest("GET", "/rest/noauth/health", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "database closed") {
+		t.Errorf("Expected 503 database closed, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Stopping, it's not healthy anymore. Stopping twice, as the
+	// supervisor may, is fine.
+	s.Stop()
+	s.Stop()
+	rec = httptest.NewRecorder()
+	s.getHealth(rec, httptest.NewRequest("GET", "/rest/noauth/health", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "stopping") {
+		t.Errorf("Expected 503 stopping, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestCSRFRequired(t *testing.T) {
 	t.Parallel()
 
@@ -1170,6 +1276,247 @@ func TestCheckExpiry(t *testing.T) {
 	}
 }
 
+type metricsTestModel struct {
+	*mockedModel
+	remote protocol.DeviceID
+}
+
+func (m metricsTestModel) ConnectionStats() map[string]interface{} {
+	return map[string]interface{}{
+		"connections": map[string]model.ConnectionInfo{
+			m.remote.String(): {
+				Connected:  true,
+				Statistics: protocol.Statistics{InBytesTotal: 100, OutBytesTotal: 200},
+			},
+		},
+		"total": model.ConnectionInfo{
+			Statistics: protocol.Statistics{InBytesTotal: 1000, OutBytesTotal: 2000},
+		},
+	}
+}
+
+func (m metricsTestModel) Completion(device protocol.DeviceID, folder string) model.FolderCompletion {
+	return model.FolderCompletion{CompletionPct: 50}
+}
+
+func (m metricsTestModel) GlobalSize(folder string) db.Counts {
+	return db.Counts{Bytes: 1000}
+}
+
+func (m metricsTestModel) NeedSize(folder string) db.Counts {
+	return db.Counts{Bytes: 250}
+}
+
+type metricsTestConnections struct {
+	*mockedConnections
+}
+
+func (metricsTestConnections) ConnectionStatus() map[string]connections.ConnectionStatusEntry {
+	errStr := "connection refused"
+	return map[string]connections.ConnectionStatusEntry{
+		"tcp://192.0.2.42:22000": {When: time.Now(), Error: &errStr},
+		"tcp://192.0.2.43:22000": {When: time.Now()},
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Parallel()
+
+	remote := protocol.DeviceID{1, 2, 3}
+	raw := config.New(protocol.LocalDeviceID)
+	raw.Devices = append(raw.Devices, config.NewDeviceConfiguration(remote, "remote"))
+	folder := config.NewFolderConfiguration(protocol.LocalDeviceID, "default", "default", fs.FilesystemTypeFake, "")
+	folder.Devices = append(folder.Devices, config.FolderDeviceConfiguration{DeviceID: remote})
+	raw.Folders = append(raw.Folders, folder)
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+	sub := events.NewBufferedSubscription(evLogger.Subscribe(DefaultEventMask), EventSubBufferSize)
+	for _, duration := range []float64{3, 1.5} {
+		evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "default", "from": "scanning", "to": "idle", "duration": duration})
+	}
+	evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "default", "from": "syncing", "to": "idle", "duration": 10.0})
+
+	s := &service{
+		id:                 protocol.LocalDeviceID,
+		cfg:                config.Wrap("/dev/null", raw, events.NoopLogger),
+		model:              metricsTestModel{new(mockedModel), remote},
+		connectionsService: metricsTestConnections{new(mockedConnections)},
+		eventSubs:          map[events.EventType]events.BufferedSubscription{DefaultEventMask: sub},
+		eventSubsMut:       sync.NewMutex(),
+	}
+
+	// Wait for the events to be buffered.
+	for i := 0; len(sub.Since(0, nil, time.Second)) < 3; i++ {
+		if i == 10 {
+			t.Fatal("Timed out waiting for events")
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.prometheusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %v", rec.Code)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := func(name string, labels map[string]string) (float64, bool) {
+		fam, ok := families[name]
+		if !ok {
+			return 0, false
+		}
+	nextMetric:
+		for _, m := range fam.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if labels[lp.GetName()] != lp.GetValue() {
+					continue nextMetric
+				}
+			}
+			switch {
+			case m.Gauge != nil:
+				return m.GetGauge().GetValue(), true
+			case m.Counter != nil:
+				return m.GetCounter().GetValue(), true
+			}
+		}
+		return 0, false
+	}
+
+	cases := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"syncthing_connections_connected_devices", nil, 1},
+		{"syncthing_connections_device_connected", map[string]string{"device": remote.String()}, 1},
+		{"syncthing_connections_device_received_bytes_total", map[string]string{"device": remote.String()}, 100},
+		{"syncthing_connections_device_sent_bytes_total", map[string]string{"device": remote.String()}, 200},
+		{"syncthing_connections_received_bytes_total", nil, 1000},
+		{"syncthing_connections_sent_bytes_total", nil, 2000},
+		{"syncthing_connections_last_dial_success", map[string]string{"address": "tcp://192.0.2.42:22000"}, 0},
+		{"syncthing_connections_last_dial_success", map[string]string{"address": "tcp://192.0.2.43:22000"}, 1},
+		{"syncthing_folder_completion_percent", map[string]string{"folder": "default", "device": protocol.LocalDeviceID.String()}, 75},
+		{"syncthing_folder_completion_percent", map[string]string{"folder": "default", "device": remote.String()}, 50},
+		{"syncthing_folder_last_scan_duration_seconds", map[string]string{"folder": "default"}, 1.5},
+	}
+	for _, tc := range cases {
+		if v, ok := value(tc.name, tc.labels); !ok {
+			t.Errorf("Missing metric %v%v", tc.name, tc.labels)
+		} else if v != tc.value {
+			t.Errorf("Metric %v%v is %v, expected %v", tc.name, tc.labels, v, tc.value)
+		}
+	}
+	if _, ok := families["syncthing_connections_last_dial_timestamp_seconds"]; !ok {
+		t.Error("Missing metric syncthing_connections_last_dial_timestamp_seconds")
+	}
+}
+
+func TestPrometheusMetricsAuth(t *testing.T) {
+	t.Parallel()
+
+	const testAPIKey = "foobarbaz"
+	cfg := new(mockedConfig)
+	cfg.gui.APIKey = testAPIKey
+	s := &service{cfg: cfg}
+	h := s.whenAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Without GUI authentication, the API key is required.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status %v without API key", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status %v with API key", rec.Code)
+	}
+
+	// With GUI authentication, the middleware in front took care of it.
+	cfg.gui.User = "user"
+	cfg.gui.Password = "pass"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status %v with GUI authentication", rec.Code)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	t.Parallel()
+
+	dev1, dev2 := protocol.DeviceID{1}.String(), protocol.DeviceID{2}.String()
+	evs := []events.Event{
+		{Type: events.StateChanged, Data: map[string]interface{}{"folder": "a", "to": "idle"}},
+		{Type: events.StateChanged, Data: map[string]interface{}{"folder": "b", "to": "idle"}},
+		{Type: events.DeviceConnected, Data: map[string]string{"id": dev1}},
+		{Type: events.DeviceDisconnected, Data: map[string]string{"id": dev2}},
+		{Type: events.FolderCompletion, Data: map[string]interface{}{"folder": "a", "device": dev2}},
+		{Type: events.ItemStarted, Data: map[string]string{"folder": "b", "item": "file"}},
+		{Type: events.ConfigSaved, Data: config.Configuration{}},
+		{Type: events.StartupComplete, Data: map[string]string{"myID": dev1}},
+	}
+	cases := []struct {
+		filter   eventFilter
+		expected []int
+	}{
+		{eventFilter{}, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{eventFilter{folder: "a"}, []int{0, 2, 3, 4, 6, 7}},
+		{eventFilter{folder: "b"}, []int{1, 2, 3, 5, 6, 7}},
+		{eventFilter{device: dev1}, []int{0, 1, 2, 5, 6, 7}},
+		{eventFilter{device: dev2}, []int{0, 1, 3, 4, 5, 6, 7}},
+		{eventFilter{folder: "a", device: dev2}, []int{0, 3, 4, 6, 7}},
+		{eventFilter{folder: "a", device: dev1}, []int{0, 2, 6, 7}},
+	}
+	for _, tc := range cases {
+		var selected []int
+		for i, ev := range evs {
+			if tc.filter.matches(ev) {
+				selected = append(selected, i)
+			}
+		}
+		if fmt.Sprint(selected) != fmt.Sprint(tc.expected) {
+			t.Errorf("Filter %+v selected %v, expected %v", tc.filter, selected, tc.expected)
+		}
+	}
+}
+
+func TestEventFilterWaits(t *testing.T) {
+	t.Parallel()
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+	sub := events.NewBufferedSubscription(evLogger.Subscribe(events.StateChanged), EventSubBufferSize)
+	filter := eventFilter{folder: "a"}
+
+	evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "b"})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "b"})
+		evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "a"})
+	}()
+
+	// The events for other folders don't end the wait.
+	evs := filter.since(sub, 0, 10*time.Second)
+	if len(evs) != 1 || evs[0].SubscriptionID != 3 {
+		t.Fatalf("Expected the third event only, got %v", evs)
+	}
+
+	// Nothing more for the folder, so it times out.
+	evLogger.Log(events.StateChanged, map[string]interface{}{"folder": "b"})
+	if evs := filter.since(sub, 3, 100*time.Millisecond); len(evs) != 0 {
+		t.Errorf("Expected no events, got %v", evs)
+	}
+}
+
 func equalStrings(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -1202,3 +1549,192 @@ func runningInContainer() bool {
 	}
 	return false
 }
+
+type snapshotTestModel struct {
+	*mockedModel
+	db *db.Lowlevel
+}
+
+func (m snapshotTestModel) SnapshotDatabase(location string) error {
+	return m.db.WriteSnapshot(location)
+}
+
+func (m snapshotTestModel) DatabaseOpen() bool {
+	return m.db.IsOpen()
+}
+
+func TestSystemSnapshot(t *testing.T) {
+	t.Parallel()
+
+	raw := config.New(protocol.LocalDeviceID)
+	raw.Folders = append(raw.Folders, config.NewFolderConfiguration(protocol.LocalDeviceID, "default", "default", fs.FilesystemTypeFake, "/snapshot"))
+	ldb := db.NewLowlevel(backend.OpenMemory())
+	defer ldb.Close()
+	fset := db.NewFileSet("default", fs.NewFilesystem(fs.FilesystemTypeFake, ""), ldb)
+	const numFiles = 100
+	for i := 0; i < numFiles; i++ {
+		fset.Update(protocol.LocalDeviceID, []protocol.FileInfo{{
+			Name:    fmt.Sprintf("file%d", i),
+			Version: protocol.Vector{}.Update(protocol.LocalDeviceID.Short()),
+		}})
+	}
+
+	s := &service{
+		id:          protocol.LocalDeviceID,
+		cfg:         config.Wrap("/dev/null", raw, events.NoopLogger),
+		model:       snapshotTestModel{new(mockedModel), ldb},
+		snapshotMut: sync.NewMutex(),
+	}
+
+	// Keep syncing while the snapshot is made.
+	stop := make(chan struct{})
+	updated := make(chan int)
+	go func() {
+		n := 0
+		defer func() { updated <- n }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fset.Update(protocol.LocalDeviceID, []protocol.FileInfo{{
+				Name:    fmt.Sprintf("new%d", n),
+				Version: protocol.Vector{}.Update(protocol.LocalDeviceID.Short()),
+			}})
+			n++
+		}
+	}()
+
+	rec := httptest.NewRecorder()
+	s.postSystemSnapshot(rec, httptest.NewRequest("POST", "/rest/system/snapshot", nil))
+	close(stop)
+	n := <-updated
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %v: %s", rec.Code, rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "syncthing-snapshot-") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+	if files := int(fset.LocalSize().Files); files != numFiles+n {
+		t.Errorf("Have %d files after the snapshot, expected %d", files, numFiles+n)
+	}
+
+	// Restore the snapshot into a fresh config directory.
+	dir, err := ioutil.TempDir("", "syncthing-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	extractTarGz(t, rec.Body, dir)
+
+	cfg, err := config.Load(filepath.Join(dir, "config.xml"), protocol.LocalDeviceID, events.NoopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Folder("default"); !ok {
+		t.Error("Restored config lacks the folder")
+	}
+	// The device identity comes along, so that the restored instance is
+	// the same device.
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		orig, err := ioutil.ReadFile(filepath.Join(confDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || !bytes.Equal(restored, orig) {
+			t.Errorf("Restored %s differs from the original: %v", name, err)
+		}
+	}
+	bdb, err := backend.Open(filepath.Join(dir, filepath.Base(locations.Get(locations.Database))), backend.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := db.NewLowlevel(bdb)
+	defer rdb.Close()
+	rset := db.NewFileSet("default", fs.NewFilesystem(fs.FilesystemTypeFake, ""), rdb)
+	if files := int(rset.LocalSize().Files); files < numFiles || files > numFiles+n {
+		t.Errorf("Restored %d files, expected %d to %d", files, numFiles, numFiles+n)
+	}
+	if _, ok := rset.Get(protocol.LocalDeviceID, "file0"); !ok {
+		t.Error("Restored database lacks file0")
+	}
+}
+
+func TestSystemSnapshotToDir(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "syncthing-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	raw := config.New(protocol.LocalDeviceID)
+	raw.Options.SnapshotDir = dir
+	ldb := db.NewLowlevel(backend.OpenMemory())
+	defer ldb.Close()
+	s := &service{
+		id:          protocol.LocalDeviceID,
+		cfg:         config.Wrap("/dev/null", raw, events.NoopLogger),
+		model:       snapshotTestModel{new(mockedModel), ldb},
+		snapshotMut: sync.NewMutex(),
+	}
+
+	rec := httptest.NewRecorder()
+	s.postSystemSnapshot(rec, httptest.NewRequest("POST", "/rest/system/snapshot", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %v: %s", rec.Code, rec.Body)
+	}
+	var res struct {
+		Path string
+		Size int64
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(res.Path) != dir {
+		t.Errorf("Snapshot written to %v, expected it in %v", res.Path, dir)
+	}
+	if info, err := os.Stat(res.Path); err != nil {
+		t.Error(err)
+	} else if info.Size() != res.Size {
+		t.Errorf("Snapshot is %d bytes, reported %d", info.Size(), res.Size)
+	}
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the snapshot in the directory, got %v, %v", entries, err)
+	}
+}
+
+func extractTarGz(t *testing.T, r io.Reader, dir string) {
+	t.Helper()
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if hdr.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(path, 0700); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		fd, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(fd, tr)
+		fd.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
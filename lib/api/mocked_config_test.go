@@ -7,6 +7,8 @@
 package api
 
 import (
+	"io"
+
 	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/util"
@@ -66,6 +68,10 @@ func (c *mockedConfig) Save() error {
 	return nil
 }
 
+func (c *mockedConfig) ExportJSON(w io.Writer, withSecrets bool) error {
+	return nil
+}
+
 func (c *mockedConfig) RequiresRestart() bool {
 	return false
 }
@@ -7,6 +7,10 @@
 package api
 
 import (
+	"context"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/connections"
 )
 
@@ -20,6 +24,18 @@ func (m *mockedConnections) ConnectionStatus() map[string]connections.Connection
 	return nil
 }
 
+func (m *mockedConnections) DialBackoff() map[string]connections.DialBackoffEntry {
+	return nil
+}
+
+func (m *mockedConnections) DeviceAddresses(config.DeviceConfiguration) []string {
+	return nil
+}
+
+func (m *mockedConnections) DialForConnectivity(context.Context, config.DeviceConfiguration, string) (time.Duration, error) {
+	return 0, nil
+}
+
 func (m *mockedConnections) NATType() string {
 	return ""
 }
@@ -9,6 +9,7 @@ package api
 import (
 	"time"
 
+	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/discover"
 	"github.com/syncthing/syncthing/lib/protocol"
 )
@@ -50,3 +51,16 @@ func (m *mockedCachingMux) Add(finder discover.Finder, cacheTime, negCacheTime t
 func (m *mockedCachingMux) ChildErrors() map[string]error {
 	return nil
 }
+
+func (m *mockedCachingMux) Forget(deviceID protocol.DeviceID) {
+}
+
+// from config.Committer
+
+func (m *mockedCachingMux) VerifyConfiguration(from, to config.Configuration) error {
+	return nil
+}
+
+func (m *mockedCachingMux) CommitConfiguration(from, to config.Configuration) bool {
+	return true
+}
@@ -23,4 +23,8 @@ func (r *mockedLoggerRecorder) Since(t time.Time) []logger.Line {
 	}
 }
 
+func (r *mockedLoggerRecorder) All() []logger.Line {
+	return r.Since(time.Time{})
+}
+
 func (r *mockedLoggerRecorder) Clear() {}
@@ -7,6 +7,7 @@
 package api
 
 import (
+	"context"
 	"net"
 	"time"
 
@@ -24,6 +25,10 @@ func (m *mockedModel) GlobalDirectoryTree(folder, prefix string, levels int, dir
 	return nil
 }
 
+func (m *mockedModel) ClusterCompletion(folder string) (model.ClusterCompletionInfo, error) {
+	return model.ClusterCompletionInfo{}, nil
+}
+
 func (m *mockedModel) Completion(device protocol.DeviceID, folder string) model.FolderCompletion {
 	return model.FolderCompletion{}
 }
@@ -36,10 +41,18 @@ func (m *mockedModel) NeedFolderFiles(folder string, page, perpage int) ([]db.Fi
 	return nil, nil, nil
 }
 
+func (m *mockedModel) NeedFolderFilesMatching(folder, pattern string, offset, limit int) ([]db.FileInfoTruncated, int, error) {
+	return nil, 0, nil
+}
+
 func (m *mockedModel) RemoteNeedFolderFiles(device protocol.DeviceID, folder string, page, perpage int) ([]db.FileInfoTruncated, error) {
 	return nil, nil
 }
 
+func (m *mockedModel) ConflictingFiles(folder string) ([]model.ConflictFile, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) NeedSize(folder string) db.Counts {
 	return db.Counts{}
 }
@@ -48,10 +61,26 @@ func (m *mockedModel) ConnectionStats() map[string]interface{} {
 	return nil
 }
 
+func (m *mockedModel) ConnectionAttempts(protocol.DeviceID) []connections.Attempt {
+	return nil
+}
+
+func (m *mockedModel) DialAttempt(protocol.DeviceID, connections.Attempt) {}
+
+func (m *mockedModel) TestDeviceConnectivity(context.Context, protocol.DeviceID) (model.ConnectivityResult, error) {
+	return model.ConnectivityResult{}, nil
+}
+
+func (m *mockedModel) SetConnectivityTester(connections.ConnectivityTester) {}
+
 func (m *mockedModel) DeviceStatistics() (map[string]stats.DeviceStatistics, error) {
 	return nil, nil
 }
 
+func (m *mockedModel) IntroducedDevices(protocol.DeviceID) []protocol.DeviceID {
+	return nil
+}
+
 func (m *mockedModel) FolderStatistics() (map[string]stats.FolderStatistics, error) {
 	return nil, nil
 }
@@ -64,9 +93,21 @@ func (m *mockedModel) CurrentGlobalFile(folder string, file string) (protocol.Fi
 	return protocol.FileInfo{}, false
 }
 
+func (m *mockedModel) OpenRemoteFile(folder, file string) (model.ReadSeekCloser, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) VerifyFolder(ctx context.Context, folder string) (<-chan model.VerifyResult, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) ResetFolder(folder string) {
 }
 
+func (m *mockedModel) GlobalAvailability(folder, file string) ([]protocol.DeviceID, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) Availability(folder string, file protocol.FileInfo, block protocol.BlockInfo) []model.Availability {
 	return nil
 }
@@ -79,6 +120,10 @@ func (m *mockedModel) SetIgnores(folder string, content []string) error {
 	return nil
 }
 
+func (m *mockedModel) MatchIgnore(folder, path string) (bool, string, error) {
+	return false, "", nil
+}
+
 func (m *mockedModel) GetFolderVersions(folder string) (map[string][]versioner.FileVersion, error) {
 	return nil, nil
 }
@@ -87,6 +132,34 @@ func (m *mockedModel) RestoreFolderVersions(folder string, versions map[string]t
 	return nil, nil
 }
 
+func (m *mockedModel) RestoreFolderVersionTo(folder, file string, version time.Time, dest string) error {
+	return nil
+}
+
+func (m *mockedModel) FolderVersionsCleanupDryRun(folder string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) DryRunPull(folder string) ([]model.PullAction, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) CreateFolderMarker(folder string) error {
+	return nil
+}
+
+func (m *mockedModel) RevertToGlobal(folder, file string) error {
+	return nil
+}
+
+func (m *mockedModel) OverrideSubpaths(folder string, subs []string) error {
+	return nil
+}
+
+func (m *mockedModel) RevertSubpaths(folder string, subs []string) error {
+	return nil
+}
+
 func (m *mockedModel) PauseDevice(device protocol.DeviceID) {
 }
 
@@ -106,8 +179,18 @@ func (m *mockedModel) ScanFolderSubdirs(folder string, subs []string) error {
 	return nil
 }
 
+func (m *mockedModel) ScanFolderMetadataOnly(folder string) error {
+	return nil
+}
+
+func (m *mockedModel) AddProgressObserver(observer model.ProgressObserver) {}
+
 func (m *mockedModel) BringToFront(folder, file string) {}
 
+func (m *mockedModel) PrioritizeFile(folder, file string) error {
+	return nil
+}
+
 func (m *mockedModel) Connection(deviceID protocol.DeviceID) (connections.Connection, bool) {
 	return nil, false
 }
@@ -140,8 +223,12 @@ func (m *mockedModel) UsageReportingStats(version int, preview bool) map[string]
 	return nil
 }
 
-func (m *mockedModel) FolderErrors(folder string) ([]model.FileError, error) {
-	return nil, nil
+func (m *mockedModel) FolderErrors(folder string, offset, limit int) ([]model.FileError, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockedModel) ClearFolderError(folder, path string) error {
+	return nil
 }
 
 func (m *mockedModel) WatchError(folder string) error {
@@ -177,6 +264,14 @@ func (m *mockedModel) DownloadProgress(deviceID protocol.DeviceID, folder string
 	return nil
 }
 
+func (m *mockedModel) MetadataRequest(deviceID protocol.DeviceID, folder, prefix string) ([]protocol.FileInfo, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) RangeRequest(deviceID protocol.DeviceID, folder, name string, size int32, offset int64) (protocol.RequestResponse, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) AddConnection(conn connections.Connection, hello protocol.HelloResult) {}
 
 func (m *mockedModel) OnHello(protocol.DeviceID, net.Addr, protocol.HelloResult) error {
@@ -188,3 +283,15 @@ func (m *mockedModel) GetHello(protocol.DeviceID) protocol.HelloIntf {
 }
 
 func (m *mockedModel) StartDeadlockDetector(timeout time.Duration) {}
+
+func (m *mockedModel) SnapshotDatabase(location string) error {
+	return nil
+}
+
+func (m *mockedModel) DatabaseOpen() bool {
+	return true
+}
+
+func (m *mockedModel) FileHistory(folder, file string) ([]db.VersionEvent, error) {
+	return nil, nil
+}
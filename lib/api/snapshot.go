@@ -0,0 +1,201 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/locations"
+)
+
+// postSystemSnapshot produces a tar.gz archive of the configuration, the
+// device certificate and key, and a consistent copy of the database, which
+// can be unpacked into the config directory of a fresh instance to take over
+// the device's identity. Syncing continues while it's produced. The archive
+// is returned in the response, or written to the configured snapshot
+// directory.
+func (s *service) postSystemSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.snapshotMut.Lock()
+	defer s.snapshotMut.Unlock()
+
+	// The copy of the database is staged next to the database, which has
+	// room for it, rather than in a possibly small or shared temp dir.
+	tmpDir, err := ioutil.TempDir(filepath.Dir(locations.Get(locations.Database)), ".syncthing-snapshot-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbName := filepath.Base(locations.Get(locations.Database))
+	if err := s.model.SnapshotDatabase(filepath.Join(tmpDir, dbName)); err != nil {
+		l.Warnln("Snapshot: failed to copy database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cfg := s.cfg.RawCopy()
+	var cfgBuf bytes.Buffer
+	if err := cfg.WriteXML(&cfgBuf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("syncthing-snapshot-%s-%s.tar.gz", s.id.Short().String(), time.Now().Format("2006-01-02T150405"))
+
+	dir := cfg.Options.SnapshotDir
+	if dir == "" {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name)
+		if err := writeSnapshotArchive(w, cfgBuf.Bytes(), tmpDir, dbName); err != nil {
+			// Too late to tell the client, the archive is cut short.
+			l.Warnln("Snapshot: failed to send archive:", err)
+		}
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	size, err := writeSnapshotFile(path, cfgBuf.Bytes(), tmpDir, dbName)
+	if err != nil {
+		l.Warnln("Snapshot: failed to write archive:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l.Infoln("Wrote snapshot to", path)
+	sendJSON(w, map[string]interface{}{
+		"path": path,
+		"size": size,
+	})
+}
+
+// writeSnapshotFile writes the archive to a temporary file next to path,
+// renaming it into place when complete.
+func writeSnapshotFile(path string, cfg []byte, tmpDir, dbName string) (int64, error) {
+	fd, err := ioutil.TempFile(filepath.Dir(path), ".syncthing-snapshot-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(fd.Name())
+	if err := writeSnapshotArchive(fd, cfg, tmpDir, dbName); err != nil {
+		fd.Close()
+		return 0, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return 0, err
+	}
+	if err := fd.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(fd.Name(), path)
+}
+
+// snapshotIdentityFiles are the files making up the device identity, which
+// are included in the snapshot as they are.
+var snapshotIdentityFiles = []locations.LocationEnum{
+	locations.CertFile,
+	locations.KeyFile,
+}
+
+// writeSnapshotArchive writes config.xml, the device identity and the
+// database directory dbName from tmpDir, laid out as in the config
+// directory.
+func writeSnapshotArchive(w io.Writer, cfg []byte, tmpDir, dbName string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    filepath.Base(locations.Get(locations.ConfigFile)),
+		Mode:    0600,
+		Size:    int64(len(cfg)),
+		ModTime: now,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(cfg); err != nil {
+		return err
+	}
+
+	for _, loc := range snapshotIdentityFiles {
+		if err := writeTarFile(tw, locations.Get(loc)); err != nil {
+			return err
+		}
+	}
+
+	err := filepath.Walk(filepath.Join(tmpDir, dbName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tmpDir, path)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		_, err = io.Copy(tw, fd)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeTarFile adds the file at path to the archive, under its base name.
+func writeTarFile(tw *tar.Writer, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.Base(path)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, fd)
+	return err
+}
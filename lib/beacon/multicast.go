@@ -12,28 +12,62 @@ import (
 	"net"
 	"time"
 
+	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 )
 
+// NewMulticast returns a beacon sending to and receiving from the multicast
+// group at addr, on all interfaces. The group may be IPv4 or IPv6.
 func NewMulticast(addr string) Interface {
+	return newMulticast(addr, false)
+}
+
+// NewMulticastFromGroupPort is like NewMulticast, but sends from the port of
+// the multicast group instead of an ephemeral one. Protocols like mDNS
+// require this, as responders ignore packets from other source ports.
+func NewMulticastFromGroupPort(addr string) Interface {
+	return newMulticast(addr, true)
+}
+
+func newMulticast(addr string, groupPort bool) Interface {
+	laddr := ":0"
+	if groupPort {
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			laddr = ":" + port
+		}
+	}
+	if isIPv4Group(addr) {
+		return newMulticast4(addr, laddr)
+	}
 	c := newCast("multicastBeacon")
 	c.addReader(func(ctx context.Context) error {
 		return readMulticasts(ctx, c.outbox, addr)
 	})
 	c.addWriter(func(ctx context.Context) error {
-		return writeMulticasts(ctx, c.inbox, addr)
+		return writeMulticasts(ctx, c.inbox, addr, laddr)
 	})
 	return c
 }
 
-func writeMulticasts(ctx context.Context, inbox <-chan []byte, addr string) error {
+// listenWriter opens the socket used for sending. When binding a fixed port
+// it must be shareable with our own reader and other responders on the
+// host.
+func listenWriter(network, laddr string) (net.PacketConn, error) {
+	if laddr == ":0" {
+		return net.ListenPacket(network, laddr)
+	}
+	lc := net.ListenConfig{Control: setReuseAddr}
+	return lc.ListenPacket(context.Background(), network, laddr)
+}
+
+func writeMulticasts(ctx context.Context, inbox <-chan []byte, addr, laddr string) error {
 	gaddr, err := net.ResolveUDPAddr("udp6", addr)
 	if err != nil {
 		l.Debugln(err)
 		return err
 	}
 
-	conn, err := net.ListenPacket("udp6", ":0")
+	conn, err := listenWriter("udp6", laddr)
 	if err != nil {
 		l.Debugln(err)
 		return err
@@ -159,3 +193,166 @@ func readMulticasts(ctx context.Context, outbox chan<- recv, addr string) error
 		}
 	}
 }
+
+func isIPv4Group(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() != nil
+}
+
+func newMulticast4(addr, laddr string) Interface {
+	c := newCast("multicast4Beacon")
+	c.addReader(func(ctx context.Context) error {
+		return readMulticasts4(ctx, c.outbox, addr)
+	})
+	c.addWriter(func(ctx context.Context) error {
+		return writeMulticasts4(ctx, c.inbox, addr, laddr)
+	})
+	return c
+}
+
+func writeMulticasts4(ctx context.Context, inbox <-chan []byte, addr, laddr string) error {
+	gaddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		l.Debugln(err)
+		return err
+	}
+
+	conn, err := listenWriter("udp4", laddr)
+	if err != nil {
+		l.Debugln(err)
+		return err
+	}
+	doneCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-doneCtx.Done()
+		conn.Close()
+	}()
+
+	pconn := ipv4.NewPacketConn(conn)
+	if err := pconn.SetMulticastTTL(1); err != nil {
+		l.Debugln(err)
+		return err
+	}
+
+	for {
+		var bs []byte
+		select {
+		case bs = <-inbox:
+		case <-doneCtx.Done():
+			return nil
+		}
+
+		intfs, err := net.Interfaces()
+		if err != nil {
+			l.Debugln(err)
+			return err
+		}
+
+		success := 0
+		for _, intf := range intfs {
+			if intf.Flags&net.FlagMulticast == 0 {
+				continue
+			}
+			if err = pconn.SetMulticastInterface(&intf); err != nil {
+				l.Debugln(err, "on set interface", intf.Name)
+				continue
+			}
+			pconn.SetWriteDeadline(time.Now().Add(time.Second))
+			_, err = pconn.WriteTo(bs, nil, gaddr)
+			pconn.SetWriteDeadline(time.Time{})
+
+			if err != nil {
+				l.Debugln(err, "on write to", gaddr, intf.Name)
+				continue
+			}
+
+			l.Debugf("sent %d bytes to %v on %s", len(bs), gaddr, intf.Name)
+
+			success++
+
+			select {
+			case <-doneCtx.Done():
+				return nil
+			default:
+			}
+		}
+
+		if success == 0 {
+			if err == nil {
+				err = errors.New("no multicast interfaces available")
+			}
+			return err
+		}
+	}
+}
+
+func readMulticasts4(ctx context.Context, outbox chan<- recv, addr string) error {
+	gaddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		l.Debugln(err)
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		l.Debugln(err)
+		return err
+	}
+	doneCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-doneCtx.Done()
+		conn.Close()
+	}()
+
+	intfs, err := net.Interfaces()
+	if err != nil {
+		l.Debugln(err)
+		return err
+	}
+
+	pconn := ipv4.NewPacketConn(conn)
+	joined := 0
+	for _, intf := range intfs {
+		err := pconn.JoinGroup(&intf, &net.UDPAddr{IP: gaddr.IP})
+		if err != nil {
+			l.Debugln("IPv4 join", intf.Name, "failed:", err)
+			continue
+		}
+		l.Debugln("IPv4 join", intf.Name, "success")
+		joined++
+	}
+
+	if joined == 0 {
+		l.Debugln("no multicast interfaces available")
+		return errors.New("no multicast interfaces available")
+	}
+
+	bs := make([]byte, 65536)
+	for {
+		select {
+		case <-doneCtx.Done():
+			return nil
+		default:
+		}
+		n, _, addr, err := pconn.ReadFrom(bs)
+		if err != nil {
+			l.Debugln(err)
+			return err
+		}
+		l.Debugf("recv %d bytes from %s", n, addr)
+
+		c := make([]byte, n)
+		copy(c, bs)
+		select {
+		case outbox <- recv{c, addr}:
+		default:
+			l.Debugln("dropping message")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsIPv4Group(t *testing.T) {
+	cases := []struct {
+		addr string
+		v4   bool
+	}{
+		{"224.0.0.251:5353", true},
+		{"[ff02::fb]:5353", false},
+		{"[ff12::8384]:21027", false},
+		{"[::ffff:224.0.0.251]:5353", true},
+		{"garbage", false},
+	}
+	for _, tc := range cases {
+		if res := isIPv4Group(tc.addr); res != tc.v4 {
+			t.Errorf("isIPv4Group(%q) = %v, expected %v", tc.addr, res, tc.v4)
+		}
+	}
+}
+
+func TestListenWriterSharesPort(t *testing.T) {
+	c1, err := listenWriter("udp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(c1.LocalAddr().String())
+	c1.Close()
+
+	// Two sockets sending from the same fixed port, as our own reader
+	// and other mDNS responders on the host would.
+	laddr := ":" + port
+	c2, err := listenWriter("udp4", laddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c3, err := listenWriter("udp4", laddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c3.Close()
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/rand"
+	"github.com/syncthing/syncthing/lib/tlsutil"
 	"github.com/syncthing/syncthing/lib/util"
 )
 
@@ -33,6 +34,7 @@ const (
 	OldestHandledVersion = 10
 	CurrentVersion       = 29
 	MaxRescanIntervalS   = 365 * 24 * 60 * 60
+	MaxScanJitterPct     = 50
 )
 
 var (
@@ -67,6 +69,9 @@ var (
 	DefaultDiscoveryServers = append(DefaultDiscoveryServersV4, DefaultDiscoveryServersV6...)
 	// DefaultTheme is the default and fallback theme for the web UI.
 	DefaultTheme = "default"
+	// KnownTransports are the valid values for the enabled transports
+	// option.
+	KnownTransports = []string{"tcp", "quic", "relay", "unix"}
 	// Default stun servers should be substituted when the configuration
 	// contains <stunServer>default</stunServer>.
 
@@ -96,6 +101,15 @@ var (
 	errFolderIDEmpty     = errors.New("folder has empty ID")
 	errFolderIDDuplicate = errors.New("folder has duplicate ID")
 	errFolderPathEmpty   = errors.New("folder has empty path")
+	errUnknownTransport  = errors.New("unknown transport")
+	errUnknownDialFamily = errors.New("unknown dial family")
+	errUnknownEventType  = errors.New("unknown event type")
+	errWebhookScheme     = errors.New("webhook URL must be http or https")
+	errWebhookDuplicate  = errors.New("webhook has duplicate URL")
+	errRedacted          = errors.New("configuration contains redacted secrets")
+	errNoFolderPassword  = errors.New("receive encrypted folder has no encryption password")
+	errUntrustedSharer   = errors.New("receive encrypted folder must only be shared with trusted devices")
+	errUntrustedNoKey    = errors.New("folder shared with an untrusted device has no encryption password")
 )
 
 func New(myID protocol.DeviceID) Configuration {
@@ -116,6 +130,35 @@ func New(myID protocol.DeviceID) Configuration {
 	return cfg
 }
 
+// DefaultValues holds the canonical defaults for folder and options
+// configuration.
+type DefaultValues struct {
+	Folder  FolderConfiguration  `json:"folder"`
+	Options OptionsConfiguration `json:"options"`
+}
+
+// Defaults returns the default folder and options configuration, i.e. the
+// values a freshly created configuration would have. Callers should use
+// these instead of repeating the default values.
+func Defaults() DefaultValues {
+	var defaults DefaultValues
+
+	util.SetDefaults(&defaults.Folder)
+	defaults.Folder.Versioning.Params = make(map[string]string)
+	defaults.Folder.WeakHashThresholdPct = DefaultWeakHashThresholdPct
+	defaults.Folder.MarkerName = DefaultMarkerName
+
+	util.SetDefaults(&defaults.Options)
+	util.FillNilSlices(&defaults.Options)
+	defaults.Options.AlwaysLocalNets = []string{}
+	defaults.Options.UnackedNotificationIDs = []string{}
+	defaults.Options.EnabledTransports = []string{}
+	defaults.Options.ConnectionPriorities = []TransportPriority{}
+	defaults.Options.TLSCipherSuites = []string{}
+
+	return defaults
+}
+
 func NewWithFreePorts(myID protocol.DeviceID) (Configuration, error) {
 	cfg := New(myID)
 
@@ -153,6 +196,9 @@ func ReadXML(r io.Reader, myID protocol.DeviceID) (Configuration, error) {
 	}
 	cfg.OriginalVersion = cfg.Version
 
+	if err := cfg.resolveSecrets(); err != nil {
+		return Configuration{}, err
+	}
 	if err := cfg.prepare(myID); err != nil {
 		return Configuration{}, err
 	}
@@ -176,25 +222,90 @@ func ReadJSON(r io.Reader, myID protocol.DeviceID) (Configuration, error) {
 	}
 	cfg.OriginalVersion = cfg.Version
 
+	if err := cfg.resolveSecrets(); err != nil {
+		return Configuration{}, err
+	}
 	if err := cfg.prepare(myID); err != nil {
 		return Configuration{}, err
 	}
 	return cfg, nil
 }
 
+// redactedValue replaces secrets in exported configurations.
+const redactedValue = "REDACTED"
+
+// ImportJSON reads a configuration as written by ExportJSON, with the same
+// defaults and validation as when loading it from disk. Configurations
+// exported without secrets are rejected until the secrets are filled in.
+// The returned configuration has no MyID, as that isn't part of it.
+func ImportJSON(r io.Reader) (Configuration, error) {
+	var cfg Configuration
+
+	util.SetDefaults(&cfg)
+	util.SetDefaults(&cfg.Options)
+	util.SetDefaults(&cfg.GUI)
+
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return Configuration{}, err
+	}
+	cfg.OriginalVersion = cfg.Version
+
+	if cfg.GUI.APIKey == redactedValue || cfg.GUI.Password == redactedValue {
+		return Configuration{}, fmt.Errorf("gui: %v", errRedacted)
+	}
+	for _, folder := range cfg.Folders {
+		if folder.EncryptionPassword == redactedValue {
+			return Configuration{}, fmt.Errorf("folder %q: %v", folder.ID, errRedacted)
+		}
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return Configuration{}, err
+	}
+	if err := cfg.clean(); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
+
+// WriteJSON writes the configuration as indented JSON, with the API key
+// and passwords replaced unless withSecrets is set.
+func (cfg *Configuration) WriteJSON(w io.Writer, withSecrets bool) error {
+	out := cfg.Copy()
+	out.unresolveSecrets()
+	if !withSecrets {
+		out.redact()
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "    ")
+	return e.Encode(out)
+}
+
+// redact replaces the secrets, but not references to them.
+func (cfg *Configuration) redact() {
+	for _, field := range cfg.secretFields() {
+		if *field != "" && !isSecretRef(*field) {
+			*field = redactedValue
+		}
+	}
+}
+
 type Configuration struct {
-	Version        int                   `xml:"version,attr" json:"version"`
-	Folders        []FolderConfiguration `xml:"folder" json:"folders"`
-	Devices        []DeviceConfiguration `xml:"device" json:"devices"`
-	GUI            GUIConfiguration      `xml:"gui" json:"gui"`
-	LDAP           LDAPConfiguration     `xml:"ldap" json:"ldap"`
-	Options        OptionsConfiguration  `xml:"options" json:"options"`
-	IgnoredDevices []ObservedDevice      `xml:"remoteIgnoredDevice" json:"remoteIgnoredDevices"`
-	PendingDevices []ObservedDevice      `xml:"pendingDevice" json:"pendingDevices"`
-	XMLName        xml.Name              `xml:"configuration" json:"-"`
+	Version        int                    `xml:"version,attr" json:"version"`
+	Folders        []FolderConfiguration  `xml:"folder" json:"folders"`
+	Devices        []DeviceConfiguration  `xml:"device" json:"devices"`
+	GUI            GUIConfiguration       `xml:"gui" json:"gui"`
+	LDAP           LDAPConfiguration      `xml:"ldap" json:"ldap"`
+	Options        OptionsConfiguration   `xml:"options" json:"options"`
+	IgnoredDevices []ObservedDevice       `xml:"remoteIgnoredDevice" json:"remoteIgnoredDevices"`
+	PendingDevices []ObservedDevice       `xml:"pendingDevice" json:"pendingDevices"`
+	Webhooks       []WebhookConfiguration `xml:"webhook" json:"webhooks"`
+	XMLName        xml.Name               `xml:"configuration" json:"-"`
 
 	MyID            protocol.DeviceID `xml:"-" json:"-"` // Provided by the instantiator.
 	OriginalVersion int               `xml:"-" json:"-"` // The version we read from disk, before any conversion
+
+	secretRefs map[string]secretRef // References the secrets were resolved from
 }
 
 func (cfg Configuration) Copy() Configuration {
@@ -222,13 +333,20 @@ func (cfg Configuration) Copy() Configuration {
 	newCfg.PendingDevices = make([]ObservedDevice, len(cfg.PendingDevices))
 	copy(newCfg.PendingDevices, cfg.PendingDevices)
 
+	newCfg.Webhooks = make([]WebhookConfiguration, len(cfg.Webhooks))
+	for i := range newCfg.Webhooks {
+		newCfg.Webhooks[i] = cfg.Webhooks[i].Copy()
+	}
+
 	return newCfg
 }
 
 func (cfg *Configuration) WriteXML(w io.Writer) error {
+	out := cfg.Copy()
+	out.unresolveSecrets()
 	e := xml.NewEncoder(w)
 	e.Indent("", "    ")
-	err := e.Encode(cfg)
+	err := e.Encode(out)
 	if err != nil {
 		return err
 	}
@@ -307,6 +425,56 @@ func (cfg *Configuration) clean() error {
 
 	cfg.Options.RawListenAddresses = util.UniqueTrimmedStrings(cfg.Options.RawListenAddresses)
 	cfg.Options.RawGlobalAnnServers = util.UniqueTrimmedStrings(cfg.Options.RawGlobalAnnServers)
+	cfg.Options.EnabledTransports = util.UniqueTrimmedStrings(cfg.Options.EnabledTransports)
+
+nextTransport:
+	for _, transport := range cfg.Options.EnabledTransports {
+		for _, known := range KnownTransports {
+			if transport == known {
+				continue nextTransport
+			}
+		}
+		return fmt.Errorf("enabled transport %q: %v", transport, errUnknownTransport)
+	}
+
+nextPriority:
+	for _, prio := range cfg.Options.ConnectionPriorities {
+		for _, known := range KnownTransports {
+			if prio.Transport == known {
+				continue nextPriority
+			}
+		}
+		return fmt.Errorf("connection priority %q: %v", prio.Transport, errUnknownTransport)
+	}
+
+	switch cfg.Options.DialFamily {
+	case "":
+		cfg.Options.DialFamily = DialFamilyBoth
+	case DialFamilyBoth, DialFamilyIPv4, DialFamilyIPv6:
+	default:
+		return fmt.Errorf("dial family %q: %v", cfg.Options.DialFamily, errUnknownDialFamily)
+	}
+
+	if cfg.Options.TLSMinVersion == "" {
+		cfg.Options.TLSMinVersion = "1.2"
+	}
+	if _, err := tlsutil.ParseVersion(cfg.Options.TLSMinVersion); err != nil {
+		return errors.Wrap(err, "TLS minimum version")
+	}
+	if _, err := tlsutil.ParseCipherSuites(cfg.Options.TLSCipherSuites); err != nil {
+		return errors.Wrap(err, "TLS cipher suites")
+	}
+
+	existingWebhooks := make(map[string]bool)
+	for _, hook := range cfg.Webhooks {
+		if err := hook.validate(); err != nil {
+			return fmt.Errorf("webhook %q: %v", hook.URL, err)
+		}
+		if existingWebhooks[hook.URL] {
+			return fmt.Errorf("webhook %q: %v", hook.URL, errWebhookDuplicate)
+		}
+		existingWebhooks[hook.URL] = true
+	}
 
 	if cfg.Version > 0 && cfg.Version < OldestHandledVersion {
 		l.Warnf("Configuration version %d is deprecated. Attempting best effort conversion, but please verify manually.", cfg.Version)
@@ -349,11 +517,21 @@ func (cfg *Configuration) clean() error {
 		cfg.Devices[i].prepare(sharedFolders[cfg.Devices[i].DeviceID])
 	}
 
+	if err := cfg.checkEncryptedFolders(); err != nil {
+		return err
+	}
+
 	// Very short reconnection intervals are annoying
 	if cfg.Options.ReconnectIntervalS < 5 {
 		cfg.Options.ReconnectIntervalS = 5
 	}
 
+	if cfg.Options.ScanJitterPct < 0 {
+		cfg.Options.ScanJitterPct = 0
+	} else if cfg.Options.ScanJitterPct > MaxScanJitterPct {
+		cfg.Options.ScanJitterPct = MaxScanJitterPct
+	}
+
 	if cfg.GUI.APIKey == "" {
 		cfg.GUI.APIKey = rand.String(32)
 	}
@@ -413,16 +591,68 @@ nextPendingDevice:
 	if cfg.PendingDevices == nil {
 		cfg.PendingDevices = []ObservedDevice{}
 	}
+	if cfg.Webhooks == nil {
+		cfg.Webhooks = []WebhookConfiguration{}
+	}
 	if cfg.Options.AlwaysLocalNets == nil {
 		cfg.Options.AlwaysLocalNets = []string{}
 	}
 	if cfg.Options.UnackedNotificationIDs == nil {
 		cfg.Options.UnackedNotificationIDs = []string{}
 	}
+	if cfg.Options.EnabledTransports == nil {
+		cfg.Options.EnabledTransports = []string{}
+	}
+	if cfg.Options.ConnectionPriorities == nil {
+		cfg.Options.ConnectionPriorities = []TransportPriority{}
+	}
+	if cfg.Options.TLSCipherSuites == nil {
+		cfg.Options.TLSCipherSuites = []string{}
+	}
 
 	return nil
 }
 
+// checkEncryptedFolders verifies that receive encrypted folders have the
+// password the trusted devices encrypt with, and aren't shared with devices
+// which would themselves get the data encrypted. Folders shared with
+// untrusted devices must have a password, and their keys are derived here.
+func (cfg *Configuration) checkEncryptedFolders() error {
+	untrusted := make(map[protocol.DeviceID]bool)
+	for _, dev := range cfg.Devices {
+		if dev.Untrusted {
+			untrusted[dev.DeviceID] = true
+		}
+	}
+	for _, folder := range cfg.Folders {
+		if folder.Type != FolderTypeReceiveEncrypted {
+			for _, dev := range folder.Devices {
+				if !untrusted[dev.DeviceID] {
+					continue
+				}
+				if folder.EncryptionPassword == "" {
+					return fmt.Errorf("folder %q: %v; device %s is marked untrusted", folder.ID, errUntrustedNoKey, dev.DeviceID)
+				}
+				DeriveFolderKey(folder.ID, folder.EncryptionPassword) // cached for when it's used
+				break
+			}
+		}
+
+		if folder.Type != FolderTypeReceiveEncrypted {
+			continue
+		}
+		if folder.EncryptionPassword == "" {
+			return fmt.Errorf("folder %q: %v; set the password used on the trusted devices", folder.ID, errNoFolderPassword)
+		}
+		for _, dev := range folder.Devices {
+			if untrusted[dev.DeviceID] {
+				return fmt.Errorf("folder %q: %v; device %s is marked untrusted", folder.ID, errUntrustedSharer, dev.DeviceID)
+			}
+		}
+	}
+	return nil
+}
+
 // DeviceMap returns a map of device ID to device configuration for the given configuration.
 func (cfg *Configuration) DeviceMap() map[protocol.DeviceID]DeviceConfiguration {
 	m := make(map[protocol.DeviceID]DeviceConfiguration, len(cfg.Devices))
@@ -9,6 +9,7 @@ package config
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -46,6 +47,7 @@ func TestDefaultValues(t *testing.T) {
 		MaxSendKbps:             0,
 		MaxRecvKbps:             0,
 		ReconnectIntervalS:      60,
+		MaxReconnectIntervalS:   900,
 		RelaysEnabled:           true,
 		RelayReconnectIntervalM: 10,
 		StartBrowser:            true,
@@ -67,6 +69,7 @@ func TestDefaultValues(t *testing.T) {
 		AlwaysLocalNets:         []string{},
 		OverwriteRemoteDevNames: false,
 		TempIndexMinBlocks:      10,
+		TempIndexIntervalMs:     250,
 		UnackedNotificationIDs:  []string{},
 		DefaultFolderPath:       "~",
 		SetLowPriority:          true,
@@ -75,6 +78,13 @@ func TestDefaultValues(t *testing.T) {
 		StunKeepaliveStartS:     180,
 		StunKeepaliveMinS:       20,
 		RawStunServers:          []string{"default"},
+		EnabledTransports:       []string{},
+		ConnectionPriorities:    []TransportPriority{},
+		ConnectionDrainTimeoutS: 10,
+		ScanJitterPct:           25,
+		DialFamily:              DialFamilyBoth,
+		TLSMinVersion:           "1.2",
+		TLSCipherSuites:         []string{},
 	}
 
 	cfg := New(device1)
@@ -84,6 +94,27 @@ func TestDefaultValues(t *testing.T) {
 	}
 }
 
+func TestDefaultsMatchNew(t *testing.T) {
+	defaults := Defaults()
+
+	cfg := New(device1)
+	if diff, equal := messagediff.PrettyDiff(defaults.Options, cfg.Options); !equal {
+		t.Errorf("Default options differ from new config. Diff:\n%s", diff)
+	}
+
+	fcfg := NewFolderConfiguration(device1, "default", "Default", fs.FilesystemTypeBasic, "testdata")
+	// Zero out the things that are specific to the folder, rather than
+	// being defaults.
+	fcfg.ID = ""
+	fcfg.Label = ""
+	fcfg.Path = ""
+	fcfg.Devices = nil
+	fcfg.cachedFilesystem = nil
+	if diff, equal := messagediff.PrettyDiff(defaults.Folder, fcfg); !equal {
+		t.Errorf("Default folder differs from new folder. Diff:\n%s", diff)
+	}
+}
+
 func TestDeviceConfig(t *testing.T) {
 	for i := OldestHandledVersion; i <= CurrentVersion; i++ {
 		os.RemoveAll(filepath.Join("testdata", DefaultMarkerName))
@@ -189,9 +220,11 @@ func TestOverriddenValues(t *testing.T) {
 		LocalAnnEnabled:         false,
 		LocalAnnPort:            42123,
 		LocalAnnMCAddr:          "quux:3232",
+		LocalAnnMDNSEnabled:     true,
 		MaxSendKbps:             1234,
 		MaxRecvKbps:             2341,
 		ReconnectIntervalS:      6000,
+		MaxReconnectIntervalS:   7200,
 		RelaysEnabled:           false,
 		RelayReconnectIntervalM: 20,
 		StartBrowser:            false,
@@ -215,6 +248,7 @@ func TestOverriddenValues(t *testing.T) {
 		AlwaysLocalNets:         []string{},
 		OverwriteRemoteDevNames: true,
 		TempIndexMinBlocks:      100,
+		TempIndexIntervalMs:     500,
 		UnackedNotificationIDs:  []string{"asdfasdf"},
 		DefaultFolderPath:       "/media/syncthing",
 		SetLowPriority:          false,
@@ -223,6 +257,18 @@ func TestOverriddenValues(t *testing.T) {
 		StunKeepaliveStartS:     9000,
 		StunKeepaliveMinS:       900,
 		RawStunServers:          []string{"foo"},
+		EnabledTransports:       []string{"tcp"},
+		ConnectionPriorities:    []TransportPriority{{Transport: "relay", Priority: 5}},
+		ConnLimitPerDevice:      2,
+		ConnectionDrainTimeoutS: 30,
+		ScanJitterPct:           10,
+		DatabaseDir:             "/var/lib/syncthing/db",
+		DatabaseStoreURL:        "s3://s3.example.com/bucket/syncthing",
+		DialFamily:              DialFamilyIPv6,
+		TLSMinVersion:           "1.3",
+		TLSCipherSuites:         []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"},
+		SnapshotDir:             "/var/backups/syncthing",
+		QUICIdleTimeoutS:        20,
 	}
 
 	os.Unsetenv("STNOUPGRADE")
@@ -455,6 +501,80 @@ func TestFolderPath(t *testing.T) {
 	}
 }
 
+func TestFolderPathExpansion(t *testing.T) {
+	os.Setenv("STTEST_FOLDERBASE", "/base")
+	defer os.Unsetenv("STTEST_FOLDERBASE")
+	os.Unsetenv("STTEST_UNSETVAR")
+
+	home, err := fs.ExpandTilde("~")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"${STTEST_FOLDERBASE}/foo", "/base/foo"},
+		{"$STTEST_FOLDERBASE/foo", "/base/foo"},
+		{"/data/${STTEST_UNSETVAR}foo", "/data/foo"},
+		{"/data/$STTEST_UNSETVAR/foo", "/data//foo"},
+		{"/data/100%/foo", "/data/100%/foo"},
+		{"~", home},
+		{"~/foo", filepath.Join(home, "foo")},
+	}
+	if runtime.GOOS == "windows" {
+		cases = append(cases, []struct {
+			path     string
+			expected string
+		}{
+			{"%STTEST_FOLDERBASE%/foo", "/base/foo"},
+			{"C:/%STTEST_UNSETVAR%foo", "C:/foo"},
+		}...)
+	}
+
+	for _, tc := range cases {
+		if res := expandPath(tc.path); res != filepath.FromSlash(tc.expected) {
+			t.Errorf("expandPath(%q) => %q, expected %q", tc.path, res, filepath.FromSlash(tc.expected))
+		}
+	}
+
+	// Unset variables are warned about only once
+	if _, ok := unsetPathEnvs["STTEST_UNSETVAR"]; !ok {
+		t.Error("expected unset variable to be recorded as warned about")
+	}
+}
+
+func TestFolderPathExpansionRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("STTEST_FOLDERBASE", dir)
+	defer os.Unsetenv("STTEST_FOLDERBASE")
+
+	path := filepath.Join(dir, "config.xml")
+	cfg := New(device1)
+	cfg.Folders = append(cfg.Folders, NewFolderConfiguration(device1, "expanded", "", fs.FilesystemTypeBasic, "${STTEST_FOLDERBASE}/folder"))
+	if err := wrap(path, cfg).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := load(path, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcfg := loaded.Folders()["expanded"]
+	if fcfg.Path != "${STTEST_FOLDERBASE}/folder" {
+		t.Errorf("Raw folder path not preserved, got %q", fcfg.Path)
+	}
+	if uri := fcfg.Filesystem().URI(); uri != filepath.Join(dir, "folder") {
+		t.Errorf("Folder filesystem at %q, expected %q", uri, filepath.Join(dir, "folder"))
+	}
+}
+
 func TestFolderCheckPath(t *testing.T) {
 	n, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -654,6 +774,74 @@ func TestPullOrder(t *testing.T) {
 	}
 }
 
+func TestConflictResolution(t *testing.T) {
+	wrapper, err := load("testdata/conflictresolution.xml", device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name       string
+		resolution ConflictResolution
+	}{
+		{"f1", ConflictResolutionManual},      // empty value, default
+		{"f2", ConflictResolutionManual},      // explicit
+		{"f3", ConflictResolutionNewestWins},  // explicit
+		{"f4", ConflictResolutionLargestWins}, // explicit
+		{"f5", ConflictResolutionLocalWins},   // explicit
+	}
+
+	// Verify values are deserialized correctly, and survive serializing
+	// and deserializing again.
+
+	folders := wrapper.Folders()
+	for _, tc := range expected {
+		if actual := folders[tc.name].ConflictResolution; actual != tc.resolution {
+			t.Errorf("Incorrect conflict resolution for %q: %v != %v", tc.name, actual, tc.resolution)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	cfg := wrapper.RawCopy()
+	cfg.WriteXML(buf)
+
+	cfg, err = ReadXML(buf, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders = wrap("testdata/conflictresolution.xml", cfg).Folders()
+
+	for _, tc := range expected {
+		if actual := folders[tc.name].ConflictResolution; actual != tc.resolution {
+			t.Errorf("Incorrect conflict resolution for %q after round trip: %v != %v", tc.name, actual, tc.resolution)
+		}
+	}
+}
+
+func TestConflictResolutionInvalid(t *testing.T) {
+	if _, err := load("testdata/conflictresolution-invalid.xml", device1); err == nil {
+		t.Error("Loading a config with an unknown conflict resolution should fail")
+	}
+
+	var f FolderConfiguration
+	if err := json.Unmarshal([]byte(`{"conflictResolution": "whatever"}`), &f); err == nil {
+		t.Error("Unmarshalling an unknown conflict resolution should fail")
+	}
+}
+
+func TestIgnoreModeInvalid(t *testing.T) {
+	var f FolderConfiguration
+	if err := json.Unmarshal([]byte(`{"ignoreMode": "allowlist"}`), &f); err != nil {
+		t.Error(err)
+	} else if f.IgnoreMode != IgnoreModeAllowlist {
+		t.Errorf("Incorrect ignore mode %v", f.IgnoreMode)
+	}
+
+	if err := json.Unmarshal([]byte(`{"ignoreMode": "whatever"}`), &f); err == nil {
+		t.Error("Unmarshalling an unknown ignore mode should fail")
+	}
+}
+
 func TestLargeRescanInterval(t *testing.T) {
 	wrapper, err := load("testdata/largeinterval.xml", device1)
 	if err != nil {
@@ -668,6 +856,52 @@ func TestLargeRescanInterval(t *testing.T) {
 	}
 }
 
+func TestNegativePullerWorkers(t *testing.T) {
+	cfg := Configuration{
+		Version: CurrentVersion,
+		Folders: []FolderConfiguration{
+			{ID: "f", Path: "testdata", Copiers: -1, Pullers: -2, Finishers: -3},
+		},
+	}
+	if err := cfg.prepare(device1); err != nil {
+		t.Fatal(err)
+	}
+	f := cfg.Folders[0]
+	if f.Copiers != 0 || f.Pullers != 0 || f.Finishers != 0 {
+		t.Errorf("Negative worker counts should become zero, got %d, %d, %d", f.Copiers, f.Pullers, f.Finishers)
+	}
+}
+
+func TestPullerRoutines(t *testing.T) {
+	// The old pullers element is migrated into the pending data limit and
+	// doesn't set the number of puller routines.
+	wrapper, err := load("testdata/example.xml", device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := wrapper.Folders()["default"]
+	if f.Pullers != 0 || f.PullerMaxPendingKiB != 128*16 {
+		t.Errorf("Expected 0 pullers and %d KiB pending, got %d and %d", 128*16, f.Pullers, f.PullerMaxPendingKiB)
+	}
+
+	cfg := wrapper.RawCopy()
+	cfg.Folders[0].Pullers = 3
+	buf := new(bytes.Buffer)
+	if err := cfg.WriteXML(buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("<pullers>")) {
+		t.Error("The deprecated pullers element was written")
+	}
+	cfg, err = ReadXML(buf, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := cfg.Folders[0]; f.Pullers != 3 || f.PullerMaxPendingKiB != 128*16 {
+		t.Errorf("Expected 3 pullers and %d KiB pending, got %d and %d", 128*16, f.Pullers, f.PullerMaxPendingKiB)
+	}
+}
+
 func TestGUIConfigURL(t *testing.T) {
 	testcases := [][2]string{
 		{"192.0.2.42:8080", "http://192.0.2.42:8080/"},
@@ -728,6 +962,160 @@ func TestEmptyFolderPaths(t *testing.T) {
 	}
 }
 
+func TestUnknownTransport(t *testing.T) {
+	cfg := New(device1)
+	cfg.Options.EnabledTransports = []string{"tcp", "kcp"}
+
+	err := cfg.clean()
+	if err == nil || !strings.Contains(err.Error(), errUnknownTransport.Error()) {
+		t.Fatal("Expected error due to unknown transport, got", err)
+	}
+
+	cfg.Options.EnabledTransports = []string{"tcp", "relay"}
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Options.IsTransportEnabled("tcp") || cfg.Options.IsTransportEnabled("quic") {
+		t.Error("Unexpected set of enabled transports")
+	}
+
+	cfg.Options.ConnectionPriorities = []TransportPriority{{Transport: "kcp", Priority: 1}}
+	err = cfg.clean()
+	if err == nil || !strings.Contains(err.Error(), errUnknownTransport.Error()) {
+		t.Fatal("Expected error due to unknown transport, got", err)
+	}
+}
+
+func TestDialFamily(t *testing.T) {
+	cfg := New(device1)
+	cfg.Options.DialFamily = "ipx"
+	if err := cfg.clean(); err == nil || !strings.Contains(err.Error(), errUnknownDialFamily.Error()) {
+		t.Fatal("Expected error due to unknown dial family, got", err)
+	}
+
+	cfg.Options.DialFamily = ""
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Options.DialFamily != DialFamilyBoth {
+		t.Errorf("Expected empty dial family to mean both, got %q", cfg.Options.DialFamily)
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	cfg := New(device1)
+	cfg.Options.TLSMinVersion = "1.4"
+	if err := cfg.clean(); err == nil || !strings.Contains(err.Error(), "TLS minimum version") {
+		t.Error("Expected error due to unknown TLS version, got", err)
+	}
+
+	cfg.Options.TLSMinVersion = "1.3"
+	cfg.Options.TLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "TLS_RSA_WITH_RC4_128_SHA"}
+	if err := cfg.clean(); err == nil || !strings.Contains(err.Error(), "TLS_RSA_WITH_RC4_128_SHA") {
+		t.Error("Expected error due to insecure cipher suite, got", err)
+	}
+
+	cfg.Options.TLSCipherSuites = cfg.Options.TLSCipherSuites[:1]
+	if err := cfg.clean(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	cases := []struct {
+		hook WebhookConfiguration
+		err  error
+	}{
+		{WebhookConfiguration{URL: "ftp://example.com/hook"}, errWebhookScheme},
+		{WebhookConfiguration{URL: "https://example.com/hook", Events: []string{"NoSuchEvent"}}, errUnknownEventType},
+		{WebhookConfiguration{URL: "https://example.com/hook", Events: []string{"DeviceConnected", "FolderSummary"}}, nil},
+	}
+	for _, tc := range cases {
+		cfg := New(device1)
+		cfg.Webhooks = []WebhookConfiguration{tc.hook}
+		err := cfg.clean()
+		if tc.err == nil && err != nil {
+			t.Errorf("Unexpected error for %v: %v", tc.hook, err)
+		} else if tc.err != nil && (err == nil || !strings.Contains(err.Error(), tc.err.Error())) {
+			t.Errorf("Expected error %v for %v, got %v", tc.err, tc.hook, err)
+		}
+	}
+
+	cfg := New(device1)
+	cfg.Webhooks = []WebhookConfiguration{{URL: "https://example.com/hook"}, {URL: "https://example.com/hook"}}
+	if err := cfg.clean(); err == nil || !strings.Contains(err.Error(), errWebhookDuplicate.Error()) {
+		t.Error("Expected error due to duplicate webhook, got", err)
+	}
+
+	// Without event types, all are delivered.
+	mask, err := WebhookConfiguration{}.EventMask()
+	if err != nil || mask != events.AllEvents {
+		t.Errorf("Unexpected event mask %v, %v", mask, err)
+	}
+	mask, _ = cases[2].hook.EventMask()
+	if mask != events.DeviceConnected|events.FolderSummary {
+		t.Errorf("Unexpected event mask %v", mask)
+	}
+}
+
+func TestReceiveEncryptedFolder(t *testing.T) {
+	cfg := New(device1)
+	cfg.Devices = append(cfg.Devices, NewDeviceConfiguration(device2, "untrusted"))
+	fcfg := NewFolderConfiguration(device1, "encrypted", "", fs.FilesystemTypeBasic, "testdata")
+	fcfg.Type = FolderTypeReceiveEncrypted
+	cfg.Folders = []FolderConfiguration{fcfg}
+
+	err := cfg.clean()
+	if err == nil || !strings.Contains(err.Error(), errNoFolderPassword.Error()) {
+		t.Fatal("Expected error due to missing password, got", err)
+	}
+
+	cfg.Folders[0].EncryptionPassword = "foo"
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Folders[0].Devices = append(cfg.Folders[0].Devices, FolderDeviceConfiguration{DeviceID: device2})
+	cfg.Devices[1].Untrusted = true
+	err = cfg.clean()
+	if err == nil || !strings.Contains(err.Error(), errUntrustedSharer.Error()) {
+		t.Fatal("Expected error due to untrusted device, got", err)
+	}
+
+	cfg.Devices[1].Untrusted = false
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeriveFolderKey(t *testing.T) {
+	key := DeriveFolderKey("folder", "password")
+	if len(key) != protocol.FolderKeySize {
+		t.Fatalf("Key has length %d, expected %d", len(key), protocol.FolderKeySize)
+	}
+	if !bytes.Equal(key, DeriveFolderKey("folder", "password")) {
+		t.Error("Key differs for the same inputs")
+	}
+	if bytes.Equal(key, DeriveFolderKey("folder", "other")) {
+		t.Error("Key is the same for a different password")
+	}
+	if bytes.Equal(key, DeriveFolderKey("other", "password")) {
+		t.Error("Key is the same for a different folder")
+	}
+}
+
+func TestConnectionPriority(t *testing.T) {
+	opts := OptionsConfiguration{
+		ConnectionPriorities: []TransportPriority{{Transport: "relay", Priority: 5}},
+	}
+	if prio := opts.ConnectionPriority("relay", 200); prio != 5 {
+		t.Errorf("Relay priority is %d, expected 5", prio)
+	}
+	if prio := opts.ConnectionPriority("tcp", 10); prio != 10 {
+		t.Errorf("TCP priority is %d, expected the default 10", prio)
+	}
+}
+
 func TestV14ListenAddressesMigration(t *testing.T) {
 	tcs := [][3][]string{
 		// Default listen plus default relays is now "default"
@@ -1154,3 +1542,139 @@ func load(path string, myID protocol.DeviceID) (Wrapper, error) {
 func wrap(path string, cfg Configuration) Wrapper {
 	return Wrap(path, cfg, events.NoopLogger)
 }
+
+func TestAutoAcceptsFolder(t *testing.T) {
+	cfg := DeviceConfiguration{AutoAcceptFolders: true}
+	if !cfg.AutoAcceptsFolder("abcd-1234", "Photos") {
+		t.Error("folders should be accepted when there are no patterns")
+	}
+
+	cfg.AutoAcceptFolderPatterns = []string{"shared-*", "Ph?tos"}
+	cases := []struct {
+		id, label string
+		accepted  bool
+	}{
+		{"shared-one", "", true},
+		{"shared-two", "Whatever", true},
+		{"abcd-1234", "Photos", true},
+		{"abcd-1234", "Music", false},
+		{"other-shared-one", "Photos and videos", false},
+	}
+	for _, tc := range cases {
+		if res := cfg.AutoAcceptsFolder(tc.id, tc.label); res != tc.accepted {
+			t.Errorf("AutoAcceptsFolder(%q, %q) => %v, expected %v", tc.id, tc.label, res, tc.accepted)
+		}
+	}
+
+	cfg.AutoAcceptFolders = false
+	if cfg.AutoAcceptsFolder("shared-one", "") {
+		t.Error("folders should not be accepted when auto accept is disabled")
+	}
+}
+
+func TestExportImportJSON(t *testing.T) {
+	wrapper, err := load("testdata/example.xml", device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := wrapper.RawCopy()
+	cfg.GUI.APIKey = "abc123"
+	cfg.GUI.Password = "hunter2"
+	cfg.Folders[0].EncryptionPassword = "secret"
+	// Our own device is added to the folders after they are sorted when
+	// loading, preparing again puts it in the same place as on import.
+	if err := cfg.prepare(device1); err != nil {
+		t.Fatal(err)
+	}
+	wrapper = wrap("/dev/null", cfg)
+
+	buf := new(bytes.Buffer)
+	if err := wrapper.ExportJSON(buf, true); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := wrapper.RawCopy()
+	for _, c := range []*Configuration{&expected, &imported} {
+		c.MyID = protocol.EmptyDeviceID
+		c.OriginalVersion = 0
+		c.XMLName = xml.Name{}
+		for i := range c.Folders {
+			c.Folders[i].cachedFilesystem = nil
+		}
+	}
+	if diff, equal := messagediff.PrettyDiff(expected, imported); !equal {
+		t.Errorf("Imported config differs. Diff:\n%s", diff)
+	}
+}
+
+func TestExportJSONRedacted(t *testing.T) {
+	wrapper, err := load("testdata/example.xml", device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := wrapper.RawCopy()
+	cfg.GUI.APIKey = "abc123"
+	cfg.GUI.Password = "hunter2"
+	cfg.Folders[0].EncryptionPassword = "secret"
+	wrapper = wrap("/dev/null", cfg)
+
+	buf := new(bytes.Buffer)
+	if err := wrapper.ExportJSON(buf, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"abc123", "hunter2", "secret"} {
+		if bytes.Contains(buf.Bytes(), []byte(secret)) {
+			t.Errorf("Exported config contains %q", secret)
+		}
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(redactedValue)) {
+		t.Error("Exported config lacks redacted values")
+	}
+
+	if _, err := ImportJSON(buf); err == nil {
+		t.Error("Expected an error importing a redacted config")
+	}
+}
+
+func TestFolderKey(t *testing.T) {
+	cfg := New(device1)
+	cfg.Devices = append(cfg.Devices, NewDeviceConfiguration(device2, "untrusted"))
+	cfg.Devices[1].Untrusted = true
+	fcfg := NewFolderConfiguration(device1, "folder", "", fs.FilesystemTypeBasic, "testdata")
+	fcfg.Devices = append(fcfg.Devices, FolderDeviceConfiguration{DeviceID: device2})
+	fcfg.EncryptionPassword = "password"
+	cfg.Folders = []FolderConfiguration{fcfg}
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+
+	folderKeysMut.Lock()
+	cached := folderKeys["folder"]
+	folderKeysMut.Unlock()
+	key := protocol.KeyFromPassword("folder", "password")[:]
+	if cached.password != "password" || !bytes.Equal(cached.key, key) {
+		t.Error("Key wasn't derived on validation")
+	}
+	if !bytes.Equal(cfg.Folders[0].FolderKey(), key) {
+		t.Error("Unexpected folder key")
+	}
+
+	// The key is derived again when the password changes.
+	cfg.Folders[0].EncryptionPassword = "other"
+	if err := cfg.clean(); err != nil {
+		t.Fatal(err)
+	}
+	if other := cfg.Folders[0].FolderKey(); bytes.Equal(other, key) || !bytes.Equal(other, protocol.KeyFromPassword("folder", "other")[:]) {
+		t.Error("Key wasn't derived for the changed password")
+	}
+
+	// An untrusted device must never get a folder without a password.
+	cfg.Folders[0].EncryptionPassword = ""
+	if err := cfg.clean(); err == nil || !strings.Contains(err.Error(), errUntrustedNoKey.Error()) {
+		t.Error("Expected error due to missing password, got", err)
+	}
+}
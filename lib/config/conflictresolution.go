@@ -0,0 +1,55 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import "fmt"
+
+// ConflictResolution is the policy for handling a conflict between the
+// local version of a file and an incoming one.
+type ConflictResolution int
+
+const (
+	ConflictResolutionManual      ConflictResolution = iota // default, keep a conflict copy
+	ConflictResolutionNewestWins                            // the most recently modified version wins
+	ConflictResolutionLargestWins                           // the largest version wins, or the newest if the sizes are equal
+	ConflictResolutionLocalWins                             // the version on this device always wins
+)
+
+func (r ConflictResolution) String() string {
+	switch r {
+	case ConflictResolutionManual:
+		return "manual"
+	case ConflictResolutionNewestWins:
+		return "newestWins"
+	case ConflictResolutionLargestWins:
+		return "largestWins"
+	case ConflictResolutionLocalWins:
+		return "localWins"
+	default:
+		return "unknown"
+	}
+}
+
+func (r ConflictResolution) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *ConflictResolution) UnmarshalText(bs []byte) error {
+	switch string(bs) {
+	case "", "manual":
+		*r = ConflictResolutionManual
+	case "newestWins":
+		*r = ConflictResolutionNewestWins
+	case "largestWins":
+		*r = ConflictResolutionLargestWins
+	case "localWins":
+		*r = ConflictResolutionLocalWins
+	default:
+		return fmt.Errorf("unknown conflict resolution %q", string(bs))
+	}
+	return nil
+}
@@ -7,6 +7,7 @@
 package config
 
 import (
+	"path"
 	"sort"
 
 	"github.com/syncthing/syncthing/lib/protocol"
@@ -25,11 +26,15 @@ type DeviceConfiguration struct {
 	Paused                   bool                 `xml:"paused" json:"paused"`
 	AllowedNetworks          []string             `xml:"allowedNetwork,omitempty" json:"allowedNetworks"`
 	AutoAcceptFolders        bool                 `xml:"autoAcceptFolders" json:"autoAcceptFolders"`
+	AutoAcceptFolderPatterns []string             `xml:"autoAcceptFolderPattern,omitempty" json:"autoAcceptFolderPatterns"` // Empty: all folders are accepted
 	MaxSendKbps              int                  `xml:"maxSendKbps" json:"maxSendKbps"`
 	MaxRecvKbps              int                  `xml:"maxRecvKbps" json:"maxRecvKbps"`
 	IgnoredFolders           []ObservedFolder     `xml:"ignoredFolder" json:"ignoredFolders"`
 	PendingFolders           []ObservedFolder     `xml:"pendingFolder" json:"pendingFolders"`
 	MaxRequestKiB            int                  `xml:"maxRequestKiB" json:"maxRequestKiB"`
+	MaxRequestsPerSecond     int                  `xml:"maxRequestsPerSecond" json:"maxRequestsPerSecond"`   // 0: global default, <0: no limiting
+	MaxConcurrentRequests    int                  `xml:"maxConcurrentRequests" json:"maxConcurrentRequests"` // Requests the device may have outstanding towards us. 0: default, <0: no limiting
+	Untrusted                bool                 `xml:"untrusted" json:"untrusted"`                         // Folders with an encryption password are encrypted towards the device
 }
 
 func NewDeviceConfiguration(id protocol.DeviceID, name string) DeviceConfiguration {
@@ -50,6 +55,10 @@ func (cfg DeviceConfiguration) Copy() DeviceConfiguration {
 	copy(c.Addresses, cfg.Addresses)
 	c.AllowedNetworks = make([]string, len(cfg.AllowedNetworks))
 	copy(c.AllowedNetworks, cfg.AllowedNetworks)
+	if cfg.AutoAcceptFolderPatterns != nil {
+		c.AutoAcceptFolderPatterns = make([]string, len(cfg.AutoAcceptFolderPatterns))
+		copy(c.AutoAcceptFolderPatterns, cfg.AutoAcceptFolderPatterns)
+	}
 	c.IgnoredFolders = make([]ObservedFolder, len(cfg.IgnoredFolders))
 	copy(c.IgnoredFolders, cfg.IgnoredFolders)
 	c.PendingFolders = make([]ObservedFolder, len(cfg.PendingFolders))
@@ -90,6 +99,26 @@ func (cfg *DeviceConfiguration) IgnoredFolder(folder string) bool {
 	return false
 }
 
+// AutoAcceptsFolder returns true if a folder with the given ID and label,
+// offered by the device, should be automatically accepted.
+func (cfg *DeviceConfiguration) AutoAcceptsFolder(id, label string) bool {
+	if !cfg.AutoAcceptFolders {
+		return false
+	}
+	if len(cfg.AutoAcceptFolderPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range cfg.AutoAcceptFolderPatterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, label); ok && label != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func sortedObservedFolderSlice(input map[string]ObservedFolder) []ObservedFolder {
 	output := make([]ObservedFolder, 0, len(input))
 	for _, folder := range input {
@@ -9,6 +9,8 @@ package config
 import (
 	"errors"
 	"fmt"
+	"os"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
 	"github.com/syncthing/syncthing/lib/util"
 )
 
@@ -26,7 +29,28 @@ var (
 	ErrMarkerMissing    = errors.New("folder marker missing (this indicates potential data loss, search docs/forum to get information about how to proceed)")
 )
 
-const DefaultMarkerName = ".stfolder"
+const (
+	DefaultMarkerName           = ".stfolder"
+	DefaultWeakHashThresholdPct = 25
+)
+
+var (
+	windowsEnvVarExp = regexp.MustCompile(`%[A-Za-z_][A-Za-z0-9_()]*%`)
+
+	// unsetPathEnvs holds the names of unset environment variables used in
+	// folder paths that we have already warned about.
+	unsetPathEnvs    = make(map[string]struct{})
+	unsetPathEnvsMut = sync.NewMutex()
+
+	// folderKeys holds the keys derived by DeriveFolderKey, per folder ID.
+	folderKeys    = make(map[string]folderKey)
+	folderKeysMut = sync.NewMutex()
+)
+
+type folderKey struct {
+	password string
+	key      []byte
+}
 
 type FolderConfiguration struct {
 	ID                      string                      `xml:"id,attr" json:"id"`
@@ -38,25 +62,43 @@ type FolderConfiguration struct {
 	RescanIntervalS         int                         `xml:"rescanIntervalS,attr" json:"rescanIntervalS" default:"3600"`
 	FSWatcherEnabled        bool                        `xml:"fsWatcherEnabled,attr" json:"fsWatcherEnabled" default:"true"`
 	FSWatcherDelayS         int                         `xml:"fsWatcherDelayS,attr" json:"fsWatcherDelayS" default:"10"`
+	ScanOnConnect           bool                        `xml:"scanOnConnect" json:"scanOnConnect"` // Scan when a device sharing the folder connects, mostly useful without rescan interval and watcher.
 	IgnorePerms             bool                        `xml:"ignorePerms,attr" json:"ignorePerms"`
 	AutoNormalize           bool                        `xml:"autoNormalize,attr" json:"autoNormalize" default:"true"`
 	MinDiskFree             Size                        `xml:"minDiskFree" json:"minDiskFree" default:"1%"`
 	Versioning              VersioningConfiguration     `xml:"versioning" json:"versioning"`
-	Copiers                 int                         `xml:"copiers" json:"copiers"` // This defines how many files are handled concurrently.
+	FollowSymlinks          FollowSymlinksConfiguration `xml:"followSymlinks" json:"followSymlinks"`
+	Copiers                 int                         `xml:"copiers" json:"copiers" restart:"false"`        // This defines how many files are handled concurrently. Zero sets the default.
+	Pullers                 int                         `xml:"pullerRoutines" json:"pullers" restart:"false"` // Routines requesting blocks from other devices, within the PullerMaxPendingKiB limit. Zero sets the default.
+	Finishers               int                         `xml:"finishers" json:"finishers" restart:"false"`    // Routines finalizing pulled files. Zero sets the default.
 	PullerMaxPendingKiB     int                         `xml:"pullerMaxPendingKiB" json:"pullerMaxPendingKiB"`
 	Hashers                 int                         `xml:"hashers" json:"hashers"` // Less than one sets the value to the number of cores. These are CPU bound due to hashing.
 	Order                   PullOrder                   `xml:"order" json:"order"`
+	PullPriorityPatterns    []string                    `xml:"pullPriorityPattern" json:"pullPriorityPatterns"` // Files matching these globs are pulled first, regardless of the order.
 	IgnoreDelete            bool                        `xml:"ignoreDelete" json:"ignoreDelete"`
+	IgnoreMode              IgnoreMode                  `xml:"ignoreMode" json:"ignoreMode"`
 	ScanProgressIntervalS   int                         `xml:"scanProgressIntervalS" json:"scanProgressIntervalS"` // Set to a negative value to disable. Value of 0 will get replaced with value of 2 (default value)
 	PullerPauseS            int                         `xml:"pullerPauseS" json:"pullerPauseS"`
 	MaxConflicts            int                         `xml:"maxConflicts" json:"maxConflicts" default:"-1"`
+	ConflictResolution      ConflictResolution          `xml:"conflictResolution" json:"conflictResolution"`
 	DisableSparseFiles      bool                        `xml:"disableSparseFiles" json:"disableSparseFiles"`
+	VerifyReassembled       bool                        `xml:"verifyReassembled" json:"verifyReassembled"`
 	DisableTempIndexes      bool                        `xml:"disableTempIndexes" json:"disableTempIndexes"`
 	Paused                  bool                        `xml:"paused" json:"paused"`
 	WeakHashThresholdPct    int                         `xml:"weakHashThresholdPct" json:"weakHashThresholdPct"` // Use weak hash if more than X percent of the file has changed. Set to -1 to always use weak hash.
 	MarkerName              string                      `xml:"markerName" json:"markerName"`
+	EncryptionPassword      string                      `xml:"encryptionPassword" json:"encryptionPassword"` // Used towards untrusted devices
 	CopyOwnershipFromParent bool                        `xml:"copyOwnershipFromParent" json:"copyOwnershipFromParent"`
 	RawModTimeWindowS       int                         `xml:"modTimeWindowS" json:"modTimeWindowS"`
+	BlockSizeStrategy       protocol.BlockSizeStrategy  `xml:"blockSizeStrategy" json:"blockSizeStrategy"`
+	ScanVerifyFraction      float64                     `xml:"scanVerifyFraction" json:"scanVerifyFraction"`         // Fraction of unchanged files that are hashed anyway when scanning, to detect corruption.
+	RejectPatterns          []string                    `xml:"rejectPattern" json:"rejectPatterns"`                  // Incoming items matching these globs, and anything below them, are never pulled, regardless of ignores.
+	MaxFileSize             int64                       `xml:"maxFileSize" json:"maxFileSize"`                       // Incoming files larger than this many bytes are never pulled. Zero means no limit.
+	VerifyMaxKiBps          int                         `xml:"verifyMaxKiBps" json:"verifyMaxKiBps" restart:"false"` // Rate at which files are read when verifying the folder. Zero means no limit.
+	VerifyResync            bool                        `xml:"verifyResync" json:"verifyResync" restart:"false"`     // Pull files that fail verification again from other devices.
+	PreserveHardlinks       bool                        `xml:"preserveHardlinks" json:"preserveHardlinks"`           // Files hardlinked within the folder are hardlinked when pulled, instead of copied.
+	SkipContentTypes        []string                    `xml:"skipContentType" json:"skipContentTypes"`              // Local files whose sniffed MIME type is one of these, or matches "type/*", are skipped when scanning.
+	TrackVersionHistory     bool                        `xml:"trackVersionHistory" json:"trackVersionHistory"`       // Keep the latest version changes of each file, for debugging why it changed.
 
 	cachedFilesystem    fs.Filesystem
 	cachedModTimeWindow time.Duration
@@ -91,6 +133,18 @@ func (f FolderConfiguration) Copy() FolderConfiguration {
 	c.Devices = make([]FolderDeviceConfiguration, len(f.Devices))
 	copy(c.Devices, f.Devices)
 	c.Versioning = f.Versioning.Copy()
+	if f.PullPriorityPatterns != nil {
+		c.PullPriorityPatterns = make([]string, len(f.PullPriorityPatterns))
+		copy(c.PullPriorityPatterns, f.PullPriorityPatterns)
+	}
+	if f.RejectPatterns != nil {
+		c.RejectPatterns = make([]string, len(f.RejectPatterns))
+		copy(c.RejectPatterns, f.RejectPatterns)
+	}
+	if f.SkipContentTypes != nil {
+		c.SkipContentTypes = make([]string, len(f.SkipContentTypes))
+		copy(c.SkipContentTypes, f.SkipContentTypes)
+	}
 	return c
 }
 
@@ -99,7 +153,7 @@ func (f FolderConfiguration) Filesystem() fs.Filesystem {
 	// cfg.Folders["default"].Filesystem() should be valid.
 	if f.cachedFilesystem == nil {
 		l.Infoln("bug: uncached filesystem call (should only happen in tests)")
-		return fs.NewFilesystem(f.FilesystemType, f.Path)
+		return fs.NewFilesystem(f.FilesystemType, expandPath(f.Path), f.FollowSymlinks.walkOptions()...)
 	}
 	return f.cachedFilesystem
 }
@@ -206,7 +260,9 @@ func (f *FolderConfiguration) DeviceIDs() []protocol.DeviceID {
 }
 
 func (f *FolderConfiguration) prepare() {
-	f.cachedFilesystem = fs.NewFilesystem(f.FilesystemType, f.Path)
+	// The path is kept as given, so that it is saved unexpanded, while the
+	// filesystem uses the expanded variant.
+	f.cachedFilesystem = fs.NewFilesystem(f.FilesystemType, expandPath(f.Path), f.FollowSymlinks.walkOptions()...)
 
 	if f.RescanIntervalS > MaxRescanIntervalS {
 		f.RescanIntervalS = MaxRescanIntervalS
@@ -216,7 +272,7 @@ func (f *FolderConfiguration) prepare() {
 
 	if f.FSWatcherDelayS <= 0 {
 		f.FSWatcherEnabled = false
-		f.FSWatcherDelayS = 10
+		f.FSWatcherDelayS = Defaults().Folder.FSWatcherDelayS
 	}
 
 	if f.Versioning.Params == nil {
@@ -224,13 +280,36 @@ func (f *FolderConfiguration) prepare() {
 	}
 
 	if f.WeakHashThresholdPct == 0 {
-		f.WeakHashThresholdPct = 25
+		f.WeakHashThresholdPct = DefaultWeakHashThresholdPct
 	}
 
 	if f.MarkerName == "" {
 		f.MarkerName = DefaultMarkerName
 	}
 
+	if f.Copiers < 0 {
+		f.Copiers = 0
+	}
+	if f.Pullers < 0 {
+		f.Pullers = 0
+	}
+	if f.Finishers < 0 {
+		f.Finishers = 0
+	}
+
+	if f.MaxFileSize < 0 {
+		f.MaxFileSize = 0
+	}
+	if f.VerifyMaxKiBps < 0 {
+		f.VerifyMaxKiBps = 0
+	}
+
+	if f.ScanVerifyFraction < 0 {
+		f.ScanVerifyFraction = 0
+	} else if f.ScanVerifyFraction > 1 {
+		f.ScanVerifyFraction = 1
+	}
+
 	switch {
 	case f.RawModTimeWindowS > 0:
 		f.cachedModTimeWindow = time.Duration(f.RawModTimeWindowS) * time.Second
@@ -266,6 +345,30 @@ func (f FolderConfiguration) RequiresRestartOnly() FolderConfiguration {
 	return copy
 }
 
+// DeriveFolderKey returns the key the given folder is encrypted with
+// towards untrusted devices, as derived from its password. The derivation
+// is deliberately slow, so the key is cached until the password changes.
+func DeriveFolderKey(folderID, password string) []byte {
+	folderKeysMut.Lock()
+	defer folderKeysMut.Unlock()
+	if cached, ok := folderKeys[folderID]; ok && cached.password == password {
+		return cached.key
+	}
+	key := protocol.KeyFromPassword(folderID, password)[:]
+	folderKeys[folderID] = folderKey{password: password, key: key}
+	return key
+}
+
+// FolderKey returns the key the folder is encrypted with towards untrusted
+// devices, or nil if it has no password. The key is derived when the
+// configuration is validated.
+func (f FolderConfiguration) FolderKey() []byte {
+	if f.EncryptionPassword == "" {
+		return nil
+	}
+	return DeriveFolderKey(f.ID, f.EncryptionPassword)
+}
+
 func (f *FolderConfiguration) SharedWith(device protocol.DeviceID) bool {
 	for _, dev := range f.Devices {
 		if dev.DeviceID == device {
@@ -293,3 +396,34 @@ func (f *FolderConfiguration) CheckAvailableSpace(req int64) error {
 	}
 	return fmt.Errorf("insufficient space in %v %v", fs.Type(), fs.URI())
 }
+
+// expandPath expands environment variables in the ${VAR} and $VAR forms
+// (plus %VAR% on Windows) and a leading tilde in the given folder path.
+// Undefined variables expand to the empty string.
+func expandPath(path string) string {
+	if runtime.GOOS == "windows" {
+		path = windowsEnvVarExp.ReplaceAllStringFunc(path, func(v string) string {
+			return lookupPathEnv(v[1 : len(v)-1])
+		})
+	}
+	path = os.Expand(path, lookupPathEnv)
+	if expanded, err := fs.ExpandTilde(path); err == nil {
+		path = expanded
+	}
+	return path
+}
+
+// lookupPathEnv returns the value of the named environment variable. An
+// unset variable results in a warning, logged once per variable.
+func lookupPathEnv(name string) string {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		unsetPathEnvsMut.Lock()
+		if _, ok := unsetPathEnvs[name]; !ok {
+			unsetPathEnvs[name] = struct{}{}
+			l.Warnf("Environment variable %q used in folder path is not set", name)
+		}
+		unsetPathEnvsMut.Unlock()
+	}
+	return val
+}
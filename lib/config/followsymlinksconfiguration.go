@@ -0,0 +1,31 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import "github.com/syncthing/syncthing/lib/fs"
+
+const DefaultFollowSymlinksMaxDepth = 5
+
+// FollowSymlinksConfiguration determines whether symlinks in the folder are
+// scanned as the content they point to, instead of as symlinks. MaxDepth is
+// the number of symlinks that are followed within a path, zero meaning
+// DefaultFollowSymlinksMaxDepth.
+type FollowSymlinksConfiguration struct {
+	Enabled  bool `xml:"enabled,attr" json:"enabled"`
+	MaxDepth int  `xml:"maxDepth,attr" json:"maxDepth"`
+}
+
+func (c FollowSymlinksConfiguration) walkOptions() []fs.WalkOption {
+	if !c.Enabled {
+		return nil
+	}
+	maxDepth := c.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultFollowSymlinksMaxDepth
+	}
+	return []fs.WalkOption{fs.WithFollowSymlinks(maxDepth)}
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import "fmt"
+
+// IgnoreMode determines how the patterns in the ignore file are applied.
+type IgnoreMode int
+
+const (
+	IgnoreModeDenylist  IgnoreMode = iota // default, matching files are ignored
+	IgnoreModeAllowlist                   // matching files are synced, everything else is ignored
+)
+
+func (m IgnoreMode) String() string {
+	switch m {
+	case IgnoreModeDenylist:
+		return "denylist"
+	case IgnoreModeAllowlist:
+		return "allowlist"
+	default:
+		return "unknown"
+	}
+}
+
+func (m IgnoreMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *IgnoreMode) UnmarshalText(bs []byte) error {
+	switch string(bs) {
+	case "", "denylist":
+		*m = IgnoreModeDenylist
+	case "allowlist":
+		*m = IgnoreModeAllowlist
+	default:
+		return fmt.Errorf("unknown ignore mode %q", string(bs))
+	}
+	return nil
+}
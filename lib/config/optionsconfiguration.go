@@ -20,9 +20,11 @@ type OptionsConfiguration struct {
 	LocalAnnEnabled         bool     `xml:"localAnnounceEnabled" json:"localAnnounceEnabled" default:"true" restart:"true"`
 	LocalAnnPort            int      `xml:"localAnnouncePort" json:"localAnnouncePort" default:"21027" restart:"true"`
 	LocalAnnMCAddr          string   `xml:"localAnnounceMCAddr" json:"localAnnounceMCAddr" default:"[ff12::8384]:21027" restart:"true"`
+	LocalAnnMDNSEnabled     bool     `xml:"localAnnounceMDNSEnabled" json:"localAnnounceMDNSEnabled" default:"false" restart:"true"` // independent of localAnnounceEnabled
 	MaxSendKbps             int      `xml:"maxSendKbps" json:"maxSendKbps"`
 	MaxRecvKbps             int      `xml:"maxRecvKbps" json:"maxRecvKbps"`
 	ReconnectIntervalS      int      `xml:"reconnectionIntervalS" json:"reconnectionIntervalS" default:"60"`
+	MaxReconnectIntervalS   int      `xml:"maxReconnectionIntervalS" json:"maxReconnectionIntervalS" default:"900"`
 	RelaysEnabled           bool     `xml:"relaysEnabled" json:"relaysEnabled" default:"true"`
 	RelayReconnectIntervalM int      `xml:"relayReconnectIntervalM" json:"relayReconnectIntervalM" default:"10"`
 	StartBrowser            bool     `xml:"startBrowser" json:"startBrowser" default:"true"`
@@ -48,17 +50,34 @@ type OptionsConfiguration struct {
 	AlwaysLocalNets         []string `xml:"alwaysLocalNet" json:"alwaysLocalNets"`
 	OverwriteRemoteDevNames bool     `xml:"overwriteRemoteDeviceNamesOnConnect" json:"overwriteRemoteDeviceNamesOnConnect" default:"false"`
 	TempIndexMinBlocks      int      `xml:"tempIndexMinBlocks" json:"tempIndexMinBlocks" default:"10"`
+	TempIndexIntervalMs     int      `xml:"tempIndexIntervalMs" json:"tempIndexIntervalMs" default:"250"` // <= 0 to use progressUpdateIntervalS
 	UnackedNotificationIDs  []string `xml:"unackedNotificationID" json:"unackedNotificationIDs"`
 	TrafficClass            int      `xml:"trafficClass" json:"trafficClass"`
 	DefaultFolderPath       string   `xml:"defaultFolderPath" json:"defaultFolderPath" default:"~"`
 	SetLowPriority          bool     `xml:"setLowPriority" json:"setLowPriority" default:"true"`
 	MaxConcurrentScans      int      `xml:"maxConcurrentScans" json:"maxConcurrentScans"`
+	MaxRequestsPerSecond    int      `xml:"maxRequestsPerSecond" json:"maxRequestsPerSecond"`                              // per device, 0 for unlimited
 	CRURL                   string   `xml:"crashReportingURL" json:"crURL" default:"https://crash.syncthing.net/newcrash"` // crash reporting URL
 	CREnabled               bool     `xml:"crashReportingEnabled" json:"crashReportingEnabled" default:"true" restart:"true"`
 	StunKeepaliveStartS     int      `xml:"stunKeepaliveStartS" json:"stunKeepaliveStartS" default:"180"` // 0 for off
 	StunKeepaliveMinS       int      `xml:"stunKeepaliveMinS" json:"stunKeepaliveMinS" default:"20"`      // 0 for off
 	RawStunServers          []string `xml:"stunServer" json:"stunServers" default:"default"`
 	DatabaseTuning          Tuning   `xml:"databaseTuning" json:"databaseTuning" restart:"true"`
+	EnabledTransports       []string `xml:"enabledTransport" json:"enabledTransports"`                           // Empty means all transports are enabled
+	ConnLimitPerDevice      int      `xml:"connectionLimitPerDevice" json:"connectionLimitPerDevice"`            // 0 for unlimited
+	ConnectionIdleTimeoutS  int      `xml:"connectionIdleTimeoutS" json:"connectionIdleTimeoutS"`                // 0 for off
+	ConnectionDrainTimeoutS int      `xml:"connectionDrainTimeoutS" json:"connectionDrainTimeoutS" default:"10"` // 0 for off
+	ScanJitterPct           int      `xml:"scanJitterPct" json:"scanJitterPct" default:"25"`                     // Periodic scans happen at a random time within this percentage of the rescan interval
+	DatabaseDir             string   `xml:"databaseDir" json:"databaseDir" restart:"true"`                       // Empty means the default location in the config directory
+	DatabaseStoreURL        string   `xml:"databaseStoreURL" json:"databaseStoreURL" restart:"true"`             // Object store to persist the database to, e.g. s3://host/bucket/prefix
+	DialFamily              string   `xml:"dialFamily" json:"dialFamily" default:"both"`                         // Which IP families to dial, one of "both", "ipv4" or "ipv6"
+	DeviceCertCAFile        string   `xml:"deviceCertCAFile" json:"deviceCertCAFile"`                            // If set, device certificates must also be signed by a CA in this PEM bundle
+	TLSMinVersion           string   `xml:"tlsMinVersion" json:"tlsMinVersion" default:"1.2" restart:"true"`     // Minimum TLS version for device connections, "1.0" to "1.3"
+	TLSCipherSuites         []string `xml:"tlsCipherSuite" json:"tlsCipherSuites" restart:"true"`                // Cipher suite names as in crypto/tls, empty means the built in list. Not used for TLS 1.3.
+	SnapshotDir             string   `xml:"snapshotDir" json:"snapshotDir"`                                      // If set, snapshots are written to this directory instead of returned in the response
+	QUICIdleTimeoutS        int      `xml:"quicIdleTimeoutS" json:"quicIdleTimeoutS" restart:"true"`             // How long a QUIC connection may go without traffic before it's considered dead, 0 for the default of 10 s
+
+	ConnectionPriorities []TransportPriority `xml:"connectionPriority" json:"connectionPriorities"` // Overrides the built in transport priorities
 
 	DeprecatedUPnPEnabled        bool     `xml:"upnpEnabled,omitempty" json:"-"`
 	DeprecatedUPnPLeaseM         int      `xml:"upnpLeaseMinutes,omitempty" json:"-"`
@@ -68,6 +87,21 @@ type OptionsConfiguration struct {
 	DeprecatedMinHomeDiskFreePct float64  `xml:"minHomeDiskFreePct,omitempty" json:"-"`
 }
 
+// IP families to dial, for the dialFamily option.
+const (
+	DialFamilyBoth = "both"
+	DialFamilyIPv4 = "ipv4"
+	DialFamilyIPv6 = "ipv6"
+)
+
+// TransportPriority overrides the priority of connections over a given
+// transport. When there are several connections to a device the one with
+// the lowest priority value is kept.
+type TransportPriority struct {
+	Transport string `xml:"transport,attr" json:"transport"`
+	Priority  int    `xml:",chardata" json:"priority"`
+}
+
 func (opts OptionsConfiguration) Copy() OptionsConfiguration {
 	optsCopy := opts
 	optsCopy.RawListenAddresses = make([]string, len(opts.RawListenAddresses))
@@ -78,6 +112,12 @@ func (opts OptionsConfiguration) Copy() OptionsConfiguration {
 	copy(optsCopy.AlwaysLocalNets, opts.AlwaysLocalNets)
 	optsCopy.UnackedNotificationIDs = make([]string, len(opts.UnackedNotificationIDs))
 	copy(optsCopy.UnackedNotificationIDs, opts.UnackedNotificationIDs)
+	optsCopy.EnabledTransports = make([]string, len(opts.EnabledTransports))
+	copy(optsCopy.EnabledTransports, opts.EnabledTransports)
+	optsCopy.ConnectionPriorities = make([]TransportPriority, len(opts.ConnectionPriorities))
+	copy(optsCopy.ConnectionPriorities, opts.ConnectionPriorities)
+	optsCopy.TLSCipherSuites = make([]string, len(opts.TLSCipherSuites))
+	copy(optsCopy.TLSCipherSuites, opts.TLSCipherSuites)
 	return optsCopy
 }
 
@@ -99,6 +139,32 @@ func (opts OptionsConfiguration) IsStunDisabled() bool {
 	return opts.StunKeepaliveMinS < 1 || opts.StunKeepaliveStartS < 1 || !opts.NATEnabled
 }
 
+// IsTransportEnabled returns true if the given transport ("tcp", "quic" or
+// "relay") may be used for listening and dialing.
+func (opts OptionsConfiguration) IsTransportEnabled(transport string) bool {
+	if len(opts.EnabledTransports) == 0 {
+		return true
+	}
+	for _, enabled := range opts.EnabledTransports {
+		if enabled == transport {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionPriority returns the priority of connections over the given
+// transport ("tcp", "quic" or "relay"), or def if it has not been
+// overridden. Lower is better.
+func (opts OptionsConfiguration) ConnectionPriority(transport string, def int) int {
+	for _, prio := range opts.ConnectionPriorities {
+		if prio.Transport == transport {
+			return prio.Priority
+		}
+	}
+	return def
+}
+
 func (opts OptionsConfiguration) ListenAddresses() []string {
 	var addresses []string
 	for _, addr := range opts.RawListenAddresses {
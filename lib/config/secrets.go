@@ -0,0 +1,114 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sensitive values may be given as "${env:VARNAME}" or "${file:/path}",
+// in which case they are read from the environment or the given file when
+// the configuration is loaded.
+var secretRefExpr = regexp.MustCompile(`^\$\{(env|file):(.+)\}$`)
+
+var errSecretEmpty = errors.New("secret resolves to an empty value")
+
+// secretRef is a reference to a secret kept outside of the configuration,
+// and the value it resolved to when loading.
+type secretRef struct {
+	ref   string
+	value string
+}
+
+func isSecretRef(s string) bool {
+	return secretRefExpr.MatchString(s)
+}
+
+// resolveSecret returns the value the given reference points to. Strings
+// that aren't references are returned as is.
+func resolveSecret(s string) (string, error) {
+	m := secretRefExpr.FindStringSubmatch(s)
+	if m == nil {
+		return s, nil
+	}
+
+	var value string
+	switch m[1] {
+	case "env":
+		v, ok := os.LookupEnv(m[2])
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", m[2])
+		}
+		value = v
+	case "file":
+		bs, err := ioutil.ReadFile(m[2])
+		if err != nil {
+			return "", errors.Wrap(err, "reading secret")
+		}
+		value = strings.TrimRight(string(bs), "\r\n")
+	}
+
+	if value == "" {
+		return "", errSecretEmpty
+	}
+	return value, nil
+}
+
+// secretFields returns pointers to the sensitive fields, keyed by a name
+// that stays the same across copies of the configuration.
+func (cfg *Configuration) secretFields() map[string]*string {
+	fields := map[string]*string{
+		"gui apikey":   &cfg.GUI.APIKey,
+		"gui password": &cfg.GUI.Password,
+	}
+	for i := range cfg.Folders {
+		fields[fmt.Sprintf("folder %q encryptionPassword", cfg.Folders[i].ID)] = &cfg.Folders[i].EncryptionPassword
+	}
+	for i := range cfg.Webhooks {
+		fields[fmt.Sprintf("webhook %q secret", cfg.Webhooks[i].URL)] = &cfg.Webhooks[i].Secret
+	}
+	return fields
+}
+
+// resolveSecrets replaces references in the sensitive fields with the
+// values they point to, remembering the references for serialization.
+func (cfg *Configuration) resolveSecrets() error {
+	var refs map[string]secretRef
+	for name, field := range cfg.secretFields() {
+		if !isSecretRef(*field) {
+			continue
+		}
+		value, err := resolveSecret(*field)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if refs == nil {
+			refs = make(map[string]secretRef)
+		}
+		refs[name] = secretRef{ref: *field, value: value}
+		*field = value
+	}
+	// The map is never modified after this, so copies may share it.
+	cfg.secretRefs = refs
+	return nil
+}
+
+// unresolveSecrets puts the references back in place of the values they
+// resolved to, unless the value has been changed since.
+func (cfg *Configuration) unresolveSecrets() {
+	for name, field := range cfg.secretFields() {
+		if ref, ok := cfg.secretRefs[name]; ok && *field == ref.value {
+			*field = ref.ref
+		}
+	}
+}
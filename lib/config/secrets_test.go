@@ -0,0 +1,156 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const secretsXML = `<configuration version="%d">
+    <folder id="default" path="testdata">
+        <encryptionPassword>%s</encryptionPassword>
+    </folder>
+    <gui>
+        <apikey>%s</apikey>
+    </gui>
+</configuration>`
+
+func readSecretsXML(apiKey, encryptionPassword string) (Configuration, error) {
+	xml := fmt.Sprintf(secretsXML, CurrentVersion, encryptionPassword, apiKey)
+	return ReadXML(strings.NewReader(xml), device1)
+}
+
+func TestSecretReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("STTEST_APIKEY", "from-env")
+	defer os.Unsetenv("STTEST_APIKEY")
+
+	envRef := "${env:STTEST_APIKEY}"
+	fileRef := "${file:" + path + "}"
+	cfg, err := readSecretsXML(envRef, fileRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GUI.APIKey != "from-env" {
+		t.Errorf("API key is %q, expected the environment value", cfg.GUI.APIKey)
+	}
+	if cfg.Folders[0].EncryptionPassword != "from-file" {
+		t.Errorf("Encryption password is %q, expected the file contents", cfg.Folders[0].EncryptionPassword)
+	}
+
+	// The references are written back, not the values.
+	buf := new(bytes.Buffer)
+	if err := cfg.WriteXML(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"from-env", "from-file"} {
+		if bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Errorf("Written config contains the resolved value %q", s)
+		}
+	}
+	for _, s := range []string{envRef, fileRef} {
+		if !bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Errorf("Written config lacks the reference %q", s)
+		}
+	}
+	reread, err := ReadXML(buf, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reread.GUI.APIKey != "from-env" || reread.Folders[0].EncryptionPassword != "from-file" {
+		t.Error("Secrets not resolved when rereading the written config")
+	}
+
+	// A value changed after loading replaces the reference.
+	cfg.GUI.APIKey = "changed"
+	buf.Reset()
+	if err := cfg.WriteXML(buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte(envRef)) || !bytes.Contains(buf.Bytes(), []byte("changed")) {
+		t.Error("Changed API key not written")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(fileRef)) {
+		t.Error("Unchanged reference not written")
+	}
+}
+
+func TestSecretReferenceErrors(t *testing.T) {
+	os.Setenv("STTEST_EMPTY", "")
+	defer os.Unsetenv("STTEST_EMPTY")
+	os.Unsetenv("STTEST_UNSET")
+
+	cases := []struct {
+		apiKey, encryptionPassword string
+	}{
+		{"${env:STTEST_UNSET}", ""},
+		{"${env:STTEST_EMPTY}", ""},
+		{"abc123", "${file:testdata/does-not-exist}"},
+	}
+	for _, tc := range cases {
+		if _, err := readSecretsXML(tc.apiKey, tc.encryptionPassword); err == nil {
+			t.Errorf("Expected an error loading %q, %q", tc.apiKey, tc.encryptionPassword)
+		}
+	}
+
+	// Things that merely look a bit like references are plain values.
+	cfg, err := readSecretsXML("${env:}", "${nope:foo}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GUI.APIKey != "${env:}" || cfg.Folders[0].EncryptionPassword != "${nope:foo}" {
+		t.Error("Non-references were modified")
+	}
+}
+
+func TestSecretReferencesReplace(t *testing.T) {
+	os.Setenv("STTEST_APIKEY", "from-env")
+	defer os.Unsetenv("STTEST_APIKEY")
+
+	cfg, err := readSecretsXML("${env:STTEST_APIKEY}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wrap("/dev/null", cfg)
+
+	// The GUI posts the config with the resolved values.
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(w.RawCopy()); err != nil {
+		t.Fatal(err)
+	}
+	posted, err := ReadJSON(buf, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Replace(posted); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	raw := w.RawCopy()
+	if err := raw.WriteXML(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("${env:STTEST_APIKEY}")) {
+		t.Error("Reference lost when replacing the config")
+	}
+}
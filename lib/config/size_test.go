@@ -7,8 +7,11 @@
 package config
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/util"
 )
 
@@ -130,3 +133,55 @@ func TestFormatSI(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckFreeSpace(t *testing.T) {
+	usage := fs.Usage{Free: 2e9, Total: 100e9} // 2 GB, 2 %
+
+	cases := []struct {
+		req string
+		ok  bool
+	}{
+		{"", true},
+		{"0 %", true},
+		{"1 %", true},
+		{"2 %", true},
+		{"3 %", false},
+		{"1000000", true}, // bytes, without a unit
+		{"1999 MB", true},
+		{"2001 MB", false},
+		{"1.5 GB", true},
+		{"2.5 GB", false},
+	}
+
+	for _, tc := range cases {
+		req, err := ParseSize(tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckFreeSpace(req, usage); (err == nil) != tc.ok {
+			t.Errorf("CheckFreeSpace(%q) => %v, expected ok %v", tc.req, err, tc.ok)
+		}
+	}
+}
+
+func TestMinDiskFreeWithoutUnit(t *testing.T) {
+	// A plain number, as written by hand or by older versions, is an
+	// absolute number of bytes.
+	const xml = `<configuration version="29">
+	<folder id="default" path="/tmp">
+		<minDiskFree>5000000</minDiskFree>
+	</folder>
+</configuration>`
+
+	cfg, err := ReadXML(strings.NewReader(xml), protocol.LocalDeviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := cfg.Folders[0].MinDiskFree
+	if size.Percentage() || size.BaseValue() != 5e6 {
+		t.Errorf("expected 5 MB, got %v", size)
+	}
+	if err := CheckFreeSpace(size, fs.Usage{Free: 4e6, Total: 1e12}); err == nil {
+		t.Error("unexpected nil error with less space free")
+	}
+}
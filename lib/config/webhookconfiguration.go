@@ -0,0 +1,55 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+// WebhookConfiguration is an URL that the events of the given types are
+// posted to. Without any event types, all events are posted.
+type WebhookConfiguration struct {
+	URL    string   `xml:"url,attr" json:"url"`
+	Events []string `xml:"event" json:"events"`
+	Secret string   `xml:"secret,omitempty" json:"secret"` // for the signature of the requests
+}
+
+func (c WebhookConfiguration) Copy() WebhookConfiguration {
+	c.Events = append([]string(nil), c.Events...)
+	return c
+}
+
+// EventMask returns the mask of the event types posted to the webhook.
+func (c WebhookConfiguration) EventMask() (events.EventType, error) {
+	if len(c.Events) == 0 {
+		return events.AllEvents, nil
+	}
+	var mask events.EventType
+	for _, name := range c.Events {
+		t := events.UnmarshalEventType(name)
+		if t == 0 {
+			return 0, fmt.Errorf("event type %q: %v", name, errUnknownEventType)
+		}
+		mask |= t
+	}
+	return mask, nil
+}
+
+func (c WebhookConfiguration) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errWebhookScheme
+	}
+	_, err = c.EventMask()
+	return err
+}
@@ -7,6 +7,7 @@
 package config
 
 import (
+	"io"
 	"os"
 	"sync/atomic"
 	"time"
@@ -61,6 +62,7 @@ type Wrapper interface {
 	Replace(cfg Configuration) (Waiter, error)
 	RequiresRestart() bool
 	Save() error
+	ExportJSON(w io.Writer, withSecrets bool) error
 
 	GUI() GUIConfiguration
 	SetGUI(gui GUIConfiguration) (Waiter, error)
@@ -182,6 +184,12 @@ func (w *wrapper) Replace(cfg Configuration) (Waiter, error) {
 func (w *wrapper) replaceLocked(to Configuration) (Waiter, error) {
 	from := w.cfg
 
+	// Configurations posted by the GUI don't know where the secrets came
+	// from, keep writing the references as long as the values are the same.
+	if to.secretRefs == nil {
+		to.secretRefs = from.secretRefs
+	}
+
 	if err := to.clean(); err != nil {
 		return noopWaiter{}, err
 	}
@@ -435,6 +443,14 @@ func (w *wrapper) Save() error {
 	return nil
 }
 
+// ExportJSON writes the current configuration as JSON, which ImportJSON
+// reads. Secrets are redacted unless withSecrets is set.
+func (w *wrapper) ExportJSON(wr io.Writer, withSecrets bool) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.cfg.WriteJSON(wr, withSecrets)
+}
+
 func (w *wrapper) RequiresRestart() bool {
 	return atomic.LoadUint32(&w.requiresRestart) != 0
 }
@@ -7,11 +7,34 @@
 package connections
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+	"github.com/syncthing/syncthing/lib/tlsutil"
 )
 
 func TestFixupPort(t *testing.T) {
@@ -19,6 +42,10 @@ func TestFixupPort(t *testing.T) {
 		{"tcp://1.2.3.4:5", "tcp://1.2.3.4:5"},
 		{"tcp://1.2.3.4:", "tcp://1.2.3.4:22000"},
 		{"tcp://1.2.3.4", "tcp://1.2.3.4:22000"},
+		{"tcp://[fe80::1]", "tcp://[fe80::1]:22000"},
+		{"tcp://[fe80::1%25eth0]", "tcp://[fe80::1%25eth0]:22000"},
+		{"tcp://[fe80::1%25eth0]:", "tcp://[fe80::1%25eth0]:22000"},
+		{"tcp://[fe80::1%25eth0]:5", "tcp://[fe80::1%25eth0]:5"},
 	}
 
 	for _, tc := range cases {
@@ -167,3 +194,1087 @@ func TestGetDialer(t *testing.T) {
 		}
 	}
 }
+
+func TestEnabledTransports(t *testing.T) {
+	cfg := config.New(protocol.LocalDeviceID)
+	cfg.Options.EnabledTransports = []string{"tcp"}
+
+	cases := []struct {
+		uri     string
+		enabled bool
+	}{
+		{"tcp://1.2.3.4:5678", true},
+		{"tcp6://[::1]:5678", true},
+		{"quic://1.2.3.4:5678", false},
+		{"quic4://1.2.3.4:5678", false},
+		{"relay://1.2.3.4:5678", false},
+	}
+
+	for _, tc := range cases {
+		uri, err := url.Parse(tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = getDialerFactory(cfg, uri)
+		if tc.enabled && err != nil {
+			t.Errorf("getDialerFactory(%q) => %v, expected nil err", tc.uri, err)
+		} else if !tc.enabled && err != errDisabled {
+			t.Errorf("getDialerFactory(%q) => %v, expected %v", tc.uri, err, errDisabled)
+		}
+
+		_, err = getListenerFactory(cfg, uri)
+		if tc.enabled && err != nil {
+			t.Errorf("getListenerFactory(%q) => %v, expected nil err", tc.uri, err)
+		} else if !tc.enabled && err != errDisabled {
+			t.Errorf("getListenerFactory(%q) => %v, expected %v", tc.uri, err, errDisabled)
+		}
+	}
+}
+
+func TestConnectionPriorityReplacement(t *testing.T) {
+	relay := internalConn{connType: connTypeRelayServer, priority: relayPriority}
+	direct := internalConn{connType: connTypeTCPClient, priority: tcpPriority}
+
+	// A direct connection completing after a relayed one replaces it
+	if !shouldReplaceConnection(completeConn{internalConn: relay}, direct) {
+		t.Error("Direct connection should replace relay connection")
+	}
+	// ... but not the other way around
+	if shouldReplaceConnection(completeConn{internalConn: direct}, relay) {
+		t.Error("Relay connection should not replace direct connection")
+	}
+	if shouldReplaceConnection(completeConn{internalConn: direct}, direct) {
+		t.Error("Connection should not replace connection of equal priority")
+	}
+
+	// The priorities can be overridden in the config
+	opts := config.OptionsConfiguration{
+		ConnectionPriorities: []config.TransportPriority{{Transport: "relay", Priority: 5}},
+	}
+	relay.priority = opts.ConnectionPriority(relay.connType.Transport(), relay.priority)
+	if shouldReplaceConnection(completeConn{internalConn: relay}, direct) {
+		t.Error("Direct connection should not replace preferred relay connection")
+	}
+	if !shouldReplaceConnection(completeConn{internalConn: direct}, relay) {
+		t.Error("Preferred relay connection should replace direct connection")
+	}
+	if prio := (relayDialerFactory{}).Priority(opts); prio != 5 {
+		t.Errorf("Relay dialer priority is %d, expected 5", prio)
+	}
+	if prio := (tcpDialerFactory{}).Priority(opts); prio != tcpPriority {
+		t.Errorf("TCP dialer priority is %d, expected %d", prio, tcpPriority)
+	}
+}
+
+func TestConnectionLimitPerDevice(t *testing.T) {
+	pending := newPendingConnections()
+	var device protocol.DeviceID
+	newConn := func(ct connType, prio int) (internalConn, *fakeTLSConn) {
+		fc := &fakeTLSConn{}
+		return internalConn{fc, ct, prio}, fc
+	}
+
+	// The established connection is a relayed one
+	established := completeConn{internalConn: internalConn{&fakeTLSConn{}, connTypeRelayClient, relayPriority}}
+
+	tcp1, tcp1Fake := newConn(connTypeTCPClient, tcpPriority)
+	if !pending.add(device, tcp1, established, 2) {
+		t.Fatal("First pending connection should be kept")
+	}
+	quic, quicFake := newConn(connTypeQUICClient, quicPriority)
+	if !pending.add(device, quic, established, 2) {
+		t.Fatal("QUIC connection better than the established relay should be kept")
+	}
+
+	// Another relay connection is worse than all the others
+	relay, relayFake := newConn(connTypeRelayClient, relayPriority)
+	if pending.add(device, relay, established, 2) {
+		t.Error("Excess relay connection should be closed")
+	}
+	if !relayFake.closed {
+		t.Error("Excess relay connection was not closed")
+	}
+
+	// A better connection pushes out the lowest priority pending one
+	tcp2, tcp2Fake := newConn(connTypeTCPClient, tcpPriority)
+	if !pending.add(device, tcp2, established, 2) {
+		t.Error("Second TCP connection should be kept")
+	}
+	if !quicFake.closed {
+		t.Error("QUIC connection should have been closed in favour of TCP")
+	}
+	if tcp1Fake.closed || tcp2Fake.closed {
+		t.Error("TCP connections should not have been closed")
+	}
+	if established.tlsConn.(*fakeTLSConn).closed {
+		t.Error("Established connection should not be closed by the limit")
+	}
+
+	// Once handed over, they no longer count
+	pending.remove(tcp1)
+	pending.remove(tcp2)
+	if _, ok := pending.conns[device]; ok {
+		t.Error("Device should have no pending connections")
+	}
+
+	// With an established direct connection, the limit of one is taken
+	relay2, relay2Fake := newConn(connTypeRelayClient, relayPriority)
+	established = completeConn{internalConn: tcp1}
+	if pending.add(device, relay2, established, 1) || !relay2Fake.closed {
+		t.Error("Relay connection should be refused when a direct connection is established")
+	}
+
+	// No limit
+	for i := 0; i < 5; i++ {
+		if c, _ := newConn(connTypeRelayClient, relayPriority); !pending.add(device, c, established, 0) {
+			t.Fatal("Connections should not be limited")
+		}
+	}
+}
+
+func TestConnectionLimitPerDeviceIncoming(t *testing.T) {
+	s, mdl, lst, remoteCert := newHandleTest(t, 1)
+	defer lst.Close()
+	remoteID := protocol.NewDeviceID(remoteCert.Certificate[0])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.handle(ctx)
+
+	// connectIncoming connects as the remote device and returns the
+	// result of the hello exchange, which fails if we closed the
+	// connection.
+	connectIncoming := func() error {
+		tc, res := acceptIncoming(t, lst, remoteCert)
+		s.conns <- internalConn{tc, connTypeTCPServer, tcpPriority}
+		return <-res
+	}
+
+	// A dialed connection to the device is in progress, taking up the
+	// only slot.
+	dialed := internalConn{&fakeTLSConn{}, connTypeTCPClient, tcpPriority}
+	if !s.addPending(remoteID, dialed) {
+		t.Fatal("Dialed connection should be kept")
+	}
+	if err := connectIncoming(); err == nil {
+		t.Error("Incoming connection should have been closed")
+	}
+	select {
+	case c := <-mdl.added:
+		t.Fatalf("Incoming connection %v should not be handed to the model", c)
+	default:
+	}
+	pendingCount := func() int {
+		s.pending.mut.Lock()
+		defer s.pending.mut.Unlock()
+		return len(s.pending.conns[remoteID])
+	}
+	if n := pendingCount(); n != 1 {
+		t.Errorf("Expected only the dialed connection to be pending, got %d", n)
+	}
+
+	// Once the dialed connection is gone, the incoming one is accepted.
+	s.pending.remove(dialed)
+	if err := connectIncoming(); err != nil {
+		t.Error("Incoming connection should have been accepted:", err)
+	}
+	select {
+	case <-mdl.added:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Incoming connection wasn't handed to the model")
+	}
+	if n := pendingCount(); n != 0 {
+		t.Errorf("Accepted connection should no longer be pending, got %d", n)
+	}
+}
+
+func TestSimultaneousDirectAndRelayConnections(t *testing.T) {
+	for _, directFirst := range []bool{true, false} {
+		t.Run(fmt.Sprintf("directFirst=%v", directFirst), func(t *testing.T) {
+			s, mdl, lst, remoteCert := newHandleTest(t, 0)
+			defer lst.Close()
+			remoteID := protocol.NewDeviceID(remoteCert.Certificate[0])
+
+			// Both connections are established before either is
+			// handled.
+			s.conns = make(chan internalConn, 2)
+			directConn, directRes := acceptIncoming(t, lst, remoteCert)
+			relayConn, relayRes := acceptIncoming(t, lst, remoteCert)
+			defer directConn.Close()
+			defer relayConn.Close()
+			direct := internalConn{directConn, connTypeTCPServer, tcpPriority}
+			relay := internalConn{relayConn, connTypeRelayServer, relayPriority}
+			if directFirst {
+				s.conns <- direct
+				s.conns <- relay
+			} else {
+				s.conns <- relay
+				s.conns <- direct
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go s.handle(ctx)
+
+			if err := <-directRes; err != nil {
+				t.Error("Direct connection should have been kept:", err)
+			}
+			err := <-relayRes
+			if directFirst {
+				// The relay connection is turned down ...
+				if err == nil {
+					t.Error("Relay connection should have been closed")
+				}
+				if n := len(mdl.added); n != 1 {
+					t.Errorf("Expected only the direct connection to be handed to the model, got %d", n)
+				}
+			} else if n := len(mdl.added); n != 2 {
+				// ... or replaced.
+				t.Errorf("Expected the relay connection to be replaced by the direct one, got %d connections", n)
+			}
+
+			c, ok := mdl.Connection(remoteID)
+			if !ok || c.Type() != direct.Type() {
+				t.Errorf("Expected the direct connection to be established, got %v", c)
+			}
+		})
+	}
+}
+
+// newHandleTest returns a service for handling connections from a remote
+// device with the given connection limit, a listener it can connect to and
+// the remote device's certificate.
+func newHandleTest(t *testing.T, connLimit int) (*service, *fakeConnModel, net.Listener, tls.Certificate) {
+	t.Helper()
+
+	// With the name on them, so they pass verification.
+	myCert, remoteCert := newCASignedCert(t, nil, false), newCASignedCert(t, nil, false)
+	myID, remoteID := protocol.NewDeviceID(myCert.Certificate[0]), protocol.NewDeviceID(remoteCert.Certificate[0])
+
+	w := config.Wrap("/dev/null", config.New(myID), events.NoopLogger)
+	waiter, err := w.SetDevice(config.NewDeviceConfiguration(remoteID, "remote"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+	opts := w.Options()
+	opts.ConnLimitPerDevice = connLimit
+	waiter, err = w.SetOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+
+	mdl := &fakeConnModel{added: make(chan Connection, 2), mut: sync.NewMutex()}
+	s := &service{
+		cfg:                  w,
+		myID:                 myID,
+		model:                mdl,
+		conns:                make(chan internalConn),
+		limiter:              newLimiter(w),
+		pending:              newPendingConnections(),
+		idleRedials:          newIdleRedials(),
+		tlsDefaultCommonName: "syncthing",
+	}
+
+	lst, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{myCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, mdl, lst, remoteCert
+}
+
+// acceptIncoming connects to the listener as the remote device, returning
+// our end of the connection and the result of the hello exchange on the
+// remote end, which fails if we close the connection.
+func acceptIncoming(t *testing.T, lst net.Listener, remoteCert tls.Certificate) (*tls.Conn, <-chan error) {
+	t.Helper()
+	res := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", lst.Addr().String(), &tls.Config{
+			Certificates:       []tls.Certificate{remoteCert},
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			res <- err
+			return
+		}
+		_, err = protocol.ExchangeHello(conn, &protocol.Hello{DeviceName: "remote"})
+		if err == nil {
+			// Wait for the verdict after the hello exchange.
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err = conn.Read(make([]byte, 1)); isTimeout(err) {
+				err = nil
+			}
+		}
+		conn.Close()
+		res <- err
+	}()
+	conn, err := lst.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := conn.(*tls.Conn)
+	if err := tc.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	return tc, res
+}
+
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// fakeConnModel accepts all devices and keeps the last connection added as
+// the established one.
+type fakeConnModel struct {
+	protocol.Model
+	added    chan Connection
+	mut      sync.Mutex
+	conn     Connection
+	attempts map[protocol.DeviceID][]Attempt
+}
+
+func (m *fakeConnModel) AddConnection(conn Connection, _ protocol.HelloResult) {
+	m.mut.Lock()
+	m.conn = conn
+	m.mut.Unlock()
+	m.added <- conn
+}
+
+func (m *fakeConnModel) Connection(protocol.DeviceID) (Connection, bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.conn, m.conn != nil
+}
+
+func (m *fakeConnModel) OnHello(protocol.DeviceID, net.Addr, protocol.HelloResult) error {
+	return nil
+}
+
+func (m *fakeConnModel) GetHello(protocol.DeviceID) protocol.HelloIntf {
+	return &protocol.Hello{DeviceName: "local"}
+}
+
+func (m *fakeConnModel) DialAttempt(device protocol.DeviceID, attempt Attempt) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.attempts == nil {
+		m.attempts = make(map[protocol.DeviceID][]Attempt)
+	}
+	m.attempts[device] = append(m.attempts[device], attempt)
+}
+
+func (m *fakeConnModel) dialAttempts(device protocol.DeviceID) []Attempt {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return append([]Attempt(nil), m.attempts[device]...)
+}
+
+type fakeTLSConn struct {
+	closed bool
+}
+
+func (c *fakeTLSConn) Read([]byte) (int, error)             { return 0, io.EOF }
+func (c *fakeTLSConn) Write(b []byte) (int, error)          { return len(b), nil }
+func (c *fakeTLSConn) Close() error                         { c.closed = true; return nil }
+func (c *fakeTLSConn) ConnectionState() tls.ConnectionState { return tls.ConnectionState{} }
+func (c *fakeTLSConn) RemoteAddr() net.Addr                 { return &net.TCPAddr{} }
+func (c *fakeTLSConn) LocalAddr() net.Addr                  { return &net.TCPAddr{} }
+func (c *fakeTLSConn) SetDeadline(time.Time) error          { return nil }
+func (c *fakeTLSConn) SetWriteDeadline(time.Time) error     { return nil }
+
+func TestBackoffInterval(t *testing.T) {
+	base, max := time.Minute, 15*time.Minute
+	cases := []struct {
+		failures  int
+		hasWorked bool
+		interval  time.Duration
+	}{
+		{0, false, time.Minute},
+		{1, false, 4 * time.Minute},
+		{2, false, 15 * time.Minute},
+		{10, false, 15 * time.Minute},
+		{0, true, time.Minute},
+		{1, true, 2 * time.Minute},
+		{2, true, 4 * time.Minute},
+		{3, true, 8 * time.Minute},
+		{4, true, 15 * time.Minute},
+		{1000, true, 15 * time.Minute},
+	}
+	for _, tc := range cases {
+		if res := backoffInterval(base, max, tc.failures, tc.hasWorked); res != tc.interval {
+			t.Errorf("backoffInterval(%v, %v, %d, %v) => %v, expected %v", base, max, tc.failures, tc.hasWorked, res, tc.interval)
+		}
+	}
+
+	// The maximum never makes the interval shorter than the base
+	if res := backoffInterval(10*time.Minute, time.Minute, 3, false); res != 10*time.Minute {
+		t.Errorf("Interval %v is not the base interval", res)
+	}
+}
+
+func TestDialBackoff(t *testing.T) {
+	s := &service{
+		dialBackoffMut: sync.NewMutex(),
+		dialBackoff:    make(map[string]DialBackoffEntry),
+	}
+	key := dialKey(protocol.LocalDeviceID, "tcp://192.0.2.42:22000")
+	now := time.Now()
+
+	within := func(interval, expected time.Duration) bool {
+		return interval >= expected*3/4 && interval <= expected*5/4
+	}
+
+	// Repeated failures grow the interval
+	prev := time.Duration(0)
+	for i := 0; i < 3; i++ {
+		s.recordDialResult(key, errors.New("unreachable"))
+		interval := s.nextDialInterval(key, time.Minute, time.Hour, now)
+		if interval <= prev {
+			t.Errorf("Interval %v after %d failures did not grow from %v", interval, i+1, prev)
+		}
+		prev = interval
+	}
+	if entry := s.DialBackoff()[key]; entry.Failures != 3 || !entry.LastSuccess.IsZero() {
+		t.Errorf("Unexpected backoff state %+v", entry)
+	}
+
+	// Success resets it
+	s.recordDialResult(key, nil)
+	if interval := s.nextDialInterval(key, time.Minute, time.Hour, now); !within(interval, time.Minute) {
+		t.Errorf("Interval %v after success, expected about a minute", interval)
+	}
+	entry := s.DialBackoff()[key]
+	if entry.Failures != 0 || entry.LastSuccess.IsZero() {
+		t.Errorf("Unexpected backoff state %+v", entry)
+	}
+
+	// Having worked before, it now backs off more slowly
+	s.recordDialResult(key, errors.New("unreachable"))
+	if interval := s.nextDialInterval(key, time.Minute, time.Hour, now); !within(interval, 2*time.Minute) {
+		t.Errorf("Interval %v after one failure, expected about two minutes", interval)
+	}
+
+	// Cancelled dials don't count
+	s.recordDialResult(key, context.Canceled)
+	if entry := s.DialBackoff()[key]; entry.Failures != 1 {
+		t.Errorf("Expected cancelled dial to be ignored, got %d failures", entry.Failures)
+	}
+
+	// Forgotten once no longer dialed
+	s.pruneDialBackoff(nil)
+	if len(s.DialBackoff()) != 0 {
+		t.Error("Expected backoff state to be pruned")
+	}
+}
+
+type fakeDialer struct {
+	err error
+}
+
+func (d fakeDialer) Dial(context.Context, protocol.DeviceID, *url.URL) (internalConn, error) {
+	return internalConn{}, d.err
+}
+
+func (fakeDialer) RedialFrequency() time.Duration {
+	return time.Minute
+}
+
+func TestConnectionAttempts(t *testing.T) {
+	mdl := &fakeConnModel{mut: sync.NewMutex()}
+	s := &service{
+		model:               mdl,
+		connectionStatusMut: sync.NewRWMutex(),
+		connectionStatus:    make(map[string]ConnectionStatusEntry),
+		dialBackoffMut:      sync.NewMutex(),
+		dialBackoff:         make(map[string]DialBackoffEntry),
+	}
+	device := protocol.NewDeviceID([]byte("device"))
+	target := func(addr string, dialer genericDialer) dialTarget {
+		uri, err := url.Parse(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dialTarget{addr: addr, dialer: dialer, uri: uri, deviceID: device}
+	}
+
+	// Failed dials are recorded with their error
+	dialErr := errors.New("connection refused")
+	tgts := []dialTarget{
+		target("tcp://192.0.2.42:22000", fakeDialer{dialErr}),
+		target("relay://192.0.2.43:22067", fakeDialer{dialErr}),
+	}
+	if _, ok := s.dialParallel(context.Background(), device, tgts); ok {
+		t.Fatal("Expected dialing to fail")
+	}
+	attempts := mdl.dialAttempts(device)
+	if len(attempts) != 2 {
+		t.Fatalf("Expected two attempts, got %v", attempts)
+	}
+	transports := make(map[string]string)
+	for _, a := range attempts {
+		if a.Outcome != AttemptFailure || a.Error == nil || *a.Error != dialErr.Error() || a.When.IsZero() {
+			t.Errorf("Unexpected attempt %+v", a)
+		}
+		transports[a.Address] = a.Transport
+	}
+	if transports["tcp://192.0.2.42:22000"] != "tcp" || transports["relay://192.0.2.43:22067"] != "relay" {
+		t.Errorf("Unexpected transports %v", transports)
+	}
+
+	// Successful ones without
+	s.recordAttempt(target("quic://192.0.2.42:22000", nil), AttemptSuccess, nil)
+	attempts = mdl.dialAttempts(device)
+	if last := attempts[len(attempts)-1]; last.Outcome != AttemptSuccess || last.Error != nil || last.Transport != "quic" {
+		t.Errorf("Unexpected attempt %+v", last)
+	}
+}
+
+// connectivityTestCerts returns certificates for us and a remote device.
+func connectivityTestCerts(t *testing.T) (tls.Certificate, tls.Certificate) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "syncthing-connectivity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newCert := func(name string) tls.Certificate {
+		cert, err := tlsutil.NewCertificate(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"), "syncthing", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	return newCert("local"), newCert("remote")
+}
+
+// tlsTestListener listens as the device with the given certificate,
+// completing TLS handshakes and counting the connections accepted.
+func tlsTestListener(addr string, cert tls.Certificate) (net.Listener, *int32, error) {
+	return tlsTestListenerWithConfig(addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+	})
+}
+
+func tlsTestListenerWithConfig(addr string, tlsCfg *tls.Config) (net.Listener, *int32, error) {
+	lst, err := tls.Listen("tcp", addr, tlsCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted := new(int32)
+	go func() {
+		for {
+			conn, err := lst.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return lst, accepted, nil
+}
+
+func TestDialForConnectivity(t *testing.T) {
+	myCert, remoteCert := connectivityTestCerts(t)
+	myID, remoteID := protocol.NewDeviceID(myCert.Certificate[0]), protocol.NewDeviceID(remoteCert.Certificate[0])
+
+	// The remote device
+	lst, _, err := tlsTestListener("127.0.0.1:0", remoteCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close()
+
+	// An address where nothing listens.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	reachable := "tcp://" + lst.Addr().String()
+	unreachable := "tcp://" + closed.Addr().String()
+	w := config.Wrap("/dev/null", config.New(myID), events.NoopLogger)
+	remoteCfg := config.NewDeviceConfiguration(remoteID, "remote")
+	remoteCfg.Addresses = []string{reachable, unreachable}
+	waiter, err := w.SetDevice(remoteCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+
+	// Neither pending connections nor the dial state are set up, so this
+	// would blow up if the test touched them.
+	s := &service{
+		cfg:    w,
+		myID:   myID,
+		tlsCfg: &tls.Config{Certificates: []tls.Certificate{myCert}, InsecureSkipVerify: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if addrs := s.DeviceAddresses(remoteCfg); len(addrs) != 2 || addrs[0] != reachable || addrs[1] != unreachable {
+		t.Fatalf("Unexpected addresses %v", addrs)
+	}
+	if _, err := s.DialForConnectivity(ctx, remoteCfg, reachable); err != nil {
+		t.Errorf("Expected %v to be reachable, got %v", reachable, err)
+	}
+	if _, err := s.DialForConnectivity(ctx, remoteCfg, unreachable); err == nil {
+		t.Errorf("Expected %v to be unreachable", unreachable)
+	}
+
+	// At the reachable address is another device than the one tested.
+	otherCfg := config.NewDeviceConfiguration(device2, "other")
+	otherCfg.Addresses = []string{reachable}
+	waiter, err = w.SetDevice(otherCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+	if _, err := s.DialForConnectivity(ctx, otherCfg, reachable); err == nil {
+		t.Error("Expected the wrong device to be reported")
+	}
+}
+
+func TestDialFamily(t *testing.T) {
+	cases := []struct {
+		addr       string
+		ipv4, ipv6 bool
+	}{
+		{"tcp://192.0.2.42:22000", true, false},
+		{"tcp://[2001:db8::42]:22000", false, true},
+		{"tcp://[fe80::1%25eth0]:22000", false, true},
+		{"quic://192.0.2.42", true, false},
+		{"tcp://example.com:22000", true, true},
+		{"tcp4://example.com:22000", true, false},
+		{"tcp6://example.com:22000", false, true},
+		{"relay://[2001:db8::42]:22067", false, true},
+	}
+	for _, tc := range cases {
+		uri, err := url.Parse(tc.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isDialFamilyAllowed(uri, config.DialFamilyBoth) {
+			t.Errorf("%v should be dialed for both families", tc.addr)
+		}
+		if res := isDialFamilyAllowed(uri, config.DialFamilyIPv4); res != tc.ipv4 {
+			t.Errorf("%v dialed for IPv4: %v, expected %v", tc.addr, res, tc.ipv4)
+		}
+		if res := isDialFamilyAllowed(uri, config.DialFamilyIPv6); res != tc.ipv6 {
+			t.Errorf("%v dialed for IPv6: %v, expected %v", tc.addr, res, tc.ipv6)
+		}
+	}
+
+	myCert, remoteCert := connectivityTestCerts(t)
+	myID, remoteID := protocol.NewDeviceID(myCert.Certificate[0]), protocol.NewDeviceID(remoteCert.Certificate[0])
+	v4, v4Accepted, err := tlsTestListener("127.0.0.1:0", remoteCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v4.Close()
+	v6, v6Accepted, err := tlsTestListener("[::1]:0", remoteCert)
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	defer v6.Close()
+
+	dialCases := []struct {
+		family    string
+		lst       net.Listener
+		accepted  *int32
+		reachable bool
+	}{
+		{config.DialFamilyIPv4, v4, v4Accepted, true},
+		{config.DialFamilyIPv4, v6, v6Accepted, false},
+		{config.DialFamilyIPv6, v6, v6Accepted, true},
+		{config.DialFamilyIPv6, v4, v4Accepted, false},
+		{config.DialFamilyBoth, v4, v4Accepted, true},
+		{config.DialFamilyBoth, v6, v6Accepted, true},
+	}
+	for _, tc := range dialCases {
+		raw := config.New(myID)
+		raw.Options.DialFamily = tc.family
+		remoteCfg := config.NewDeviceConfiguration(remoteID, "remote")
+		remoteCfg.Addresses = []string{"tcp://" + tc.lst.Addr().String()}
+		raw.Devices = append(raw.Devices, remoteCfg)
+		s := &service{
+			cfg:    config.Wrap("/dev/null", raw, events.NoopLogger),
+			myID:   myID,
+			tlsCfg: &tls.Config{Certificates: []tls.Certificate{myCert}, InsecureSkipVerify: true},
+		}
+
+		before := atomic.LoadInt32(tc.accepted)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := s.DialForConnectivity(ctx, remoteCfg, remoteCfg.Addresses[0])
+		cancel()
+		if reachable := err == nil; reachable != tc.reachable {
+			t.Errorf("%v dialing %v: reachable %v, expected %v (%v)", tc.family, remoteCfg.Addresses[0], reachable, tc.reachable, err)
+		}
+		if !tc.reachable {
+			if err != errDialFamilyDisabled {
+				t.Errorf("%v dialing %v: unexpected error %v", tc.family, remoteCfg.Addresses[0], err)
+			}
+			if atomic.LoadInt32(tc.accepted) != before {
+				t.Errorf("%v dialing %v: the address was dialed", tc.family, remoteCfg.Addresses[0])
+			}
+		}
+	}
+
+	// Host names are resolved to the family being dialed only.
+	for _, tc := range []struct {
+		family string
+		lst    net.Listener
+	}{
+		{config.DialFamilyIPv4, v6},
+		{config.DialFamilyIPv6, v4},
+	} {
+		_, port, _ := net.SplitHostPort(tc.lst.Addr().String())
+		uri := &url.URL{Scheme: "tcp", Host: net.JoinHostPort("localhost", port)}
+		opts := config.New(myID).Options
+		opts.DialFamily = tc.family
+		d := tcpDialerFactory{}.New(opts, &tls.Config{Certificates: []tls.Certificate{myCert}, InsecureSkipVerify: true})
+		if conn, err := d.Dial(context.Background(), remoteID, uri); err == nil {
+			conn.Close()
+			t.Errorf("%v: dialing %v reached %v", tc.family, uri, conn.RemoteAddr())
+		}
+	}
+}
+
+// newCASignedCert returns a certificate signed by the given CA, or a self
+// signed one if ca is nil.
+func newCASignedCert(t *testing.T, ca *tls.Certificate, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "syncthing"},
+		DNSNames:              []string{"syncthing"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parent, signer := template, crypto.Signer(key)
+	if ca != nil {
+		parent = ca.Leaf
+		signer = ca.PrivateKey.(crypto.Signer)
+	}
+	der, err := x509.CreateCertificate(crand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestDeviceCertCA(t *testing.T) {
+	ca := newCASignedCert(t, nil, true)
+	signed := newCASignedCert(t, &ca, false)
+	selfSigned := newCASignedCert(t, nil, false)
+	intermediate := newCASignedCert(t, &ca, true)
+	chained := newCASignedCert(t, &intermediate, false)
+	chained.Certificate = append(chained.Certificate, intermediate.Certificate[0])
+	myCert, _ := connectivityTestCerts(t)
+	myID := protocol.NewDeviceID(myCert.Certificate[0])
+
+	fd, err := ioutil.TempFile("", "syncthing-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	if err := pem.Encode(fd, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}); err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	// Both devices have certificates matching their device IDs, only one
+	// is signed by the CA.
+	raw := config.New(myID)
+	var listeners []net.Listener
+	defer func() {
+		for _, lst := range listeners {
+			lst.Close()
+		}
+	}()
+	addDevice := func(cert tls.Certificate) protocol.DeviceID {
+		lst, _, err := tlsTestListener("127.0.0.1:0", cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, lst)
+		deviceCfg := config.NewDeviceConfiguration(protocol.NewDeviceID(cert.Certificate[0]), "")
+		deviceCfg.Addresses = []string{"tcp://" + lst.Addr().String()}
+		raw.Devices = append(raw.Devices, deviceCfg)
+		return deviceCfg.DeviceID
+	}
+	signedID, selfSignedID, chainedID := addDevice(signed), addDevice(selfSigned), addDevice(chained)
+
+	reachable := func(caFile string, device protocol.DeviceID) (bool, error) {
+		raw.Options.DeviceCertCAFile = caFile
+		s := &service{
+			cfg:    config.Wrap("/dev/null", raw.Copy(), events.NoopLogger),
+			myID:   myID,
+			tlsCfg: &tls.Config{Certificates: []tls.Certificate{myCert}, InsecureSkipVerify: true},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		deviceCfg, _ := s.cfg.Device(device)
+		_, err := s.DialForConnectivity(ctx, deviceCfg, deviceCfg.Addresses[0])
+		return err == nil, err
+	}
+
+	// Without a CA file, the device ID is enough
+	if ok, err := reachable("", selfSignedID); !ok {
+		t.Error("Self signed certificate rejected without CA file:", err)
+	}
+	if ok, err := reachable(fd.Name(), signedID); !ok {
+		t.Error("Certificate signed by the CA rejected:", err)
+	}
+	if ok, err := reachable(fd.Name(), selfSignedID); ok {
+		t.Error("Certificate not signed by the CA accepted")
+	} else if !strings.Contains(err.Error(), "not signed by a trusted CA") {
+		t.Error("Unexpected error:", err)
+	}
+
+	// Intermediates sent along with the certificate are used, but only
+	// when there is a CA file.
+	if ok, err := reachable(fd.Name(), chainedID); !ok {
+		t.Error("Certificate signed by an intermediate rejected:", err)
+	}
+	if ok, _ := reachable("", chainedID); ok {
+		t.Error("Certificate chain accepted without CA file")
+	}
+	if err := verifyDeviceCertCA(fd.Name(), []*x509.Certificate{chained.Leaf}); err == nil {
+		t.Error("Expected an error without the intermediate")
+	}
+
+	// Connections are refused if the CA file can't be used
+	if err := verifyDeviceCertCA(fd.Name()+".missing", []*x509.Certificate{signed.Leaf}); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	myCert, remoteCert := connectivityTestCerts(t)
+	myID, remoteID := protocol.NewDeviceID(myCert.Certificate[0]), protocol.NewDeviceID(remoteCert.Certificate[0])
+	base := tlsutil.SecureDefault()
+	base.Certificates = []tls.Certificate{myCert}
+	base.ClientAuth = tls.RequestClientCert
+	base.InsecureSkipVerify = true
+
+	opts := config.New(myID).Options
+	if tlsCfg := withTLSOptions(base, opts); tlsCfg.MinVersion != tls.VersionTLS12 || len(tlsCfg.CipherSuites) != len(base.CipherSuites) {
+		t.Errorf("Default options changed the TLS config, min version %x, %d cipher suites", tlsCfg.MinVersion, len(tlsCfg.CipherSuites))
+	}
+	opts.TLSCipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	if tlsCfg := withTLSOptions(base, opts); len(tlsCfg.CipherSuites) != 1 || tlsCfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected cipher suites %v", tlsCfg.CipherSuites)
+	}
+	if len(base.CipherSuites) == 1 {
+		t.Error("The original TLS config was modified")
+	}
+
+	opts.TLSMinVersion = "1.3"
+	tlsCfg := withTLSOptions(base, opts)
+
+	// Listening, a peer which can't do TLS 1.3 is refused.
+	lst, _, err := tlsTestListenerWithConfig("127.0.0.1:0", tlsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close()
+	handshake := func(maxVersion uint16) (uint16, error) {
+		conn, err := tls.Dial("tcp", lst.Addr().String(), &tls.Config{
+			Certificates:       []tls.Certificate{remoteCert},
+			InsecureSkipVerify: true,
+			MaxVersion:         maxVersion,
+		})
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().Version, nil
+	}
+	if _, err := handshake(tls.VersionTLS12); err == nil {
+		t.Error("TLS 1.2 connection was accepted with TLS 1.3 as minimum")
+	}
+	if version, err := handshake(0); err != nil || version != tls.VersionTLS13 {
+		t.Errorf("Expected a TLS 1.3 connection, got version %x, %v", version, err)
+	}
+
+	// Dialing, a peer which can't do TLS 1.3 is refused.
+	old, _, err := tlsTestListenerWithConfig("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{remoteCert},
+		ClientAuth:   tls.RequestClientCert,
+		MaxVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	raw := config.New(myID)
+	remoteCfg := config.NewDeviceConfiguration(remoteID, "remote")
+	remoteCfg.Addresses = []string{"tcp://" + old.Addr().String()}
+	raw.Devices = append(raw.Devices, remoteCfg)
+	for _, tc := range []struct {
+		tlsCfg    *tls.Config
+		reachable bool
+	}{
+		{base, true},
+		{tlsCfg, false},
+	} {
+		s := &service{cfg: config.Wrap("/dev/null", raw, events.NoopLogger), myID: myID, tlsCfg: tc.tlsCfg}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := s.DialForConnectivity(ctx, remoteCfg, remoteCfg.Addresses[0])
+		cancel()
+		if reachable := err == nil; reachable != tc.reachable {
+			t.Errorf("Min version %x: reachable %v, expected %v (%v)", tc.tlsCfg.MinVersion, reachable, tc.reachable, err)
+		}
+	}
+}
+
+func TestUnixSocketConnection(t *testing.T) {
+	myCert, remoteCert := connectivityTestCerts(t)
+	myID, remoteID := protocol.NewDeviceID(myCert.Certificate[0]), protocol.NewDeviceID(remoteCert.Certificate[0])
+
+	dir, err := ioutil.TempDir("", "syncthing-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bep.sock")
+
+	// A socket left behind by a previous run doesn't stop the listener.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	// The remote device listens on the socket.
+	uri, err := url.Parse("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := config.New(remoteID)
+	lf, err := getListenerFactory(raw, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan internalConn, 1)
+	lst := lf.New(uri, nil, &tls.Config{
+		Certificates: []tls.Certificate{remoteCert},
+		ClientAuth:   tls.RequestClientCert,
+	}, conns, nil)
+	go lst.Serve()
+	defer lst.Stop()
+	if addrs := lst.LANAddresses(); len(addrs) != 1 || addrs[0].String() != uri.String() {
+		t.Errorf("Unexpected LAN addresses %v", addrs)
+	}
+	if addrs := lst.WANAddresses(); len(addrs) != 0 {
+		t.Errorf("Unexpected WAN addresses %v", addrs)
+	}
+
+	df, err := getDialerFactory(raw, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := df.New(raw.Options, &tls.Config{Certificates: []tls.Certificate{myCert}, InsecureSkipVerify: true})
+	var conn internalConn
+	for i := 0; ; i++ {
+		conn, err = dialer.Dial(context.Background(), remoteID, uri)
+		if err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	if conn.Type() != "unix-client" || conn.Transport() != "unix" || conn.priority != unixPriority {
+		t.Errorf("Unexpected dialed connection %v, %v, priority %d", conn.Type(), conn.Transport(), conn.priority)
+	}
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) == 0 || protocol.NewDeviceID(certs[0].Raw) != remoteID {
+		t.Error("Dialed connection isn't to the remote device")
+	}
+	var server internalConn
+	select {
+	case server = <-conns:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the accepted connection")
+	}
+	defer server.Close()
+	if server.Type() != "unix-server" || server.Transport() != "unix" {
+		t.Errorf("Unexpected accepted connection %v, %v", server.Type(), server.Transport())
+	}
+	if certs := server.ConnectionState().PeerCertificates; len(certs) == 0 || protocol.NewDeviceID(certs[0].Raw) != myID {
+		t.Error("Accepted connection isn't from the local device")
+	}
+	s := &service{}
+	if !s.isLAN(server.RemoteAddr()) {
+		t.Error("Unix socket connection should count as LAN")
+	}
+}
+
+func TestUnixSocketReplacesTCP(t *testing.T) {
+	unix := internalConn{&fakeTLSConn{}, connTypeUnixClient, unixPriority}
+	tcp := internalConn{&fakeTLSConn{}, connTypeTCPServer, tcpPriority}
+
+	if !shouldReplaceConnection(completeConn{internalConn: tcp}, unix) {
+		t.Error("Unix socket connection should replace TCP connection")
+	}
+	if shouldReplaceConnection(completeConn{internalConn: unix}, tcp) {
+		t.Error("TCP connection should not replace Unix socket connection")
+	}
+
+	// With a connection over the socket established, a TCP connection to
+	// the same device is dropped when only one is allowed ...
+	pending := newPendingConnections()
+	var device protocol.DeviceID
+	tcpFake := tcp.tlsConn.(*fakeTLSConn)
+	if pending.add(device, tcp, completeConn{internalConn: unix}, 1) || !tcpFake.closed {
+		t.Error("TCP connection should be refused when a Unix socket connection is established")
+	}
+	// ... but not the other way around.
+	tcpFake.closed = false
+	if !pending.add(device, unix, completeConn{internalConn: tcp}, 1) {
+		t.Error("Unix socket connection should be kept when a TCP connection is established")
+	}
+}
+
+type fakeRelayScorer time.Duration
+
+func (s fakeRelayScorer) RelayScore() (time.Duration, bool) {
+	return time.Duration(s), true
+}
+
+func TestConnectionRelayScore(t *testing.T) {
+	relay := internalConn{scoredRelayConn{&fakeTLSConn{}, fakeRelayScorer(150 * time.Millisecond)}, connTypeRelayServer, relayPriority}
+	if score, ok := relay.RelayScore(); !ok || score != 150*time.Millisecond {
+		t.Errorf("got relay score %v, %v, expected 150ms", score, ok)
+	}
+
+	direct := internalConn{&fakeTLSConn{}, connTypeTCPClient, tcpPriority}
+	if score, ok := direct.RelayScore(); ok {
+		t.Errorf("got relay score %v for a direct connection", score)
+	}
+}
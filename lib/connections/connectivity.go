@@ -0,0 +1,66 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+var errDialFamilyDisabled = errors.New("address family is not dialed")
+
+// ConnectivityTester dials devices outside of the connection loop, to find
+// out whether they can be reached.
+type ConnectivityTester interface {
+	// DeviceAddresses returns the addresses to dial the device at, with
+	// "dynamic" replaced by the addresses found by discovery.
+	DeviceAddresses(deviceCfg config.DeviceConfiguration) []string
+	// DialForConnectivity dials the device at the given address and returns
+	// the time it took until the device was identified. The connection is
+	// closed again, so an established connection to the device is left as
+	// is.
+	DialForConnectivity(ctx context.Context, deviceCfg config.DeviceConfiguration, addr string) (time.Duration, error)
+}
+
+func (s *service) DeviceAddresses(deviceCfg config.DeviceConfiguration) []string {
+	return s.resolveDeviceAddresses(deviceCfg)
+}
+
+func (s *service) DialForConnectivity(ctx context.Context, deviceCfg config.DeviceConfiguration, addr string) (time.Duration, error) {
+	cfg := s.cfg.RawCopy()
+	uri, err := url.Parse(addr)
+	if err != nil {
+		return 0, err
+	}
+	if len(deviceCfg.AllowedNetworks) > 0 && !IsAllowedNetwork(uri.Host, deviceCfg.AllowedNetworks) {
+		return 0, errors.New("network disallowed")
+	}
+	if !isDialFamilyAllowed(uri, cfg.Options.DialFamily) {
+		return 0, errDialFamilyDisabled
+	}
+	dialerFactory, err := getDialerFactory(cfg, uri)
+	if err != nil {
+		return 0, err
+	}
+
+	t0 := time.Now()
+	conn, err := dialerFactory.New(cfg.Options, s.tlsCfg).Dial(ctx, deviceCfg.DeviceID, uri)
+	if err != nil {
+		return 0, err
+	}
+	// Closes the connection on error
+	if err := s.validateIdentity(conn, deviceCfg.DeviceID); err != nil {
+		return 0, err
+	}
+	latency := time.Since(t0)
+	conn.Close()
+	return latency, nil
+}
@@ -0,0 +1,219 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+var errConnectionIdle = protocol.NewCloseError(protocol.CloseReasonIdle, "connection idle")
+
+// An activityTracker records when a message, other than the keepalive
+// pings, was last sent or received on a connection.
+type activityTracker struct {
+	last int64 // UnixNano, accessed atomically
+}
+
+func newActivityTracker() *activityTracker {
+	t := &activityTracker{}
+	t.touch()
+	return t
+}
+
+func (t *activityTracker) touch() {
+	atomic.StoreInt64(&t.last, time.Now().UnixNano())
+}
+
+func (t *activityTracker) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.last)))
+}
+
+// activityModel records the messages received from the other device
+// before handing them to the model.
+type activityModel struct {
+	protocol.Model
+	activity *activityTracker
+}
+
+func (m activityModel) Index(deviceID protocol.DeviceID, folder string, files []protocol.FileInfo) error {
+	m.activity.touch()
+	return m.Model.Index(deviceID, folder, files)
+}
+
+func (m activityModel) IndexUpdate(deviceID protocol.DeviceID, folder string, files []protocol.FileInfo) error {
+	m.activity.touch()
+	return m.Model.IndexUpdate(deviceID, folder, files)
+}
+
+func (m activityModel) Request(deviceID protocol.DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (protocol.RequestResponse, error) {
+	m.activity.touch()
+	defer m.activity.touch()
+	return m.Model.Request(deviceID, folder, name, size, offset, hash, weakHash, fromTemporary)
+}
+
+func (m activityModel) MetadataRequest(deviceID protocol.DeviceID, folder, prefix string) ([]protocol.FileInfo, error) {
+	m.activity.touch()
+	return m.Model.MetadataRequest(deviceID, folder, prefix)
+}
+
+func (m activityModel) RangeRequest(deviceID protocol.DeviceID, folder, name string, size int32, offset int64) (protocol.RequestResponse, error) {
+	m.activity.touch()
+	return m.Model.RangeRequest(deviceID, folder, name, size, offset)
+}
+
+func (m activityModel) ClusterConfig(deviceID protocol.DeviceID, config protocol.ClusterConfig) error {
+	m.activity.touch()
+	return m.Model.ClusterConfig(deviceID, config)
+}
+
+func (m activityModel) DownloadProgress(deviceID protocol.DeviceID, folder string, updates []protocol.FileDownloadProgressUpdate) error {
+	m.activity.touch()
+	return m.Model.DownloadProgress(deviceID, folder, updates)
+}
+
+// activityConnection records the messages sent to the other device.
+type activityConnection struct {
+	protocol.Connection
+	activity *activityTracker
+}
+
+func (c activityConnection) Index(ctx context.Context, folder string, files []protocol.FileInfo) error {
+	c.activity.touch()
+	return c.Connection.Index(ctx, folder, files)
+}
+
+func (c activityConnection) IndexUpdate(ctx context.Context, folder string, files []protocol.FileInfo) error {
+	c.activity.touch()
+	return c.Connection.IndexUpdate(ctx, folder, files)
+}
+
+func (c activityConnection) Request(ctx context.Context, folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+	c.activity.touch()
+	defer c.activity.touch()
+	return c.Connection.Request(ctx, folder, name, offset, size, hash, weakHash, fromTemporary)
+}
+
+func (c activityConnection) MetadataRequest(ctx context.Context, folder, prefix string) ([]protocol.FileInfo, error) {
+	c.activity.touch()
+	defer c.activity.touch()
+	return c.Connection.MetadataRequest(ctx, folder, prefix)
+}
+
+func (c activityConnection) RangeRequest(ctx context.Context, folder, name string, offset int64, size int) ([]byte, error) {
+	c.activity.touch()
+	defer c.activity.touch()
+	return c.Connection.RangeRequest(ctx, folder, name, offset, size)
+}
+
+func (c activityConnection) ClusterConfig(config protocol.ClusterConfig) {
+	c.activity.touch()
+	c.Connection.ClusterConfig(config)
+}
+
+func (c activityConnection) DownloadProgress(ctx context.Context, folder string, updates []protocol.FileDownloadProgressUpdate) {
+	c.activity.touch()
+	c.Connection.DownloadProgress(ctx, folder, updates)
+}
+
+// closeWhenIdle closes the connection once no messages have been exchanged
+// for the given timeout. It returns when the connection is closed, by us or
+// otherwise, and whether it was closed for being idle. The model sees this
+// as any other closed connection.
+func closeWhenIdle(conn protocol.Connection, activity *activityTracker, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for range timer.C {
+		if conn.Closed() {
+			return false
+		}
+		idle := activity.idleFor()
+		if idle >= timeout {
+			l.Infof("Closing connection to %s at %s after being idle for %v", conn.ID(), conn.Name(), idle.Truncate(time.Second))
+			conn.Close(errConnectionIdle)
+			return true
+		}
+		timer.Reset(timeout - idle)
+	}
+	return false
+}
+
+// idleRedials keeps us from dialing devices again right after closing the
+// connection to them for being idle, as that would defeat the purpose.
+// A device is dialed again once the backoff has passed or there is local
+// work to send to it, whichever comes first.
+type idleRedials struct {
+	until map[protocol.DeviceID]time.Time
+	mut   sync.Mutex
+}
+
+func newIdleRedials() *idleRedials {
+	return &idleRedials{
+		until: make(map[protocol.DeviceID]time.Time),
+		mut:   sync.NewMutex(),
+	}
+}
+
+// suppress keeps the device from being dialed for the given backoff.
+func (r *idleRedials) suppress(device protocol.DeviceID, backoff time.Duration) {
+	r.mut.Lock()
+	r.until[device] = time.Now().Add(backoff)
+	r.mut.Unlock()
+}
+
+// suppressed returns true if the device must not be dialed at the given
+// time.
+func (r *idleRedials) suppressed(device protocol.DeviceID, now time.Time) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	until, ok := r.until[device]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(r.until, device)
+		return false
+	}
+	return true
+}
+
+// release allows the devices to be dialed again right away.
+func (r *idleRedials) release(devices []protocol.DeviceID) {
+	r.mut.Lock()
+	for _, device := range devices {
+		delete(r.until, device)
+	}
+	r.mut.Unlock()
+}
+
+// serve releases the devices a folder is shared with whenever there are
+// local changes in it, as those need to be sent.
+func (r *idleRedials) serve(ctx context.Context, cfg config.Wrapper, evLogger events.Logger) {
+	sub := evLogger.Subscribe(events.LocalIndexUpdated)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-sub.C():
+			data, ok := ev.Data.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			folder, _ := data["folder"].(string)
+			if fcfg, ok := cfg.Folder(folder); ok {
+				r.release(fcfg.DeviceIDs())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// fakeProtoConn is a protocol.Connection where sending messages is a no-op
+// and closing is recorded.
+type fakeProtoConn struct {
+	protocol.Connection
+	closed chan error
+}
+
+func newFakeProtoConn() *fakeProtoConn {
+	return &fakeProtoConn{closed: make(chan error, 1)}
+}
+
+func (c *fakeProtoConn) ID() protocol.DeviceID { return protocol.LocalDeviceID }
+func (c *fakeProtoConn) Name() string          { return "fake" }
+
+func (c *fakeProtoConn) Index(context.Context, string, []protocol.FileInfo) error { return nil }
+
+func (c *fakeProtoConn) Close(err error) {
+	c.closed <- err
+}
+
+func (c *fakeProtoConn) Closed() bool {
+	return len(c.closed) > 0
+}
+
+func TestCloseWhenIdle(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	fake := newFakeProtoConn()
+	activity := newActivityTracker()
+	conn := activityConnection{fake, activity}
+
+	start := time.Now()
+	idle := make(chan bool, 1)
+	go func() {
+		idle <- closeWhenIdle(conn, activity, timeout)
+	}()
+
+	// Keep the connection busy for a few timeouts.
+
+	var lastActivity time.Time
+	for time.Since(start) < 3*timeout {
+		select {
+		case <-fake.closed:
+			t.Fatal("connection closed while in use")
+		case <-time.After(timeout / 5):
+		}
+		lastActivity = time.Now()
+		conn.Index(context.Background(), "default", nil)
+	}
+
+	// Then let it go idle.
+
+	select {
+	case err := <-fake.closed:
+		if !<-idle {
+			t.Error("closeWhenIdle did not report closing for being idle")
+		}
+		if err != errConnectionIdle {
+			t.Error("unexpected close error:", err)
+		}
+		if idle := time.Since(lastActivity); idle < timeout {
+			t.Errorf("connection closed after %v, before the timeout", idle)
+		}
+	case <-time.After(10 * timeout):
+		t.Fatal("idle connection not closed")
+	}
+}
+
+func TestCloseWhenIdleAlreadyClosed(t *testing.T) {
+	fake := newFakeProtoConn()
+	fake.closed <- nil
+
+	done := make(chan struct{})
+	go func() {
+		if closeWhenIdle(fake, newActivityTracker(), 10*time.Millisecond) {
+			t.Error("closeWhenIdle reported closing an already closed connection")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closeWhenIdle did not return for a closed connection")
+	}
+}
+
+func TestIdleRedials(t *testing.T) {
+	cfg := config.Wrap("/dev/null", config.Configuration{
+		Folders: []config.FolderConfiguration{
+			{ID: "default", Devices: []config.FolderDeviceConfiguration{{DeviceID: device1}}},
+		},
+	}, events.NoopLogger)
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+
+	r := newIdleRedials()
+	now := time.Now()
+
+	r.suppress(device1, time.Hour)
+	r.suppress(device2, time.Hour)
+	if !r.suppressed(device1, now) || !r.suppressed(device2, now) {
+		t.Fatal("expected redials to be suppressed")
+	}
+
+	// The backoff passing allows the redial.
+	if r.suppressed(device2, now.Add(2*time.Hour)) {
+		t.Error("expected redial to be allowed after the backoff")
+	}
+
+	// Local changes in a shared folder allow the redial right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.serve(ctx, cfg, evLogger)
+	for start := time.Now(); r.suppressed(device1, now); {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("expected redial to be allowed after local changes")
+		}
+		evLogger.Log(events.LocalIndexUpdated, map[string]interface{}{"folder": "default"})
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -7,6 +7,9 @@
 package connections
 
 import (
+	"bytes"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/syncthing/syncthing/lib/config"
@@ -24,6 +27,10 @@ func TestIsLANHost(t *testing.T) {
 		// local nets
 		{"10.20.30.40:22000", true},
 		{"10.20.30.40", true},
+		// private ranges
+		{"172.16.5.5:22000", true},
+		{"192.168.1.1", true},
+		{"[fd12::1]:22000", true},
 		// neither
 		{"192.0.2.1:22000", false},
 		{"192.0.2.1", false},
@@ -46,3 +53,50 @@ func TestIsLANHost(t *testing.T) {
 		}
 	}
 }
+
+func TestLANWANLimiting(t *testing.T) {
+	cfg := config.Wrap("/dev/null", config.Configuration{
+		Options: config.OptionsConfiguration{
+			MaxSendKbps: 10000,
+		},
+	}, events.NoopLogger)
+	s := &service{cfg: cfg, limiter: newLimiter(cfg)}
+
+	src := make([]byte, int(12.5*maxSingleWriteSize))
+	writes := func(addr string) int {
+		host, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cw := &countingWriter{w: new(bytes.Buffer)}
+		_, wr := s.limiter.getLimiters(device1, struct {
+			io.Reader
+			io.Writer
+		}{new(bytes.Buffer), cw}, s.isLAN(host))
+		if _, err := wr.Write(src); err != nil {
+			t.Fatal(err)
+		}
+		return cw.writeCount
+	}
+
+	// A LAN peer is not shaped, so gets the data in one write
+	if n := writes("192.168.1.10:22000"); n != 1 {
+		t.Errorf("LAN peer got %d writes, expected it to be unlimited", n)
+	}
+	// A WAN peer is shaped, which results in many smaller writes
+	if n := writes("203.0.113.10:22000"); n != 13 {
+		t.Errorf("WAN peer got %d writes, expected it to be limited", n)
+	}
+
+	// With LAN limiting enabled both are shaped
+	opts := cfg.Options()
+	opts.LimitBandwidthInLan = true
+	waiter, err := cfg.SetOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+	if n := writes("192.168.1.10:22000"); n != 13 {
+		t.Errorf("LAN peer got %d writes, expected it to be limited", n)
+	}
+}
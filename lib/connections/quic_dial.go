@@ -40,12 +40,17 @@ func init() {
 
 type quicDialer struct {
 	commonDialer
+	quicCfg *quic.Config
 }
 
 func (d *quicDialer) Dial(ctx context.Context, _ protocol.DeviceID, uri *url.URL) (internalConn, error) {
 	uri = fixupPort(uri, config.DefaultQUICPort)
 
-	addr, err := net.ResolveUDPAddr("udp", uri.Host)
+	network := "udp"
+	if uri.Scheme == "quic" {
+		network = dialNetwork(network, d.dialFamily)
+	}
+	addr, err := net.ResolveUDPAddr(network, uri.Host)
 	if err != nil {
 		return internalConn{}, err
 	}
@@ -69,7 +74,7 @@ func (d *quicDialer) Dial(ctx context.Context, _ protocol.DeviceID, uri *url.URL
 	ctx, cancel := context.WithTimeout(ctx, quicOperationTimeout)
 	defer cancel()
 
-	session, err := quic.DialContext(ctx, conn, addr, uri.Host, d.tlsCfg, quicConfig)
+	session, err := quic.DialContext(ctx, conn, addr, uri.Host, d.tlsCfg, d.quicCfg)
 	if err != nil {
 		if createdConn != nil {
 			_ = createdConn.Close()
@@ -96,22 +101,28 @@ type quicDialerFactory struct {
 }
 
 func (quicDialerFactory) New(opts config.OptionsConfiguration, tlsCfg *tls.Config) genericDialer {
-	return &quicDialer{commonDialer{
-		reconnectInterval: time.Duration(opts.ReconnectIntervalS) * time.Second,
-		tlsCfg:            tlsCfg,
-	}}
+	return &quicDialer{
+		commonDialer: commonDialer{
+			reconnectInterval: time.Duration(opts.ReconnectIntervalS) * time.Second,
+			tlsCfg:            tlsCfg,
+			dialFamily:        opts.DialFamily,
+		},
+		quicCfg: quicConfigFor(opts),
+	}
 }
 
-func (quicDialerFactory) Priority() int {
-	return quicPriority
+func (quicDialerFactory) Priority(opts config.OptionsConfiguration) int {
+	return opts.ConnectionPriority("quic", quicPriority)
 }
 
 func (quicDialerFactory) AlwaysWAN() bool {
 	return false
 }
 
-func (quicDialerFactory) Valid(_ config.Configuration) error {
-	// Always valid
+func (quicDialerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("quic") {
+		return errDisabled
+	}
 	return nil
 }
 
@@ -97,7 +97,7 @@ func (t *quicListener) serve(ctx context.Context) error {
 	registry.Register(t.uri.Scheme, conn)
 	defer registry.Unregister(t.uri.Scheme, conn)
 
-	listener, err := quic.Listen(conn, t.tlsCfg, quicConfig)
+	listener, err := quic.Listen(conn, t.tlsCfg, quicConfigFor(t.cfg.Options()))
 	if err != nil {
 		l.Infoln("Listen (BEP/quic):", err)
 		return err
@@ -189,7 +189,10 @@ func (t *quicListener) NATType() string {
 
 type quicListenerFactory struct{}
 
-func (f *quicListenerFactory) Valid(config.Configuration) error {
+func (f *quicListenerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("quic") {
+		return errDisabled
+	}
 	return nil
 }
 
@@ -10,16 +10,41 @@ package connections
 
 import (
 	"net"
+	"time"
 
 	"github.com/lucas-clemente/quic-go"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+// The version of quic-go we use can't migrate connections: it announces
+// disable_migration in its transport parameters and a session stays bound to
+// the packet connection and remote address it was created with, with no way
+// to rebind it. So a session does not survive a change of local address
+// (e.g. switching from Wi-Fi to Ethernet). Instead the keepalives stop being
+// answered and the session is torn down after the idle timeout, at which
+// point the regular reconnect loop dials the device again. The default is a
+// third of the quic-go default, to notice a dead path sooner; keepalives are
+// sent every half of it.
+const (
+	defaultQUICIdleTimeout = 10 * time.Second
+	minQUICIdleTimeout     = 5 * time.Second // quic-go doesn't accept less from the other side
 )
 
-var (
-	quicConfig = &quic.Config{
+// quicConfigFor returns the QUIC config for the given options.
+func quicConfigFor(opts config.OptionsConfiguration) *quic.Config {
+	idleTimeout := time.Duration(opts.QUICIdleTimeoutS) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = defaultQUICIdleTimeout
+	} else if idleTimeout < minQUICIdleTimeout {
+		idleTimeout = minQUICIdleTimeout
+	}
+	return &quic.Config{
 		ConnectionIDLength: 4,
 		KeepAlive:          true,
+		IdleTimeout:        idleTimeout,
 	}
-)
+}
 
 type quicTlsConn struct {
 	quic.Session
@@ -9,9 +9,17 @@
 package connections
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/lucas-clemente/quic-go"
+
+	"github.com/syncthing/syncthing/lib/config"
 )
 
 type mockPacketConn struct {
@@ -90,3 +98,158 @@ func TestPacketConnLess(t *testing.T) {
 		}
 	}
 }
+
+// blockingUDPProxy forwards packets between a client and the server at
+// target, until blocked.
+type blockingUDPProxy struct {
+	conn    net.PacketConn
+	target  net.Addr
+	blocked int32
+}
+
+func newBlockingUDPProxy(target net.Addr) (*blockingUDPProxy, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &blockingUDPProxy{conn: conn, target: target}
+	go p.serve()
+	return p, nil
+}
+
+func (p *blockingUDPProxy) serve() {
+	buf := make([]byte, 65536)
+	var client net.Addr
+	for {
+		n, addr, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if atomic.LoadInt32(&p.blocked) != 0 {
+			continue
+		}
+		if addr.String() == p.target.String() {
+			if client != nil {
+				_, _ = p.conn.WriteTo(buf[:n], client)
+			}
+		} else {
+			client = addr
+			_, _ = p.conn.WriteTo(buf[:n], p.target)
+		}
+	}
+}
+
+func TestQUICIdleTimeout(t *testing.T) {
+	// A session whose path stops working, e.g. after a change of local
+	// address, must be torn down after the idle timeout so that the device
+	// is dialed again.
+
+	if testing.Short() {
+		t.Skip("waits for the idle timeout")
+	}
+
+	// The shortest timeout possible, to keep the test short.
+	quicCfg := quicConfigFor(config.OptionsConfiguration{QUICIdleTimeoutS: 1})
+	idleTimeout := quicCfg.IdleTimeout
+	if idleTimeout != minQUICIdleTimeout {
+		t.Fatalf("Idle timeout %v, expected the minimum of %v", idleTimeout, minQUICIdleTimeout)
+	}
+
+	cert, _ := connectivityTestCerts(t)
+	tlsCfg := &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		NextProtos:         []string{"bep/1.0"},
+		ClientAuth:         tls.RequestClientCert,
+		InsecureSkipVerify: true,
+	}
+
+	serverConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	listener, err := quic.Listen(serverConn, tlsCfg, quicCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			session, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream, err := session.AcceptStream(context.Background())
+				if err == nil {
+					_, _ = io.Copy(stream, stream)
+				}
+			}()
+		}
+	}()
+
+	proxy, err := newBlockingUDPProxy(serverConn.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.conn.Close()
+
+	clientConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), quicOperationTimeout)
+	defer cancel()
+	session, err := quic.DialContext(ctx, clientConn, proxy.conn.LocalAddr(), "", tlsCfg, quicCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte("ping")
+	if _, err := stream.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keepalives keep the session alive as long as the path works.
+	select {
+	case <-session.Context().Done():
+		t.Fatal("Session closed while the path works")
+	case <-time.After(idleTimeout + time.Second):
+	}
+
+	atomic.StoreInt32(&proxy.blocked, 1)
+	t0 := time.Now()
+	select {
+	case <-session.Context().Done():
+		if d := time.Since(t0); d < idleTimeout/2 {
+			t.Errorf("Session closed after just %v", d)
+		}
+	case <-time.After(2 * idleTimeout):
+		t.Fatal("Session not closed after the idle timeout")
+	}
+}
+
+func TestQUICConfigIdleTimeout(t *testing.T) {
+	cases := []struct {
+		timeoutS int
+		expected time.Duration
+	}{
+		{0, defaultQUICIdleTimeout},
+		{-1, defaultQUICIdleTimeout},
+		{1, minQUICIdleTimeout},
+		{60, time.Minute},
+	}
+	for _, tc := range cases {
+		if res := quicConfigFor(config.OptionsConfiguration{QUICIdleTimeoutS: tc.timeoutS}).IdleTimeout; res != tc.expected {
+			t.Errorf("Idle timeout for %d s is %v, expected %v", tc.timeoutS, res, tc.expected)
+		}
+	}
+}
@@ -76,8 +76,8 @@ func (relayDialerFactory) New(opts config.OptionsConfiguration, tlsCfg *tls.Conf
 	}}
 }
 
-func (relayDialerFactory) Priority() int {
-	return relayPriority
+func (relayDialerFactory) Priority(opts config.OptionsConfiguration) int {
+	return opts.ConnectionPriority("relay", relayPriority)
 }
 
 func (relayDialerFactory) AlwaysWAN() bool {
@@ -85,7 +85,7 @@ func (relayDialerFactory) AlwaysWAN() bool {
 }
 
 func (relayDialerFactory) Valid(cfg config.Configuration) error {
-	if !cfg.Options.RelaysEnabled {
+	if !cfg.Options.RelaysEnabled || !cfg.Options.IsTransportEnabled("relay") {
 		return errDisabled
 	}
 	return nil
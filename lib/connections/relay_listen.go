@@ -104,7 +104,7 @@ func (t *relayListener) serve(ctx context.Context) error {
 				continue
 			}
 
-			t.conns <- internalConn{tc, connTypeRelayServer, relayPriority}
+			t.conns <- internalConn{scoredRelayConn{tc, t}, connTypeRelayServer, relayPriority}
 
 		// Poor mans notifier that informs the connection service that the
 		// relay URI has changed. This can only happen when we connect to a
@@ -161,6 +161,28 @@ func (t *relayListener) Error() error {
 	return nil
 }
 
+// RelayScore returns the score of the relay currently in use, lower is
+// better.
+func (t *relayListener) RelayScore() (time.Duration, bool) {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	if t.client == nil {
+		return 0, false
+	}
+	return t.client.Score(), true
+}
+
+// scoredRelayConn is a connection through the relay of a listener, scored
+// as that relay.
+type scoredRelayConn struct {
+	tlsConn
+	scorer relayScorer
+}
+
+func (c scoredRelayConn) RelayScore() (time.Duration, bool) {
+	return c.scorer.RelayScore()
+}
+
 func (t *relayListener) Factory() listenerFactory {
 	return t.factory
 }
@@ -188,7 +210,7 @@ func (f *relayListenerFactory) New(uri *url.URL, cfg config.Wrapper, tlsCfg *tls
 }
 
 func (relayListenerFactory) Valid(cfg config.Configuration) error {
-	if !cfg.Options.RelaysEnabled {
+	if !cfg.Options.RelaysEnabled || !cfg.Options.IsTransportEnabled("relay") {
 		return errDisabled
 	}
 	return nil
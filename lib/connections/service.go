@@ -9,7 +9,9 @@ package connections
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"sort"
@@ -23,7 +25,9 @@ import (
 	"github.com/syncthing/syncthing/lib/nat"
 	"github.com/syncthing/syncthing/lib/osutil"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
 	"github.com/syncthing/syncthing/lib/sync"
+	"github.com/syncthing/syncthing/lib/tlsutil"
 	"github.com/syncthing/syncthing/lib/util"
 
 	// Registers NAT service providers
@@ -94,6 +98,8 @@ type Service interface {
 	discover.AddressLister
 	ListenerStatus() map[string]ListenerStatusEntry
 	ConnectionStatus() map[string]ConnectionStatusEntry
+	DialBackoff() map[string]DialBackoffEntry
+	ConnectivityTester
 	NATType() string
 }
 
@@ -108,6 +114,32 @@ type ConnectionStatusEntry struct {
 	Error *string   `json:"error"`
 }
 
+// DialBackoffEntry describes how long we wait before dialing a device at a
+// given address again.
+type DialBackoffEntry struct {
+	Failures    int       `json:"failures"`    // consecutive failed dials
+	LastSuccess time.Time `json:"lastSuccess"` // zero if it has never worked
+	NextDial    time.Time `json:"nextDial"`
+}
+
+// AttemptOutcome is how dialing a device at an address ended.
+type AttemptOutcome string
+
+const (
+	AttemptSuccess  AttemptOutcome = "success"
+	AttemptFailure  AttemptOutcome = "failure"
+	AttemptRejected AttemptOutcome = "rejected" // connected, but a better connection exists
+)
+
+// Attempt describes one dial of a device at an address.
+type Attempt struct {
+	Address   string         `json:"address"`
+	Transport string         `json:"transport"`
+	When      time.Time      `json:"when"`
+	Outcome   AttemptOutcome `json:"outcome"`
+	Error     *string        `json:"error"`
+}
+
 type service struct {
 	*suture.Supervisor
 	cfg                  config.Wrapper
@@ -130,6 +162,13 @@ type service struct {
 
 	connectionStatusMut sync.RWMutex
 	connectionStatus    map[string]ConnectionStatusEntry // address -> latest error/status
+
+	pending *pendingConnections
+
+	dialBackoffMut sync.Mutex
+	dialBackoff    map[string]DialBackoffEntry // device/address -> backoff state
+
+	idleRedials *idleRedials
 }
 
 func NewService(cfg config.Wrapper, myID protocol.DeviceID, mdl Model, tlsCfg *tls.Config, discoverer discover.Finder, bepProtocolName string, tlsDefaultCommonName string, evLogger events.Logger) Service {
@@ -143,7 +182,7 @@ func NewService(cfg config.Wrapper, myID protocol.DeviceID, mdl Model, tlsCfg *t
 		cfg:                  cfg,
 		myID:                 myID,
 		model:                mdl,
-		tlsCfg:               tlsCfg,
+		tlsCfg:               withTLSOptions(tlsCfg, cfg.Options()),
 		discoverer:           discoverer,
 		conns:                make(chan internalConn),
 		bepProtocolName:      bepProtocolName,
@@ -171,6 +210,13 @@ func NewService(cfg config.Wrapper, myID protocol.DeviceID, mdl Model, tlsCfg *t
 
 		connectionStatusMut: sync.NewRWMutex(),
 		connectionStatus:    make(map[string]ConnectionStatusEntry),
+
+		pending: newPendingConnections(),
+
+		dialBackoffMut: sync.NewMutex(),
+		dialBackoff:    make(map[string]DialBackoffEntry),
+
+		idleRedials: newIdleRedials(),
 	}
 	cfg.Subscribe(service)
 
@@ -188,6 +234,9 @@ func NewService(cfg config.Wrapper, myID protocol.DeviceID, mdl Model, tlsCfg *t
 
 	service.Add(util.AsService(service.connect, fmt.Sprintf("%s/connect", service)))
 	service.Add(util.AsService(service.handle, fmt.Sprintf("%s/handle", service)))
+	service.Add(util.AsService(func(ctx context.Context) {
+		service.idleRedials.serve(ctx, cfg, evLogger)
+	}, fmt.Sprintf("%s/idleRedials", service)))
 	service.Add(service.listenerSupervisor)
 
 	return service
@@ -208,6 +257,11 @@ func (s *service) handle(ctx context.Context) {
 		case c = <-s.conns:
 		}
 
+		// Dialed connections were counted against the connection limit
+		// when they were established; incoming ones are checked below,
+		// once we know which device they are from.
+		dialed := s.pending.remove(c)
+
 		cs := c.ConnectionState()
 
 		// We should have negotiated the next level protocol "bep/1.0" as part
@@ -219,11 +273,11 @@ func (s *service) handle(ctx context.Context) {
 		}
 
 		// We should have received exactly one certificate from the other
-		// side. If we didn't, they don't have a device ID and we drop the
-		// connection.
+		// side, plus any intermediates to the device certificate CA. If we
+		// didn't, they don't have a device ID and we drop the connection.
 		certs := cs.PeerCertificates
-		if cl := len(certs); cl != 1 {
-			l.Infof("Got peer certificate list of length %d != 1 from peer at %s; protocol error", cl, c)
+		if err := checkPeerCertificates(certs, s.cfg.Options().DeviceCertCAFile); err != nil {
+			l.Infof("%v from peer at %s; protocol error", err, c)
 			c.Close()
 			continue
 		}
@@ -273,12 +327,15 @@ func (s *service) handle(ctx context.Context) {
 			continue
 		}
 
+		c.priority = s.connectionPriority(c)
+
 		// If we have a relay connection, and the new incoming connection is
 		// not a relay connection, we should drop that, and prefer this one.
+		// The existing connection is closed by the model once the new one,
+		// which has completed the hello exchange, is added.
 		ct, connected := s.model.Connection(remoteID)
 
-		// Lower priority is better, just like nice etc.
-		if connected && ct.Priority() > c.priority {
+		if connected && shouldReplaceConnection(ct, c) {
 			l.Debugf("Switching connections %s (existing: %s new: %s)", remoteID, ct, c)
 		} else if connected {
 			// We should not already be connected to the other party. TODO: This
@@ -314,6 +371,15 @@ func (s *service) handle(ctx context.Context) {
 			c.Close()
 			continue
 		}
+		if err := verifyDeviceCertCA(s.cfg.Options().DeviceCertCAFile, certs); err != nil {
+			l.Warnf("Bad certificate from %s at %s: %v", remoteID, c, err)
+			c.Close()
+			continue
+		}
+
+		if !dialed && !s.addPending(remoteID, c) {
+			continue
+		}
 
 		// Wrap the connection in rate limiters. The limiter itself will
 		// keep up with config changes to the rate and whether or not LAN
@@ -321,16 +387,63 @@ func (s *service) handle(ctx context.Context) {
 		isLAN := s.isLAN(c.RemoteAddr())
 		rd, wr := s.limiter.getLimiters(remoteID, c, isLAN)
 
-		protoConn := protocol.NewConnection(remoteID, rd, wr, s.model, c.String(), deviceCfg.Compression)
+		var receiver protocol.Model = s.model
+		var activity *activityTracker
+		idleTimeout := time.Duration(s.cfg.Options().ConnectionIdleTimeoutS) * time.Second
+		if idleTimeout > 0 {
+			activity = newActivityTracker()
+			receiver = activityModel{receiver, activity}
+		}
+
+		var protoConn protocol.Connection
+		if deviceCfg.Untrusted {
+			protoConn = protocol.NewEncryptedConnection(remoteID, rd, wr, receiver, c.String(), deviceCfg.Compression, s.folderKey(remoteID))
+		} else {
+			protoConn = protocol.NewConnection(remoteID, rd, wr, receiver, c.String(), deviceCfg.Compression)
+		}
+		if activity != nil {
+			protoConn = activityConnection{protoConn, activity}
+			go func(conn protocol.Connection) {
+				if closeWhenIdle(conn, activity, idleTimeout) {
+					s.idleRedials.suppress(remoteID, idleTimeout)
+				}
+			}(protoConn)
+		}
 		modelConn := completeConn{c, protoConn}
 
 		l.Infof("Established secure connection to %s at %s", remoteID, c)
 
+		s.idleRedials.release([]protocol.DeviceID{remoteID})
+
 		s.model.AddConnection(modelConn, hello)
+		// Now counted as the established connection, if kept by the
+		// model.
+		s.pending.remove(c)
 		continue
 	}
 }
 
+// folderKey returns a function looking up the encryption keys of the
+// folders shared with the given untrusted device, in the current config.
+// Folders that aren't shared with it or have no password have no key, and
+// are thus not shared over the connection.
+func (s *service) folderKey(deviceID protocol.DeviceID) protocol.FolderKeyFunc {
+	return func(folder string) *[protocol.FolderKeySize]byte {
+		fcfg, ok := s.cfg.Folder(folder)
+		if !ok || !fcfg.SharedWith(deviceID) {
+			return nil
+		}
+		bs := fcfg.FolderKey()
+		if bs == nil {
+			l.Debugf("Folder %s has no encryption password; not sharing it with untrusted device %s", fcfg.Description(), deviceID)
+			return nil
+		}
+		var key [protocol.FolderKeySize]byte
+		copy(key[:], bs)
+		return &key
+	}
+}
+
 func (s *service) connect(ctx context.Context) {
 	nextDial := make(map[string]time.Time)
 
@@ -349,7 +462,7 @@ func (s *service) connect(ctx context.Context) {
 			if df.Valid(cfg) != nil {
 				continue
 			}
-			if prio := df.Priority(); prio < bestDialerPrio {
+			if prio := df.Priority(cfg.Options); prio < bestDialerPrio {
 				bestDialerPrio = prio
 			}
 		}
@@ -371,25 +484,17 @@ func (s *service) connect(ctx context.Context) {
 
 			ct, connected := s.model.Connection(deviceID)
 
-			if connected && ct.Priority() == bestDialerPrio {
-				// Things are already as good as they can get.
+			if !connected && s.idleRedials.suppressed(deviceID, now) {
+				l.Debugln("Not dialing", deviceID, "as the connection was closed for being idle")
 				continue
 			}
 
-			var addrs []string
-			for _, addr := range deviceCfg.Addresses {
-				if addr == "dynamic" {
-					if s.discoverer != nil {
-						if t, err := s.discoverer.Lookup(deviceID); err == nil {
-							addrs = append(addrs, t...)
-						}
-					}
-				} else {
-					addrs = append(addrs, addr)
-				}
+			if connected && ct.Priority() == bestDialerPrio {
+				// Things are already as good as they can get.
+				continue
 			}
 
-			addrs = util.UniqueTrimmedStrings(addrs)
+			addrs := s.resolveDeviceAddresses(deviceCfg)
 
 			l.Debugln("Reconnect loop for", deviceID, addrs)
 
@@ -397,7 +502,7 @@ func (s *service) connect(ctx context.Context) {
 
 			for _, addr := range addrs {
 				// Use a special key that is more than just the address, as you might have two devices connected to the same relay
-				nextDialKey := deviceID.String() + "/" + addr
+				nextDialKey := dialKey(deviceID, addr)
 				seen = append(seen, nextDialKey)
 				nextDialAt, ok := nextDial[nextDialKey]
 				if ok && initialRampup >= sleep && nextDialAt.After(now) {
@@ -423,6 +528,11 @@ func (s *service) connect(ctx context.Context) {
 					}
 				}
 
+				if !isDialFamilyAllowed(uri, cfg.Options.DialFamily) {
+					l.Debugln("Not dialing", uri, "as only", cfg.Options.DialFamily, "is dialed")
+					continue
+				}
+
 				dialerFactory, err := getDialerFactory(cfg, uri)
 				if err != nil {
 					s.setConnectionStatus(addr, err)
@@ -441,15 +551,14 @@ func (s *service) connect(ctx context.Context) {
 					continue
 				}
 
-				priority := dialerFactory.Priority()
+				priority := dialerFactory.Priority(cfg.Options)
 
 				if connected && priority >= ct.Priority() {
-					l.Debugf("Not dialing using %s as priority is less than current connection (%d >= %d)", dialerFactory, dialerFactory.Priority(), ct.Priority())
+					l.Debugf("Not dialing using %s as priority is less than current connection (%d >= %d)", dialerFactory, priority, ct.Priority())
 					continue
 				}
 
 				dialer := dialerFactory.New(s.cfg.Options(), s.tlsCfg)
-				nextDial[nextDialKey] = now.Add(dialer.RedialFrequency())
 
 				// For LAN addresses, increase the priority so that we
 				// try these first.
@@ -470,12 +579,19 @@ func (s *service) connect(ctx context.Context) {
 			}
 
 			conn, ok := s.dialParallel(ctx, deviceCfg.DeviceID, dialTargets)
+
+			maxInterval := time.Duration(cfg.Options.MaxReconnectIntervalS) * time.Second
+			for _, tgt := range dialTargets {
+				nextDial[tgt.key()] = now.Add(s.nextDialInterval(tgt.key(), tgt.dialer.RedialFrequency(), maxInterval, now))
+			}
+
 			if ok {
 				s.conns <- conn
 			}
 		}
 
 		nextDial, sleep = filterAndFindSleepDuration(nextDial, seen, now)
+		s.pruneDialBackoff(seen)
 
 		if initialRampup < sleep {
 			l.Debugln("initial rampup; sleep", initialRampup, "and update to", initialRampup*2)
@@ -493,6 +609,24 @@ func (s *service) connect(ctx context.Context) {
 	}
 }
 
+// resolveDeviceAddresses returns the configured addresses of the device,
+// with "dynamic" replaced by the addresses found by discovery.
+func (s *service) resolveDeviceAddresses(deviceCfg config.DeviceConfiguration) []string {
+	var addrs []string
+	for _, addr := range deviceCfg.Addresses {
+		if addr == "dynamic" {
+			if s.discoverer != nil {
+				if t, err := s.discoverer.Lookup(deviceCfg.DeviceID); err == nil {
+					addrs = append(addrs, t...)
+				}
+			}
+		} else {
+			addrs = append(addrs, addr)
+		}
+	}
+	return util.UniqueTrimmedStrings(addrs)
+}
+
 func (s *service) isLANHost(host string) bool {
 	// Probably we are called with an ip:port combo which we can resolve as
 	// a TCP address.
@@ -517,13 +651,15 @@ func (s *service) isLAN(addr net.Addr) bool {
 		ip = addr.IP
 	case *net.UDPAddr:
 		ip = addr.IP
+	case *net.UnixAddr:
+		// Always on this host
+		return true
 	default:
-		// From the standard library, just Unix sockets.
 		// If you invent your own, handle it.
 		return false
 	}
 
-	if ip.IsLoopback() {
+	if ip.IsLoopback() || util.IsPrivateIP(ip) {
 		return true
 	}
 
@@ -722,6 +858,114 @@ func (s *service) setConnectionStatus(address string, err error) {
 	s.connectionStatusMut.Unlock()
 }
 
+func (s *service) DialBackoff() map[string]DialBackoffEntry {
+	result := make(map[string]DialBackoffEntry)
+	s.dialBackoffMut.Lock()
+	for k, v := range s.dialBackoff {
+		result[k] = v
+	}
+	s.dialBackoffMut.Unlock()
+	return result
+}
+
+// recordAttempt hands the outcome of dialing the target to the model, which
+// keeps the recent attempts of each device.
+func (s *service) recordAttempt(tgt dialTarget, outcome AttemptOutcome, err error) {
+	attempt := Attempt{
+		Address: tgt.addr,
+		When:    time.Now().UTC(),
+		Outcome: outcome,
+	}
+	if tgt.uri != nil {
+		attempt.Transport = tgt.uri.Scheme
+	}
+	if err != nil {
+		errStr := err.Error()
+		attempt.Error = &errStr
+	}
+	s.model.DialAttempt(tgt.deviceID, attempt)
+}
+
+// recordDialResult updates the backoff state for the given dial key,
+// resetting it on success.
+func (s *service) recordDialResult(key string, err error) {
+	if errors.Cause(err) == context.Canceled {
+		return
+	}
+
+	s.dialBackoffMut.Lock()
+	defer s.dialBackoffMut.Unlock()
+	entry := s.dialBackoff[key]
+	if err != nil {
+		entry.Failures++
+	} else {
+		entry.Failures = 0
+		entry.LastSuccess = time.Now().UTC().Truncate(time.Second)
+	}
+	s.dialBackoff[key] = entry
+}
+
+// nextDialInterval returns how long to wait before dialing the given key
+// again, based on the number of consecutive failures so far.
+func (s *service) nextDialInterval(key string, base, max time.Duration, now time.Time) time.Duration {
+	s.dialBackoffMut.Lock()
+	defer s.dialBackoffMut.Unlock()
+	entry := s.dialBackoff[key]
+	interval := withJitter(backoffInterval(base, max, entry.Failures, !entry.LastSuccess.IsZero()))
+	entry.NextDial = now.Add(interval).UTC().Truncate(time.Second)
+	s.dialBackoff[key] = entry
+	return interval
+}
+
+// pruneDialBackoff forgets the backoff state of keys that are no longer
+// being dialed.
+func (s *service) pruneDialBackoff(seen []string) {
+	keep := make(map[string]struct{}, len(seen))
+	for _, key := range seen {
+		keep[key] = struct{}{}
+	}
+
+	s.dialBackoffMut.Lock()
+	for key := range s.dialBackoff {
+		if _, ok := keep[key]; !ok {
+			delete(s.dialBackoff, key)
+		}
+	}
+	s.dialBackoffMut.Unlock()
+}
+
+// backoffInterval returns the base interval grown exponentially by the
+// number of consecutive failures, capped at max. Addresses that have
+// worked before back off more slowly than ones that never did, as they are
+// more likely to come back.
+func backoffInterval(base, max time.Duration, failures int, hasWorked bool) time.Duration {
+	if max < base {
+		max = base
+	}
+	factor := time.Duration(4)
+	if hasWorked {
+		factor = 2
+	}
+	interval := base
+	for i := 0; i < failures && interval < max; i++ {
+		interval *= factor
+	}
+	if interval > max {
+		interval = max
+	}
+	return interval
+}
+
+// withJitter returns a random interval within 25% of the given one, so
+// that dials to many devices don't happen in lockstep.
+func withJitter(d time.Duration) time.Duration {
+	spread := int64(d / 2)
+	if spread <= 0 {
+		return d
+	}
+	return d - d/4 + time.Duration(rand.Int63()%spread)
+}
+
 func (s *service) NATType() string {
 	s.listenersMut.RLock()
 	defer s.listenersMut.RUnlock()
@@ -778,6 +1022,104 @@ func filterAndFindSleepDuration(nextDial map[string]time.Time, seen []string, no
 	return newNextDial, min
 }
 
+// pendingConnections keeps track of connections to devices that have been
+// established but not yet handed over to the model, so that we can limit
+// the number of concurrent connections to each device.
+type pendingConnections struct {
+	conns map[protocol.DeviceID][]internalConn
+	mut   sync.Mutex
+}
+
+func newPendingConnections() *pendingConnections {
+	return &pendingConnections{
+		conns: make(map[protocol.DeviceID][]internalConn),
+		mut:   sync.NewMutex(),
+	}
+}
+
+// add registers a pending connection to the device. If the device then has
+// more than limit connections, counting the established one if any, the
+// lowest priority pending connections are closed. The established
+// connection is never closed here; if enough pending connections are
+// better than it, it will be replaced by one of them later on. A limit of
+// zero or less means unlimited. Returns false if c itself was closed.
+func (p *pendingConnections) add(deviceID protocol.DeviceID, c internalConn, established Connection, limit int) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	conns := append(p.conns[deviceID], c)
+	p.conns[deviceID] = conns
+
+	total := len(conns)
+	if established != nil {
+		total++
+	}
+	if limit <= 0 || total <= limit {
+		return true
+	}
+
+	// Stable, so that the older of two connections with equal priority is
+	// kept.
+	sort.SliceStable(conns, func(a, b int) bool {
+		return conns[a].priority < conns[b].priority
+	})
+
+	keep := limit
+	if established != nil {
+		better := 0
+		for _, pc := range conns {
+			if shouldReplaceConnection(established, pc) {
+				better++
+			}
+		}
+		if better < limit {
+			// The established connection is among the best ones and
+			// takes up a slot.
+			keep = limit - 1
+		}
+	}
+
+	kept := true
+	for _, pc := range conns[keep:] {
+		l.Infof("Closing connection %s to %s: more than %d connections to device", pc, deviceID, limit)
+		pc.Close()
+		if pc.tlsConn == c.tlsConn {
+			kept = false
+		}
+	}
+	p.conns[deviceID] = conns[:keep]
+	return kept
+}
+
+// remove forgets about the connection. Returns whether it was pending.
+func (p *pendingConnections) remove(c internalConn) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	for deviceID, conns := range p.conns {
+		for i, pc := range conns {
+			if pc.tlsConn != c.tlsConn {
+				continue
+			}
+			conns = append(conns[:i], conns[i+1:]...)
+			if len(conns) == 0 {
+				delete(p.conns, deviceID)
+			} else {
+				p.conns[deviceID] = conns
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// shouldReplaceConnection returns true if the new connection should replace
+// the existing one to the same device. Lower priority is better, just like
+// nice etc.
+func shouldReplaceConnection(existing Connection, c internalConn) bool {
+	return existing.Priority() > c.priority
+}
+
 func urlsToStrings(urls []*url.URL) []string {
 	strings := make([]string, len(urls))
 	for i, url := range urls {
@@ -802,6 +1144,20 @@ func warningFor(dev protocol.DeviceID, msg string) {
 	}
 }
 
+// withTLSOptions returns a copy of the TLS configuration with the minimum
+// version and cipher suites set from the options. These are validated when
+// the config is loaded and require a restart to change.
+func withTLSOptions(tlsCfg *tls.Config, opts config.OptionsConfiguration) *tls.Config {
+	tlsCfg = tlsCfg.Clone()
+	if version, err := tlsutil.ParseVersion(opts.TLSMinVersion); err == nil {
+		tlsCfg.MinVersion = version
+	}
+	if suites, err := tlsutil.ParseCipherSuites(opts.TLSCipherSuites); err == nil && len(suites) > 0 {
+		tlsCfg.CipherSuites = suites
+	}
+	return tlsCfg
+}
+
 func tlsTimedHandshake(tc *tls.Conn) error {
 	tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
 	defer tc.SetDeadline(time.Time{})
@@ -867,10 +1223,16 @@ func (s *service) dialParallel(ctx context.Context, deviceID protocol.DeviceID,
 					err = s.validateIdentity(conn, deviceID)
 				}
 				s.setConnectionStatus(tgt.addr, err)
+				s.recordDialResult(tgt.key(), err)
 				if err != nil {
 					l.Debugln("dialing", deviceID, tgt.uri, "error:", err)
+					s.recordAttempt(tgt, AttemptFailure, err)
+				} else if !s.addPending(deviceID, conn) {
+					l.Debugln("dialing", deviceID, tgt.uri, "success, but too many connections:", conn)
+					s.recordAttempt(tgt, AttemptRejected, nil)
 				} else {
 					l.Debugln("dialing", deviceID, tgt.uri, "success:", conn)
+					s.recordAttempt(tgt, AttemptSuccess, nil)
 					res <- conn
 				}
 				wg.Done()
@@ -893,6 +1255,7 @@ func (s *service) dialParallel(ctx context.Context, deviceID protocol.DeviceID,
 				wg.Wait()
 				l.Debugln("discarding", len(res), "connections while connecting to", deviceID, prio)
 				for conn := range res {
+					s.pending.remove(conn)
 					conn.Close()
 				}
 			}(deviceID, prio)
@@ -904,17 +1267,73 @@ func (s *service) dialParallel(ctx context.Context, deviceID protocol.DeviceID,
 	return internalConn{}, false
 }
 
+// connectionPriority returns the priority of the connection, taking any
+// configured override of the transport priority into account.
+func (s *service) connectionPriority(c internalConn) int {
+	return s.cfg.Options().ConnectionPriority(c.connType.Transport(), c.priority)
+}
+
+// addPending registers a freshly dialed or accepted connection to the
+// device with the pending connections, closing any excess ones. Returns
+// false if the given connection was closed.
+func (s *service) addPending(deviceID protocol.DeviceID, c internalConn) bool {
+	c.priority = s.connectionPriority(c)
+	var established Connection
+	if ct, ok := s.model.Connection(deviceID); ok {
+		established = ct
+	}
+	return s.pending.add(deviceID, c, established, s.cfg.Options().ConnLimitPerDevice)
+}
+
+// checkPeerCertificates checks that the peer sent a device certificate,
+// followed by intermediates only when they are needed to verify it against
+// the device certificate CA.
+func checkPeerCertificates(certs []*x509.Certificate, caFile string) error {
+	if cl := len(certs); cl == 0 || cl > 1 && caFile == "" {
+		return fmt.Errorf("got peer certificate list of length %d != 1", cl)
+	}
+	return nil
+}
+
+// verifyDeviceCertCA checks that the device certificate, the first of the
+// given ones, is signed by one of the CAs in the given PEM file, in addition
+// to matching the device ID. The other certificates are used as
+// intermediates. Any certificate passes when no file is given.
+func verifyDeviceCertCA(caFile string, certs []*x509.Certificate) error {
+	if caFile == "" {
+		return nil
+	}
+	bs, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return errors.Wrap(err, "reading device certificate CA file")
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bs) {
+		return fmt.Errorf("no certificates in device certificate CA file %s", caFile)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return errors.Wrap(err, "device certificate not signed by a trusted CA")
+}
+
 func (s *service) validateIdentity(c internalConn, expectedID protocol.DeviceID) error {
 	cs := c.ConnectionState()
 
 	// We should have received exactly one certificate from the other
-	// side. If we didn't, they don't have a device ID and we drop the
-	// connection.
+	// side, plus any intermediates. If we didn't, they don't have a device
+	// ID and we drop the connection.
 	certs := cs.PeerCertificates
-	if cl := len(certs); cl != 1 {
-		l.Infof("Got peer certificate list of length %d != 1 from peer at %s; protocol error", cl, c)
+	if err := checkPeerCertificates(certs, s.cfg.Options().DeviceCertCAFile); err != nil {
+		l.Infof("%v from peer at %s; protocol error", err, c)
 		c.Close()
-		return fmt.Errorf("expected 1 certificate, got %d", cl)
+		return err
 	}
 	remoteCert := certs[0]
 	remoteID := protocol.NewDeviceID(remoteCert.Raw)
@@ -934,5 +1353,10 @@ func (s *service) validateIdentity(c internalConn, expectedID protocol.DeviceID)
 		return fmt.Errorf("unexpected device id, expected %s got %s", expectedID, remoteID)
 	}
 
+	if err := verifyDeviceCertCA(s.cfg.Options().DeviceCertCAFile, certs); err != nil {
+		c.Close()
+		return err
+	}
+
 	return nil
 }
@@ -30,6 +30,7 @@ type Connection interface {
 	Priority() int
 	String() string
 	Crypto() string
+	RelayScore() (time.Duration, bool)
 }
 
 // completeConn is the aggregation of an internalConn and the
@@ -45,6 +46,11 @@ func (c completeConn) Close(err error) {
 	c.internalConn.Close()
 }
 
+func (c completeConn) Drain(ctx context.Context, err error) {
+	c.Connection.Drain(ctx, err)
+	c.internalConn.Close()
+}
+
 type tlsConn interface {
 	io.ReadWriteCloser
 	ConnectionState() tls.ConnectionState
@@ -71,6 +77,8 @@ const (
 	connTypeTCPServer
 	connTypeQUICClient
 	connTypeQUICServer
+	connTypeUnixClient
+	connTypeUnixServer
 )
 
 func (t connType) String() string {
@@ -87,6 +95,10 @@ func (t connType) String() string {
 		return "quic-client"
 	case connTypeQUICServer:
 		return "quic-server"
+	case connTypeUnixClient:
+		return "unix-client"
+	case connTypeUnixServer:
+		return "unix-server"
 	default:
 		return "unknown-type"
 	}
@@ -100,6 +112,8 @@ func (t connType) Transport() string {
 		return "tcp"
 	case connTypeQUICClient, connTypeQUICServer:
 		return "quic"
+	case connTypeUnixClient, connTypeUnixServer:
+		return "unix"
 	default:
 		return "unknown"
 	}
@@ -126,6 +140,15 @@ func (c internalConn) Crypto() string {
 	return fmt.Sprintf("%s-%s", tlsVersionNames[cs.Version], tlsCipherSuiteNames[cs.CipherSuite])
 }
 
+// RelayScore returns the score of the relay the connection goes through, if
+// it's known.
+func (c internalConn) RelayScore() (time.Duration, bool) {
+	if scorer, ok := c.tlsConn.(relayScorer); ok {
+		return scorer.RelayScore()
+	}
+	return 0, false
+}
+
 func (c internalConn) Transport() string {
 	transport := c.connType.Transport()
 	host, _, err := net.SplitHostPort(c.LocalAddr().String())
@@ -148,7 +171,7 @@ func (c internalConn) String() string {
 
 type dialerFactory interface {
 	New(config.OptionsConfiguration, *tls.Config) genericDialer
-	Priority() int
+	Priority(config.OptionsConfiguration) int
 	AlwaysWAN() bool
 	Valid(config.Configuration) error
 	String() string
@@ -158,6 +181,7 @@ type commonDialer struct {
 	trafficClass      int
 	reconnectInterval time.Duration
 	tlsCfg            *tls.Config
+	dialFamily        string
 }
 
 func (d *commonDialer) RedialFrequency() time.Duration {
@@ -194,12 +218,19 @@ type genericListener interface {
 	NATType() string
 }
 
+// relayScorer is implemented by listeners that can rate the relay they
+// are using, and the connections through it.
+type relayScorer interface {
+	RelayScore() (time.Duration, bool)
+}
+
 type Model interface {
 	protocol.Model
 	AddConnection(conn Connection, hello protocol.HelloResult)
 	Connection(remoteID protocol.DeviceID) (Connection, bool)
 	OnHello(protocol.DeviceID, net.Addr, protocol.HelloResult) error
 	GetHello(protocol.DeviceID) protocol.HelloIntf
+	DialAttempt(protocol.DeviceID, Attempt)
 }
 
 type onAddressesChangedNotifier struct {
@@ -224,6 +255,16 @@ type dialTarget struct {
 	deviceID protocol.DeviceID
 }
 
+// key identifies the combination of device and address, as there might be
+// two devices connected to the same relay.
+func (t dialTarget) key() string {
+	return dialKey(t.deviceID, t.addr)
+}
+
+func dialKey(deviceID protocol.DeviceID, addr string) string {
+	return deviceID.String() + "/" + addr
+}
+
 func (t dialTarget) Dial(ctx context.Context) (internalConn, error) {
 	l.Debugln("dialing", t.deviceID, t.uri, "prio", t.priority)
 	return t.dialer.Dial(ctx, t.deviceID, t.uri)
@@ -35,7 +35,11 @@ func (d *tcpDialer) Dial(ctx context.Context, _ protocol.DeviceID, uri *url.URL)
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	conn, err := dialer.DialContext(timeoutCtx, uri.Scheme, uri.Host)
+	network := uri.Scheme
+	if network == "tcp" {
+		network = dialNetwork(network, d.dialFamily)
+	}
+	conn, err := dialer.DialContext(timeoutCtx, network, uri.Host)
 	if err != nil {
 		return internalConn{}, err
 	}
@@ -67,19 +71,22 @@ func (tcpDialerFactory) New(opts config.OptionsConfiguration, tlsCfg *tls.Config
 		trafficClass:      opts.TrafficClass,
 		reconnectInterval: time.Duration(opts.ReconnectIntervalS) * time.Second,
 		tlsCfg:            tlsCfg,
+		dialFamily:        opts.DialFamily,
 	}}
 }
 
-func (tcpDialerFactory) Priority() int {
-	return tcpPriority
+func (tcpDialerFactory) Priority(opts config.OptionsConfiguration) int {
+	return opts.ConnectionPriority("tcp", tcpPriority)
 }
 
 func (tcpDialerFactory) AlwaysWAN() bool {
 	return false
 }
 
-func (tcpDialerFactory) Valid(_ config.Configuration) error {
-	// Always valid
+func (tcpDialerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("tcp") {
+		return errDisabled
+	}
 	return nil
 }
 
@@ -188,7 +188,9 @@ func (f *tcpListenerFactory) New(uri *url.URL, cfg config.Wrapper, tlsCfg *tls.C
 	return l
 }
 
-func (tcpListenerFactory) Valid(_ config.Configuration) error {
-	// Always valid
+func (tcpListenerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("tcp") {
+		return errDisabled
+	}
 	return nil
 }
@@ -0,0 +1,83 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// Connections over a Unix socket are local and preferred over anything
+// else.
+const unixPriority = 5
+
+func init() {
+	dialers["unix"] = &unixDialerFactory{}
+}
+
+type unixDialer struct {
+	commonDialer
+}
+
+func (d *unixDialer) Dial(ctx context.Context, _ protocol.DeviceID, uri *url.URL) (internalConn, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(timeoutCtx, "unix", unixSocketPath(uri))
+	if err != nil {
+		return internalConn{}, err
+	}
+
+	tc := tls.Client(conn, d.tlsCfg)
+	err = tlsTimedHandshake(tc)
+	if err != nil {
+		tc.Close()
+		return internalConn{}, err
+	}
+
+	return internalConn{tc, connTypeUnixClient, unixPriority}, nil
+}
+
+type unixDialerFactory struct{}
+
+func (unixDialerFactory) New(opts config.OptionsConfiguration, tlsCfg *tls.Config) genericDialer {
+	return &unixDialer{commonDialer{
+		reconnectInterval: time.Duration(opts.ReconnectIntervalS) * time.Second,
+		tlsCfg:            tlsCfg,
+	}}
+}
+
+func (unixDialerFactory) Priority(opts config.OptionsConfiguration) int {
+	return opts.ConnectionPriority("unix", unixPriority)
+}
+
+func (unixDialerFactory) AlwaysWAN() bool {
+	return false
+}
+
+func (unixDialerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("unix") {
+		return errDisabled
+	}
+	return nil
+}
+
+func (unixDialerFactory) String() string {
+	return "Unix Socket Dialer"
+}
+
+// unixSocketPath returns the path of the socket in a unix:///path/to/socket
+// address. A relative path may be given as unix://path/to/socket.
+func unixSocketPath(uri *url.URL) string {
+	return uri.Host + uri.Path
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/nat"
+	"github.com/syncthing/syncthing/lib/util"
+)
+
+func init() {
+	listeners["unix"] = &unixListenerFactory{}
+}
+
+type unixListener struct {
+	util.ServiceWithError
+	onAddressesChangedNotifier
+
+	uri     *url.URL
+	tlsCfg  *tls.Config
+	conns   chan internalConn
+	factory listenerFactory
+}
+
+func (t *unixListener) serve(ctx context.Context) error {
+	path := unixSocketPath(t.uri)
+
+	// A socket left behind by an unclean shutdown would make listening
+	// fail.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		l.Infoln("Listen (BEP/unix):", err)
+		return err
+	}
+	defer listener.Close()
+
+	l.Infof("Unix socket listener (%v) starting", path)
+	defer l.Infof("Unix socket listener (%v) shutting down", path)
+
+	acceptFailures := 0
+	const maxAcceptFailures = 10
+
+	for {
+		listener.SetDeadline(time.Now().Add(time.Second))
+		conn, err := listener.Accept()
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				conn.Close()
+			}
+			return nil
+		default:
+		}
+		if err != nil {
+			if err, ok := err.(*net.OpError); !ok || !err.Timeout() {
+				l.Warnln("Listen (BEP/unix): Accepting connection:", err)
+
+				acceptFailures++
+				if acceptFailures > maxAcceptFailures {
+					// Return to restart the listener, because something
+					// seems permanently damaged.
+					return err
+				}
+
+				// Slightly increased delay for each failure.
+				time.Sleep(time.Duration(acceptFailures) * time.Second)
+			}
+			continue
+		}
+
+		acceptFailures = 0
+		l.Debugln("Listen (BEP/unix): connect on", path)
+
+		tc := tls.Server(conn, t.tlsCfg)
+		if err := tlsTimedHandshake(tc); err != nil {
+			l.Infoln("Listen (BEP/unix): TLS handshake:", err)
+			tc.Close()
+			continue
+		}
+
+		t.conns <- internalConn{tc, connTypeUnixServer, unixPriority}
+	}
+}
+
+func (t *unixListener) URI() *url.URL {
+	return t.uri
+}
+
+func (t *unixListener) WANAddresses() []*url.URL {
+	// The socket can't be reached from elsewhere.
+	return nil
+}
+
+func (t *unixListener) LANAddresses() []*url.URL {
+	return []*url.URL{t.uri}
+}
+
+func (t *unixListener) String() string {
+	return t.uri.String()
+}
+
+func (t *unixListener) Factory() listenerFactory {
+	return t.factory
+}
+
+func (t *unixListener) NATType() string {
+	return "unknown"
+}
+
+type unixListenerFactory struct{}
+
+func (f *unixListenerFactory) New(uri *url.URL, cfg config.Wrapper, tlsCfg *tls.Config, conns chan internalConn, natService *nat.Service) genericListener {
+	l := &unixListener{
+		uri:     uri,
+		tlsCfg:  tlsCfg,
+		conns:   conns,
+		factory: f,
+	}
+	l.ServiceWithError = util.AsServiceWithError(l.serve, l.String())
+	return l
+}
+
+func (unixListenerFactory) Valid(cfg config.Configuration) error {
+	if !cfg.Options.IsTransportEnabled("unix") {
+		return errDisabled
+	}
+	return nil
+}
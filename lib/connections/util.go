@@ -11,6 +11,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+
+	"github.com/syncthing/syncthing/lib/config"
 )
 
 func fixupPort(uri *url.URL, defaultPort int) *url.URL {
@@ -18,8 +20,9 @@ func fixupPort(uri *url.URL, defaultPort int) *url.URL {
 
 	host, port, err := net.SplitHostPort(uri.Host)
 	if err != nil && strings.Contains(err.Error(), "missing port") {
-		// addr is on the form "1.2.3.4"
-		copyURI.Host = net.JoinHostPort(uri.Host, strconv.Itoa(defaultPort))
+		// addr is on the form "1.2.3.4" or "[fe80::1%eth0]"
+		host = strings.TrimSuffix(strings.TrimPrefix(uri.Host, "["), "]")
+		copyURI.Host = net.JoinHostPort(host, strconv.Itoa(defaultPort))
 	} else if err == nil && port == "" {
 		// addr is on the form "1.2.3.4:"
 		copyURI.Host = net.JoinHostPort(host, strconv.Itoa(defaultPort))
@@ -27,3 +30,48 @@ func fixupPort(uri *url.URL, defaultPort int) *url.URL {
 
 	return &copyURI
 }
+
+// dialNetwork returns the network, "tcp" or "udp", restricted to the IP
+// family we dial.
+func dialNetwork(network, family string) string {
+	switch family {
+	case config.DialFamilyIPv4:
+		return network + "4"
+	case config.DialFamilyIPv6:
+		return network + "6"
+	default:
+		return network
+	}
+}
+
+// isDialFamilyAllowed returns false if the address is of an IP family we
+// don't dial. Host names are resolved to an allowed family when dialing.
+func isDialFamilyAllowed(uri *url.URL, family string) bool {
+	switch {
+	case family == config.DialFamilyIPv4 && strings.HasSuffix(uri.Scheme, "6"):
+		return false
+	case family == config.DialFamilyIPv6 && strings.HasSuffix(uri.Scheme, "4"):
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(uri.Host)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(uri.Host, "["), "]")
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		// Zone of a link local address
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	switch family {
+	case config.DialFamilyIPv4:
+		return ip.To4() != nil
+	case config.DialFamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
@@ -7,6 +7,8 @@
 package backend
 
 import (
+	"fmt"
+	"os"
 	"sync"
 )
 
@@ -99,6 +101,7 @@ type Backend interface {
 	Writer
 	NewReadTransaction() (ReadTransaction, error)
 	NewWriteTransaction() (WriteTransaction, error)
+	Compact() error
 	Close() error
 }
 
@@ -111,14 +114,57 @@ const (
 	TuningLarge
 )
 
+// The database implementation is selected by the STDBBACKEND environment
+// variable, either "leveldb" (the default) or "badger".
+var dbBackend = os.Getenv("STDBBACKEND")
+
 func Open(path string, tuning Tuning) (Backend, error) {
-	return OpenLevelDB(path, tuning)
+	switch dbBackend {
+	case "", "leveldb":
+		return OpenLevelDB(path, tuning)
+	case "badger":
+		return OpenBadger(path)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", dbBackend)
+	}
 }
 
 func OpenMemory() Backend {
+	if dbBackend == "badger" {
+		return OpenBadgerMemory()
+	}
 	return OpenLevelDBMemory()
 }
 
+// Copy writes everything read from src to dst. Given a read transaction as
+// src, the copy is consistent while writes to the source continue.
+func Copy(dst Backend, src Reader) error {
+	it, err := src.NewPrefixIterator(nil)
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	t, err := dst.NewWriteTransaction()
+	if err != nil {
+		return err
+	}
+	defer t.Release()
+
+	for it.Next() {
+		if err := t.Put(it.Key(), it.Value()); err != nil {
+			return err
+		}
+		if err := t.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
 type errClosed struct{}
 
 func (errClosed) Error() string { return "database is closed" }
@@ -127,6 +173,19 @@ type errNotFound struct{}
 
 func (errNotFound) Error() string { return "key not found" }
 
+// errReadOnly is returned by writes to a database that temporarily can't
+// be written to, with the reason why.
+type errReadOnly struct {
+	reason string
+}
+
+func (e errReadOnly) Error() string {
+	if e.reason == "" {
+		return "database is read only"
+	}
+	return "database is read only: " + e.reason
+}
+
 func IsClosed(err error) bool {
 	if _, ok := err.(errClosed); ok {
 		return true
@@ -147,6 +206,35 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+func IsReadOnly(err error) bool {
+	if _, ok := err.(errReadOnly); ok {
+		return true
+	}
+	if _, ok := err.(*errReadOnly); ok {
+		return true
+	}
+	return false
+}
+
+// CheckWritable returns an error for which IsReadOnly is true if the
+// database can't currently be written to.
+func CheckWritable(b Backend) error {
+	if w, ok := b.(interface{ checkWritable() error }); ok {
+		return w.checkWritable()
+	}
+	return nil
+}
+
+// ClosedUncleanly returns true if the database may have lost writes because
+// it wasn't closed properly last time, such that sequence numbers may be
+// reused and the delta index IDs must be reset.
+func ClosedUncleanly(b Backend) bool {
+	if u, ok := b.(interface{ closedUncleanly() bool }); ok {
+		return u.closedUncleanly()
+	}
+	return false
+}
+
 // releaser manages counting on top of a waitgroup
 type releaser struct {
 	wg   *sync.WaitGroup
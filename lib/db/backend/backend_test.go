@@ -6,7 +6,11 @@
 
 package backend
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
 
 // testBackendBehavior is the generic test suite that must be fulfilled by
 // every backend implementation. It should be called by each implementation
@@ -15,6 +19,12 @@ func testBackendBehavior(t *testing.T, open func() Backend) {
 	t.Run("WriteIsolation", func(t *testing.T) { testWriteIsolation(t, open) })
 	t.Run("DeleteNonexisten", func(t *testing.T) { testDeleteNonexistent(t, open) })
 	t.Run("IteratorClosedDB", func(t *testing.T) { testIteratorClosedDB(t, open) })
+	t.Run("PrefixIterator", func(t *testing.T) { testPrefixIterator(t, open) })
+	t.Run("RangeIterator", func(t *testing.T) { testRangeIterator(t, open) })
+	t.Run("SnapshotIsolation", func(t *testing.T) { testSnapshotIsolation(t, open) })
+	t.Run("TransactionCommit", func(t *testing.T) { testTransactionCommit(t, open) })
+	t.Run("Compact", func(t *testing.T) { testCompact(t, open) })
+	t.Run("Copy", func(t *testing.T) { testCopy(t, open) })
 }
 
 func testWriteIsolation(t *testing.T, open func() Backend) {
@@ -74,3 +84,198 @@ func testIteratorClosedDB(t *testing.T, open func() Backend) {
 		t.Error("Next: IsClosed(err) == false:", err)
 	}
 }
+
+// iterKeys returns a function that returns the keys of an iterator as a
+// comma separated string, releasing it.
+func iterKeys(t *testing.T) func(Iterator, error) string {
+	return func(it Iterator, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Release()
+		var keys []string
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+			if string(it.Value()) != "v"+string(it.Key()) {
+				t.Errorf("value %q for key %q", it.Value(), it.Key())
+			}
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(keys, ",")
+	}
+}
+
+func putKeys(t *testing.T, db Writer, keys ...string) {
+	t.Helper()
+	for _, k := range keys {
+		if err := db.Put([]byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testPrefixIterator(t *testing.T, open func() Backend) {
+	// Prefix iteration returns exactly the keys with the prefix, in order.
+
+	db := open()
+	defer db.Close()
+
+	putKeys(t, db, "b2", "a", "b1", "ba", "b", "c", "b\xff")
+
+	if keys := iterKeys(t)(db.NewPrefixIterator([]byte("b"))); keys != "b,b1,b2,ba,b\xff" {
+		t.Errorf("prefix b: %s", keys)
+	}
+	if keys := iterKeys(t)(db.NewPrefixIterator([]byte("x"))); keys != "" {
+		t.Errorf("prefix x: %s", keys)
+	}
+	if keys := iterKeys(t)(db.NewPrefixIterator(nil)); keys != "a,b,b1,b2,ba,b\xff,c" {
+		t.Errorf("nil prefix: %s", keys)
+	}
+}
+
+func testRangeIterator(t *testing.T, open func() Backend) {
+	// Range iteration includes the first key and excludes the last.
+
+	db := open()
+	defer db.Close()
+
+	putKeys(t, db, "a", "b", "c", "d")
+
+	if keys := iterKeys(t)(db.NewRangeIterator([]byte("b"), []byte("d"))); keys != "b,c" {
+		t.Errorf("range b-d: %s", keys)
+	}
+	if keys := iterKeys(t)(db.NewRangeIterator([]byte("bb"), []byte("z"))); keys != "c,d" {
+		t.Errorf("range bb-z: %s", keys)
+	}
+}
+
+func testSnapshotIsolation(t *testing.T, open func() Backend) {
+	// Read transactions, and iterators created from them, don't see writes
+	// made after they were created.
+
+	db := open()
+	defer db.Close()
+
+	putKeys(t, db, "a", "b")
+
+	snap, err := db.NewReadTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	putKeys(t, db, "c")
+	if err := db.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := iterKeys(t)(snap.NewPrefixIterator(nil)); keys != "a,b" {
+		t.Errorf("snapshot sees %s", keys)
+	}
+	if _, err := snap.Get([]byte("c")); !IsNotFound(err) {
+		t.Error("snapshot sees later write:", err)
+	}
+	snap.Release()
+
+	if keys := iterKeys(t)(db.NewPrefixIterator(nil)); keys != "b,c" {
+		t.Errorf("database has %s", keys)
+	}
+}
+
+func testTransactionCommit(t *testing.T, open func() Backend) {
+	// Writes in a transaction are visible after commit, also across
+	// checkpoints, but not when released without commit.
+
+	db := open()
+	defer db.Close()
+
+	tx, err := db.NewWriteTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		putKeys(t, tx, fmt.Sprintf("k%04d", i))
+		if i%100 == 0 {
+			if err := tx.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Delete([]byte("k0000")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Release()
+
+	keys := iterKeys(t)(db.NewPrefixIterator([]byte("k")))
+	if n := strings.Count(keys, ",") + 1; n != 999 || strings.HasPrefix(keys, "k0000") {
+		t.Errorf("%d keys after commit, expected 999", n)
+	}
+
+	tx, err = db.NewWriteTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	putKeys(t, tx, "x")
+	tx.Release()
+	if _, err := db.Get([]byte("x")); !IsNotFound(err) {
+		t.Error("released transaction was written:", err)
+	}
+}
+
+func testCompact(t *testing.T, open func() Backend) {
+	db := open()
+	defer db.Close()
+
+	putKeys(t, db, "a", "b")
+	if err := db.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := iterKeys(t)(db.NewPrefixIterator(nil)); keys != "b" {
+		t.Errorf("database has %s after compaction", keys)
+	}
+}
+
+func testCopy(t *testing.T, open func() Backend) {
+	// Copying a snapshot is not affected by later writes.
+
+	src := open()
+	defer src.Close()
+	for _, k := range []string{"a", "b", "c"} {
+		if err := src.Put([]byte(k), []byte(k+"-value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := src.NewReadTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+	if err := src.Put([]byte("d"), []byte("d-value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := open()
+	defer dst.Close()
+	if err := Copy(dst, snap); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if v, err := dst.Get([]byte(k)); err != nil || string(v) != k+"-value" {
+			t.Errorf("Key %q: got %q, %v", k, v, err)
+		}
+	}
+	if _, err := dst.Get([]byte("d")); !IsNotFound(err) {
+		t.Error("Key written after the snapshot should not be copied, got", err)
+	}
+}
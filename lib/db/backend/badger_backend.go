@@ -0,0 +1,429 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+const (
+	// Value log GC rewrites files with at least this fraction of garbage.
+	badgerGCDiscardRatio = 0.5
+)
+
+// OpenBadger opens the badger database at the given location, creating it
+// if it doesn't exist.
+func OpenBadger(path string) (Backend, error) {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err == nil {
+		return nil, fmt.Errorf("%s contains a leveldb database", path)
+	}
+	opts := badger.DefaultOptions(path).WithLogger(badgerLogger{})
+	return openBadger(opts)
+}
+
+// OpenBadgerMemory returns a new Backend referencing an in-memory badger
+// database.
+func OpenBadgerMemory() Backend {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(badgerLogger{})
+	b, err := openBadger(opts)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func openBadger(opts badger.Options) (Backend, error) {
+	bdb, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerBackend{bdb: bdb, inMemory: opts.InMemory}, nil
+}
+
+// badgerBackend implements Backend on top of a badger database. Badger
+// transactions read their own writes, so write transactions read from a
+// separate read transaction to get the same isolation as with leveldb.
+type badgerBackend struct {
+	bdb      *badger.DB
+	inMemory bool
+	closeWG  sync.WaitGroup
+
+	closeMut sync.RWMutex
+	closed   bool
+}
+
+// acquire registers an operation on the database, which must be ended by
+// calling release. It fails if the database is closed.
+func (b *badgerBackend) acquire() (*releaser, error) {
+	b.closeMut.RLock()
+	defer b.closeMut.RUnlock()
+	if b.closed {
+		return nil, errClosed{}
+	}
+	return newReleaser(&b.closeWG), nil
+}
+
+func (b *badgerBackend) NewReadTransaction() (ReadTransaction, error) {
+	return b.newSnapshot()
+}
+
+func (b *badgerBackend) newSnapshot() (*badgerSnapshot, error) {
+	rel, err := b.acquire()
+	if err != nil {
+		return nil, err
+	}
+	return &badgerSnapshot{
+		txn: b.bdb.NewTransaction(false),
+		rel: rel,
+	}, nil
+}
+
+func (b *badgerBackend) NewWriteTransaction() (WriteTransaction, error) {
+	snap, err := b.newSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := b.acquire()
+	if err != nil {
+		snap.Release()
+		return nil, err
+	}
+	return &badgerTransaction{
+		badgerSnapshot: snap,
+		bdb:            b.bdb,
+		txn:            b.bdb.NewTransaction(true),
+		rel:            rel,
+	}, nil
+}
+
+func (b *badgerBackend) Close() error {
+	b.closeMut.Lock()
+	if b.closed {
+		b.closeMut.Unlock()
+		return errClosed{}
+	}
+	b.closed = true
+	b.closeMut.Unlock()
+
+	b.closeWG.Wait()
+	return b.bdb.Close()
+}
+
+func (b *badgerBackend) Get(key []byte) ([]byte, error) {
+	snap, err := b.newSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	return snap.Get(key)
+}
+
+func (b *badgerBackend) NewPrefixIterator(prefix []byte) (Iterator, error) {
+	snap, err := b.newSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	// The snapshot lives on until the iterator is released.
+	defer snap.Release()
+	return snap.newIterator(prefix, prefix, nil), nil
+}
+
+func (b *badgerBackend) NewRangeIterator(first, last []byte) (Iterator, error) {
+	snap, err := b.newSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	return snap.newIterator(nil, first, last), nil
+}
+
+func (b *badgerBackend) Put(key, val []byte) error {
+	rel, err := b.acquire()
+	if err != nil {
+		return err
+	}
+	defer rel.Release()
+	return wrapBadgerErr(b.bdb.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, val)
+	}))
+}
+
+func (b *badgerBackend) Delete(key []byte) error {
+	rel, err := b.acquire()
+	if err != nil {
+		return err
+	}
+	defer rel.Release()
+	return wrapBadgerErr(b.bdb.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	}))
+}
+
+// Compact moves everything to the last level of the tree and reclaims
+// space in the value log.
+func (b *badgerBackend) Compact() error {
+	rel, err := b.acquire()
+	if err != nil {
+		return err
+	}
+	defer rel.Release()
+
+	if err := b.bdb.Flatten(runtime.NumCPU()); err != nil {
+		return wrapBadgerErr(err)
+	}
+	if b.inMemory {
+		// There is no value log.
+		return nil
+	}
+	for {
+		// GC one value log file at a time, until there is nothing left
+		// to rewrite.
+		err := b.bdb.RunValueLogGC(badgerGCDiscardRatio)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			return nil
+		}
+		if err != nil {
+			return wrapBadgerErr(err)
+		}
+	}
+}
+
+// badgerSnapshot implements backend.ReadTransaction. Badger doesn't allow
+// discarding a transaction with open iterators, while we allow releasing
+// them in any order, so the transaction is only discarded once both the
+// snapshot and all its iterators are released.
+type badgerSnapshot struct {
+	txn *badger.Txn
+	rel *releaser
+
+	mut      sync.Mutex
+	iters    int
+	released bool
+}
+
+func (l *badgerSnapshot) Get(key []byte) ([]byte, error) {
+	item, err := l.txn.Get(key)
+	if err != nil {
+		return nil, wrapBadgerErr(err)
+	}
+	val, err := item.ValueCopy(nil)
+	return val, wrapBadgerErr(err)
+}
+
+func (l *badgerSnapshot) NewPrefixIterator(prefix []byte) (Iterator, error) {
+	return l.newIterator(prefix, prefix, nil), nil
+}
+
+func (l *badgerSnapshot) NewRangeIterator(first, last []byte) (Iterator, error) {
+	return l.newIterator(nil, first, last), nil
+}
+
+func (l *badgerSnapshot) newIterator(prefix, first, last []byte) *badgerIterator {
+	l.mut.Lock()
+	l.iters++
+	l.mut.Unlock()
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	return &badgerIterator{
+		it:    l.txn.NewIterator(opts),
+		snap:  l,
+		first: first,
+		last:  last,
+	}
+}
+
+func (l *badgerSnapshot) Release() {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	l.discardLocked()
+}
+
+func (l *badgerSnapshot) iteratorReleased() {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.iters--
+	l.discardLocked()
+}
+
+func (l *badgerSnapshot) discardLocked() {
+	if l.released && l.iters == 0 {
+		l.txn.Discard()
+		l.rel.Release()
+	}
+}
+
+// badgerTransaction implements backend.WriteTransaction. Writes go to a
+// separate badger transaction, committed when it grows too large, on
+// Checkpoint and on Commit.
+type badgerTransaction struct {
+	*badgerSnapshot
+	bdb  *badger.DB
+	txn  *badger.Txn
+	size int
+	rel  *releaser
+}
+
+// Badger keeps the given slices until the transaction is committed, while
+// our callers reuse their buffers, hence the copies.
+
+func (t *badgerTransaction) Delete(key []byte) error {
+	key = append([]byte(nil), key...)
+	return t.update(len(key), func() error { return t.txn.Delete(key) })
+}
+
+func (t *badgerTransaction) Put(key, val []byte) error {
+	key = append([]byte(nil), key...)
+	val = append([]byte(nil), val...)
+	return t.update(len(key)+len(val), func() error { return t.txn.Set(key, val) })
+}
+
+func (t *badgerTransaction) update(size int, fn func() error) error {
+	err := fn()
+	if err == badger.ErrTxnTooBig {
+		// Commit what we have and retry in a new transaction.
+		if err := t.flush(); err != nil {
+			return err
+		}
+		err = fn()
+	}
+	if err != nil {
+		return wrapBadgerErr(err)
+	}
+	t.size += size
+	return nil
+}
+
+func (t *badgerTransaction) Checkpoint() error {
+	if t.size < dbFlushBatchMin {
+		return nil
+	}
+	return t.flush()
+}
+
+func (t *badgerTransaction) Commit() error {
+	err := wrapBadgerErr(t.txn.Commit())
+	t.badgerSnapshot.Release()
+	t.rel.Release()
+	return err
+}
+
+func (t *badgerTransaction) Release() {
+	t.txn.Discard()
+	t.badgerSnapshot.Release()
+	t.rel.Release()
+}
+
+func (t *badgerTransaction) flush() error {
+	if err := t.txn.Commit(); err != nil {
+		return wrapBadgerErr(err)
+	}
+	t.txn = t.bdb.NewTransaction(true)
+	t.size = 0
+	return nil
+}
+
+// badgerIterator implements backend.Iterator, over the keys with a prefix
+// or in a range.
+type badgerIterator struct {
+	it          *badger.Iterator
+	snap        *badgerSnapshot
+	first, last []byte
+	started     bool
+	key, val    []byte
+	err         error
+	released    bool
+}
+
+func (i *badgerIterator) Next() bool {
+	if i.err != nil || i.released {
+		return false
+	}
+	if i.started {
+		i.it.Next()
+	} else {
+		i.it.Seek(i.first)
+		i.started = true
+	}
+	if !i.it.Valid() {
+		return false
+	}
+	item := i.it.Item()
+	key := item.KeyCopy(nil)
+	if i.last != nil && bytes.Compare(key, i.last) >= 0 {
+		return false
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		i.err = wrapBadgerErr(err)
+		return false
+	}
+	i.key, i.val = key, val
+	return true
+}
+
+func (i *badgerIterator) Key() []byte {
+	return i.key
+}
+
+func (i *badgerIterator) Value() []byte {
+	return i.val
+}
+
+func (i *badgerIterator) Error() error {
+	return i.err
+}
+
+func (i *badgerIterator) Release() {
+	if i.released {
+		return
+	}
+	i.released = true
+	i.it.Close()
+	i.snap.iteratorReleased()
+}
+
+// wrapBadgerErr wraps errors so that the backend package can recognize them
+func wrapBadgerErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == badger.ErrKeyNotFound {
+		return errNotFound{}
+	}
+	return err
+}
+
+// badgerLogger sends badger's logging to our logger, where the noise goes
+// to debug.
+type badgerLogger struct{}
+
+func (badgerLogger) Errorf(format string, args ...interface{}) {
+	l.Warnf(format, args...)
+}
+
+func (badgerLogger) Warningf(format string, args ...interface{}) {
+	l.Infof(format, args...)
+}
+
+func (badgerLogger) Infof(format string, args ...interface{}) {
+	l.Debugf(format, args...)
+}
+
+func (badgerLogger) Debugf(format string, args ...interface{}) {
+	l.Debugf(format, args...)
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBadgerBackendBehavior(t *testing.T) {
+	testBackendBehavior(t, OpenBadgerMemory)
+}
+
+func TestBadgerLevelDBSeparation(t *testing.T) {
+	// Neither backend opens a database of the other kind.
+
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := OpenLevelDB(dir, TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := OpenBadger(dir); err == nil {
+		t.Error("unexpected nil error opening leveldb database with badger")
+	}
+
+	dir, err = ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err = OpenBadger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := OpenLevelDB(dir, TuningAuto); err == nil {
+		t.Error("unexpected nil error opening badger database with leveldb")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -60,6 +61,10 @@ func (b *leveldbBackend) Close() error {
 	return wrapLeveldbErr(b.ldb.Close())
 }
 
+func (b *leveldbBackend) Compact() error {
+	return wrapLeveldbErr(b.ldb.CompactRange(util.Range{}))
+}
+
 func (b *leveldbBackend) Get(key []byte) ([]byte, error) {
 	val, err := b.ldb.Get(key, nil)
 	return val, wrapLeveldbErr(err)
@@ -105,11 +110,17 @@ func (l leveldbSnapshot) Release() {
 	l.rel.Release()
 }
 
+// batchWriter is where leveldbTransaction writes its batches, usually the
+// *leveldb.DB itself.
+type batchWriter interface {
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+}
+
 // leveldbTransaction implements backend.WriteTransaction using a batch (not
 // an actual leveldb transaction)
 type leveldbTransaction struct {
 	leveldbSnapshot
-	ldb   *leveldb.DB
+	ldb   batchWriter
 	batch *leveldb.Batch
 	rel   *releaser
 }
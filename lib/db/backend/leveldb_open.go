@@ -9,6 +9,7 @@ package backend
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -37,6 +38,9 @@ const (
 // recovery on it if opening fails. Worst case, if recovery is not possible,
 // the database is erased and created from scratch.
 func OpenLevelDB(location string, tuning Tuning) (Backend, error) {
+	if _, err := os.Stat(filepath.Join(location, "KEYREGISTRY")); err == nil {
+		return nil, fmt.Errorf("%s contains a badger database", location)
+	}
 	opts := optsFor(location, tuning)
 	ldb, err := open(location, opts)
 	if err != nil {
@@ -0,0 +1,417 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package backend
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+const (
+	// How often writes are uploaded to the object store.
+	objectStoreFlushInterval = 10 * time.Second
+	// A full snapshot is uploaded after this many write ahead log segments,
+	// after which the older segments and snapshots are removed.
+	objectStoreSnapshotSegments = 100
+
+	objectStoreWALPrefix      = "wal/"
+	objectStoreSnapshotPrefix = "snapshot/"
+	// Present while the database isn't open, after everything was
+	// uploaded when it was closed.
+	objectStoreCleanKey = "clean-close"
+
+	objectStoreReadOnlyReason = "object store unreachable"
+)
+
+// ObjectStore is the minimal interface to an object store, such as S3,
+// needed to persist a database.
+type ObjectStore interface {
+	// List returns the keys of all objects with the given prefix, in no
+	// particular order.
+	List(prefix string) ([]string, error)
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	Delete(key string) error
+}
+
+// objectStoreBackend implements Backend on top of a local leveldb, which
+// serves all reads and is persisted to an object store. Writes are
+// collected and periodically uploaded as a write ahead log segment, with a
+// full snapshot every so often. Opening the database restores the newest
+// snapshot and the segments after it into the local database.
+//
+// When the object store can't be written to, the database turns read only
+// until an upload succeeds again, keeping what wasn't uploaded yet. Writes
+// not yet uploaded when the process dies are lost, which is detected on the
+// next open by a missing clean close marker.
+type objectStoreBackend struct {
+	*leveldbBackend
+	store   ObjectStore
+	unclean bool // the last session may have lost writes
+
+	mut      sync.Mutex
+	pending  *leveldb.Batch // written locally, not yet uploaded
+	seq      uint64         // sequence number of the last uploaded segment
+	segments int            // segments uploaded since the last snapshot
+	readOnly bool
+	stale    bool // opened from the local cache only, permanently read only
+
+	flushMut sync.Mutex
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// OpenObjectStore opens the database persisted to the given object store.
+// The local copy is kept in cacheDir, or in memory if cacheDir is empty.
+// The cacheDir is wiped when restoring from the object store, so it must
+// not be used for anything else. If the object store can't be reached, the
+// local copy is opened read only as a fallback, if there is one.
+func OpenObjectStore(store ObjectStore, cacheDir string, tuning Tuning) (Backend, error) {
+	b := &objectStoreBackend{
+		store:   store,
+		pending: new(leveldb.Batch),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	snapshot, segments, err := objectStoreState(store)
+	if err != nil {
+		if cacheDir == "" {
+			return nil, err
+		}
+		if _, serr := os.Stat(cacheDir); serr != nil {
+			return nil, err
+		}
+		l.Warnf("Object store unreachable, opening local copy of the database read only: %v", err)
+		ldb, err := open(cacheDir, optsFor(cacheDir, tuning))
+		if err != nil {
+			return nil, err
+		}
+		b.leveldbBackend = &leveldbBackend{ldb: ldb}
+		b.readOnly = true
+		b.stale = true
+		close(b.stopped)
+		return b, nil
+	}
+
+	var ldb *leveldb.DB
+	if cacheDir == "" {
+		ldb, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		// The local copy is restored from scratch, it may be outdated.
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return nil, err
+		}
+		ldb, err = open(cacheDir, optsFor(cacheDir, tuning))
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.leveldbBackend = &leveldbBackend{ldb: ldb}
+
+	if err := b.restore(snapshot, segments); err != nil {
+		ldb.Close()
+		return nil, err
+	}
+
+	// The marker is removed while the database is open, so that it's
+	// missing if we don't get to close it properly.
+	clean, err := store.List(objectStoreCleanKey)
+	if err == nil && len(clean) > 0 {
+		err = store.Delete(objectStoreCleanKey)
+	}
+	if err != nil {
+		ldb.Close()
+		return nil, err
+	}
+	b.unclean = len(clean) == 0 && (snapshot > 0 || len(segments) > 0)
+
+	go b.serve()
+	return b, nil
+}
+
+// objectStoreState returns the sequence number of the newest snapshot, and
+// those of the write ahead log segments after it in order.
+func objectStoreState(store ObjectStore) (uint64, []uint64, error) {
+	snapshots, err := listObjectSeqs(store, objectStoreSnapshotPrefix)
+	if err != nil {
+		return 0, nil, err
+	}
+	var snapshot uint64
+	if len(snapshots) > 0 {
+		snapshot = snapshots[len(snapshots)-1]
+	}
+
+	segments, err := listObjectSeqs(store, objectStoreWALPrefix)
+	if err != nil {
+		return 0, nil, err
+	}
+	for len(segments) > 0 && segments[0] <= snapshot {
+		segments = segments[1:]
+	}
+	return snapshot, segments, nil
+}
+
+func (b *objectStoreBackend) restore(snapshot uint64, segments []uint64) error {
+	if snapshot > 0 {
+		if err := b.apply(objectKey(objectStoreSnapshotPrefix, snapshot)); err != nil {
+			return err
+		}
+		b.seq = snapshot
+	}
+	for _, seq := range segments {
+		if seq != b.seq+1 {
+			return fmt.Errorf("object store: missing write ahead log segment %d", b.seq+1)
+		}
+		if err := b.apply(objectKey(objectStoreWALPrefix, seq)); err != nil {
+			return err
+		}
+		b.seq = seq
+	}
+	b.segments = len(segments)
+	return nil
+}
+
+func (b *objectStoreBackend) apply(key string) error {
+	data, err := b.store.Get(key)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	if err := batch.Load(data); err != nil {
+		return fmt.Errorf("object store: %s: %v", key, err)
+	}
+	return wrapLeveldbErr(b.ldb.Write(batch, nil))
+}
+
+func (b *objectStoreBackend) serve() {
+	defer close(b.stopped)
+	t := time.NewTicker(objectStoreFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := b.flush(); err != nil {
+				l.Debugln("Flushing database to object store:", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Write writes the batch to the local database and queues it for upload.
+// It's used by write transactions, as well as Put and Delete.
+func (b *objectStoreBackend) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.readOnly {
+		return errReadOnly{objectStoreReadOnlyReason}
+	}
+	if err := b.ldb.Write(batch, wo); err != nil {
+		return err
+	}
+	return batch.Replay(b.pending)
+}
+
+func (b *objectStoreBackend) NewWriteTransaction() (WriteTransaction, error) {
+	snap, err := b.newSnapshot()
+	if err != nil {
+		return nil, err // already wrapped
+	}
+	return &leveldbTransaction{
+		leveldbSnapshot: snap,
+		ldb:             b,
+		batch:           new(leveldb.Batch),
+		rel:             newReleaser(&b.closeWG),
+	}, nil
+}
+
+func (b *objectStoreBackend) checkWritable() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.readOnly {
+		return errReadOnly{objectStoreReadOnlyReason}
+	}
+	return nil
+}
+
+func (b *objectStoreBackend) closedUncleanly() bool {
+	return b.unclean
+}
+
+func (b *objectStoreBackend) Put(key, val []byte) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, val)
+	return wrapLeveldbErr(b.Write(batch, nil))
+}
+
+func (b *objectStoreBackend) Delete(key []byte) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return wrapLeveldbErr(b.Write(batch, nil))
+}
+
+// Close uploads what is pending, marking the database as cleanly closed,
+// and closes the local database. An error uploading is returned, but the
+// database is closed regardless.
+func (b *objectStoreBackend) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.stopped
+	b.closeWG.Wait()
+	err := b.flush()
+	if err == nil && !b.stale {
+		err = b.store.Put(objectStoreCleanKey, nil)
+	}
+	if cerr := b.leveldbBackend.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flush uploads the pending writes as a new write ahead log segment, and a
+// snapshot when it's time for one.
+func (b *objectStoreBackend) flush() error {
+	b.flushMut.Lock()
+	defer b.flushMut.Unlock()
+
+	b.mut.Lock()
+	if b.pending.Len() == 0 {
+		b.mut.Unlock()
+		return nil
+	}
+	data := b.pending.Dump()
+	b.pending = new(leveldb.Batch)
+	seq := b.seq + 1
+	b.mut.Unlock()
+
+	if err := b.store.Put(objectKey(objectStoreWALPrefix, seq), data); err != nil {
+		b.mut.Lock()
+		// Put back what failed to upload in front of what was written
+		// since.
+		restored := new(leveldb.Batch)
+		_ = restored.Load(data)
+		_ = b.pending.Replay(restored)
+		b.pending = restored
+		if !b.readOnly {
+			l.Warnln("Object store unreachable, database is read only until it's back:", err)
+			b.readOnly = true
+		}
+		b.mut.Unlock()
+		return err
+	}
+
+	b.mut.Lock()
+	b.seq = seq
+	b.segments++
+	if b.readOnly && !b.stale {
+		l.Infoln("Object store reachable again, database is writable")
+		b.readOnly = false
+	}
+	snapshot := b.segments >= objectStoreSnapshotSegments
+	b.mut.Unlock()
+
+	if snapshot {
+		if err := b.snapshot(); err != nil {
+			// Not fatal, the write ahead log is complete. We'll try again
+			// on the next flush.
+			l.Infoln("Uploading database snapshot to object store:", err)
+		}
+	}
+	return nil
+}
+
+// snapshot uploads the whole database, and removes the segments and
+// snapshots it replaces. The snapshot may contain writes that will only be
+// uploaded in a later segment, which is fine as replaying them is
+// idempotent. Must be called with flushMut held.
+func (b *objectStoreBackend) snapshot() error {
+	b.mut.Lock()
+	snap, err := b.ldb.GetSnapshot()
+	seq := b.seq
+	b.mut.Unlock()
+	if err != nil {
+		return wrapLeveldbErr(err)
+	}
+	defer snap.Release()
+
+	batch := new(leveldb.Batch)
+	it := snap.NewIterator(nil, nil)
+	for it.Next() {
+		batch.Put(it.Key(), it.Value())
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return wrapLeveldbErr(err)
+	}
+
+	if err := b.store.Put(objectKey(objectStoreSnapshotPrefix, seq), batch.Dump()); err != nil {
+		return err
+	}
+	b.mut.Lock()
+	b.segments = 0
+	b.mut.Unlock()
+
+	b.removeObjects(objectStoreWALPrefix, seq+1)
+	b.removeObjects(objectStoreSnapshotPrefix, seq)
+	return nil
+}
+
+// removeObjects removes the objects with the given prefix and a sequence
+// number lower than before. Failures only waste some space and are just
+// logged.
+func (b *objectStoreBackend) removeObjects(prefix string, before uint64) {
+	seqs, err := listObjectSeqs(b.store, prefix)
+	if err != nil {
+		l.Debugln("Listing objects to remove:", err)
+		return
+	}
+	for _, seq := range seqs {
+		if seq >= before {
+			break
+		}
+		if err := b.store.Delete(objectKey(prefix, seq)); err != nil {
+			l.Debugln("Removing object:", err)
+		}
+	}
+}
+
+func objectKey(prefix string, seq uint64) string {
+	return fmt.Sprintf("%s%016x", prefix, seq)
+}
+
+// listObjectSeqs returns the sequence numbers of the objects with the given
+// prefix, sorted. Objects not named by objectKey are ignored.
+func listObjectSeqs(store ObjectStore, prefix string) ([]uint64, error) {
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 16, 64)
+		if err != nil || seq == 0 {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+	return seqs, nil
+}
@@ -0,0 +1,328 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errUnreachable = errors.New("object store unreachable")
+
+// memObjectStore is an ObjectStore in memory, which can be made to fail.
+type memObjectStore struct {
+	mut     sync.Mutex
+	objects map[string][]byte
+	fail    bool
+}
+
+func newMemObjectStore() *memObjectStore {
+	return &memObjectStore{objects: make(map[string][]byte)}
+}
+
+func (s *memObjectStore) setFail(fail bool) {
+	s.mut.Lock()
+	s.fail = fail
+	s.mut.Unlock()
+}
+
+func (s *memObjectStore) List(prefix string) ([]string, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.fail {
+		return nil, errUnreachable
+	}
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memObjectStore) Get(key string) ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.fail {
+		return nil, errUnreachable
+	}
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, errNotFound{}
+	}
+	return data, nil
+}
+
+func (s *memObjectStore) Put(key string, data []byte) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.fail {
+		return errUnreachable
+	}
+	s.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memObjectStore) Delete(key string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.fail {
+		return errUnreachable
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memObjectStore) count(prefix string) int {
+	keys, _ := s.List(prefix)
+	return len(keys)
+}
+
+func openTestObjectStore(t *testing.T, store ObjectStore, cacheDir string) *objectStoreBackend {
+	t.Helper()
+	db, err := OpenObjectStore(store, cacheDir, TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.(*objectStoreBackend)
+}
+
+func checkValue(t *testing.T, db Backend, key, expected string) {
+	t.Helper()
+	val, err := db.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("getting %s: %v", key, err)
+	}
+	if string(val) != expected {
+		t.Fatalf("value of %s is %q, expected %q", key, val, expected)
+	}
+}
+
+func TestObjectStoreBackendBehavior(t *testing.T) {
+	testBackendBehavior(t, func() Backend {
+		db, err := OpenObjectStore(newMemObjectStore(), "", TuningAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestObjectStorePersistence(t *testing.T) {
+	store := newMemObjectStore()
+	db := openTestObjectStore(t, store, "")
+
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("b"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.NewWriteTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Put([]byte("a"), []byte("2"))
+	_ = tx.Delete([]byte("b"))
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing uploads what's pending.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.count(objectStoreWALPrefix); n != 2 {
+		t.Errorf("%d write ahead log segments, expected 2", n)
+	}
+
+	// A restart, with nothing local.
+
+	db = openTestObjectStore(t, store, "")
+	checkValue(t, db, "a", "2")
+	if _, err := db.Get([]byte("b")); !IsNotFound(err) {
+		t.Error("deleted key exists after restart:", err)
+	}
+
+	// Enough writes for a snapshot, which replaces the older segments.
+
+	for i := 0; i < objectStoreSnapshotSegments; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key%d", i)), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := store.count(objectStoreSnapshotPrefix); n != 1 {
+		t.Errorf("%d snapshots, expected 1", n)
+	}
+	// The two segments from before the restart count, so the last two
+	// are after the snapshot.
+	if n := store.count(objectStoreWALPrefix); n != 2 {
+		t.Errorf("%d write ahead log segments after snapshot, expected 2", n)
+	}
+	if err := db.Put([]byte("c"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestObjectStore(t, store, "")
+	defer db.Close()
+	checkValue(t, db, "a", "2")
+	checkValue(t, db, "c", "3")
+	for i := 0; i < objectStoreSnapshotSegments; i++ {
+		checkValue(t, db, fmt.Sprintf("key%d", i), "x")
+	}
+}
+
+func TestObjectStoreErrors(t *testing.T) {
+	store := newMemObjectStore()
+	db := openTestObjectStore(t, store, "")
+
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing to upload makes the database read only, without losing
+	// anything.
+
+	store.setFail(true)
+	if err := db.flush(); err == nil {
+		t.Fatal("unexpected nil error flushing to failing store")
+	}
+	if err := db.Put([]byte("b"), []byte("2")); !IsReadOnly(err) {
+		t.Fatal("expected read only error, got", err)
+	}
+	if err := CheckWritable(db); !IsReadOnly(err) {
+		t.Fatal("expected read only error checking writability, got", err)
+	}
+	tx, err := db.NewWriteTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Put([]byte("b"), []byte("2"))
+	if err := tx.Commit(); !IsReadOnly(err) {
+		t.Fatal("expected read only error on commit, got", err)
+	}
+	checkValue(t, db, "a", "1")
+
+	// Once the store is back, so are writes.
+
+	store.setFail(false)
+	if err := db.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritable(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestObjectStore(t, store, "")
+	checkValue(t, db, "a", "1")
+	checkValue(t, db, "b", "2")
+	db.Close()
+
+	// Opening without the store fails, unless there is a local copy.
+
+	store.setFail(true)
+	if _, err := OpenObjectStore(store, "", TuningAuto); err == nil {
+		t.Fatal("unexpected nil error opening unreachable store without local copy")
+	}
+
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+
+	store.setFail(false)
+	db = openTestObjectStore(t, store, cacheDir)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store.setFail(true)
+	db = openTestObjectStore(t, store, cacheDir)
+	defer db.Close()
+	checkValue(t, db, "a", "1")
+	checkValue(t, db, "b", "2")
+	if err := db.Put([]byte("c"), []byte("3")); !IsReadOnly(err) {
+		t.Fatal("expected read only error, got", err)
+	}
+
+	// Even when the store is back, the local copy may be outdated.
+	store.setFail(false)
+	if err := db.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("c"), []byte("3")); !IsReadOnly(err) {
+		t.Fatal("expected read only error, got", err)
+	}
+}
+
+func TestObjectStoreUncleanClose(t *testing.T) {
+	store := newMemObjectStore()
+	db := openTestObjectStore(t, store, "")
+	if db.closedUncleanly() {
+		t.Error("new database closed uncleanly")
+	}
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestObjectStore(t, store, "")
+	if db.closedUncleanly() {
+		t.Error("database closed uncleanly after proper close")
+	}
+	if err := db.Put([]byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("c"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash, losing the last write.
+	close(db.stop)
+	<-db.stopped
+	db.leveldbBackend.Close()
+
+	db = openTestObjectStore(t, store, "")
+	defer db.Close()
+	if !ClosedUncleanly(db) {
+		t.Error("database closed cleanly after crash")
+	}
+	checkValue(t, db, "b", "2")
+	if _, err := db.Get([]byte("c")); !IsNotFound(err) {
+		t.Error("write after the last upload survived a crash:", err)
+	}
+}
@@ -7,6 +7,11 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/syncthing/syncthing/lib/db/backend"
@@ -213,7 +218,7 @@ func TestUpdate0to3(t *testing.T) {
 		haveUpdate0to3[remoteDevice1][0].Name: haveUpdate0to3[remoteDevice1][0],
 		haveUpdate0to3[remoteDevice0][2].Name: haveUpdate0to3[remoteDevice0][2],
 	}
-	_ = db.withNeed(folder, protocol.LocalDeviceID[:], false, func(fi FileIntf) bool {
+	_ = db.withNeed(folder, protocol.LocalDeviceID[:], false, nil, func(fi FileIntf) bool {
 		e, ok := need[fi.FileName()]
 		if !ok {
 			t.Error("Got unexpected needed file:", fi.FileName())
@@ -253,3 +258,237 @@ func TestDowngrade(t *testing.T) {
 		t.Fatalf("Error has %v as min Syncthing version, expected %v", err.minSyncthingVersion, dbMinSyncthingVersion)
 	}
 }
+
+func TestUpdateBatchCrashConsistency(t *testing.T) {
+	// The second commit of the batch fails, like when crashing while
+	// writing it. The database must contain exactly the first batch,
+	// with matching metadata.
+
+	cb := &countingBackend{Backend: backend.OpenMemory()}
+	db := NewLowlevel(cb)
+	defer db.Close()
+
+	const folder = "test"
+	s := NewFileSet(folder, fs.NewFilesystem(fs.FilesystemTypeBasic, "."), db)
+	cb.failCommit = cb.commits + 2
+
+	var committed int
+	batch := s.NewUpdateBatch(func(fs []protocol.FileInfo) {
+		committed += len(fs)
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected failing commit to panic")
+			}
+		}()
+		for i := 0; i < updateBatchMaxFiles+10; i++ {
+			batch.Update(protocol.FileInfo{
+				Name:    fmt.Sprintf("file%d", i),
+				Version: protocol.Vector{}.Update(myID),
+				Blocks:  genBlocks(1),
+			})
+		}
+		batch.Commit()
+	}()
+	if committed != updateBatchMaxFiles {
+		t.Fatalf("committed %d files, expected %d", committed, updateBatchMaxFiles)
+	}
+
+	// Start over from the database, like after a restart.
+	s = NewFileSet(folder, fs.NewFilesystem(fs.FilesystemTypeBasic, "."), db)
+
+	have := 0
+	s.WithHaveTruncated(protocol.LocalDeviceID, func(fi FileIntf) bool {
+		have++
+		return true
+	})
+	if have != updateBatchMaxFiles {
+		t.Errorf("have %d files in db, expected %d", have, updateBatchMaxFiles)
+	}
+	if _, ok := s.Get(protocol.LocalDeviceID, fmt.Sprintf("file%d", updateBatchMaxFiles)); ok {
+		t.Error("file from the failed batch is in the db")
+	}
+	if files := s.LocalSize().Files; files != updateBatchMaxFiles {
+		t.Errorf("metadata counts %d files, expected %d", files, updateBatchMaxFiles)
+	}
+	if seq := s.Sequence(protocol.LocalDeviceID); seq != updateBatchMaxFiles {
+		t.Errorf("sequence is %d, expected %d", seq, updateBatchMaxFiles)
+	}
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	// A snapshot taken while the folder is being updated can be opened as
+	// a database of its own, with consistent metadata, and the updates
+	// aren't held up by it.
+
+	dir, err := ioutil.TempDir("", "syncthing-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewLowlevel(backend.OpenMemory())
+	defer db.Close()
+
+	const folder = "test"
+	s := NewFileSet(folder, fs.NewFilesystem(fs.FilesystemTypeBasic, "."), db)
+	const numFiles = 1000
+	for i := 0; i < numFiles; i++ {
+		s.Update(protocol.LocalDeviceID, []protocol.FileInfo{{
+			Name:    fmt.Sprintf("file%d", i),
+			Version: protocol.Vector{}.Update(myID),
+			Blocks:  genBlocks(1),
+		}})
+	}
+
+	stop := make(chan struct{})
+	updated := make(chan int)
+	go func() {
+		n := 0
+		defer func() { updated <- n }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			s.Update(protocol.LocalDeviceID, []protocol.FileInfo{{
+				Name:    fmt.Sprintf("new%d", n),
+				Version: protocol.Vector{}.Update(myID),
+				Blocks:  genBlocks(1),
+			}})
+			n++
+		}
+	}()
+
+	location := filepath.Join(dir, "index")
+	err = db.WriteSnapshot(location)
+	close(stop)
+	n := <-updated
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("no updates while writing the snapshot")
+	}
+	if files := int(s.LocalSize().Files); files != numFiles+n {
+		t.Errorf("have %d files after the snapshot, expected %d", files, numFiles+n)
+	}
+
+	bdb, err := backend.Open(location, backend.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb := NewLowlevel(bdb)
+	defer sdb.Close()
+	ss := NewFileSet(folder, fs.NewFilesystem(fs.FilesystemTypeBasic, "."), sdb)
+
+	have := 0
+	ss.WithHaveTruncated(protocol.LocalDeviceID, func(fi FileIntf) bool {
+		have++
+		return true
+	})
+	if have < numFiles || have > numFiles+n {
+		t.Errorf("have %d files in the snapshot, expected %d to %d", have, numFiles, numFiles+n)
+	}
+	if files := int(ss.LocalSize().Files); files != have {
+		t.Errorf("metadata counts %d files in the snapshot, expected %d", files, have)
+	}
+	if seq := ss.Sequence(protocol.LocalDeviceID); seq != int64(have) {
+		t.Errorf("sequence is %d in the snapshot, expected %d", seq, have)
+	}
+}
+
+func BenchmarkScanUpdates(b *testing.B) {
+	// A scan of a large folder, committing the files to the database in
+	// chunks of 1000 as scanning used to, or with an UpdateBatch.
+
+	const numFiles = 50000
+	const chunk = 1000
+	files := make([]protocol.FileInfo, numFiles)
+	for i := range files {
+		files[i] = protocol.FileInfo{
+			Name:    fmt.Sprintf("dir%d/file%d", i/100, i),
+			Version: protocol.Vector{}.Update(myID),
+			Blocks:  genBlocks(1),
+		}
+	}
+
+	run := func(b *testing.B, update func(s *FileSet)) {
+		b.ReportAllocs()
+		var writes int
+		for i := 0; i < b.N; i++ {
+			cb := &countingBackend{Backend: backend.OpenMemory()}
+			db := NewLowlevel(cb)
+			s := NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), db)
+			cb.writes = 0
+			update(s)
+			writes = cb.writes
+			db.Close()
+		}
+		b.Logf("%d files, %d database writes", numFiles, writes)
+	}
+
+	b.Run("Update", func(b *testing.B) {
+		run(b, func(s *FileSet) {
+			for i := 0; i < len(files); i += chunk {
+				s.Update(protocol.LocalDeviceID, files[i:i+chunk])
+			}
+		})
+	})
+
+	b.Run("UpdateBatch", func(b *testing.B) {
+		run(b, func(s *FileSet) {
+			batch := s.NewUpdateBatch(nil)
+			for _, f := range files {
+				batch.Update(f)
+			}
+			batch.Commit()
+		})
+	})
+}
+
+// countingBackend counts the writes to the database: commits of write
+// transactions as well as direct puts and deletes. Checkpoints, which
+// write only once the transaction is large enough, aren't counted.
+// Optionally the n:th commit fails.
+type countingBackend struct {
+	backend.Backend
+	writes     int
+	commits    int
+	failCommit int
+}
+
+func (b *countingBackend) NewWriteTransaction() (backend.WriteTransaction, error) {
+	t, err := b.Backend.NewWriteTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &countingTransaction{WriteTransaction: t, b: b}, nil
+}
+
+func (b *countingBackend) Put(key, val []byte) error {
+	b.writes++
+	return b.Backend.Put(key, val)
+}
+
+func (b *countingBackend) Delete(key []byte) error {
+	b.writes++
+	return b.Backend.Delete(key)
+}
+
+type countingTransaction struct {
+	backend.WriteTransaction
+	b *countingBackend
+}
+
+func (t *countingTransaction) Commit() error {
+	t.b.writes++
+	t.b.commits++
+	if t.b.commits == t.b.failCommit {
+		t.WriteTransaction.Release()
+		return errors.New("failing commit")
+	}
+	return t.WriteTransaction.Commit()
+}
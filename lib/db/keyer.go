@@ -59,6 +59,9 @@ const (
 
 	// KeyTypeNeed <int32 folder ID> <file name> = <nothing>
 	KeyTypeNeed = 12
+
+	// KeyTypeVersionHistory <int32 folder ID> <file name> = versionHistory
+	KeyTypeVersionHistory = 13
 )
 
 type keyer interface {
@@ -93,6 +96,9 @@ type keyer interface {
 
 	// Folder metadata
 	GenerateFolderMetaKey(key, folder []byte) (folderMetaKey, error)
+
+	// Version history
+	GenerateVersionHistoryKey(key, folder, name []byte) (versionHistoryKey, error)
 }
 
 // defaultKeyer implements our key scheme. It needs folder and device
@@ -281,6 +287,24 @@ func (k defaultKeyer) GenerateFolderMetaKey(key, folder []byte) (folderMetaKey,
 	return key, nil
 }
 
+type versionHistoryKey []byte
+
+func (k versionHistoryKey) WithoutName() []byte {
+	return k[:keyPrefixLen+keyFolderLen]
+}
+
+func (k defaultKeyer) GenerateVersionHistoryKey(key, folder, name []byte) (versionHistoryKey, error) {
+	folderID, err := k.folderIdx.ID(folder)
+	if err != nil {
+		return nil, err
+	}
+	key = resize(key, keyPrefixLen+keyFolderLen+len(name))
+	key[0] = KeyTypeVersionHistory
+	binary.BigEndian.PutUint32(key[keyPrefixLen:], folderID)
+	copy(key[keyPrefixLen+keyFolderLen:], name)
+	return key, nil
+}
+
 // resize returns a byte slice of the specified size, reusing bs if possible
 func resize(bs []byte, size int) []byte {
 	if cap(bs) < size {
@@ -41,6 +41,47 @@ func (db *Lowlevel) ListFolders() []string {
 	return db.folderIdx.Values()
 }
 
+// IsOpen returns whether the database can still be read from, i.e. it
+// hasn't been closed.
+func (db *Lowlevel) IsOpen() bool {
+	t, err := db.NewReadTransaction()
+	if err != nil {
+		return false
+	}
+	t.Release()
+	return true
+}
+
+// WriteSnapshot writes a consistent copy of the database to a new database
+// at location, while updates to this one continue.
+func (db *Lowlevel) WriteSnapshot(location string) error {
+	snap, err := db.NewReadTransaction()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	dst, err := backend.Open(location, backend.TuningSmall)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := backend.Copy(dst, snap); err != nil {
+		return err
+	}
+
+	// The folder metadata is written after the files it counts, so the
+	// snapshot may have caught it in between. It is recalculated when the
+	// copy is opened instead.
+	cp := NewLowlevel(dst)
+	for _, folder := range cp.ListFolders() {
+		if err := cp.dropFolderMeta([]byte(folder)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // updateRemoteFiles adds a list of fileinfos to the database and updates the
 // global versionlist and metadata.
 func (db *Lowlevel) updateRemoteFiles(folder, device []byte, fs []protocol.FileInfo, meta *metadataTracker) error {
@@ -103,6 +144,34 @@ func (db *Lowlevel) updateLocalFiles(folder []byte, fs []protocol.FileInfo, meta
 	}
 	defer t.close()
 
+	if err := db.updateLocalFilesInTransaction(t, folder, fs, meta, true); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+// updateLocalFilesAtomic is like updateLocalFiles, except that the files
+// and the folder metadata are written together in a single transaction,
+// without intermediate checkpoints. Either all of it ends up in the
+// database or nothing.
+func (db *Lowlevel) updateLocalFilesAtomic(folder []byte, fs []protocol.FileInfo, meta *metadataTracker) error {
+	t, err := db.newReadWriteTransaction()
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	if err := db.updateLocalFilesInTransaction(t, folder, fs, meta, false); err != nil {
+		return err
+	}
+	if err := meta.toWriter(t, db.keyer, folder); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+func (db *Lowlevel) updateLocalFilesInTransaction(t readWriteTransaction, folder []byte, fs []protocol.FileInfo, meta *metadataTracker, checkpoint bool) error {
+	var err error
 	var dk, gk, keyBuf []byte
 	blockBuf := make([]byte, 4)
 	for _, f := range fs {
@@ -186,12 +255,15 @@ func (db *Lowlevel) updateLocalFiles(folder []byte, fs []protocol.FileInfo, meta
 			}
 		}
 
+		if !checkpoint {
+			continue
+		}
 		if err := t.Checkpoint(); err != nil {
 			return err
 		}
 	}
 
-	return t.commit()
+	return nil
 }
 
 func (db *Lowlevel) withHave(folder, device, prefix []byte, truncate bool, fn Iterator) error {
@@ -476,9 +548,12 @@ func (db *Lowlevel) availability(folder, file []byte) ([]protocol.DeviceID, erro
 	return devices, nil
 }
 
-func (db *Lowlevel) withNeed(folder, device []byte, truncate bool, fn Iterator) error {
+// withNeed iterates the files needed by the device. If filter is non-nil,
+// only files with names passing it are considered, which is cheaper than
+// filtering in fn as the rejected files are never loaded.
+func (db *Lowlevel) withNeed(folder, device []byte, truncate bool, filter func(name []byte) bool, fn Iterator) error {
 	if bytes.Equal(device, protocol.LocalDeviceID[:]) {
-		return db.withNeedLocal(folder, truncate, fn)
+		return db.withNeedLocal(folder, truncate, filter, fn)
 	}
 
 	t, err := db.newReadOnlyTransaction()
@@ -505,6 +580,11 @@ func (db *Lowlevel) withNeed(folder, device []byte, truncate bool, fn Iterator)
 			continue
 		}
 
+		name := db.keyer.NameFromGlobalVersionKey(dbi.Key())
+		if filter != nil && !filter(name) {
+			continue
+		}
+
 		haveFV, have := vl.Get(device)
 		// XXX: This marks Concurrent (i.e. conflicting) changes as
 		// needs. Maybe we should do that, but it needs special
@@ -513,7 +593,6 @@ func (db *Lowlevel) withNeed(folder, device []byte, truncate bool, fn Iterator)
 			continue
 		}
 
-		name := db.keyer.NameFromGlobalVersionKey(dbi.Key())
 		needVersion := vl.Versions[0].Version
 		needDevice := protocol.DeviceIDFromBytes(vl.Versions[0].Device)
 
@@ -558,7 +637,7 @@ func (db *Lowlevel) withNeed(folder, device []byte, truncate bool, fn Iterator)
 	return dbi.Error()
 }
 
-func (db *Lowlevel) withNeedLocal(folder []byte, truncate bool, fn Iterator) error {
+func (db *Lowlevel) withNeedLocal(folder []byte, truncate bool, filter func(name []byte) bool, fn Iterator) error {
 	t, err := db.newReadOnlyTransaction()
 	if err != nil {
 		return err
@@ -579,7 +658,11 @@ func (db *Lowlevel) withNeedLocal(folder []byte, truncate bool, fn Iterator) err
 	var f FileIntf
 	var ok bool
 	for dbi.Next() {
-		keyBuf, f, ok, err = t.getGlobal(keyBuf, folder, db.keyer.NameFromGlobalVersionKey(dbi.Key()), truncate)
+		name := db.keyer.NameFromGlobalVersionKey(dbi.Key())
+		if filter != nil && !filter(name) {
+			continue
+		}
+		keyBuf, f, ok, err = t.getGlobal(keyBuf, folder, name, truncate)
 		if err != nil {
 			return err
 		}
@@ -11,6 +11,7 @@ import (
 	"math/bits"
 	"time"
 
+	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/sync"
 )
@@ -49,6 +50,16 @@ func (m *metadataTracker) Unmarshal(bs []byte) error {
 	return nil
 }
 
+// replace sets the metadata to that of other, which must not be used
+// afterwards.
+func (m *metadataTracker) replace(other *metadataTracker) {
+	m.mut.Lock()
+	m.counts = other.counts
+	m.indexes = other.indexes
+	m.dirty = false
+	m.mut.Unlock()
+}
+
 // Unmarshal returns the protobuf representation of the metadataTracker
 func (m *metadataTracker) Marshal() ([]byte, error) {
 	return m.counts.Marshal()
@@ -57,7 +68,12 @@ func (m *metadataTracker) Marshal() ([]byte, error) {
 // toDB saves the marshalled metadataTracker to the given db, under the key
 // corresponding to the given folder
 func (m *metadataTracker) toDB(db *Lowlevel, folder []byte) error {
-	key, err := db.keyer.GenerateFolderMetaKey(nil, folder)
+	return m.toWriter(db, db.keyer, folder)
+}
+
+// toWriter is like toDB, but writes to any writer, e.g. a transaction.
+func (m *metadataTracker) toWriter(w backend.Writer, keyer keyer, folder []byte) error {
+	key, err := keyer.GenerateFolderMetaKey(nil, folder)
 	if err != nil {
 		return err
 	}
@@ -73,7 +89,7 @@ func (m *metadataTracker) toDB(db *Lowlevel, folder []byte) error {
 	if err != nil {
 		return err
 	}
-	err = db.Put(key, bs)
+	err = w.Put(key, bs)
 	if err == nil {
 		m.dirty = false
 	}
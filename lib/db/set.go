@@ -30,6 +30,8 @@ type FileSet struct {
 	meta   *metadataTracker
 
 	updateMutex sync.Mutex // protects database updates and the corresponding metadata changes
+
+	versionHistoryLength int // protected by updateMutex, zero when not tracked
 }
 
 // FileIntf is the set of methods implemented by both protocol.FileInfo and
@@ -83,6 +85,9 @@ func NewFileSet(folder string, fs fs.Filesystem, db *Lowlevel) *FileSet {
 		l.Infof("No stored folder metadata for %q: recalculating", folder)
 		if err := s.recalcCounts(); backend.IsClosed(err) {
 			return nil
+		} else if backend.IsReadOnly(err) {
+			// The counts are complete, just not stored.
+			l.Debugf("%s storing recalculated metadata: %v", folder, err)
 		} else if err != nil {
 			panic(err)
 		}
@@ -90,6 +95,8 @@ func NewFileSet(folder string, fs fs.Filesystem, db *Lowlevel) *FileSet {
 		l.Infof("Stored folder metadata for %q is %v old; recalculating", folder, age)
 		if err := s.recalcCounts(); backend.IsClosed(err) {
 			return nil
+		} else if backend.IsReadOnly(err) {
+			l.Debugf("%s storing recalculated metadata: %v", folder, err)
 		} else if err != nil {
 			panic(err)
 		}
@@ -101,8 +108,11 @@ func NewFileSet(folder string, fs fs.Filesystem, db *Lowlevel) *FileSet {
 func (s *FileSet) recalcCounts() error {
 	s.meta = newMetadataTracker()
 
-	if err := s.db.checkGlobals([]byte(s.folder), s.meta); err != nil {
-		return err
+	// A read only database can't be fixed, but the counts are calculated
+	// all the same.
+	checkErr := s.db.checkGlobals([]byte(s.folder), s.meta)
+	if checkErr != nil && !backend.IsReadOnly(checkErr) {
+		return checkErr
 	}
 
 	var deviceID protocol.DeviceID
@@ -116,7 +126,10 @@ func (s *FileSet) recalcCounts() error {
 	}
 
 	s.meta.SetCreated()
-	return s.meta.toDB(s.db, []byte(s.folder))
+	if err := s.meta.toDB(s.db, []byte(s.folder)); err != nil {
+		return err
+	}
+	return checkErr
 }
 
 func (s *FileSet) Drop(device protocol.DeviceID) {
@@ -127,6 +140,9 @@ func (s *FileSet) Drop(device protocol.DeviceID) {
 
 	if err := s.db.dropDeviceFolder(device[:], []byte(s.folder), s.meta); backend.IsClosed(err) {
 		return
+	} else if backend.IsReadOnly(err) {
+		s.discardMetaChanges(err)
+		return
 	} else if err != nil {
 		panic(err)
 	}
@@ -148,6 +164,9 @@ func (s *FileSet) Drop(device protocol.DeviceID) {
 
 	if err := s.meta.toDB(s.db, []byte(s.folder)); backend.IsClosed(err) {
 		return
+	} else if backend.IsReadOnly(err) {
+		s.discardMetaChanges(err)
+		return
 	} else if err != nil {
 		panic(err)
 	}
@@ -164,35 +183,178 @@ func (s *FileSet) Update(device protocol.DeviceID, fs []protocol.FileInfo) {
 	s.updateMutex.Lock()
 	defer s.updateMutex.Unlock()
 
-	defer func() {
-		if err := s.meta.toDB(s.db, []byte(s.folder)); err != nil && !backend.IsClosed(err) {
-			panic(err)
-		}
-	}()
-
+	var err error
 	if device == protocol.LocalDeviceID {
 		// For the local device we have a bunch of metadata to track.
-		if err := s.db.updateLocalFiles([]byte(s.folder), fs, s.meta); err != nil && !backend.IsClosed(err) {
-			panic(err)
-		}
+		err = s.db.updateLocalFiles([]byte(s.folder), fs, s.meta)
+	} else {
+		// Easy case, just update the files.
+		err = s.db.updateRemoteFiles([]byte(s.folder), device[:], fs, s.meta)
+	}
+	if err == nil {
+		err = s.meta.toDB(s.db, []byte(s.folder))
+	}
+	if backend.IsClosed(err) {
 		return
+	} else if backend.IsReadOnly(err) {
+		s.discardMetaChanges(err)
+		return
+	} else if err != nil {
+		panic(err)
 	}
-	// Easy case, just update the files and we're done.
-	if err := s.db.updateRemoteFiles([]byte(s.folder), device[:], fs, s.meta); err != nil && !backend.IsClosed(err) {
+	s.recordVersionHistory(device, fs)
+}
+
+// discardMetaChanges reloads the metadata from the database, after an
+// update that may already be accounted for in it failed because the
+// database is read only. The update is lost; the folder is stopped while
+// the database is read only and picks it up again afterwards. Must be
+// called with the updateMutex held.
+func (s *FileSet) discardMetaChanges(err error) {
+	l.Debugf("%s discarding update: %v", s.folder, err)
+	meta := newMetadataTracker()
+	if err := meta.fromDB(s.db, []byte(s.folder)); err != nil {
+		l.Debugf("%s reloading metadata: %v", s.folder, err)
+		return
+	}
+	s.meta.replace(meta)
+}
+
+// TrackVersionHistory makes the set record the latest changes of the
+// version of each file, up to length of them per file. Zero stops the
+// recording and drops what was recorded.
+func (s *FileSet) TrackVersionHistory(length int) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.versionHistoryLength = length
+	if length > 0 {
+		return
+	}
+	if err := s.db.dropVersionHistory([]byte(s.folder)); backend.IsReadOnly(err) {
+		l.Warnf("Failed to remove the version history of folder %q from the database: %v", s.folder, err)
+	} else if err != nil && !backend.IsClosed(err) {
 		panic(err)
 	}
 }
 
+// VersionHistory returns the recorded changes of the version of the file,
+// oldest first.
+func (s *FileSet) VersionHistory(file string) []VersionEvent {
+	hist, err := s.db.versionHistory([]byte(s.folder), []byte(osutil.NormalizedFilename(file)))
+	if backend.IsClosed(err) {
+		return nil
+	} else if err != nil {
+		panic(err)
+	}
+	return hist
+}
+
+// recordVersionHistory must be called with the updateMutex held.
+func (s *FileSet) recordVersionHistory(device protocol.DeviceID, fs []protocol.FileInfo) {
+	if s.versionHistoryLength == 0 {
+		return
+	}
+	if err := s.db.recordVersionHistory([]byte(s.folder), device[:], fs, s.versionHistoryLength); backend.IsReadOnly(err) {
+		l.Debugf("%s recording version history: %v", s.folder, err)
+	} else if err != nil && !backend.IsClosed(err) {
+		panic(err)
+	}
+}
+
+const (
+	// An UpdateBatch is committed to the database when it reaches either
+	// of these limits.
+	updateBatchMaxFiles = 10000
+	updateBatchMaxBytes = 16 << 20 // 16 MiB
+)
+
+// An UpdateBatch collects updates to local files and commits them to the
+// database in large, atomic writes, instead of one or more writes per
+// update. Each commit writes the files together with the folder metadata,
+// so an interruption at any point leaves the database consistent, holding
+// exactly the batches that were committed before it.
+type UpdateBatch struct {
+	set       *FileSet
+	files     []protocol.FileInfo
+	size      int
+	committed func([]protocol.FileInfo)
+}
+
+// NewUpdateBatch returns a batch of local file updates. The committed
+// function, if not nil, is called with the files after each commit to the
+// database.
+func (s *FileSet) NewUpdateBatch(committed func([]protocol.FileInfo)) *UpdateBatch {
+	return &UpdateBatch{
+		set:       s,
+		files:     make([]protocol.FileInfo, 0, updateBatchMaxFiles),
+		committed: committed,
+	}
+}
+
+// Update adds the file to the batch, committing the batch if it's full.
+func (b *UpdateBatch) Update(f protocol.FileInfo) {
+	b.files = append(b.files, f)
+	b.size += f.ProtoSize()
+	if len(b.files) >= updateBatchMaxFiles || b.size >= updateBatchMaxBytes {
+		b.Commit()
+	}
+}
+
+// Commit writes the updates in the batch to the database.
+func (b *UpdateBatch) Commit() {
+	if len(b.files) == 0 {
+		return
+	}
+	fs := b.files
+	b.files = make([]protocol.FileInfo, 0, updateBatchMaxFiles)
+	b.size = 0
+
+	s := b.set
+	l.Debugf("%s UpdateBatch.Commit([%d])", s.folder, len(fs))
+	normalizeFilenames(fs)
+
+	s.updateMutex.Lock()
+	err := s.db.updateLocalFilesAtomic([]byte(s.folder), fs, s.meta)
+	if err == nil {
+		s.recordVersionHistory(protocol.LocalDeviceID, fs)
+	} else if backend.IsReadOnly(err) {
+		s.discardMetaChanges(err)
+	}
+	s.updateMutex.Unlock()
+	if backend.IsClosed(err) || backend.IsReadOnly(err) {
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	if b.committed != nil {
+		b.committed(fs)
+	}
+}
+
 func (s *FileSet) WithNeed(device protocol.DeviceID, fn Iterator) {
 	l.Debugf("%s WithNeed(%v)", s.folder, device)
-	if err := s.db.withNeed([]byte(s.folder), device[:], false, nativeFileIterator(fn)); err != nil && !backend.IsClosed(err) {
+	if err := s.db.withNeed([]byte(s.folder), device[:], false, nil, nativeFileIterator(fn)); err != nil && !backend.IsClosed(err) {
 		panic(err)
 	}
 }
 
 func (s *FileSet) WithNeedTruncated(device protocol.DeviceID, fn Iterator) {
 	l.Debugf("%s WithNeedTruncated(%v)", s.folder, device)
-	if err := s.db.withNeed([]byte(s.folder), device[:], true, nativeFileIterator(fn)); err != nil && !backend.IsClosed(err) {
+	if err := s.db.withNeed([]byte(s.folder), device[:], true, nil, nativeFileIterator(fn)); err != nil && !backend.IsClosed(err) {
+		panic(err)
+	}
+}
+
+// WithFilteredNeedTruncated is like WithNeedTruncated, but only iterates
+// the needed files whose names pass the filter. Files are filtered before
+// being loaded from the database.
+func (s *FileSet) WithFilteredNeedTruncated(device protocol.DeviceID, filter func(name string) bool, fn Iterator) {
+	l.Debugf("%s WithFilteredNeedTruncated(%v)", s.folder, device)
+	nameFilter := func(name []byte) bool {
+		return filter(osutil.NativeFilename(string(name)))
+	}
+	if err := s.db.withNeed([]byte(s.folder), device[:], true, nameFilter, nativeFileIterator(fn)); err != nil && !backend.IsClosed(err) {
 		panic(err)
 	}
 }
@@ -332,7 +494,9 @@ func (s *FileSet) IndexID(device protocol.DeviceID) protocol.IndexID {
 		// No index ID set yet. We create one now.
 		id = protocol.NewIndexID()
 		err := s.db.setIndexID(device[:], []byte(s.folder), id)
-		if backend.IsClosed(err) {
+		if backend.IsClosed(err) || backend.IsReadOnly(err) {
+			// Without a stored index ID, other devices get our full
+			// index.
 			return 0
 		} else if err != nil {
 			panic(err)
@@ -345,7 +509,10 @@ func (s *FileSet) SetIndexID(device protocol.DeviceID, id protocol.IndexID) {
 	if device == protocol.LocalDeviceID {
 		panic("do not explicitly set index ID for local device")
 	}
-	if err := s.db.setIndexID(device[:], []byte(s.folder), id); err != nil && !backend.IsClosed(err) {
+	if err := s.db.setIndexID(device[:], []byte(s.folder), id); backend.IsReadOnly(err) {
+		// We'll get the full index again on the next connection.
+		l.Debugf("%s setting index ID of %v: %v", s.folder, device, err)
+	} else if err != nil && !backend.IsClosed(err) {
 		panic(err)
 	}
 }
@@ -372,11 +539,15 @@ func DropFolder(db *Lowlevel, folder string) {
 		db.dropFolder,
 		db.dropMtimes,
 		db.dropFolderMeta,
+		db.dropVersionHistory,
 		db.folderIdx.Delete,
 	}
 	for _, drop := range droppers {
 		if err := drop([]byte(folder)); backend.IsClosed(err) {
 			return
+		} else if backend.IsReadOnly(err) {
+			l.Warnf("Failed to remove folder %q from the database: %v", folder, err)
+			return
 		} else if err != nil {
 			panic(err)
 		}
@@ -394,7 +565,10 @@ func DropDeltaIndexIDs(db *Lowlevel) {
 	}
 	defer dbi.Release()
 	for dbi.Next() {
-		if err := db.Delete(dbi.Key()); err != nil && !backend.IsClosed(err) {
+		if err := db.Delete(dbi.Key()); backend.IsReadOnly(err) {
+			l.Warnln("Failed to drop delta index IDs from the database:", err)
+			return
+		} else if err != nil && !backend.IsClosed(err) {
 			panic(err)
 		}
 	}
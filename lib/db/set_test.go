@@ -8,7 +8,9 @@ package db_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -1458,7 +1460,138 @@ func TestIgnoreAfterReceiveOnly(t *testing.T) {
 	}
 }
 
+func TestVersionHistory(t *testing.T) {
+	ldb := db.NewLowlevel(backend.OpenMemory())
+	defer ldb.Close()
+
+	const file = "foo"
+	s := db.NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), ldb)
+
+	v1 := protocol.Vector{}.Update(myID)
+	s.Update(protocol.LocalDeviceID, fileList{{Name: file, Version: v1, ModifiedBy: myID}})
+	if hist := s.VersionHistory(file); len(hist) != 0 {
+		t.Fatalf("Recorded %d version events without tracking", len(hist))
+	}
+
+	s.TrackVersionHistory(3)
+	s.Update(protocol.LocalDeviceID, fileList{{Name: file, Version: v1, ModifiedBy: myID}})
+	// The same version from another device is not a change.
+	s.Update(remoteDevice0, fileList{{Name: file, Version: v1, ModifiedBy: myID}})
+	v2 := v1.Copy().Update(remoteDevice0.Short())
+	s.Update(remoteDevice0, fileList{{Name: file, Version: v2, ModifiedBy: remoteDevice0.Short()}})
+	s.Update(protocol.LocalDeviceID, fileList{{Name: file, Version: v2, ModifiedBy: remoteDevice0.Short()}})
+	v3 := v2.Copy().Update(myID)
+	s.Update(protocol.LocalDeviceID, fileList{{Name: file, Version: v3, ModifiedBy: myID}})
+	// An outdated version isn't a change either.
+	s.Update(remoteDevice1, fileList{{Name: file, Version: v1, ModifiedBy: myID}})
+	v4 := v3.Copy().Update(myID)
+	batch := s.NewUpdateBatch(nil)
+	batch.Update(protocol.FileInfo{Name: file, Version: v4, ModifiedBy: myID, Deleted: true})
+	batch.Commit()
+
+	// The oldest event falls out of the bounded history.
+	expected := []struct {
+		version    protocol.Vector
+		modifiedBy protocol.ShortID
+		device     protocol.DeviceID
+		deleted    bool
+	}{
+		{v2, remoteDevice0.Short(), remoteDevice0, false},
+		{v3, myID, protocol.LocalDeviceID, false},
+		{v4, myID, protocol.LocalDeviceID, true},
+	}
+	hist := s.VersionHistory(file)
+	if len(hist) != len(expected) {
+		t.Fatalf("Got %d version events, expected %d: %v", len(hist), len(expected), hist)
+	}
+	for i, ev := range hist {
+		exp := expected[i]
+		if !ev.Version.Equal(exp.version) || ev.ModifiedBy != exp.modifiedBy || ev.Device != exp.device || ev.Deleted != exp.deleted {
+			t.Errorf("Event %d is %+v, expected %+v", i, ev, exp)
+		}
+		if ev.Time.IsZero() || i > 0 && ev.Time.Before(hist[i-1].Time) {
+			t.Errorf("Event %d has unexpected time %v", i, ev.Time)
+		}
+	}
+
+	// The history is kept in the database until the folder is dropped.
+	s = db.NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), ldb)
+	if hist := s.VersionHistory(file); len(hist) != len(expected) {
+		t.Errorf("Got %d version events from the database, expected %d", len(hist), len(expected))
+	}
+	db.DropFolder(ldb, "test")
+	s = db.NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), ldb)
+	if hist := s.VersionHistory(file); len(hist) != 0 {
+		t.Errorf("Got %d version events after dropping the folder", len(hist))
+	}
+}
+
 func replace(fs *db.FileSet, device protocol.DeviceID, files []protocol.FileInfo) {
 	fs.Drop(device)
 	fs.Update(device, files)
 }
+
+// unreachableStore is an object store that can't be reached.
+type unreachableStore struct{}
+
+func (unreachableStore) List(string) ([]string, error) { return nil, errors.New("unreachable") }
+func (unreachableStore) Get(string) ([]byte, error)    { return nil, errors.New("unreachable") }
+func (unreachableStore) Put(string, []byte) error      { return errors.New("unreachable") }
+func (unreachableStore) Delete(string) error           { return errors.New("unreachable") }
+
+func TestUpdateReadOnly(t *testing.T) {
+	// Updates are discarded, without panicking or changing the counts, when
+	// the database can't be written to.
+
+	dir, err := ioutil.TempDir("", "syncthing-readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The local copy of a database persisted to an object store.
+	bdb, err := backend.Open(dir, backend.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldb := db.NewLowlevel(bdb)
+	s := db.NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), ldb)
+	s.Update(protocol.LocalDeviceID, fileList{{Name: "a", Version: protocol.Vector{}.Update(myID), Blocks: genBlocks(1)}})
+	s.Update(remoteDevice0, fileList{{Name: "b", Version: protocol.Vector{}.Update(remoteDevice0.Short()), Blocks: genBlocks(2)}})
+	ldb.Close()
+
+	// The object store is unreachable, so the local copy is opened read
+	// only.
+	bdb, err = backend.OpenObjectStore(unreachableStore{}, dir, backend.TuningAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldb = db.NewLowlevel(bdb)
+	defer ldb.Close()
+	s = db.NewFileSet("test", fs.NewFilesystem(fs.FilesystemTypeBasic, "."), ldb)
+	local, global := s.LocalSize(), s.GlobalSize()
+
+	if err := backend.CheckWritable(bdb); !backend.IsReadOnly(err) {
+		t.Fatal("Expected read only database, got", err)
+	}
+
+	files := fileList{{Name: "c", Version: protocol.Vector{}.Update(myID), Blocks: genBlocks(3)}}
+	s.Update(protocol.LocalDeviceID, files)
+	s.Update(remoteDevice1, files)
+	s.Drop(remoteDevice0)
+	batch := s.NewUpdateBatch(func([]protocol.FileInfo) {
+		t.Error("Unexpected commit")
+	})
+	batch.Update(files[0])
+	batch.Commit()
+
+	if got := s.LocalSize(); got.Files != local.Files || got.Bytes != local.Bytes {
+		t.Errorf("Local size changed from %+v to %+v", local, s.LocalSize())
+	}
+	if got := s.GlobalSize(); got.Files != global.Files || got.Bytes != global.Bytes {
+		t.Errorf("Global size changed from %+v to %+v", global, s.GlobalSize())
+	}
+	if _, ok := s.Get(remoteDevice0, "b"); !ok {
+		t.Error("File of dropped device is gone")
+	}
+}
@@ -140,6 +140,28 @@ func (f FileInfoTruncated) ConvertToIgnoredFileInfo(by protocol.ShortID) protoco
 	}
 }
 
+// ConvertToBlocklessFileInfo returns the FileInfo, which lacks only the
+// blocks.
+func (f FileInfoTruncated) ConvertToBlocklessFileInfo() protocol.FileInfo {
+	return protocol.FileInfo{
+		Name:          f.Name,
+		Size:          f.Size,
+		ModifiedS:     f.ModifiedS,
+		ModifiedBy:    f.ModifiedBy,
+		Version:       f.Version,
+		Sequence:      f.Sequence,
+		SymlinkTarget: f.SymlinkTarget,
+		Type:          f.Type,
+		Permissions:   f.Permissions,
+		ModifiedNs:    f.ModifiedNs,
+		RawBlockSize:  f.RawBlockSize,
+		LocalFlags:    f.LocalFlags,
+		Deleted:       f.Deleted,
+		RawInvalid:    f.RawInvalid,
+		NoPermissions: f.NoPermissions,
+	}
+}
+
 func (c Counts) Add(other Counts) Counts {
 	return Counts{
 		Files:       c.Files + other.Files,
@@ -117,7 +117,7 @@ func (db *Lowlevel) newReadWriteTransaction() (readWriteTransaction, error) {
 }
 
 func (t readWriteTransaction) commit() error {
-	t.readOnlyTransaction.close()
+	// Committing releases the read side as well.
 	return t.WriteTransaction.Commit()
 }
 
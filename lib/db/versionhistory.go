@@ -0,0 +1,174 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/db/backend"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// A VersionEvent is a change of the version of a file, as recorded when
+// version history is tracked for the folder.
+type VersionEvent struct {
+	Time       time.Time         `json:"time"` // when the change was recorded
+	Version    protocol.Vector   `json:"version"`
+	ModifiedBy protocol.ShortID  `json:"modifiedBy"` // the device that made the change
+	Device     protocol.DeviceID `json:"device"`     // the device that announced the change
+	Deleted    bool              `json:"deleted"`
+}
+
+var errVersionHistoryCorrupt = errors.New("corrupt version history")
+
+// The versionHistory is our database representation of the version events
+// of a file, oldest first. Each event is the time in unix nanos, the short
+// and announcing device IDs, the deleted flag and the length prefixed
+// marshalled version.
+type versionHistory []VersionEvent
+
+const versionEventFixedLen = 8 + 8 + protocol.DeviceIDLength + 1 + 4
+
+func (h versionHistory) Marshal() ([]byte, error) {
+	var bs []byte
+	for _, ev := range h {
+		ver, err := ev.Version.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		var buf [versionEventFixedLen]byte
+		binary.BigEndian.PutUint64(buf[0:], uint64(ev.Time.UnixNano()))
+		binary.BigEndian.PutUint64(buf[8:], uint64(ev.ModifiedBy))
+		copy(buf[16:], ev.Device[:])
+		if ev.Deleted {
+			buf[16+protocol.DeviceIDLength] = 1
+		}
+		binary.BigEndian.PutUint32(buf[17+protocol.DeviceIDLength:], uint32(len(ver)))
+		bs = append(bs, buf[:]...)
+		bs = append(bs, ver...)
+	}
+	return bs, nil
+}
+
+func (h *versionHistory) Unmarshal(bs []byte) error {
+	*h = (*h)[:0]
+	for len(bs) > 0 {
+		if len(bs) < versionEventFixedLen {
+			return errVersionHistoryCorrupt
+		}
+		ev := VersionEvent{
+			Time:       time.Unix(0, int64(binary.BigEndian.Uint64(bs[0:]))),
+			ModifiedBy: protocol.ShortID(binary.BigEndian.Uint64(bs[8:])),
+			Deleted:    bs[16+protocol.DeviceIDLength] == 1,
+		}
+		copy(ev.Device[:], bs[16:])
+		verLen := int(binary.BigEndian.Uint32(bs[17+protocol.DeviceIDLength:]))
+		bs = bs[versionEventFixedLen:]
+		if len(bs) < verLen {
+			return errVersionHistoryCorrupt
+		}
+		if err := ev.Version.Unmarshal(bs[:verLen]); err != nil {
+			return err
+		}
+		bs = bs[verLen:]
+		*h = append(*h, ev)
+	}
+	return nil
+}
+
+// recordVersionHistory appends the versions of the files announced by the
+// device to their version history, keeping at most length events per file.
+// Versions that aren't newer than the latest recorded one, e.g. the same
+// change announced by another device, aren't recorded.
+func (db *Lowlevel) recordVersionHistory(folder, device []byte, fs []protocol.FileInfo, length int) error {
+	t, err := db.newReadWriteTransaction()
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	var deviceID protocol.DeviceID
+	copy(deviceID[:], device)
+	now := time.Now()
+
+	var key []byte
+	for _, f := range fs {
+		key, err = db.keyer.GenerateVersionHistoryKey(key, folder, []byte(f.Name))
+		if err != nil {
+			return err
+		}
+		hist, err := t.getVersionHistory(key)
+		if err != nil {
+			return err
+		}
+		if n := len(hist); n > 0 && f.Version.LesserEqual(hist[n-1].Version) {
+			continue
+		}
+
+		hist = append(hist, VersionEvent{
+			Time:       now,
+			Version:    f.Version,
+			ModifiedBy: f.ModifiedBy,
+			Device:     deviceID,
+			Deleted:    f.Deleted,
+		})
+		if len(hist) > length {
+			hist = hist[len(hist)-length:]
+		}
+		bs, err := hist.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := t.Put(key, bs); err != nil {
+			return err
+		}
+		if err := t.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return t.commit()
+}
+
+func (db *Lowlevel) versionHistory(folder, file []byte) ([]VersionEvent, error) {
+	t, err := db.newReadOnlyTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	key, err := db.keyer.GenerateVersionHistoryKey(nil, folder, file)
+	if err != nil {
+		return nil, err
+	}
+	return t.getVersionHistory(key)
+}
+
+func (t readOnlyTransaction) getVersionHistory(key []byte) (versionHistory, error) {
+	bs, err := t.Get(key)
+	if backend.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var hist versionHistory
+	if err := hist.Unmarshal(bs); err != nil {
+		// Start over rather than failing updates on a bad history.
+		l.Debugf("unmarshal version history %x: %v", key, err)
+		return nil, nil
+	}
+	return hist, nil
+}
+
+func (db *Lowlevel) dropVersionHistory(folder []byte) error {
+	key, err := db.keyer.GenerateVersionHistoryKey(nil, folder, nil)
+	if err != nil {
+		return err
+	}
+	return db.dropPrefix(key.WithoutName())
+}
@@ -0,0 +1,285 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dialer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+var (
+	errNoProxy         = errors.New("no SOCKS5 proxy configured")
+	errAlreadyAccepted = errors.New("inbound connection already accepted")
+)
+
+const (
+	socks5Version = 5
+
+	socks5AuthNone     = 0
+	socks5AuthPassword = 2
+	socks5AuthNoAccept = 0xff
+
+	socks5CmdBind = 2
+
+	socks5AtypIPv4   = 1
+	socks5AtypDomain = 3
+	socks5AtypIPv6   = 4
+)
+
+var socks5Replies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// BindViaProxy asks the SOCKS5 proxy from the environment to listen for an
+// inbound connection on our behalf. It returns the address the proxy
+// listens on, to be advertised to the remote side, and a function that
+// waits for the remote side to connect and returns the connection. It fails
+// if no SOCKS5 proxy is configured.
+func BindViaProxy(ctx context.Context) (string, func() (net.Conn, error), error) {
+	u, err := socksProxyFromEnvironment()
+	if err != nil {
+		return "", nil, err
+	}
+	var auth *proxy.Auth
+	if u.User != nil {
+		auth = new(proxy.Auth)
+		auth.User = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			auth.Password = p
+		}
+	}
+	return socks5Bind(ctx, u.Host, auth)
+}
+
+// socksProxyFromEnvironment returns the proxy URL from ALL_PROXY, if it is
+// a SOCKS5 proxy.
+func socksProxyFromEnvironment() (*url.URL, error) {
+	env := os.Getenv("ALL_PROXY")
+	if env == "" {
+		env = os.Getenv("all_proxy")
+	}
+	if env == "" {
+		return nil, errNoProxy
+	}
+	u, err := url.Parse(env)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks" && u.Scheme != "socks5" {
+		return nil, errNoProxy
+	}
+	return u, nil
+}
+
+// socks5Bind performs the BIND command against the proxy at proxyAddr. The
+// proxy sends two replies, the first with the address it listens on and the
+// second once the inbound connection is made.
+func socks5Bind(ctx context.Context, proxyAddr string, auth *proxy.Auth) (string, func() (net.Conn, error), error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Abort the handshake when the context ends.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	addr, err := socks5BindHandshake(conn, auth)
+	close(stop)
+	<-stopped
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return "", nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The proxy may not know its own external address.
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			proxyHost, _, _ := net.SplitHostPort(proxyAddr)
+			addr = net.JoinHostPort(proxyHost, port)
+		}
+	}
+	l.Debugln("Proxy listening on", addr, "for inbound connection")
+
+	var once sync.Once
+	accept := func() (net.Conn, error) {
+		err := errAlreadyAccepted
+		var remote string
+		once.Do(func() {
+			remote, err = socks5ReadReply(conn)
+			if err != nil {
+				conn.Close()
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		l.Debugln("Accepted inbound connection from", remote, "via proxy")
+		return &boundConn{conn, socks5Addr(remote)}, nil
+	}
+	return addr, accept, nil
+}
+
+// socks5BindHandshake authenticates and sends the BIND command, returning
+// the address from the first reply.
+func socks5BindHandshake(conn net.Conn, auth *proxy.Auth) (string, error) {
+	methods := []byte{socks5AuthNone}
+	if auth != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return "", err
+	}
+
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return "", err
+	}
+	if resp[0] != socks5Version {
+		return "", fmt.Errorf("unexpected SOCKS version %d", resp[0])
+	}
+	switch resp[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if auth == nil {
+			return "", errors.New("proxy requires authentication")
+		}
+		if len(auth.User) > 255 || len(auth.Password) > 255 {
+			return "", errors.New("proxy user or password too long")
+		}
+		msg := []byte{1, byte(len(auth.User))}
+		msg = append(msg, auth.User...)
+		msg = append(msg, byte(len(auth.Password)))
+		msg = append(msg, auth.Password...)
+		if _, err := conn.Write(msg); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			return "", err
+		}
+		if resp[1] != 0 {
+			return "", errors.New("proxy rejected user or password")
+		}
+	case socks5AuthNoAccept:
+		return "", errors.New("no acceptable proxy authentication method")
+	default:
+		return "", fmt.Errorf("unsupported proxy authentication method %d", resp[1])
+	}
+
+	// We don't know where the inbound connection will come from, which
+	// the unspecified address says.
+	req := []byte{socks5Version, socks5CmdBind, 0, socks5AtypIPv4, 0, 0, 0, 0, 0, 0}
+	if _, err := conn.Write(req); err != nil {
+		return "", err
+	}
+	return socks5ReadReply(conn)
+}
+
+// socks5ReadReply reads a reply to a command and returns the address in it.
+func socks5ReadReply(conn net.Conn) (string, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return "", err
+	}
+	if hdr[0] != socks5Version {
+		return "", fmt.Errorf("unexpected SOCKS version %d", hdr[0])
+	}
+	if hdr[1] != 0 {
+		if int(hdr[1]) < len(socks5Replies) {
+			return "", fmt.Errorf("proxy bind failed: %s", socks5Replies[hdr[1]])
+		}
+		return "", fmt.Errorf("proxy bind failed: unknown reply %d", hdr[1])
+	}
+
+	var host string
+	switch hdr[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if hdr[3] == socks5AtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", fmt.Errorf("unknown address type %d", hdr[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// boundConn is the connection to the proxy, relaying the inbound connection.
+type boundConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *boundConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// socks5Addr is an address reported by the proxy.
+type socks5Addr string
+
+func (a socks5Addr) Network() string {
+	return "tcp"
+}
+
+func (a socks5Addr) String() string {
+	return string(a)
+}
@@ -0,0 +1,269 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockSocks5Server struct {
+	net.Listener
+	user, password string
+	unspecified    bool // reply with the unspecified address to the bind
+	failure        byte // reply with this failure to the bind
+}
+
+func newMockSocks5Server(t *testing.T, srv *mockSocks5Server) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Listener = l
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		srv.serve(conn)
+	}()
+}
+
+func (s *mockSocks5Server) serve(conn net.Conn) error {
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return err
+	}
+	if s.user == "" {
+		if _, err := conn.Write([]byte{socks5Version, socks5AuthNone}); err != nil {
+			return err
+		}
+	} else {
+		if bytes.IndexByte(buf[:buf[1]], socks5AuthPassword) < 0 {
+			_, err := conn.Write([]byte{socks5Version, socks5AuthNoAccept})
+			return err
+		}
+		if _, err := conn.Write([]byte{socks5Version, socks5AuthPassword}); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return err
+		}
+		user := make([]byte, buf[1])
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		password := make([]byte, buf[0])
+		if _, err := io.ReadFull(conn, password); err != nil {
+			return err
+		}
+		status := byte(0)
+		if string(user) != s.user || string(password) != s.password {
+			status = 1
+		}
+		if _, err := conn.Write([]byte{1, status}); err != nil || status != 0 {
+			return err
+		}
+	}
+
+	// The bind request for an IPv4 address.
+	if _, err := io.ReadFull(conn, buf[:10]); err != nil {
+		return err
+	}
+	if buf[1] != socks5CmdBind || buf[3] != socks5AtypIPv4 {
+		_, err := conn.Write([]byte{socks5Version, 7, 0, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	if s.failure != 0 {
+		_, err := conn.Write([]byte{socks5Version, s.failure, 0, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+
+	inbound, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer inbound.Close()
+	listenAddr := inbound.Addr().(*net.TCPAddr)
+	if s.unspecified {
+		listenAddr = &net.TCPAddr{IP: net.IPv4zero, Port: listenAddr.Port}
+	}
+	if _, err := conn.Write(socks5TestReply(listenAddr)); err != nil {
+		return err
+	}
+
+	peer, err := inbound.Accept()
+	if err != nil {
+		return err
+	}
+	defer peer.Close()
+	if _, err := conn.Write(socks5TestReply(peer.RemoteAddr().(*net.TCPAddr))); err != nil {
+		return err
+	}
+
+	go io.Copy(peer, conn)
+	_, err = io.Copy(conn, peer)
+	return err
+}
+
+func socks5TestReply(addr *net.TCPAddr) []byte {
+	reply := []byte{socks5Version, 0, 0, socks5AtypIPv4}
+	reply = append(reply, addr.IP.To4()...)
+	var port [2]byte
+	binary.BigEndian.PutUint16(port[:], uint16(addr.Port))
+	return append(reply, port[:]...)
+}
+
+func setProxyEnv(t *testing.T, value string) func() {
+	t.Helper()
+	old, oldLower := os.Getenv("ALL_PROXY"), os.Getenv("all_proxy")
+	os.Setenv("ALL_PROXY", value)
+	os.Setenv("all_proxy", "")
+	return func() {
+		os.Setenv("ALL_PROXY", old)
+		os.Setenv("all_proxy", oldLower)
+	}
+}
+
+func TestBindViaProxyNoProxy(t *testing.T) {
+	defer setProxyEnv(t, "")()
+	if _, _, err := BindViaProxy(context.Background()); err != errNoProxy {
+		t.Errorf("Expected %v, got %v", errNoProxy, err)
+	}
+
+	defer setProxyEnv(t, "http://127.0.0.1:3128")()
+	if _, _, err := BindViaProxy(context.Background()); err != errNoProxy {
+		t.Errorf("Expected %v for an HTTP proxy, got %v", errNoProxy, err)
+	}
+}
+
+func TestBindViaProxy(t *testing.T) {
+	for _, unspecified := range []bool{false, true} {
+		srv := &mockSocks5Server{user: "user", password: "pass", unspecified: unspecified}
+		newMockSocks5Server(t, srv)
+		defer srv.Close()
+		defer setProxyEnv(t, "socks5://user:pass@"+srv.Addr().String())()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		listenAddr, accept, err := BindViaProxy(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(listenAddr, "127.0.0.1:") {
+			t.Errorf("Unexpected listen address %v", listenAddr)
+		}
+
+		remote, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer remote.Close()
+
+		conn, err := accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if conn.RemoteAddr().String() != remote.LocalAddr().String() {
+			t.Errorf("Expected remote address %v, got %v", remote.LocalAddr(), conn.RemoteAddr())
+		}
+		if _, err := accept(); err != errAlreadyAccepted {
+			t.Errorf("Expected %v accepting twice, got %v", errAlreadyAccepted, err)
+		}
+
+		// Data flows both ways.
+		buf := make([]byte, 5)
+		if _, err := remote.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("Read %q, %v from inbound connection", buf, err)
+		}
+		if _, err := conn.Write([]byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(remote, buf); err != nil || string(buf) != "world" {
+			t.Errorf("Read %q, %v from proxy", buf, err)
+		}
+	}
+}
+
+func TestBindViaProxyFailures(t *testing.T) {
+	cases := []struct {
+		srv   *mockSocks5Server
+		proxy func(addr string) string
+		err   string
+	}{
+		{
+			srv:   &mockSocks5Server{failure: 2},
+			proxy: func(addr string) string { return "socks5://" + addr },
+			err:   "connection not allowed by ruleset",
+		},
+		{
+			srv:   &mockSocks5Server{user: "user", password: "pass"},
+			proxy: func(addr string) string { return "socks5://" + addr },
+			err:   "no acceptable proxy authentication method",
+		},
+		{
+			srv:   &mockSocks5Server{user: "user", password: "pass"},
+			proxy: func(addr string) string { return "socks5://user:wrong@" + addr },
+			err:   "proxy rejected user or password",
+		},
+	}
+	for _, tc := range cases {
+		newMockSocks5Server(t, tc.srv)
+		restore := setProxyEnv(t, tc.proxy(tc.srv.Addr().String()))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, _, err := BindViaProxy(ctx)
+		cancel()
+		restore()
+		tc.srv.Close()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestBindViaProxyCancel(t *testing.T) {
+	// A proxy that never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+	defer setProxyEnv(t, "socks5://"+l.Addr().String())()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := BindViaProxy(ctx); err == nil {
+		t.Error("Expected the bind to fail when the context ends")
+	}
+}
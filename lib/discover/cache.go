@@ -7,10 +7,13 @@
 package discover
 
 import (
+	"errors"
+	"reflect"
 	"sort"
 	stdsync "sync"
 	"time"
 
+	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/sync"
 	"github.com/syncthing/syncthing/lib/util"
@@ -22,11 +25,21 @@ import (
 // long we cache and return successful lookup results, the negative cache
 // time sets how long we refrain from asking about the same device ID after
 // receiving a negative answer. The value of zero disables caching (positive
-// or negative).
+// or negative). Cached results for a device are forgotten when its
+// configured addresses change.
 type CachingMux interface {
 	FinderService
+	VerifyConfiguration(from, to config.Configuration) error
+	CommitConfiguration(from, to config.Configuration) bool
 	Add(finder Finder, cacheTime, negCacheTime time.Duration)
 	ChildErrors() map[string]error
+	Forget(deviceID protocol.DeviceID)
+}
+
+// A forgetter is a Finder that keeps its own cache of lookup results, which
+// can be invalidated per device.
+type forgetter interface {
+	Forget(deviceID protocol.DeviceID)
 }
 
 type cachingMux struct {
@@ -131,6 +144,36 @@ func (m *cachingMux) Lookup(deviceID protocol.DeviceID) (addresses []string, err
 	return addresses, nil
 }
 
+// Forget drops any cached results for the given device, both our own and
+// those of our Finders.
+func (m *cachingMux) Forget(deviceID protocol.DeviceID) {
+	m.mut.RLock()
+	for i, finder := range m.finders {
+		m.caches[i].Forget(deviceID)
+		if f, ok := finder.Finder.(forgetter); ok {
+			f.Forget(deviceID)
+		}
+	}
+	m.mut.RUnlock()
+}
+
+func (m *cachingMux) VerifyConfiguration(from, to config.Configuration) error {
+	return nil
+}
+
+// CommitConfiguration forgets cached results for devices whose configured
+// addresses have changed, so that the next lookup reflects the new config.
+func (m *cachingMux) CommitConfiguration(from, to config.Configuration) bool {
+	fromDevices := from.DeviceMap()
+	for _, dev := range to.Devices {
+		if old, ok := fromDevices[dev.DeviceID]; ok && !reflect.DeepEqual(old.Addresses, dev.Addresses) {
+			l.Debugln("addresses changed for", dev.DeviceID, "; forgetting cached discovery results")
+			m.Forget(dev.DeviceID)
+		}
+	}
+	return true
+}
+
 func (m *cachingMux) String() string {
 	return "discovery cache"
 }
@@ -220,6 +263,55 @@ func (c *cache) Get(id protocol.DeviceID) (CacheEntry, bool) {
 	return ce, ok
 }
 
+func (c *cache) Forget(id protocol.DeviceID) {
+	c.mut.Lock()
+	delete(c.entries, id)
+	c.mut.Unlock()
+}
+
+// cachedLookup returns the cached result for the device if it is still
+// valid, otherwise it performs the lookup and caches the result. The lookup
+// returns how long a successful result is valid for; failures are cached
+// for as long as the error says, or globalNegCacheTime.
+func (c *cache) cachedLookup(device protocol.DeviceID, lookup func(protocol.DeviceID) ([]string, time.Duration, error)) ([]string, error) {
+	if entry, ok := c.Get(device); ok && time.Now().Before(entry.validUntil) {
+		if entry.found {
+			l.Debugln("cached lookup for", device, "addresses:", entry.Addresses)
+			return entry.Addresses, nil
+		}
+		l.Debugln("negative cache entry for", device, "valid until", entry.validUntil)
+		return nil, lookupError{
+			error:    errors.New("device not found (cached)"),
+			cacheFor: time.Until(entry.validUntil),
+		}
+	}
+
+	addresses, cacheFor, err := lookup(device)
+	now := time.Now()
+	if err != nil {
+		if err, ok := err.(cachedError); ok {
+			cacheFor = err.CacheFor()
+		} else {
+			cacheFor = globalNegCacheTime
+		}
+		c.Set(device, CacheEntry{
+			when:       now,
+			validUntil: now.Add(cacheFor),
+		})
+		return nil, err
+	}
+
+	// A successful lookup without addresses is still a valid answer, and
+	// cached as such rather than as a failure.
+	c.Set(device, CacheEntry{
+		Addresses:  addresses,
+		when:       now,
+		found:      true,
+		validUntil: now.Add(cacheFor),
+	})
+	return addresses, nil
+}
+
 func (c *cache) Cache() map[protocol.DeviceID]CacheEntry {
 	c.mut.Lock()
 	m := make(map[protocol.DeviceID]CacheEntry, len(c.entries))
@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	stdsync "sync"
 	"time"
 
@@ -38,6 +39,7 @@ type globalClient struct {
 	noLookup       bool
 	evLogger       events.Logger
 	errorHolder
+	*cache
 }
 
 type httpClient interface {
@@ -49,6 +51,13 @@ const (
 	defaultReannounceInterval  = 30 * time.Minute
 	announceErrorRetryInterval = 5 * time.Minute
 	requestTimeout             = 5 * time.Second
+
+	// Lookup results are cached for as long as the server says they are
+	// valid, or for globalCacheTime if it doesn't say. Failed lookups are
+	// cached for as long as the server asks us to wait before retrying, or
+	// for globalNegCacheTime.
+	globalCacheTime    = 5 * time.Minute
+	globalNegCacheTime = time.Minute
 )
 
 type announcement struct {
@@ -72,12 +81,26 @@ func (e lookupError) CacheFor() time.Duration {
 	return e.cacheFor
 }
 
+// NewGlobal returns a discovery provider for the given discovery server.
+// Servers using a scheme registered with RegisterBackend are handled by that
+// backend, others by the global discovery protocol over HTTPS.
 func NewGlobal(server string, cert tls.Certificate, addrList AddressLister, evLogger events.Logger) (FinderService, error) {
+	dsn := server
 	server, opts, err := parseOptions(server)
 	if err != nil {
 		return nil, err
 	}
 
+	if u, _ := url.Parse(server); u != nil {
+		if factory, ok := backendFactory(u.Scheme); ok {
+			var myID protocol.DeviceID
+			if len(cert.Certificate) > 0 {
+				myID = protocol.NewDeviceID(cert.Certificate[0])
+			}
+			return newBackendClient(factory, dsn, opts, myID, addrList, evLogger)
+		}
+	}
+
 	var devID protocol.DeviceID
 	if opts.id != "" {
 		devID, err = protocol.DeviceIDFromString(opts.id)
@@ -128,6 +151,7 @@ func NewGlobal(server string, cert tls.Certificate, addrList AddressLister, evLo
 		noAnnounce:     opts.noAnnounce,
 		noLookup:       opts.noLookup,
 		evLogger:       evLogger,
+		cache:          newCache(),
 	}
 	cl.Service = util.AsService(cl.serve, cl.String())
 	if !opts.noAnnounce {
@@ -138,7 +162,9 @@ func NewGlobal(server string, cert tls.Certificate, addrList AddressLister, evLo
 	return cl, nil
 }
 
-// Lookup returns the list of addresses where the given device is available
+// Lookup returns the list of addresses where the given device is available.
+// Results, including failed lookups, are cached so that repeated lookups for
+// a device that is offline don't hit the discovery server every time.
 func (c *globalClient) Lookup(device protocol.DeviceID) (addresses []string, err error) {
 	if c.noLookup {
 		return nil, lookupError{
@@ -147,9 +173,15 @@ func (c *globalClient) Lookup(device protocol.DeviceID) (addresses []string, err
 		}
 	}
 
+	return c.cachedLookup(device, c.lookup)
+}
+
+// lookup performs the actual query against the discovery server. It returns
+// the addresses and how long they may be cached for.
+func (c *globalClient) lookup(device protocol.DeviceID) ([]string, time.Duration, error) {
 	qURL, err := url.Parse(c.server)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	q := qURL.Query()
@@ -159,7 +191,7 @@ func (c *globalClient) Lookup(device protocol.DeviceID) (addresses []string, err
 	resp, err := c.queryClient.Get(qURL.String())
 	if err != nil {
 		l.Debugln("globalClient.Lookup", qURL, err)
-		return nil, err
+		return nil, 0, err
 	}
 	if resp.StatusCode != 200 {
 		resp.Body.Close()
@@ -171,18 +203,35 @@ func (c *globalClient) Lookup(device protocol.DeviceID) (addresses []string, err
 				cacheFor: time.Duration(secs) * time.Second,
 			}
 		}
-		return nil, err
+		return nil, 0, err
 	}
 
 	bs, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	resp.Body.Close()
 
 	var ann announcement
-	err = json.Unmarshal(bs, &ann)
-	return ann.Addresses, err
+	if err := json.Unmarshal(bs, &ann); err != nil {
+		return nil, 0, err
+	}
+	return ann.Addresses, cacheMaxAge(resp.Header, globalCacheTime), nil
+}
+
+// cacheMaxAge returns the max-age given in the Cache-Control header, or def
+// if there is none.
+func cacheMaxAge(h http.Header, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if secs, err := strconv.Atoi(directive[len("max-age="):]); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return def
 }
 
 func (c *globalClient) String() string {
@@ -283,8 +332,7 @@ func (c *globalClient) sendAnnouncement(timer *time.Timer) {
 }
 
 func (c *globalClient) Cache() map[protocol.DeviceID]CacheEntry {
-	// The globalClient doesn't do caching
-	return nil
+	return c.cache.Cache()
 }
 
 // parseOptions parses and strips away any ?query=val options, setting the
@@ -311,7 +359,7 @@ func parseOptions(dsn string) (server string, opts serverOptions, err error) {
 		if !opts.noAnnounce {
 			return "", serverOptions{}, errors.New("http without noannounce not supported")
 		}
-	} else if p.Scheme != "https" {
+	} else if _, ok := backendFactory(p.Scheme); !ok && p.Scheme != "https" {
 		return "", serverOptions{}, errors.New("unsupported scheme " + p.Scheme)
 	}
 
@@ -8,6 +8,8 @@ package discover
 
 import (
 	"crypto/tls"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -15,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/tlsutil"
@@ -217,6 +220,177 @@ func TestGlobalAnnounce(t *testing.T) {
 	}
 }
 
+func TestGlobalNegativeCache(t *testing.T) {
+	cl := &countingHTTPClient{status: http.StatusNotFound}
+	c := &globalClient{
+		server:      "https://192.0.2.42/",
+		queryClient: cl,
+		cache:       newCache(),
+	}
+
+	// Repeated lookups for a device that isn't known are answered from the
+	// negative cache.
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Lookup(protocol.LocalDeviceID); err == nil {
+			t.Fatal("unexpected nil error for unknown device")
+		}
+	}
+	if cl.gets != 1 {
+		t.Fatalf("server queried %d times, expected once", cl.gets)
+	}
+
+	// Forgetting the device, as happens when its addresses change, makes
+	// us ask again.
+
+	mux := NewCachingMux()
+	mux.Add(c, 0, 0)
+	mux.Forget(protocol.LocalDeviceID)
+	if _, err := c.Lookup(protocol.LocalDeviceID); err == nil {
+		t.Fatal("unexpected nil error for unknown device")
+	}
+	if cl.gets != 2 {
+		t.Fatalf("server queried %d times, expected twice", cl.gets)
+	}
+
+	// When the entry expires we ask again.
+
+	entry, _ := c.Get(protocol.LocalDeviceID)
+	entry.validUntil = time.Now().Add(-time.Second)
+	c.Set(protocol.LocalDeviceID, entry)
+	if _, err := c.Lookup(protocol.LocalDeviceID); err == nil {
+		t.Fatal("unexpected nil error for unknown device")
+	}
+	if cl.gets != 3 {
+		t.Fatalf("server queried %d times, expected three times", cl.gets)
+	}
+}
+
+func TestGlobalPositiveCache(t *testing.T) {
+	cl := &countingHTTPClient{
+		status: http.StatusOK,
+		body:   `{"addresses":["tcp://192.0.2.42:22000"]}`,
+	}
+	c := &globalClient{
+		server:      "https://192.0.2.42/",
+		queryClient: cl,
+		cache:       newCache(),
+	}
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.Lookup(protocol.LocalDeviceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "tcp://192.0.2.42:22000" {
+			t.Fatalf("incorrect addresses list: %v", addrs)
+		}
+	}
+	if cl.gets != 1 {
+		t.Fatalf("server queried %d times, expected once", cl.gets)
+	}
+
+	// A max-age of zero from the server means don't cache.
+
+	cl.header = http.Header{"Cache-Control": []string{"public, max-age=0"}}
+	c.Forget(protocol.LocalDeviceID)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lookup(protocol.LocalDeviceID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cl.gets != 3 {
+		t.Fatalf("server queried %d times, expected three times", cl.gets)
+	}
+}
+
+func TestGlobalEmptyResultCache(t *testing.T) {
+	cl := &countingHTTPClient{
+		status: http.StatusOK,
+		body:   `{"addresses":[]}`,
+	}
+	c := &globalClient{
+		server:      "https://192.0.2.42/",
+		queryClient: cl,
+		cache:       newCache(),
+	}
+
+	// A successful answer without addresses is cached like any other, not
+	// turned into an error.
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.Lookup(protocol.LocalDeviceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 0 {
+			t.Fatalf("incorrect addresses list: %v", addrs)
+		}
+	}
+	if cl.gets != 1 {
+		t.Fatalf("server queried %d times, expected once", cl.gets)
+	}
+	if entry, _ := c.Get(protocol.LocalDeviceID); time.Until(entry.validUntil) <= globalNegCacheTime {
+		t.Errorf("empty result cached until %v, expected the positive cache time", entry.validUntil)
+	}
+}
+
+func TestCachingMuxForgetsChangedDevices(t *testing.T) {
+	cl := &countingHTTPClient{status: http.StatusNotFound}
+	c := &globalClient{
+		server:      "https://192.0.2.42/",
+		queryClient: cl,
+		cache:       newCache(),
+	}
+	mux := NewCachingMux()
+	mux.Add(c, 0, 0)
+
+	other := protocol.DeviceID{1, 2, 3}
+	c.Lookup(protocol.LocalDeviceID)
+	c.Lookup(other)
+
+	from := config.New(protocol.LocalDeviceID)
+	from.Devices = []config.DeviceConfiguration{
+		{DeviceID: protocol.LocalDeviceID, Addresses: []string{"dynamic"}},
+		{DeviceID: other, Addresses: []string{"dynamic"}},
+	}
+	to := from.Copy()
+	to.Devices[0].Addresses = []string{"tcp://192.0.2.42:22000"}
+	mux.CommitConfiguration(from, to)
+
+	if _, ok := c.Get(protocol.LocalDeviceID); ok {
+		t.Error("cache entry should have been forgotten after address change")
+	}
+	if _, ok := c.Get(other); !ok {
+		t.Error("cache entry should have been kept for unchanged device")
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	cases := []struct {
+		header string
+		maxAge time.Duration
+	}{
+		{"", time.Minute},
+		{"max-age=300", 5 * time.Minute},
+		{"public, max-age=60", time.Minute},
+		{"max-age=0", 0},
+		{"no-store", time.Minute},
+		{"max-age=-1", time.Minute},
+		{"max-age=foo", time.Minute},
+	}
+
+	for _, tc := range cases {
+		h := http.Header{}
+		if tc.header != "" {
+			h.Set("Cache-Control", tc.header)
+		}
+		if res := cacheMaxAge(h, time.Minute); res != tc.maxAge {
+			t.Errorf("cacheMaxAge(%q) => %v, expected %v", tc.header, res, tc.maxAge)
+		}
+	}
+}
+
 func testLookup(url string) ([]string, error) {
 	disco, err := NewGlobal(url, tls.Certificate{}, nil, events.NoopLogger)
 	if err != nil {
@@ -247,6 +421,33 @@ func (s *fakeDiscoveryServer) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// countingHTTPClient answers all queries with the given response and
+// counts them.
+type countingHTTPClient struct {
+	status int
+	header http.Header
+	body   string
+	gets   int
+}
+
+func (c *countingHTTPClient) Get(url string) (*http.Response, error) {
+	c.gets++
+	header := c.header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode: c.status,
+		Status:     http.StatusText(c.status),
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(c.body)),
+	}, nil
+}
+
+func (c *countingHTTPClient) Post(url, ctype string, data io.Reader) (*http.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
 type fakeAddressLister struct{}
 
 func (f *fakeAddressLister) ExternalAddresses() []string {
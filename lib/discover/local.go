@@ -18,6 +18,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/syncthing/syncthing/lib/beacon"
@@ -215,6 +216,13 @@ func (c *localClient) recvAnnouncements(ctx context.Context) {
 }
 
 func (c *localClient) registerDevice(src net.Addr, device Announce) bool {
+	return registerAnnouncement(c.cache, c.evLogger, src, device)
+}
+
+// registerAnnouncement caches the addresses in an announcement received
+// from src, and returns true if the device should be considered newly
+// discovered.
+func registerAnnouncement(c *cache, evLogger events.Logger, src net.Addr, device Announce) bool {
 	// Remember whether we already had a valid cache entry for this device.
 	// If the instance ID has changed the remote device has restarted since
 	// we last heard from it, so we should treat it as a new device.
@@ -233,7 +241,9 @@ func (c *localClient) registerDevice(src net.Addr, device Announce) bool {
 			continue
 		}
 
-		tcpAddr, err := net.ResolveTCPAddr("tcp", u.Host)
+		// Any zone refers to an interface on the remote side, which might
+		// not exist here.
+		tcpAddr, err := net.ResolveTCPAddr("tcp", stripZone(u.Host))
 		if err != nil {
 			continue
 		}
@@ -262,6 +272,14 @@ func (c *localClient) registerDevice(src net.Addr, device Announce) bool {
 			l.Debugf("discover: Reconstructed URL is %#v", u)
 			validAddresses = append(validAddresses, u.String())
 			l.Debugf("discover: Replaced address %v in %s to get %s", tcpAddr.IP, addr, u.String())
+		} else if zone := linkLocalZone(tcpAddr.IP, src); zone != "" {
+			// A link local address is only usable with the zone of the
+			// interface it's reachable on, which is the one we received
+			// the announcement on. Any zone given by the remote side
+			// refers to its own interfaces and is meaningless to us.
+			u.Host = net.JoinHostPort(tcpAddr.IP.String()+"%"+zone, strconv.Itoa(tcpAddr.Port))
+			validAddresses = append(validAddresses, u.String())
+			l.Debugf("discover: Added zone %s to link local address %s to get %s", zone, addr, u.String())
 		} else {
 			validAddresses = append(validAddresses, addr)
 			l.Debugf("discover: Accepted address %s verbatim", addr)
@@ -276,7 +294,7 @@ func (c *localClient) registerDevice(src net.Addr, device Announce) bool {
 	})
 
 	if isNewDevice {
-		c.evLogger.Log(events.DeviceDiscovered, map[string]interface{}{
+		evLogger.Log(events.DeviceDiscovered, map[string]interface{}{
 			"device": device.ID.String(),
 			"addrs":  validAddresses,
 		})
@@ -284,3 +302,30 @@ func (c *localClient) registerDevice(src net.Addr, device Announce) bool {
 
 	return isNewDevice
 }
+
+// linkLocalZone returns the zone of the source address if ip is an IPv6
+// link local address, or the empty string otherwise.
+func linkLocalZone(ip net.IP, src net.Addr) string {
+	if ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+		return ""
+	}
+	switch src := src.(type) {
+	case *net.UDPAddr:
+		return src.Zone
+	case *net.TCPAddr:
+		return src.Zone
+	}
+	return ""
+}
+
+// stripZone removes the zone, if any, from the given host:port.
+func stripZone(hostPort string) string {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		return net.JoinHostPort(host[:i], port)
+	}
+	return hostPort
+}
@@ -9,6 +9,7 @@ package discover
 import (
 	"bytes"
 	"net"
+	"net/url"
 	"testing"
 
 	"github.com/syncthing/syncthing/lib/events"
@@ -87,3 +88,55 @@ func TestLocalInstanceIDShouldTriggerNew(t *testing.T) {
 		t.Fatal("new instance ID should be new")
 	}
 }
+
+func TestLocalLinkLocalZones(t *testing.T) {
+	c, err := NewLocal(protocol.LocalDeviceID, ":0", &fakeAddressLister{}, events.NoopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := c.(*localClient)
+
+	cases := []struct {
+		device protocol.DeviceID
+		src    *net.UDPAddr
+		zone   string
+	}{
+		{protocol.DeviceID{1}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 21027, Zone: "eth0"}, "eth0"},
+		{protocol.DeviceID{2}, &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 21027, Zone: "2"}, "2"},
+		{protocol.DeviceID{3}, &net.UDPAddr{IP: net.ParseIP("fe80::3"), Port: 21027, Zone: "3"}, "3"},
+	}
+
+	for _, tc := range cases {
+		lc.registerDevice(tc.src, Announce{
+			ID: tc.device,
+			Addresses: []string{
+				"tcp://0.0.0.0:22000",           // unspecified, gets the source address
+				"tcp://[fe80::aa]:22000",        // link local, gets the source zone
+				"quic://[fe80::bb%25en7]:22000", // link local with the remote's zone, which is replaced
+				"tcp://192.168.0.1:22000",       // untouched
+			},
+			InstanceID: 42,
+		})
+
+		addrs, _ := lc.Lookup(tc.device)
+		if len(addrs) != 4 {
+			t.Fatalf("Unexpected addresses %v", addrs)
+		}
+		for i, expected := range []string{tc.src.IP.String(), "fe80::aa", "fe80::bb"} {
+			u, err := url.Parse(addrs[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr, err := net.ResolveTCPAddr("tcp", u.Host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr.IP.String() != expected || addr.Zone != tc.zone || addr.Port != 22000 {
+				t.Errorf("Address %s resolved to %v, expected %s with zone %s", addrs[i], addr, expected, tc.zone)
+			}
+		}
+		if addrs[3] != "tcp://192.168.0.1:22000" {
+			t.Errorf("Address %s should not have been changed", addrs[3])
+		}
+	}
+}
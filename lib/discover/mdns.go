@@ -0,0 +1,393 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/syncthing/syncthing/lib/beacon"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
+	"github.com/syncthing/syncthing/lib/util"
+	"github.com/thejerf/suture"
+)
+
+const (
+	// MDNSAddr4 and MDNSAddr6 are the IPv4 and link local IPv6 mDNS
+	// multicast groups and port.
+	MDNSAddr4 = "224.0.0.251:5353"
+	MDNSAddr6 = "[ff02::fb]:5353"
+
+	// mdnsService is the DNS-SD service type we announce. Each device is an
+	// instance of it, named by its device ID, with the listen addresses
+	// in the TXT record. The SRV and A/AAAA records point at the host
+	// "<device ID>.local." for the benefit of generic mDNS browsers.
+	mdnsService = "_syncthing._tcp.local."
+	mdnsDomain  = "local."
+
+	mdnsTXTAddress  = "addr="
+	mdnsTXTInstance = "instance="
+)
+
+// mdnsClient is a local discovery provider based on mDNS/DNS-SD. It runs
+// alongside the regular local discovery and shares its cache semantics.
+type mdnsClient struct {
+	*suture.Supervisor
+	name     string
+	myID     protocol.DeviceID
+	addrList AddressLister
+	evLogger events.Logger
+
+	beacon       beacon.Interface
+	localIPs     func() []net.IP
+	announceTick <-chan time.Time
+	forcedTick   chan time.Time
+
+	*cache
+}
+
+// NewMDNS returns a Finder that announces and resolves devices using mDNS
+// on the given multicast address, usually MDNSAddr4 or MDNSAddr6.
+func NewMDNS(id protocol.DeviceID, addr string, addrList AddressLister, evLogger events.Logger) (FinderService, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	name := "IPv6 mDNS local"
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		name = "IPv4 mDNS local"
+	}
+	return newMDNS(id, name, beacon.NewMulticastFromGroupPort(addr), addrList, evLogger), nil
+}
+
+func newMDNS(id protocol.DeviceID, name string, b beacon.Interface, addrList AddressLister, evLogger events.Logger) *mdnsClient {
+	c := &mdnsClient{
+		Supervisor: suture.New("mdns", suture.Spec{
+			PassThroughPanics: true,
+		}),
+		name:         name,
+		myID:         id,
+		addrList:     addrList,
+		evLogger:     evLogger,
+		beacon:       b,
+		localIPs:     interfaceIPs,
+		announceTick: time.NewTicker(BroadcastInterval).C,
+		forcedTick:   make(chan time.Time),
+		cache:        newCache(),
+	}
+
+	c.Add(c.beacon)
+	c.Add(util.AsService(c.recvMessages, fmt.Sprintf("%s/recv", c)))
+	c.Add(util.AsService(c.sendAnnouncements, fmt.Sprintf("%s/send", c)))
+
+	return c
+}
+
+// Lookup returns a list of addresses the device is available at.
+func (c *mdnsClient) Lookup(device protocol.DeviceID) (addresses []string, err error) {
+	if cache, ok := c.Get(device); ok {
+		if time.Since(cache.when) < CacheLifeTime {
+			addresses = cache.Addresses
+		}
+	}
+	return
+}
+
+func (c *mdnsClient) String() string {
+	return c.name
+}
+
+func (c *mdnsClient) Error() error {
+	return c.beacon.Error()
+}
+
+func (c *mdnsClient) sendAnnouncements(ctx context.Context) {
+	instanceID := rand.Int63()
+
+	// Ask for other devices first, so that we don't have to wait for
+	// their next periodic announcement.
+	if msg, err := mdnsQuery(); err == nil {
+		c.beacon.Send(msg)
+	} else {
+		l.Debugln("discover: creating mDNS query:", err)
+	}
+
+	for {
+		if msg, ok, err := c.announcement(instanceID); err != nil {
+			l.Debugln("discover: creating mDNS announcement:", err)
+		} else if ok {
+			c.beacon.Send(msg)
+		}
+
+		select {
+		case <-c.announceTick:
+		case <-c.forcedTick:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *mdnsClient) recvMessages(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		buf, addr := c.beacon.Recv()
+		if buf == nil {
+			continue
+		}
+
+		query, anns, err := parseMDNS(buf)
+		if err != nil {
+			l.Debugf("discover: Failed to parse mDNS message from %s: %v", addr, err)
+			continue
+		}
+
+		respond := query
+		for _, ann := range anns {
+			if ann.ID == c.myID {
+				continue
+			}
+			l.Debugf("discover: Received mDNS announcement from %s for %s", addr, ann.ID)
+			if registerAnnouncement(c.cache, c.evLogger, addr, ann) {
+				respond = true
+			}
+		}
+
+		if respond {
+			// Someone is asking for us or we found a new device, so
+			// announce ourselves right away if we can.
+			select {
+			case c.forcedTick <- time.Now():
+			default:
+			}
+		}
+	}
+}
+
+// announcement returns an mDNS response announcing our addresses. Returns
+// false if there is nothing useful to send.
+func (c *mdnsClient) announcement(instanceID int64) ([]byte, bool, error) {
+	addrs := c.addrList.AllAddresses()
+	if len(addrs) == 0 {
+		// Nothing to announce
+		return nil, false, nil
+	}
+
+	service, err := dnsmessage.NewName(mdnsService)
+	if err != nil {
+		return nil, false, err
+	}
+	instance, err := dnsmessage.NewName(c.myID.String() + "." + mdnsService)
+	if err != nil {
+		return nil, false, err
+	}
+
+	host, err := dnsmessage.NewName(c.myID.String() + "." + mdnsDomain)
+	if err != nil {
+		return nil, false, err
+	}
+
+	txt := make([]string, 0, len(addrs)+1)
+	txt = append(txt, mdnsTXTInstance+strconv.FormatInt(instanceID, 10))
+	for _, addr := range addrs {
+		txt = append(txt, mdnsTXTAddress+addr)
+	}
+	port, ips := c.hostRecords(addrs)
+
+	ttl := uint32(CacheLifeTime / time.Second)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, false, err
+	}
+	if err := b.PTRResource(dnsmessage.ResourceHeader{Name: service, Class: dnsmessage.ClassINET, TTL: ttl}, dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return nil, false, err
+	}
+	if err := b.TXTResource(dnsmessage.ResourceHeader{Name: instance, Class: dnsmessage.ClassINET, TTL: ttl}, dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, false, err
+	}
+	if port != 0 {
+		if err := b.SRVResource(dnsmessage.ResourceHeader{Name: instance, Class: dnsmessage.ClassINET, TTL: ttl}, dnsmessage.SRVResource{Port: port, Target: host}); err != nil {
+			return nil, false, err
+		}
+	}
+	for _, ip := range ips {
+		hdr := dnsmessage.ResourceHeader{Name: host, Class: dnsmessage.ClassINET, TTL: ttl}
+		if ip4 := ip.To4(); ip4 != nil {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			err = b.AResource(hdr, a)
+		} else {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			err = b.AAAAResource(hdr, aaaa)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	msg, err := b.Finish()
+	return msg, err == nil, err
+}
+
+// hostRecords returns the port for the SRV record, taken from the first
+// listen address that has one, and the IPs for the A/AAAA records. These
+// are the specified IPs of the listen addresses, plus the local interface
+// addresses if any listen address is unspecified.
+func (c *mdnsClient) hostRecords(addrs []string) (uint16, []net.IP) {
+	var port uint16
+	var ips []net.IP
+	seen := make(map[string]struct{})
+	add := func(ip net.IP) {
+		if ip == nil || ip.IsLoopback() {
+			return
+		}
+		if _, ok := seen[ip.String()]; ok {
+			return
+		}
+		seen[ip.String()] = struct{}{}
+		ips = append(ips, ip)
+	}
+	unspecified := false
+	for _, addr := range addrs {
+		uri, err := url.Parse(addr)
+		if err != nil {
+			continue
+		}
+		if port == 0 {
+			if p, err := strconv.ParseUint(uri.Port(), 10, 16); err == nil {
+				port = uint16(p)
+			}
+		}
+		ip := net.ParseIP(uri.Hostname())
+		if ip == nil || ip.IsUnspecified() {
+			unspecified = true
+			continue
+		}
+		add(ip)
+	}
+	if unspecified {
+		for _, ip := range c.localIPs() {
+			add(ip)
+		}
+	}
+	return port, ips
+}
+
+// interfaceIPs returns the unicast addresses of all local interfaces.
+func interfaceIPs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		l.Debugln("discover: listing interface addresses:", err)
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips
+}
+
+// mdnsQuery returns an mDNS query for all instances of our service.
+func mdnsQuery() ([]byte, error) {
+	service, err := dnsmessage.NewName(mdnsService)
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: service, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// parseMDNS returns whether the message contains a query for our service,
+// and the device announcements it contains. Records for other services are
+// ignored.
+func parseMDNS(buf []byte) (bool, []Announce, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(buf)
+	if err != nil {
+		return false, nil, err
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return false, nil, err
+	}
+	if !hdr.Response {
+		for _, q := range questions {
+			if (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL) && strings.EqualFold(q.Name.String(), mdnsService) {
+				return true, nil, nil
+			}
+		}
+		return false, nil, nil
+	}
+
+	var anns []Announce
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return false, nil, err
+		}
+
+		name := h.Name.String()
+		if h.Type != dnsmessage.TypeTXT || !strings.HasSuffix(strings.ToLower(name), "."+mdnsService) {
+			if err := p.SkipAnswer(); err != nil {
+				return false, nil, err
+			}
+			continue
+		}
+
+		txt, err := p.TXTResource()
+		if err != nil {
+			return false, nil, err
+		}
+
+		id, err := protocol.DeviceIDFromString(name[:len(name)-len(mdnsService)-1])
+		if err != nil {
+			l.Debugf("discover: Skipping mDNS instance %q: %v", name, err)
+			continue
+		}
+
+		ann := Announce{ID: id}
+		for _, entry := range txt.TXT {
+			switch {
+			case strings.HasPrefix(entry, mdnsTXTAddress):
+				ann.Addresses = append(ann.Addresses, entry[len(mdnsTXTAddress):])
+			case strings.HasPrefix(entry, mdnsTXTInstance):
+				ann.InstanceID, _ = strconv.ParseInt(entry[len(mdnsTXTInstance):], 10, 64)
+			}
+		}
+		anns = append(anns, ann)
+	}
+
+	return false, anns, nil
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+func TestMDNSRoundTrip(t *testing.T) {
+	network := newLoopbackNetwork()
+	id1, _ := protocol.DeviceIDFromString("AIR6LPZ7K4PTTUXQSMUUCPQ5YWOEDFIIQJUG7772YQXXR5YD6AWQ")
+	id2, _ := protocol.DeviceIDFromString("GYRZZQB-IRNPV4Z-T7TC52W-EQYJ3TT-FDQW6MW-DFLMU42-SSSU6EM-FBK2VAY")
+
+	c1 := newMDNS(id1, "mDNS", network.join(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5353}), &fakeAddressLister{}, events.NoopLogger)
+	c2 := newMDNS(id2, "mDNS", network.join(&net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 5353}), &staticAddressLister{"quic://[fe80::2]:22000"}, events.NoopLogger)
+	go c1.Serve()
+	defer c1.Stop()
+	go c2.Serve()
+	defer c2.Stop()
+
+	// Each side announces on startup and replies to the other's query, so
+	// both should find each other without waiting for the periodic
+	// announcement.
+	t0 := time.Now()
+	for {
+		addrs1, _ := c2.Lookup(id1)
+		addrs2, _ := c1.Lookup(id2)
+		if len(addrs1) > 0 && len(addrs2) > 0 {
+			// The unspecified address is replaced by the source
+			if len(addrs1) != 2 || addrs1[0] != "tcp://[fe80::1]:22000" || addrs1[1] != "tcp://192.168.0.1:22000" {
+				t.Errorf("Unexpected addresses for device 1: %v", addrs1)
+			}
+			if len(addrs2) != 1 || addrs2[0] != "quic://[fe80::2]:22000" {
+				t.Errorf("Unexpected addresses for device 2: %v", addrs2)
+			}
+			break
+		}
+		if time.Since(t0) > 5*time.Second {
+			t.Fatal("Devices did not discover each other")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// We don't register ourselves
+	if addrs, _ := c1.Lookup(id1); len(addrs) != 0 {
+		t.Error("Device should not discover itself")
+	}
+}
+
+func TestMDNSIgnoresOtherServices(t *testing.T) {
+	id, _ := protocol.DeviceIDFromString("AIR6LPZ7K4PTTUXQSMUUCPQ5YWOEDFIIQJUG7772YQXXR5YD6AWQ")
+	c := newMDNS(id, "mDNS", newLoopbackNetwork().join(&net.UDPAddr{}), &fakeAddressLister{}, events.NoopLogger)
+
+	msg, ok, err := c.announcement(42)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	query, anns, err := parseMDNS(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query || len(anns) != 1 || anns[0].ID != id || anns[0].InstanceID != 42 {
+		t.Fatalf("Unexpected parse result %v %+v", query, anns)
+	}
+
+	msg, err = mdnsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, anns, err := parseMDNS(msg); err != nil || !query || len(anns) != 0 {
+		t.Fatalf("Unexpected parse result %v %+v %v", query, anns, err)
+	}
+
+	if _, _, err := parseMDNS([]byte("garbage")); err == nil {
+		t.Error("Expected error parsing garbage")
+	}
+}
+
+func TestMDNSAnnouncementRecords(t *testing.T) {
+	id, _ := protocol.DeviceIDFromString("AIR6LPZ7K4PTTUXQSMUUCPQ5YWOEDFIIQJUG7772YQXXR5YD6AWQ")
+	c := newMDNS(id, "mDNS", newLoopbackNetwork().join(&net.UDPAddr{}), &fakeAddressLister{}, events.NoopLogger)
+	c.localIPs = func() []net.IP {
+		return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.0.0.1"), net.ParseIP("fe80::1"), net.ParseIP("192.168.0.1")}
+	}
+
+	msg, ok, err := c.announcement(42)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := id.String() + ".local."
+	var srv *dnsmessage.SRVResource
+	var ips []string
+	for _, a := range answers {
+		switch r := a.Body.(type) {
+		case *dnsmessage.SRVResource:
+			srv = r
+		case *dnsmessage.AResource:
+			if a.Header.Name.String() != host {
+				t.Errorf("Unexpected A record name %v", a.Header.Name)
+			}
+			ips = append(ips, net.IP(r.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			if a.Header.Name.String() != host {
+				t.Errorf("Unexpected AAAA record name %v", a.Header.Name)
+			}
+			ips = append(ips, net.IP(r.AAAA[:]).String())
+		}
+	}
+
+	if srv == nil {
+		t.Fatal("Missing SRV record")
+	}
+	if srv.Port != 22000 || srv.Target.String() != host {
+		t.Errorf("Unexpected SRV record %+v", srv)
+	}
+	// The explicit listen address first, then the interface addresses for
+	// the unspecified one, without loopback or duplicates.
+	if len(ips) != 3 || ips[0] != "192.168.0.1" || ips[1] != "10.0.0.1" || ips[2] != "fe80::1" {
+		t.Errorf("Unexpected addresses %v", ips)
+	}
+}
+
+type staticAddressLister []string
+
+func (s *staticAddressLister) ExternalAddresses() []string { return *s }
+func (s *staticAddressLister) AllAddresses() []string      { return *s }
+
+// loopbackNetwork is an in memory multicast group, delivering everything
+// sent by any member to all members, including the sender.
+type loopbackNetwork struct {
+	mut     sync.Mutex
+	members []*loopbackBeacon
+}
+
+func newLoopbackNetwork() *loopbackNetwork {
+	return &loopbackNetwork{mut: sync.NewMutex()}
+}
+
+func (n *loopbackNetwork) join(addr net.Addr) *loopbackBeacon {
+	b := &loopbackBeacon{
+		network: n,
+		addr:    addr,
+		inbox:   make(chan loopbackPacket, 16),
+		stop:    make(chan struct{}),
+	}
+	n.mut.Lock()
+	n.members = append(n.members, b)
+	n.mut.Unlock()
+	return b
+}
+
+type loopbackPacket struct {
+	data []byte
+	src  net.Addr
+}
+
+type loopbackBeacon struct {
+	network *loopbackNetwork
+	addr    net.Addr
+	inbox   chan loopbackPacket
+	stop    chan struct{}
+}
+
+func (b *loopbackBeacon) Serve()         { <-b.stop }
+func (b *loopbackBeacon) Stop()          { close(b.stop) }
+func (b *loopbackBeacon) String() string { return "loopbackBeacon@" + b.addr.String() }
+func (b *loopbackBeacon) Error() error   { return nil }
+
+func (b *loopbackBeacon) Send(data []byte) {
+	b.network.mut.Lock()
+	defer b.network.mut.Unlock()
+	for _, m := range b.network.members {
+		select {
+		case m.inbox <- loopbackPacket{data, b.addr}:
+		default:
+		}
+	}
+}
+
+func (b *loopbackBeacon) Recv() ([]byte, net.Addr) {
+	select {
+	case p := <-b.inbox:
+		return p.data, p.src
+	case <-b.stop:
+		return nil, nil
+	}
+}
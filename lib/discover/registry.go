@@ -0,0 +1,189 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	stdsync "sync"
+	"time"
+
+	"github.com/thejerf/suture"
+
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/util"
+)
+
+// An Announcer publishes our addresses so that other devices can find us.
+type Announcer interface {
+	Announce(addresses []string) error
+}
+
+// A Backend is a device registry that can be used in place of a global
+// discovery server. Lookup returns the addresses the device is available
+// at, or an error if it isn't known.
+type Backend interface {
+	Announcer
+	Lookup(deviceID protocol.DeviceID) ([]string, error)
+}
+
+// A BackendFactory creates a Backend for a discovery server URL, for use by
+// the device with the given ID. The URL is given including any query
+// parameters.
+type BackendFactory func(server *url.URL, myID protocol.DeviceID) (Backend, error)
+
+var (
+	backends    = make(map[string]BackendFactory)
+	backendsMut stdsync.RWMutex
+)
+
+// RegisterBackend makes a discovery backend available under the given URL
+// scheme. Discovery servers in the config using that scheme (for example
+// "registry://directory.example.com") are then handled by the backend
+// instead of the global discovery protocol. The standard ?noannounce and
+// ?nolookup options apply. RegisterBackend panics if the scheme is
+// already taken.
+func RegisterBackend(scheme string, factory BackendFactory) {
+	if factory == nil {
+		panic("discover: nil backend factory for " + scheme)
+	}
+
+	backendsMut.Lock()
+	defer backendsMut.Unlock()
+	if _, ok := backends[scheme]; ok || scheme == "http" || scheme == "https" {
+		panic("discover: backend already registered for " + scheme)
+	}
+	backends[scheme] = factory
+}
+
+func backendFactory(scheme string) (BackendFactory, bool) {
+	backendsMut.RLock()
+	factory, ok := backends[scheme]
+	backendsMut.RUnlock()
+	return factory, ok
+}
+
+// backendClient runs a Backend as a discovery provider, with the same
+// announcement schedule and caching as the globalClient.
+type backendClient struct {
+	suture.Service
+	server     string
+	backend    Backend
+	addrList   AddressLister
+	noAnnounce bool
+	noLookup   bool
+	evLogger   events.Logger
+	errorHolder
+	*cache
+}
+
+func newBackendClient(factory BackendFactory, server string, opts serverOptions, myID protocol.DeviceID, addrList AddressLister, evLogger events.Logger) (*backendClient, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := factory(u, myID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't show any credentials that may be in the URL.
+	u.User = nil
+	u.RawQuery = ""
+
+	c := &backendClient{
+		server:     u.String(),
+		backend:    backend,
+		addrList:   addrList,
+		noAnnounce: opts.noAnnounce,
+		noLookup:   opts.noLookup,
+		evLogger:   evLogger,
+		cache:      newCache(),
+	}
+	c.Service = util.AsService(c.serve, c.String())
+	if !opts.noAnnounce {
+		c.setError(errors.New("not announced"))
+	}
+
+	return c, nil
+}
+
+// Lookup returns the list of addresses where the given device is available,
+// caching the result.
+func (c *backendClient) Lookup(device protocol.DeviceID) ([]string, error) {
+	if c.noLookup {
+		return nil, lookupError{
+			error:    errors.New("lookups not supported"),
+			cacheFor: time.Hour,
+		}
+	}
+
+	return c.cachedLookup(device, func(device protocol.DeviceID) ([]string, time.Duration, error) {
+		addrs, err := c.backend.Lookup(device)
+		return addrs, globalCacheTime, err
+	})
+}
+
+func (c *backendClient) String() string {
+	return "global@" + c.server
+}
+
+func (c *backendClient) Cache() map[protocol.DeviceID]CacheEntry {
+	return c.cache.Cache()
+}
+
+func (c *backendClient) serve(ctx context.Context) {
+	if c.noAnnounce {
+		<-ctx.Done()
+		return
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	eventSub := c.evLogger.Subscribe(events.ListenAddressesChanged)
+	defer eventSub.Unsubscribe()
+
+	for {
+		select {
+		case <-eventSub.C():
+			// Debounce, as in the globalClient.
+			timer.Reset(2 * time.Second)
+
+		case <-timer.C:
+			c.sendAnnouncement(timer)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *backendClient) sendAnnouncement(timer *time.Timer) {
+	var addrs []string
+	if c.addrList != nil {
+		addrs = c.addrList.ExternalAddresses()
+	}
+
+	if len(addrs) == 0 {
+		c.setError(nil)
+		timer.Reset(announceErrorRetryInterval)
+		return
+	}
+
+	if err := c.backend.Announce(addrs); err != nil {
+		l.Debugln("announce to", c.server, "failed:", err)
+		c.setError(err)
+		timer.Reset(announceErrorRetryInterval)
+		return
+	}
+
+	c.setError(nil)
+	timer.Reset(defaultReannounceInterval)
+}
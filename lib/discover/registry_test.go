@@ -0,0 +1,172 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/tlsutil"
+)
+
+// memoryRegistry is an example in-memory device registry. Each device
+// using it gets a memoryBackend announcing into the shared registry.
+type memoryRegistry struct {
+	addresses map[protocol.DeviceID][]string
+	lookups   int
+	mut       stdsync.Mutex
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{addresses: make(map[protocol.DeviceID][]string)}
+}
+
+func (r *memoryRegistry) factory(server *url.URL, myID protocol.DeviceID) (Backend, error) {
+	if server.Host == "" {
+		return nil, errors.New("missing registry name")
+	}
+	return &memoryBackend{registry: r, myID: myID}, nil
+}
+
+// stats returns the number of lookups made and devices announced so far.
+func (r *memoryRegistry) stats() (lookups, announced int) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.lookups, len(r.addresses)
+}
+
+type memoryBackend struct {
+	registry *memoryRegistry
+	myID     protocol.DeviceID
+}
+
+func (b *memoryBackend) Announce(addresses []string) error {
+	b.registry.mut.Lock()
+	b.registry.addresses[b.myID] = addresses
+	b.registry.mut.Unlock()
+	return nil
+}
+
+func (b *memoryBackend) Lookup(deviceID protocol.DeviceID) ([]string, error) {
+	b.registry.mut.Lock()
+	defer b.registry.mut.Unlock()
+	b.registry.lookups++
+	addrs, ok := b.registry.addresses[deviceID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return addrs, nil
+}
+
+func TestRegisterBackend(t *testing.T) {
+	registry := newMemoryRegistry()
+	RegisterBackend("memory-register", registry.factory)
+
+	for _, scheme := range []string{"memory-register", "http", "https"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q should panic", scheme)
+				}
+			}()
+			RegisterBackend(scheme, registry.factory)
+		}()
+	}
+
+	if _, err := NewGlobal("memory-register://", tls.Certificate{}, nil, events.NoopLogger); err == nil {
+		t.Error("factory error should be returned")
+	}
+	if _, err := NewGlobal("memory-unregistered://test", tls.Certificate{}, nil, events.NoopLogger); err == nil {
+		t.Error("unregistered scheme should be refused")
+	}
+}
+
+func TestBackendAnnounceLookup(t *testing.T) {
+	registry := newMemoryRegistry()
+	RegisterBackend("memory-lookup", registry.factory)
+
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, err := tlsutil.NewCertificate(dir+"/cert.pem", dir+"/key.pem", "syncthing", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	myID := protocol.NewDeviceID(cert.Certificate[0])
+
+	disco, err := NewGlobal("memory-lookup://test?token=secret", cert, new(fakeAddressLister), events.NoopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := disco.String(); s != "global@memory-lookup://test" {
+		t.Errorf("unexpected name %q, should not include the query", s)
+	}
+
+	go disco.Serve()
+	defer disco.Stop()
+
+	// The announcement happens in the background as soon as we start.
+
+	var addrs []string
+	for i := 0; i < 100; i++ {
+		if disco.Error() == nil {
+			addrs, err = disco.Lookup(myID)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "tcp://0.0.0.0:22000" {
+		t.Errorf("incorrect addresses list: %v", addrs)
+	}
+
+	// Unknown devices are not found, and the negative result is cached.
+
+	for i := 0; i < 2; i++ {
+		if _, err := disco.Lookup(protocol.LocalDeviceID); err == nil {
+			t.Error("unexpected nil error for unknown device")
+		}
+	}
+	if lookups, _ := registry.stats(); lookups != 2 {
+		t.Errorf("registry queried %d times, expected twice", lookups)
+	}
+}
+
+func TestBackendNoAnnounce(t *testing.T) {
+	registry := newMemoryRegistry()
+	RegisterBackend("memory-noannounce", registry.factory)
+
+	disco, err := NewGlobal("memory-noannounce://test?noannounce&nolookup", tls.Certificate{}, new(fakeAddressLister), events.NoopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go disco.Serve()
+	defer disco.Stop()
+
+	if err := disco.Error(); err != nil {
+		t.Error("unexpected error without announcing:", err)
+	}
+	if _, err := disco.Lookup(protocol.LocalDeviceID); err == nil {
+		t.Error("lookups should not be supported")
+	}
+	if lookups, announced := registry.stats(); lookups != 0 || announced != 0 {
+		t.Error("registry should not have been used")
+	}
+}
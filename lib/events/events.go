@@ -52,6 +52,10 @@ const (
 	FolderWatchStateChanged
 	ListenAddressesChanged
 	LoginAttempt
+	FolderLowDiskSpace
+	FolderSufficientDiskSpace
+	FolderScanSummary
+	ClusterConfigReceived
 
 	AllEvents = (1 << iota) - 1
 )
@@ -121,6 +125,14 @@ func (t EventType) String() string {
 		return "LoginAttempt"
 	case FolderWatchStateChanged:
 		return "FolderWatchStateChanged"
+	case FolderLowDiskSpace:
+		return "FolderLowDiskSpace"
+	case FolderSufficientDiskSpace:
+		return "FolderSufficientDiskSpace"
+	case FolderScanSummary:
+		return "FolderScanSummary"
+	case ClusterConfigReceived:
+		return "ClusterConfigReceived"
 	default:
 		return "Unknown"
 	}
@@ -200,6 +212,14 @@ func UnmarshalEventType(s string) EventType {
 		return LoginAttempt
 	case "FolderWatchStateChanged":
 		return FolderWatchStateChanged
+	case "FolderLowDiskSpace":
+		return FolderLowDiskSpace
+	case "FolderSufficientDiskSpace":
+		return FolderSufficientDiskSpace
+	case "FolderScanSummary":
+		return FolderScanSummary
+	case "ClusterConfigReceived":
+		return ClusterConfigReceived
 	default:
 		return 0
 	}
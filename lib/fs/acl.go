@@ -0,0 +1,84 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ACLTag is the kind of a POSIX ACL entry.
+type ACLTag uint16
+
+// The ACL entry tags, as in linux/posix_acl.h.
+const (
+	ACLUserObj  ACLTag = 0x01 // the owner
+	ACLUser     ACLTag = 0x02 // the user with the given ID
+	ACLGroupObj ACLTag = 0x04 // the owning group
+	ACLGroup    ACLTag = 0x08 // the group with the given ID
+	ACLMask     ACLTag = 0x10 // the maximum permissions of named users and groups
+	ACLOther    ACLTag = 0x20 // everyone else
+)
+
+// ACLEntry is a single entry of a POSIX ACL. The ID is only meaningful for
+// ACLUser and ACLGroup entries. Perm holds the read (4), write (2) and
+// execute (1) bits.
+type ACLEntry struct {
+	Tag  ACLTag `json:"tag"`
+	ID   uint32 `json:"id"`
+	Perm uint16 `json:"perm"`
+}
+
+// ACL is a POSIX access ACL. A nil ACL means there is none beyond the
+// basic permission bits, or that ACLs are not supported.
+type ACL []ACLEntry
+
+const (
+	aclXattrName    = "system.posix_acl_access"
+	aclXattrVersion = 2
+	aclUndefinedID  = 0xffffffff
+	aclEntrySize    = 8
+)
+
+var errInvalidACL = errors.New("invalid ACL")
+
+// marshalACL returns the ACL in the little endian format used by the
+// extended attribute.
+func marshalACL(acl ACL) []byte {
+	bs := make([]byte, 4+aclEntrySize*len(acl))
+	binary.LittleEndian.PutUint32(bs, aclXattrVersion)
+	for i, e := range acl {
+		id := e.ID
+		if e.Tag != ACLUser && e.Tag != ACLGroup {
+			id = aclUndefinedID
+		}
+		off := 4 + i*aclEntrySize
+		binary.LittleEndian.PutUint16(bs[off:], uint16(e.Tag))
+		binary.LittleEndian.PutUint16(bs[off+2:], e.Perm)
+		binary.LittleEndian.PutUint32(bs[off+4:], id)
+	}
+	return bs
+}
+
+// unmarshalACL parses the value of the extended attribute.
+func unmarshalACL(bs []byte) (ACL, error) {
+	if len(bs) < 4 || (len(bs)-4)%aclEntrySize != 0 || binary.LittleEndian.Uint32(bs) != aclXattrVersion {
+		return nil, errInvalidACL
+	}
+	acl := make(ACL, (len(bs)-4)/aclEntrySize)
+	for i := range acl {
+		off := 4 + i*aclEntrySize
+		acl[i] = ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(bs[off:])),
+			Perm: binary.LittleEndian.Uint16(bs[off+2:]),
+		}
+		if acl[i].Tag == ACLUser || acl[i].Tag == ACLGroup {
+			acl[i].ID = binary.LittleEndian.Uint32(bs[off+4:])
+		}
+	}
+	return acl, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func getACL(path string) (ACL, error) {
+	bs := make([]byte, 256)
+	for {
+		n, err := unix.Lgetxattr(path, aclXattrName, bs)
+		switch err {
+		case nil:
+			return unmarshalACL(bs[:n])
+		case unix.ERANGE:
+			// The buffer is too small, ask for the size and retry.
+			if n, err = unix.Lgetxattr(path, aclXattrName, nil); err != nil {
+				return nil, err
+			}
+			bs = make([]byte, n)
+		case unix.ENODATA, unix.ENOTSUP:
+			// No ACL, or no support for ACLs on this filesystem.
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+func setACL(path string, acl ACL) error {
+	var err error
+	if acl == nil {
+		err = unix.Lremovexattr(path, aclXattrName)
+		if err == unix.ENODATA {
+			err = nil
+		}
+	} else {
+		err = unix.Lsetxattr(path, aclXattrName, marshalACL(acl), 0)
+	}
+	if err == unix.ENOTSUP {
+		return nil
+	}
+	return err
+}
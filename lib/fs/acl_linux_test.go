@@ -0,0 +1,85 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestACLRoundTrip(t *testing.T) {
+	fs, dir := setup(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"first", "second"} {
+		fd, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd.Close()
+	}
+
+	if acl, err := fs.GetACL("first"); err != nil || acl != nil {
+		t.Fatalf("got ACL %v, %v for a new file, expected none", acl, err)
+	}
+
+	acl := ACL{
+		{Tag: ACLUserObj, Perm: 6},
+		{Tag: ACLUser, ID: 12345, Perm: 4},
+		{Tag: ACLGroupObj, Perm: 4},
+		{Tag: ACLGroup, ID: 23456, Perm: 6},
+		{Tag: ACLMask, Perm: 6},
+		{Tag: ACLOther, Perm: 0},
+	}
+	if err := fs.SetACL("first", acl); err != nil {
+		t.Fatal(err)
+	}
+	read, err := fs.GetACL("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read == nil {
+		t.Skip("filesystem doesn't support ACLs")
+	}
+	if !reflect.DeepEqual(read, acl) {
+		t.Fatalf("read ACL %v, expected %v", read, acl)
+	}
+
+	// Reapply what was read to another file.
+
+	if err := fs.SetACL("second", read); err != nil {
+		t.Fatal(err)
+	}
+	if second, err := fs.GetACL("second"); err != nil || !reflect.DeepEqual(second, acl) {
+		t.Fatalf("second file has ACL %v, %v, expected %v", second, err, acl)
+	}
+
+	// A symlink to the file doesn't have its ACL, nor can it be given one.
+
+	if err := fs.CreateSymlink("first", "link"); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := fs.GetACL("link"); err != nil || link != nil {
+		t.Fatalf("symlink has ACL %v, %v, expected the target's not to be followed", link, err)
+	}
+	if err := fs.SetACL("link", nil); err != nil {
+		t.Fatal(err)
+	}
+	if first, err := fs.GetACL("first"); err != nil || !reflect.DeepEqual(first, acl) {
+		t.Fatalf("first file has ACL %v, %v after removing it from the symlink, expected %v", first, err, acl)
+	}
+
+	// The ACL can be removed again.
+
+	if err := fs.SetACL("second", nil); err != nil {
+		t.Fatal(err)
+	}
+	if second, err := fs.GetACL("second"); err != nil || second != nil {
+		t.Fatalf("second file has ACL %v, %v after removal", second, err)
+	}
+}
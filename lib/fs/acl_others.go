@@ -0,0 +1,19 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build !linux
+
+package fs
+
+// POSIX ACLs are only supported on Linux, elsewhere they are ignored.
+
+func getACL(string) (ACL, error) {
+	return nil, nil
+}
+
+func setACL(string, ACL) error {
+	return nil
+}
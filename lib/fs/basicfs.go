@@ -107,6 +107,22 @@ func (f *BasicFilesystem) Lchown(name string, uid, gid int) error {
 	return os.Lchown(name, uid, gid)
 }
 
+func (f *BasicFilesystem) GetACL(name string) (ACL, error) {
+	name, err := f.rooted(name)
+	if err != nil {
+		return nil, err
+	}
+	return getACL(name)
+}
+
+func (f *BasicFilesystem) SetACL(name string, acl ACL) error {
+	name, err := f.rooted(name)
+	if err != nil {
+		return err
+	}
+	return setACL(name, acl)
+}
+
 func (f *BasicFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	name, err := f.rooted(name)
 	if err != nil {
@@ -145,7 +161,7 @@ func (f *BasicFilesystem) Lstat(name string) (FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return basicFileInfo{fi}, err
+	return basicFileInfo{FileInfo: fi, reparsePoint: reparsePointOf(name, fi)}, err
 }
 
 func (f *BasicFilesystem) Remove(name string) error {
@@ -176,6 +192,18 @@ func (f *BasicFilesystem) Rename(oldpath, newpath string) error {
 	return os.Rename(oldpath, newpath)
 }
 
+func (f *BasicFilesystem) Hardlink(oldname, newname string) error {
+	oldname, err := f.rooted(oldname)
+	if err != nil {
+		return err
+	}
+	newname, err = f.rooted(newname)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
 func (f *BasicFilesystem) Stat(name string) (FileInfo, error) {
 	name, err := f.rooted(name)
 	if err != nil {
@@ -185,7 +213,7 @@ func (f *BasicFilesystem) Stat(name string) (FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return basicFileInfo{fi}, err
+	return basicFileInfo{FileInfo: fi}, err
 }
 
 func (f *BasicFilesystem) DirNames(name string) ([]string, error) {
@@ -311,12 +339,13 @@ func (f basicFile) Stat() (FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return basicFileInfo{info}, nil
+	return basicFileInfo{FileInfo: info}, nil
 }
 
 // basicFileInfo implements the fs.FileInfo interface on top of an os.FileInfo.
 type basicFileInfo struct {
 	os.FileInfo
+	reparsePoint ReparsePoint // only set by Lstat
 }
 
 func (e basicFileInfo) IsSymlink() bool {
@@ -329,6 +358,10 @@ func (e basicFileInfo) IsRegular() bool {
 	return e.Mode()&ModeType == 0
 }
 
+func (e basicFileInfo) ReparsePoint() ReparsePoint {
+	return e.reparsePoint
+}
+
 // longFilenameSupport adds the necessary prefix to the path to enable long
 // filename support on windows if necessary.
 // This does NOT check the current system, i.e. will also take effect on unix paths.
@@ -8,7 +8,10 @@
 
 package fs
 
-import "syscall"
+import (
+	"fmt"
+	"syscall"
+)
 
 func (e basicFileInfo) Mode() FileMode {
 	return FileMode(e.FileInfo.Mode())
@@ -27,3 +30,10 @@ func (e basicFileInfo) Group() int {
 	}
 	return -1
 }
+
+func (e basicFileInfo) HardlinkID() string {
+	if st, ok := e.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 && e.IsRegular() {
+		return fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+	}
+	return ""
+}
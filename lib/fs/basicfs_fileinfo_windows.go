@@ -37,6 +37,11 @@ func (e basicFileInfo) Mode() FileMode {
 		// NTFS deduped files. Remove the symlink bit.
 		m &^= os.ModeSymlink
 	}
+	if e.reparsePoint == ReparsePointJunction || e.reparsePoint == ReparsePointMountPoint {
+		// Junctions and mount points look like symlinks (or irregular
+		// files, depending on the Go version), but are neither.
+		m = m&os.ModePerm | os.ModeIrregular
+	}
 	// Set executable bits on files with executable extenions (.exe, .bat, etc).
 	if isWindowsExecutable(e.Name()) {
 		m |= 0111
@@ -56,3 +61,7 @@ func (e basicFileInfo) Owner() int {
 func (e basicFileInfo) Group() int {
 	return -1
 }
+
+func (e basicFileInfo) HardlinkID() string {
+	return ""
+}
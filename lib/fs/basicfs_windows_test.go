@@ -10,6 +10,7 @@ package fs
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -193,3 +194,50 @@ func TestGetFinalPath(t *testing.T) {
 		}
 	}
 }
+
+func TestJunction(t *testing.T) {
+	fs, dir := setup(t)
+	defer os.RemoveAll(dir)
+
+	if err := fs.MkdirAll("target", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createJunction(filepath.Join(dir, "target"), filepath.Join(dir, "junction")); err != nil {
+		t.Skip("Can't create junction:", err)
+	}
+	if err := fs.CreateSymlink("target", "symlink"); err != nil {
+		// Requires privileges or developer mode
+		t.Log("Can't create symlink:", err)
+	} else {
+		info, err := fs.Lstat("symlink")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rp := info.ReparsePoint(); rp != ReparsePointSymlink || !info.IsSymlink() {
+			t.Errorf("symlink classified as %v, symlink %v", rp, info.IsSymlink())
+		}
+	}
+
+	info, err := fs.Lstat("junction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp := info.ReparsePoint(); rp != ReparsePointJunction {
+		t.Errorf("junction classified as %v", rp)
+	}
+	if info.IsSymlink() || info.IsDir() || info.IsRegular() || info.Mode()&ModeIrregular == 0 {
+		t.Errorf("junction should be irregular, got mode %v", info.Mode())
+	}
+
+	info, err = fs.Lstat("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp := info.ReparsePoint(); rp != ReparsePointNone {
+		t.Errorf("directory classified as %v", rp)
+	}
+}
+
+func createJunction(target, name string) error {
+	return exec.Command("cmd", "/c", "mklink", "/J", name, target).Run()
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"errors"
+	"io"
+)
+
+var errCopyRangeNotSupported = errors.New("optimised copy not supported on this platform")
+
+type copyRangeMethod int
+
+const (
+	copyRangeMethodStandard copyRangeMethod = iota
+	copyRangeMethodIoctl
+	copyRangeMethodCopyFileRange
+)
+
+func (m copyRangeMethod) String() string {
+	switch m {
+	case copyRangeMethodIoctl:
+		return "ioctl"
+	case copyRangeMethodCopyFileRange:
+		return "copy_file_range"
+	default:
+		return "standard"
+	}
+}
+
+// CopyRange copies size bytes from src at srcOffset to dst at dstOffset.
+// When both files are on a BasicFilesystem that supports it the data is
+// shared (reflinked) or copied within the kernel; otherwise, or when that
+// fails, the data is copied through a buffer.
+func CopyRange(src, dst File, srcOffset, dstOffset, size int64) error {
+	_, err := copyRange(src, dst, srcOffset, dstOffset, size)
+	return err
+}
+
+// copyRange is CopyRange, additionally returning the method that was used.
+func copyRange(src, dst File, srcOffset, dstOffset, size int64) (copyRangeMethod, error) {
+	srcFile, srcOk := unwrapBasicFile(src)
+	dstFile, dstOk := unwrapBasicFile(dst)
+	if srcOk && dstOk {
+		method, err := copyRangeOptimised(srcFile, dstFile, srcOffset, dstOffset, size)
+		if err == nil {
+			return method, nil
+		}
+		if err != errCopyRangeNotSupported {
+			l.Debugf("Optimised copy of %s to %s failed, falling back: %v", src.Name(), dst.Name(), err)
+		}
+	}
+	return copyRangeMethodStandard, copyRangeStandard(src, dst, srcOffset, dstOffset, size)
+}
+
+// unwrapBasicFile returns the basicFile underneath any wrapping done by
+// the filesystem layers, such as the MtimeFS.
+func unwrapBasicFile(f File) (basicFile, bool) {
+	for {
+		switch file := f.(type) {
+		case basicFile:
+			return file, true
+		case *mtimeFile:
+			f = file.File
+		default:
+			return basicFile{}, false
+		}
+	}
+}
+
+func copyRangeStandard(src, dst File, srcOffset, dstOffset, size int64) error {
+	bufSize := int64(4 << 20)
+	if size < bufSize {
+		bufSize = size
+	}
+	buf := make([]byte, bufSize)
+
+	for size > 0 {
+		if int64(len(buf)) > size {
+			buf = buf[:size]
+		}
+		n, err := src.ReadAt(buf, srcOffset)
+		if err == io.EOF && n == len(buf) {
+			err = nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err := dst.WriteAt(buf[:n], dstOffset); err != nil {
+			return err
+		}
+		srcOffset += int64(n)
+		dstOffset += int64(n)
+		size -= int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"io"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileCloneRange is struct file_clone_range from linux/fs.h
+type fileCloneRange struct {
+	srcFd      int64
+	srcOffset  uint64
+	srcLength  uint64
+	destOffset uint64
+}
+
+// ficloneRange is the FICLONERANGE ioctl request, _IOW(0x94, 13, struct
+// file_clone_range). The direction bits are encoded differently on a few
+// architectures.
+var ficloneRange = func() uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le":
+		return 0x8020940d
+	default:
+		return 0x4020940d
+	}
+}()
+
+func copyRangeOptimised(src, dst basicFile, srcOffset, dstOffset, size int64) (copyRangeMethod, error) {
+	// Cloning shares the extents between the files (Btrfs, XFS), but
+	// requires the offsets and size to be aligned to the filesystem block
+	// size, which is usually the case for our blocks.
+	if err := copyRangeIoctl(src, dst, srcOffset, dstOffset, size); err == nil {
+		return copyRangeMethodIoctl, nil
+	}
+	if err := copyRangeCopyFileRange(src, dst, srcOffset, dstOffset, size); err != nil {
+		return copyRangeMethodStandard, err
+	}
+	return copyRangeMethodCopyFileRange, nil
+}
+
+func copyRangeIoctl(src, dst basicFile, srcOffset, dstOffset, size int64) error {
+	params := fileCloneRange{
+		srcFd:      int64(src.Fd()),
+		srcOffset:  uint64(srcOffset),
+		srcLength:  uint64(size),
+		destOffset: uint64(dstOffset),
+	}
+	_, _, e := unix.Syscall(unix.SYS_IOCTL, dst.Fd(), ficloneRange, uintptr(unsafe.Pointer(&params)))
+	runtime.KeepAlive(src)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+func copyRangeCopyFileRange(src, dst basicFile, srcOffset, dstOffset, size int64) error {
+	for size > 0 {
+		// The offsets are advanced by the kernel.
+		n, err := unix.CopyFileRange(int(src.Fd()), &srcOffset, int(dst.Fd()), &dstOffset, int(size), 0)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Past the end of the source file.
+			return io.ErrUnexpectedEOF
+		}
+		size -= int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build !linux
+
+package fs
+
+// copyRangeOptimised is not implemented on this platform. On macOS
+// clonefile(2) only clones entire files, which doesn't help with copying
+// single blocks into a temporary file.
+func copyRangeOptimised(_, _ basicFile, _, _, _ int64) (copyRangeMethod, error) {
+	return copyRangeMethodStandard, errCopyRangeNotSupported
+}
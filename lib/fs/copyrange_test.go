@@ -0,0 +1,131 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/rand"
+)
+
+const copyRangeBlockSize = 128 << 10
+
+type copyRangeFunc func(src, dst File, srcOffset, dstOffset, size int64) error
+
+func testCopyRange(t *testing.T, copyFn copyRangeFunc) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs := NewMtimeFS(NewFilesystem(FilesystemTypeBasic, dir), make(mapStore))
+
+	data := make([]byte, 4*copyRangeBlockSize)
+	if _, err := rand.Reader.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := fs.Create("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := fs.Create("dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.Truncate(int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy the second and third blocks of the source to the start of the
+	// destination, and the first block to the end.
+	if err := copyFn(src, dst, copyRangeBlockSize, 0, 2*copyRangeBlockSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFn(src, dst, 0, 3*copyRangeBlockSize, copyRangeBlockSize); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]byte, len(data))
+	copy(expected, data[copyRangeBlockSize:3*copyRangeBlockSize])
+	copy(expected[3*copyRangeBlockSize:], data[:copyRangeBlockSize])
+
+	actual := make([]byte, len(data))
+	if _, err := dst.ReadAt(actual, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Error("destination does not contain the expected data")
+	}
+
+	// Copying beyond the end of the source is an error.
+	if err := copyFn(src, dst, 4*copyRangeBlockSize, 0, copyRangeBlockSize); err == nil {
+		t.Error("expected error copying beyond the end of the source")
+	}
+}
+
+func TestCopyRangeStandard(t *testing.T) {
+	testCopyRange(t, copyRangeStandard)
+}
+
+func TestCopyRange(t *testing.T) {
+	var methods []copyRangeMethod
+	testCopyRange(t, func(src, dst File, srcOffset, dstOffset, size int64) error {
+		method, err := copyRange(src, dst, srcOffset, dstOffset, size)
+		if err == nil {
+			methods = append(methods, method)
+		}
+		return err
+	})
+
+	for _, method := range methods {
+		switch {
+		case runtime.GOOS != "linux" && method != copyRangeMethodStandard:
+			t.Errorf("copied using %v, expected standard copy", method)
+		case method == copyRangeMethodStandard:
+			// Old kernel or a filesystem not supporting either method.
+			t.Log("optimised copying not supported in", os.TempDir())
+		default:
+			t.Log("copied using", method)
+		}
+	}
+}
+
+func TestCopyRangeFallback(t *testing.T) {
+	fs := newFakeFilesystem("/TestCopyRangeFallback")
+	src, err := fs.Create("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Write(make([]byte, copyRangeBlockSize)); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := fs.Create("dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, err := copyRange(src, dst, 0, 0, copyRangeBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != copyRangeMethodStandard {
+		t.Errorf("copied using %v, expected standard copy", method)
+	}
+}
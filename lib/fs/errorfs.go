@@ -22,6 +22,7 @@ func (fs *errorFilesystem) Lchown(name string, uid, gid int) error
 func (fs *errorFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error { return fs.err }
 func (fs *errorFilesystem) Create(name string) (File, error)                            { return nil, fs.err }
 func (fs *errorFilesystem) CreateSymlink(target, name string) error                     { return fs.err }
+func (fs *errorFilesystem) Hardlink(oldname, newname string) error                      { return fs.err }
 func (fs *errorFilesystem) DirNames(name string) ([]string, error)                      { return nil, fs.err }
 func (fs *errorFilesystem) Lstat(name string) (FileInfo, error)                         { return nil, fs.err }
 func (fs *errorFilesystem) Mkdir(name string, perm FileMode) error                      { return fs.err }
@@ -44,6 +45,8 @@ func (fs *errorFilesystem) Usage(name string) (Usage, error)
 func (fs *errorFilesystem) Type() FilesystemType                                        { return fs.fsType }
 func (fs *errorFilesystem) URI() string                                                 { return fs.uri }
 func (fs *errorFilesystem) SameFile(fi1, fi2 FileInfo) bool                             { return false }
+func (fs *errorFilesystem) GetACL(name string) (ACL, error)                             { return nil, fs.err }
+func (fs *errorFilesystem) SetACL(name string, acl ACL) error                           { return fs.err }
 func (fs *errorFilesystem) Watch(path string, ignore Matcher, ctx context.Context, ignorePerms bool) (<-chan Event, <-chan error, error) {
 	return nil, nil, fs.err
 }
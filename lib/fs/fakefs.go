@@ -31,7 +31,8 @@ const randomBlockShift = 14 // 128k
 //
 // - File metadata is kept in RAM. Specifically, we remember which files and
 //   directories exist, their dates, permissions and sizes. Symlinks are
-//   not supported.
+//   not supported. Hardlinked names share the metadata and contents of the
+//   first name.
 //
 // - File contents are generated pseudorandomly with just the file name as
 //   seed. Writes are discarded, other than having the effect of increasing
@@ -52,9 +53,10 @@ const randomBlockShift = 14 // 128k
 // - Two fakefs:s pointing at the same root path see the same files.
 //
 type fakefs struct {
-	mut    sync.Mutex
-	root   *fakeEntry
-	insens bool
+	mut     sync.Mutex
+	root    *fakeEntry
+	insens  bool
+	lastIno uint64
 }
 
 var (
@@ -149,8 +151,18 @@ type fakeEntry struct {
 	mode      FileMode
 	uid       int
 	gid       int
+	acl       ACL
 	mtime     time.Time
 	children  map[string]*fakeEntry
+	links     int    // additional names of a hardlinked file
+	ino       uint64 // set when first hardlinked
+}
+
+// unlink is called when a name of the entry is removed.
+func (e *fakeEntry) unlink() {
+	if e.links > 0 {
+		e.links--
+	}
 }
 
 func (fs *fakefs) entryForName(name string) *fakeEntry {
@@ -203,6 +215,27 @@ func (fs *fakefs) Lchown(name string, uid, gid int) error {
 	return nil
 }
 
+func (fs *fakefs) GetACL(name string) (ACL, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	entry := fs.entryForName(name)
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	return append(ACL(nil), entry.acl...), nil
+}
+
+func (fs *fakefs) SetACL(name string, acl ACL) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	entry := fs.entryForName(name)
+	if entry == nil {
+		return os.ErrNotExist
+	}
+	entry.acl = append(ACL(nil), acl...)
+	return nil
+}
+
 func (fs *fakefs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
@@ -271,6 +304,40 @@ func (fs *fakefs) CreateSymlink(target, name string) error {
 	return nil
 }
 
+func (fs *fakefs) Hardlink(oldname, newname string) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	entry := fs.entryForName(oldname)
+	if entry == nil {
+		return os.ErrNotExist
+	} else if entry.entryType != fakeEntryTypeFile {
+		return errors.New("not a regular file")
+	}
+
+	dir := fs.entryForName(filepath.Dir(newname))
+	if dir == nil {
+		return os.ErrNotExist
+	} else if dir.entryType != fakeEntryTypeDir {
+		return errors.New("not a directory")
+	}
+	key := filepath.Base(newname)
+	if fs.insens {
+		key = UnicodeLowercase(key)
+	}
+	if _, ok := dir.children[key]; ok {
+		return os.ErrExist
+	}
+
+	if entry.ino == 0 {
+		fs.lastIno++
+		entry.ino = fs.lastIno
+	}
+	entry.links++
+	dir.children[key] = entry
+	return nil
+}
+
 func (fs *fakefs) DirNames(name string) ([]string, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
@@ -281,8 +348,14 @@ func (fs *fakefs) DirNames(name string) ([]string, error) {
 	}
 
 	names := make([]string, 0, len(entry.children))
-	for _, child := range entry.children {
-		names = append(names, child.name)
+	for key, child := range entry.children {
+		name := child.name
+		if child.links > 0 && UnicodeLowercase(name) != UnicodeLowercase(key) {
+			// Not the first name of a hardlinked file. Case insensitive
+			// filesystems only know the lower case key.
+			name = key
+		}
+		names = append(names, name)
 	}
 
 	return names, nil
@@ -298,7 +371,7 @@ func (fs *fakefs) Lstat(name string) (FileInfo, error) {
 	}
 
 	info := &fakeFileInfo{*entry}
-	if fs.insens {
+	if fs.insens || entry.links > 0 {
 		info.name = filepath.Base(name)
 	}
 
@@ -450,6 +523,7 @@ func (fs *fakefs) Remove(name string) error {
 	if len(entry.children) != 0 {
 		return errors.New("not empty")
 	}
+	entry.unlink()
 
 	entry = fs.entryForName(filepath.Dir(name))
 	delete(entry.children, filepath.Base(name))
@@ -471,6 +545,9 @@ func (fs *fakefs) RemoveAll(name string) error {
 
 	// RemoveAll is easy when the file system uses garbage collection under
 	// the hood... We even get the correct semantics for open fd:s for free.
+	if child, ok := entry.children[filepath.Base(name)]; ok {
+		child.unlink()
+	}
 	delete(entry.children, filepath.Base(name))
 	return nil
 }
@@ -513,10 +590,18 @@ func (fs *fakefs) Rename(oldname, newname string) error {
 		if dst.entryType == fakeEntryTypeDir {
 			return errors.New("is a directory")
 		}
+		if dst == entry {
+			// Both are names of the same hardlinked file.
+			return nil
+		}
+		dst.unlink()
 	}
 
 	p1.children[newKey] = entry
-	entry.name = filepath.Base(newname)
+	if entry.links == 0 {
+		// Hardlinked files keep the first name, which seeds the contents.
+		entry.name = filepath.Base(newname)
+	}
 
 	delete(p0.children, oldKey)
 
@@ -819,6 +904,10 @@ func (f *fakeFileInfo) IsSymlink() bool {
 	return f.entryType == fakeEntryTypeSymlink
 }
 
+func (f *fakeFileInfo) ReparsePoint() ReparsePoint {
+	return ReparsePointNone
+}
+
 func (f *fakeFileInfo) Owner() int {
 	return f.uid
 }
@@ -826,3 +915,10 @@ func (f *fakeFileInfo) Owner() int {
 func (f *fakeFileInfo) Group() int {
 	return f.gid
 }
+
+func (f *fakeFileInfo) HardlinkID() string {
+	if f.links > 0 && f.entryType == fakeEntryTypeFile {
+		return strconv.FormatUint(f.ino, 10)
+	}
+	return ""
+}
@@ -23,6 +23,9 @@ type Filesystem interface {
 	Chtimes(name string, atime time.Time, mtime time.Time) error
 	Create(name string) (File, error)
 	CreateSymlink(target, name string) error
+	// Hardlink creates newname as an additional name for the existing
+	// file oldname.
+	Hardlink(oldname, newname string) error
 	DirNames(name string) ([]string, error)
 	Lstat(name string) (FileInfo, error)
 	Mkdir(name string, perm FileMode) error
@@ -48,6 +51,11 @@ type Filesystem interface {
 	Type() FilesystemType
 	URI() string
 	SameFile(fi1, fi2 FileInfo) bool
+	// GetACL returns the POSIX access ACL of the named item, or nil if it
+	// has none or ACLs aren't supported. SetACL replaces it, removing it
+	// when nil, and does nothing where ACLs aren't supported.
+	GetACL(name string) (ACL, error)
+	SetACL(name string, acl ACL) error
 }
 
 // The File interface abstracts access to a regular file, being a somewhat
@@ -78,8 +86,13 @@ type FileInfo interface {
 	// Extensions
 	IsRegular() bool
 	IsSymlink() bool
+	ReparsePoint() ReparsePoint
 	Owner() int
 	Group() int
+	// HardlinkID identifies the underlying file of a regular file with
+	// more than one name, being the same for all its names, and is empty
+	// otherwise or where unsupported.
+	HardlinkID() string
 }
 
 // FileMode is similar to os.FileMode
@@ -144,6 +157,7 @@ const ModeSetgid = FileMode(os.ModeSetgid)
 const ModeSetuid = FileMode(os.ModeSetuid)
 const ModeSticky = FileMode(os.ModeSticky)
 const ModeSymlink = FileMode(os.ModeSymlink)
+const ModeIrregular = FileMode(os.ModeIrregular)
 const ModeType = FileMode(os.ModeType)
 const PathSeparator = os.PathSeparator
 const OptAppend = os.O_APPEND
@@ -172,7 +186,7 @@ var IsPermission = os.IsPermission
 // IsPathSeparator is the equivalent of os.IsPathSeparator
 var IsPathSeparator = os.IsPathSeparator
 
-func NewFilesystem(fsType FilesystemType, uri string) Filesystem {
+func NewFilesystem(fsType FilesystemType, uri string, opts ...WalkOption) Filesystem {
 	var fs Filesystem
 	switch fsType {
 	case FilesystemTypeBasic:
@@ -189,14 +203,14 @@ func NewFilesystem(fsType FilesystemType, uri string) Filesystem {
 	}
 
 	if l.ShouldDebug("walkfs") {
-		return NewWalkFilesystem(&logFilesystem{fs})
+		return NewWalkFilesystem(&logFilesystem{fs}, opts...)
 	}
 
 	if l.ShouldDebug("fs") {
-		return &logFilesystem{NewWalkFilesystem(fs)}
+		return &logFilesystem{NewWalkFilesystem(fs, opts...)}
 	}
 
-	return NewWalkFilesystem(fs)
+	return NewWalkFilesystem(fs, opts...)
 }
 
 // IsInternal returns true if the file, as a path relative to the folder
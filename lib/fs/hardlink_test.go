@@ -0,0 +1,119 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func testHardlink(t *testing.T, fs Filesystem) {
+	t.Helper()
+
+	fd, err := fs.Create("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fd.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	info, err := fs.Lstat("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := info.HardlinkID(); id != "" {
+		t.Errorf("Unexpected hardlink ID %q for a single name", id)
+	}
+
+	if err := fs.Hardlink("first", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Hardlink("first", "second"); err == nil {
+		t.Error("Expected an error linking to an existing name")
+	}
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Hardlink("dir", "dir2"); err == nil {
+		t.Error("Expected an error linking a directory")
+	}
+
+	first, err := fs.Lstat("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fs.Lstat("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.HardlinkID() == "" || first.HardlinkID() != second.HardlinkID() {
+		t.Errorf("Expected equal hardlink IDs, got %q and %q", first.HardlinkID(), second.HardlinkID())
+	}
+	if second.Name() != "second" || second.Size() != 5 {
+		t.Errorf("Unexpected second name %v, size %v", second.Name(), second.Size())
+	}
+	names, err := fs.DirNames(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if len(names) < 3 || names[len(names)-2] != "first" || names[len(names)-1] != "second" {
+		t.Errorf("Unexpected names %v", names)
+	}
+
+	// Writes through one name are seen through the other.
+	fd, err = fs.OpenFile("second", OptReadWrite, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fd.WriteAt([]byte("!"), 5); err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+	if info, err := fs.Lstat("first"); err != nil || info.Size() != 6 {
+		t.Errorf("Unexpected first after write %v, %v", info, err)
+	}
+
+	// Renaming keeps the link, removing one name ends it.
+	if err := fs.Rename("second", "third"); err != nil {
+		t.Fatal(err)
+	}
+	third, err := fs.Lstat("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.HardlinkID() != first.HardlinkID() {
+		t.Errorf("Hardlink ID changed on rename, %q != %q", third.HardlinkID(), first.HardlinkID())
+	}
+	if err := fs.Remove("first"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fs.Lstat("third"); err != nil || info.HardlinkID() != "" {
+		t.Errorf("Expected no hardlink after removing a name, got %v, %v", info, err)
+	}
+}
+
+func TestFakeFSHardlink(t *testing.T) {
+	testHardlink(t, newFakeFilesystem("/hardlink"))
+}
+
+func TestBasicHardlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hardlinks aren't detected on Windows")
+	}
+	dir, err := ioutil.TempDir("", "syncthing-hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testHardlink(t, newBasicFilesystem(dir))
+}
@@ -38,6 +38,18 @@ func (fs *logFilesystem) Chtimes(name string, atime time.Time, mtime time.Time)
 	return err
 }
 
+func (fs *logFilesystem) GetACL(name string) (ACL, error) {
+	acl, err := fs.Filesystem.GetACL(name)
+	l.Debugln(getCaller(), fs.Type(), fs.URI(), "GetACL", name, acl, err)
+	return acl, err
+}
+
+func (fs *logFilesystem) SetACL(name string, acl ACL) error {
+	err := fs.Filesystem.SetACL(name, acl)
+	l.Debugln(getCaller(), fs.Type(), fs.URI(), "SetACL", name, acl, err)
+	return err
+}
+
 func (fs *logFilesystem) Create(name string) (File, error) {
 	file, err := fs.Filesystem.Create(name)
 	l.Debugln(getCaller(), fs.Type(), fs.URI(), "Create", name, file, err)
@@ -50,6 +62,12 @@ func (fs *logFilesystem) CreateSymlink(target, name string) error {
 	return err
 }
 
+func (fs *logFilesystem) Hardlink(oldname, newname string) error {
+	err := fs.Filesystem.Hardlink(oldname, newname)
+	l.Debugln(getCaller(), fs.Type(), fs.URI(), "Hardlink", oldname, newname, err)
+	return err
+}
+
 func (fs *logFilesystem) DirNames(name string) ([]string, error) {
 	names, err := fs.Filesystem.DirNames(name)
 	l.Debugln(getCaller(), fs.Type(), fs.URI(), "DirNames", name, names, err)
@@ -0,0 +1,34 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+// ReparsePoint is the kind of Windows reparse point a file is. Junctions
+// and mount points are reported by Lstat with ModeIrregular, not as
+// symlinks, as they can't be handled as such.
+type ReparsePoint int
+
+const (
+	ReparsePointNone       ReparsePoint = iota // not a reparse point, or one we don't care about
+	ReparsePointSymlink                        // a symbolic link
+	ReparsePointJunction                       // a directory junction
+	ReparsePointMountPoint                     // a volume mounted at a directory
+)
+
+func (p ReparsePoint) String() string {
+	switch p {
+	case ReparsePointNone:
+		return "none"
+	case ReparsePointSymlink:
+		return "symlink"
+	case ReparsePointJunction:
+		return "junction"
+	case ReparsePointMountPoint:
+		return "mount point"
+	default:
+		return "unknown"
+	}
+}
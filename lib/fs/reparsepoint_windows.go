@@ -0,0 +1,91 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build windows
+
+package fs
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+)
+
+const ioReparseTagMountPoint = 0xA0000003 // IO_REPARSE_TAG_MOUNT_POINT, missing from syscall
+
+// reparsePointOf returns the kind of reparse point the file with the given
+// (Lstat) info is.
+func reparsePointOf(name string, fi os.FileInfo) ReparsePoint {
+	attrs, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+		return ReparsePointNone
+	}
+
+	buf, err := readReparseData(name)
+	if err != nil {
+		l.Debugf("Reading reparse point %v: %v", name, err)
+		return ReparsePointNone
+	}
+
+	switch binary.LittleEndian.Uint32(buf) {
+	case syscall.IO_REPARSE_TAG_SYMLINK:
+		return ReparsePointSymlink
+
+	case ioReparseTagMountPoint:
+		// Junctions and mount points share the tag, but mount points have
+		// a volume as the target. The mount point reparse buffer is the
+		// tag (4 bytes), data length and reserved (2+2 bytes), substitute
+		// name offset and length (2+2 bytes), print name offset and length
+		// (2+2 bytes) and the path buffer.
+		if len(buf) < 16 {
+			return ReparsePointJunction
+		}
+		start := 16 + int(binary.LittleEndian.Uint16(buf[8:]))
+		end := start + int(binary.LittleEndian.Uint16(buf[10:]))
+		if end > len(buf) {
+			return ReparsePointJunction
+		}
+		if strings.HasPrefix(utf16BytesToString(buf[start:end]), `\??\Volume{`) {
+			return ReparsePointMountPoint
+		}
+		return ReparsePointJunction
+
+	default:
+		return ReparsePointNone
+	}
+}
+
+func readReparseData(name string) ([]byte, error) {
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(namep, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_OPEN_REPARSE_POINT|syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+
+	buf := make([]byte, syscall.MAXIMUM_REPARSE_DATA_BUFFER_SIZE)
+	var n uint32
+	if err := syscall.DeviceIoControl(h, syscall.FSCTL_GET_REPARSE_POINT, nil, 0, &buf[0], uint32(len(buf)), &n, nil); err != nil {
+		return nil, err
+	}
+	if n < 4 {
+		return nil, syscall.EINVAL
+	}
+	return buf[:n], nil
+}
+
+func utf16BytesToString(b []byte) string {
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(s))
+}
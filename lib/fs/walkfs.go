@@ -10,7 +10,10 @@
 
 package fs
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"sort"
+)
 
 // WalkFunc is the type of the function called for each file or directory
 // visited by Walk. The path argument contains the argument to Walk as a
@@ -30,14 +33,34 @@ type WalkFunc func(path string, info FileInfo, err error) error
 
 type walkFilesystem struct {
 	Filesystem
+	followSymlinks int // max number of symlinks to follow in a path
 }
 
-func NewWalkFilesystem(next Filesystem) Filesystem {
-	return &walkFilesystem{next}
+// A WalkOption can be passed to NewWalkFilesystem and NewFilesystem.
+type WalkOption func(*walkFilesystem)
+
+// WithFollowSymlinks makes Walk follow symlinks and junctions, walking their
+// targets as regular content, up to maxDepth symlinks deep. Symlinks that
+// would cause a cycle are not followed. The default is to not follow
+// symlinks.
+func WithFollowSymlinks(maxDepth int) WalkOption {
+	return func(f *walkFilesystem) {
+		f.followSymlinks = maxDepth
+	}
+}
+
+func NewWalkFilesystem(next Filesystem, opts ...WalkOption) Filesystem {
+	f := &walkFilesystem{Filesystem: next}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-// walk recursively descends path, calling walkFn.
-func (f *walkFilesystem) walk(path string, info FileInfo, walkFn WalkFunc) error {
+// walk recursively descends path, calling walkFn. The ancestors are the
+// directories above path, only tracked when following symlinks, and
+// symlinks is the number of symlinks followed to get to path.
+func (f *walkFilesystem) walk(path string, info FileInfo, ancestors []FileInfo, symlinks int, walkFn WalkFunc) error {
 	path, err := Canonicalize(path)
 	if err != nil {
 		return err
@@ -59,16 +82,30 @@ func (f *walkFilesystem) walk(path string, info FileInfo, walkFn WalkFunc) error
 	if err != nil {
 		return walkFn(path, info, err)
 	}
+	// Walk in lexical order, so that the first name of a hardlinked file
+	// is the same in every walk.
+	sort.Strings(names)
+
+	if f.followSymlinks > 0 {
+		ancestors = append(ancestors, info)
+	}
 
 	for _, name := range names {
 		filename := filepath.Join(path, name)
 		fileInfo, err := f.Lstat(filename)
+		fileSymlinks := symlinks
+		if err == nil && (fileInfo.IsSymlink() || fileInfo.ReparsePoint() == ReparsePointJunction) && symlinks < f.followSymlinks {
+			if target, ok := f.followSymlink(filename, ancestors); ok {
+				fileInfo = target
+				fileSymlinks++
+			}
+		}
 		if err != nil {
 			if err := walkFn(filename, fileInfo, err); err != nil && err != SkipDir {
 				return err
 			}
 		} else {
-			err = f.walk(filename, fileInfo, walkFn)
+			err = f.walk(filename, fileInfo, ancestors, fileSymlinks, walkFn)
 			if err != nil {
 				if !fileInfo.IsDir() || err != SkipDir {
 					return err
@@ -79,16 +116,35 @@ func (f *walkFilesystem) walk(path string, info FileInfo, walkFn WalkFunc) error
 	return nil
 }
 
+// followSymlink returns the info of the symlink's target, and false if it
+// is broken or leads to one of the ancestors.
+func (f *walkFilesystem) followSymlink(name string, ancestors []FileInfo) (FileInfo, bool) {
+	target, err := f.Stat(name)
+	if err != nil {
+		l.Debugf("Not following symlink %v: %v", name, err)
+		return nil, false
+	}
+	if target.IsDir() {
+		for _, ancestor := range ancestors {
+			if f.SameFile(target, ancestor) {
+				l.Debugf("Not following symlink %v: cycle", name)
+				return nil, false
+			}
+		}
+	}
+	return target, true
+}
+
 // Walk walks the file tree rooted at root, calling walkFn for each file or
 // directory in the tree, including root. All errors that arise visiting files
 // and directories are filtered by walkFn. The files are walked in lexical
 // order, which makes the output deterministic but means that for very
 // large directories Walk can be inefficient.
-// Walk does not follow symbolic links.
+// Walk does not follow symbolic links, unless enabled by WithFollowSymlinks.
 func (f *walkFilesystem) Walk(root string, walkFn WalkFunc) error {
 	info, err := f.Lstat(root)
 	if err != nil {
 		return walkFn(root, nil, err)
 	}
-	return f.walk(root, info, walkFn)
+	return f.walk(root, info, nil, 0, walkFn)
 }
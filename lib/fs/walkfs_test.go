@@ -7,6 +7,8 @@
 package fs
 
 import (
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 )
@@ -39,3 +41,67 @@ func testWalkSkipSymlink(t *testing.T, fsType FilesystemType, uri string) {
 		t.Fatal(err)
 	}
 }
+
+func testWalkFollowSymlinks(t *testing.T, fsType FilesystemType, uri string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks on windows")
+	}
+
+	fs := NewFilesystem(fsType, uri)
+	for _, dir := range []string{"towalk", "target/sub", "other"} {
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"target/sub/file", "other/file"} {
+		fd, err := fs.Create(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd.Close()
+	}
+	links := map[string]string{
+		"towalk/target":    "../target",
+		"target/sub/other": "../../other",
+		"target/sub/up":    "..", // a cycle
+	}
+	for name, target := range links {
+		if err := fs.CreateSymlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(maxDepth int) map[string]bool {
+		t.Helper()
+		walked := make(map[string]bool) // path -> is symlink
+		fs := NewFilesystem(fsType, uri, WithFollowSymlinks(maxDepth))
+		if err := fs.Walk("towalk", func(path string, info FileInfo, err error) error {
+			if err != nil {
+				t.Fatal(err)
+			}
+			walked[filepath.ToSlash(path)] = info.IsSymlink()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return walked
+	}
+
+	expected := map[string]bool{
+		"towalk":                  false,
+		"towalk/target":           false,
+		"towalk/target/sub":       false,
+		"towalk/target/sub/file":  false,
+		"towalk/target/sub/other": true,
+		"towalk/target/sub/up":    true,
+	}
+	if walked := walk(1); !reflect.DeepEqual(walked, expected) {
+		t.Errorf("Following one symlink, walked %v, expected %v", walked, expected)
+	}
+
+	expected["towalk/target/sub/other"] = false
+	expected["towalk/target/sub/other/file"] = false
+	if walked := walk(5); !reflect.DeepEqual(walked, expected) {
+		t.Errorf("Following symlinks, walked %v, expected %v", walked, expected)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -42,6 +43,7 @@ func init() {
 
 type Pattern struct {
 	pattern string
+	line    string // the line in the ignore file this pattern comes from
 	match   glob.Glob
 	result  Result
 }
@@ -115,6 +117,8 @@ type Matcher struct {
 	stop            chan struct{}
 	changeDetector  ChangeDetector
 	skipIgnoredDirs bool
+	allowlist       bool
+	remotes         map[string]int // generations of the remote includes parsed
 	mut             sync.Mutex
 }
 
@@ -136,6 +140,15 @@ func WithChangeDetector(cd ChangeDetector) Option {
 	}
 }
 
+// WithAllowlist enables or disables allowlist mode, where the patterns
+// select the files that are not ignored and everything else is ignored.
+// The default is disabled.
+func WithAllowlist(v bool) Option {
+	return func(m *Matcher) {
+		m.allowlist = v
+	}
+}
+
 func New(fs fs.Filesystem, opts ...Option) *Matcher {
 	m := &Matcher{
 		fs:              fs,
@@ -156,10 +169,13 @@ func New(fs fs.Filesystem, opts ...Option) *Matcher {
 }
 
 func (m *Matcher) Load(file string) error {
-	m.mut.Lock()
-	defer m.mut.Unlock()
+	return m.withRemoteIncludes(func() error {
+		return m.loadLocked(file)
+	})
+}
 
-	if m.changeDetector.Seen(m.fs, file) && !m.changeDetector.Changed() {
+func (m *Matcher) loadLocked(file string) error {
+	if m.changeDetector.Seen(m.fs, file) && !m.changeDetector.Changed() && !remoteIncludes.changed(m.remotes) {
 		return nil
 	}
 
@@ -182,17 +198,63 @@ func (m *Matcher) Load(file string) error {
 }
 
 func (m *Matcher) Parse(r io.Reader, file string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.withRemoteIncludes(func() error {
+		return m.parseLocked(bytes.NewReader(data), file)
+	})
+}
+
+// withRemoteIncludes calls load with the lock held, fetching the remote
+// includes before that without holding it, so that a slow remote doesn't
+// hold up matching. Remote includes seen for the first time are only known
+// after loading, so they are fetched then and load is called again.
+func (m *Matcher) withRemoteIncludes(load func() error) error {
+	m.mut.Lock()
+	urls := m.remoteURLsLocked()
+	m.mut.Unlock()
+	remoteIncludes.refresh(urls)
+
+	m.mut.Lock()
+	err := load()
+	urls = m.remoteURLsLocked()
+	m.mut.Unlock()
+	if !remoteIncludes.due(urls) {
+		return err
+	}
+
+	remoteIncludes.refresh(urls)
 	m.mut.Lock()
 	defer m.mut.Unlock()
-	return m.parseLocked(r, file)
+	return load()
+}
+
+func (m *Matcher) remoteURLsLocked() []string {
+	urls := make([]string, 0, len(m.remotes))
+	for url := range m.remotes {
+		urls = append(urls, url)
+	}
+	return urls
 }
 
 func (m *Matcher) parseLocked(r io.Reader, file string) error {
-	lines, patterns, err := parseIgnoreFile(m.fs, r, file, m.changeDetector, make(map[string]struct{}))
+	gens := remoteIncludes.generations()
+	linesSeen := make(map[string]struct{})
+	lines, patterns, err := parseIgnoreFile(m.fs, r, file, m.changeDetector, linesSeen)
 	// Error is saved and returned at the end. We process the patterns
 	// (possibly blank) anyway.
 
 	m.lines = lines
+	m.remotes = make(map[string]int)
+	for _, url := range remoteIncludeURLs(linesSeen) {
+		m.remotes[url] = gens[url]
+	}
+
+	if m.allowlist {
+		patterns = allowlistPatterns(patterns)
+	}
 
 	newHash := hashPatterns(patterns)
 	if newHash == m.curHash {
@@ -235,7 +297,7 @@ func (m *Matcher) Match(file string) (result Result) {
 	defer m.mut.Unlock()
 
 	if len(m.patterns) == 0 {
-		return resultNotMatched
+		return m.unmatchedResult()
 	}
 
 	if m.matches != nil {
@@ -251,6 +313,25 @@ func (m *Matcher) Match(file string) (result Result) {
 		}()
 	}
 
+	result, _ = m.matchLocked(file)
+	return result
+}
+
+// MatchLine returns the result of matching the file, and the line in the
+// ignore file of the pattern that decided it. The line is empty if no
+// pattern matched.
+func (m *Matcher) MatchLine(file string) (Result, string) {
+	if file == "." {
+		return resultNotMatched, ""
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	return m.matchLocked(file)
+}
+
+func (m *Matcher) matchLocked(file string) (Result, string) {
 	// Check all the patterns for a match.
 	file = filepath.ToSlash(file)
 	var lowercaseFile string
@@ -260,16 +341,24 @@ func (m *Matcher) Match(file string) (result Result) {
 				lowercaseFile = strings.ToLower(file)
 			}
 			if pattern.match.Match(lowercaseFile) {
-				return pattern.result
+				return pattern.result, pattern.line
 			}
 		} else {
 			if pattern.match.Match(file) {
-				return pattern.result
+				return pattern.result, pattern.line
 			}
 		}
 	}
 
-	// Default to not matching.
+	return m.unmatchedResult(), ""
+}
+
+// unmatchedResult returns the result for files not matched by any pattern:
+// not ignored, unless in allowlist mode.
+func (m *Matcher) unmatchedResult() Result {
+	if m.allowlist {
+		return resultInclude
+	}
 	return resultNotMatched
 }
 
@@ -345,6 +434,51 @@ func (m *Matcher) SkipIgnoredDirs() bool {
 	return m.skipIgnoredDirs
 }
 
+// allowlistPatterns returns the patterns to use in allowlist mode. The
+// patterns are inverted, so that matching files are not ignored. For
+// patterns rooted in the folder, the parent directories are not ignored
+// either, so that they can be traversed while skipping all other
+// directories.
+func allowlistPatterns(patterns []Pattern) []Pattern {
+	res := make([]Pattern, 0, len(patterns))
+	seenParents := make(map[string]struct{})
+	var parents []Pattern
+	for _, p := range patterns {
+		p.result ^= resultInclude
+		res = append(res, p)
+
+		if p.result.IsIgnored() || !p.allowsSkippingIgnoredDirs() {
+			continue
+		}
+		for i := 1; i < len(p.pattern); i++ {
+			if p.pattern[i] != '/' {
+				continue
+			}
+			parent := p.pattern[:i]
+			if _, ok := seenParents[parent]; ok {
+				continue
+			}
+			seenParents[parent] = struct{}{}
+			// The parent is free of wildcards, as the pattern allows
+			// skipping ignored dirs.
+			match, err := glob.Compile(parent[1:], '/')
+			if err != nil {
+				continue
+			}
+			parents = append(parents, Pattern{
+				pattern: parent,
+				line:    p.line,
+				match:   match,
+				result:  p.result &^ resultDeletable,
+			})
+		}
+	}
+
+	// Parents go last, so that they don't take precedence over explicit
+	// patterns for the same directory.
+	return append(res, parents...)
+}
+
 func hashPatterns(patterns []Pattern) string {
 	h := md5.New()
 	for _, pat := range patterns {
@@ -473,12 +607,16 @@ func parseLine(line string) ([]Pattern, error) {
 func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd ChangeDetector, linesSeen map[string]struct{}) ([]string, []Pattern, error) {
 	var lines []string
 	var patterns []Pattern
+	var origLine string
 
 	addPattern := func(line string) error {
 		newPatterns, err := parseLine(line)
 		if err != nil {
 			return errors.Wrapf(err, "invalid pattern %q in ignore file", line)
 		}
+		for i := range newPatterns {
+			newPatterns[i].line = origLine
+		}
 		patterns = append(patterns, newPatterns...)
 		return nil
 	}
@@ -499,6 +637,7 @@ func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd Chan
 			continue
 		}
 
+		origLine = line
 		line = filepath.ToSlash(line)
 		switch {
 		case strings.HasPrefix(line, "#include"):
@@ -514,6 +653,24 @@ func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd Chan
 				break
 			}
 
+			if isRemoteInclude(includeRel) {
+				var includePatterns []Pattern
+				if includePatterns, err = loadParseRemoteInclude(fs, includeRel, cd, linesSeen); err == nil {
+					patterns = append(patterns, includePatterns...)
+				} else {
+					err = fmt.Errorf("failed to load include %s: %s", includeRel, err.Error())
+				}
+				break
+			}
+			if strings.HasPrefix(includeRel, "http://") {
+				err = fmt.Errorf("failed to parse #include line: only https URLs are supported")
+				break
+			}
+			if isRemoteInclude(currentFile) {
+				err = fmt.Errorf("failed to parse #include line: local include %s in remote file %s", includeRel, currentFile)
+				break
+			}
+
 			includeFile := filepath.Join(filepath.Dir(currentFile), includeRel)
 			var includePatterns []Pattern
 			if includePatterns, err = loadParseIncludeFile(fs, includeFile, cd, linesSeen); err == nil {
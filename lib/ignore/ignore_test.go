@@ -1150,3 +1150,124 @@ func TestSkipIgnoredDirs(t *testing.T) {
 		t.Error("SkipIgnoredDirs should be true")
 	}
 }
+
+func TestMatchLine(t *testing.T) {
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."), WithCache(true))
+
+	stignore := `!/keep/important.log
+(?d)*.log
+(?i)/Photos
+!(?i)**/TMP
+*.tmp`
+	if err := pats.Parse(bytes.NewBufferString(stignore), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		file      string
+		ignored   bool
+		deletable bool
+		line      string
+	}{
+		{"keep/important.log", false, false, "!/keep/important.log"},
+		{"keep/other.log", true, true, "(?d)*.log"},
+		{"sub/dir/other.log", true, true, "(?d)*.log"},
+		{"photos", true, false, "(?i)/Photos"},
+		{filepath.FromSlash("PHOTOS/img.jpg"), true, false, "(?i)/Photos"},
+		{filepath.FromSlash("sub/photos"), false, false, ""},
+		{filepath.FromSlash("sub/Tmp/a.tmp"), false, false, "!(?i)**/TMP"},
+		{"a.tmp", true, false, "*.tmp"},
+		{"other.txt", false, false, ""},
+	}
+
+	for _, tc := range cases {
+		res, line := pats.MatchLine(tc.file)
+		if res.IsIgnored() != tc.ignored || res.IsDeletable() != tc.deletable || line != tc.line {
+			t.Errorf("%q: got %v, %v, %q; expected %v, %v, %q", tc.file, res.IsIgnored(), res.IsDeletable(), line, tc.ignored, tc.deletable, tc.line)
+		}
+		if res != pats.Match(tc.file) {
+			t.Errorf("%q: MatchLine and Match disagree", tc.file)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	allowlist := `/photos/2020
+!/docs/private
+/docs
+(?i)*.KEEP`
+
+	// The same as a denylist, which is what users had to write before.
+	denylist := `!/photos/2020
+/docs/private
+!/docs
+!(?i)*.KEEP
+*`
+
+	allow := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."), WithAllowlist(true))
+	if err := allow.Parse(bytes.NewBufferString(allowlist), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	deny := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."))
+	if err := deny.Parse(bytes.NewBufferString(denylist), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		"photos/2020",
+		"photos/2020/img.jpg",
+		"photos/2019/img.jpg",
+		"photos/img.jpg",
+		"docs",
+		"docs/readme.txt",
+		"docs/private",
+		"docs/private/secret.txt",
+		"other/file.keep",
+		"other/file.txt",
+		"file.KEEP",
+		"file.txt",
+	}
+	for _, file := range files {
+		file = filepath.FromSlash(file)
+		if a, d := allow.Match(file).IsIgnored(), deny.Match(file).IsIgnored(); a != d {
+			t.Errorf("%q: ignored %v in allowlist mode, %v in equivalent denylist", file, a, d)
+		}
+	}
+
+	// Without patterns, everything is ignored.
+	empty := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."), WithAllowlist(true))
+	if !empty.Match("file.txt").IsIgnored() {
+		t.Error("unmatched file should be ignored in allowlist mode")
+	}
+}
+
+func TestAllowlistSkipIgnoredDirs(t *testing.T) {
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."), WithAllowlist(true))
+	if err := pats.Parse(bytes.NewBufferString("/photos/2020/best\n/docs/\n"), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only rooted patterns, so ignored directories can be skipped, but the
+	// parents of the included paths must still be traversed.
+	if !pats.SkipIgnoredDirs() {
+		t.Error("should be able to skip ignored dirs")
+	}
+	for _, dir := range []string{"photos", "photos/2020", "photos/2020/best", "photos/2020/best/sub", "docs", "docs/sub"} {
+		if pats.Match(filepath.FromSlash(dir)).IsIgnored() {
+			t.Errorf("%q should not be ignored", dir)
+		}
+	}
+	for _, dir := range []string{"photos/2019", "photos/2020/other", "other"} {
+		if !pats.Match(filepath.FromSlash(dir)).IsIgnored() {
+			t.Errorf("%q should be ignored", dir)
+		}
+	}
+
+	// Patterns matching anywhere in the tree require a full traversal.
+	if err := pats.Parse(bytes.NewBufferString("/docs\n*.jpg\n"), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if pats.SkipIgnoredDirs() {
+		t.Error("should not be able to skip ignored dirs")
+	}
+}
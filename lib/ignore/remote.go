@@ -0,0 +1,249 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ignore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/locations"
+	"github.com/syncthing/syncthing/lib/osutil"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+const (
+	// maxRemoteIncludeSize is the largest pattern file we accept from a
+	// remote include.
+	maxRemoteIncludeSize = 1 << 20
+
+	// remoteIncludeCacheTime is how long a fetched remote include is used
+	// before checking whether it changed.
+	remoteIncludeCacheTime = time.Hour
+
+	// remoteIncludeRetryTime is how long to wait before fetching a remote
+	// include again after failing to.
+	remoteIncludeRetryTime = 5 * time.Minute
+)
+
+var remoteIncludes = newRemoteIncludeCache(&http.Client{Timeout: 30 * time.Second}, "")
+
+// remoteIncludeCache holds the contents of remote include files, keyed by
+// URL. Files are only fetched by refresh, never while looking them up, so
+// that callers can fetch without holding their locks. The last good copy
+// of each file is kept on disk and used when the remote can't be reached,
+// including after a restart.
+type remoteIncludeCache struct {
+	client  *http.Client
+	dir     string // for the last good copies, the default location if empty
+	entries map[string]remoteInclude
+	mut     sync.Mutex
+}
+
+type remoteInclude struct {
+	data []byte
+	etag string
+	gen  int       // incremented whenever data changes
+	next time.Time // when to fetch again
+}
+
+func newRemoteIncludeCache(client *http.Client, dir string) *remoteIncludeCache {
+	return &remoteIncludeCache{
+		client:  client,
+		dir:     dir,
+		entries: make(map[string]remoteInclude),
+		mut:     sync.NewMutex(),
+	}
+}
+
+// lookup returns the cached contents of the remote file, nil if there are
+// none.
+func (c *remoteIncludeCache) lookup(url string) []byte {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.entries[url].data
+}
+
+// generations returns the generation of each cached file.
+func (c *remoteIncludeCache) generations() map[string]int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	gens := make(map[string]int, len(c.entries))
+	for url, entry := range c.entries {
+		gens[url] = entry.gen
+	}
+	return gens
+}
+
+// changed returns true if any of the files changed since the given
+// generations.
+func (c *remoteIncludeCache) changed(gens map[string]int) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for url, gen := range gens {
+		if c.entries[url].gen != gen {
+			return true
+		}
+	}
+	return false
+}
+
+// due returns true if any of the files hasn't been fetched yet, or is due
+// to be checked again.
+func (c *remoteIncludeCache) due(urls []string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for _, url := range urls {
+		if entry, ok := c.entries[url]; !ok || !time.Now().Before(entry.next) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh fetches those of the files which haven't been fetched yet, or
+// are due to be checked again. Failing to fetch a file is not an error;
+// the cached or last good copy is used if there is one, otherwise nothing.
+func (c *remoteIncludeCache) refresh(urls []string) {
+	for _, url := range urls {
+		c.mut.Lock()
+		entry, ok := c.entries[url]
+		c.mut.Unlock()
+		if ok && time.Now().Before(entry.next) {
+			continue
+		}
+
+		data, etag, err := c.fetch(url, entry.etag)
+		switch {
+		case err != nil:
+			entry.next = time.Now().Add(remoteIncludeRetryTime)
+			if ok {
+				l.Warnf("Failed to fetch ignore patterns from %s, using cached copy: %v", url, err)
+			} else if saved, serr := ioutil.ReadFile(c.copyPath(url)); serr == nil {
+				l.Warnf("Failed to fetch ignore patterns from %s, using last good copy: %v", url, err)
+				entry.data = saved
+				entry.gen++
+			} else {
+				l.Warnf("Failed to fetch ignore patterns from %s, skipping include: %v", url, err)
+			}
+		case data == nil:
+			// Not modified
+			entry.next = time.Now().Add(remoteIncludeCacheTime)
+		default:
+			entry.next = time.Now().Add(remoteIncludeCacheTime)
+			entry.etag = etag
+			if !ok || !bytes.Equal(data, entry.data) {
+				entry.data = data
+				entry.gen++
+				if err := c.saveCopy(url, data); err != nil {
+					l.Infof("Failed to save ignore patterns from %s: %v", url, err)
+				}
+			}
+		}
+
+		c.mut.Lock()
+		c.entries[url] = entry
+		c.mut.Unlock()
+	}
+}
+
+// fetch returns the contents of the remote file and its ETag, or nil data
+// if it's unchanged from the given ETag.
+func (c *remoteIncludeCache) fetch(url, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if resp.ContentLength > maxRemoteIncludeSize {
+		return nil, "", fmt.Errorf("pattern file too large (%d bytes)", resp.ContentLength)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRemoteIncludeSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxRemoteIncludeSize {
+		return nil, "", fmt.Errorf("pattern file too large (more than %d bytes)", maxRemoteIncludeSize)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+func (c *remoteIncludeCache) copyPath(url string) string {
+	dir := c.dir
+	if dir == "" {
+		dir = locations.Get(locations.RemoteIgnores)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(url))))
+}
+
+func (c *remoteIncludeCache) saveCopy(url string, data []byte) error {
+	path := c.copyPath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	fd, err := osutil.CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func isRemoteInclude(file string) bool {
+	return strings.HasPrefix(file, "https://")
+}
+
+// remoteIncludeURLs returns the URLs of the remote files included by the
+// given ignore file lines.
+func remoteIncludeURLs(lines map[string]struct{}) []string {
+	var urls []string
+	for line := range lines {
+		if !strings.HasPrefix(line, "#include") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) == 2 && isRemoteInclude(strings.TrimSpace(fields[1])) {
+			urls = append(urls, strings.TrimSpace(fields[1]))
+		}
+	}
+	return urls
+}
+
+func loadParseRemoteInclude(filesystem fs.Filesystem, url string, cd ChangeDetector, linesSeen map[string]struct{}) ([]Pattern, error) {
+	data := remoteIncludes.lookup(url)
+	_, patterns, err := parseIgnoreFile(filesystem, bytes.NewReader(data), url, cd, linesSeen)
+	return patterns, err
+}
@@ -0,0 +1,266 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ignore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+// remoteServer serves the current patterns, or fails when they are empty.
+type remoteServer struct {
+	*httptest.Server
+	patterns atomic.Value
+	requests int32
+	dir      string // for the last good copies
+}
+
+func newRemoteServer(t *testing.T, patterns string) *remoteServer {
+	t.Helper()
+	s := &remoteServer{}
+	s.patterns.Store(patterns)
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		patterns := s.patterns.Load().(string)
+		if patterns == "" {
+			http.Error(w, "nope", http.StatusInternalServerError)
+			return
+		}
+		etag := fmt.Sprintf(`"%x"`, md5.Sum([]byte(patterns)))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(patterns))
+	}))
+
+	dir, err := ioutil.TempDir("", "syncthing-remote-ignores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.dir = dir
+	remoteIncludes = newRemoteIncludeCache(s.Client(), dir)
+
+	return s
+}
+
+func (s *remoteServer) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.dir)
+}
+
+// expireRemoteIncludes makes the cached remote includes due to be fetched
+// again.
+func expireRemoteIncludes() {
+	remoteIncludes.mut.Lock()
+	for url, entry := range remoteIncludes.entries {
+		entry.next = time.Time{}
+		remoteIncludes.entries[url] = entry
+	}
+	remoteIncludes.mut.Unlock()
+}
+
+func parseRemote(t *testing.T, url string) *Matcher {
+	t.Helper()
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."))
+	if err := pats.Parse(bytes.NewBufferString("#include "+url+"\n/local\n"), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if !pats.Match("local").IsIgnored() {
+		t.Error("local pattern should apply")
+	}
+	return pats
+}
+
+func TestRemoteIncludeCache(t *testing.T) {
+	srv := newRemoteServer(t, "!keep.remote\n*.remote\n")
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		pats := parseRemote(t, srv.URL+"/patterns")
+		if !pats.Match("file.remote").IsIgnored() {
+			t.Error("remote pattern should apply")
+		}
+		if pats.Match("keep.remote").IsIgnored() {
+			t.Error("remote negation should apply")
+		}
+	}
+
+	if n := atomic.LoadInt32(&srv.requests); n != 1 {
+		t.Errorf("remote fetched %d times, expected once", n)
+	}
+}
+
+func TestRemoteIncludeFetchFailure(t *testing.T) {
+	srv := newRemoteServer(t, "")
+	defer srv.Close()
+
+	// Without a cached copy there is nothing to include, but the rest of
+	// the patterns still apply.
+
+	pats := parseRemote(t, srv.URL+"/patterns")
+	if pats.Match("file.remote").IsIgnored() {
+		t.Error("nothing should be included from a failed fetch")
+	}
+
+	// Failed fetches are retried, eventually.
+
+	srv.patterns.Store("*.remote\n")
+	parseRemote(t, srv.URL+"/patterns")
+	if n := atomic.LoadInt32(&srv.requests); n != 1 {
+		t.Errorf("remote fetched %d times, expected once before retrying", n)
+	}
+	expireRemoteIncludes()
+	pats = parseRemote(t, srv.URL+"/patterns")
+	if !pats.Match("file.remote").IsIgnored() {
+		t.Error("remote pattern should apply after retrying")
+	}
+
+	// With an expired cached copy, the cached copy is used when fetching
+	// fails.
+
+	expireRemoteIncludes()
+	srv.patterns.Store("")
+	pats = parseRemote(t, srv.URL+"/patterns")
+	if !pats.Match("file.remote").IsIgnored() {
+		t.Error("cached copy should be used when the fetch fails")
+	}
+	if n := atomic.LoadInt32(&srv.requests); n != 3 {
+		t.Errorf("remote fetched %d times, expected three times", n)
+	}
+
+	// After a restart, the last good copy from disk is used.
+
+	remoteIncludes = newRemoteIncludeCache(srv.Client(), srv.dir)
+	pats = parseRemote(t, srv.URL+"/patterns")
+	if !pats.Match("file.remote").IsIgnored() {
+		t.Error("last good copy should be used when the fetch fails")
+	}
+}
+
+func TestRemoteIncludeRefresh(t *testing.T) {
+	srv := newRemoteServer(t, "*.remote\n")
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "syncthing-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".stignore"), []byte("#include "+srv.URL+"/patterns\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, dir))
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if !pats.Match("file.remote").IsIgnored() {
+		t.Error("remote pattern should apply")
+	}
+
+	// Unchanged remote files are not downloaded again.
+	expireRemoteIncludes()
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&srv.requests); n != 2 {
+		t.Errorf("remote fetched %d times, expected twice", n)
+	}
+
+	// Changes are picked up, even though the local file is unchanged.
+	srv.patterns.Store("*.other\n")
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if !pats.Match("file.remote").IsIgnored() {
+		t.Error("cached remote pattern should apply until it expires")
+	}
+	expireRemoteIncludes()
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if pats.Match("file.remote").IsIgnored() || !pats.Match("file.other").IsIgnored() {
+		t.Error("changed remote patterns should apply")
+	}
+}
+
+func TestRemoteIncludeSizeLimit(t *testing.T) {
+	srv := newRemoteServer(t, "*.remote\n"+strings.Repeat("#", maxRemoteIncludeSize))
+	defer srv.Close()
+
+	pats := parseRemote(t, srv.URL+"/patterns")
+	if pats.Match("file.remote").IsIgnored() {
+		t.Error("too large pattern file should be rejected")
+	}
+
+	if data := remoteIncludes.lookup(srv.URL + "/patterns"); data != nil {
+		t.Error("too large pattern file should not be cached")
+	}
+}
+
+func TestRemoteIncludeSlowFetch(t *testing.T) {
+	srv := newRemoteServer(t, "*.remote\n")
+	defer srv.Close()
+	parseRemote(t, srv.URL+"/patterns")
+
+	// A remote that doesn't respond until we're done.
+	requested := make(chan struct{})
+	unblock := make(chan struct{})
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-unblock
+	}))
+	defer slow.Close()
+	defer close(unblock)
+	remoteIncludes.client = slow.Client()
+	slowPats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."))
+	go slowPats.Parse(bytes.NewBufferString("#include "+slow.URL+"/patterns\n"), ".stignore")
+	<-requested
+
+	// Neither the cached copy from the other remote nor matching with the
+	// patterns being loaded are held up meanwhile.
+	done := make(chan []byte)
+	go func() {
+		slowPats.Match("file.remote")
+		done <- remoteIncludes.lookup(srv.URL + "/patterns")
+	}()
+	select {
+	case data := <-done:
+		if string(data) != "*.remote\n" {
+			t.Errorf("unexpected cached include %q", data)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cached include held up by a slow fetch")
+	}
+}
+
+func TestRemoteIncludeRestrictions(t *testing.T) {
+	srv := newRemoteServer(t, "#include local.txt\n")
+	defer srv.Close()
+
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."))
+	if err := pats.Parse(bytes.NewBufferString("#include "+srv.URL+"\n"), ".stignore"); err == nil {
+		t.Error("local include from a remote file should fail")
+	}
+	if err := pats.Parse(bytes.NewBufferString("#include http://example.com/patterns\n"), ".stignore"); err == nil {
+		t.Error("plain http include should fail")
+	}
+}
@@ -28,8 +28,10 @@ const (
 	HTTPSCertFile LocationEnum = "httpsCertFile"
 	HTTPSKeyFile  LocationEnum = "httpsKeyFile"
 	Database      LocationEnum = "database"
+	DatabaseCache LocationEnum = "databaseCache"
 	LogFile       LocationEnum = "logFile"
 	CsrfTokens    LocationEnum = "csrfTokens"
+	RemoteIgnores LocationEnum = "remoteIgnores"
 	PanicLog      LocationEnum = "panicLog"
 	AuditLog      LocationEnum = "auditLog"
 	GUIAssets     LocationEnum = "GUIAssets"
@@ -60,6 +62,16 @@ func SetBaseDir(baseDirName BaseDirEnum, path string) error {
 	return expandLocations()
 }
 
+// Set overrides the given location with an explicit path, which then takes
+// precedence over the template based on the base directories.
+func Set(location LocationEnum, path string) error {
+	if _, ok := locationTemplates[location]; !ok {
+		return fmt.Errorf("unknown location: %s", location)
+	}
+	overrides[location] = path
+	return expandLocations()
+}
+
 func Get(location LocationEnum) string {
 	return locations[location]
 }
@@ -82,8 +94,10 @@ var locationTemplates = map[LocationEnum]string{
 	HTTPSCertFile: "${config}/https-cert.pem",
 	HTTPSKeyFile:  "${config}/https-key.pem",
 	Database:      "${config}/index-v0.14.0.db",
+	DatabaseCache: "${config}/index-cache.db",
 	LogFile:       "${config}/syncthing.log", // -logfile on Windows
 	CsrfTokens:    "${config}/csrftokens.txt",
+	RemoteIgnores: "${config}/remote-ignores",
 	PanicLog:      "${config}/panic-${timestamp}.log",
 	AuditLog:      "${config}/audit-${timestamp}.log",
 	GUIAssets:     "${config}/gui",
@@ -92,11 +106,17 @@ var locationTemplates = map[LocationEnum]string{
 
 var locations = make(map[LocationEnum]string)
 
+// Locations set explicitly, instead of from the templates
+var overrides = make(map[LocationEnum]string)
+
 // expandLocations replaces the variables in the locations map with actual
 // directory locations.
 func expandLocations() error {
 	newLocations := make(map[LocationEnum]string)
 	for key, dir := range locationTemplates {
+		if override, ok := overrides[key]; ok {
+			dir = override
+		}
 		for varName, value := range baseDirs {
 			dir = strings.Replace(dir, "${"+string(varName)+"}", value, -1)
 		}
@@ -5,6 +5,7 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -28,6 +29,19 @@ const (
 	NumLevels
 )
 
+var levelNames = [NumLevels]string{"DEBUG", "VERBOSE", "INFO", "WARNING"}
+
+// LogFormat selects how log lines are written.
+type LogFormat int
+
+const (
+	// FormatText writes human readable lines; this is the default.
+	FormatText LogFormat = iota
+	// FormatJSON writes each line as a JSON object with time, level,
+	// prefix, facility and message fields.
+	FormatJSON
+)
+
 const (
 	DefaultFlags = log.Ltime
 	DebugFlags   = log.Ltime | log.Ldate | log.Lmicroseconds | log.Lshortfile
@@ -40,6 +54,7 @@ type Logger interface {
 	AddHandler(level LogLevel, h MessageHandler)
 	SetFlags(flag int)
 	SetPrefix(prefix string)
+	SetFormat(format LogFormat)
 	Debugln(vals ...interface{})
 	Debugf(format string, vals ...interface{})
 	Verboseln(vals ...interface{})
@@ -58,6 +73,8 @@ type Logger interface {
 
 type logger struct {
 	logger     *log.Logger
+	out        io.Writer
+	format     LogFormat
 	handlers   [NumLevels][]MessageHandler
 	facilities map[string]string   // facility name => description
 	debug      map[string]struct{} // only facility names with debugging enabled
@@ -80,6 +97,7 @@ func New() Logger {
 func newLogger(w io.Writer) Logger {
 	return &logger{
 		logger:     log.New(w, "", DefaultFlags),
+		out:        w,
 		traces:     os.Getenv("STTRACE"),
 		facilities: make(map[string]string),
 		debug:      make(map[string]struct{}),
@@ -112,82 +130,93 @@ func (l *logger) callHandlers(level LogLevel, s string) {
 	}
 }
 
+// SetFormat sets the output format of log lines.
+func (l *logger) SetFormat(format LogFormat) {
+	l.mut.Lock()
+	l.format = format
+	l.mut.Unlock()
+}
+
 // Debugln logs a line with a DEBUG prefix.
 func (l *logger) Debugln(vals ...interface{}) {
-	l.debugln(3, vals...)
-}
-func (l *logger) debugln(level int, vals ...interface{}) {
-	s := fmt.Sprintln(vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(level, "DEBUG: "+s)
-	l.callHandlers(LevelDebug, s)
+	l.logln(3, "", LevelDebug, vals...)
 }
 
 // Debugf logs a formatted line with a DEBUG prefix.
 func (l *logger) Debugf(format string, vals ...interface{}) {
-	l.debugf(3, format, vals...)
-}
-func (l *logger) debugf(level int, format string, vals ...interface{}) {
-	s := fmt.Sprintf(format, vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(level, "DEBUG: "+s)
-	l.callHandlers(LevelDebug, s)
+	l.logf(3, "", LevelDebug, format, vals...)
 }
 
 // Infoln logs a line with a VERBOSE prefix.
 func (l *logger) Verboseln(vals ...interface{}) {
-	s := fmt.Sprintln(vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(2, "VERBOSE: "+s)
-	l.callHandlers(LevelVerbose, s)
+	l.logln(3, "", LevelVerbose, vals...)
 }
 
 // Infof logs a formatted line with a VERBOSE prefix.
 func (l *logger) Verbosef(format string, vals ...interface{}) {
-	s := fmt.Sprintf(format, vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(2, "VERBOSE: "+s)
-	l.callHandlers(LevelVerbose, s)
+	l.logf(3, "", LevelVerbose, format, vals...)
 }
 
 // Infoln logs a line with an INFO prefix.
 func (l *logger) Infoln(vals ...interface{}) {
-	s := fmt.Sprintln(vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(2, "INFO: "+s)
-	l.callHandlers(LevelInfo, s)
+	l.logln(3, "", LevelInfo, vals...)
 }
 
 // Infof logs a formatted line with an INFO prefix.
 func (l *logger) Infof(format string, vals ...interface{}) {
-	s := fmt.Sprintf(format, vals...)
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	l.logger.Output(2, "INFO: "+s)
-	l.callHandlers(LevelInfo, s)
+	l.logf(3, "", LevelInfo, format, vals...)
 }
 
 // Warnln logs a formatted line with a WARNING prefix.
 func (l *logger) Warnln(vals ...interface{}) {
+	l.logln(3, "", LevelWarn, vals...)
+}
+
+// Warnf logs a formatted line with a WARNING prefix.
+func (l *logger) Warnf(format string, vals ...interface{}) {
+	l.logf(3, "", LevelWarn, format, vals...)
+}
+
+func (l *logger) logln(calldepth int, facility string, level LogLevel, vals ...interface{}) {
 	s := fmt.Sprintln(vals...)
 	l.mut.Lock()
 	defer l.mut.Unlock()
-	l.logger.Output(2, "WARNING: "+s)
-	l.callHandlers(LevelWarn, s)
+	l.outputLocked(calldepth+1, facility, level, s)
+	l.callHandlers(level, s)
 }
 
-// Warnf logs a formatted line with a WARNING prefix.
-func (l *logger) Warnf(format string, vals ...interface{}) {
+func (l *logger) logf(calldepth int, facility string, level LogLevel, format string, vals ...interface{}) {
 	s := fmt.Sprintf(format, vals...)
 	l.mut.Lock()
 	defer l.mut.Unlock()
-	l.logger.Output(2, "WARNING: "+s)
-	l.callHandlers(LevelWarn, s)
+	l.outputLocked(calldepth+1, facility, level, s)
+	l.callHandlers(level, s)
+}
+
+type jsonLine struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Prefix   string    `json:"prefix,omitempty"` // as set by SetPrefix, without brackets
+	Facility string    `json:"facility"`
+	Message  string    `json:"message"`
+}
+
+func (l *logger) outputLocked(calldepth int, facility string, level LogLevel, s string) {
+	if l.format != FormatJSON {
+		l.logger.Output(calldepth, levelNames[level]+": "+s)
+		return
+	}
+	bs, err := json.Marshal(jsonLine{
+		Time:     time.Now(),
+		Level:    levelNames[level],
+		Prefix:   strings.Trim(l.logger.Prefix(), "[] "),
+		Facility: facility,
+		Message:  strings.TrimSpace(s),
+	})
+	if err != nil {
+		return
+	}
+	l.out.Write(append(bs, '\n'))
 }
 
 // ShouldDebug returns true if the given facility has debugging enabled.
@@ -269,7 +298,7 @@ func (l *facilityLogger) Debugln(vals ...interface{}) {
 	if !l.ShouldDebug(l.facility) {
 		return
 	}
-	l.logger.debugln(3, vals...)
+	l.logln(3, l.facility, LevelDebug, vals...)
 }
 
 // Debugf logs a formatted line with a DEBUG prefix.
@@ -277,17 +306,52 @@ func (l *facilityLogger) Debugf(format string, vals ...interface{}) {
 	if !l.ShouldDebug(l.facility) {
 		return
 	}
-	l.logger.debugf(3, format, vals...)
+	l.logf(3, l.facility, LevelDebug, format, vals...)
+}
+
+// Verboseln logs a line with a VERBOSE prefix.
+func (l *facilityLogger) Verboseln(vals ...interface{}) {
+	l.logln(3, l.facility, LevelVerbose, vals...)
+}
+
+// Verbosef logs a formatted line with a VERBOSE prefix.
+func (l *facilityLogger) Verbosef(format string, vals ...interface{}) {
+	l.logf(3, l.facility, LevelVerbose, format, vals...)
+}
+
+// Infoln logs a line with an INFO prefix.
+func (l *facilityLogger) Infoln(vals ...interface{}) {
+	l.logln(3, l.facility, LevelInfo, vals...)
+}
+
+// Infof logs a formatted line with an INFO prefix.
+func (l *facilityLogger) Infof(format string, vals ...interface{}) {
+	l.logf(3, l.facility, LevelInfo, format, vals...)
+}
+
+// Warnln logs a line with a WARNING prefix.
+func (l *facilityLogger) Warnln(vals ...interface{}) {
+	l.logln(3, l.facility, LevelWarn, vals...)
+}
+
+// Warnf logs a formatted line with a WARNING prefix.
+func (l *facilityLogger) Warnf(format string, vals ...interface{}) {
+	l.logf(3, l.facility, LevelWarn, format, vals...)
 }
 
 // A Recorder keeps a size limited record of log events.
 type Recorder interface {
 	Since(t time.Time) []Line
+	All() []Line
 	Clear()
 }
 
+// recorder keeps the first "initial" lines followed by a "..." marker,
+// and the most recent lines after that in a ring buffer.
 type recorder struct {
-	lines   []Line
+	head    []Line
+	ring    []Line
+	next    int // position of the oldest line in ring, once it's full
 	initial int
 	mut     sync.Mutex
 }
@@ -299,37 +363,62 @@ type Line struct {
 	Level   LogLevel  `json:"level"`
 }
 
+// NewRecorder returns a Recorder keeping at most size lines of the given
+// level or above, of which the first initial lines are never discarded.
 func NewRecorder(l Logger, level LogLevel, size, initial int) Recorder {
+	ringSize := size
+	if initial > 0 {
+		// Room for the initial lines and the marker following them
+		ringSize -= initial + 1
+	}
+	if ringSize < 1 {
+		ringSize = 1
+	}
 	r := &recorder{
-		lines:   make([]Line, 0, size),
+		head:    make([]Line, 0, initial+1),
+		ring:    make([]Line, 0, ringSize),
 		initial: initial,
 	}
 	l.AddHandler(level, r.append)
 	return r
 }
 
+// Since returns the recorded lines logged after the given time.
 func (r *recorder) Since(t time.Time) []Line {
 	r.mut.Lock()
 	defer r.mut.Unlock()
 
-	res := r.lines
-
-	for i := 0; i < len(res); i++ {
+	res := r.allLocked()
+	for i := range res {
 		if res[i].When.After(t) {
-			// We must copy the result as r.lines can be mutated as soon as the lock
-			// is released.
-			res = res[i:]
-			cp := make([]Line, len(res))
-			copy(cp, res)
-			return cp
+			return res[i:]
 		}
 	}
 	return nil
 }
 
+// All returns all recorded lines, oldest first.
+func (r *recorder) All() []Line {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.allLocked()
+}
+
+// allLocked returns a copy of the recorded lines in chronological order,
+// as the buffers can be mutated as soon as the lock is released.
+func (r *recorder) allLocked() []Line {
+	res := make([]Line, 0, len(r.head)+len(r.ring))
+	res = append(res, r.head...)
+	res = append(res, r.ring[r.next:]...)
+	res = append(res, r.ring[:r.next]...)
+	return res
+}
+
 func (r *recorder) Clear() {
 	r.mut.Lock()
-	r.lines = r.lines[:0]
+	r.head = r.head[:0]
+	r.ring = r.ring[:0]
+	r.next = 0
 	r.mut.Unlock()
 }
 
@@ -343,22 +432,21 @@ func (r *recorder) append(l LogLevel, msg string) {
 	r.mut.Lock()
 	defer r.mut.Unlock()
 
-	if len(r.lines) == cap(r.lines) {
-		if r.initial > 0 {
-			// Shift all lines one step to the left, keeping the "initial" first intact.
-			copy(r.lines[r.initial+1:], r.lines[r.initial+2:])
-		} else {
-			copy(r.lines, r.lines[1:])
+	if len(r.head) < r.initial {
+		r.head = append(r.head, line)
+		if len(r.head) == r.initial {
+			r.head = append(r.head, Line{time.Now(), "...", l})
 		}
-		// Add the new one at the end
-		r.lines[len(r.lines)-1] = line
 		return
 	}
 
-	r.lines = append(r.lines, line)
-	if len(r.lines) == r.initial {
-		r.lines = append(r.lines, Line{time.Now(), "...", l})
+	if len(r.ring) < cap(r.ring) {
+		r.ring = append(r.ring, line)
+		return
 	}
+	// Overwrite the oldest line
+	r.ring[r.next] = line
+	r.next = (r.next + 1) % len(r.ring)
 }
 
 // controlStripper is a Writer that replaces control characters
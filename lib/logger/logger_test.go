@@ -5,6 +5,7 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -154,6 +155,52 @@ func TestRecorder(t *testing.T) {
 	}
 }
 
+func TestRecorderWraparound(t *testing.T) {
+	l := New()
+	l.SetFlags(0)
+
+	r := NewRecorder(l, LevelInfo, 4, 0)
+
+	if lines := r.All(); len(lines) != 0 {
+		t.Fatalf("Expected no lines, got %v", lines)
+	}
+
+	var mid time.Time
+	for i := 0; i < 11; i++ {
+		if i == 8 {
+			time.Sleep(time.Millisecond)
+			mid = time.Now()
+			time.Sleep(time.Millisecond)
+		}
+		l.Infof("Info#%d", i)
+
+		// The buffer should always hold the last (up to) four lines, in order
+		lines := r.All()
+		first := i - 3
+		if first < 0 {
+			first = 0
+		}
+		if len(lines) != i-first+1 {
+			t.Fatalf("Incorrect length %d after %d lines", len(lines), i+1)
+		}
+		for j, line := range lines {
+			if expected := fmt.Sprintf("Info#%d", first+j); line.Message != expected {
+				t.Errorf("Incorrect line %d after %d lines: %s != %s", j, i+1, line.Message, expected)
+			}
+		}
+	}
+
+	lines := r.Since(mid)
+	if len(lines) != 3 || lines[0].Message != "Info#8" || lines[2].Message != "Info#10" {
+		t.Errorf("Incorrect lines since %v: %v", mid, lines)
+	}
+
+	r.Clear()
+	if lines := r.All(); len(lines) != 0 {
+		t.Errorf("Expected no lines after clear, got %v", lines)
+	}
+}
+
 func TestStackLevel(t *testing.T) {
 	b := new(bytes.Buffer)
 	l := newLogger(b)
@@ -168,6 +215,49 @@ func TestStackLevel(t *testing.T) {
 	}
 }
 
+func TestJSONFormat(t *testing.T) {
+	b := new(bytes.Buffer)
+	l := newLogger(controlStripper{b})
+	l.SetFormat(FormatJSON)
+
+	f0 := l.NewFacility("f0", "foo#0")
+	f1 := l.NewFacility("f1", "foo#1")
+	l.SetDebug("f0", true)
+	l.SetDebug("f1", false)
+
+	l.Infoln("plain info")
+	f0.Debugf("debug %d from f0", 0)
+	f1.Debugln("debug from f1")
+	f1.Warnln("warning \"quoted\"\x07from f1")
+	l.SetPrefix("[ABCDE] ")
+	f0.Infoln("info from f0")
+
+	expected := []jsonLine{
+		{Level: "INFO", Facility: "", Message: "plain info"},
+		{Level: "DEBUG", Facility: "f0", Message: "debug 0 from f0"},
+		{Level: "WARNING", Facility: "f1", Message: "warning \"quoted\"\x07from f1"},
+		{Level: "INFO", Prefix: "ABCDE", Facility: "f0", Message: "info from f0"},
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(expected), len(lines), b.String())
+	}
+	for i, line := range lines {
+		var res jsonLine
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", line, err)
+		}
+		if res.Time.IsZero() {
+			t.Errorf("Missing time in %q", line)
+		}
+		res.Time = time.Time{}
+		if res != expected[i] {
+			t.Errorf("Line %d: got %+v, expected %+v", i, res, expected[i])
+		}
+	}
+}
+
 func TestControlStripper(t *testing.T) {
 	b := new(bytes.Buffer)
 	l := newLogger(controlStripper{b})
@@ -0,0 +1,122 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"sort"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// Reasons a folder isn't synced with a device, as reported in the
+// ClusterConfigReceived event.
+const (
+	mismatchNotLocal        = "folder does not exist on this device"
+	mismatchNotShared       = "folder not shared with the remote device"
+	mismatchIgnored         = "folder is ignored for the remote device"
+	mismatchNotSharedBack   = "folder not shared back"
+	mismatchRemotePaused    = "remote has folder paused"
+	mismatchLocalPaused     = "folder paused on this device"
+	mismatchBothSendOnly    = "folder is send only on both devices"
+	mismatchRemoteNotListed = "remote does not list this device for the folder"
+)
+
+// clusterConfigFolder describes how a folder is shared between us and a
+// remote device, according to our config and their cluster config.
+type clusterConfigFolder struct {
+	Folder         string   `json:"folder"`
+	Label          string   `json:"label"`
+	SharedLocally  bool     `json:"sharedLocally"`
+	SharedByRemote bool     `json:"sharedByRemote"`
+	LocalType      string   `json:"localType,omitempty"`
+	RemoteType     string   `json:"remoteType,omitempty"` // Receive only folders appear as sendreceive.
+	Introducer     bool     `json:"introducer"`           // The remote has us as introducer.
+	Mismatches     []string `json:"mismatchReasons"`
+}
+
+// clusterConfigFolders compares the folders announced by the remote device
+// to the folders in our config, for all folders known to either side.
+func clusterConfigFolders(myID protocol.DeviceID, deviceCfg config.DeviceConfiguration, folderCfgs map[string]config.FolderConfiguration, cm protocol.ClusterConfig) []clusterConfigFolder {
+	res := make(map[string]*clusterConfigFolder)
+
+	for _, folder := range cm.Folders {
+		ccf := &clusterConfigFolder{
+			Folder:         folder.ID,
+			Label:          folder.Label,
+			SharedByRemote: true,
+			RemoteType:     config.FolderTypeSendReceive.String(),
+			Mismatches:     []string{},
+		}
+		if folder.ReadOnly {
+			ccf.RemoteType = config.FolderTypeSendOnly.String()
+		}
+		if folder.Paused {
+			ccf.Mismatches = append(ccf.Mismatches, mismatchRemotePaused)
+		}
+		listed := false
+		for _, dev := range folder.Devices {
+			if dev.ID == myID {
+				listed = true
+				ccf.Introducer = dev.Introducer
+			}
+		}
+		if !listed {
+			ccf.Mismatches = append(ccf.Mismatches, mismatchRemoteNotListed)
+		}
+		if _, ok := folderCfgs[folder.ID]; !ok {
+			if deviceCfg.IgnoredFolder(folder.ID) {
+				ccf.Mismatches = append(ccf.Mismatches, mismatchIgnored)
+			} else {
+				ccf.Mismatches = append(ccf.Mismatches, mismatchNotLocal)
+			}
+		}
+		res[folder.ID] = ccf
+	}
+
+	for _, fcfg := range folderCfgs {
+		shared := fcfg.SharedWith(deviceCfg.DeviceID)
+		ccf, ok := res[fcfg.ID]
+		if !ok {
+			if !shared {
+				// Nothing to do with this device.
+				continue
+			}
+			ccf = &clusterConfigFolder{
+				Folder:     fcfg.ID,
+				Label:      fcfg.Label,
+				Mismatches: []string{mismatchNotSharedBack},
+			}
+			res[fcfg.ID] = ccf
+		}
+		ccf.Label = fcfg.Label
+		ccf.SharedLocally = shared
+		ccf.LocalType = fcfg.Type.String()
+		if ccf.SharedByRemote && !shared {
+			if deviceCfg.IgnoredFolder(fcfg.ID) {
+				ccf.Mismatches = append(ccf.Mismatches, mismatchIgnored)
+			} else {
+				ccf.Mismatches = append(ccf.Mismatches, mismatchNotShared)
+			}
+		}
+		if fcfg.Paused {
+			ccf.Mismatches = append(ccf.Mismatches, mismatchLocalPaused)
+		}
+		if fcfg.Type == config.FolderTypeSendOnly && ccf.RemoteType == config.FolderTypeSendOnly.String() {
+			ccf.Mismatches = append(ccf.Mismatches, mismatchBothSendOnly)
+		}
+	}
+
+	folders := make([]clusterConfigFolder, 0, len(res))
+	for _, ccf := range res {
+		folders = append(folders, *ccf)
+	}
+	sort.Slice(folders, func(a, b int) bool {
+		return folders[a].Folder < folders[b].Folder
+	})
+	return folders
+}
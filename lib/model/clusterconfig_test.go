@@ -0,0 +1,147 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestClusterConfigMismatches(t *testing.T) {
+	newFolder := func(id string, devs ...protocol.DeviceID) config.FolderConfiguration {
+		fcfg := config.NewFolderConfiguration(myID, id, "", fs.FilesystemTypeFake, id)
+		for _, dev := range devs {
+			fcfg.Devices = append(fcfg.Devices, config.FolderDeviceConfiguration{DeviceID: dev})
+		}
+		return fcfg
+	}
+	ccFolder := func(id string, devs ...protocol.DeviceID) protocol.Folder {
+		folder := protocol.Folder{ID: id}
+		for _, dev := range devs {
+			folder.Devices = append(folder.Devices, protocol.Device{ID: dev})
+		}
+		return folder
+	}
+
+	folderCfgs := make(map[string]config.FolderConfiguration)
+	add := func(fcfg config.FolderConfiguration) {
+		folderCfgs[fcfg.ID] = fcfg
+	}
+	add(newFolder("ok", device1))
+	add(newFolder("notShared"))
+	add(newFolder("notSharedBack", device1))
+	add(newFolder("unshared"))
+	pausedLocal := newFolder("pausedLocal", device1)
+	pausedLocal.Paused = true
+	add(pausedLocal)
+	add(newFolder("pausedRemote", device1))
+	sendOnly := newFolder("sendOnly", device1)
+	sendOnly.Type = config.FolderTypeSendOnly
+	add(sendOnly)
+	add(newFolder("notListed", device1))
+
+	deviceCfg := config.NewDeviceConfiguration(device1, "device1")
+	deviceCfg.IgnoredFolders = []config.ObservedFolder{{ID: "ignored"}}
+
+	cm := protocol.ClusterConfig{Folders: []protocol.Folder{
+		ccFolder("ok", myID, device1),
+		ccFolder("notShared", myID, device1),
+		ccFolder("notLocal", myID, device1),
+		ccFolder("ignored", myID, device1),
+		ccFolder("pausedLocal", myID, device1),
+		ccFolder("pausedRemote", myID, device1),
+		ccFolder("sendOnly", myID, device1),
+		ccFolder("notListed", device1),
+	}}
+	cm.Folders[0].Devices[0].Introducer = true
+	cm.Folders[5].Paused = true
+	cm.Folders[6].ReadOnly = true
+
+	expected := map[string][]string{
+		"ignored":       {mismatchIgnored},
+		"notListed":     {mismatchRemoteNotListed},
+		"notLocal":      {mismatchNotLocal},
+		"notShared":     {mismatchNotShared},
+		"notSharedBack": {mismatchNotSharedBack},
+		"ok":            {},
+		"pausedLocal":   {mismatchLocalPaused},
+		"pausedRemote":  {mismatchRemotePaused},
+		"sendOnly":      {mismatchBothSendOnly},
+	}
+
+	folders := clusterConfigFolders(myID, deviceCfg, folderCfgs, cm)
+	if len(folders) != len(expected) {
+		t.Errorf("Expected %d folders, got %d: %v", len(expected), len(folders), folders)
+	}
+	for _, f := range folders {
+		if exp, ok := expected[f.Folder]; !ok {
+			t.Errorf("Unexpected folder %v", f.Folder)
+		} else if !reflect.DeepEqual(f.Mismatches, exp) {
+			t.Errorf("Folder %v: expected mismatches %v, got %v", f.Folder, exp, f.Mismatches)
+		}
+		switch f.Folder {
+		case "ok":
+			if !f.SharedLocally || !f.SharedByRemote || !f.Introducer {
+				t.Errorf("Unexpected state for folder ok: %+v", f)
+			}
+		case "notSharedBack":
+			if !f.SharedLocally || f.SharedByRemote || f.RemoteType != "" {
+				t.Errorf("Unexpected state for folder notSharedBack: %+v", f)
+			}
+		case "notLocal":
+			if f.SharedLocally || !f.SharedByRemote || f.LocalType != "" {
+				t.Errorf("Unexpected state for folder notLocal: %+v", f)
+			}
+		case "sendOnly":
+			if f.LocalType != "sendonly" || f.RemoteType != "sendonly" {
+				t.Errorf("Unexpected types for folder sendOnly: %+v", f)
+			}
+		}
+	}
+}
+
+func TestClusterConfigReceivedEvent(t *testing.T) {
+	m, _, _ := setupModelWithConnection()
+	defer cleanupModelAndRemoveDir(m, m.cfg.Folders()["default"].Filesystem().URI())
+
+	sub := m.evLogger.Subscribe(events.ClusterConfigReceived)
+	defer sub.Unsubscribe()
+
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID:      "unknown",
+				Devices: []protocol.Device{{ID: myID}, {ID: device1}},
+			},
+		},
+	})
+
+	ev, err := sub.Poll(time.Second)
+	if err != nil {
+		t.Fatal("Expected event:", err)
+	}
+	data := ev.Data.(map[string]interface{})
+	if data["device"] != device1.String() {
+		t.Errorf("Unexpected device %v", data["device"])
+	}
+	folders := data["folders"].([]clusterConfigFolder)
+	if len(folders) != 2 {
+		t.Fatalf("Expected two folders, got %v", folders)
+	}
+	if folders[0].Folder != "default" || !reflect.DeepEqual(folders[0].Mismatches, []string{mismatchNotSharedBack}) {
+		t.Errorf("Unexpected default folder %+v", folders[0])
+	}
+	if folders[1].Folder != "unknown" || !reflect.DeepEqual(folders[1].Mismatches, []string{mismatchNotLocal}) {
+		t.Errorf("Unexpected unknown folder %+v", folders[1])
+	}
+}
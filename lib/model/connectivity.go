@@ -0,0 +1,100 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"context"
+	stdsync "sync"
+
+	"github.com/pkg/errors"
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/connections"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+var (
+	errConnectivitySelf        = errors.New("cannot test connectivity to ourselves")
+	errConnectivityNoAddresses = errors.New("no addresses known for device")
+	errConnectivityUnavailable = errors.New("connectivity tests are not available")
+)
+
+// ConnectivityResult is the outcome of dialing each address of a device.
+type ConnectivityResult struct {
+	Device    protocol.DeviceID     `json:"device"`
+	Addresses []AddressConnectivity `json:"addresses"`
+}
+
+// AddressConnectivity is the outcome of dialing one address of a device.
+type AddressConnectivity struct {
+	Address   string  `json:"address"`
+	Reachable bool    `json:"reachable"`
+	LatencyMs int64   `json:"latencyMs"` // until the device was identified, if reachable
+	Error     *string `json:"error"`
+}
+
+// SetConnectivityTester sets what is used to dial devices when testing their
+// connectivity.
+func (m *model) SetConnectivityTester(tester connections.ConnectivityTester) {
+	m.pmut.Lock()
+	m.connTester = tester
+	m.pmut.Unlock()
+}
+
+// TestDeviceConnectivity dials all addresses of the device right away and
+// reports whether it could be reached at each of them. The connections are
+// closed again, so an established connection to the device is left as is.
+// Devices that aren't configured yet are looked up using discovery.
+func (m *model) TestDeviceConnectivity(ctx context.Context, device protocol.DeviceID) (ConnectivityResult, error) {
+	if device == m.id {
+		return ConnectivityResult{}, errConnectivitySelf
+	}
+
+	m.pmut.RLock()
+	tester := m.connTester
+	m.pmut.RUnlock()
+	if tester == nil {
+		return ConnectivityResult{}, errConnectivityUnavailable
+	}
+
+	deviceCfg, ok := m.cfg.Device(device)
+	if !ok {
+		deviceCfg = config.DeviceConfiguration{DeviceID: device, Addresses: []string{"dynamic"}}
+	}
+	addrs := tester.DeviceAddresses(deviceCfg)
+	if len(addrs) == 0 {
+		return ConnectivityResult{}, errConnectivityNoAddresses
+	}
+
+	res := ConnectivityResult{
+		Device:    device,
+		Addresses: make([]AddressConnectivity, len(addrs)),
+	}
+	var wg stdsync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			res.Addresses[i] = testAddressConnectivity(ctx, tester, deviceCfg, addr)
+		}(i, addr)
+	}
+	wg.Wait()
+	return res, nil
+}
+
+func testAddressConnectivity(ctx context.Context, tester connections.ConnectivityTester, deviceCfg config.DeviceConfiguration, addr string) AddressConnectivity {
+	res := AddressConnectivity{Address: addr}
+	latency, err := tester.DialForConnectivity(ctx, deviceCfg, addr)
+	if err != nil {
+		l.Debugln("testing connectivity to", deviceCfg.DeviceID, addr, "error:", err)
+		errStr := err.Error()
+		res.Error = &errStr
+		return res
+	}
+	res.Reachable = true
+	res.LatencyMs = latency.Nanoseconds() / 1e6
+	return res
+}
@@ -28,9 +28,11 @@ type fakeConnection struct {
 	id                       protocol.DeviceID
 	downloadProgressMessages []downloadProgressMessage
 	closed                   bool
+	drained                  bool
 	files                    []protocol.FileInfo
 	fileData                 map[string][]byte
 	folder                   string
+	capabilities             []string
 	model                    *model
 	indexFn                  func(context.Context, string, []protocol.FileInfo)
 	requestFn                func(ctx context.Context, folder, name string, offset int64, size int, hash []byte, fromTemporary bool) ([]byte, error)
@@ -49,6 +51,13 @@ func (f *fakeConnection) Close(err error) {
 	f.model.Closed(f, err)
 }
 
+func (f *fakeConnection) Drain(_ context.Context, err error) {
+	f.mut.Lock()
+	f.drained = true
+	f.mut.Unlock()
+	f.Close(err)
+}
+
 func (f *fakeConnection) Start() {
 }
 
@@ -93,6 +102,15 @@ func (f *fakeConnection) Request(ctx context.Context, folder, name string, offse
 
 func (f *fakeConnection) ClusterConfig(protocol.ClusterConfig) {}
 
+func (f *fakeConnection) HasCapability(name string) bool {
+	for _, c := range f.capabilities {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *fakeConnection) Ping() bool {
 	f.mut.Lock()
 	defer f.mut.Unlock()
@@ -109,6 +127,14 @@ func (f *fakeConnection) Statistics() protocol.Statistics {
 	return protocol.Statistics{}
 }
 
+func (f *fakeConnection) MetadataRequest(_ context.Context, folder, prefix string) ([]protocol.FileInfo, error) {
+	return nil, protocol.ErrUnsupported
+}
+
+func (f *fakeConnection) RangeRequest(_ context.Context, folder, name string, offset int64, size int) ([]byte, error) {
+	return nil, protocol.ErrUnsupported
+}
+
 func (f *fakeConnection) DownloadProgress(_ context.Context, folder string, updates []protocol.FileDownloadProgressUpdate) {
 	f.downloadProgressMessages = append(f.downloadProgressMessages, downloadProgressMessage{
 		folder:  folder,
@@ -238,6 +264,10 @@ func (f *fakeUnderlyingConn) Crypto() string {
 	return "fake"
 }
 
+func (f *fakeUnderlyingConn) RelayScore() (time.Duration, bool) {
+	return 0, false
+}
+
 func (f *fakeUnderlyingConn) Transport() string {
 	return "fake"
 }
@@ -9,7 +9,6 @@ package model
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"path/filepath"
 	"sort"
 	"sync/atomic"
@@ -19,12 +18,14 @@ import (
 
 	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/ignore"
 	"github.com/syncthing/syncthing/lib/locations"
 	"github.com/syncthing/syncthing/lib/osutil"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
 	"github.com/syncthing/syncthing/lib/scanner"
 	"github.com/syncthing/syncthing/lib/stats"
 	"github.com/syncthing/syncthing/lib/sync"
@@ -33,8 +34,9 @@ import (
 	"github.com/thejerf/suture"
 )
 
-// scanLimiter limits the number of concurrent scans. A limit of zero means no limit.
-var scanLimiter = newByteSemaphore(0)
+// scanOnConnectDelay is how long to wait after a device connected before
+// scanning, so that several devices connecting result in a single scan.
+var scanOnConnectDelay = 10 * time.Second
 
 type folder struct {
 	suture.Service
@@ -55,11 +57,14 @@ type folder struct {
 	scanNow             chan rescanRequest
 	scanDelay           chan time.Duration
 	initialScanFinished chan struct{}
+	connectScan         chan struct{}
 	scanErrors          []FileError
 	scanErrorsMut       sync.Mutex
 
 	pullScheduled chan struct{}
 
+	lowDiskSpace bool
+
 	watchCancel      context.CancelFunc
 	watchChan        chan []string
 	restartWatchChan chan struct{}
@@ -70,8 +75,9 @@ type folder struct {
 }
 
 type rescanRequest struct {
-	subdirs []string
-	err     chan error
+	subdirs      []string
+	metadataOnly bool
+	err          chan error
 }
 
 type puller interface {
@@ -79,6 +85,7 @@ type puller interface {
 }
 
 func newFolder(model *model, fset *db.FileSet, ignores *ignore.Matcher, cfg config.FolderConfiguration, evLogger events.Logger) folder {
+	scanInterval := time.Duration(cfg.RescanIntervalS) * time.Second
 	return folder{
 		stateTracker:              newStateTracker(cfg.ID, evLogger),
 		FolderConfiguration:       cfg,
@@ -89,11 +96,12 @@ func newFolder(model *model, fset *db.FileSet, ignores *ignore.Matcher, cfg conf
 		fset:    fset,
 		ignores: ignores,
 
-		scanInterval:        time.Duration(cfg.RescanIntervalS) * time.Second,
-		scanTimer:           time.NewTimer(time.Millisecond), // The first scan should be done immediately.
+		scanInterval:        scanInterval,
+		scanTimer:           time.NewTimer(initialScanDelay(scanInterval, model.cfg.Options().ScanJitterPct)), // The first scan should be done soon, staggered with other folders.
 		scanNow:             make(chan rescanRequest),
 		scanDelay:           make(chan time.Duration),
 		initialScanFinished: make(chan struct{}),
+		connectScan:         make(chan struct{}, 1),
 		scanErrorsMut:       sync.NewMutex(),
 
 		pullScheduled: make(chan struct{}, 1), // This needs to be 1-buffered so that we queue a pull if we're busy when it comes.
@@ -126,6 +134,11 @@ func (f *folder) serve(ctx context.Context) {
 		f.startWatch()
 	}
 
+	connectScanTimer := time.NewTimer(0)
+	<-connectScanTimer.C
+	defer connectScanTimer.Stop()
+	connectScanPending := false
+
 	initialCompleted := f.initialScanFinished
 
 	pull := func() {
@@ -172,10 +185,39 @@ func (f *folder) serve(ctx context.Context) {
 		case <-f.scanTimer.C:
 			l.Debugln(f, "Scanning due to timer")
 			f.scanTimerFired()
+			// A full scan was just done, no need for another one.
+			if connectScanPending {
+				if !connectScanTimer.Stop() {
+					<-connectScanTimer.C
+				}
+				connectScanPending = false
+			}
+
+		case <-f.connectScan:
+			select {
+			case <-f.initialScanFinished:
+			default:
+				// The initial scan is yet to happen.
+				continue
+			}
+			if !connectScanPending {
+				l.Debugln(f, "Scheduling scan due to device connection")
+				connectScanTimer.Reset(scanOnConnectDelay)
+				connectScanPending = true
+			}
+
+		case <-connectScanTimer.C:
+			l.Debugln(f, "Scanning due to device connection")
+			connectScanPending = false
+			f.scanSubdirs(nil)
 
 		case req := <-f.scanNow:
 			l.Debugln(f, "Scanning due to request")
-			req.err <- f.scanSubdirs(req.subdirs)
+			if req.metadataOnly {
+				req.err <- f.scanMetadataOnly()
+			} else {
+				req.err <- f.scanSubdirs(req.subdirs)
+			}
 
 		case next := <-f.scanDelay:
 			l.Debugln(f, "Delaying scan")
@@ -194,6 +236,12 @@ func (f *folder) serve(ctx context.Context) {
 
 func (f *folder) BringToFront(string) {}
 
+func (f *folder) Prioritize(string) error {
+	return errFolderNotPulling
+}
+
+func (f *folder) applyConfig(config.FolderConfiguration) {}
+
 func (f *folder) Override() {}
 
 func (f *folder) Revert() {}
@@ -219,16 +267,33 @@ func (f *folder) SchedulePull() {
 	}
 }
 
+// scheduleScanOnConnect requests a full scan after a device sharing the
+// folder has connected. Requests in quick succession result in a single
+// scan.
+func (f *folder) scheduleScanOnConnect() {
+	select {
+	case f.connectScan <- struct{}{}:
+	default:
+	}
+}
+
 func (f *folder) Jobs(_, _ int) ([]string, []string, int) {
 	return nil, nil, 0
 }
 
 func (f *folder) Scan(subdirs []string) error {
+	return f.requestScan(rescanRequest{subdirs: subdirs})
+}
+
+// ScanMetadataOnly checks the folder for changes without hashing, see
+// scanMetadataOnly.
+func (f *folder) ScanMetadataOnly() error {
+	return f.requestScan(rescanRequest{metadataOnly: true})
+}
+
+func (f *folder) requestScan(req rescanRequest) error {
 	<-f.initialScanFinished
-	req := rescanRequest{
-		subdirs: subdirs,
-		err:     make(chan error),
-	}
+	req.err = make(chan error)
 
 	select {
 	case f.scanNow <- req:
@@ -242,13 +307,41 @@ func (f *folder) Reschedule() {
 	if f.scanInterval == 0 {
 		return
 	}
-	// Sleep a random time between 3/4 and 5/4 of the configured interval.
-	sleepNanos := (f.scanInterval.Nanoseconds()*3 + rand.Int63n(2*f.scanInterval.Nanoseconds())) / 4
-	interval := time.Duration(sleepNanos) * time.Nanosecond
+	interval := jitteredInterval(f.scanInterval, f.model.cfg.Options().ScanJitterPct)
 	l.Debugln(f, "next rescan in", interval)
 	f.scanTimer.Reset(interval)
 }
 
+// maxInitialScanStagger bounds how long the first scan of a folder is
+// delayed, as nothing is pulled before it's done.
+const maxInitialScanStagger = 10 * time.Second
+
+// initialScanDelay returns a random delay for the first scan of a folder,
+// within jitterPct percent of the interval but at most of
+// maxInitialScanStagger. Folders started together thus don't all scan at
+// once.
+func initialScanDelay(interval time.Duration, jitterPct int) time.Duration {
+	if jitterPct <= 0 {
+		return time.Millisecond
+	}
+	if interval <= 0 || interval > maxInitialScanStagger {
+		interval = maxInitialScanStagger
+	}
+	jitter := float64(interval) * float64(jitterPct) / 100
+	return time.Millisecond + time.Duration(jitter*rand.Float64())
+}
+
+// jitteredInterval returns a random duration within jitterPct percent of the
+// interval. Folders with the same interval thus don't all scan at the same
+// time, while on average they still scan at the configured interval.
+func jitteredInterval(interval time.Duration, jitterPct int) time.Duration {
+	if jitterPct <= 0 {
+		return interval
+	}
+	jitter := float64(interval) * float64(jitterPct) / 100
+	return interval + time.Duration(jitter*(2*rand.Float64()-1))
+}
+
 func (f *folder) Delay(next time.Duration) {
 	f.scanDelay <- next
 }
@@ -269,6 +362,12 @@ func (f *folder) getHealthError() error {
 		return err
 	}
 
+	// Nothing can be stored while the database is read only, so we neither
+	// scan nor pull.
+	if err := backend.CheckWritable(f.model.db.Backend); err != nil {
+		return err
+	}
+
 	dbPath := locations.Get(locations.Database)
 	if usage, err := fs.NewFilesystem(fs.FilesystemTypeBasic, dbPath).Usage("."); err == nil {
 		if err = config.CheckFreeSpace(f.model.cfg.Options().MinHomeDiskFree, usage); err != nil {
@@ -279,6 +378,41 @@ func (f *folder) getHealthError() error {
 	return nil
 }
 
+// checkDiskSpace compares the free space on the given filesystem with the
+// folder's configured minimum and emits a FolderLowDiskSpace or
+// FolderSufficientDiskSpace event when the folder crosses the threshold.
+func (f *folder) checkDiskSpace(ffs fs.Filesystem) {
+	val := f.MinDiskFree.BaseValue()
+	if val <= 0 {
+		return
+	}
+	usage, err := ffs.Usage(".")
+	if err != nil {
+		l.Debugf("%v: failed to get disk usage: %v", f.Description(), err)
+		return
+	}
+
+	low := config.CheckFreeSpace(f.MinDiskFree, usage) != nil
+	if low == f.lowDiskSpace {
+		return
+	}
+	f.lowDiskSpace = low
+
+	required := int64(val)
+	if f.MinDiskFree.Percentage() {
+		required = int64(val / 100 * float64(usage.Total))
+	}
+	ev := events.FolderSufficientDiskSpace
+	if low {
+		ev = events.FolderLowDiskSpace
+	}
+	f.evLogger.Log(ev, map[string]interface{}{
+		"folder":   f.ID,
+		"required": required,
+		"free":     usage.Free,
+	})
+}
+
 func (f *folder) scanSubdirs(subDirs []string) error {
 	if err := f.getHealthError(); err != nil {
 		// If there is a health error we set it as the folder error. We do not
@@ -312,8 +446,8 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 	f.setError(nil)
 	f.setState(FolderScanWaiting)
 
-	scanLimiter.take(1)
-	defer scanLimiter.give(1)
+	f.model.scanLimiter.take(1)
+	defer f.model.scanLimiter.give(1)
 
 	for i := range subDirs {
 		sub := osutil.NativeFilename(subDirs[i])
@@ -336,7 +470,13 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 		return ok
 	})
 
+	// Deferred after taking the limiter, so that we are done scanning by
+	// the time another folder may start.
 	f.setState(FolderScanning)
+	defer f.setState(FolderIdle)
+
+	var stats scanner.Stats
+	var dbUpdateDuration time.Duration
 
 	mtimefs := f.fset.MtimeFS()
 	fchan := scanner.Walk(f.ctx, scanner.Config{
@@ -354,14 +494,40 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 		LocalFlags:            f.localFlags,
 		ModTimeWindow:         f.ModTimeWindow(),
 		EventLogger:           f.evLogger,
+		BlockSizeStrategy:     f.BlockSizeStrategy,
+		VerifyFraction:        f.ScanVerifyFraction,
+		PreserveHardlinks:     f.PreserveHardlinks,
+		SkipContentTypes:      f.SkipContentTypes,
+		Stats:                 &stats,
+		ProgressFn: func(current, total int64) {
+			f.model.progressEmitter.observers.scanProgress(f.ID, current, total)
+		},
 	})
 
+	// Changes are committed to the database in large atomic batches, each
+	// also announced once committed. An interrupted scan leaves the
+	// database with the batches committed so far.
+	dbBatch := f.fset.NewUpdateBatch(func(fs []protocol.FileInfo) {
+		f.localsUpdated(fs)
+		f.emitDiskChangeEvents(fs, events.LocalChangeDetected)
+	})
+	commitDBBatch := func() {
+		t0 := time.Now()
+		dbBatch.Commit()
+		dbUpdateDuration += time.Since(t0)
+	}
+	// Keep what passed the health checks when returning early.
+	defer dbBatch.Commit()
 	batchFn := func(fs []protocol.FileInfo) error {
 		if err := f.CheckHealth(); err != nil {
 			l.Debugf("Stopping scan of folder %s due to: %s", f.Description(), err)
 			return err
 		}
-		f.updateLocalsFromScanning(fs)
+		t0 := time.Now()
+		for _, file := range fs {
+			dbBatch.Update(file)
+		}
+		dbUpdateDuration += time.Since(t0)
 		return nil
 	}
 	// Resolve items which are identical with the global state.
@@ -415,6 +581,9 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 	if err := batch.flush(); err != nil {
 		return err
 	}
+	// The next phase looks for deleted files in the database, which must
+	// include what was just scanned.
+	commitDBBatch()
 
 	if len(subDirs) == 0 {
 		// If we have no specific subdirectories to traverse, set it to one
@@ -486,7 +655,7 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 				// it's still here. Simply stat:ing it wont do as there are
 				// tons of corner cases (e.g. parent dir->symlink, missing
 				// permissions)
-				if !osutil.IsDeleted(mtimefs, file.Name) {
+				if !f.isDeleted(mtimefs, file.Name) {
 					if ignoredParent != "" {
 						// Don't ignore parents of this not ignored item
 						toIgnore = toIgnore[:0]
@@ -546,12 +715,91 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 	if err := batch.flush(); err != nil {
 		return err
 	}
+	commitDBBatch()
+
+	f.evLogger.Log(events.FolderScanSummary, map[string]interface{}{
+		"folder":           f.ID,
+		"filesHashed":      stats.FilesHashed,
+		"bytesHashed":      stats.BytesHashed,
+		"walkDuration":     stats.WalkDuration.Seconds(),
+		"hashDuration":     stats.HashDuration.Seconds(),
+		"dbUpdateDuration": dbUpdateDuration.Seconds(),
+	})
 
 	f.ScanCompleted()
-	f.setState(FolderIdle)
 	return nil
 }
 
+// scanMetadataOnly walks the folder, comparing only size, modification time
+// and permissions to what is in the database. Changed files are not hashed,
+// they are flagged as needing a rescan instead, which the next normal scan
+// does. Deleted files aren't looked for.
+func (f *folder) scanMetadataOnly() error {
+	if err := f.getHealthError(); err != nil {
+		f.setError(err)
+		return err
+	}
+	f.setError(nil)
+	f.setState(FolderScanWaiting)
+
+	f.model.scanLimiter.take(1)
+	defer f.model.scanLimiter.give(1)
+
+	f.setState(FolderScanning)
+	defer f.setState(FolderIdle)
+
+	fchan := scanner.Walk(f.ctx, scanner.Config{
+		Folder:                f.ID,
+		Matcher:               f.ignores,
+		CurrentFiler:          cFiler{f.fset},
+		Filesystem:            f.fset.MtimeFS(),
+		IgnorePerms:           f.IgnorePerms,
+		AutoNormalize:         f.AutoNormalize,
+		ShortID:               f.shortID,
+		ProgressTickIntervalS: -1,
+		LocalFlags:            f.localFlags,
+		ModTimeWindow:         f.ModTimeWindow(),
+		EventLogger:           f.evLogger,
+		BlockSizeStrategy:     f.BlockSizeStrategy,
+		MetadataOnly:          true,
+		PreserveHardlinks:     f.PreserveHardlinks,
+		SkipContentTypes:      f.SkipContentTypes,
+	})
+
+	batch := newFileInfoBatch(func(fs []protocol.FileInfo) error {
+		if err := f.CheckHealth(); err != nil {
+			l.Debugf("Stopping metadata scan of folder %s due to: %s", f.Description(), err)
+			return err
+		}
+		f.updateLocalsFromScanning(fs)
+		return nil
+	})
+	for res := range fchan {
+		if res.Err != nil {
+			f.newScanError(res.Path, res.Err)
+			continue
+		}
+		if err := batch.flushIfFull(); err != nil {
+			return err
+		}
+		batch.append(res.File)
+	}
+	return batch.flush()
+}
+
+// isDeleted returns whether the file no longer exists. When following
+// symlinks, files below symlinks are not considered deleted.
+func (f *folder) isDeleted(ffs fs.Filesystem, name string) bool {
+	if !f.FollowSymlinks.Enabled {
+		return osutil.IsDeleted(ffs, name)
+	}
+	if _, err := ffs.Lstat(name); fs.IsNotExist(err) {
+		return true
+	}
+	_, ok := osutil.TraversesSymlink(ffs, filepath.Dir(name)).(*osutil.NotADirectoryError)
+	return ok
+}
+
 func (f *folder) scanTimerFired() {
 	err := f.scanSubdirs(nil)
 
@@ -770,6 +1018,28 @@ outer:
 	f.scanErrors = filtered
 }
 
+// ClearError drops the scan error for the given item and rescans it.
+func (f *folder) ClearError(path string) error {
+	f.scanErrorsMut.Lock()
+	found := false
+	filtered := f.scanErrors[:0]
+	for _, fe := range f.scanErrors {
+		if fe.Path == path {
+			found = true
+			continue
+		}
+		filtered = append(filtered, fe)
+	}
+	f.scanErrors = filtered
+	f.scanErrorsMut.Unlock()
+
+	if !found {
+		return errNoFileError
+	}
+	go func() { _ = f.Scan([]string{path}) }()
+	return nil
+}
+
 func (f *folder) Errors() []FileError {
 	f.scanErrorsMut.Lock()
 	defer f.scanErrorsMut.Unlock()
@@ -799,7 +1069,12 @@ func (f *folder) updateLocalsFromPulling(fs []protocol.FileInfo) {
 
 func (f *folder) updateLocals(fs []protocol.FileInfo) {
 	f.fset.Update(protocol.LocalDeviceID, fs)
+	f.localsUpdated(fs)
+}
 
+// localsUpdated announces that the given local files were updated in the
+// database.
+func (f *folder) localsUpdated(fs []protocol.FileInfo) {
 	filenames := make([]string, len(fs))
 	for i, file := range fs {
 		filenames[i] = file.Name
@@ -890,6 +1165,20 @@ func unifySubs(dirs []string, exists func(dir string) bool) []string {
 	return dirs
 }
 
+// inSubpaths returns true if the name is at or below one of the given
+// canonical paths, or if there are none.
+func inSubpaths(name string, subs []string) bool {
+	if len(subs) == 0 {
+		return true
+	}
+	for _, sub := range subs {
+		if name == sub || fs.IsParent(name, sub) {
+			return true
+		}
+	}
+	return false
+}
+
 type cFiler struct {
 	*db.FileSet
 }
@@ -21,6 +21,8 @@ import (
 
 func init() {
 	folderFactories[config.FolderTypeReceiveOnly] = newReceiveOnlyFolder
+	// The encrypted data is pulled as is, and must not be changed locally.
+	folderFactories[config.FolderTypeReceiveEncrypted] = newReceiveOnlyFolder
 }
 
 /*
@@ -64,6 +66,12 @@ func newReceiveOnlyFolder(model *model, fset *db.FileSet, ignores *ignore.Matche
 }
 
 func (f *receiveOnlyFolder) Revert() {
+	f.revert(nil)
+}
+
+// revert throws away the local changes to the items at or below the given
+// canonical paths, or to the whole folder if there are none.
+func (f *receiveOnlyFolder) revert(subs []string) {
 	f.setState(FolderScanning)
 	defer f.setState(FolderIdle)
 
@@ -81,7 +89,7 @@ func (f *receiveOnlyFolder) Revert() {
 	batchSizeBytes := 0
 	f.fset.WithHave(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
 		fi := intf.(protocol.FileInfo)
-		if !fi.IsReceiveOnlyChanged() {
+		if !fi.IsReceiveOnlyChanged() || !inSubpaths(fi.Name, subs) {
 			// We're only interested in files that have changed locally in
 			// receive only mode.
 			return true
@@ -195,6 +195,82 @@ func TestRecvOnlyRevertNeeds(t *testing.T) {
 	}
 }
 
+func TestRecvOnlyRevertSubpaths(t *testing.T) {
+	// Make sure that only the local changes at the given paths are
+	// reverted, and the other ones are kept.
+
+	m, f := setupROFolder()
+	ffs := f.Filesystem()
+	defer cleanupModelAndRemoveDir(m, ffs.URI())
+
+	must(t, ffs.MkdirAll(".stfolder", 0755))
+	oldData := []byte("hello\n")
+	knownFiles := setupKnownFiles(t, ffs, oldData)
+
+	m.Index(device1, "ro", knownFiles)
+	f.updateLocalsFromScanning(knownFiles)
+
+	m.startFolder("ro")
+	m.ScanFolder("ro")
+
+	// Change the known file and add some unknown ones.
+
+	must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "knownDir/knownFile"), []byte("totally different data\n"), 0644))
+	must(t, ffs.MkdirAll("unknownDir", 0755))
+	must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "unknownDir/unknownFile"), []byte("hello\n"), 0644))
+	must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "unknownFile"), []byte("hello\n"), 0644))
+	must(t, m.ScanFolder("ro"))
+
+	size := m.ReceiveOnlyChangedSize("ro")
+	if size.Files != 3 || size.Directories != 1 {
+		t.Fatalf("ROChanged: expected 3 files and 1 directory: %+v", size)
+	}
+
+	if err := m.RevertSubpaths("ro", []string{"../unknownDir"}); err == nil {
+		t.Error("Expected error reverting path outside of the folder")
+	}
+	if err := m.RevertSubpaths("default", []string{"unknownDir"}); err != errFolderNotReceiveOnly {
+		t.Errorf("Expected %v, got %v", errFolderNotReceiveOnly, err)
+	}
+
+	// Revert the unknown directory, which is deleted along with its
+	// contents.
+
+	must(t, m.RevertSubpaths("ro", []string{"unknownDir"}))
+
+	for _, p := range []string{"unknownDir", "unknownDir/unknownFile"} {
+		if _, err := ffs.Stat(p); !fs.IsNotExist(err) {
+			t.Error("Unexpected existing thing:", p)
+		}
+	}
+	for _, p := range []string{"knownDir/knownFile", "unknownFile"} {
+		if _, err := ffs.Stat(p); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	size = m.ReceiveOnlyChangedSize("ro")
+	if size.Files != 2 || size.Directories != 0 {
+		t.Fatalf("ROChanged: expected 2 files: %+v", size)
+	}
+	size = m.NeedSize("ro")
+	if size.Files+size.Directories > 0 {
+		t.Fatalf("Need: expected nothing: %+v", size)
+	}
+
+	// Revert the known file, which is then needed again.
+
+	must(t, m.RevertSubpaths("ro", []string{"knownDir/knownFile"}))
+
+	size = m.ReceiveOnlyChangedSize("ro")
+	if size.Files != 1 {
+		t.Fatalf("ROChanged: expected 1 file: %+v", size)
+	}
+	size = m.NeedSize("ro")
+	if size.Files != 1 || size.Bytes != int64(len(oldData)) {
+		t.Fatalf("Need: expected to need the old file data: %+v", size)
+	}
+}
+
 func TestRecvOnlyUndoChanges(t *testing.T) {
 	testOs := &fatalOs{t}
 
@@ -95,11 +95,20 @@ func (f *sendOnlyFolder) pull() bool {
 }
 
 func (f *sendOnlyFolder) Override() {
+	f.override(nil)
+}
+
+// override re-asserts the local state of the items at or below the given
+// canonical paths, or of the whole folder if there are none.
+func (f *sendOnlyFolder) override(subs []string) {
 	f.setState(FolderScanning)
 	batch := make([]protocol.FileInfo, 0, maxBatchSizeFiles)
 	batchSizeBytes := 0
 	f.fset.WithNeed(protocol.LocalDeviceID, func(fi db.FileIntf) bool {
 		need := fi.(protocol.FileInfo)
+		if !inSubpaths(need.Name, subs) {
+			return true
+		}
 		if len(batch) == maxBatchSizeFiles || batchSizeBytes > maxBatchSizeBytes {
 			f.updateLocalsFromScanning(batch)
 			batch = batch[:0]
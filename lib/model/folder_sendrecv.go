@@ -60,6 +60,10 @@ type copyBlocksState struct {
 // Which filemode bits to preserve
 const retainBits = fs.ModeSetgid | fs.ModeSetuid | fs.ModeSticky
 
+// quarantineDir is where corrupt reassembled files are moved to. It's
+// within the folder marker directory, so it's never scanned.
+var quarantineDir = filepath.Join(config.DefaultMarkerName, "quarantine")
+
 var (
 	activity                  = newDeviceActivity()
 	errNoDevice               = errors.New("peers who had this file went away, or the file has changed while syncing. will retry later")
@@ -70,6 +74,8 @@ var (
 	errModified               = errors.New("file modified but not rescanned; will try again later")
 	errUnexpectedDirOnFileDel = errors.New("encountered directory when trying to remove file/symlink")
 	errIncompatibleSymlink    = errors.New("incompatible symlink entry; rescan with newer Syncthing on source")
+	errNotGlobal              = errors.New("no other device has this file")
+	errReassembledCorrupt     = errors.New("reassembled file does not match the expected hashes; will pull again")
 	contextRemovingOldItem    = "removing item to be replaced"
 )
 
@@ -85,6 +91,8 @@ const (
 
 const (
 	defaultCopiers          = 2
+	defaultPullers          = 1
+	defaultFinishers        = 1
 	defaultPullerPause      = 60 * time.Second
 	defaultPullerPendingKiB = 2 * protocol.MaxBlockSize / 1024
 
@@ -107,6 +115,41 @@ type sendReceiveFolder struct {
 	pullErrors    map[string]string // errors for most recent/current iteration
 	oldPullErrors map[string]string // errors from previous iterations for log filtering only
 	pullErrorsMut sync.Mutex
+
+	prioritized map[string]struct{} // files to pull first, until they are done
+	prioMut     sync.Mutex
+
+	workers    pullerWorkers // applied at the start of each pull
+	workersMut sync.Mutex
+
+	workerStarted func(stage string) // for tests
+
+	rejected int // items rejected by policy in the last pull, for logging
+}
+
+// pullerWorkers are the number of routines for each stage of pulling.
+type pullerWorkers struct {
+	copiers, pullers, finishers int
+}
+
+// pullerWorkersFor returns the configured number of routines, with the
+// defaults for those that are unset.
+func pullerWorkersFor(cfg config.FolderConfiguration) pullerWorkers {
+	w := pullerWorkers{
+		copiers:   cfg.Copiers,
+		pullers:   cfg.Pullers,
+		finishers: cfg.Finishers,
+	}
+	if w.copiers <= 0 {
+		w.copiers = defaultCopiers
+	}
+	if w.pullers <= 0 {
+		w.pullers = defaultPullers
+	}
+	if w.finishers <= 0 {
+		w.finishers = defaultFinishers
+	}
+	return w
 }
 
 func newSendReceiveFolder(model *model, fset *db.FileSet, ignores *ignore.Matcher, cfg config.FolderConfiguration, ver versioner.Versioner, fs fs.Filesystem, evLogger events.Logger) service {
@@ -116,14 +159,14 @@ func newSendReceiveFolder(model *model, fset *db.FileSet, ignores *ignore.Matche
 		versioner:     ver,
 		queue:         newJobQueue(),
 		pullErrorsMut: sync.NewMutex(),
+		prioritized:   make(map[string]struct{}),
+		prioMut:       sync.NewMutex(),
+		workers:       pullerWorkersFor(cfg),
+		workersMut:    sync.NewMutex(),
 	}
 	f.folder.puller = f
 	f.folder.Service = util.AsService(f.serve, f.String())
 
-	if f.Copiers == 0 {
-		f.Copiers = defaultCopiers
-	}
-
 	// If the configured max amount of pending data is zero, we use the
 	// default. If it's configured to something non-zero but less than the
 	// protocol block size we adjust it upwards accordingly.
@@ -162,6 +205,8 @@ func (f *sendReceiveFolder) pull() bool {
 		return false
 	}
 
+	f.checkDiskSpace(f.fs)
+
 	// Check if the ignore patterns changed.
 	oldHash := f.ignores.Hash()
 	defer func() {
@@ -244,7 +289,11 @@ func (f *sendReceiveFolder) pullerIteration(scanChan chan<- string) int {
 	doneWg := sync.NewWaitGroup()
 	updateWg := sync.NewWaitGroup()
 
-	l.Debugln(f, "copiers:", f.Copiers, "pullerPendingKiB:", f.PullerMaxPendingKiB)
+	f.workersMut.Lock()
+	workers := f.workers
+	f.workersMut.Unlock()
+
+	l.Debugln(f, "copiers:", workers.copiers, "pullers:", workers.pullers, "finishers:", workers.finishers, "pullerPendingKiB:", f.PullerMaxPendingKiB)
 
 	updateWg.Add(1)
 	go func() {
@@ -253,8 +302,9 @@ func (f *sendReceiveFolder) pullerIteration(scanChan chan<- string) int {
 		updateWg.Done()
 	}()
 
-	for i := 0; i < f.Copiers; i++ {
+	for i := 0; i < workers.copiers; i++ {
 		copyWg.Add(1)
+		f.startedWorker("copier")
 		go func() {
 			// copierRoutine finishes when copyChan is closed
 			f.copierRoutine(copyChan, pullChan, finisherChan)
@@ -262,21 +312,29 @@ func (f *sendReceiveFolder) pullerIteration(scanChan chan<- string) int {
 		}()
 	}
 
-	pullWg.Add(1)
-	go func() {
-		// pullerRoutine finishes when pullChan is closed
-		f.pullerRoutine(pullChan, finisherChan)
-		pullWg.Done()
-	}()
+	// The pullers share the limit on pending requests.
+	requestLimiter := newByteSemaphore(f.PullerMaxPendingKiB * 1024)
+	for i := 0; i < workers.pullers; i++ {
+		pullWg.Add(1)
+		f.startedWorker("puller")
+		go func() {
+			// pullerRoutine finishes when pullChan is closed
+			f.pullerRoutine(pullChan, finisherChan, requestLimiter)
+			pullWg.Done()
+		}()
+	}
 
-	doneWg.Add(1)
-	// finisherRoutine finishes when finisherChan is closed
-	go func() {
-		f.finisherRoutine(finisherChan, dbUpdateChan, scanChan)
-		doneWg.Done()
-	}()
+	for i := 0; i < workers.finishers; i++ {
+		doneWg.Add(1)
+		f.startedWorker("finisher")
+		// finisherRoutine finishes when finisherChan is closed
+		go func() {
+			f.finisherRoutine(finisherChan, dbUpdateChan, scanChan)
+			doneWg.Done()
+		}()
+	}
 
-	changed, fileDeletions, dirDeletions, err := f.processNeeded(dbUpdateChan, copyChan, scanChan)
+	changed, fileDeletions, dirDeletions, links, err := f.processNeeded(dbUpdateChan, copyChan, scanChan)
 
 	// Signal copy and puller routines that we are done with the in data for
 	// this iteration. Wait for them to finish.
@@ -290,6 +348,13 @@ func (f *sendReceiveFolder) pullerIteration(scanChan chan<- string) int {
 	close(finisherChan)
 	doneWg.Wait()
 
+	// The targets of these were pulled above. Those that can't be linked
+	// remain needed and are pulled in the next iteration.
+	for _, file := range links {
+		f.linkFile(file, true, dbUpdateChan, scanChan)
+		f.queue.Done(file.Name)
+	}
+
 	if err == nil {
 		f.processDeletions(fileDeletions, dirDeletions, dbUpdateChan, scanChan)
 	}
@@ -307,8 +372,13 @@ func (f *sendReceiveFolder) pullerIteration(scanChan chan<- string) int {
 	return changed
 }
 
-func (f *sendReceiveFolder) processNeeded(dbUpdateChan chan<- dbUpdateJob, copyChan chan<- copyBlocksState, scanChan chan<- string) (int, map[string]protocol.FileInfo, []protocol.FileInfo, error) {
+// processNeeded handles the needed items, queueing files to be copied and
+// pulled. Files to be hardlinked to files that are pulled are returned, to
+// be linked once those are in place.
+func (f *sendReceiveFolder) processNeeded(dbUpdateChan chan<- dbUpdateJob, copyChan chan<- copyBlocksState, scanChan chan<- string) (int, map[string]protocol.FileInfo, []protocol.FileInfo, []protocol.FileInfo, error) {
 	changed := 0
+	rejected := 0
+	var rejectedExample string
 	var dirDeletions []protocol.FileInfo
 	fileDeletions := map[string]protocol.FileInfo{}
 	buckets := map[string][]protocol.FileInfo{}
@@ -324,22 +394,32 @@ func (f *sendReceiveFolder) processNeeded(dbUpdateChan chan<- dbUpdateJob, copyC
 		default:
 		}
 
-		if f.IgnoreDelete && intf.IsDeleted() {
-			l.Debugln(f, "ignore file deletion (config)", intf.FileName())
+		file := intf.(protocol.FileInfo)
+		step, cur, hasCur := f.planPullStep(file)
+		if step == pullStepNone {
+			l.Debugln(f, "ignore file deletion (config)", file.Name)
 			return true
 		}
 
 		changed++
 
-		file := intf.(protocol.FileInfo)
+		switch step {
+		case pullStepRejected:
+			// Rejected items stay needed as they are in the index, so a
+			// change in policy takes effect on the next pull.
+			changed--
+			rejected++
+			if rejectedExample == "" {
+				rejectedExample = file.Name
+			}
+			l.Debugln(f, "Not pulling item rejected by policy", file.Name)
 
-		switch {
-		case f.ignores.ShouldIgnore(file.Name):
+		case pullStepIgnored:
 			file.SetIgnored(f.shortID)
 			l.Debugln(f, "Handling ignored file", file)
 			dbUpdateChan <- dbUpdateJob{file, dbUpdateInvalidate}
 
-		case runtime.GOOS == "windows" && fs.WindowsInvalidFilename(file.Name):
+		case pullStepInvalidName:
 			if file.IsDeleted() {
 				// Just pretend we deleted it, no reason to create an error
 				// about a deleted file that we can't have anyway.
@@ -353,96 +433,95 @@ func (f *sendReceiveFolder) processNeeded(dbUpdateChan chan<- dbUpdateJob, copyC
 				changed--
 			}
 
-		case file.IsDeleted():
-			if file.IsDirectory() {
-				// Perform directory deletions at the end, as we may have
-				// files to delete inside them before we get to that point.
-				dirDeletions = append(dirDeletions, file)
-			} else if file.IsSymlink() {
-				f.deleteFile(file, dbUpdateChan, scanChan)
-			} else {
-				df, ok := f.fset.Get(protocol.LocalDeviceID, file.Name)
-				// Local file can be already deleted, but with a lower version
-				// number, hence the deletion coming in again as part of
-				// WithNeed, furthermore, the file can simply be of the wrong
-				// type if we haven't yet managed to pull it.
-				if ok && !df.IsDeleted() && !df.IsSymlink() && !df.IsDirectory() && !df.IsInvalid() {
-					fileDeletions[file.Name] = file
-					// Put files into buckets per first hash
-					key := string(df.Blocks[0].Hash)
-					buckets[key] = append(buckets[key], df)
-				} else {
-					f.deleteFileWithCurrent(file, df, ok, dbUpdateChan, scanChan)
-				}
-			}
+		case pullStepDeleteDir:
+			// Perform directory deletions at the end, as we may have
+			// files to delete inside them before we get to that point.
+			dirDeletions = append(dirDeletions, file)
 
-		case file.Type == protocol.FileInfoTypeFile:
-			curFile, hasCurFile := f.fset.Get(protocol.LocalDeviceID, file.Name)
-			if _, need := blockDiff(curFile.Blocks, file.Blocks); hasCurFile && len(need) == 0 {
-				// We are supposed to copy the entire file, and then fetch nothing. We
-				// are only updating metadata, so we don't actually *need* to make the
-				// copy.
-				f.shortcutFile(file, curFile, dbUpdateChan)
-			} else {
-				// Queue files for processing after directories and symlinks.
-				f.queue.Push(file.Name, file.Size, file.ModTime())
-			}
+		case pullStepDeleteFileLater:
+			fileDeletions[file.Name] = file
+			// Put files into buckets per first hash
+			key := string(cur.Blocks[0].Hash)
+			buckets[key] = append(buckets[key], cur)
+
+		case pullStepDeleteFile:
+			f.deleteFileWithCurrent(file, cur, hasCur, dbUpdateChan, scanChan)
+
+		case pullStepShortcut:
+			// We are supposed to copy the entire file, and then fetch nothing. We
+			// are only updating metadata, so we don't actually *need* to make the
+			// copy.
+			f.shortcutFile(file, cur, dbUpdateChan)
 
-		case runtime.GOOS == "windows" && file.IsSymlink():
+		case pullStepFile:
+			// Queue files for processing after directories and symlinks.
+			f.queue.Push(file.Name, file.Size, file.ModTime())
+
+		case pullStepUnsupported:
 			file.SetUnsupported(f.shortID)
 			l.Debugln(f, "Invalidating symlink (unsupported)", file.Name)
 			dbUpdateChan <- dbUpdateJob{file, dbUpdateInvalidate}
 
-		case file.IsDirectory() && !file.IsSymlink():
+		case pullStepDir:
 			l.Debugln(f, "Handling directory", file.Name)
 			if f.checkParent(file.Name, scanChan) {
 				f.handleDir(file, dbUpdateChan, scanChan)
 			}
 
-		case file.IsSymlink():
+		case pullStepSymlink:
 			l.Debugln(f, "Handling symlink", file.Name)
 			if f.checkParent(file.Name, scanChan) {
 				f.handleSymlink(file, dbUpdateChan, scanChan)
 			}
-
-		default:
-			l.Warnln(file)
-			panic("unhandleable item type, can't happen")
 		}
 
 		return true
 	})
 
+	// Only log about rejected items when their number changes, not on
+	// every pull.
+	if rejected != f.rejected {
+		if rejected > 0 {
+			l.Infof("%v: Not pulling %d items rejected by policy, e.g. %s", f, rejected, rejectedExample)
+		}
+		f.rejected = rejected
+	}
+
 	select {
 	case <-f.ctx.Done():
-		return changed, nil, nil, f.ctx.Err()
+		return changed, nil, nil, nil, f.ctx.Err()
 	default:
 	}
 
 	// Now do the file queue. Reorder it according to configuration.
 
-	switch f.Order {
-	case config.OrderRandom:
-		f.queue.Shuffle()
-	case config.OrderAlphabetic:
-	// The queue is already in alphabetic order.
-	case config.OrderSmallestFirst:
-		f.queue.SortSmallestFirst()
-	case config.OrderLargestFirst:
-		f.queue.SortLargestFirst()
-	case config.OrderOldestFirst:
-		f.queue.SortOldestFirst()
-	case config.OrderNewestFirst:
-		f.queue.SortNewestFirst()
-	}
+	f.orderQueue()
 
 	// Process the file queue.
 
+	var later, links []protocol.FileInfo
+	var pulling map[string]struct{}
+	if f.PreserveHardlinks {
+		pulling = make(map[string]struct{})
+	}
+	pull := func(fi protocol.FileInfo) {
+		if f.availableFromConnected(fi.Name) {
+			// Handle the file normally, by coping and pulling, etc.
+			if pulling != nil {
+				pulling[fi.Name] = struct{}{}
+			}
+			f.handleFile(fi, copyChan, dbUpdateChan)
+			return
+		}
+		f.newPullError(fi.Name, errNotAvailable)
+		f.queue.Done(fi.Name)
+	}
+
 nextFile:
 	for {
 		select {
 		case <-f.ctx.Done():
-			return changed, fileDeletions, dirDeletions, f.ctx.Err()
+			return changed, fileDeletions, dirDeletions, links, f.ctx.Err()
 		default:
 		}
 
@@ -498,19 +577,298 @@ nextFile:
 			}
 		}
 
-		devices := f.fset.Availability(fileName)
-		for _, dev := range devices {
-			if _, ok := f.model.Connection(dev); ok {
-				// Handle the file normally, by coping and pulling, etc.
-				f.handleFile(fi, copyChan, dbUpdateChan)
-				continue nextFile
+		if f.PreserveHardlinks && fi.HardlinkTarget != "" {
+			// The target may be among the files still queued.
+			later = append(later, fi)
+			continue nextFile
+		}
+
+		pull(fi)
+	}
+
+	// Files to be hardlinked are linked to their targets if those are in
+	// place, once they are if they are being pulled, or pulled otherwise.
+	for _, fi := range later {
+		if _, ok := pulling[fi.HardlinkTarget]; ok {
+			links = append(links, fi)
+		} else if f.linkFile(fi, false, dbUpdateChan, scanChan) {
+			f.queue.Done(fi.Name)
+		} else {
+			pull(fi)
+		}
+	}
+
+	return changed, fileDeletions, dirDeletions, links, nil
+}
+
+// orderQueue sorts the file queue according to the configured order, and
+// then moves the files matching the priority patterns to the front.
+func (f *sendReceiveFolder) orderQueue() {
+	switch f.Order {
+	case config.OrderRandom:
+		f.queue.Shuffle()
+	case config.OrderAlphabetic:
+	// The queue is already in alphabetic order.
+	case config.OrderSmallestFirst:
+		f.queue.SortSmallestFirst()
+	case config.OrderLargestFirst:
+		f.queue.SortLargestFirst()
+	case config.OrderOldestFirst:
+		f.queue.SortOldestFirst()
+	case config.OrderNewestFirst:
+		f.queue.SortNewestFirst()
+	}
+
+	if len(f.PullPriorityPatterns) > 0 {
+		f.queue.Prioritize(func(name string) bool {
+			return matchesPatterns(f.PullPriorityPatterns, name)
+		})
+	}
+
+	// Explicitly prioritized files go first of all. Those no longer in the
+	// queue aren't needed anymore and are forgotten.
+	f.prioMut.Lock()
+	defer f.prioMut.Unlock()
+	if len(f.prioritized) == 0 {
+		return
+	}
+	queued := make(map[string]struct{}, len(f.prioritized))
+	f.queue.Prioritize(func(name string) bool {
+		_, ok := f.prioritized[name]
+		if ok {
+			queued[name] = struct{}{}
+		}
+		return ok
+	})
+	for name := range f.prioritized {
+		if _, ok := queued[name]; !ok {
+			delete(f.prioritized, name)
+		}
+	}
+}
+
+// matchesPatterns returns true if the file matches one of the glob
+// patterns. Patterns without a slash match the file name in any directory,
+// the others the whole path.
+func matchesPatterns(patterns []string, name string) bool {
+	base := filepath.Base(name)
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, base); ok {
+				return true
 			}
+		} else if ok, _ := filepath.Match(filepath.FromSlash(pattern), name); ok {
+			return true
 		}
-		f.newPullError(fileName, errNotAvailable)
-		f.queue.Done(fileName)
+	}
+	return false
+}
+
+// rejectedByPolicy returns true if the item must not be pulled according
+// to the folder's reject patterns and maximum file size. Everything below a
+// directory matching a reject pattern is rejected as well. Deletions are
+// never rejected.
+func rejectedByPolicy(cfg config.FolderConfiguration, file protocol.FileInfo) bool {
+	if file.IsDeleted() {
+		return false
+	}
+	if cfg.MaxFileSize > 0 && file.Type == protocol.FileInfoTypeFile && file.Size > cfg.MaxFileSize {
+		return true
+	}
+	if len(cfg.RejectPatterns) == 0 {
+		return false
+	}
+	for name := file.Name; name != "." && name != string(fs.PathSeparator); name = filepath.Dir(name) {
+		if matchesPatterns(cfg.RejectPatterns, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullStep is what the puller does with a needed item.
+type pullStep int
+
+const (
+	pullStepNone            pullStep = iota // nothing at all, not even a db update
+	pullStepIgnored                         // the item is ignored and invalidated in the db
+	pullStepRejected                        // the item is rejected by policy and left as needed
+	pullStepInvalidName                     // the item can't exist on this system
+	pullStepUnsupported                     // the item type isn't supported on this system
+	pullStepDeleteDir                       // deleted after everything else, deepest first
+	pullStepDeleteFile                      // deleted right away
+	pullStepDeleteFileLater                 // deleted after pulling, unless it can be renamed
+	pullStepShortcut                        // only the metadata changed
+	pullStepFile                            // pulled by the copiers and pullers
+	pullStepDir                             // created or updated right away
+	pullStepSymlink                         // created or updated right away
+)
+
+// planPullStep decides what the puller does with the needed item. It
+// returns the current local version of the item along with the decision,
+// if it was looked up to decide.
+func (f *sendReceiveFolder) planPullStep(file protocol.FileInfo) (pullStep, protocol.FileInfo, bool) {
+	switch {
+	case f.IgnoreDelete && file.IsDeleted():
+		return pullStepNone, protocol.FileInfo{}, false
+
+	case f.ignores.ShouldIgnore(file.Name):
+		return pullStepIgnored, protocol.FileInfo{}, false
+
+	case rejectedByPolicy(f.FolderConfiguration, file):
+		return pullStepRejected, protocol.FileInfo{}, false
+
+	case runtime.GOOS == "windows" && fs.WindowsInvalidFilename(file.Name):
+		return pullStepInvalidName, protocol.FileInfo{}, false
+
+	case file.IsDeleted():
+		cur, hasCur := f.fset.Get(protocol.LocalDeviceID, file.Name)
+		if file.IsDirectory() {
+			return pullStepDeleteDir, cur, hasCur
+		}
+		// Local file can be already deleted, but with a lower version
+		// number, hence the deletion coming in again as part of
+		// WithNeed, furthermore, the file can simply be of the wrong
+		// type if we haven't yet managed to pull it.
+		if !file.IsSymlink() && hasCur && !cur.IsDeleted() && !cur.IsSymlink() && !cur.IsDirectory() && !cur.IsInvalid() {
+			return pullStepDeleteFileLater, cur, hasCur
+		}
+		return pullStepDeleteFile, cur, hasCur
+
+	case file.Type == protocol.FileInfoTypeFile:
+		cur, hasCur := f.fset.Get(protocol.LocalDeviceID, file.Name)
+		if _, need := blockDiff(cur.Blocks, file.Blocks); hasCur && len(need) == 0 {
+			return pullStepShortcut, cur, hasCur
+		}
+		return pullStepFile, cur, hasCur
+
+	case runtime.GOOS == "windows" && file.IsSymlink():
+		return pullStepUnsupported, protocol.FileInfo{}, false
+
+	case file.IsDirectory() && !file.IsSymlink():
+		return pullStepDir, protocol.FileInfo{}, false
+
+	case file.IsSymlink():
+		return pullStepSymlink, protocol.FileInfo{}, false
+	}
+
+	l.Warnln(file)
+	panic("unhandleable item type, can't happen")
+}
+
+// availableFromConnected returns true if a device we are connected to has
+// the given file.
+func (f *sendReceiveFolder) availableFromConnected(file string) bool {
+	for _, dev := range f.fset.Availability(file) {
+		if _, ok := f.model.Connection(dev); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dryRunPull returns the changes a pull would make to the items in the
+// folder, as far as the database knows, without making them. Files that no
+// connected device can provide are left out, as they would fail to be
+// pulled.
+func (f *sendReceiveFolder) dryRunPull() []PullAction {
+	var actions []PullAction
+	f.fset.WithNeed(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+		file := intf.(protocol.FileInfo)
+		step, _, _ := f.planPullStep(file)
+		cur, hasCur := f.fset.Get(protocol.LocalDeviceID, file.Name)
+		exists := hasCur && !cur.IsDeleted() && !cur.IsInvalid()
+
+		var action PullActionType
+		switch step {
+		case pullStepDeleteDir, pullStepDeleteFile, pullStepDeleteFileLater:
+			switch {
+			case !exists:
+				return true
+			case step != pullStepDeleteDir && !cur.IsDirectory() && f.inConflict(cur.Version, file.Version):
+				// Deletions always lose conflicts, see deleteFileWithCurrent.
+				action = PullActionConflict
+			default:
+				action = PullActionDelete
+			}
+
+		case pullStepShortcut:
+			action = PullActionUpdate
+
+		case pullStepFile, pullStepDir, pullStepSymlink:
+			if step == pullStepFile && !f.availableFromConnected(file.Name) {
+				return true
+			}
+			switch {
+			case !exists:
+				action = PullActionCreate
+			case step == pullStepDir && cur.IsDirectory():
+				action = PullActionUpdate
+			case f.replaceInConflict(cur, file):
+				action = PullActionConflict
+			default:
+				action = PullActionUpdate
+			}
+
+		default:
+			return true
+		}
+
+		actions = append(actions, PullAction{
+			Name:   file.Name,
+			Type:   pullItemType(file),
+			Action: action,
+		})
+		return true
+	})
+	return actions
+}
+
+// replaceInConflict returns true if replacing the current item by the given
+// one needs conflict handling. Directories and symlinks aren't checked for
+// conflicts.
+func (f *sendReceiveFolder) replaceInConflict(cur, file protocol.FileInfo) bool {
+	return !cur.IsDirectory() && !cur.IsSymlink() && f.inConflict(cur.Version, file.Version)
+}
+
+// revertToGlobal throws away the local version of the given item, so that
+// the global version from the other devices is pulled in its place, which
+// is a deletion if they have deleted it. Nothing on disk is touched until
+// then, and no conflict copy is created.
+func (f *sendReceiveFolder) revertToGlobal(name string) error {
+	remote := false
+	for _, dev := range f.fset.ListDevices() {
+		if fi, ok := f.fset.Get(dev, name); ok && !fi.IsInvalid() {
+			remote = true
+			break
+		}
+	}
+	if !remote {
+		return errNotGlobal
 	}
 
-	return changed, fileDeletions, dirDeletions, nil
+	if cur, ok := f.fset.Get(protocol.LocalDeviceID, name); ok {
+		// As in a receive only revert, the empty version is strictly older
+		// than any other existing version and not in conflict with
+		// anything.
+		cur.Version = protocol.Vector{}
+		cur.LocalFlags &^= protocol.FlagLocalReceiveOnly
+		f.updateLocals([]protocol.FileInfo{cur})
+	}
+
+	f.SchedulePull()
+	return nil
+}
+
+func pullItemType(file protocol.FileInfo) string {
+	switch {
+	case file.IsSymlink():
+		return "symlink"
+	case file.IsDirectory():
+		return "dir"
+	default:
+		return "file"
+	}
 }
 
 func (f *sendReceiveFolder) processDeletions(fileDeletions map[string]protocol.FileInfo, dirDeletions []protocol.FileInfo, dbUpdateChan chan<- dbUpdateJob, scanChan chan<- string) {
@@ -586,17 +944,19 @@ func (f *sendReceiveFolder) handleDir(file protocol.FileInfo, dbUpdateChan chan<
 		}
 
 		// Remove it to replace with the dir.
-		if !curFile.IsSymlink() && f.inConflict(curFile.Version, file.Version) {
+		if f.replaceInConflict(curFile, file) {
 			// The new file has been changed in conflict with the existing one. We
 			// should file it away as a conflict instead of just removing or
-			// archiving. Also merge with the version vector we had, to indicate
-			// we have resolved the conflict.
+			// archiving, unless the folder's conflict resolution policy
+			// picks a winner. Also merge with the version vector we had, to
+			// indicate we have resolved the conflict.
 			// Symlinks aren't checked for conflicts.
 
-			file.Version = file.Version.Merge(curFile.Version)
-			err = f.inWritableDir(func(name string) error {
-				return f.moveForConflict(name, file.ModifiedBy.String(), scanChan)
-			}, curFile.Name)
+			var keepLocal bool
+			if keepLocal, err = f.handleConflict(curFile, &file, scanChan); keepLocal {
+				f.keepLocalVersion(curFile, file, dbUpdateChan)
+				return
+			}
 		} else {
 			err = f.deleteItemOnDisk(curFile, scanChan)
 		}
@@ -738,17 +1098,19 @@ func (f *sendReceiveFolder) handleSymlink(file protocol.FileInfo, dbUpdateChan c
 		}
 		// Remove it to replace with the symlink. This also handles the
 		// "change symlink type" path.
-		if !curFile.IsDirectory() && !curFile.IsSymlink() && f.inConflict(curFile.Version, file.Version) {
+		if f.replaceInConflict(curFile, file) {
 			// The new file has been changed in conflict with the existing one. We
 			// should file it away as a conflict instead of just removing or
-			// archiving. Also merge with the version vector we had, to indicate
-			// we have resolved the conflict.
+			// archiving, unless the folder's conflict resolution policy
+			// picks a winner. Also merge with the version vector we had, to
+			// indicate we have resolved the conflict.
 			// Directories and symlinks aren't checked for conflicts.
 
-			file.Version = file.Version.Merge(curFile.Version)
-			err = f.inWritableDir(func(name string) error {
-				return f.moveForConflict(name, file.ModifiedBy.String(), scanChan)
-			}, curFile.Name)
+			var keepLocal bool
+			if keepLocal, err = f.handleConflict(curFile, &file, scanChan); keepLocal {
+				f.keepLocalVersion(curFile, file, dbUpdateChan)
+				return
+			}
 		} else {
 			err = f.deleteItemOnDisk(curFile, scanChan)
 		}
@@ -1003,6 +1365,64 @@ func (f *sendReceiveFolder) renameFile(cur, source, target protocol.FileInfo, db
 	return nil
 }
 
+// linkFile puts the file in place as a hardlink to its hardlink target,
+// which must be up to date, or just pulled, and unchanged on disk. It
+// returns false, having done nothing, if the file should be pulled instead.
+func (f *sendReceiveFolder) linkFile(file protocol.FileInfo, targetPulled bool, dbUpdateChan chan<- dbUpdateJob, scanChan chan<- string) bool {
+	target, ok := f.fset.GetGlobal(file.HardlinkTarget)
+	if !ok || target.IsDeleted() || target.IsInvalid() || target.Type != protocol.FileInfoTypeFile || !protocol.BlocksEqual(target.Blocks, file.Blocks) {
+		return false
+	}
+	if !targetPulled {
+		if cur, ok := f.fset.Get(protocol.LocalDeviceID, target.Name); !ok || !cur.Version.Equal(target.Version) {
+			return false
+		}
+	}
+	// As the contents are shared, the target must not have changed since.
+	stat, err := f.fs.Lstat(target.Name)
+	if err != nil || !stat.IsRegular() {
+		return false
+	}
+	if cur, err := scanner.CreateFileInfo(stat, target.Name, f.fs); err != nil || !cur.IsEquivalentOptional(target, f.ModTimeWindow(), f.IgnorePerms, true, protocol.LocalAllFlags) {
+		return false
+	}
+
+	tempName := fs.TempName(file.Name)
+	if err := f.inWritableDir(f.fs.Remove, tempName); err != nil && !fs.IsNotExist(err) {
+		return false
+	}
+	if err := f.inWritableDir(func(name string) error { return f.fs.Hardlink(target.Name, name) }, tempName); err != nil {
+		l.Warnf("Failed to hardlink %q to %q in folder %s, copying instead: %v", file.Name, target.Name, f.Description(), err)
+		return false
+	}
+
+	l.Debugln(f, "hardlinking", file.Name, "to", target.Name)
+
+	f.evLogger.Log(events.ItemStarted, map[string]string{
+		"folder": f.folderID,
+		"item":   file.Name,
+		"type":   "file",
+		"action": "update",
+	})
+
+	curFile, hasCurFile := f.fset.Get(protocol.LocalDeviceID, file.Name)
+	err = f.performFinish(file, curFile, hasCurFile, tempName, dbUpdateChan, scanChan)
+	if err != nil {
+		// Writing to the temp file when reusing it would change the target.
+		f.fs.Remove(tempName)
+		f.newPullError(file.Name, err)
+	}
+
+	f.evLogger.Log(events.ItemFinished, map[string]interface{}{
+		"folder": f.folderID,
+		"item":   file.Name,
+		"error":  events.Error(err),
+		"type":   "file",
+		"action": "update",
+	})
+	return true
+}
+
 // This is the flow of data and events here, I think...
 //
 // +-----------------------+
@@ -1297,10 +1717,13 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 					return true
 				}
 
-				_, err = dstFd.WriteAt(buf, block.Offset)
-				if err != nil {
-					state.fail(errors.Wrap(err, "dst write"))
-
+				if err := copyBlockRange(dstFd, file, offset, block, buf); err != nil {
+					if !isVerifyError(err) {
+						state.fail(err)
+						return false
+					}
+					l.Debugln("Failed to verify copied block", err)
+					return true
 				}
 				if offset == block.Offset {
 					state.copiedFromOrigin()
@@ -1316,14 +1739,15 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 
 			if !found {
 				found = f.model.finder.Iterate(folders, block.Hash, func(folder, path string, index int32) bool {
-					fs := folderFilesystems[folder]
-					fd, err := fs.Open(path)
+					ffs := folderFilesystems[folder]
+					fd, err := ffs.Open(path)
 					if err != nil {
 						return false
 					}
+					defer fd.Close()
 
-					_, err = fd.ReadAt(buf, int64(state.file.BlockSize())*int64(index))
-					fd.Close()
+					srcOffset := int64(state.file.BlockSize()) * int64(index)
+					_, err = fd.ReadAt(buf, srcOffset)
 					if err != nil {
 						return false
 					}
@@ -1333,9 +1757,13 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 						return false
 					}
 
-					_, err = dstFd.WriteAt(buf, block.Offset)
-					if err != nil {
-						state.fail(errors.Wrap(err, "dst write"))
+					if err := copyBlockRange(dstFd, fd, srcOffset, block, buf); err != nil {
+						if !isVerifyError(err) {
+							state.fail(err)
+							return true
+						}
+						l.Debugln("Finder failed to verify copied block", err)
+						return false
 					}
 					if path == state.file.Name {
 						state.copiedFromOrigin()
@@ -1369,10 +1797,53 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 	}
 }
 
-func verifyBuffer(buf []byte, block protocol.BlockInfo) error {
+func verifyLength(buf []byte, block protocol.BlockInfo) error {
 	if len(buf) != int(block.Size) {
 		return fmt.Errorf("length mismatch %d != %d", len(buf), block.Size)
 	}
+	return nil
+}
+
+// copyBlockRange lets the filesystem share or copy the block in place where
+// it can, instead of writing the buffer. The source may have changed since
+// it was read into the buffer and verified, so the copy is read back into
+// buf and verified in turn, returning a verifyError if it doesn't match.
+func copyBlockRange(dst *lockedWriterAt, src fs.File, srcOffset int64, block protocol.BlockInfo, buf []byte) error {
+	if err := dst.CopyRange(src, srcOffset, block.Offset, int64(block.Size)); err != nil {
+		return errors.Wrap(err, "dst write")
+	}
+	if _, err := dst.ReadAt(buf, block.Offset); err != nil {
+		return errors.Wrap(err, "dst read")
+	}
+	if err := verifyBuffer(buf, block); err != nil {
+		return verifyError{err}
+	}
+	return nil
+}
+
+type verifyError struct {
+	error
+}
+
+func isVerifyError(err error) bool {
+	_, ok := err.(verifyError)
+	return ok
+}
+
+// verifyEncryptedBuffer checks that the block of a receive encrypted folder
+// is the one announced by its encrypted hash, as the hash of the plaintext
+// isn't known.
+func verifyEncryptedBuffer(buf []byte, block protocol.BlockInfo) error {
+	if err := verifyLength(buf, block); err != nil {
+		return err
+	}
+	return protocol.VerifyEncryptedBlock(buf, block.Hash)
+}
+
+func verifyBuffer(buf []byte, block protocol.BlockInfo) error {
+	if err := verifyLength(buf, block); err != nil {
+		return err
+	}
 	hf := sha256.New()
 	_, err := hf.Write(buf)
 	if err != nil {
@@ -1387,8 +1858,7 @@ func verifyBuffer(buf []byte, block protocol.BlockInfo) error {
 	return nil
 }
 
-func (f *sendReceiveFolder) pullerRoutine(in <-chan pullBlockState, out chan<- *sharedPullerState) {
-	requestLimiter := newByteSemaphore(f.PullerMaxPendingKiB * 1024)
+func (f *sendReceiveFolder) pullerRoutine(in <-chan pullBlockState, out chan<- *sharedPullerState, requestLimiter *byteSemaphore) {
 	wg := sync.NewWaitGroup()
 
 	for state := range in {
@@ -1475,7 +1945,11 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 
 		// Verify that the received block matches the desired hash, if not
 		// try pulling it from another device.
-		lastError = verifyBuffer(buf, state.block)
+		if f.Type == config.FolderTypeReceiveEncrypted {
+			lastError = verifyEncryptedBuffer(buf, state.block)
+		} else {
+			lastError = verifyBuffer(buf, state.block)
+		}
 		if lastError != nil {
 			l.Debugln("request:", f.folderID, state.file.Name, state.block.Offset, state.block.Size, "hash mismatch")
 			continue
@@ -1516,17 +1990,23 @@ func (f *sendReceiveFolder) performFinish(file, curFile protocol.FileInfo, hasCu
 			return err
 		}
 
-		if !curFile.IsDirectory() && !curFile.IsSymlink() && f.inConflict(curFile.Version, file.Version) {
+		if f.replaceInConflict(curFile, file) {
 			// The new file has been changed in conflict with the existing one. We
 			// should file it away as a conflict instead of just removing or
-			// archiving. Also merge with the version vector we had, to indicate
-			// we have resolved the conflict.
+			// archiving, unless the folder's conflict resolution policy
+			// picks a winner. Also merge with the version vector we had, to
+			// indicate we have resolved the conflict.
 			// Directories and symlinks aren't checked for conflicts.
 
-			file.Version = file.Version.Merge(curFile.Version)
-			err = f.inWritableDir(func(name string) error {
-				return f.moveForConflict(name, file.ModifiedBy.String(), scanChan)
-			}, curFile.Name)
+			var keepLocal bool
+			if keepLocal, err = f.handleConflict(curFile, &file, scanChan); keepLocal {
+				// The new file lost; throw away what we downloaded.
+				if err := f.fs.Remove(tempName); err != nil && !fs.IsNotExist(err) {
+					l.Infof("Conflict for %q in folder %s: failed to remove temporary file of the losing version: %v", file.Name, f.Description(), err)
+				}
+				f.keepLocalVersion(curFile, file, dbUpdateChan)
+				return nil
+			}
 		} else {
 			err = f.deleteItemOnDisk(curFile, scanChan)
 		}
@@ -1549,6 +2029,97 @@ func (f *sendReceiveFolder) performFinish(file, curFile protocol.FileInfo, hasCu
 	return nil
 }
 
+// verifyReassembled hashes the completed temp file to check that it has the
+// expected contents. If it doesn't, the temp file is quarantined, so that
+// the file is pulled again from scratch instead of being put in place.
+func (f *sendReceiveFolder) verifyReassembled(file protocol.FileInfo, tempName string) error {
+	if f.Type == config.FolderTypeReceiveEncrypted {
+		ok, err := f.verifyEncryptedBlocks(file, tempName)
+		if err != nil {
+			return errors.Wrap(err, "verifying reassembled file")
+		}
+		if ok {
+			return nil
+		}
+	} else {
+		blocks, err := scanner.HashFileParallel(f.ctx, f.fs, tempName, file.BlockSize(), f.model.numHashers(f.folderID), nil, false)
+		if err != nil {
+			return errors.Wrap(err, "verifying reassembled file")
+		}
+		if protocol.BlocksEqual(blocks, file.Blocks) {
+			return nil
+		}
+	}
+
+	f.quarantine(file, tempName)
+	return errReassembledCorrupt
+}
+
+// verifyEncryptedBlocks returns whether each block in the temp file of a
+// receive encrypted folder is the one announced by its encrypted hash.
+func (f *sendReceiveFolder) verifyEncryptedBlocks(file protocol.FileInfo, tempName string) (bool, error) {
+	fd, err := f.fs.Open(tempName)
+	if err != nil {
+		return false, err
+	}
+	defer fd.Close()
+
+	buf := protocol.BufferPool.Get(file.BlockSize())
+	defer func() {
+		protocol.BufferPool.Put(buf)
+	}()
+	for _, block := range file.Blocks {
+		buf = protocol.BufferPool.Upgrade(buf, int(block.Size))
+		if _, err := fd.ReadAt(buf, block.Offset); err != nil {
+			return false, err
+		}
+		if verifyEncryptedBuffer(buf, block) != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// quarantine moves the corrupt temp file for the given file out of the way,
+// into the quarantine directory where it's kept for inspection until the
+// file is pulled successfully. If that fails it's removed instead.
+func (f *sendReceiveFolder) quarantine(file protocol.FileInfo, tempName string) {
+	name := filepath.Join(quarantineDir, versioner.TagFilename(file.Name, time.Now().Format(versioner.TimeFormat)))
+	err := f.fs.MkdirAll(filepath.Dir(name), 0700)
+	if err == nil {
+		err = f.fs.Rename(tempName, name)
+	}
+	if err == nil {
+		l.Warnf("Reassembled file %q in folder %s is corrupt, pulling it again; moved the corrupt copy to %s", file.Name, f.Description(), name)
+		return
+	}
+
+	l.Warnf("Reassembled file %q in folder %s is corrupt, pulling it again; failed to quarantine the corrupt copy: %v", file.Name, f.Description(), err)
+	if err := f.fs.Remove(tempName); err != nil && !fs.IsNotExist(err) {
+		l.Debugln(f, "removing corrupt temp file:", err)
+	}
+}
+
+// removeQuarantined removes the quarantined corrupt copies of the given
+// file, if any.
+func (f *sendReceiveFolder) removeQuarantined(name string) {
+	dir := filepath.Join(quarantineDir, filepath.Dir(name))
+	names, err := f.fs.DirNames(dir)
+	if err != nil {
+		// Usually there is no quarantine at all
+		return
+	}
+	base := filepath.Base(name)
+	for _, qname := range names {
+		if untagged, tag := versioner.UntagFilename(qname); tag == "" || untagged != base {
+			continue
+		}
+		if err := f.fs.Remove(filepath.Join(dir, qname)); err != nil && !fs.IsNotExist(err) {
+			l.Debugln(f, "removing quarantined file:", err)
+		}
+	}
+}
+
 func (f *sendReceiveFolder) finisherRoutine(in <-chan *sharedPullerState, dbUpdateChan chan<- dbUpdateJob, scanChan chan<- string) {
 	for state := range in {
 		if closed, err := state.finalClose(); closed {
@@ -1556,10 +2127,20 @@ func (f *sendReceiveFolder) finisherRoutine(in <-chan *sharedPullerState, dbUpda
 
 			f.queue.Done(state.file.Name)
 
+			if err == nil && f.VerifyReassembled {
+				err = f.verifyReassembled(state.file, state.tempName)
+			}
+
 			if err == nil {
 				err = f.performFinish(state.file, state.curFile, state.hasCurFile, state.tempName, dbUpdateChan, scanChan)
 			}
 
+			if err == nil {
+				// Corrupt copies from earlier attempts have served their
+				// purpose now that the file is in place.
+				f.removeQuarantined(state.file.Name)
+			}
+
 			if err != nil {
 				f.newPullError(state.file.Name, err)
 			} else {
@@ -1589,11 +2170,59 @@ func (f *sendReceiveFolder) finisherRoutine(in <-chan *sharedPullerState, dbUpda
 	}
 }
 
+// applyConfig takes the number of pulling routines from the new config,
+// to be used from the next pull on.
+func (f *sendReceiveFolder) applyConfig(cfg config.FolderConfiguration) {
+	f.workersMut.Lock()
+	f.workers = pullerWorkersFor(cfg)
+	f.workersMut.Unlock()
+}
+
+func (f *sendReceiveFolder) startedWorker(stage string) {
+	if f.workerStarted != nil {
+		f.workerStarted(stage)
+	}
+}
+
 // Moves the given filename to the front of the job queue
 func (f *sendReceiveFolder) BringToFront(filename string) {
 	f.queue.BringToFront(filename)
 }
 
+// Prioritize makes the given file be pulled before anything else, in the
+// current pull if it's in progress and in the following ones until the
+// file is done.
+func (f *sendReceiveFolder) Prioritize(filename string) error {
+	gf, ok := f.fset.GetGlobal(filename)
+	if !ok || gf.IsDeleted() || gf.IsInvalid() || gf.Type != protocol.FileInfoTypeFile {
+		return errNotPrioritizable
+	}
+	if lf, ok := f.fset.Get(protocol.LocalDeviceID, filename); ok && lf.Version.GreaterEqual(gf.Version) {
+		return errNotPrioritizable
+	}
+
+	f.prioMut.Lock()
+	f.prioritized[filename] = struct{}{}
+	f.queue.BringToFront(filename)
+	f.prioMut.Unlock()
+
+	f.SchedulePull()
+	return nil
+}
+
+// prioritizedDone forgets the priority of the given files, now that they
+// are done.
+func (f *sendReceiveFolder) prioritizedDone(files []protocol.FileInfo) {
+	f.prioMut.Lock()
+	defer f.prioMut.Unlock()
+	if len(f.prioritized) == 0 {
+		return
+	}
+	for _, file := range files {
+		delete(f.prioritized, file.Name)
+	}
+}
+
 func (f *sendReceiveFolder) Jobs(page, perpage int) ([]string, []string, int) {
 	return f.queue.Jobs(page, perpage)
 }
@@ -1629,6 +2258,7 @@ func (f *sendReceiveFolder) dbUpdaterRoutine(dbUpdateChan <-chan dbUpdateJob) {
 		// All updates to file/folder objects that originated remotely
 		// (across the network) use this call to updateLocals
 		f.updateLocalsFromPulling(files)
+		f.prioritizedDone(files)
 
 		if found {
 			f.ReceivedFile(lastFile.Name, lastFile.IsDeleted())
@@ -1712,6 +2342,52 @@ func (f *sendReceiveFolder) inConflict(current, replacement protocol.Vector) boo
 	return false
 }
 
+// handleConflict takes care of the current item, which is in conflict with
+// the file about to replace it, according to the folder's conflict
+// resolution policy. The version of the new file is updated to resolve the
+// conflict. It returns true if the current item is to be kept instead, in
+// which case nothing has been changed on disk.
+func (f *sendReceiveFolder) handleConflict(curFile protocol.FileInfo, file *protocol.FileInfo, scanChan chan<- string) (bool, error) {
+	file.Version = file.Version.Merge(curFile.Version)
+
+	if f.ConflictResolution == config.ConflictResolutionManual {
+		return false, f.inWritableDir(func(name string) error {
+			return f.moveForConflict(name, file.ModifiedBy.String(), scanChan)
+		}, curFile.Name)
+	}
+
+	if conflictLocalWins(f.ConflictResolution, curFile, *file) {
+		l.Infof("Conflict for %q in folder %s resolved (%v): keeping local version", curFile.Name, f.Description(), f.ConflictResolution)
+		return true, nil
+	}
+
+	l.Infof("Conflict for %q in folder %s resolved (%v): accepting version from %v", curFile.Name, f.Description(), f.ConflictResolution, file.ModifiedBy)
+	return false, f.deleteItemOnDisk(curFile, scanChan)
+}
+
+// conflictLocalWins returns true if the local version of a file should be
+// kept over the conflicting remote one under the given policy. Both sides
+// come to the same conclusion, as ties are broken by the version vector.
+func conflictLocalWins(policy config.ConflictResolution, local, remote protocol.FileInfo) bool {
+	switch policy {
+	case config.ConflictResolutionLocalWins:
+		return true
+	case config.ConflictResolutionLargestWins:
+		if local.FileSize() != remote.FileSize() {
+			return local.FileSize() > remote.FileSize()
+		}
+	}
+	return local.WinsConflict(remote)
+}
+
+// keepLocalVersion records the current item with a version superseding the
+// one it was in conflict with, making it the one other devices will sync.
+func (f *sendReceiveFolder) keepLocalVersion(curFile, file protocol.FileInfo, dbUpdateChan chan<- dbUpdateJob) {
+	curFile.Version = curFile.Version.Merge(file.Version).Update(f.shortID)
+	curFile.ModifiedBy = f.shortID
+	dbUpdateChan <- dbUpdateJob{curFile, dbUpdateHandleFile}
+}
+
 func removeAvailability(availabilities []Availability, availability Availability) []Availability {
 	for i := range availabilities {
 		if availabilities[i] == availability {
@@ -1808,6 +2484,21 @@ func (f *sendReceiveFolder) Errors() []FileError {
 	return errors
 }
 
+// ClearError drops the pull or scan error for the given item and retries
+// it.
+func (f *sendReceiveFolder) ClearError(path string) error {
+	f.pullErrorsMut.Lock()
+	_, ok := f.pullErrors[path]
+	delete(f.pullErrors, path)
+	f.pullErrorsMut.Unlock()
+
+	if !ok {
+		return f.folder.ClearError(path)
+	}
+	f.SchedulePull()
+	return nil
+}
+
 // deleteItemOnDisk deletes the file represented by old that is about to be replaced by new.
 func (f *sendReceiveFolder) deleteItemOnDisk(item protocol.FileInfo, scanChan chan<- string) (err error) {
 	defer func() {
@@ -2001,6 +2692,22 @@ func isConflict(name string) bool {
 	return strings.Contains(filepath.Base(name), ".sync-conflict-")
 }
 
+// conflictOriginal returns the name of the file the given conflict copy was
+// made of, i.e. the inverse of conflictName.
+func conflictOriginal(name string) string {
+	idx := strings.LastIndex(name, ".sync-conflict-")
+	if idx < 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) >= len(name)-idx {
+		// The extension dot is part of the conflict marker, the original
+		// had no extension.
+		ext = ""
+	}
+	return name[:idx] + ext
+}
+
 func existingConflicts(name string, fs fs.Filesystem) []string {
 	ext := filepath.Ext(name)
 	matches, err := fs.Glob(name[:len(name)-len(ext)] + ".sync-conflict-????????-??????*" + ext)
@@ -10,11 +10,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,6 +32,7 @@ import (
 	"github.com/syncthing/syncthing/lib/osutil"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/scanner"
+	"github.com/syncthing/syncthing/lib/stats"
 	"github.com/syncthing/syncthing/lib/sync"
 )
 
@@ -102,13 +108,20 @@ func setupSendReceiveFolder(files ...protocol.FileInfo) (*model, *sendReceiveFol
 			model:               model,
 			fset:                model.folderFiles[fcfg.ID],
 			initialScanFinished: make(chan struct{}),
+			scanErrorsMut:       sync.NewMutex(),
 			ctx:                 context.TODO(),
 			FolderConfiguration: fcfg,
+
+			FolderStatisticsReference: stats.NewFolderStatisticsReference(model.db, fcfg.ID),
 		},
 
 		queue:         newJobQueue(),
 		pullErrors:    make(map[string]string),
 		pullErrorsMut: sync.NewMutex(),
+		prioritized:   make(map[string]struct{}),
+		prioMut:       sync.NewMutex(),
+		workers:       pullerWorkersFor(fcfg),
+		workersMut:    sync.NewMutex(),
 	}
 	f.fs = fs.NewMtimeFS(f.Filesystem(), db.NewNamespacedKV(model.db, "mtime"))
 
@@ -594,7 +607,7 @@ func TestDeregisterOnFailInPull(t *testing.T) {
 	pullWg := sync.NewWaitGroup()
 	pullWg.Add(1)
 	go func() {
-		f.pullerRoutine(pullChan, finisherBufferChan)
+		f.pullerRoutine(pullChan, finisherBufferChan, newByteSemaphore(f.PullerMaxPendingKiB*1024))
 		pullWg.Done()
 	}()
 	go f.finisherRoutine(finisherChan, dbUpdateChan, make(chan string))
@@ -963,6 +976,121 @@ func TestSRConflictReplaceFileByLink(t *testing.T) {
 	}
 }
 
+// TestSRConflictResolution checks that no conflict copy is created when
+// the folder has a conflict resolution policy, and that the winning side is
+// kept.
+func TestSRConflictResolution(t *testing.T) {
+	cases := []struct {
+		policy    config.ConflictResolution
+		localWins bool
+	}{
+		{config.ConflictResolutionNewestWins, false},
+		{config.ConflictResolutionLargestWins, false}, // both empty, so newest wins
+		{config.ConflictResolutionLocalWins, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			m, f := setupSendReceiveFolder()
+			defer cleanupSRFolder(f, m)
+			ffs := f.Filesystem()
+			f.ConflictResolution = tc.policy
+
+			name := "foo"
+
+			// create local file, older than the remote change
+			file := createFile(t, name, ffs)
+			file.Version = protocol.Vector{}.Update(myID.Short())
+			f.updateLocalsFromScanning([]protocol.FileInfo{file})
+
+			// Simulate remote creating a dir with the same name
+			rem := file
+			rem.Type = protocol.FileInfoTypeDirectory
+			rem.Size = 0
+			rem.ModifiedS = file.ModifiedS + 10
+			rem.Version = protocol.Vector{}.Update(device1.Short())
+			rem.ModifiedBy = device1.Short()
+
+			dbUpdateChan := make(chan dbUpdateJob, 1)
+			scanChan := make(chan string, 1)
+
+			f.handleDir(rem, dbUpdateChan, scanChan)
+
+			if confls := existingConflicts(name, ffs); len(confls) != 0 {
+				t.Fatal("Expected no conflicts, got", confls)
+			}
+
+			info, err := ffs.Lstat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := <-dbUpdateChan
+			if tc.localWins {
+				if info.IsDir() {
+					t.Error("Expected local file to be kept")
+				}
+				if job.file.IsDirectory() || job.file.Version.Compare(rem.Version) != protocol.Greater {
+					t.Errorf("Expected local file with superseding version in db, got %v", job.file)
+				}
+			} else {
+				if !info.IsDir() {
+					t.Error("Expected local file to be replaced by dir")
+				}
+				if !job.file.IsDirectory() {
+					t.Errorf("Expected dir in db, got %v", job.file)
+				}
+			}
+		})
+	}
+}
+
+func TestConflictLocalWins(t *testing.T) {
+	local := protocol.FileInfo{
+		Name:       "foo",
+		Size:       100,
+		ModifiedS:  10,
+		ModifiedBy: myID.Short(),
+		Version:    protocol.Vector{}.Update(myID.Short()),
+	}
+	newerRemote := protocol.FileInfo{
+		Name:       "foo",
+		Size:       50,
+		ModifiedS:  20,
+		ModifiedBy: device1.Short(),
+		Version:    protocol.Vector{}.Update(device1.Short()),
+	}
+	// Same modification time and size, only the version vector differs.
+	tiedRemote := newerRemote
+	tiedRemote.Size = local.Size
+	tiedRemote.ModifiedS = local.ModifiedS
+
+	cases := []struct {
+		policy    config.ConflictResolution
+		remote    protocol.FileInfo
+		localWins bool
+	}{
+		{config.ConflictResolutionNewestWins, newerRemote, false},
+		{config.ConflictResolutionLargestWins, newerRemote, true},
+		{config.ConflictResolutionLocalWins, newerRemote, true},
+		// Ties are broken the same way by both sides
+		{config.ConflictResolutionNewestWins, tiedRemote, local.WinsConflict(tiedRemote)},
+		{config.ConflictResolutionLargestWins, tiedRemote, local.WinsConflict(tiedRemote)},
+		{config.ConflictResolutionLocalWins, tiedRemote, true},
+	}
+
+	for i, tc := range cases {
+		if res := conflictLocalWins(tc.policy, local, tc.remote); res != tc.localWins {
+			t.Errorf("%d: %v: expected local wins to be %v, got %v", i, tc.policy, tc.localWins, res)
+		}
+		if tc.policy == config.ConflictResolutionLocalWins {
+			continue
+		}
+		if conflictLocalWins(tc.policy, local, tc.remote) == conflictLocalWins(tc.policy, tc.remote, local) {
+			t.Errorf("%d: %v: both sides came to the same conclusion", i, tc.policy)
+		}
+	}
+}
+
 // TestDeleteBehindSymlink checks that we don't delete or schedule a scan
 // when trying to delete a file behind a symlink.
 func TestDeleteBehindSymlink(t *testing.T) {
@@ -1036,3 +1164,754 @@ func startCopier(f *sendReceiveFolder, pullChan chan<- pullBlockState, finisherC
 	}()
 	return copyChan, wg
 }
+
+type fixedUsageFilesystem struct {
+	fs.Filesystem
+	usage fs.Usage
+}
+
+func (f *fixedUsageFilesystem) Usage(string) (fs.Usage, error) {
+	return f.usage, nil
+}
+
+func TestLowDiskSpaceEvents(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+
+	f.MinDiskFree = config.Size{Value: 100, Unit: "kB"}
+	ffs := &fixedUsageFilesystem{Filesystem: f.fs, usage: fs.Usage{Free: 1e6, Total: 1e9}}
+
+	sub := m.evLogger.Subscribe(events.FolderLowDiskSpace | events.FolderSufficientDiskSpace)
+	defer sub.Unsubscribe()
+
+	expect := func(typ events.EventType, free int64) {
+		t.Helper()
+		ev, err := sub.Poll(time.Second)
+		if err != nil {
+			t.Fatalf("Expected %v event: %v", typ, err)
+		}
+		if ev.Type != typ {
+			t.Fatalf("Expected %v event, got %v", typ, ev.Type)
+		}
+		data := ev.Data.(map[string]interface{})
+		if data["folder"] != f.ID || data["required"] != int64(100e3) || data["free"] != free {
+			t.Errorf("Unexpected event data %v", data)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		if ev, err := sub.Poll(100 * time.Millisecond); err != events.ErrTimeout {
+			t.Fatalf("Expected no event, got %v", ev)
+		}
+	}
+
+	// Plenty of space, no event
+	f.checkDiskSpace(ffs)
+	expectNone()
+
+	ffs.usage.Free = 50e3
+	f.checkDiskSpace(ffs)
+	expect(events.FolderLowDiskSpace, 50e3)
+
+	// Still low, no repeated event
+	ffs.usage.Free = 40e3
+	f.checkDiskSpace(ffs)
+	expectNone()
+
+	ffs.usage.Free = 200e3
+	f.checkDiskSpace(ffs)
+	expect(events.FolderSufficientDiskSpace, 200e3)
+
+	f.checkDiskSpace(ffs)
+	expectNone()
+}
+
+// TestDryRunPull checks that the dry run predicts the changes a subsequent
+// pull makes.
+func TestDryRunPull(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+	ffs := f.Filesystem()
+	f.ignores = ignore.New(ffs)
+
+	// Local files, which the remote changes in various ways
+	var locals []protocol.FileInfo
+	for _, name := range []string{"changed", "deleted", "conflicting"} {
+		file := createFile(t, name, ffs)
+		file.Blocks = []protocol.BlockInfo{{Size: 0, Hash: scanner.SHA256OfNothing}}
+		file.Version = protocol.Vector{}.Update(myID.Short())
+		locals = append(locals, file)
+	}
+	f.updateLocalsFromScanning(locals)
+
+	rem := device1.Short()
+	changed := locals[0]
+	changed.Permissions = 0600
+	changed.Version = changed.Version.Update(rem)
+	deleted := locals[1]
+	deleted.Deleted = true
+	deleted.Version = deleted.Version.Update(rem)
+	conflicting := locals[2]
+	conflicting.Type = protocol.FileInfoTypeDirectory
+	conflicting.Version = protocol.Vector{}.Update(rem)
+	conflicting.ModifiedBy = rem
+	newDir := protocol.FileInfo{
+		Name:        "newdir",
+		Type:        protocol.FileInfoTypeDirectory,
+		Permissions: 0755,
+		Version:     protocol.Vector{}.Update(rem),
+		ModifiedBy:  rem,
+	}
+	remotes := []protocol.FileInfo{changed, deleted, conflicting, newDir}
+	expected := map[string]PullActionType{
+		"changed":     PullActionUpdate,
+		"deleted":     PullActionDelete,
+		"conflicting": PullActionConflict,
+		"newdir":      PullActionCreate,
+	}
+	if runtime.GOOS != "windows" {
+		remotes = append(remotes, protocol.FileInfo{
+			Name:          "newlink",
+			Type:          protocol.FileInfoTypeSymlink,
+			SymlinkTarget: "newdir",
+			Version:       protocol.Vector{}.Update(rem),
+			ModifiedBy:    rem,
+		})
+		expected["newlink"] = PullActionCreate
+	}
+	f.fset.Update(device1, remotes)
+
+	actions := f.dryRunPull()
+	if len(actions) != len(expected) {
+		t.Errorf("Expected %d actions, got %v", len(expected), actions)
+	}
+	for _, a := range actions {
+		if exp, ok := expected[a.Name]; !ok || a.Action != exp {
+			t.Errorf("Unexpected action %v, expected %q", a, exp)
+		}
+	}
+
+	// Nothing has changed on disk
+	if _, err := ffs.Lstat("deleted"); err != nil {
+		t.Error("Dry run touched the disk:", err)
+	}
+	if _, err := ffs.Lstat("newdir"); !fs.IsNotExist(err) {
+		t.Error("Dry run touched the disk:", err)
+	}
+
+	// The actual pull handles exactly the same items
+	sub := m.evLogger.Subscribe(events.ItemFinished)
+	defer sub.Unsubscribe()
+
+	f.pullerIteration(make(chan string, len(remotes)))
+
+	pulled := make(map[string]string)
+	for {
+		ev, err := sub.Poll(100 * time.Millisecond)
+		if err != nil {
+			break
+		}
+		data := ev.Data.(map[string]interface{})
+		if err := data["error"].(*string); err != nil {
+			t.Errorf("Error pulling %v: %v", data["item"], *err)
+		}
+		pulled[data["item"].(string)] = data["action"].(string)
+	}
+	if len(pulled) != len(actions) {
+		t.Errorf("Pull handled %v, dry run predicted %v", pulled, actions)
+	}
+	for _, a := range actions {
+		switch act := pulled[a.Name]; {
+		case act == "":
+			t.Errorf("Predicted %v didn't happen", a)
+		case (a.Action == PullActionDelete) != (act == "delete"):
+			t.Errorf("Predicted %v, but pull did %q", a, act)
+		}
+	}
+	if confls := existingConflicts("conflicting", ffs); len(confls) != 1 {
+		t.Error("Expected one conflict, got", confls)
+	}
+}
+
+func TestRevertToGlobal(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+	ffs := f.Filesystem()
+	f.ignores = ignore.New(ffs)
+
+	// Local files, all but one edited locally after receiving them from
+	// the remote, which has since deleted one of them.
+	rem := device1.Short()
+	var locals, remotes []protocol.FileInfo
+	for i, name := range []string{"edited", "deleted", "other", "localonly"} {
+		file := createFile(t, name, ffs)
+		file.Blocks = []protocol.BlockInfo{{Size: 0, Hash: scanner.SHA256OfNothing}}
+		file.Version = protocol.Vector{}.Update(rem)
+		if name != "localonly" {
+			remote := file
+			remote.Permissions = 0600
+			remote.Sequence = int64(i + 1)
+			if name == "deleted" {
+				remote.Deleted = true
+				remote.Blocks = nil
+			}
+			remotes = append(remotes, remote)
+		}
+		file.Version = file.Version.Update(myID.Short())
+		locals = append(locals, file)
+	}
+	f.updateLocalsFromScanning(locals)
+	f.fset.Update(device1, remotes)
+
+	need := func() []string {
+		var names []string
+		f.fset.WithNeed(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+			names = append(names, intf.FileName())
+			return true
+		})
+		sort.Strings(names)
+		return names
+	}
+	if n := need(); len(n) != 0 {
+		t.Fatal("Expected to need nothing, got", n)
+	}
+
+	for _, name := range []string{"edited", "deleted"} {
+		if err := f.revertToGlobal(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"localonly", "nonexistent"} {
+		if err := f.revertToGlobal(name); err != errNotGlobal {
+			t.Errorf("Expected errNotGlobal reverting %v, got %v", name, err)
+		}
+	}
+
+	if n := need(); len(n) != 2 || n[0] != "deleted" || n[1] != "edited" {
+		t.Fatal("Expected to need the reverted files, got", n)
+	}
+
+	f.pullerIteration(make(chan string, 1))
+
+	if n := need(); len(n) != 0 {
+		t.Error("Expected to need nothing after pulling, got", n)
+	}
+	if _, err := ffs.Lstat("deleted"); !fs.IsNotExist(err) {
+		t.Error("Expected reverted file to be deleted, got", err)
+	}
+	for i, name := range []string{"edited", "other"} {
+		expected := remotes[0].Version
+		if i == 1 {
+			expected = locals[2].Version
+		}
+		if fi, ok := f.fset.Get(protocol.LocalDeviceID, name); !ok || !fi.Version.Equal(expected) {
+			t.Errorf("Expected %v at version %v, got %v", name, expected, fi.Version)
+		}
+	}
+	if _, err := ffs.Lstat("localonly"); err != nil {
+		t.Error("Expected local file to be kept, got", err)
+	}
+}
+
+func TestPullPriorityPatterns(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+
+	f.PullPriorityPatterns = []string{"index.html", "*.json", "assets/*.css"}
+
+	now := time.Now()
+	files := []struct {
+		name string
+		size int64
+		age  time.Duration
+	}{
+		{"a.txt", 10, 4 * time.Hour},
+		{"assets/site.css", 50, 3 * time.Hour},
+		{"manifest.json", 30, 2 * time.Hour},
+		{"sub/index.html", 20, 1 * time.Hour},
+		{"sub/style.css", 5, 5 * time.Hour},
+		{"z.bin", 40, 0},
+	}
+
+	cases := []struct {
+		order    config.PullOrder
+		expected []string
+	}{
+		{config.OrderAlphabetic, []string{"assets/site.css", "manifest.json", "sub/index.html", "a.txt", "sub/style.css", "z.bin"}},
+		{config.OrderSmallestFirst, []string{"sub/index.html", "manifest.json", "assets/site.css", "sub/style.css", "a.txt", "z.bin"}},
+		{config.OrderLargestFirst, []string{"assets/site.css", "manifest.json", "sub/index.html", "z.bin", "a.txt", "sub/style.css"}},
+		{config.OrderNewestFirst, []string{"sub/index.html", "manifest.json", "assets/site.css", "z.bin", "a.txt", "sub/style.css"}},
+		{config.OrderOldestFirst, []string{"assets/site.css", "manifest.json", "sub/index.html", "sub/style.css", "a.txt", "z.bin"}},
+	}
+
+	for _, tc := range cases {
+		f.Order = tc.order
+		f.queue.Reset()
+		for _, file := range files {
+			f.queue.Push(filepath.FromSlash(file.name), file.size, now.Add(-file.age))
+		}
+
+		f.orderQueue()
+
+		_, actual, _ := f.queue.Jobs(1, 100)
+		for i := range tc.expected {
+			tc.expected[i] = filepath.FromSlash(tc.expected[i])
+		}
+		if !equalStrings(tc.expected, actual) {
+			t.Errorf("Unexpected order for %v: %v", tc.order, actual)
+		}
+	}
+
+	// Prioritized files come first in any order, even random.
+	f.Order = config.OrderRandom
+	f.queue.Reset()
+	for _, file := range files {
+		f.queue.Push(filepath.FromSlash(file.name), file.size, now.Add(-file.age))
+	}
+	f.orderQueue()
+	_, actual, _ := f.queue.Jobs(1, 100)
+	for i, name := range actual {
+		if prio := matchesPatterns(f.PullPriorityPatterns, name); prio != (i < 3) {
+			t.Errorf("Unexpected position %d for %v in random order: %v", i, name, actual)
+		}
+	}
+}
+
+func TestPrioritizeFile(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+
+	// Patterns are trumped by explicit priorities.
+	f.Order = config.OrderAlphabetic
+	f.PullPriorityPatterns = []string{"*.json"}
+
+	names := []string{"a.txt", "b.txt", "c.json", "d.txt", "e.txt"}
+	var files []protocol.FileInfo
+	for _, name := range names {
+		files = append(files, protocol.FileInfo{
+			Name:    name,
+			Version: protocol.Vector{}.Update(device1.Short()),
+			Size:    10,
+			Blocks:  []protocol.BlockInfo{{Size: 10}},
+		})
+	}
+	f.fset.Update(device1, files)
+
+	// Queues the files like a pull iteration does, returning them in the
+	// order they would be pulled.
+	pullOrder := func() []string {
+		f.queue.Reset()
+		for _, name := range names {
+			f.queue.Push(name, 10, time.Time{})
+		}
+		f.orderQueue()
+		_, queued, _ := f.queue.Jobs(1, 100)
+		return queued
+	}
+
+	if order := pullOrder(); !equalStrings(order, []string{"c.json", "a.txt", "b.txt", "d.txt", "e.txt"}) {
+		t.Fatal("Unexpected initial order:", order)
+	}
+
+	// The current pull iteration picks up the priority right away.
+	must(t, f.Prioritize("d.txt"))
+	if next, _ := f.queue.Pop(); next != "d.txt" {
+		t.Errorf("Pulling %v first, expected d.txt", next)
+	}
+	f.queue.Done("d.txt")
+
+	// As do the following ones, until the file is done.
+	must(t, f.Prioritize("e.txt"))
+	for i := 0; i < 2; i++ {
+		if order := pullOrder(); !equalStrings(order, []string{"d.txt", "e.txt", "c.json", "a.txt", "b.txt"}) {
+			t.Fatalf("Unexpected order in iteration %d: %v", i, order)
+		}
+	}
+
+	f.prioritizedDone(files[3:4])
+	if order := pullOrder(); !equalStrings(order, []string{"e.txt", "c.json", "a.txt", "b.txt", "d.txt"}) {
+		t.Error("Unexpected order after d.txt is done:", order)
+	}
+
+	// A priority is forgotten when the file is no longer queued.
+	f.queue.Reset()
+	f.orderQueue()
+	if order := pullOrder(); !equalStrings(order, []string{"c.json", "a.txt", "b.txt", "d.txt", "e.txt"}) {
+		t.Error("Unexpected order after e.txt was not needed:", order)
+	}
+
+	// Files we don't need can't be prioritized.
+	f.updateLocalsFromScanning(files[:1])
+	for _, name := range []string{"a.txt", "nonexistent"} {
+		if err := f.Prioritize(name); err != errNotPrioritizable {
+			t.Errorf("Prioritizing %v: got %v, expected %v", name, err, errNotPrioritizable)
+		}
+	}
+}
+
+func TestVerifyReassembled(t *testing.T) {
+	for _, corrupt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("corrupt=%v", corrupt), func(t *testing.T) {
+			m, f := setupSendReceiveFolder()
+			defer cleanupSRFolder(f, m)
+			ffs := f.Filesystem()
+			f.VerifyReassembled = true
+			// The copier looks for blocks in the configured folders.
+			m.cfg.SetFolder(f.FolderConfiguration)
+
+			// A local file, which the remote has copied to a new name that
+			// we can then pull by copying all the blocks locally.
+			data := make([]byte, 3*protocol.MinBlockSize)
+			rand.Read(data)
+			src := createFile(t, "src", ffs)
+			must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "src"), data, 0644))
+			src.Size = int64(len(data))
+			blocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(data), protocol.MinBlockSize, int64(len(data)), nil, false)
+			must(t, err)
+			src.Blocks = blocks
+			src.Version = protocol.Vector{}.Update(myID.Short())
+			f.updateLocalsFromScanning([]protocol.FileInfo{src})
+
+			dst := src
+			dst.Name = "dst"
+			dst.Sequence = 1
+			dst.Version = protocol.Vector{}.Update(device1.Short())
+			f.fset.Update(device1, []protocol.FileInfo{dst})
+
+			pullChan := make(chan pullBlockState, len(blocks))
+			finisherChan := make(chan *sharedPullerState, 1)
+			dbUpdateChan := make(chan dbUpdateJob, 1)
+			copyChan, copyWg := startCopier(f, pullChan, finisherChan)
+
+			f.handleFile(dst, copyChan, dbUpdateChan)
+
+			var state *sharedPullerState
+			select {
+			case state = <-finisherChan:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Timed out waiting for the copier")
+			}
+			close(copyChan)
+			copyWg.Wait()
+
+			if corrupt {
+				fd, err := os.OpenFile(filepath.Join(ffs.URI(), state.tempName), os.O_WRONLY, 0644)
+				must(t, err)
+				_, err = fd.WriteAt([]byte("corruption"), protocol.MinBlockSize+42)
+				must(t, err)
+				must(t, fd.Close())
+			}
+
+			// Leftovers of an earlier corrupt attempt, and of another
+			// file.
+			oldCorrupt := filepath.Join(quarantineDir, "dst~20200101-000000")
+			otherCorrupt := filepath.Join(quarantineDir, "dst2~20200101-000000")
+			if !corrupt {
+				must(t, ffs.MkdirAll(quarantineDir, 0700))
+				for _, name := range []string{oldCorrupt, otherCorrupt} {
+					fd, err := ffs.Create(name)
+					must(t, err)
+					must(t, fd.Close())
+				}
+			}
+
+			in := make(chan *sharedPullerState, 1)
+			in <- state
+			close(in)
+			f.finisherRoutine(in, dbUpdateChan, make(chan string, 1))
+
+			_, dstErr := ffs.Lstat("dst")
+			if !corrupt {
+				if dstErr != nil {
+					t.Fatal("Expected the file to be put in place, got", dstErr)
+				}
+				if job := <-dbUpdateChan; job.file.Name != "dst" {
+					t.Errorf("Expected db update for dst, got %v", job.file.Name)
+				}
+				if _, err := ffs.Lstat(oldCorrupt); !fs.IsNotExist(err) {
+					t.Error("Expected the quarantined copy to be removed after a successful pull, got", err)
+				}
+				if _, err := ffs.Lstat(otherCorrupt); err != nil {
+					t.Error("Expected the quarantined copy of another file to be kept, got", err)
+				}
+				return
+			}
+
+			if !fs.IsNotExist(dstErr) {
+				t.Error("Expected the corrupt file not to be put in place, got", dstErr)
+			}
+			if _, err := ffs.Lstat(state.tempName); !fs.IsNotExist(err) {
+				t.Error("Expected the corrupt temp file to be moved away, got", err)
+			}
+			quarantined, err := ffs.Glob(filepath.Join(quarantineDir, "dst~*"))
+			must(t, err)
+			if len(quarantined) != 1 {
+				t.Fatalf("Expected the corrupt file to be quarantined, got %v", quarantined)
+			}
+			if bs, err := ioutil.ReadFile(filepath.Join(ffs.URI(), quarantined[0])); err != nil || !bytes.Contains(bs, []byte("corruption")) {
+				t.Errorf("Expected the corrupt contents in quarantine, got %v", err)
+			}
+			if err := f.pullErrors["dst"]; !strings.Contains(err, errReassembledCorrupt.Error()) {
+				t.Errorf("Expected a corruption pull error, got %q", err)
+			}
+			select {
+			case job := <-dbUpdateChan:
+				t.Errorf("Unexpected db update for %v", job.file.Name)
+			default:
+			}
+			if _, ok := f.fset.Get(protocol.LocalDeviceID, "dst"); ok {
+				t.Error("Expected the file to still be needed")
+			}
+		})
+	}
+}
+
+func TestClearPullErrorSchedulesPull(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+	f.pullScheduled = make(chan struct{}, 1)
+
+	f.newPullError("a", errors.New("permission denied"))
+	f.newPullError("b", errors.New("permission denied"))
+
+	if err := f.ClearError("a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-f.pullScheduled:
+	default:
+		t.Error("clearing a pull error didn't schedule a pull")
+	}
+	if errs := f.Errors(); len(errs) != 1 || errs[0].Path != "b" {
+		t.Errorf("unexpected errors after clearing: %v", errs)
+	}
+
+	if err := f.ClearError("a"); err != errNoFileError {
+		t.Errorf("clearing a cleared error returned %v", err)
+	}
+	select {
+	case <-f.pullScheduled:
+		t.Error("pull scheduled without clearing an error")
+	default:
+	}
+}
+
+func TestPullerWorkers(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+
+	started := make(map[string]int)
+	f.workerStarted = func(stage string) {
+		started[stage]++
+	}
+	check := func(copiers, pullers, finishers int) {
+		t.Helper()
+		for k := range started {
+			delete(started, k)
+		}
+		f.pullerIteration(make(chan string))
+		expected := map[string]int{"copier": copiers, "puller": pullers, "finisher": finishers}
+		if !reflect.DeepEqual(started, expected) {
+			t.Errorf("Started %v, expected %v", started, expected)
+		}
+	}
+
+	// Auto
+	check(defaultCopiers, defaultPullers, defaultFinishers)
+
+	cfg := f.FolderConfiguration
+	cfg.Copiers = 3
+	cfg.Pullers = 2
+	cfg.Finishers = 4
+	f.applyConfig(cfg)
+	check(3, 2, 4)
+
+	// Back to auto, partially.
+	cfg.Copiers = 0
+	cfg.Finishers = 0
+	f.applyConfig(cfg)
+	check(defaultCopiers, 2, defaultFinishers)
+}
+
+func TestPullerWorkersReconfigure(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	m.fmut.RLock()
+	runner := m.folderRunners["default"]
+	m.fmut.RUnlock()
+
+	fcfg.Copiers = 5
+	fcfg.Pullers = 3
+	fcfg.Finishers = 2
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+
+	m.fmut.RLock()
+	newRunner := m.folderRunners["default"]
+	m.fmut.RUnlock()
+	if newRunner != runner {
+		t.Fatal("Folder was restarted")
+	}
+
+	f := runner.(*sendReceiveFolder)
+	f.workersMut.Lock()
+	workers := f.workers
+	f.workersMut.Unlock()
+	if expected := (pullerWorkers{copiers: 5, pullers: 3, finishers: 2}); workers != expected {
+		t.Errorf("Got workers %+v, expected %+v", workers, expected)
+	}
+}
+
+func TestLinkFile(t *testing.T) {
+	// Verifies that a file is hardlinked to its target when that is in
+	// place, and pulled otherwise.
+
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+	f.folder.FolderConfiguration = config.NewFolderConfiguration(m.id, f.ID, f.Label, fs.FilesystemTypeFake, fmt.Sprintf("/TestLinkFile%d", time.Now().UnixNano()))
+	f.folder.FolderConfiguration.PreserveHardlinks = true
+	f.fs = f.Filesystem()
+
+	fd, err := f.fs.Create("a")
+	must(t, err)
+	_, err = fd.Write(make([]byte, 2*protocol.MinBlockSize))
+	must(t, err)
+	fd.Close()
+	info, err := f.fs.Lstat("a")
+	must(t, err)
+
+	target := setupFile("a", []int{1, 2})
+	target.Type = protocol.FileInfoTypeFile
+	target.Size = info.Size()
+	target.Permissions = uint32(info.Mode() & fs.ModePerm)
+	target.ModifiedS = info.ModTime().Unix()
+	target.ModifiedNs = int32(info.ModTime().Nanosecond())
+	target.Version = target.Version.Update(myID.Short())
+	f.updateLocalsFromScanning([]protocol.FileInfo{target})
+
+	file := target
+	file.Name = "b"
+	file.HardlinkTarget = "a"
+	file.Version = protocol.Vector{}.Update(device1.Short())
+
+	dbUpdateChan := make(chan dbUpdateJob, 1)
+	if !f.linkFile(file, false, dbUpdateChan, nil) {
+		t.Fatal("Expected the file to be linked")
+	}
+	if job := <-dbUpdateChan; job.file.Name != "b" {
+		t.Errorf("Unexpected database update for %v", job.file.Name)
+	}
+	a, err := f.fs.Lstat("a")
+	must(t, err)
+	b, err := f.fs.Lstat("b")
+	must(t, err)
+	if a.HardlinkID() == "" || a.HardlinkID() != b.HardlinkID() {
+		t.Errorf("Expected a and b to be hardlinked, got IDs %q and %q", a.HardlinkID(), b.HardlinkID())
+	}
+
+	// A target changed on disk isn't linked to.
+	must(t, f.fs.Chtimes("a", time.Unix(1234567890, 0), time.Unix(1234567890, 0)))
+	file.Name = "c"
+	if f.linkFile(file, false, dbUpdateChan, nil) {
+		t.Error("Expected the file not to be linked to a changed target")
+	}
+	if _, err := f.fs.Lstat("c"); !fs.IsNotExist(err) {
+		t.Error("Expected c not to exist, got", err)
+	}
+}
+
+func TestCopyBlockRangeVerifies(t *testing.T) {
+	dir := createTmpDir()
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+
+	data := make([]byte, protocol.MinBlockSize)
+	rand.Read(data)
+	blocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(data), protocol.MinBlockSize, -1, nil, false)
+	must(t, err)
+	block := blocks[0]
+
+	src, err := ffs.Create("src")
+	must(t, err)
+	defer src.Close()
+	_, err = src.Write(data)
+	must(t, err)
+	dstFd, err := ffs.Create("dst")
+	must(t, err)
+	defer dstFd.Close()
+	dst := &lockedWriterAt{sync.NewRWMutex(), dstFd}
+
+	buf := make([]byte, len(data))
+	if err := copyBlockRange(dst, src, 0, block, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source changed after it was verified.
+	_, err = src.WriteAt([]byte{data[0] + 1}, 0)
+	must(t, err)
+	if err := copyBlockRange(dst, src, 0, block, buf); !isVerifyError(err) {
+		t.Fatal("Expected a verification error, got", err)
+	}
+}
+
+func TestRejectByPolicy(t *testing.T) {
+	m, f := setupSendReceiveFolder()
+	defer cleanupSRFolder(f, m)
+	f.ignores = ignore.New(f.Filesystem())
+
+	f.RejectPatterns = []string{"*.exe", "bin"}
+	f.MaxFileSize = 100
+
+	var files []protocol.FileInfo
+	for _, file := range []struct {
+		name string
+		typ  protocol.FileInfoType
+		size int64
+	}{
+		{"ok.txt", protocol.FileInfoTypeFile, 4},
+		{"dir/virus.exe", protocol.FileInfoTypeFile, 4},
+		{"bin", protocol.FileInfoTypeDirectory, 128},
+		{"bin/tool", protocol.FileInfoTypeFile, 4},
+		{"bin/sub/tool", protocol.FileInfoTypeFile, 4},
+		{"large", protocol.FileInfoTypeFile, 101},
+		{"limit", protocol.FileInfoTypeFile, 100},
+	} {
+		files = append(files, protocol.FileInfo{
+			Name:    filepath.FromSlash(file.name),
+			Type:    file.typ,
+			Size:    file.size,
+			Version: protocol.Vector{}.Update(device1.Short()),
+			Blocks:  []protocol.BlockInfo{{Size: int32(file.size), Hash: []byte("hash")}},
+		})
+	}
+	f.fset.Update(device1, files)
+
+	rejected := func() []string {
+		var names []string
+		f.fset.WithNeed(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+			file := intf.(protocol.FileInfo)
+			if step, _, _ := f.planPullStep(file); step == pullStepRejected {
+				names = append(names, filepath.ToSlash(file.Name))
+			}
+			return true
+		})
+		sort.Strings(names)
+		return names
+	}
+
+	// Rejected items, including everything below a rejected directory,
+	// stay needed but aren't pulled.
+	if expected := []string{"bin", "bin/sub/tool", "bin/tool", "dir/virus.exe", "large"}; !reflect.DeepEqual(rejected(), expected) {
+		t.Errorf("Expected %v to be rejected, got %v", expected, rejected())
+	}
+
+	// Changing the policy applies to the existing index.
+	f.RejectPatterns = nil
+	f.MaxFileSize = 0
+	if res := rejected(); len(res) != 0 {
+		t.Errorf("Expected nothing to be rejected after lifting the policy, got %v", res)
+	}
+}
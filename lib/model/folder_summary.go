@@ -77,13 +77,13 @@ func (c *folderSummaryService) String() string {
 func (c *folderSummaryService) Summary(folder string) (map[string]interface{}, error) {
 	var res = make(map[string]interface{})
 
-	errors, err := c.model.FolderErrors(folder)
+	_, errors, err := c.model.FolderErrors(folder, 0, 0)
 	if err != nil && err != ErrFolderPaused && err != errFolderNotRunning {
 		// Stats from the db can still be obtained if the folder is just paused/being started
 		return nil, err
 	}
-	res["errors"] = len(errors)
-	res["pullErrors"] = len(errors) // deprecated
+	res["errors"] = errors
+	res["pullErrors"] = errors // deprecated
 
 	res["invalid"] = "" // Deprecated, retains external API for now
 
@@ -96,7 +96,7 @@ func (c *folderSummaryService) Summary(folder string) (map[string]interface{}, e
 	need := c.model.NeedSize(folder)
 	res["needFiles"], res["needDirectories"], res["needSymlinks"], res["needDeletes"], res["needBytes"], res["needTotalItems"] = need.Files, need.Directories, need.Symlinks, need.Deleted, need.Bytes, need.TotalItems()
 
-	if c.cfg.Folders()[folder].Type == config.FolderTypeReceiveOnly {
+	if t := c.cfg.Folders()[folder].Type; t == config.FolderTypeReceiveOnly || t == config.FolderTypeReceiveEncrypted {
 		// Add statistics for things that have changed locally in a receive
 		// only folder.
 		ro := c.model.ReceiveOnlyChangedSize(folder)
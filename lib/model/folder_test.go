@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/d4l3k/messagediff"
 	"github.com/syncthing/syncthing/lib/config"
@@ -135,6 +136,67 @@ func TestUnifySubs(t *testing.T) {
 	}
 }
 
+func TestJitteredScanInterval(t *testing.T) {
+	const interval = time.Hour
+
+	if d := jitteredInterval(interval, 0); d != interval {
+		t.Errorf("got %v without jitter, expected %v", d, interval)
+	}
+
+	// Many folders with the same interval scan at different times, but all
+	// within the jitter of the interval.
+	const folders = 100
+	min, max := time.Duration(1<<63-1), time.Duration(0)
+	seen := make(map[time.Duration]int)
+	for i := 0; i < folders; i++ {
+		d := jitteredInterval(interval, 25)
+		if d < interval*3/4 || d > interval*5/4 {
+			t.Fatalf("interval %v outside of the jitter", d)
+		}
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		seen[d.Truncate(time.Second)]++
+	}
+	if max-min < interval/4 {
+		t.Errorf("scans only spread over %v", max-min)
+	}
+	for d, n := range seen {
+		if n > 3 {
+			t.Errorf("%d folders scan at %v", n, d)
+		}
+	}
+}
+
+func TestInitialScanDelay(t *testing.T) {
+	if d := initialScanDelay(time.Hour, 0); d != time.Millisecond {
+		t.Errorf("got %v without jitter, expected the first scan right away", d)
+	}
+
+	// Folders started together scan at different times, soon after
+	// starting.
+	const folders = 100
+	min, max := time.Duration(1<<63-1), time.Duration(0)
+	for i := 0; i < folders; i++ {
+		d := initialScanDelay(time.Hour, 50)
+		if d > time.Millisecond+maxInitialScanStagger/2 {
+			t.Fatalf("first scan delayed by %v", d)
+		}
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	if max-min < maxInitialScanStagger/4 {
+		t.Errorf("first scans only spread over %v", max-min)
+	}
+}
+
 func BenchmarkUnifySubs(b *testing.B) {
 	cases := unifySubsCases()
 	b.ReportAllocs()
@@ -9,6 +9,9 @@ package model
 import (
 	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/sync"
 )
@@ -22,6 +25,7 @@ const (
 	FolderSyncPreparing
 	FolderSyncing
 	FolderError
+	FolderMarkerMissing
 )
 
 func (s folderState) String() string {
@@ -38,6 +42,8 @@ func (s folderState) String() string {
 		return "syncing"
 	case FolderError:
 		return "error"
+	case FolderMarkerMissing:
+		return "marker-missing"
 	default:
 		return "unknown"
 	}
@@ -61,9 +67,10 @@ func newStateTracker(id string, evLogger events.Logger) stateTracker {
 	}
 }
 
-// setState sets the new folder state, for states other than FolderError.
+// setState sets the new folder state, for states other than FolderError and
+// FolderMarkerMissing.
 func (s *stateTracker) setState(newState folderState) {
-	if newState == FolderError {
+	if newState == FolderError || newState == FolderMarkerMissing {
 		panic("must use setError")
 	}
 
@@ -106,7 +113,9 @@ func (s *stateTracker) getState() (current folderState, changed time.Time, err e
 }
 
 // setError sets the folder state to FolderError with the specified error or
-// to FolderIdle if the error is nil
+// to FolderIdle if the error is nil. A missing folder marker gets its own
+// FolderMarkerMissing state, as it usually means the folder path isn't
+// mounted rather than anything being wrong with the data.
 func (s *stateTracker) setError(err error) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
@@ -116,10 +125,14 @@ func (s *stateTracker) setError(err error) {
 		"from":   s.current.String(),
 	}
 
-	if err != nil {
+	switch {
+	case errors.Cause(err) == config.ErrMarkerMissing:
+		eventData["error"] = err.Error()
+		s.current = FolderMarkerMissing
+	case err != nil:
 		eventData["error"] = err.Error()
 		s.current = FolderError
-	} else {
+	default:
 		s.current = FolderIdle
 	}
 
@@ -0,0 +1,109 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func linkCount(t *testing.T, path string) (uint64, uint64) {
+	t.Helper()
+	info, err := os.Lstat(path)
+	must(t, err)
+	st := info.Sys().(*syscall.Stat_t)
+	return uint64(st.Nlink), st.Ino
+}
+
+func TestScanHardlinks(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.PreserveHardlinks = true
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+
+	ffs := fcfg.Filesystem()
+	writeVerifyFile(t, ffs, "a", 1024)
+	writeVerifyFile(t, ffs, "c", 1024)
+	must(t, ffs.Hardlink("a", "b"))
+
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, ffs.URI())
+
+	expected := map[string]string{"a": "", "b": "a", "c": ""}
+	for name, target := range expected {
+		f, ok := m.CurrentFolderFile("default", name)
+		if !ok {
+			t.Fatalf("%v not scanned", name)
+		}
+		if f.HardlinkTarget != target {
+			t.Errorf("%v: expected hardlink target %q, got %q", name, target, f.HardlinkTarget)
+		}
+	}
+}
+
+func TestPullHardlinks(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.PreserveHardlinks = true
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m, fc := setupModelWithConnectionFromWrapper(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	done := make(chan struct{})
+	seen := make(map[string]bool)
+	fc.mut.Lock()
+	fc.indexFn = func(_ context.Context, folder string, fs []protocol.FileInfo) {
+		for _, f := range fs {
+			seen[f.Name] = true
+		}
+		if seen["a"] && seen["b"] && seen["c"] {
+			close(done)
+		}
+	}
+	fc.mut.Unlock()
+
+	contents := []byte("linked contents\n")
+	fc.addFile("a", 0644, protocol.FileInfoTypeFile, contents)
+	fc.addFile("b", 0644, protocol.FileInfoTypeFile, contents)
+	fc.addFile("c", 0644, protocol.FileInfoTypeFile, contents)
+	fc.mut.Lock()
+	// The names of a file share the modification time.
+	for i := range fc.files {
+		fc.files[i].ModifiedS = fc.files[0].ModifiedS
+	}
+	fc.files[1].HardlinkTarget = "a"
+	fc.mut.Unlock()
+	fc.sendIndexUpdate()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the files to sync")
+	}
+
+	path := fcfg.Filesystem().URI()
+	nlinkA, inoA := linkCount(t, filepath.Join(path, "a"))
+	nlinkB, inoB := linkCount(t, filepath.Join(path, "b"))
+	nlinkC, _ := linkCount(t, filepath.Join(path, "c"))
+	if nlinkA != 2 || nlinkB != 2 || inoA != inoB {
+		t.Errorf("Expected a and b to be hardlinked, got link counts %d and %d, inodes %d and %d", nlinkA, nlinkB, inoA, inoB)
+	}
+	if nlinkC != 1 {
+		t.Errorf("Expected c not to be hardlinked, got link count %d", nlinkC)
+	}
+	if err := equalContents(filepath.Join(path, "b"), contents); err != nil {
+		t.Error("Hardlinked file has wrong contents:", err)
+	}
+}
@@ -16,16 +16,20 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	stdsync "sync"
 	"time"
 
+	"github.com/gobwas/glob"
 	"github.com/pkg/errors"
 	"github.com/thejerf/suture"
+	"golang.org/x/time/rate"
 
 	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/connections"
 	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/ignore"
@@ -45,23 +49,39 @@ const (
 	maxBatchSizeFiles = 1000       // Either way, don't include more files than this
 )
 
+// How many requests a device may have outstanding towards us, unless
+// configured otherwise for the device.
+const defaultMaxConcurrentRequests = 512
+
+// How many changes of the version of each file are kept, when the folder
+// tracks version history.
+const versionHistoryLength = 20
+
+// How many of the most recent dial attempts are kept per device.
+const maxConnectionAttempts = 100
+
 type service interface {
 	BringToFront(string)
+	Prioritize(string) error
 	Override()
 	Revert()
 	DelayScan(d time.Duration)
 	SchedulePull()                                    // something relevant changed, we should try a pull
 	Jobs(page, perpage int) ([]string, []string, int) // In progress, Queued, skipped
 	Scan(subs []string) error
+	ScanMetadataOnly() error
 	Serve()
 	Stop()
 	CheckHealth() error
 	Errors() []FileError
 	WatchError() error
 	ForceRescan(file protocol.FileInfo) error
+	ClearError(path string) error
 	GetStatistics() (stats.FolderStatistics, error)
 
 	getState() (folderState, time.Time, error)
+	scheduleScanOnConnect()
+	applyConfig(cfg config.FolderConfiguration) // changes that don't require a restart
 }
 
 type Availability struct {
@@ -69,6 +89,23 @@ type Availability struct {
 	FromTemporary bool              `json:"fromTemporary"`
 }
 
+// PullActionType is the kind of change a pull makes to an item.
+type PullActionType string
+
+const (
+	PullActionCreate   PullActionType = "create"
+	PullActionUpdate   PullActionType = "update"
+	PullActionDelete   PullActionType = "delete"
+	PullActionConflict PullActionType = "conflict"
+)
+
+// A PullAction is a change a pull would make to an item in a folder.
+type PullAction struct {
+	Name   string         `json:"name"`
+	Type   string         `json:"type"` // "file", "dir" or "symlink"
+	Action PullActionType `json:"action"`
+}
+
 type DirectoryTree struct {
 	Name        string           `json:"name"`
 	IsDirectory bool             `json:"isDirectory"`
@@ -85,24 +122,42 @@ type Model interface {
 	ScanFolder(folder string) error
 	ScanFolders() map[string]error
 	ScanFolderSubdirs(folder string, subs []string) error
+	ScanFolderMetadataOnly(folder string) error
+	AddProgressObserver(observer ProgressObserver)
 	State(folder string) (string, time.Time, error)
-	FolderErrors(folder string) ([]FileError, error)
+	FolderErrors(folder string, offset, limit int) ([]FileError, int, error)
+	ClearFolderError(folder, path string) error
 	WatchError(folder string) error
 	Override(folder string)
 	Revert(folder string)
 	BringToFront(folder, file string)
+	PrioritizeFile(folder, file string) error
 	GetIgnores(folder string) ([]string, []string, error)
 	SetIgnores(folder string, content []string) error
+	MatchIgnore(folder, path string) (bool, string, error)
 
 	GetFolderVersions(folder string) (map[string][]versioner.FileVersion, error)
 	RestoreFolderVersions(folder string, versions map[string]time.Time) (map[string]string, error)
+	RestoreFolderVersionTo(folder, file string, version time.Time, dest string) error
+	FolderVersionsCleanupDryRun(folder string) ([]string, error)
+	DryRunPull(folder string) ([]PullAction, error)
+	CreateFolderMarker(folder string) error
+	RevertToGlobal(folder, file string) error
+	OverrideSubpaths(folder string, subs []string) error
+	RevertSubpaths(folder string, subs []string) error
 
 	LocalChangedFiles(folder string, page, perpage int) []db.FileInfoTruncated
 	NeedFolderFiles(folder string, page, perpage int) ([]db.FileInfoTruncated, []db.FileInfoTruncated, []db.FileInfoTruncated)
+	NeedFolderFilesMatching(folder, pattern string, offset, limit int) ([]db.FileInfoTruncated, int, error)
 	RemoteNeedFolderFiles(device protocol.DeviceID, folder string, page, perpage int) ([]db.FileInfoTruncated, error)
+	ConflictingFiles(folder string) ([]ConflictFile, error)
 	CurrentFolderFile(folder string, file string) (protocol.FileInfo, bool)
 	CurrentGlobalFile(folder string, file string) (protocol.FileInfo, bool)
+	OpenRemoteFile(folder, file string) (ReadSeekCloser, error)
+	VerifyFolder(ctx context.Context, folder string) (<-chan VerifyResult, error)
 	Availability(folder string, file protocol.FileInfo, block protocol.BlockInfo) []Availability
+	GlobalAvailability(folder, file string) ([]protocol.DeviceID, error)
+	FileHistory(folder, file string) ([]db.VersionEvent, error)
 
 	GlobalSize(folder string) db.Counts
 	LocalSize(folder string) db.Counts
@@ -113,13 +168,20 @@ type Model interface {
 	RemoteSequence(folder string) (int64, bool)
 
 	Completion(device protocol.DeviceID, folder string) FolderCompletion
+	ClusterCompletion(folder string) (ClusterCompletionInfo, error)
 	ConnectionStats() map[string]interface{}
+	ConnectionAttempts(device protocol.DeviceID) []connections.Attempt
+	TestDeviceConnectivity(ctx context.Context, device protocol.DeviceID) (ConnectivityResult, error)
+	SetConnectivityTester(tester connections.ConnectivityTester)
 	DeviceStatistics() (map[string]stats.DeviceStatistics, error)
+	IntroducedDevices(introducer protocol.DeviceID) []protocol.DeviceID
 	FolderStatistics() (map[string]stats.FolderStatistics, error)
 	UsageReportingStats(version int, preview bool) map[string]interface{}
 
 	StartDeadlockDetector(timeout time.Duration)
 	GlobalDirectoryTree(folder, prefix string, levels int, dirsonly bool) []*DirectoryTree
+	SnapshotDatabase(location string) error
+	DatabaseOpen() bool
 }
 
 type model struct {
@@ -134,6 +196,7 @@ type model struct {
 	cacheIgnoredFiles bool
 	protectedFiles    []string
 	evLogger          events.Logger
+	scanLimiter       *byteSemaphore // limits the number of concurrent scans, zero meaning no limit
 
 	clientName    string
 	clientVersion string
@@ -151,10 +214,15 @@ type model struct {
 	pmut                sync.RWMutex // protects the below
 	conn                map[protocol.DeviceID]connections.Connection
 	connRequestLimiters map[protocol.DeviceID]*byteSemaphore
+	connReadAheads      map[protocol.DeviceID]*readAhead
+	connRateLimiters    map[protocol.DeviceID]*rate.Limiter
 	closed              map[protocol.DeviceID]chan struct{}
 	helloMessages       map[protocol.DeviceID]protocol.HelloResult
 	deviceDownloads     map[protocol.DeviceID]*deviceDownloadState
-	remotePausedFolders map[protocol.DeviceID][]string // deviceID -> folders
+	remotePausedFolders map[protocol.DeviceID][]string                  // deviceID -> folders
+	remoteCloseReasons  map[protocol.DeviceID]protocol.RemoteCloseError // deviceID -> reason it gave for the last closed connection
+	connAttempts        map[protocol.DeviceID][]connections.Attempt     // deviceID -> recent dial attempts, oldest first
+	connTester          connections.ConnectivityTester
 
 	foldersRunning int32 // for testing only
 }
@@ -166,18 +234,29 @@ var (
 )
 
 var (
-	errDeviceUnknown     = errors.New("unknown device")
-	errDevicePaused      = errors.New("device is paused")
-	errDeviceIgnored     = errors.New("device is ignored")
-	ErrFolderPaused      = errors.New("folder is paused")
-	errFolderNotRunning  = errors.New("folder is not running")
-	errFolderMissing     = errors.New("no such folder")
-	errNetworkNotAllowed = errors.New("network not allowed")
-	errNoVersioner       = errors.New("folder has no versioner")
+	errDeviceUnknown        = errors.New("unknown device")
+	errDevicePaused         = protocol.NewCloseError(protocol.CloseReasonDevicePaused, "device is paused")
+	errDeviceIgnored        = errors.New("device is ignored")
+	ErrFolderPaused         = errors.New("folder is paused")
+	errFolderNotRunning     = errors.New("folder is not running")
+	errFolderMissing        = errors.New("no such folder")
+	errNetworkNotAllowed    = errors.New("network not allowed")
+	errNoVersioner          = errors.New("folder has no versioner")
+	errNoCleanupDryRun      = errors.New("versioner does not support cleanup preview")
+	errFolderNotPulling     = errors.New("folder does not pull changes")
+	errFolderNotSendOnly    = errors.New("folder is not send only")
+	errFolderNotReceiveOnly = errors.New("folder is not receive only")
+	errNotPrioritizable     = errors.New("file is not to be pulled")
+	errNoFileError          = errors.New("no error for the given item")
+	errNoSuchFile           = errors.New("no such file")
+	errNotRegularFile       = errors.New("not a regular file")
+	errNoVersionHistory     = errors.New("folder does not track version history")
 	// errors about why a connection is closed
-	errIgnoredFolderRemoved = errors.New("folder no longer ignored")
-	errReplacingConnection  = errors.New("replacing connection")
-	errStopped              = errors.New("Syncthing is being stopped")
+	errIgnoredFolderRemoved = protocol.NewCloseError(protocol.CloseReasonFolderChanged, "folder no longer ignored")
+	errReplacingConnection  = protocol.NewCloseError(protocol.CloseReasonReplaced, "replacing connection")
+	errStopped              = protocol.NewCloseError(protocol.CloseReasonShutdown, "Syncthing is being stopped")
+	errDeviceRemoved        = protocol.NewCloseError(protocol.CloseReasonDeviceRemoved, "device removed")
+	errDeviceTrustChanged   = protocol.NewCloseError(protocol.CloseReasonFolderChanged, "device trust changed")
 )
 
 // NewModel creates and starts a new model. The model starts in read-only mode,
@@ -200,6 +279,7 @@ func NewModel(cfg config.Wrapper, id protocol.DeviceID, clientName, clientVersio
 		cacheIgnoredFiles:   cfg.Options().CacheIgnoredFiles,
 		protectedFiles:      protectedFiles,
 		evLogger:            evLogger,
+		scanLimiter:         newByteSemaphore(cfg.Options().MaxConcurrentScans),
 		clientName:          clientName,
 		clientVersion:       clientVersion,
 		folderCfgs:          make(map[string]config.FolderConfiguration),
@@ -211,10 +291,14 @@ func NewModel(cfg config.Wrapper, id protocol.DeviceID, clientName, clientVersio
 		folderVersioners:    make(map[string]versioner.Versioner),
 		conn:                make(map[protocol.DeviceID]connections.Connection),
 		connRequestLimiters: make(map[protocol.DeviceID]*byteSemaphore),
+		connReadAheads:      make(map[protocol.DeviceID]*readAhead),
+		connRateLimiters:    make(map[protocol.DeviceID]*rate.Limiter),
 		closed:              make(map[protocol.DeviceID]chan struct{}),
 		helloMessages:       make(map[protocol.DeviceID]protocol.HelloResult),
 		deviceDownloads:     make(map[protocol.DeviceID]*deviceDownloadState),
 		remotePausedFolders: make(map[protocol.DeviceID][]string),
+		remoteCloseReasons:  make(map[protocol.DeviceID]protocol.RemoteCloseError),
+		connAttempts:        make(map[protocol.DeviceID][]connections.Attempt),
 		fmut:                sync.NewRWMutex(),
 		pmut:                sync.NewRWMutex(),
 	}
@@ -222,7 +306,6 @@ func NewModel(cfg config.Wrapper, id protocol.DeviceID, clientName, clientVersio
 		m.deviceStatRefs[devID] = stats.NewDeviceStatisticsReference(m.db, devID.String())
 	}
 	m.Add(m.progressEmitter)
-	scanLimiter.setCapacity(cfg.Options().MaxConcurrentScans)
 
 	return m
 }
@@ -257,6 +340,7 @@ func (m *model) Stop() {
 	for id := range devs {
 		ids = append(ids, id)
 	}
+	m.drainConns(ids, time.Duration(m.cfg.Options().ConnectionDrainTimeoutS)*time.Second, errStopped)
 	w := m.closeConns(ids, errStopped)
 	w.Wait()
 }
@@ -278,7 +362,7 @@ func (m *model) startFolder(folder string) {
 	m.fmut.RUnlock()
 
 	// Close connections to affected devices
-	m.closeConns(folderCfg.DeviceIDs(), fmt.Errorf("started folder %v", folderCfg.Description()))
+	m.closeConns(folderCfg.DeviceIDs(), protocol.NewCloseError(protocol.CloseReasonFolderChanged, fmt.Sprintf("started folder %v", folderCfg.Description())))
 
 	m.fmut.Lock()
 	defer m.fmut.Unlock()
@@ -420,8 +504,14 @@ func (m *model) addFolder(cfg config.FolderConfiguration) {
 func (m *model) addFolderLocked(cfg config.FolderConfiguration, fset *db.FileSet) {
 	m.folderCfgs[cfg.ID] = cfg
 	m.folderFiles[cfg.ID] = fset
+	if cfg.TrackVersionHistory {
+		fset.TrackVersionHistory(versionHistoryLength)
+	} else {
+		// Drops what might have been recorded while it was enabled.
+		fset.TrackVersionHistory(0)
+	}
 
-	ignores := ignore.New(cfg.Filesystem(), ignore.WithCache(m.cacheIgnoredFiles))
+	ignores := ignore.New(cfg.Filesystem(), ignore.WithCache(m.cacheIgnoredFiles), ignore.WithAllowlist(cfg.IgnoreMode == config.IgnoreModeAllowlist))
 	if err := ignores.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
 		l.Warnln("Loading ignores:", err)
 	}
@@ -429,7 +519,7 @@ func (m *model) addFolderLocked(cfg config.FolderConfiguration, fset *db.FileSet
 }
 
 func (m *model) removeFolder(cfg config.FolderConfiguration) {
-	m.stopFolder(cfg, fmt.Errorf("removing folder %v", cfg.Description()))
+	m.stopFolder(cfg, protocol.NewCloseError(protocol.CloseReasonFolderChanged, fmt.Sprintf("removing folder %v", cfg.Description())))
 
 	m.fmut.Lock()
 
@@ -520,7 +610,7 @@ func (m *model) restartFolder(from, to config.FolderConfiguration) {
 		fset = db.NewFileSet(to.ID, to.Filesystem(), m.db)
 	}
 
-	m.stopFolder(from, fmt.Errorf("%v folder %v", errMsg, to.Description()))
+	m.stopFolder(from, protocol.NewCloseError(protocol.CloseReasonFolderChanged, fmt.Sprintf("%v folder %v", errMsg, to.Description())))
 
 	m.fmut.Lock()
 	defer m.fmut.Unlock()
@@ -539,7 +629,7 @@ func (m *model) newFolder(cfg config.FolderConfiguration) {
 	fset := db.NewFileSet(cfg.ID, cfg.Filesystem(), m.db)
 
 	// Close connections to affected devices
-	m.closeConns(cfg.DeviceIDs(), fmt.Errorf("started folder %v", cfg.Description()))
+	m.closeConns(cfg.DeviceIDs(), protocol.NewCloseError(protocol.CloseReasonFolderChanged, fmt.Sprintf("started folder %v", cfg.Description())))
 
 	m.fmut.Lock()
 	defer m.fmut.Unlock()
@@ -649,22 +739,34 @@ type ConnectionInfo struct {
 	Paused        bool
 	Address       string
 	ClientVersion string
+	Platform      string
 	Type          string
 	Crypto        string
+	CloseReason   protocol.CloseReason // as given by the device for the last closed connection
+	CloseMessage  string
+	RelayScore    time.Duration // of the relay the connection goes through, zero if unknown
 }
 
 func (info ConnectionInfo) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	res := map[string]interface{}{
 		"at":            info.At,
 		"inBytesTotal":  info.InBytesTotal,
 		"outBytesTotal": info.OutBytesTotal,
+		"rttMs":         info.RTT.Seconds() * 1000,
 		"connected":     info.Connected,
 		"paused":        info.Paused,
 		"address":       info.Address,
 		"clientVersion": info.ClientVersion,
+		"platform":      info.Platform,
 		"type":          info.Type,
 		"crypto":        info.Crypto,
-	})
+		"closeReason":   info.CloseReason,
+		"closeMessage":  info.CloseMessage,
+	}
+	if info.RelayScore > 0 {
+		res["relayScoreMs"] = info.RelayScore.Seconds() * 1000
+	}
+	return json.Marshal(res)
 }
 
 // ConnectionStats returns a map with connection statistics for each device.
@@ -683,8 +785,13 @@ func (m *model) ConnectionStats() map[string]interface{} {
 		}
 		ci := ConnectionInfo{
 			ClientVersion: strings.TrimSpace(versionString),
+			Platform:      hello.Platform,
 			Paused:        deviceCfg.Paused,
 		}
+		if reason, ok := m.remoteCloseReasons[device]; ok {
+			ci.CloseReason = reason.Code
+			ci.CloseMessage = reason.Reason
+		}
 		if conn, ok := m.conn[device]; ok {
 			ci.Type = conn.Type()
 			ci.Crypto = conn.Crypto()
@@ -693,6 +800,9 @@ func (m *model) ConnectionStats() map[string]interface{} {
 			if addr := conn.RemoteAddr(); addr != nil {
 				ci.Address = addr.String()
 			}
+			if score, ok := conn.RelayScore(); ok {
+				ci.RelayScore = score
+			}
 		}
 
 		conns[device.String()] = ci
@@ -712,6 +822,26 @@ func (m *model) ConnectionStats() map[string]interface{} {
 	return res
 }
 
+// DialAttempt records the outcome of dialing the device, keeping the most
+// recent maxConnectionAttempts of them.
+func (m *model) DialAttempt(device protocol.DeviceID, attempt connections.Attempt) {
+	m.pmut.Lock()
+	attempts := append(m.connAttempts[device], attempt)
+	if len(attempts) > maxConnectionAttempts {
+		attempts = append(attempts[:0:0], attempts[len(attempts)-maxConnectionAttempts:]...)
+	}
+	m.connAttempts[device] = attempts
+	m.pmut.Unlock()
+}
+
+// ConnectionAttempts returns the most recent dial attempts to the device,
+// oldest first.
+func (m *model) ConnectionAttempts(device protocol.DeviceID) []connections.Attempt {
+	m.pmut.RLock()
+	defer m.pmut.RUnlock()
+	return append([]connections.Attempt(nil), m.connAttempts[device]...)
+}
+
 // DeviceStatistics returns statistics about each device
 func (m *model) DeviceStatistics() (map[string]stats.DeviceStatistics, error) {
 	m.fmut.RLock()
@@ -829,6 +959,92 @@ func (m *model) Completion(device protocol.DeviceID, folder string) FolderComple
 	}
 }
 
+// ClusterCompletionInfo is the completion of a folder across the devices
+// it is shared with, including ourselves. Only connected devices are
+// accounted for in the percentages, as we don't know how far along the
+// others are.
+type ClusterCompletionInfo struct {
+	MinPct       float64
+	MaxPct       float64
+	AvgPct       float64
+	Devices      map[protocol.DeviceID]FolderCompletion // connected devices
+	Behind       []protocol.DeviceID                    // connected devices that aren't complete
+	Disconnected []protocol.DeviceID                    // devices with unknown completion
+}
+
+// Map returns the members as a map, e.g. used in api to serialize as Json.
+func (info ClusterCompletionInfo) Map() map[string]interface{} {
+	devices := make(map[string]interface{}, len(info.Devices))
+	for id, comp := range info.Devices {
+		devices[id.String()] = comp.Map()
+	}
+	return map[string]interface{}{
+		"minCompletion": info.MinPct,
+		"maxCompletion": info.MaxPct,
+		"avgCompletion": info.AvgPct,
+		"devices":       devices,
+		"behind":        info.Behind,
+		"disconnected":  info.Disconnected,
+	}
+}
+
+// ClusterCompletion returns the completion of the given folder across all
+// the devices it is shared with.
+func (m *model) ClusterCompletion(folder string) (ClusterCompletionInfo, error) {
+	m.fmut.RLock()
+	cfg, ok := m.folderCfgs[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return ClusterCompletionInfo{}, errFolderMissing
+	}
+
+	info := ClusterCompletionInfo{
+		Devices:      make(map[protocol.DeviceID]FolderCompletion),
+		Behind:       []protocol.DeviceID{},
+		Disconnected: []protocol.DeviceID{},
+	}
+	for _, device := range cfg.DeviceIDs() {
+		var comp FolderCompletion
+		if device == m.id {
+			comp = m.Completion(protocol.LocalDeviceID, folder)
+		} else {
+			m.pmut.RLock()
+			_, connected := m.conn[device]
+			m.pmut.RUnlock()
+			if !connected {
+				info.Disconnected = append(info.Disconnected, device)
+				continue
+			}
+			comp = m.Completion(device, folder)
+		}
+
+		if len(info.Devices) == 0 || comp.CompletionPct < info.MinPct {
+			info.MinPct = comp.CompletionPct
+		}
+		if comp.CompletionPct > info.MaxPct {
+			info.MaxPct = comp.CompletionPct
+		}
+		info.AvgPct += comp.CompletionPct
+		info.Devices[device] = comp
+		if comp.CompletionPct < 100 {
+			info.Behind = append(info.Behind, device)
+		}
+	}
+	if len(info.Devices) > 0 {
+		info.AvgPct /= float64(len(info.Devices))
+	}
+
+	sortDeviceIDs(info.Behind)
+	sortDeviceIDs(info.Disconnected)
+	return info, nil
+}
+
+func sortDeviceIDs(devices []protocol.DeviceID) {
+	sort.Slice(devices, func(a, b int) bool {
+		return devices[a].Compare(devices[b]) < 0
+	})
+}
+
 func addSizeOfFile(s *db.Counts, f db.FileIntf) {
 	switch {
 	case f.IsDeleted():
@@ -977,6 +1193,47 @@ func (m *model) NeedFolderFiles(folder string, page, perpage int) ([]db.FileInfo
 	return progress, queued, rest
 }
 
+// NeedFolderFilesMatching returns the currently needed files whose names
+// match the glob pattern, skipping the first offset of them and returning
+// at most limit (all if limit is zero), together with the total number of
+// matching needed files. Patterns use forward slashes as separator
+// regardless of the platform, so "docs/**" matches everything below docs.
+func (m *model) NeedFolderFilesMatching(folder, pattern string, offset, limit int) ([]db.FileInfoTruncated, int, error) {
+	m.fmut.RLock()
+	rf, ok := m.folderFiles[folder]
+	cfg := m.folderCfgs[folder]
+	m.fmut.RUnlock()
+
+	if !ok {
+		return nil, 0, errFolderMissing
+	}
+	if offset < 0 || limit < 0 {
+		return nil, 0, fmt.Errorf("invalid offset %d or limit %d", offset, limit)
+	}
+	match, err := glob.Compile(pattern, '/')
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid pattern")
+	}
+
+	var files []db.FileInfoTruncated
+	total := 0
+	rf.WithFilteredNeedTruncated(protocol.LocalDeviceID, func(name string) bool {
+		return match.Match(filepath.ToSlash(name))
+	}, func(f db.FileIntf) bool {
+		if cfg.IgnoreDelete && f.IsDeleted() {
+			return true
+		}
+		// Keep going past the requested page to get the total.
+		if total >= offset && (limit == 0 || total < offset+limit) {
+			files = append(files, f.(db.FileInfoTruncated))
+		}
+		total++
+		return true
+	})
+
+	return files, total, nil
+}
+
 // LocalChangedFiles returns a paginated list of currently needed files in
 // progress, queued, and to be queued on next puller iteration, as well as the
 // total number of files currently needed.
@@ -989,7 +1246,7 @@ func (m *model) LocalChangedFiles(folder string, page, perpage int) []db.FileInf
 	if !ok {
 		return nil
 	}
-	if fcfg.Type != config.FolderTypeReceiveOnly {
+	if fcfg.Type != config.FolderTypeReceiveOnly && fcfg.Type != config.FolderTypeReceiveEncrypted {
 		return nil
 	}
 	if rf.ReceiveOnlyChangedSize().TotalItems() == 0 {
@@ -1048,6 +1305,38 @@ func (m *model) RemoteNeedFolderFiles(device protocol.DeviceID, folder string, p
 	return files, nil
 }
 
+// A ConflictFile is a conflict copy in a folder, together with the name of
+// the file it is a conflict copy of.
+type ConflictFile struct {
+	db.FileInfoTruncated
+	Original string `json:"original"`
+}
+
+// ConflictingFiles returns all conflict copies currently in the folder,
+// based on the local index rather than the filesystem.
+func (m *model) ConflictingFiles(folder string) ([]ConflictFile, error) {
+	m.fmut.RLock()
+	rf, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+
+	var files []ConflictFile
+	rf.WithHaveTruncated(protocol.LocalDeviceID, func(f db.FileIntf) bool {
+		if f.IsDeleted() || f.IsInvalid() || f.IsDirectory() || !isConflict(f.FileName()) {
+			return true
+		}
+		files = append(files, ConflictFile{
+			FileInfoTruncated: f.(db.FileInfoTruncated),
+			Original:          conflictOriginal(f.FileName()),
+		})
+		return true
+	})
+
+	return files, nil
+}
+
 // Index is called when a new device is connected and we receive their full index.
 // Implements the protocol.Model interface.
 func (m *model) Index(deviceID protocol.DeviceID, folder string, fs []protocol.FileInfo) error {
@@ -1095,6 +1384,12 @@ func (m *model) handleIndex(deviceID protocol.DeviceID, folder string, fs []prot
 	m.pmut.RUnlock()
 	downloads.Update(folder, makeForgetUpdate(fs))
 
+	// The index can't be stored while the database is read only. Failing
+	// gets us the same index again when reconnecting.
+	if err := backend.CheckWritable(m.db.Backend); err != nil {
+		return errors.Wrap(err, folder)
+	}
+
 	if !update {
 		files.Drop(deviceID)
 	}
@@ -1146,10 +1441,19 @@ func (m *model) ClusterConfig(deviceID protocol.DeviceID, cm protocol.ClusterCon
 	// Needs to happen outside of the fmut, as can cause CommitConfiguration
 	if deviceCfg.AutoAcceptFolders {
 		for _, folder := range cm.Folders {
+			if !deviceCfg.AutoAcceptsFolder(folder.ID, folder.Label) {
+				l.Debugf("Not auto-accepting folder %s from device %s, as it matches no pattern", folder.Description(), deviceID)
+				continue
+			}
 			changed = m.handleAutoAccepts(deviceCfg, folder) || changed
 		}
 	}
 
+	m.evLogger.Log(events.ClusterConfigReceived, map[string]interface{}{
+		"device":  deviceID.String(),
+		"folders": clusterConfigFolders(m.id, deviceCfg, m.cfg.Folders(), cm),
+	})
+
 	m.fmut.RLock()
 	var paused []string
 	for _, folder := range cm.Folders {
@@ -1284,8 +1588,9 @@ func (m *model) ClusterConfig(deviceID protocol.DeviceID, cm protocol.ClusterCon
 		conn, ok := m.conn[deviceID]
 		m.pmut.RUnlock()
 		// In case we've got ClusterConfig, and the connection disappeared
-		// from infront of our nose.
-		if ok {
+		// from infront of our nose. Peers that don't advertise support for
+		// temporary indexes aren't sent any download progress updates.
+		if ok && conn.HasCapability(protocol.CapabilityTempIndexes) {
 			m.progressEmitter.temporaryIndexSubscribe(conn, tempIndexFolders)
 		}
 	}
@@ -1502,6 +1807,19 @@ func (m *model) introduceDevice(device protocol.Device, introducerCfg config.Dev
 	return newDeviceCfg
 }
 
+// IntroducedDevices returns the devices that were added to the config by
+// the given introducer, sorted by device ID.
+func (m *model) IntroducedDevices(introducer protocol.DeviceID) []protocol.DeviceID {
+	var devices []protocol.DeviceID
+	for id, cfg := range m.cfg.Devices() {
+		if cfg.IntroducedBy == introducer {
+			devices = append(devices, id)
+		}
+	}
+	sortDeviceIDs(devices)
+	return devices
+}
+
 // Closed is called when a connection has been closed
 func (m *model) Closed(conn protocol.Connection, err error) {
 	device := conn.ID()
@@ -1514,9 +1832,18 @@ func (m *model) Closed(conn protocol.Connection, err error) {
 	}
 	delete(m.conn, device)
 	delete(m.connRequestLimiters, device)
+	delete(m.connReadAheads, device)
+	delete(m.connRateLimiters, device)
 	delete(m.helloMessages, device)
 	delete(m.deviceDownloads, device)
 	delete(m.remotePausedFolders, device)
+	// Older devices don't send a reason code, and a connection may be
+	// lost without a Close message at all.
+	if rce, ok := errors.Cause(err).(*protocol.RemoteCloseError); ok {
+		m.remoteCloseReasons[device] = *rce
+	} else {
+		m.remoteCloseReasons[device] = protocol.RemoteCloseError{Code: protocol.CloseReasonUnknown}
+	}
 	closed := m.closed[device]
 	delete(m.closed, device)
 	m.pmut.Unlock()
@@ -1550,6 +1877,36 @@ func (m *model) closeConns(devs []protocol.DeviceID, err error) config.Waiter {
 	return &channelWaiter{chans: closed}
 }
 
+// drainConns closes the connections to the given devices, after giving the
+// requests in flight on them up to the given timeout to be answered. With a
+// zero timeout nothing is drained.
+func (m *model) drainConns(devs []protocol.DeviceID, timeout time.Duration, err error) {
+	if timeout <= 0 {
+		return
+	}
+
+	conns := make([]connections.Connection, 0, len(devs))
+	m.pmut.RLock()
+	for _, dev := range devs {
+		if conn, ok := m.conn[dev]; ok {
+			conns = append(conns, conn)
+		}
+	}
+	m.pmut.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	wg := sync.NewWaitGroup()
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn connections.Connection) {
+			defer wg.Done()
+			conn.Drain(ctx, err)
+		}(conn)
+	}
+	wg.Wait()
+}
+
 // closeConn closes the underlying connection for the given device and returns
 // a waiter that will return once the connection is finished closing.
 func (m *model) closeConn(dev protocol.DeviceID, err error) config.Waiter {
@@ -1649,12 +2006,20 @@ func (m *model) Request(deviceID protocol.DeviceID, folder, name string, size in
 		return nil, protocol.ErrNoSuchFile
 	}
 
-	// Restrict parallel requests by connection/device
+	// Restrict the request rate and parallel requests by connection/device
 
 	m.pmut.RLock()
+	rateLimiter := m.connRateLimiters[deviceID]
 	limiter := m.connRequestLimiters[deviceID]
+	readAhead := m.connReadAheads[deviceID]
 	m.pmut.RUnlock()
 
+	if rateLimiter != nil && !rateLimiter.Allow() {
+		// The other side retries failed blocks later on.
+		l.Debugf("%v REQ(in) rate limited: %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
+		return nil, protocol.ErrGeneric
+	}
+
 	if limiter != nil {
 		limiter.take(int(size))
 	}
@@ -1687,7 +2052,7 @@ func (m *model) Request(deviceID protocol.DeviceID, folder, name string, size in
 			return nil, protocol.ErrNoSuchFile
 		}
 		err := readOffsetIntoBuf(folderFs, tempFn, offset, res.data)
-		if err == nil && scanner.Validate(res.data, hash, weakHash) {
+		if err == nil && validateBlock(folderCfg, res.data, hash, weakHash) {
 			return res, nil
 		}
 		// Fall through to reading from a non-temp file, just incase the temp
@@ -1701,7 +2066,13 @@ func (m *model) Request(deviceID protocol.DeviceID, folder, name string, size in
 		return nil, protocol.ErrNoSuchFile
 	}
 
-	if err := readOffsetIntoBuf(folderFs, name, offset, res.data); fs.IsNotExist(err) {
+	buffered := false
+	if readAhead != nil {
+		buffered, err = readAhead.read(folderFs, folder, name, offset, res.data)
+	} else {
+		err = readOffsetIntoBuf(folderFs, name, offset, res.data)
+	}
+	if fs.IsNotExist(err) {
 		l.Debugf("%v REQ(in) file doesn't exist: %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
 		return nil, protocol.ErrNoSuchFile
 	} else if err != nil {
@@ -1709,7 +2080,17 @@ func (m *model) Request(deviceID protocol.DeviceID, folder, name string, size in
 		return nil, protocol.ErrGeneric
 	}
 
-	if !scanner.Validate(res.data, hash, weakHash) {
+	if buffered && !validateBlock(folderCfg, res.data, hash, weakHash) {
+		// The file might have changed since it was read ahead, so try
+		// again reading it directly.
+		readAhead.evict()
+		if err := readOffsetIntoBuf(folderFs, name, offset, res.data); err != nil {
+			l.Debugf("%v REQ(in) failed reading file (%v): %s: %q / %q o=%d s=%d", m, err, deviceID, folder, name, offset, size)
+			return nil, protocol.ErrGeneric
+		}
+	}
+
+	if !validateBlock(folderCfg, res.data, hash, weakHash) {
 		m.recheckFile(deviceID, folderFs, folder, name, size, offset, hash)
 		l.Debugf("%v REQ(in) failed validating data (%v): %s: %q / %q o=%d s=%d", m, err, deviceID, folder, name, offset, size)
 		return nil, protocol.ErrNoSuchFile
@@ -1718,6 +2099,16 @@ func (m *model) Request(deviceID protocol.DeviceID, folder, name string, size in
 	return res, nil
 }
 
+// validateBlock checks that the data read from disk matches the hashes it
+// was requested with. Receive encrypted folders hold data as sent by the
+// trusted devices, with encrypted hashes that are checked without the key.
+func validateBlock(folderCfg config.FolderConfiguration, buf, hash []byte, weakHash uint32) bool {
+	if folderCfg.Type == config.FolderTypeReceiveEncrypted {
+		return len(hash) == 0 || protocol.VerifyEncryptedBlock(buf, hash) == nil
+	}
+	return scanner.Validate(buf, hash, weakHash)
+}
+
 func (m *model) recheckFile(deviceID protocol.DeviceID, folderFs fs.Filesystem, folder, name string, size int32, offset int64, hash []byte) {
 	cf, ok := m.CurrentFolderFile(folder, name)
 	if !ok {
@@ -1762,6 +2153,132 @@ func (m *model) recheckFile(deviceID protocol.DeviceID, folderFs fs.Filesystem,
 	l.Debugf("%v recheckFile: %s: %q / %q", m, deviceID, folder, name)
 }
 
+// RangeRequest serves size bytes of the file at offset, which needn't be
+// aligned to blocks. The data is read directly from the file, reading all
+// the blocks the range overlaps to validate them against the hashes in the
+// database. Ranges reaching past the end of the file are invalid.
+func (m *model) RangeRequest(deviceID protocol.DeviceID, folder, name string, size int32, offset int64) (out protocol.RequestResponse, err error) {
+	if size <= 0 || size > protocol.MaxBlockSize || offset < 0 {
+		return nil, protocol.ErrInvalid
+	}
+
+	m.fmut.RLock()
+	folderCfg, ok := m.folderCfgs[folder]
+	folderIgnores := m.folderIgnores[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		l.Debugf("Range request from %s for file %s in unstarted folder %q", deviceID, name, folder)
+		return nil, protocol.ErrGeneric
+	}
+
+	if !folderCfg.SharedWith(deviceID) {
+		l.Warnf("Range request from %s for file %s in unshared folder %q", deviceID, name, folder)
+		return nil, protocol.ErrGeneric
+	}
+	if folderCfg.Paused {
+		l.Debugf("Range request from %s for file %s in paused folder %q", deviceID, name, folder)
+		return nil, protocol.ErrGeneric
+	}
+
+	if name, err = fs.Canonicalize(name); err != nil {
+		l.Debugf("Range request from %s in folder %q for invalid filename %s", deviceID, folder, name)
+		return nil, protocol.ErrGeneric
+	}
+
+	l.Debugf("%v RANGEREQ(in): %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
+
+	if fs.IsInternal(name) || folderIgnores.Match(name).IsIgnored() {
+		l.Debugf("%v RANGEREQ(in) for internal or ignored file: %s: %q / %q", m, deviceID, folder, name)
+		return nil, protocol.ErrInvalid
+	}
+
+	folderFs := folderCfg.Filesystem()
+
+	if err := osutil.TraversesSymlink(folderFs, filepath.Dir(name)); err != nil {
+		l.Debugf("%v RANGEREQ(in) traversal check: %s - %s: %q / %q", m, err, deviceID, folder, name)
+		return nil, protocol.ErrNoSuchFile
+	}
+
+	// The blocks to validate against come from our view of the file.
+	cf, ok := m.CurrentFolderFile(folder, name)
+	if !ok || cf.IsDeleted() || cf.IsInvalid() || cf.Type != protocol.FileInfoTypeFile {
+		l.Debugf("%v RANGEREQ(in) no such file: %s: %q / %q", m, deviceID, folder, name)
+		return nil, protocol.ErrNoSuchFile
+	}
+	end := offset + int64(size)
+	if end > cf.Size {
+		l.Debugf("%v RANGEREQ(in) past end of file (%d): %s: %q / %q o=%d s=%d", m, cf.Size, deviceID, folder, name, offset, size)
+		return nil, protocol.ErrInvalid
+	}
+
+	m.pmut.RLock()
+	rateLimiter := m.connRateLimiters[deviceID]
+	limiter := m.connRequestLimiters[deviceID]
+	m.pmut.RUnlock()
+
+	if rateLimiter != nil && !rateLimiter.Allow() {
+		l.Debugf("%v RANGEREQ(in) rate limited: %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
+		return nil, protocol.ErrGeneric
+	}
+
+	if limiter != nil {
+		limiter.take(int(size))
+	}
+
+	res := newRequestResponse(int(size))
+	defer func() {
+		if err != nil {
+			res.Close()
+		}
+	}()
+
+	if limiter != nil {
+		go func() {
+			res.Wait()
+			limiter.give(int(size))
+		}()
+	}
+
+	if info, err := folderFs.Lstat(name); err != nil || !info.IsRegular() {
+		l.Debugf("%v RANGEREQ(in) failed stating file (%v): %s: %q / %q", m, err, deviceID, folder, name)
+		return nil, protocol.ErrNoSuchFile
+	}
+
+	blockBuf := protocol.BufferPool.Get(cf.BlockSize())
+	defer protocol.BufferPool.Put(blockBuf)
+	for _, block := range cf.Blocks {
+		blockEnd := block.Offset + int64(block.Size)
+		if blockEnd <= offset || block.Offset >= end {
+			continue
+		}
+
+		buf := blockBuf[:block.Size]
+		if err := readOffsetIntoBuf(folderFs, name, block.Offset, buf); fs.IsNotExist(err) {
+			return nil, protocol.ErrNoSuchFile
+		} else if err != nil {
+			l.Debugf("%v RANGEREQ(in) failed reading file (%v): %s: %q / %q", m, err, deviceID, folder, name)
+			return nil, protocol.ErrGeneric
+		}
+		if !validateBlock(folderCfg, buf, block.Hash, block.WeakHash) {
+			m.recheckFile(deviceID, folderFs, folder, name, block.Size, block.Offset, block.Hash)
+			l.Debugf("%v RANGEREQ(in) failed validating block at %d: %s: %q / %q", m, block.Offset, deviceID, folder, name)
+			return nil, protocol.ErrNoSuchFile
+		}
+
+		// Copy the part of the block that is within the range.
+		from, to := int64(0), int64(block.Size)
+		if block.Offset < offset {
+			from = offset - block.Offset
+		}
+		if blockEnd > end {
+			to = end - block.Offset
+		}
+		copy(res.data[block.Offset+from-offset:], buf[from:to])
+	}
+
+	return res, nil
+}
+
 func (m *model) CurrentFolderFile(folder string, file string) (protocol.FileInfo, bool) {
 	m.fmut.RLock()
 	fs, ok := m.folderFiles[folder]
@@ -1782,6 +2299,30 @@ func (m *model) CurrentGlobalFile(folder string, file string) (protocol.FileInfo
 	return fs.GetGlobal(file)
 }
 
+// OpenRemoteFile returns a reader for the global version of the file, which
+// fetches its contents from the devices that have it as they are read.
+func (m *model) OpenRemoteFile(folder, file string) (ReadSeekCloser, error) {
+	m.fmut.RLock()
+	_, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+
+	file, err := fs.Canonicalize(file)
+	if err != nil {
+		return nil, err
+	}
+	gf, ok := m.CurrentGlobalFile(folder, file)
+	if !ok || gf.IsDeleted() || gf.IsInvalid() {
+		return nil, errors.Wrap(errNoSuchFile, file)
+	}
+	if gf.Type != protocol.FileInfoTypeFile {
+		return nil, errors.Wrap(errNotRegularFile, file)
+	}
+	return newRemoteFile(m, folder, gf), nil
+}
+
 // Connection returns the current connection for device, and a boolean whether a connection was found.
 func (m *model) Connection(deviceID protocol.DeviceID) (connections.Connection, bool) {
 	m.pmut.RLock()
@@ -1812,7 +2353,7 @@ func (m *model) GetIgnores(folder string) ([]string, []string, error) {
 	}
 
 	if !ignoresOk {
-		ignores = ignore.New(fs.NewFilesystem(cfg.FilesystemType, cfg.Path))
+		ignores = ignore.New(fs.NewFilesystem(cfg.FilesystemType, cfg.Path), ignore.WithAllowlist(cfg.IgnoreMode == config.IgnoreModeAllowlist))
 	}
 
 	if err := ignores.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
@@ -1853,6 +2394,26 @@ func (m *model) SetIgnores(folder string, content []string) error {
 	return nil
 }
 
+// MatchIgnore returns whether the path is ignored by the folder's current
+// ignore patterns, and the pattern line that decided it. The line is empty
+// if no pattern matched.
+func (m *model) MatchIgnore(folder, path string) (bool, string, error) {
+	m.fmut.RLock()
+	ignores, ok := m.folderIgnores[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return false, "", errFolderMissing
+	}
+
+	path, err := fs.Canonicalize(path)
+	if err != nil {
+		return false, "", err
+	}
+
+	res, line := ignores.MatchLine(path)
+	return res.IsIgnored(), line, nil
+}
+
 // OnHello is called when an device connects to us.
 // This allows us to extract some information from the Hello message
 // and add it to a list of known devices ahead of any checks.
@@ -1896,6 +2457,7 @@ func (m *model) GetHello(id protocol.DeviceID) protocol.HelloIntf {
 		DeviceName:    name,
 		ClientName:    m.clientName,
 		ClientVersion: m.clientVersion,
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
 	}
 }
 
@@ -1911,7 +2473,8 @@ func (m *model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	}
 
 	m.pmut.Lock()
-	if oldConn, ok := m.conn[deviceID]; ok {
+	oldConn, replacing := m.conn[deviceID]
+	if replacing {
 		l.Infoln("Replacing old connection", oldConn, "with", conn, "for", deviceID)
 		// There is an existing connection to this device that we are
 		// replacing. We must close the existing connection and wait for the
@@ -1928,6 +2491,7 @@ func (m *model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	m.conn[deviceID] = conn
 	m.closed[deviceID] = make(chan struct{})
 	m.deviceDownloads[deviceID] = newDeviceDownloadState()
+	m.connReadAheads[deviceID] = newReadAhead(readAheadSize)
 	// 0: default, <0: no limiting
 	switch {
 	case device.MaxRequestKiB > 0:
@@ -1935,6 +2499,14 @@ func (m *model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	case device.MaxRequestKiB == 0:
 		m.connRequestLimiters[deviceID] = newByteSemaphore(1024 * defaultPullerPendingKiB)
 	}
+	// 0: global default, <0: no limiting
+	reqRate := device.MaxRequestsPerSecond
+	if reqRate == 0 {
+		reqRate = m.cfg.Options().MaxRequestsPerSecond
+	}
+	if reqRate > 0 {
+		m.connRateLimiters[deviceID] = rate.NewLimiter(rate.Limit(reqRate), reqRate)
+	}
 
 	m.helloMessages[deviceID] = hello
 
@@ -1962,6 +2534,10 @@ func (m *model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	cm := m.generateClusterConfig(deviceID)
 	conn.ClusterConfig(cm)
 
+	if !replacing {
+		m.scanOnConnect(deviceID)
+	}
+
 	if (device.Name == "" || m.cfg.Options().OverwriteRemoteDevNames) && hello.DeviceName != "" {
 		device.Name = hello.DeviceName
 		m.cfg.SetDevice(device)
@@ -1971,6 +2547,70 @@ func (m *model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	m.deviceWasSeen(deviceID)
 }
 
+// scanOnConnect schedules a scan of the folders shared with the given,
+// newly connected device that have ScanOnConnect enabled.
+func (m *model) scanOnConnect(deviceID protocol.DeviceID) {
+	m.fmut.RLock()
+	defer m.fmut.RUnlock()
+	for folder, cfg := range m.folderCfgs {
+		if !cfg.ScanOnConnect || !cfg.SharedWith(deviceID) {
+			continue
+		}
+		if runner, ok := m.folderRunners[folder]; ok {
+			runner.scheduleScanOnConnect()
+		}
+	}
+}
+
+// MetadataRequest returns the files and directories directly in the given
+// directory of the folder, for the device to browse without pulling the
+// whole index. They are as announced in index messages, but without blocks.
+func (m *model) MetadataRequest(deviceID protocol.DeviceID, folder, prefix string) ([]protocol.FileInfo, error) {
+	m.fmut.RLock()
+	folderCfg, ok := m.folderCfgs[folder]
+	rf := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		l.Debugf("Metadata request from %s for unstarted folder %q", deviceID, folder)
+		return nil, protocol.ErrGeneric
+	}
+	if !folderCfg.SharedWith(deviceID) {
+		l.Warnf("Metadata request from %s for unshared folder %q", deviceID, folder)
+		return nil, protocol.ErrGeneric
+	}
+	if folderCfg.Paused {
+		l.Debugf("Metadata request from %s for paused folder %q", deviceID, folder)
+		return nil, protocol.ErrGeneric
+	}
+
+	dir := "."
+	if prefix != "" {
+		var err error
+		if dir, err = fs.Canonicalize(prefix); err != nil {
+			l.Debugf("Metadata request from %s in folder %q for invalid prefix %s", deviceID, folder, prefix)
+			return nil, protocol.ErrGeneric
+		}
+		prefix = dir
+	}
+
+	var files []protocol.FileInfo
+	rf.WithPrefixedHaveTruncated(protocol.LocalDeviceID, prefix, func(fi db.FileIntf) bool {
+		if filepath.Dir(fi.FileName()) != dir {
+			// Deeper down, or the prefix itself.
+			return true
+		}
+		f := fi.(db.FileInfoTruncated).ConvertToBlocklessFileInfo()
+		f.RawInvalid = f.IsInvalid()
+		if f.IsReceiveOnlyChanged() {
+			f.Version = protocol.Vector{}
+		}
+		f.LocalFlags = 0
+		files = append(files, f)
+		return true
+	})
+	return files, nil
+}
+
 func (m *model) DownloadProgress(device protocol.DeviceID, folder string, updates []protocol.FileDownloadProgressUpdate) error {
 	m.fmut.RLock()
 	cfg, ok := m.folderCfgs[folder]
@@ -2196,6 +2836,9 @@ func (m *model) ScanFolder(folder string) error {
 	return m.ScanFolderSubdirs(folder, nil)
 }
 
+// ScanFolderSubdirs scans the given subdirectories of the folder, or the
+// entire folder if none are given. Subdirectories must be relative to and
+// within the folder root; overlapping entries are merged before scanning.
 func (m *model) ScanFolderSubdirs(folder string, subs []string) error {
 	m.fmut.RLock()
 	err := m.checkFolderRunningLocked(folder)
@@ -2206,9 +2849,38 @@ func (m *model) ScanFolderSubdirs(folder string, subs []string) error {
 		return err
 	}
 
+	for _, sub := range subs {
+		if _, err := fs.Canonicalize(sub); err != nil {
+			return errors.Wrapf(err, "subdirectory %q", sub)
+		}
+	}
+
 	return runner.Scan(subs)
 }
 
+// AddProgressObserver registers an observer to be called with scan and pull
+// progress, in addition to the progress events.
+func (m *model) AddProgressObserver(observer ProgressObserver) {
+	m.progressEmitter.observers.add(observer)
+}
+
+// ScanFolderMetadataOnly checks the folder for changes by size,
+// modification time and permissions only, without reading any file
+// contents. Changed files are flagged to be hashed by the next normal scan.
+// This is faster but misses changes that leave the metadata untouched.
+func (m *model) ScanFolderMetadataOnly(folder string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return runner.ScanMetadataOnly()
+}
+
 func (m *model) DelayScan(folder string, next time.Duration) {
 	m.fmut.RLock()
 	runner, ok := m.folderRunners[folder]
@@ -2304,6 +2976,18 @@ func (m *model) generateClusterConfig(device protocol.DeviceID) protocol.Cluster
 		message.Folders = append(message.Folders, protocolFolder)
 	}
 
+	message.Capabilities = protocol.LocalCapabilities
+
+	// 0: default, <0: no limiting
+	if devCfg, ok := m.cfg.Device(device); ok {
+		switch {
+		case devCfg.MaxConcurrentRequests > 0:
+			message.MaxConcurrentRequests = int32(devCfg.MaxConcurrentRequests)
+		case devCfg.MaxConcurrentRequests == 0:
+			message.MaxConcurrentRequests = defaultMaxConcurrentRequests
+		}
+	}
+
 	return message
 }
 
@@ -2321,15 +3005,44 @@ func (m *model) State(folder string) (string, time.Time, error) {
 	return state.String(), changed, err
 }
 
-func (m *model) FolderErrors(folder string) ([]FileError, error) {
+// FolderErrors returns at most limit errors of the folder, starting at
+// offset, together with the total number of errors. A limit of zero or less
+// returns all errors from the offset on.
+func (m *model) FolderErrors(folder string, offset, limit int) ([]FileError, int, error) {
 	m.fmut.RLock()
 	err := m.checkFolderRunningLocked(folder)
 	runner := m.folderRunners[folder]
 	m.fmut.RUnlock()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	errs := runner.Errors()
+	total := len(errs)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return nil, total, nil
 	}
-	return runner.Errors(), nil
+	errs = errs[offset:]
+	if limit > 0 && limit < len(errs) {
+		errs = errs[:limit]
+	}
+	return errs, total, nil
+}
+
+// ClearFolderError drops the error for the given item, e.g. after the
+// cause has been fixed, and retries the item.
+func (m *model) ClearFolderError(folder, path string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return err
+	}
+	return runner.ClearError(path)
 }
 
 func (m *model) WatchError(folder string) error {
@@ -2358,6 +3071,71 @@ func (m *model) Override(folder string) {
 	runner.Override()
 }
 
+// OverrideSubpaths is like Override, restricted to the items at or below the
+// given paths in the folder.
+func (m *model) OverrideSubpaths(folder string, subs []string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	r, ok := runner.(interface{ override(subs []string) })
+	if !ok {
+		return errFolderNotSendOnly
+	}
+
+	canonical, err := canonicalSubpaths(subs)
+	if err != nil || len(canonical) == 0 {
+		// Nothing to do rather than the whole folder if there are no paths.
+		return err
+	}
+
+	r.override(canonical)
+	return nil
+}
+
+// RevertSubpaths is like Revert, restricted to the items at or below the
+// given paths in the folder.
+func (m *model) RevertSubpaths(folder string, subs []string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	r, ok := runner.(interface{ revert(subs []string) })
+	if !ok {
+		return errFolderNotReceiveOnly
+	}
+
+	canonical, err := canonicalSubpaths(subs)
+	if err != nil || len(canonical) == 0 {
+		// Nothing to do rather than the whole folder if there are no paths.
+		return err
+	}
+
+	r.revert(canonical)
+	return nil
+}
+
+// canonicalSubpaths validates that the paths are within the folder and
+// returns them in canonical form.
+func canonicalSubpaths(subs []string) ([]string, error) {
+	canonical := make([]string, len(subs))
+	for i, sub := range subs {
+		var err error
+		if canonical[i], err = fs.Canonicalize(sub); err != nil {
+			return nil, errors.Wrap(err, sub)
+		}
+	}
+	return canonical, nil
+}
+
 func (m *model) Revert(folder string) {
 	// Grab the runner and the file set.
 
@@ -2412,6 +3190,18 @@ func (m *model) RemoteSequence(folder string) (int64, bool) {
 	return ver, true
 }
 
+// SnapshotDatabase writes a consistent copy of the database to a new
+// database at location, without holding up syncing.
+func (m *model) SnapshotDatabase(location string) error {
+	return m.db.WriteSnapshot(location)
+}
+
+// DatabaseOpen returns whether the database is usable, i.e. hasn't been
+// closed.
+func (m *model) DatabaseOpen() bool {
+	return m.db.IsOpen()
+}
+
 func (m *model) GlobalDirectoryTree(folder, prefix string, levels int, dirsonly bool) []*DirectoryTree {
 	m.fmut.RLock()
 	files, ok := m.folderFiles[folder]
@@ -2516,6 +3306,122 @@ func (m *model) RestoreFolderVersions(folder string, versions map[string]time.Ti
 	return restoreErrors, nil
 }
 
+// RestoreFolderVersionTo restores a version of the file to another path
+// in the folder, leaving the current file as it is.
+func (m *model) RestoreFolderVersionTo(folder, file string, version time.Time, dest string) error {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return errFolderMissing
+	}
+
+	m.fmut.RLock()
+	ver, ok := m.folderVersioners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return errFolderMissing
+	}
+	if ver == nil {
+		return errNoVersioner
+	}
+
+	if err := ver.RestoreTo(file, version, dest); err != nil {
+		return err
+	}
+
+	// Trigger scan
+	if !fcfg.FSWatcherEnabled {
+		go func() { _ = m.ScanFolderSubdirs(folder, []string{dest}) }()
+	}
+
+	return nil
+}
+
+// FolderVersionsCleanupDryRun returns the versions that the next cleanup of
+// the folder's versioner would remove, without removing them.
+func (m *model) FolderVersionsCleanupDryRun(folder string) ([]string, error) {
+	m.fmut.RLock()
+	ver, ok := m.folderVersioners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+	if ver == nil {
+		return nil, errNoVersioner
+	}
+
+	dr, ok := ver.(versioner.CleanupDryRunner)
+	if !ok {
+		return nil, errNoCleanupDryRun
+	}
+	return dr.CleanupDryRun()
+}
+
+// RevertToGlobal discards the local version of the file and schedules a
+// pull of the global version from the other devices in its place.
+func (m *model) RevertToGlobal(folder, file string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	file, err = fs.Canonicalize(file)
+	if err != nil {
+		return err
+	}
+
+	r, ok := runner.(interface{ revertToGlobal(string) error })
+	if !ok {
+		return errFolderNotPulling
+	}
+	return r.revertToGlobal(file)
+}
+
+// CreateFolderMarker creates the marker of a folder whose marker is missing
+// and clears the resulting folder error. This is for when the user has made
+// sure the folder path is the intended one, as a missing marker usually
+// means that the folder path isn't mounted.
+func (m *model) CreateFolderMarker(folder string) error {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	cfg := m.folderCfgs[folder]
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.CreateMarker(); err != nil {
+		return err
+	}
+	if err := runner.CheckHealth(); err != nil {
+		return err
+	}
+
+	go func() { _ = m.ScanFolder(folder) }()
+	return nil
+}
+
+// DryRunPull returns the changes the next pull would make to the folder,
+// without making them.
+func (m *model) DryRunPull(folder string) ([]PullAction, error) {
+	m.fmut.RLock()
+	err := m.checkFolderRunningLocked(folder)
+	runner := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	dr, ok := runner.(interface{ dryRunPull() []PullAction })
+	if !ok {
+		return nil, errFolderNotPulling
+	}
+	return dr.dryRunPull(), nil
+}
+
 func (m *model) Availability(folder string, file protocol.FileInfo, block protocol.BlockInfo) []Availability {
 	// The slightly unusual locking sequence here is because we need to hold
 	// pmut for the duration (as the value returned from foldersFiles can
@@ -2556,6 +3462,56 @@ next:
 	return availabilities
 }
 
+// GlobalAvailability returns the devices, including ourselves, that have
+// the global version of the given file according to the index, regardless
+// of whether they are currently connected. The returned list is empty if no
+// device has a valid copy of the global version, and the error is
+// protocol.ErrNoSuchFile if the file isn't in the index at all.
+func (m *model) GlobalAvailability(folder, file string) ([]protocol.DeviceID, error) {
+	m.fmut.RLock()
+	fs, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+
+	if _, ok := fs.GetGlobal(file); !ok {
+		return nil, protocol.ErrNoSuchFile
+	}
+
+	devices := fs.Availability(file)
+	for i, dev := range devices {
+		if dev == protocol.LocalDeviceID {
+			devices[i] = m.id
+		}
+	}
+	sortDeviceIDs(devices)
+	return devices, nil
+}
+
+// FileHistory returns the latest changes of the version of the file, oldest
+// first, if the folder tracks them.
+func (m *model) FileHistory(folder, file string) ([]db.VersionEvent, error) {
+	m.fmut.RLock()
+	fs, ok := m.folderFiles[folder]
+	cfg := m.folderCfgs[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+	if !cfg.TrackVersionHistory {
+		return nil, errNoVersionHistory
+	}
+
+	hist := fs.VersionHistory(file)
+	for i := range hist {
+		if hist[i].Device == protocol.LocalDeviceID {
+			hist[i].Device = m.id
+		}
+	}
+	return hist, nil
+}
+
 // BringToFront bumps the given files priority in the job queue.
 func (m *model) BringToFront(folder, file string) {
 	m.fmut.RLock()
@@ -2567,6 +3523,24 @@ func (m *model) BringToFront(folder, file string) {
 	}
 }
 
+// PrioritizeFile makes the given file be pulled before anything else in
+// the folder until it's done, starting a pull if there is none in
+// progress.
+func (m *model) PrioritizeFile(folder, file string) error {
+	m.fmut.RLock()
+	runner, ok := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return errFolderMissing
+	}
+
+	file, err := fs.Canonicalize(file)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(runner.Prioritize(file), file)
+}
+
 func (m *model) ResetFolder(folder string) {
 	l.Infof("Cleaning data for folder %q", folder)
 	db.DropFolder(m.db, folder)
@@ -2583,6 +3557,15 @@ func (m *model) VerifyConfiguration(from, to config.Configuration) error {
 func (m *model) CommitConfiguration(from, to config.Configuration) bool {
 	// TODO: This should not use reflect, and should take more care to try to handle stuff without restart.
 
+	// Close connections to removed devices first, so they learn why,
+	// instead of seeing the folders shared with them change.
+	toDevices := to.DeviceMap()
+	for _, dev := range from.Devices {
+		if _, ok := toDevices[dev.DeviceID]; !ok {
+			m.closeConn(dev.DeviceID, errDeviceRemoved)
+		}
+	}
+
 	// Go through the folder configs and figure out if we need to restart or not.
 
 	fromFolders := mapFolders(from.Folders)
@@ -2615,6 +3598,15 @@ func (m *model) CommitConfiguration(from, to config.Configuration) bool {
 		// Check if anything differs that requires a restart.
 		if !reflect.DeepEqual(fromCfg.RequiresRestartOnly(), toCfg.RequiresRestartOnly()) {
 			m.restartFolder(fromCfg, toCfg)
+		} else {
+			m.fmut.Lock()
+			// Settings like the verification ones are read from here.
+			m.folderCfgs[folderID] = toCfg
+			runner, ok := m.folderRunners[folderID]
+			m.fmut.Unlock()
+			if ok {
+				runner.applyConfig(toCfg)
+			}
 		}
 
 		// Emit the folder pause/resume event
@@ -2627,16 +3619,15 @@ func (m *model) CommitConfiguration(from, to config.Configuration) bool {
 		}
 	}
 
-	// Removing a device. We actually don't need to do anything.
-	// Because folder config has changed (since the device lists do not match)
-	// Folders for that had device got "restarted", which involves killing
-	// connections to all devices that we were sharing the folder with.
-	// At some point model.Close() will get called for that device which will
-	// clean residue device state that is not part of any folder.
+	// Removing a device. The connection to it was closed above, with the
+	// reason that it was removed. Folders that had the device got
+	// "restarted", which involves killing connections to all devices that
+	// we were sharing the folder with. At some point model.Close() will get
+	// called for that device which will clean residue device state that is
+	// not part of any folder.
 
 	// Pausing a device, unpausing is handled by the connection service.
 	fromDevices := from.DeviceMap()
-	toDevices := to.DeviceMap()
 	for deviceID, toCfg := range toDevices {
 		fromCfg, ok := fromDevices[deviceID]
 		if !ok {
@@ -2647,6 +3638,11 @@ func (m *model) CommitConfiguration(from, to config.Configuration) bool {
 			continue
 		}
 		delete(fromDevices, deviceID)
+		// The connection is wrapped for encryption when it's established,
+		// reconnect to apply a changed trust setting.
+		if fromCfg.Untrusted != toCfg.Untrusted {
+			m.closeConn(deviceID, errDeviceTrustChanged)
+		}
 		if fromCfg.Paused == toCfg.Paused {
 			continue
 		}
@@ -2669,8 +3665,13 @@ func (m *model) CommitConfiguration(from, to config.Configuration) bool {
 		delete(m.deviceStatRefs, deviceID)
 	}
 	m.fmut.Unlock()
+	m.pmut.Lock()
+	for deviceID := range fromDevices {
+		delete(m.connAttempts, deviceID)
+	}
+	m.pmut.Unlock()
 
-	scanLimiter.setCapacity(to.Options.MaxConcurrentScans)
+	m.scanLimiter.setCapacity(to.Options.MaxConcurrentScans)
 
 	// Some options don't require restart as those components handle it fine
 	// by themselves. Compare the options structs containing only the
@@ -13,9 +13,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
@@ -25,7 +27,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/connections"
 	"github.com/syncthing/syncthing/lib/db"
 	"github.com/syncthing/syncthing/lib/db/backend"
 	"github.com/syncthing/syncthing/lib/events"
@@ -129,6 +134,47 @@ func newState(cfg config.Configuration) *model {
 	return m
 }
 
+func TestRequestRateLimit(t *testing.T) {
+	w := createTmpWrapper(defaultCfgWrapper.RawCopy())
+	opts := w.Options()
+	opts.MaxRequestsPerSecond = 5
+	w.SetOptions(opts)
+	dev2Cfg := config.NewDeviceConfiguration(device2, "device2")
+	dev2Cfg.MaxRequestsPerSecond = -1
+	w.SetDevice(dev2Cfg)
+	fcfg := w.FolderList()[0]
+	fcfg.Devices = append(fcfg.Devices, config.FolderDeviceConfiguration{DeviceID: device2})
+	w.SetFolder(fcfg)
+
+	m := setupModel(w)
+	defer cleanupModel(m)
+	m.AddConnection(&fakeConnection{id: device1, model: m}, protocol.HelloResult{})
+	m.AddConnection(&fakeConnection{id: device2, model: m}, protocol.HelloResult{})
+
+	request := func(dev protocol.DeviceID) error {
+		res, err := m.Request(dev, "default", "foo", 6, 0, nil, 0, false)
+		if err == nil {
+			res.Close()
+		}
+		return err
+	}
+
+	// The burst for device1 is limited by the global option, device2
+	// overrides it to be unlimited.
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if err := request(device1); err != nil {
+			failed++
+		}
+		if err := request(device2); err != nil {
+			t.Fatal("Unexpected error for unlimited device:", err)
+		}
+	}
+	if failed == 0 {
+		t.Error("Expected requests from device1 to be rate limited")
+	}
+}
+
 func TestRequest(t *testing.T) {
 	m := setupModel(defaultCfgWrapper)
 	defer cleanupModel(m)
@@ -1099,6 +1145,56 @@ func TestAutoAcceptMultipleFolders(t *testing.T) {
 	}
 }
 
+func TestAutoAcceptFolderPatterns(t *testing.T) {
+	// Only folders matching a pattern by ID or label are accepted
+	matchingID := "shared-" + srand.String(8)
+	defer os.RemoveAll(matchingID)
+	matchingLabel := "photos-" + srand.String(8)
+	defer os.RemoveAll(matchingLabel)
+	other := srand.String(8)
+	defer os.RemoveAll(other)
+	tcfg := defaultAutoAcceptCfg.Copy()
+	for i := range tcfg.Devices {
+		tcfg.Devices[i].AutoAcceptFolderPatterns = []string{"shared-*", "photos-*"}
+	}
+	m := newState(tcfg)
+	defer cleanupModel(m)
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID:    matchingID,
+				Label: matchingID,
+			},
+			{
+				ID:    srand.String(8),
+				Label: matchingLabel,
+			},
+			{
+				ID:    other,
+				Label: other,
+			},
+		},
+	})
+	if fcfg, ok := m.cfg.Folder(matchingID); !ok || !fcfg.SharedWith(device1) {
+		t.Error("expected shared", matchingID)
+	}
+	found := false
+	for _, fcfg := range m.cfg.Folders() {
+		if fcfg.Label == matchingLabel {
+			found = fcfg.SharedWith(device1)
+		}
+	}
+	if !found {
+		t.Error("expected shared", matchingLabel)
+	}
+	if fcfg, ok := m.cfg.Folder(other); ok && fcfg.SharedWith(device1) {
+		t.Error("unexpected shared", other)
+	}
+	if dev, _ := m.cfg.Device(device1); len(dev.PendingFolders) != 1 || dev.PendingFolders[0].ID != other {
+		t.Error("expected pending", other)
+	}
+}
+
 func TestAutoAcceptExistingFolder(t *testing.T) {
 	// Existing folder
 	id := srand.String(8)
@@ -1679,6 +1775,132 @@ func TestRWScanRecovery(t *testing.T) {
 	waitForState(t, sub, "default", "folder path missing")
 }
 
+func TestCreateFolderMarker(t *testing.T) {
+	testOs := &fatalOs{t}
+
+	// A folder with files in the index, as a blank one gets its marker
+	// created on startup.
+	ldb := db.NewLowlevel(backend.OpenMemory())
+	set := db.NewFileSet("default", defaultFs, ldb)
+	set.Update(protocol.LocalDeviceID, []protocol.FileInfo{
+		{Name: "dummyfile", Version: protocol.Vector{Counters: []protocol.Counter{{ID: 42, Value: 1}}}},
+	})
+
+	fcfg := config.FolderConfiguration{
+		ID:              "default",
+		Path:            "markertestfolder",
+		Type:            config.FolderTypeSendReceive,
+		RescanIntervalS: 1,
+		MarkerName:      config.DefaultMarkerName,
+	}
+	cfg := createTmpWrapper(config.Configuration{
+		Folders: []config.FolderConfiguration{fcfg},
+		Devices: []config.DeviceConfiguration{
+			{
+				DeviceID: device1,
+			},
+		},
+	})
+
+	testOs.RemoveAll(fcfg.Path)
+	testOs.Mkdir(fcfg.Path, 0700)
+	defer testOs.RemoveAll(fcfg.Path)
+
+	m := newModel(cfg, myID, "syncthing", "dev", ldb, nil)
+	sub := m.evLogger.Subscribe(events.StateChanged)
+	defer sub.Unsubscribe()
+	m.ServeBackground()
+	defer cleanupModel(m)
+
+	waitForState(t, sub, "default", config.ErrMarkerMissing.Error())
+
+	if state, _, err := m.State("default"); state != "marker-missing" || err != config.ErrMarkerMissing {
+		t.Fatalf("Expected marker-missing state, got %v (%v)", state, err)
+	}
+
+	if err := m.CreateFolderMarker("default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(fcfg.Path, config.DefaultMarkerName)); err != nil {
+		t.Error("Marker wasn't created:", err)
+	}
+	if state, _, err := m.State("default"); state == "marker-missing" || err != nil {
+		t.Errorf("Expected the marker-missing state to be cleared, got %v (%v)", state, err)
+	}
+
+	// Any other folder error is still a generic error
+	testOs.RemoveAll(fcfg.Path)
+	waitForState(t, sub, "default", "folder path missing")
+	if state, _, _ := m.State("default"); state != "error" {
+		t.Errorf("Expected error state, got %v", state)
+	}
+}
+
+func TestOverrideSubpaths(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.Type = config.FolderTypeSendOnly
+	w.SetFolder(fcfg)
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	ffs := fcfg.Filesystem()
+	must(t, ffs.MkdirAll("dir/sub", 0755))
+	names := []string{"dir/a", "dir/sub/b", "dirother", "other"}
+	for _, name := range names {
+		must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), name), []byte(name), 0644))
+	}
+	must(t, m.ScanFolder("default"))
+
+	// The remote has changed all of the files
+	m.fmut.RLock()
+	fset := m.folderFiles["default"]
+	m.fmut.RUnlock()
+	var remotes []protocol.FileInfo
+	locals := make(map[string]protocol.FileInfo)
+	for _, name := range names {
+		fi, ok := fset.Get(protocol.LocalDeviceID, filepath.FromSlash(name))
+		if !ok {
+			t.Fatal("Missing local file", name)
+		}
+		locals[fi.Name] = fi
+		fi.Version = fi.Version.Update(device1.Short())
+		fi.Size++
+		remotes = append(remotes, fi)
+	}
+	m.Index(device1, "default", remotes)
+
+	if err := m.OverrideSubpaths("default", []string{"../dir"}); err == nil {
+		t.Error("Expected error overriding path outside of the folder")
+	}
+	if err := m.OverrideSubpaths("default", []string{"dir"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rem := range remotes {
+		fi, _ := fset.Get(protocol.LocalDeviceID, rem.Name)
+		overridden := fi.Version.GreaterEqual(rem.Version) && fi.Version.Counter(myID.Short()) > locals[rem.Name].Version.Counter(myID.Short())
+		switch rem.Name {
+		case filepath.FromSlash("dir/a"), filepath.FromSlash("dir/sub/b"):
+			if !overridden {
+				t.Errorf("Expected %v to be overridden, got version %v", rem.Name, fi.Version)
+			}
+		default:
+			if !fi.Version.Equal(locals[rem.Name].Version) {
+				t.Errorf("Expected %v to be untouched, got version %v", rem.Name, fi.Version)
+			}
+		}
+	}
+}
+
+func TestOverrideSubpathsNotSendOnly(t *testing.T) {
+	m, _, fcfg := setupModelWithConnection()
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	if err := m.OverrideSubpaths("default", []string{"foo"}); err != errFolderNotSendOnly {
+		t.Errorf("Expected %v, got %v", errFolderNotSendOnly, err)
+	}
+}
+
 func TestGlobalDirectoryTree(t *testing.T) {
 	db := db.NewLowlevel(backend.OpenMemory())
 	m := newModel(defaultCfgWrapper, myID, "syncthing", "dev", db, nil)
@@ -2534,9 +2756,27 @@ func TestIssue3829(t *testing.T) {
 	}
 }
 
-func TestNoRequestsFromPausedDevices(t *testing.T) {
-	t.Skip("broken, fails randomly, #3843")
+func TestScanFolderSubdirsInvalid(t *testing.T) {
+	m := setupModel(defaultCfgWrapper)
+	defer cleanupModel(m)
+
+	if err := m.ScanFolderSubdirs("nonexistent", []string{"foo"}); err != errFolderMissing {
+		t.Errorf("Expected %v for unknown folder, got %v", errFolderMissing, err)
+	}
+
+	for _, sub := range []string{"..", "../foo", "foo/../../bar", "//foo"} {
+		if err := m.ScanFolderSubdirs("default", []string{"foo", sub}); errors.Cause(err) != fs.ErrNotRelative {
+			t.Errorf("Expected %v for %q, got %v", fs.ErrNotRelative, sub, err)
+		}
+	}
+
+	// Paths that stay within the folder after cleaning are fine
+	if err := m.ScanFolderSubdirs("default", []string{"foo/../bar", "/foo"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
 
+func TestGlobalAvailability(t *testing.T) {
 	wcfg := createTmpWrapper(defaultCfg)
 	wcfg.SetDevice(config.NewDeviceConfiguration(device2, "device2"))
 	fcfg := wcfg.FolderList()[0]
@@ -2546,122 +2786,455 @@ func TestNoRequestsFromPausedDevices(t *testing.T) {
 	m := setupModel(wcfg)
 	defer cleanupModel(m)
 
-	file := testDataExpected["foo"]
 	files := m.folderFiles["default"]
-	files.Update(device1, []protocol.FileInfo{file})
-	files.Update(device2, []protocol.FileInfo{file})
-
-	avail := m.Availability("default", file, file.Blocks[0])
-	if len(avail) != 0 {
-		t.Errorf("should not be available, no connections")
+	old := protocol.FileInfo{Name: "file", Version: protocol.Vector{}.Update(device1.Short())}
+	current := protocol.FileInfo{Name: "file", Version: old.Version.Copy().Update(device1.Short())}
+	files.Update(device1, []protocol.FileInfo{current})
+	files.Update(device2, []protocol.FileInfo{old})
+
+	expectAvailability := func(expected ...protocol.DeviceID) {
+		t.Helper()
+		avail, err := m.GlobalAvailability("default", "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(avail) != len(expected) {
+			t.Fatalf("got availability %v, expected %v", avail, expected)
+		}
+		for i := range avail {
+			if avail[i] != expected[i] {
+				t.Fatalf("got availability %v, expected %v", avail, expected)
+			}
+		}
 	}
 
-	addFakeConn(m, device1)
-	addFakeConn(m, device2)
-
-	// !!! This is not what I'd expect to happen, as we don't even know if the peer has the original index !!!
+	// Only device1 has the global version
+	expectAvailability(device1)
 
-	avail = m.Availability("default", file, file.Blocks[0])
-	if len(avail) != 2 {
-		t.Errorf("should have two available")
+	// We get the global version as well
+	files.Update(protocol.LocalDeviceID, []protocol.FileInfo{current})
+	if myID.Compare(device1) < 0 {
+		expectAvailability(myID, device1)
+	} else {
+		expectAvailability(device1, myID)
 	}
 
-	cc := protocol.ClusterConfig{
-		Folders: []protocol.Folder{
-			{
-				ID: "default",
-				Devices: []protocol.Device{
-					{ID: device1},
-					{ID: device2},
-				},
-			},
-		},
+	// A file only present as invalid is in the index, but not available
+	invalid := protocol.FileInfo{Name: "invalid", Version: old.Version, RawInvalid: true}
+	files.Update(device2, []protocol.FileInfo{invalid})
+	if avail, err := m.GlobalAvailability("default", "invalid"); err != nil || len(avail) != 0 {
+		t.Errorf("got availability %v, %v, expected none", avail, err)
 	}
 
-	m.ClusterConfig(device1, cc)
-	m.ClusterConfig(device2, cc)
+	if _, err := m.GlobalAvailability("default", "nonexistent"); err != protocol.ErrNoSuchFile {
+		t.Errorf("expected %v for nonexistent file, got %v", protocol.ErrNoSuchFile, err)
+	}
+	if _, err := m.GlobalAvailability("nonexistent", "file"); err != errFolderMissing {
+		t.Errorf("expected %v for nonexistent folder, got %v", errFolderMissing, err)
+	}
+}
 
-	avail = m.Availability("default", file, file.Blocks[0])
-	if len(avail) != 2 {
-		t.Errorf("should have two available")
+func TestFileHistory(t *testing.T) {
+	m := setupModel(defaultCfgWrapper)
+	if _, err := m.FileHistory("default", "file"); err != errNoVersionHistory {
+		t.Errorf("expected %v without tracking, got %v", errNoVersionHistory, err)
 	}
+	cleanupModel(m)
 
-	m.Closed(&fakeConnection{id: device1, model: m}, errDeviceUnknown)
-	m.Closed(&fakeConnection{id: device2, model: m}, errDeviceUnknown)
+	wcfg := createTmpWrapper(defaultCfg)
+	fcfg := wcfg.FolderList()[0]
+	fcfg.TrackVersionHistory = true
+	wcfg.SetFolder(fcfg)
+	m = setupModel(wcfg)
+	defer cleanupModel(m)
 
-	avail = m.Availability("default", file, file.Blocks[0])
-	if len(avail) != 0 {
-		t.Errorf("should have no available")
+	files := m.folderFiles["default"]
+	version := protocol.Vector{}.Update(device1.Short())
+	files.Update(device1, []protocol.FileInfo{{Name: "file", Version: version, ModifiedBy: device1.Short()}})
+	for i := 0; i < versionHistoryLength; i++ {
+		version = version.Copy().Update(myID.Short())
+		files.Update(protocol.LocalDeviceID, []protocol.FileInfo{{Name: "file", Version: version, ModifiedBy: myID.Short()}})
 	}
 
-	// Test that remote paused folders are not used.
-
-	addFakeConn(m, device1)
-	addFakeConn(m, device2)
+	hist, err := m.FileHistory("default", "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != versionHistoryLength {
+		t.Fatalf("got %d version events, expected %d", len(hist), versionHistoryLength)
+	}
+	// The change from device1 fell out, the rest are our own.
+	for _, ev := range hist {
+		if ev.Device != myID || ev.ModifiedBy != myID.Short() {
+			t.Errorf("got event from %v modified by %v, expected %v", ev.Device, ev.ModifiedBy, myID)
+		}
+	}
+	if !hist[len(hist)-1].Version.Equal(version) {
+		t.Errorf("latest event has version %v, expected %v", hist[len(hist)-1].Version, version)
+	}
 
-	m.ClusterConfig(device1, cc)
-	ccp := cc
-	ccp.Folders[0].Paused = true
-	m.ClusterConfig(device1, ccp)
+	if hist, err := m.FileHistory("default", "nonexistent"); err != nil || len(hist) != 0 {
+		t.Errorf("got history %v, %v for nonexistent file, expected none", hist, err)
+	}
+	if _, err := m.FileHistory("nonexistent", "file"); err != errFolderMissing {
+		t.Errorf("expected %v for nonexistent folder, got %v", errFolderMissing, err)
+	}
 
-	avail = m.Availability("default", file, file.Blocks[0])
-	if len(avail) != 1 {
-		t.Errorf("should have one available")
+	// Disabling the tracking drops the recorded history.
+	fcfg.TrackVersionHistory = false
+	waiter, err := wcfg.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m.fmut.RLock()
+	files = m.folderFiles["default"]
+	m.fmut.RUnlock()
+	if hist := files.VersionHistory("file"); len(hist) != 0 {
+		t.Errorf("got %d version events after disabling the history, expected none", len(hist))
 	}
 }
 
-// TestIssue2571 tests replacing a directory with content with a symlink
-func TestIssue2571(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("Scanning symlinks isn't supported on windows")
+func TestRemoteCloseReason(t *testing.T) {
+	m := setupModel(defaultCfgWrapper)
+	defer cleanupModel(m)
+
+	closeReason := func() (protocol.CloseReason, string) {
+		t.Helper()
+		ci := m.ConnectionStats()["connections"].(map[string]ConnectionInfo)[device1.String()]
+		return ci.CloseReason, ci.CloseMessage
 	}
 
-	w, fcfg := tmpDefaultWrapper()
-	testFs := fcfg.Filesystem()
-	defer os.RemoveAll(testFs.URI())
+	conn := addFakeConn(m, device1)
+	m.Closed(conn, &protocol.RemoteCloseError{Code: protocol.CloseReasonDeviceRemoved, Reason: "device removed"})
+	if code, msg := closeReason(); code != protocol.CloseReasonDeviceRemoved || msg != "device removed" {
+		t.Errorf("got close reason %v (%q), expected %v", code, msg, protocol.CloseReasonDeviceRemoved)
+	}
 
-	for _, dir := range []string{"toLink", "linkTarget"} {
-		must(t, testFs.MkdirAll(dir, 0775))
-		fd, err := testFs.Create(filepath.Join(dir, "a"))
-		must(t, err)
-		fd.Close()
+	// A connection lost without a close message has an unknown reason.
+	conn = addFakeConn(m, device1)
+	m.Closed(conn, io.EOF)
+	if code, msg := closeReason(); code != protocol.CloseReasonUnknown || msg != "" {
+		t.Errorf("got close reason %v (%q), expected %v", code, msg, protocol.CloseReasonUnknown)
 	}
+}
 
+func TestConnectionAttempts(t *testing.T) {
+	w := createTmpWrapper(defaultCfgWrapper.RawCopy())
 	m := setupModel(w)
 	defer cleanupModel(m)
 
-	must(t, testFs.RemoveAll("toLink"))
-
-	must(t, osutil.DebugSymlinkForTestsOnly(filepath.Join(testFs.URI(), "linkTarget"), filepath.Join(testFs.URI(), "toLink")))
+	for i := 0; i < maxConnectionAttempts+10; i++ {
+		m.DialAttempt(device1, connections.Attempt{Address: fmt.Sprintf("tcp://192.0.2.42:%d", i)})
+	}
+	m.DialAttempt(device2, connections.Attempt{Address: "tcp://192.0.2.43:22000"})
 
-	m.ScanFolder("default")
+	attempts := m.ConnectionAttempts(device1)
+	if len(attempts) != maxConnectionAttempts {
+		t.Fatalf("got %d attempts, expected %d", len(attempts), maxConnectionAttempts)
+	}
+	if addr := attempts[0].Address; addr != "tcp://192.0.2.42:10" {
+		t.Errorf("oldest attempt is %v, expected the first ten to be dropped", addr)
+	}
+	if addr := attempts[len(attempts)-1].Address; addr != fmt.Sprintf("tcp://192.0.2.42:%d", maxConnectionAttempts+9) {
+		t.Errorf("newest attempt is %v", addr)
+	}
 
-	if dir, ok := m.CurrentFolderFile("default", "toLink"); !ok {
-		t.Fatalf("Dir missing in db")
-	} else if !dir.IsSymlink() {
-		t.Errorf("Dir wasn't changed to symlink")
+	// Removing the device from the config forgets its attempts.
+	waiter, err := w.RemoveDevice(device1)
+	must(t, err)
+	waiter.Wait()
+	if attempts := m.ConnectionAttempts(device1); len(attempts) != 0 {
+		t.Errorf("got %d attempts for removed device, expected none", len(attempts))
 	}
-	if file, ok := m.CurrentFolderFile("default", filepath.Join("toLink", "a")); !ok {
-		t.Fatalf("File missing in db")
-	} else if !file.Deleted {
-		t.Errorf("File below symlink has not been marked as deleted")
+	if attempts := m.ConnectionAttempts(device2); len(attempts) != 1 {
+		t.Errorf("got %d attempts for device2, expected one", len(attempts))
 	}
 }
 
-// TestIssue4573 tests that contents of an unavailable dir aren't marked deleted
-func TestIssue4573(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("Can't make the dir inaccessible on windows")
+type fakeConnectivityTester struct {
+	discovered map[protocol.DeviceID][]string
+	dialErrs   map[string]error // address -> dial error
+}
+
+func (f fakeConnectivityTester) DeviceAddresses(deviceCfg config.DeviceConfiguration) []string {
+	var addrs []string
+	for _, addr := range deviceCfg.Addresses {
+		if addr == "dynamic" {
+			addrs = append(addrs, f.discovered[deviceCfg.DeviceID]...)
+		} else {
+			addrs = append(addrs, addr)
+		}
 	}
+	return addrs
+}
 
-	w, fcfg := tmpDefaultWrapper()
-	testFs := fcfg.Filesystem()
-	defer os.RemoveAll(testFs.URI())
+func (f fakeConnectivityTester) DialForConnectivity(_ context.Context, _ config.DeviceConfiguration, addr string) (time.Duration, error) {
+	if err := f.dialErrs[addr]; err != nil {
+		return 0, err
+	}
+	return 42 * time.Millisecond, nil
+}
 
-	must(t, testFs.MkdirAll("inaccessible", 0755))
-	defer testFs.Chmod("inaccessible", 0777)
+func TestDeviceConnectivity(t *testing.T) {
+	w := createTmpWrapper(defaultCfgWrapper.RawCopy())
+	m := setupModel(w)
+	defer cleanupModel(m)
 
-	file := filepath.Join("inaccessible", "a")
+	ctx := context.Background()
+	if _, err := m.TestDeviceConnectivity(ctx, device1); err != errConnectivityUnavailable {
+		t.Errorf("got %v without a tester, expected %v", err, errConnectivityUnavailable)
+	}
+
+	reachable, unreachable := "tcp://192.0.2.42:22000", "tcp://192.0.2.43:22000"
+	unknown := protocol.DeviceID{42}
+	m.SetConnectivityTester(fakeConnectivityTester{
+		discovered: map[protocol.DeviceID][]string{unknown: {reachable}},
+		dialErrs:   map[string]error{unreachable: errors.New("connection refused")},
+	})
+	dev1Cfg, _ := w.Device(device1)
+	dev1Cfg.Addresses = []string{reachable, unreachable}
+	waiter, err := w.SetDevice(dev1Cfg)
+	must(t, err)
+	waiter.Wait()
+	conn := addFakeConn(m, device1)
+
+	res, err := m.TestDeviceConnectivity(ctx, device1)
+	must(t, err)
+	if res.Device != device1 || len(res.Addresses) != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if a := res.Addresses[0]; a.Address != reachable || !a.Reachable || a.LatencyMs != 42 || a.Error != nil {
+		t.Errorf("expected %v to be reachable, got %+v", reachable, a)
+	}
+	if a := res.Addresses[1]; a.Address != unreachable || a.Reachable || a.Error == nil {
+		t.Errorf("expected %v to be unreachable, got %+v", unreachable, a)
+	}
+	if conn.Closed() {
+		t.Error("the established connection was closed")
+	}
+
+	// Devices that aren't configured are looked up using discovery.
+	res, err = m.TestDeviceConnectivity(ctx, unknown)
+	must(t, err)
+	if len(res.Addresses) != 1 || !res.Addresses[0].Reachable {
+		t.Errorf("expected the discovered address to be reachable, got %+v", res)
+	}
+
+	dev1Cfg.Addresses = nil
+	waiter, err = w.SetDevice(dev1Cfg)
+	must(t, err)
+	waiter.Wait()
+	if _, err := m.TestDeviceConnectivity(ctx, device1); err != errConnectivityNoAddresses {
+		t.Errorf("got %v without addresses, expected %v", err, errConnectivityNoAddresses)
+	}
+	if _, err := m.TestDeviceConnectivity(ctx, myID); err != errConnectivitySelf {
+		t.Errorf("got %v testing ourselves, expected %v", err, errConnectivitySelf)
+	}
+}
+
+func TestConnectionInfoRelayScore(t *testing.T) {
+	decode := func(ci ConnectionInfo) map[string]interface{} {
+		t.Helper()
+		bs, err := json.Marshal(ci)
+		must(t, err)
+		var res map[string]interface{}
+		must(t, json.Unmarshal(bs, &res))
+		return res
+	}
+
+	if score, ok := decode(ConnectionInfo{RelayScore: 150 * time.Millisecond})["relayScoreMs"]; !ok || score != 150.0 {
+		t.Errorf("got relay score %v, expected 150", score)
+	}
+	if score, ok := decode(ConnectionInfo{})["relayScoreMs"]; ok {
+		t.Errorf("got relay score %v for a connection without one", score)
+	}
+}
+
+func TestClusterCompletion(t *testing.T) {
+	device3, _ := protocol.DeviceIDFromString("LGFPDIT-7SKNNJL-VJZA4FC-7QNCRKA-CE753K7-2BW5QDK-2FOZ7FR-FEP57QJ")
+	wcfg := createTmpWrapper(defaultCfg)
+	fcfg := wcfg.FolderList()[0]
+	for _, dev := range []protocol.DeviceID{device2, device3} {
+		wcfg.SetDevice(config.NewDeviceConfiguration(dev, dev.String()))
+		fcfg.Devices = append(fcfg.Devices, config.FolderDeviceConfiguration{DeviceID: dev})
+	}
+	wcfg.SetFolder(fcfg)
+
+	m := setupModel(wcfg)
+	defer cleanupModel(m)
+
+	// device1 has everything we have, device2 has nothing and device3 is
+	// not connected.
+	var localFiles []protocol.FileInfo
+	m.folderFiles["default"].WithHave(protocol.LocalDeviceID, func(f db.FileIntf) bool {
+		localFiles = append(localFiles, f.(protocol.FileInfo))
+		return true
+	})
+	if len(localFiles) == 0 {
+		t.Fatal("expected local files")
+	}
+	addFakeConn(m, device1)
+	addFakeConn(m, device2)
+	m.Index(device1, "default", localFiles)
+
+	info, err := m.ClusterCompletion("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.MinPct != 0 || info.MaxPct != 100 {
+		t.Errorf("got min %v%% and max %v%%, expected 0%% and 100%%", info.MinPct, info.MaxPct)
+	}
+	if avg := 200.0 / 3; math.Abs(info.AvgPct-avg) > 0.01 {
+		t.Errorf("got average %v%%, expected %v%%", info.AvgPct, avg)
+	}
+	for dev, expected := range map[protocol.DeviceID]float64{myID: 100, device1: 100, device2: 0} {
+		if comp, ok := info.Devices[dev]; !ok || comp.CompletionPct != expected {
+			t.Errorf("got completion %v for %v, expected %v%%", comp, dev, expected)
+		}
+	}
+	if _, ok := info.Devices[device3]; ok {
+		t.Error("disconnected device has a completion")
+	}
+	if len(info.Behind) != 1 || info.Behind[0] != device2 {
+		t.Errorf("got devices behind %v, expected %v", info.Behind, device2)
+	}
+	if len(info.Disconnected) != 1 || info.Disconnected[0] != device3 {
+		t.Errorf("got disconnected devices %v, expected %v", info.Disconnected, device3)
+	}
+
+	if _, err := m.ClusterCompletion("nonexistent"); err != errFolderMissing {
+		t.Errorf("expected %v for nonexistent folder, got %v", errFolderMissing, err)
+	}
+}
+
+func TestNoRequestsFromPausedDevices(t *testing.T) {
+	t.Skip("broken, fails randomly, #3843")
+
+	wcfg := createTmpWrapper(defaultCfg)
+	wcfg.SetDevice(config.NewDeviceConfiguration(device2, "device2"))
+	fcfg := wcfg.FolderList()[0]
+	fcfg.Devices = append(fcfg.Devices, config.FolderDeviceConfiguration{DeviceID: device2})
+	wcfg.SetFolder(fcfg)
+
+	m := setupModel(wcfg)
+	defer cleanupModel(m)
+
+	file := testDataExpected["foo"]
+	files := m.folderFiles["default"]
+	files.Update(device1, []protocol.FileInfo{file})
+	files.Update(device2, []protocol.FileInfo{file})
+
+	avail := m.Availability("default", file, file.Blocks[0])
+	if len(avail) != 0 {
+		t.Errorf("should not be available, no connections")
+	}
+
+	addFakeConn(m, device1)
+	addFakeConn(m, device2)
+
+	// !!! This is not what I'd expect to happen, as we don't even know if the peer has the original index !!!
+
+	avail = m.Availability("default", file, file.Blocks[0])
+	if len(avail) != 2 {
+		t.Errorf("should have two available")
+	}
+
+	cc := protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: "default",
+				Devices: []protocol.Device{
+					{ID: device1},
+					{ID: device2},
+				},
+			},
+		},
+	}
+
+	m.ClusterConfig(device1, cc)
+	m.ClusterConfig(device2, cc)
+
+	avail = m.Availability("default", file, file.Blocks[0])
+	if len(avail) != 2 {
+		t.Errorf("should have two available")
+	}
+
+	m.Closed(&fakeConnection{id: device1, model: m}, errDeviceUnknown)
+	m.Closed(&fakeConnection{id: device2, model: m}, errDeviceUnknown)
+
+	avail = m.Availability("default", file, file.Blocks[0])
+	if len(avail) != 0 {
+		t.Errorf("should have no available")
+	}
+
+	// Test that remote paused folders are not used.
+
+	addFakeConn(m, device1)
+	addFakeConn(m, device2)
+
+	m.ClusterConfig(device1, cc)
+	ccp := cc
+	ccp.Folders[0].Paused = true
+	m.ClusterConfig(device1, ccp)
+
+	avail = m.Availability("default", file, file.Blocks[0])
+	if len(avail) != 1 {
+		t.Errorf("should have one available")
+	}
+}
+
+// TestIssue2571 tests replacing a directory with content with a symlink
+func TestIssue2571(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Scanning symlinks isn't supported on windows")
+	}
+
+	w, fcfg := tmpDefaultWrapper()
+	testFs := fcfg.Filesystem()
+	defer os.RemoveAll(testFs.URI())
+
+	for _, dir := range []string{"toLink", "linkTarget"} {
+		must(t, testFs.MkdirAll(dir, 0775))
+		fd, err := testFs.Create(filepath.Join(dir, "a"))
+		must(t, err)
+		fd.Close()
+	}
+
+	m := setupModel(w)
+	defer cleanupModel(m)
+
+	must(t, testFs.RemoveAll("toLink"))
+
+	must(t, osutil.DebugSymlinkForTestsOnly(filepath.Join(testFs.URI(), "linkTarget"), filepath.Join(testFs.URI(), "toLink")))
+
+	m.ScanFolder("default")
+
+	if dir, ok := m.CurrentFolderFile("default", "toLink"); !ok {
+		t.Fatalf("Dir missing in db")
+	} else if !dir.IsSymlink() {
+		t.Errorf("Dir wasn't changed to symlink")
+	}
+	if file, ok := m.CurrentFolderFile("default", filepath.Join("toLink", "a")); !ok {
+		t.Fatalf("File missing in db")
+	} else if !file.Deleted {
+		t.Errorf("File below symlink has not been marked as deleted")
+	}
+}
+
+// TestIssue4573 tests that contents of an unavailable dir aren't marked deleted
+func TestIssue4573(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Can't make the dir inaccessible on windows")
+	}
+
+	w, fcfg := tmpDefaultWrapper()
+	testFs := fcfg.Filesystem()
+	defer os.RemoveAll(testFs.URI())
+
+	must(t, testFs.MkdirAll("inaccessible", 0755))
+	defer testFs.Chmod("inaccessible", 0777)
+
+	file := filepath.Join("inaccessible", "a")
 	fd, err := testFs.Create(file)
 	must(t, err)
 	fd.Close()
@@ -3468,3 +4041,768 @@ func TestDeviceWasSeen(t *testing.T) {
 		t.Error("device should have been seen now")
 	}
 }
+
+func TestTempIndexCapability(t *testing.T) {
+	for _, tc := range []struct {
+		capabilities []string
+		subscribed   bool
+	}{
+		{nil, false},
+		{[]string{"unknown"}, false},
+		{[]string{"unknown", protocol.CapabilityTempIndexes}, true},
+	} {
+		w, fcfg := tmpDefaultWrapper()
+		m := setupModel(w)
+
+		fc := &fakeConnection{id: device1, model: m, capabilities: tc.capabilities}
+		m.AddConnection(fc, protocol.HelloResult{})
+		m.ClusterConfig(device1, protocol.ClusterConfig{
+			Folders: []protocol.Folder{
+				{
+					ID: fcfg.ID,
+					Devices: []protocol.Device{
+						{ID: myID},
+						{ID: device1},
+					},
+				},
+			},
+		})
+
+		m.progressEmitter.mut.Lock()
+		_, ok := m.progressEmitter.connections[device1]
+		m.progressEmitter.mut.Unlock()
+		if ok != tc.subscribed {
+			t.Errorf("Capabilities %v: subscribed to temp indexes is %v, expected %v", tc.capabilities, ok, tc.subscribed)
+		}
+
+		cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+	}
+}
+
+func TestIndexResume(t *testing.T) {
+	// Checks that the index sent on connection only contains the files
+	// the other side hasn't seen yet, as advertised by the index ID and max
+	// sequence in the cluster config.
+
+	cases := []struct {
+		name          string
+		indexID       func(protocol.IndexID) protocol.IndexID
+		maxSequence   int64
+		expectedFirst int64
+	}{
+		// They have seen our index up to sequence 3, only send the rest.
+		{"incremental", func(id protocol.IndexID) protocol.IndexID { return id }, 3, 4},
+		// They have never seen our index.
+		{"new", func(protocol.IndexID) protocol.IndexID { return 0 }, 0, 1},
+		// We have reset our index since last talking to them.
+		{"indexIDChanged", func(id protocol.IndexID) protocol.IndexID { return id + 1 }, 3, 1},
+		// They claim to have seen more than we have, e.g. due to having
+		// received index entries we have since lost.
+		{"aheadOfUs", func(id protocol.IndexID) protocol.IndexID { return id }, 42, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, fcfg := tmpDefaultWrapper()
+			m := setupModel(w)
+			defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+			m.fmut.RLock()
+			fset := m.folderFiles[fcfg.ID]
+			m.fmut.RUnlock()
+			fset.Update(protocol.LocalDeviceID, genFiles(5))
+			if seq := fset.Sequence(protocol.LocalDeviceID); seq != 5 {
+				t.Fatal("Expected local sequence 5, got", seq)
+			}
+
+			received := make(chan []protocol.FileInfo, 1)
+			fc := &fakeConnection{id: device1, model: m}
+			fc.indexFn = func(_ context.Context, folder string, fs []protocol.FileInfo) {
+				if folder == fcfg.ID {
+					select {
+					case received <- fs:
+					default:
+					}
+				}
+			}
+			m.AddConnection(fc, protocol.HelloResult{})
+
+			m.ClusterConfig(device1, protocol.ClusterConfig{
+				Folders: []protocol.Folder{
+					{
+						ID: fcfg.ID,
+						Devices: []protocol.Device{
+							{
+								ID:          myID,
+								IndexID:     tc.indexID(fset.IndexID(protocol.LocalDeviceID)),
+								MaxSequence: tc.maxSequence,
+							},
+							{ID: device1},
+						},
+					},
+				},
+			})
+
+			var fs []protocol.FileInfo
+			select {
+			case fs = <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for index")
+			}
+
+			if l := len(fs); l == 0 || fs[0].Sequence != tc.expectedFirst || fs[l-1].Sequence != 5 {
+				var seqs []int64
+				for _, f := range fs {
+					seqs = append(seqs, f.Sequence)
+				}
+				t.Errorf("Expected sequences %d to 5, got %v", tc.expectedFirst, seqs)
+			}
+		})
+	}
+}
+
+func TestConflictingFiles(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	conflicts := map[string]string{
+		conflictName("file.txt", "ABCDEFG"):                                 "file.txt",
+		conflictName("noext", "ABCDEFG"):                                    "noext",
+		conflictName(filepath.Join("dir", "sub", "file.txt"), "ABCDEFG"):    filepath.Join("dir", "sub", "file.txt"),
+		conflictName(filepath.Join("dir.ext", "archive.tar.gz"), "ABCDEFG"): filepath.Join("dir.ext", "archive.tar.gz"),
+	}
+	files := []protocol.FileInfo{
+		{Name: "file.txt", Version: protocol.Vector{}.Update(myID.Short())},
+		{Name: "dir", Type: protocol.FileInfoTypeDirectory, Version: protocol.Vector{}.Update(myID.Short())},
+		{Name: "deleted.sync-conflict-20200101-120000-ABCDEFG.txt", Deleted: true, Version: protocol.Vector{}.Update(myID.Short())},
+	}
+	for name := range conflicts {
+		files = append(files, protocol.FileInfo{Name: name, Version: protocol.Vector{}.Update(myID.Short())})
+	}
+	m.fmut.RLock()
+	m.folderFiles["default"].Update(protocol.LocalDeviceID, files)
+	m.fmut.RUnlock()
+
+	res, err := m.ConflictingFiles("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(conflicts) {
+		t.Fatalf("Expected %d conflicts, got %d: %v", len(conflicts), len(res), res)
+	}
+	for _, f := range res {
+		if exp, ok := conflicts[f.Name]; !ok {
+			t.Errorf("Unexpected conflict %v", f.Name)
+		} else if f.Original != exp {
+			t.Errorf("Conflict %v has original %v, expected %v", f.Name, f.Original, exp)
+		}
+	}
+
+	if _, err := m.ConflictingFiles("nonexistent"); err == nil {
+		t.Error("Expected error for nonexistent folder")
+	}
+}
+
+func TestMatchIgnore(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	if err := m.SetIgnores("default", []string{"!/keep.tmp", "(?d)(?i)*.TMP", "/build"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path    string
+		ignored bool
+		line    string
+	}{
+		{"keep.tmp", false, "!/keep.tmp"},
+		{"other.tmp", true, "(?d)(?i)*.TMP"},
+		{filepath.Join("dir", "OTHER.Tmp"), true, "(?d)(?i)*.TMP"},
+		{filepath.Join("build", "out"), true, "/build"},
+		{filepath.Join("dir", "build"), false, ""},
+		{"file.txt", false, ""},
+	}
+	for _, tc := range cases {
+		ignored, line, err := m.MatchIgnore("default", tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ignored != tc.ignored || line != tc.line {
+			t.Errorf("%v: got %v, %q; expected %v, %q", tc.path, ignored, line, tc.ignored, tc.line)
+		}
+	}
+
+	if _, _, err := m.MatchIgnore("nonexistent", "file.txt"); err != errFolderMissing {
+		t.Errorf("expected errFolderMissing, got %v", err)
+	}
+}
+
+func TestScanSummaryEvent(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	// Make sure the initial scan is done before adding files.
+	_ = m.ScanFolder("default")
+
+	ffs := fcfg.Filesystem()
+	var size int64
+	for i, name := range []string{"a", "b", "c"} {
+		data := bytes.Repeat([]byte{'x'}, (i+1)*1000)
+		fd, err := ffs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fd.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		fd.Close()
+		size += int64(len(data))
+	}
+
+	sub := m.evLogger.Subscribe(events.FolderScanSummary)
+	defer sub.Unsubscribe()
+
+	t0 := time.Now()
+	if err := m.ScanFolder("default"); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(t0).Seconds()
+
+	ev, err := sub.Poll(time.Second)
+	if err != nil {
+		t.Fatal("Expected summary event:", err)
+	}
+	data := ev.Data.(map[string]interface{})
+	if data["folder"] != "default" || data["filesHashed"] != int64(3) || data["bytesHashed"] != size {
+		t.Errorf("Unexpected event data %v", data)
+	}
+	for _, key := range []string{"walkDuration", "hashDuration", "dbUpdateDuration"} {
+		if d := data[key].(float64); d <= 0 || d > elapsed*float64(runtime.NumCPU()) {
+			t.Errorf("%v of %v out of range", key, d)
+		}
+	}
+}
+
+func TestScanOnConnect(t *testing.T) {
+	oldDelay := scanOnConnectDelay
+	scanOnConnectDelay = 100 * time.Millisecond
+	defer func() { scanOnConnectDelay = oldDelay }()
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.RescanIntervalS = 0
+	fcfg.ScanOnConnect = true
+	w.SetFolder(fcfg)
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	sub := m.evLogger.Subscribe(events.StateChanged)
+	defer sub.Unsubscribe()
+
+	// countScans returns the number of scans started within the given
+	// duration.
+	countScans := func(d time.Duration) int {
+		scans := 0
+		timeout := time.After(d)
+		for {
+			select {
+			case ev := <-sub.C():
+				data := ev.Data.(map[string]interface{})
+				if data["folder"] == fcfg.ID && data["to"] == FolderScanning.String() {
+					scans++
+				}
+			case <-timeout:
+				return scans
+			}
+		}
+	}
+
+	// A flurry of reconnects results in a single scan.
+	for i := 0; i < 5; i++ {
+		fc := addFakeConn(m, device1)
+		m.Closed(fc, errors.New("test"))
+	}
+	if scans := countScans(10 * scanOnConnectDelay); scans != 1 {
+		t.Errorf("expected one scan after reconnecting, got %v", scans)
+	}
+
+	// Another connection later on scans again.
+	fc := addFakeConn(m, device1)
+	if scans := countScans(10 * scanOnConnectDelay); scans != 1 {
+		t.Errorf("expected one scan after reconnecting again, got %v", scans)
+	}
+
+	// Replacing the connection doesn't scan, as the device was never
+	// disconnected.
+	m.AddConnection(&fakeConnection{id: device1, model: m}, protocol.HelloResult{})
+	if scans := countScans(10 * scanOnConnectDelay); scans != 0 {
+		t.Errorf("expected no scan after replacing the connection, got %v", scans)
+	}
+	m.Closed(fc, errors.New("test"))
+}
+
+func TestIntroducedDevices(t *testing.T) {
+	device3, _ := protocol.DeviceIDFromString("LGFPDIT-7SKNNJL-VJZA4FC-7QNCRKA-CE753K7-2BW5QDK-2FOZ7FR-FEP57QJ")
+
+	m := newState(config.Configuration{
+		Devices: []config.DeviceConfiguration{
+			{
+				DeviceID:   device1,
+				Introducer: true,
+			},
+		},
+		Folders: []config.FolderConfiguration{
+			{
+				ID:   "folder1",
+				Path: "testdata",
+				Devices: []config.FolderDeviceConfiguration{
+					{DeviceID: device1},
+				},
+			},
+		},
+	})
+	defer cleanupModel(m)
+
+	if devs := m.IntroducedDevices(device1); len(devs) != 0 {
+		t.Errorf("expected no introduced devices, got %v", devs)
+	}
+
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: "folder1",
+				Devices: []protocol.Device{
+					{ID: device3},
+					{ID: device2},
+				},
+			},
+		},
+	})
+
+	for _, dev := range []protocol.DeviceID{device2, device3} {
+		if cfg, ok := m.cfg.Device(dev); !ok {
+			t.Errorf("device %v was not added", dev)
+		} else if cfg.IntroducedBy != device1 {
+			t.Errorf("device %v introduced by %v, expected %v", dev, cfg.IntroducedBy, device1)
+		}
+	}
+
+	expected := []protocol.DeviceID{device2, device3}
+	if device3.Compare(device2) < 0 {
+		expected = []protocol.DeviceID{device3, device2}
+	}
+	if devs := m.IntroducedDevices(device1); len(devs) != 2 || devs[0] != expected[0] || devs[1] != expected[1] {
+		t.Errorf("introduced devices %v, expected %v", devs, expected)
+	}
+	if devs := m.IntroducedDevices(device2); len(devs) != 0 {
+		t.Errorf("expected no devices introduced by %v, got %v", device2, devs)
+	}
+}
+
+func TestScanFolderMetadataOnly(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	testFs := fcfg.Filesystem()
+	defer os.RemoveAll(testFs.URI())
+
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(name, data string) {
+		t.Helper()
+		fd, err := testFs.Create(name)
+		must(t, err)
+		_, err = fd.Write([]byte(data))
+		must(t, err)
+		must(t, fd.Close())
+		must(t, testFs.Chtimes(name, mtime, mtime))
+	}
+	write("same", "some data")
+	write("grown", "some data")
+
+	m := setupModel(w)
+	defer cleanupModel(m)
+
+	before, ok := m.CurrentFolderFile("default", "same")
+	if !ok {
+		t.Fatal("file missing in db")
+	}
+
+	write("same", "same size")
+	write("grown", "different size")
+
+	if err := m.ScanFolderMetadataOnly("default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The content only change is not detected.
+	if f, _ := m.CurrentFolderFile("default", "same"); f.MustRescan() || !f.Version.Equal(before.Version) || !protocol.BlocksEqual(f.Blocks, before.Blocks) {
+		t.Errorf("content only change was detected: %v", f)
+	}
+	// The size change is, but hashing is left to the next scan.
+	if f, _ := m.CurrentFolderFile("default", "grown"); !f.MustRescan() || len(f.Blocks) != 0 {
+		t.Errorf("size change wasn't flagged: %v", f)
+	}
+
+	must(t, m.ScanFolder("default"))
+	if f, _ := m.CurrentFolderFile("default", "grown"); f.MustRescan() || f.Size != int64(len("different size")) || len(f.Blocks) != 1 {
+		t.Errorf("flagged file wasn't rehashed: %v", f)
+	}
+
+	if err := m.ScanFolderMetadataOnly("nonexistent"); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+}
+
+func TestFolderErrorsPagination(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	defer os.RemoveAll(fcfg.Filesystem().URI())
+	m := setupModel(w)
+	defer cleanupModel(m)
+	must(t, m.ScanFolder("default"))
+
+	f := m.folderRunners["default"].(*sendReceiveFolder)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		f.newScanError(name, errors.New("some error"))
+	}
+
+	for _, tc := range []struct {
+		offset, limit int
+		expected      []string
+	}{
+		{0, 0, []string{"a", "b", "c", "d", "e"}},
+		{0, 2, []string{"a", "b"}},
+		{2, 2, []string{"c", "d"}},
+		{4, 2, []string{"e"}},
+		{3, 0, []string{"d", "e"}},
+		{5, 2, nil},
+		{10, 2, nil},
+		{-1, 1, []string{"a"}},
+	} {
+		errs, total, err := m.FolderErrors("default", tc.offset, tc.limit)
+		must(t, err)
+		if total != 5 {
+			t.Errorf("offset %d, limit %d: total %d, expected 5", tc.offset, tc.limit, total)
+		}
+		var paths []string
+		for _, e := range errs {
+			paths = append(paths, e.Path)
+		}
+		if !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("offset %d, limit %d: got %v, expected %v", tc.offset, tc.limit, paths, tc.expected)
+		}
+	}
+
+	must(t, m.ClearFolderError("default", "c"))
+	if _, total, _ := m.FolderErrors("default", 0, 0); total != 4 {
+		t.Errorf("%d errors after clearing one, expected 4", total)
+	}
+	if err := m.ClearFolderError("default", "c"); err != errNoFileError {
+		t.Errorf("clearing a cleared error returned %v", err)
+	}
+	if _, _, err := m.FolderErrors("nonexistent", 0, 0); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+}
+
+func TestNeedFolderFilesMatching(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	var files []protocol.FileInfo
+	for _, name := range []string{
+		"README.md",
+		"docs/a.md", "docs/b.md", "docs/c.txt", "docs/d.md", "docs/sub/e.md",
+		"src/main.go", "src/docs.go",
+	} {
+		files = append(files, protocol.FileInfo{
+			Name:    filepath.FromSlash(name),
+			Version: protocol.Vector{}.Update(device1.Short()),
+			Blocks:  []protocol.BlockInfo{{Size: 100}},
+			Size:    100,
+		})
+	}
+	m.fmut.RLock()
+	m.folderFiles["default"].Update(device1, files)
+	m.fmut.RUnlock()
+
+	names := func(fs []db.FileInfoTruncated) []string {
+		res := make([]string, len(fs))
+		for i, f := range fs {
+			res[i] = filepath.ToSlash(f.Name)
+		}
+		return res
+	}
+
+	cases := []struct {
+		pattern       string
+		offset, limit int
+		expected      []string
+		total         int
+	}{
+		{"docs/**", 0, 0, []string{"docs/a.md", "docs/b.md", "docs/c.txt", "docs/d.md", "docs/sub/e.md"}, 5},
+		{"docs/**", 0, 2, []string{"docs/a.md", "docs/b.md"}, 5},
+		{"docs/**", 2, 2, []string{"docs/c.txt", "docs/d.md"}, 5},
+		{"docs/**", 4, 2, []string{"docs/sub/e.md"}, 5},
+		{"docs/**", 6, 2, nil, 5},
+		{"docs/*.md", 1, 10, []string{"docs/b.md", "docs/d.md"}, 3},
+		{"**.md", 0, 3, []string{"README.md", "docs/a.md", "docs/b.md"}, 5},
+		{"*.md", 0, 0, []string{"README.md"}, 1},
+		{"nothing/**", 0, 10, nil, 0},
+	}
+	for _, tc := range cases {
+		res, total, err := m.NeedFolderFilesMatching("default", tc.pattern, tc.offset, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != tc.total {
+			t.Errorf("%s [%d:%d]: total %d, expected %d", tc.pattern, tc.offset, tc.limit, total, tc.total)
+		}
+		if got := names(res); !reflect.DeepEqual(got, tc.expected) && (len(got) > 0 || len(tc.expected) > 0) {
+			t.Errorf("%s [%d:%d]: got %v, expected %v", tc.pattern, tc.offset, tc.limit, got, tc.expected)
+		}
+	}
+
+	if _, _, err := m.NeedFolderFilesMatching("default", "docs/[", 0, 0); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, _, err := m.NeedFolderFilesMatching("default", "**", -1, 0); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+	if _, _, err := m.NeedFolderFilesMatching("nonexistent", "**", 0, 0); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+}
+
+func TestMetadataRequest(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	v := protocol.Vector{}.Update(myID.Short())
+	blocks := []protocol.BlockInfo{{Size: 100, Hash: []byte("hash")}}
+	files := []protocol.FileInfo{
+		{Name: "dir", Type: protocol.FileInfoTypeDirectory, Version: v},
+		{Name: filepath.Join("dir", "a"), Size: 100, Blocks: blocks, Version: v},
+		{Name: filepath.Join("dir", "ignored"), Size: 100, Blocks: blocks, Version: v, LocalFlags: protocol.FlagLocalIgnored},
+		{Name: filepath.Join("dir", "sub"), Type: protocol.FileInfoTypeDirectory, Version: v},
+		{Name: filepath.Join("dir", "sub", "b"), Size: 100, Blocks: blocks, Version: v},
+		{Name: "top", Size: 100, Blocks: blocks, Version: v},
+	}
+	m.fmut.RLock()
+	m.folderFiles["default"].Update(protocol.LocalDeviceID, files)
+	m.fmut.RUnlock()
+
+	cases := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"", []string{"dir", "top"}},
+		{"dir", []string{filepath.Join("dir", "a"), filepath.Join("dir", "ignored"), filepath.Join("dir", "sub")}},
+		{"dir/", []string{filepath.Join("dir", "a"), filepath.Join("dir", "ignored"), filepath.Join("dir", "sub")}},
+		{filepath.Join("dir", "sub"), []string{filepath.Join("dir", "sub", "b")}},
+		{"top", nil},
+		{"nonexistent", nil},
+	}
+	for _, tc := range cases {
+		res, err := m.MetadataRequest(device1, "default", tc.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range res {
+			names = append(names, f.Name)
+			if len(f.Blocks) != 0 {
+				t.Errorf("%q: got blocks for %v", tc.prefix, f.Name)
+			}
+			if f.LocalFlags != 0 {
+				t.Errorf("%q: got local flags for %v", tc.prefix, f.Name)
+			}
+			if f.IsInvalid() != (f.Name == filepath.Join("dir", "ignored")) {
+				t.Errorf("%q: %v has invalid %v", tc.prefix, f.Name, f.IsInvalid())
+			}
+		}
+		if !equalStrings(names, tc.expected) {
+			t.Errorf("%q: got %v, expected %v", tc.prefix, names, tc.expected)
+		}
+	}
+
+	if _, err := m.MetadataRequest(device2, "default", ""); err == nil {
+		t.Error("expected an error for a device the folder isn't shared with")
+	}
+	if _, err := m.MetadataRequest(device1, "nonexistent", ""); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+	if _, err := m.MetadataRequest(device1, "default", "../outside"); err == nil {
+		t.Error("expected an error for a prefix outside the folder")
+	}
+}
+
+func TestRangeRequest(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	m := setupModel(w)
+	ffs := fcfg.Filesystem()
+	defer cleanupModelAndRemoveDir(m, ffs.URI())
+
+	// Three full blocks and a partial one.
+	content := make([]byte, 3*protocol.MinBlockSize+1000)
+	rand.Read(content)
+	must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "file"), content, 0644))
+	if err := m.ScanFolder("default"); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := m.CurrentFolderFile("default", "file"); !ok || len(f.Blocks) != 4 {
+		t.Fatalf("Expected the file in the database with 4 blocks, got %v", f)
+	}
+
+	cases := []struct {
+		name   string
+		offset int64
+		size   int32
+	}{
+		{"sub-block", 10, 100},
+		{"block start", protocol.MinBlockSize, 100},
+		{"spanning blocks", protocol.MinBlockSize - 50, 100},
+		{"spanning three blocks", protocol.MinBlockSize - 50, protocol.MinBlockSize + 100},
+		{"up to end of file", int64(len(content)) - 10, 10},
+	}
+	for _, tc := range cases {
+		res, err := m.RangeRequest(device1, "default", "file", tc.size, tc.offset)
+		if err != nil {
+			t.Errorf("%v: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(res.Data(), content[tc.offset:tc.offset+int64(tc.size)]) {
+			t.Errorf("%v: incorrect data", tc.name)
+		}
+		res.Close()
+	}
+
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		size   int32
+	}{
+		{"past end of file", int64(len(content)) - 10, 11},
+		{"beyond end of file", int64(len(content)) + 10, 1},
+		{"negative offset", -1, 10},
+		{"empty", 0, 0},
+	} {
+		if _, err := m.RangeRequest(device1, "default", "file", tc.size, tc.offset); err != protocol.ErrInvalid {
+			t.Errorf("%v: got error %v, expected %v", tc.name, err, protocol.ErrInvalid)
+		}
+	}
+
+	if _, err := m.RangeRequest(device2, "default", "file", 10, 0); err == nil {
+		t.Error("Unexpected nil error for unshared folder")
+	}
+	if _, err := m.RangeRequest(device1, "default", "nonexistent", 10, 0); err != protocol.ErrNoSuchFile {
+		t.Errorf("Got error %v, expected %v", err, protocol.ErrNoSuchFile)
+	}
+
+	// Change the second block on disk without rescanning, ranges
+	// overlapping it must fail validation while others are still served.
+	changed := append([]byte(nil), content...)
+	changed[protocol.MinBlockSize+500]++
+	must(t, ioutil.WriteFile(filepath.Join(ffs.URI(), "file"), changed, 0644))
+	if _, err := m.RangeRequest(device1, "default", "file", 100, protocol.MinBlockSize-50); err != protocol.ErrNoSuchFile {
+		t.Errorf("Got error %v for changed data, expected %v", err, protocol.ErrNoSuchFile)
+	}
+	if _, err := m.RangeRequest(device1, "default", "file", 100, 10); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMaxConcurrentScans(t *testing.T) {
+	const folders = 8
+	const limit = 2
+
+	cfg := defaultCfg.Copy()
+	cfg.Options.MaxConcurrentScans = limit
+	cfg.Folders = nil
+	for i := 0; i < folders; i++ {
+		id := fmt.Sprintf("f%d", i)
+		fcfg := config.NewFolderConfiguration(myID, id, id, fs.FilesystemTypeFake, fmt.Sprintf("/TestMaxConcurrentScans%d?files=100&sizeavg=10000&seed=%d", i, i))
+		fcfg.FSWatcherEnabled = false
+		cfg.Folders = append(cfg.Folders, fcfg)
+	}
+	w := createTmpWrapper(cfg)
+
+	m := newModel(w, myID, "syncthing", "dev", db.NewLowlevel(backend.OpenMemory()), nil)
+	sub := m.evLogger.Subscribe(events.StateChanged)
+	defer sub.Unsubscribe()
+	m.ServeBackground()
+	defer cleanupModel(m)
+
+	// Track the scanning folders while they scan, so that no events are
+	// dropped for not being read.
+	type result struct{ scans, maxScanning int }
+	done := make(chan struct{})
+	res := make(chan result, 1)
+	go func() {
+		var r result
+		scanning := 0
+		for {
+			ev, err := sub.Poll(time.Second)
+			if err == events.ErrTimeout {
+				select {
+				case <-done:
+					res <- r
+					return
+				default:
+					continue
+				}
+			} else if err != nil {
+				t.Error(err)
+				res <- r
+				return
+			}
+			data := ev.Data.(map[string]interface{})
+			if data["to"] == FolderScanning.String() {
+				scanning++
+				r.scans++
+				if scanning > r.maxScanning {
+					r.maxScanning = scanning
+				}
+			}
+			if data["from"] == FolderScanning.String() {
+				scanning--
+			}
+		}
+	}()
+
+	// The initial scans of all folders, then rescans all at once. Both
+	// return once the scans are done.
+	m.ScanFolders()
+	m.ScanFolders()
+	close(done)
+	r := <-res
+
+	if r.scans < 2*folders {
+		t.Errorf("Expected at least %d scans, got %d", 2*folders, r.scans)
+	}
+	if r.maxScanning > limit {
+		t.Errorf("%d folders scanned concurrently, limit is %d", r.maxScanning, limit)
+	}
+}
+
+func TestStopDrainsConnections(t *testing.T) {
+	m := setupModel(defaultCfgWrapper)
+	defer func() {
+		m.db.Close()
+		m.evLogger.Stop()
+	}()
+
+	fc := addFakeConn(m, device1)
+	m.Stop()
+
+	fc.mut.Lock()
+	defer fc.mut.Unlock()
+	if !fc.drained {
+		t.Error("expected the connection to be drained when stopping")
+	}
+	if !fc.closed {
+		t.Error("expected the connection to be closed when stopping")
+	}
+}
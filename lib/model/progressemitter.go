@@ -26,12 +26,14 @@ type ProgressEmitter struct {
 	cfg                config.Wrapper
 	registry           map[string]map[string]*sharedPullerState // folder: name: puller
 	interval           time.Duration
+	messageInterval    time.Duration
 	minBlocks          int
 	sentDownloadStates map[protocol.DeviceID]*sentDownloadState // States representing what we've sent to the other peer via DownloadProgress messages.
 	connections        map[protocol.DeviceID]protocol.Connection
 	foldersByConns     map[protocol.DeviceID][]string
 	disabled           bool
 	evLogger           events.Logger
+	observers          *progressObservers
 	mut                sync.Mutex
 
 	timer *time.Timer
@@ -48,6 +50,7 @@ func NewProgressEmitter(cfg config.Wrapper, evLogger events.Logger) *ProgressEmi
 		connections:        make(map[protocol.DeviceID]protocol.Connection),
 		foldersByConns:     make(map[protocol.DeviceID][]string),
 		evLogger:           evLogger,
+		observers:          newProgressObservers(),
 		mut:                sync.NewMutex(),
 	}
 	t.Service = util.AsService(t.serve, t.String())
@@ -63,7 +66,7 @@ func (t *ProgressEmitter) serve(ctx context.Context) {
 	t.cfg.Subscribe(t)
 	defer t.cfg.Unsubscribe(t)
 
-	var lastUpdate time.Time
+	var lastUpdate, lastEvent, lastMessage time.Time
 	var lastCount, newCount int
 	for {
 		select {
@@ -74,6 +77,7 @@ func (t *ProgressEmitter) serve(ctx context.Context) {
 			t.mut.Lock()
 			l.Debugln("progress emitter: timer - looking after", len(t.registry))
 
+			now := time.Now()
 			newLastUpdated := lastUpdate
 			newCount = t.lenRegistryLocked()
 			for _, pullers := range t.registry {
@@ -84,25 +88,59 @@ func (t *ProgressEmitter) serve(ctx context.Context) {
 				}
 			}
 
+			// The event is rate limited by the (slower) progress update
+			// interval, while the download progress messages to other
+			// devices go out at their own interval. Messages only contain
+			// what changed since the last one was sent, so any number of
+			// block updates in between are coalesced into one message.
+			pending := false
 			if !newLastUpdated.Equal(lastUpdate) || newCount != lastCount {
-				lastUpdate = newLastUpdated
-				lastCount = newCount
-				t.sendDownloadProgressEventLocked()
-				if len(t.connections) > 0 {
-					t.sendDownloadProgressMessagesLocked(ctx)
+				if now.Sub(lastEvent) >= t.interval {
+					lastUpdate = newLastUpdated
+					lastCount = newCount
+					lastEvent = now
+					t.sendDownloadProgressEventLocked()
+				} else {
+					pending = true
 				}
 			} else {
 				l.Debugln("progress emitter: nothing new")
 			}
+			if len(t.connections) > 0 {
+				if now.Sub(lastMessage) >= t.messageIntervalLocked() {
+					lastMessage = now
+					t.sendDownloadProgressMessagesLocked(ctx)
+				} else {
+					pending = true
+				}
+			}
 
-			if newCount != 0 {
-				t.timer.Reset(t.interval)
+			if newCount != 0 || pending {
+				t.timer.Reset(t.tickIntervalLocked())
 			}
 			t.mut.Unlock()
 		}
 	}
 }
 
+// messageIntervalLocked returns the minimum interval between download
+// progress messages to other devices.
+func (t *ProgressEmitter) messageIntervalLocked() time.Duration {
+	if t.messageInterval <= 0 {
+		return t.interval
+	}
+	return t.messageInterval
+}
+
+// tickIntervalLocked returns the interval at which the emitter needs to
+// wake up to emit both events and messages in time.
+func (t *ProgressEmitter) tickIntervalLocked() time.Duration {
+	if msg := t.messageIntervalLocked(); len(t.connections) > 0 && msg < t.interval {
+		return msg
+	}
+	return t.interval
+}
+
 func (t *ProgressEmitter) sendDownloadProgressEventLocked() {
 	output := make(map[string]map[string]*pullerProgress)
 	for folder, pullers := range t.registry {
@@ -111,7 +149,9 @@ func (t *ProgressEmitter) sendDownloadProgressEventLocked() {
 		}
 		output[folder] = make(map[string]*pullerProgress)
 		for name, puller := range pullers {
-			output[folder][name] = puller.Progress()
+			progress := puller.Progress()
+			output[folder][name] = progress
+			t.observers.pullProgress(folder, name, progress.BytesDone, progress.BytesTotal)
 		}
 	}
 	t.evLogger.Log(events.DownloadProgress, output)
@@ -218,6 +258,7 @@ func (t *ProgressEmitter) CommitConfiguration(from, to config.Configuration) boo
 		l.Debugln("progress emitter: disabled")
 	}
 	t.minBlocks = to.Options.TempIndexMinBlocks
+	t.messageInterval = time.Duration(to.Options.TempIndexIntervalMs) * time.Millisecond
 
 	return true
 }
@@ -233,7 +274,7 @@ func (t *ProgressEmitter) Register(s *sharedPullerState) {
 	}
 	l.Debugln("progress emitter: registering", s.folder, s.file.Name)
 	if t.emptyLocked() {
-		t.timer.Reset(t.interval)
+		t.timer.Reset(t.tickIntervalLocked())
 	}
 	if _, ok := t.registry[s.folder]; !ok {
 		t.registry[s.folder] = make(map[string]*sharedPullerState)
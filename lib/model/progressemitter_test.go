@@ -464,3 +464,185 @@ func sendMsgs(p *ProgressEmitter) {
 	defer p.mut.Unlock()
 	p.sendDownloadProgressMessagesLocked(context.Background())
 }
+
+func TestDownloadProgressCoalescing(t *testing.T) {
+	c := createTmpWrapper(config.Configuration{})
+	defer os.Remove(c.ConfigPath())
+	c.SetOptions(config.OptionsConfiguration{
+		ProgressUpdateIntervalS: 60,
+		TempIndexMinBlocks:      10,
+		TempIndexIntervalMs:     50,
+	})
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+
+	p := NewProgressEmitter(c, evLogger)
+	fc := &fakeConnection{id: device1}
+	p.temporaryIndexSubscribe(fc, []string{"folder"})
+	go p.Serve()
+	defer p.Stop()
+
+	const numBlocks = 200
+	blocks := make([]protocol.BlockInfo, numBlocks)
+	for i := range blocks {
+		blocks[i] = protocol.BlockInfo{Offset: int64(i * protocol.MinBlockSize), Size: protocol.MinBlockSize}
+	}
+	s := &sharedPullerState{
+		folder: "folder",
+		file: protocol.FileInfo{
+			Name:         "file",
+			Version:      (protocol.Vector{}).Update(0),
+			Blocks:       blocks,
+			RawBlockSize: protocol.MinBlockSize,
+		},
+		mut:              sync.NewRWMutex(),
+		availableUpdated: time.Now(),
+	}
+
+	p.Register(s)
+
+	// All blocks complete while the emitter is blocked, i.e. between two
+	// of its ticks, so they must all end up in the same message.
+	p.mut.Lock()
+	for _, b := range blocks {
+		s.copyDone(b)
+	}
+	p.mut.Unlock()
+
+	// waitFor waits until a sent update satisfies fn and returns the
+	// messages sent so far.
+	waitFor := func(fn func(protocol.FileDownloadProgressUpdate) bool) []downloadProgressMessage {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			p.mut.Lock()
+			msgs := append([]downloadProgressMessage(nil), fc.downloadProgressMessages...)
+			p.mut.Unlock()
+			for _, msg := range msgs {
+				for _, u := range msg.updates {
+					if fn(u) {
+						return msgs
+					}
+				}
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("Timed out waiting for download progress, got %v", msgs)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	msgs := waitFor(func(u protocol.FileDownloadProgressUpdate) bool {
+		return u.UpdateType == protocol.UpdateTypeAppend && len(u.BlockIndexes) > 0
+	})
+	withBlocks := 0
+	for _, msg := range msgs {
+		for _, u := range msg.updates {
+			if u.UpdateType != protocol.UpdateTypeAppend || len(u.BlockIndexes) == 0 {
+				continue
+			}
+			withBlocks++
+			if len(u.BlockIndexes) != numBlocks {
+				t.Errorf("Got an update for %d blocks, expected all %d in one", len(u.BlockIndexes), numBlocks)
+			}
+		}
+	}
+	if withBlocks != 1 {
+		t.Errorf("Got %d updates with blocks, expected 1", withBlocks)
+	}
+
+	// A final forget update once the file completes
+	p.Deregister(s)
+	waitFor(func(u protocol.FileDownloadProgressUpdate) bool {
+		return u.UpdateType == protocol.UpdateTypeForget
+	})
+}
+
+type recordingObserver struct {
+	mut  sync.Mutex
+	scan []int64
+	pull map[string]int64
+}
+
+func (o *recordingObserver) OnScanProgress(folder string, current, total int64) {
+	o.mut.Lock()
+	o.scan = append(o.scan, current, total)
+	o.mut.Unlock()
+}
+
+func (o *recordingObserver) OnPullProgress(folder, file string, pulled, total int64) {
+	o.mut.Lock()
+	o.pull[folder+"/"+file] = pulled
+	o.mut.Unlock()
+}
+
+func (o *recordingObserver) lastScan() (int64, int64) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if len(o.scan) == 0 {
+		return -1, -1
+	}
+	return o.scan[len(o.scan)-2], o.scan[len(o.scan)-1]
+}
+
+func TestProgressObserver(t *testing.T) {
+	w, fcfg := tmpDefaultWrapper()
+	testFs := fcfg.Filesystem()
+	defer os.RemoveAll(testFs.URI())
+	m := setupModel(w)
+	defer cleanupModel(m)
+
+	obs := &recordingObserver{pull: make(map[string]int64), mut: sync.NewMutex()}
+	m.AddProgressObserver(obs)
+
+	// Scan progress
+
+	fd, err := testFs.Create("file")
+	must(t, err)
+	_, err = fd.Write(make([]byte, 1000))
+	must(t, err)
+	must(t, fd.Close())
+	must(t, m.ScanFolder("default"))
+
+	timeout := time.Now().Add(5 * time.Second)
+	for {
+		if current, total := obs.lastScan(); current == 1000 && total == 1000 {
+			break
+		}
+		if time.Now().After(timeout) {
+			t.Fatal("observer didn't get the scan progress")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Pull progress, alongside the event
+
+	sub := m.evLogger.Subscribe(events.DownloadProgress)
+	defer sub.Unsubscribe()
+	m.progressEmitter.mut.Lock()
+	m.progressEmitter.interval = 0
+	m.progressEmitter.mut.Unlock()
+
+	s := &sharedPullerState{
+		folder:     "default",
+		file:       protocol.FileInfo{Name: "pulled", RawBlockSize: protocol.MinBlockSize},
+		copyTotal:  2,
+		copyNeeded: 2,
+		updated:    time.Now(),
+		mut:        sync.NewRWMutex(),
+	}
+	m.progressEmitter.Register(s)
+	expectEvent(sub, t, 1)
+
+	s.copyDone(protocol.BlockInfo{})
+	expectEvent(sub, t, 1)
+
+	obs.mut.Lock()
+	defer obs.mut.Unlock()
+	if pulled, expected := obs.pull["default/pulled"], s.Progress().BytesDone; pulled != expected || pulled == 0 {
+		t.Errorf("observer got %d bytes pulled, expected %d", pulled, expected)
+	}
+}
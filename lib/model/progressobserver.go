@@ -0,0 +1,57 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// A ProgressObserver receives scan and pull progress as it happens, at the
+// same time as the FolderScanProgress and DownloadProgress events are
+// emitted. It gives embedders a typed alternative to the event bus. The
+// callbacks must not block.
+type ProgressObserver interface {
+	// OnScanProgress is called with the number of bytes hashed so far and
+	// the total number of bytes to hash in the current scan of the folder.
+	OnScanProgress(folder string, current, total int64)
+	// OnPullProgress is called with the number of bytes of the file that
+	// are done and its total size, for every file currently being pulled.
+	OnPullProgress(folder, file string, pulled, total int64)
+}
+
+type progressObservers struct {
+	observers []ProgressObserver
+	mut       sync.RWMutex
+}
+
+func newProgressObservers() *progressObservers {
+	return &progressObservers{
+		mut: sync.NewRWMutex(),
+	}
+}
+
+func (o *progressObservers) add(observer ProgressObserver) {
+	o.mut.Lock()
+	o.observers = append(o.observers, observer)
+	o.mut.Unlock()
+}
+
+func (o *progressObservers) scanProgress(folder string, current, total int64) {
+	o.mut.RLock()
+	defer o.mut.RUnlock()
+	for _, observer := range o.observers {
+		observer.OnScanProgress(folder, current, total)
+	}
+}
+
+func (o *progressObservers) pullProgress(folder, file string, pulled, total int64) {
+	o.mut.RLock()
+	defer o.mut.RUnlock()
+	for _, observer := range o.observers {
+		observer.OnPullProgress(folder, file, pulled, total)
+	}
+}
@@ -133,6 +133,24 @@ func (q *jobQueue) Shuffle() {
 	rand.Shuffle(q.queued)
 }
 
+// Prioritize moves the queued files for which the function returns true to
+// the front of the queue, keeping their order and that of the rest.
+func (q *jobQueue) Prioritize(prio func(name string) bool) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	queued := make([]jobQueueEntry, 0, len(q.queued))
+	var rest []jobQueueEntry
+	for _, e := range q.queued {
+		if prio(e.name) {
+			queued = append(queued, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	q.queued = append(queued, rest...)
+}
+
 func (q *jobQueue) Reset() {
 	q.mut.Lock()
 	defer q.mut.Unlock()
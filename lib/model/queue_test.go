@@ -250,6 +250,23 @@ func TestSortByAge(t *testing.T) {
 	}
 }
 
+func TestPrioritize(t *testing.T) {
+	q := newJobQueue()
+	q.Push("f1", 20, time.Time{})
+	q.Push("p2", 40, time.Time{})
+	q.Push("f3", 30, time.Time{})
+	q.Push("p4", 10, time.Time{})
+
+	q.Prioritize(func(name string) bool { return name[0] == 'p' })
+
+	_, actual, _ := q.Jobs(1, 100)
+	expected := []string{"p2", "p4", "f1", "f3"}
+
+	if diff, equal := messagediff.PrettyDiff(expected, actual); !equal {
+		t.Errorf("Prioritize() diff:\n%s", diff)
+	}
+}
+
 func BenchmarkJobQueueBump(b *testing.B) {
 	files := genFiles(b.N)
 
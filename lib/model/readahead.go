@@ -0,0 +1,136 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"io"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+const (
+	// readAheadSize is the size of the read ahead buffer per connection.
+	readAheadSize = 1 << 20
+	// readAheadAfter is the number of sequential requests in a row after
+	// which we start reading ahead.
+	readAheadAfter = 2
+)
+
+// readAhead serves sequential block requests of a device from a buffer, so
+// that consecutive blocks of a file are read in larger chunks instead of
+// with one read per request. There is a single buffer per connection, which
+// is dropped as soon as the requests aren't sequential anymore.
+type readAhead struct {
+	size int
+
+	mut        sync.Mutex
+	folder     string
+	name       string
+	next       int64 // offset the next request has if it's sequential
+	sequential int   // number of sequential requests in a row
+	bufOffset  int64 // offset of buf in the file
+	buf        []byte
+	gen        int // incremented whenever the buffer is dropped
+}
+
+func newReadAhead(size int) *readAhead {
+	return &readAhead{
+		size: size,
+		mut:  sync.NewMutex(),
+	}
+}
+
+// read reads len(dst) bytes at the given offset of the file into dst. It
+// returns whether the data was served from what was read previously, which
+// may be outdated if the file changed since.
+func (r *readAhead) read(ffs fs.Filesystem, folder, name string, offset int64, dst []byte) (bool, error) {
+	r.mut.Lock()
+
+	sameFile := folder == r.folder && name == r.name
+	if sameFile && offset >= r.bufOffset && offset+int64(len(dst)) <= r.bufOffset+int64(len(r.buf)) {
+		copy(dst, r.buf[offset-r.bufOffset:])
+		r.next = offset + int64(len(dst))
+		r.mut.Unlock()
+		return true, nil
+	}
+
+	if sameFile && offset == r.next {
+		r.sequential++
+	} else {
+		r.resetLocked(folder, name)
+	}
+	r.next = offset + int64(len(dst))
+
+	if r.sequential < readAheadAfter || len(dst) >= r.size {
+		r.mut.Unlock()
+		return false, readOffsetIntoBuf(ffs, name, offset, dst)
+	}
+
+	// Take the buffer, so that other requests aren't blocked while we read
+	// into it.
+	buf := r.buf
+	r.buf = nil
+	gen := r.gen
+	r.mut.Unlock()
+
+	buf, err := fillBuf(ffs, name, offset, buf, r.size)
+	if err == nil && len(buf) < len(dst) {
+		err = io.EOF
+	}
+	if err == nil {
+		copy(dst, buf)
+	}
+
+	r.mut.Lock()
+	if err == nil && r.gen == gen {
+		// Nothing reset the read ahead meanwhile, so the data is still
+		// for the file that's being read sequentially.
+		r.buf = buf
+		r.bufOffset = offset
+	}
+	r.mut.Unlock()
+	return false, err
+}
+
+// resetLocked starts tracking sequential requests for the given file.
+func (r *readAhead) resetLocked(folder, name string) {
+	r.folder, r.name = folder, name
+	r.sequential = 0
+	r.buf = r.buf[:0]
+	r.gen++
+}
+
+// fillBuf reads as much of the file at the given offset as fits in size
+// bytes, reusing buf if it's large enough.
+func fillBuf(ffs fs.Filesystem, name string, offset int64, buf []byte, size int) ([]byte, error) {
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+
+	fd, err := ffs.Open(name)
+	if err != nil {
+		return buf[:0], err
+	}
+	defer fd.Close()
+	n, err := fd.ReadAt(buf, offset)
+	if err == io.EOF {
+		// The end of the file is within the buffer.
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// evict drops the buffered data.
+func (r *readAhead) evict() {
+	r.mut.Lock()
+	r.buf = r.buf[:0]
+	r.sequential = 0
+	r.gen++
+	r.mut.Unlock()
+}
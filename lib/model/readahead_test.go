@@ -0,0 +1,230 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// countingFS counts the files opened for reading.
+type countingFS struct {
+	fs.Filesystem
+	opens int64
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	atomic.AddInt64(&c.opens, 1)
+	return c.Filesystem.Open(name)
+}
+
+func setupReadAheadFiles(t testing.TB, sizes ...int) (*countingFS, [][]byte, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	datas := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		datas[i] = make([]byte, size)
+		rand.Read(datas[i])
+		if err := ioutil.WriteFile(filepath.Join(dir, string('a'+rune(i))), datas[i], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ffs := &countingFS{Filesystem: fs.NewFilesystem(fs.FilesystemTypeBasic, dir)}
+	return ffs, datas, func() { os.RemoveAll(dir) }
+}
+
+func TestReadAheadRandomAccess(t *testing.T) {
+	const blockSize = protocol.MinBlockSize
+	ffs, datas, cleanup := setupReadAheadFiles(t, 20*blockSize+100, 7*blockSize)
+	defer cleanup()
+
+	r := newReadAhead(4 * blockSize)
+	check := func(file int, offset int64, size int) {
+		t.Helper()
+		buf := make([]byte, size)
+		if _, err := r.read(ffs, "default", string('a'+rune(file)), offset, buf); err != nil {
+			t.Fatalf("reading %d bytes at %d of file %d: %v", size, offset, file, err)
+		}
+		if !bytes.Equal(buf, datas[file][offset:offset+int64(size)]) {
+			t.Fatalf("wrong data for %d bytes at %d of file %d", size, offset, file)
+		}
+	}
+
+	// Sequential runs, interrupted by random access to both files, at
+	// block boundaries and not.
+	for i := 0; i < 1000; i++ {
+		file := rand.Intn(len(datas))
+		blocks := len(datas[file]) / blockSize
+		switch rand.Intn(3) {
+		case 0:
+			start, n := rand.Intn(blocks), rand.Intn(10)
+			for b := start; b < start+n && b < blocks; b++ {
+				check(file, int64(b*blockSize), blockSize)
+			}
+		case 1:
+			check(file, int64(rand.Intn(blocks)*blockSize), blockSize)
+		default:
+			offset := rand.Intn(len(datas[file]) - 100)
+			check(file, int64(offset), 1+rand.Intn(len(datas[file])-offset))
+		}
+	}
+
+	// The tail of the file is read ahead as well.
+	for b := 0; b < 20; b++ {
+		check(0, int64(b*blockSize), blockSize)
+	}
+	check(0, 20*blockSize, 100)
+
+	// Reading beyond the end fails, as it does without reading ahead.
+	if _, err := r.read(ffs, "default", "a", 20*blockSize, make([]byte, blockSize)); err == nil {
+		t.Error("expected an error reading beyond the end of the file")
+	}
+}
+
+func TestReadAheadReducesReads(t *testing.T) {
+	const blockSize = protocol.MinBlockSize
+	ffs, _, cleanup := setupReadAheadFiles(t, 32*blockSize)
+	defer cleanup()
+
+	r := newReadAhead(8 * blockSize)
+	buf := make([]byte, blockSize)
+	for b := 0; b < 32; b++ {
+		if _, err := r.read(ffs, "default", "a", int64(b*blockSize), buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Two direct reads before we start reading ahead, then one read per
+	// eight blocks.
+	if opens := atomic.LoadInt64(&ffs.opens); opens > 6 {
+		t.Errorf("%d reads for 32 sequential blocks", opens)
+	}
+
+	// Random access reads directly.
+	atomic.StoreInt64(&ffs.opens, 0)
+	for _, b := range []int{3, 17, 5, 30, 11, 0, 24} {
+		if _, err := r.read(ffs, "default", "a", int64(b*blockSize), buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if opens := atomic.LoadInt64(&ffs.opens); opens != 7 {
+		t.Errorf("%d reads for 7 random blocks", opens)
+	}
+}
+
+// blockingFS blocks opening files while block is set.
+type blockingFS struct {
+	fs.Filesystem
+	block   int32
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingFS) Open(name string) (fs.File, error) {
+	if atomic.LoadInt32(&b.block) == 1 {
+		b.blocked <- struct{}{}
+		<-b.release
+	}
+	return b.Filesystem.Open(name)
+}
+
+func TestReadAheadDoesNotBlockOtherReads(t *testing.T) {
+	const blockSize = protocol.MinBlockSize
+	cfs, datas, cleanup := setupReadAheadFiles(t, 8*blockSize, blockSize)
+	defer cleanup()
+	ffs := &blockingFS{Filesystem: cfs, blocked: make(chan struct{}), release: make(chan struct{})}
+
+	r := newReadAhead(4 * blockSize)
+	buf := make([]byte, blockSize)
+	for b := 0; b < readAheadAfter; b++ {
+		if _, err := r.read(ffs, "default", "a", int64(b*blockSize), buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The next sequential read fills the buffer, which blocks.
+	atomic.StoreInt32(&ffs.block, 1)
+	done := make(chan error)
+	go func() {
+		buf := make([]byte, blockSize)
+		_, err := r.read(ffs, "default", "a", readAheadAfter*blockSize, buf)
+		if err == nil && !bytes.Equal(buf, datas[0][readAheadAfter*blockSize:(readAheadAfter+1)*blockSize]) {
+			err = errors.New("wrong data")
+		}
+		done <- err
+	}()
+	<-ffs.blocked
+	atomic.StoreInt32(&ffs.block, 0)
+
+	// Meanwhile requests for another file are served.
+	other := make(chan error)
+	go func() {
+		_, err := r.read(ffs, "default", "b", 0, make([]byte, blockSize))
+		other <- err
+	}()
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Read blocked by the read ahead of another file")
+	}
+
+	close(ffs.release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkSequentialRequests(b *testing.B) {
+	const blockSize = protocol.MinBlockSize
+	const blocks = 64
+	ffs, _, cleanup := setupReadAheadFiles(b, blocks*blockSize)
+	defer cleanup()
+	buf := make([]byte, blockSize)
+
+	b.Run("direct", func(b *testing.B) {
+		atomic.StoreInt64(&ffs.opens, 0)
+		b.SetBytes(blocks * blockSize)
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < blocks; j++ {
+				if err := readOffsetIntoBuf(ffs, "a", int64(j*blockSize), buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.Logf("%d reads for %d requests", atomic.LoadInt64(&ffs.opens), b.N*blocks)
+	})
+
+	b.Run("readahead", func(b *testing.B) {
+		atomic.StoreInt64(&ffs.opens, 0)
+		b.SetBytes(blocks * blockSize)
+		r := newReadAhead(readAheadSize)
+		for i := 0; i < b.N; i++ {
+			r.evict()
+			for j := 0; j < blocks; j++ {
+				if _, err := r.read(ffs, "default", "a", int64(j*blockSize), buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.Logf("%d reads for %d requests", atomic.LoadInt64(&ffs.opens), b.N*blocks)
+	})
+}
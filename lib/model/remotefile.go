@@ -0,0 +1,178 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/golang/groupcache/lru"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/scanner"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// remoteFileCacheSize is the amount of fetched block data kept in memory
+// per open remote file.
+const remoteFileCacheSize = 64 << 20
+
+var (
+	// ErrRemoteFileUnavailable is returned when reading a remote file if
+	// none of the connected devices could provide the data. The read may
+	// be retried once devices (re)connect.
+	ErrRemoteFileUnavailable = errors.New("no connected device has the requested data")
+
+	errRemoteFileChanged = errors.New("file changed since it was opened")
+	errRemoteFileClosed  = errors.New("file is closed")
+	errInvalidWhence     = errors.New("invalid whence")
+	errNegativeOffset    = errors.New("negative offset")
+)
+
+// ReadSeekCloser is the interface that groups the basic Read, Seek and
+// Close methods.
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// remoteFile reads a file from the devices that have it, fetching blocks
+// lazily as they are read. The devices are looked up for every block, so
+// devices connecting and disconnecting mid-stream are taken into account.
+// Fetched blocks are kept in a bounded LRU cache.
+type remoteFile struct {
+	model  *model
+	folder string
+	file   protocol.FileInfo
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mut    sync.Mutex
+	offset int64
+	cache  *lru.Cache // block index to data
+	closed bool
+}
+
+func newRemoteFile(m *model, folder string, file protocol.FileInfo) *remoteFile {
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := remoteFileCacheSize / file.BlockSize()
+	if entries < 1 {
+		entries = 1
+	}
+	return &remoteFile{
+		model:  m,
+		folder: folder,
+		file:   file,
+		ctx:    ctx,
+		cancel: cancel,
+		mut:    sync.NewMutex(),
+		cache:  lru.New(entries),
+	}
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	if f.closed {
+		return 0, errRemoteFileClosed
+	}
+	if f.offset >= f.file.Size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && f.offset < f.file.Size {
+		idx := int(f.offset / int64(f.file.BlockSize()))
+		data, err := f.blockLocked(idx)
+		if err != nil {
+			// Whatever was read so far is returned, the error is
+			// returned again on the next read.
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		c := copy(p[n:], data[f.offset-f.file.Blocks[idx].Offset:])
+		n += c
+		f.offset += int64(c)
+	}
+	return n, nil
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	if f.closed {
+		return 0, errRemoteFileClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.file.Size
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the cache and aborts requests in flight.
+func (f *remoteFile) Close() error {
+	f.cancel()
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return errRemoteFileClosed
+	}
+	f.closed = true
+	f.cache.Clear()
+	return nil
+}
+
+// blockLocked returns the data of the block with the given index, from the
+// cache or requested from the first device that has it.
+func (f *remoteFile) blockLocked(idx int) ([]byte, error) {
+	if data, ok := f.cache.Get(idx); ok {
+		return data.([]byte), nil
+	}
+
+	if gf, ok := f.model.CurrentGlobalFile(f.folder, f.file.Name); !ok || !gf.Version.Equal(f.file.Version) {
+		return nil, errRemoteFileChanged
+	}
+
+	block := f.file.Blocks[idx]
+	for _, av := range f.model.Availability(f.folder, f.file, block) {
+		conn, ok := f.model.Connection(av.ID)
+		if !ok {
+			continue
+		}
+		data, err := conn.Request(f.ctx, f.folder, f.file.Name, block.Offset, int(block.Size), block.Hash, block.WeakHash, av.FromTemporary)
+		if err != nil {
+			if f.ctx.Err() != nil {
+				return nil, errRemoteFileClosed
+			}
+			l.Debugf("%v remote file: %s: %q / %q o=%d: %v", f.model, av.ID, f.folder, f.file.Name, block.Offset, err)
+			continue
+		}
+		if !scanner.Validate(data, block.Hash, block.WeakHash) {
+			l.Debugf("%v remote file: %s: %q / %q o=%d: hash mismatch", f.model, av.ID, f.folder, f.file.Name, block.Offset)
+			continue
+		}
+		f.cache.Add(idx, data)
+		return data, nil
+	}
+	return nil, ErrRemoteFileUnavailable
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// setupRemoteFile returns a model with a send only folder, so nothing is
+// pulled, and a connection to device1 which has the given file.
+func setupRemoteFile(t *testing.T, name string, data []byte) (*model, *fakeConnection, *int) {
+	t.Helper()
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.Type = config.FolderTypeSendOnly
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m := setupModel(w)
+
+	requests := 0
+	fc := addFakeConn(m, device1)
+	fc.folder = "default"
+	fc.requestFn = func(_ context.Context, folder, name string, offset int64, size int, _ []byte, _ bool) ([]byte, error) {
+		requests++
+		data := fc.fileData[name]
+		if offset+int64(size) > int64(len(data)) {
+			return nil, protocol.ErrInvalid
+		}
+		return data[offset : offset+int64(size)], nil
+	}
+	fc.addFile(name, 0644, protocol.FileInfoTypeFile, data)
+	fc.sendIndexUpdate()
+
+	return m, fc, &requests
+}
+
+func TestRemoteFileSeekRead(t *testing.T) {
+	data := make([]byte, 3*protocol.MinBlockSize+1000)
+	rand.Read(data)
+	m, fc, requests := setupRemoteFile(t, "file", data)
+	defer cleanupModelAndRemoveDir(m, m.cfg.Folders()["default"].Filesystem().URI())
+
+	f, err := m.OpenRemoteFile("default", "file")
+	must(t, err)
+	defer f.Close()
+
+	// Within the second block, then spanning into the third.
+	offset := int64(protocol.MinBlockSize + 10)
+	if pos, err := f.Seek(offset, io.SeekStart); err != nil || pos != offset {
+		t.Fatalf("Seek returned %d, %v", pos, err)
+	}
+	buf := make([]byte, protocol.MinBlockSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[offset:offset+int64(len(buf))]) {
+		t.Error("Incorrect data after seek")
+	}
+	fc.mut.Lock()
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+	fc.mut.Unlock()
+
+	// Back into the second block, which is cached.
+	if _, err := f.Seek(-100, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	buf = buf[:50]
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+	offset += protocol.MinBlockSize - 100
+	if !bytes.Equal(buf, data[offset:offset+50]) {
+		t.Error("Incorrect data after seeking back")
+	}
+	fc.mut.Lock()
+	if *requests != 2 {
+		t.Errorf("Expected cached data, got %d requests", *requests)
+	}
+	fc.mut.Unlock()
+
+	// The tail of the file, then EOF.
+	if _, err := f.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest := make([]byte, 100)
+	n, err := io.ReadFull(f, rest)
+	if err != io.ErrUnexpectedEOF || n != 10 {
+		t.Fatalf("Expected 10 bytes and an unexpected EOF, got %d, %v", n, err)
+	}
+	if !bytes.Equal(rest[:n], data[len(data)-10:]) {
+		t.Error("Incorrect data at end of file")
+	}
+
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected an error seeking before the start")
+	}
+}
+
+func TestRemoteFileDisconnect(t *testing.T) {
+	data := make([]byte, 2*protocol.MinBlockSize)
+	rand.Read(data)
+	m, fc, _ := setupRemoteFile(t, "file", data)
+	defer cleanupModelAndRemoveDir(m, m.cfg.Folders()["default"].Filesystem().URI())
+
+	f, err := m.OpenRemoteFile("default", "file")
+	must(t, err)
+	defer f.Close()
+
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The device goes away mid-stream, the next block can't be fetched.
+	fc.Close(errors.New("testing"))
+	if _, err := f.Seek(protocol.MinBlockSize, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(buf); err != ErrRemoteFileUnavailable {
+		t.Fatalf("Expected %v, got %v", ErrRemoteFileUnavailable, err)
+	}
+
+	// It's back with the same index, and the read can be retried where
+	// it failed.
+	fc2 := addFakeConn(m, device1)
+	fc2.folder = "default"
+	fc2.files = fc.files
+	fc2.fileData = fc.fileData
+	fc2.requestFn = func(_ context.Context, folder, name string, offset int64, size int, _ []byte, _ bool) ([]byte, error) {
+		return fc2.fileData[name][offset : offset+int64(size)], nil
+	}
+	fc2.sendIndexUpdate()
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[protocol.MinBlockSize:protocol.MinBlockSize+100]) {
+		t.Error("Incorrect data after reconnecting")
+	}
+}
+
+func TestOpenRemoteFileErrors(t *testing.T) {
+	m, _, _ := setupRemoteFile(t, "file", []byte("data"))
+	defer cleanupModelAndRemoveDir(m, m.cfg.Folders()["default"].Filesystem().URI())
+
+	if _, err := m.OpenRemoteFile("nonexistent", "file"); err == nil {
+		t.Error("Expected an error for an unknown folder")
+	}
+	if _, err := m.OpenRemoteFile("default", "nonexistent"); err == nil {
+		t.Error("Expected an error for an unknown file")
+	}
+	if _, err := m.OpenRemoteFile("default", "../file"); err == nil {
+		t.Error("Expected an error for an invalid name")
+	}
+}
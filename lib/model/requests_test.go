@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -20,10 +21,13 @@ import (
 	"time"
 
 	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/db"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/ignore"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
+	"github.com/syncthing/syncthing/lib/scanner"
 )
 
 func TestRequestSimple(t *testing.T) {
@@ -108,6 +112,70 @@ func TestSymlinkTraversalRead(t *testing.T) {
 	}
 }
 
+func TestSymlinkTraversalFollowingSymlinks(t *testing.T) {
+	// Verify that a synced symlink can not be traversed for reading or
+	// writing, even when the folder follows symlinks when scanning.
+
+	if runtime.GOOS == "windows" {
+		t.Skip("no symlink support on CI")
+		return
+	}
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.FollowSymlinks.Enabled = true
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m, fc := setupModelWithConnectionFromWrapper(w)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	done := make(chan struct{})
+	badReq := make(chan string, 1)
+	badIdx := make(chan string, 1)
+	fc.mut.Lock()
+	fc.indexFn = func(_ context.Context, folder string, fs []protocol.FileInfo) {
+		for _, f := range fs {
+			if f.Name == "symlink" {
+				close(done)
+				return
+			}
+			if strings.HasPrefix(f.Name, "symlink") {
+				badIdx <- f.Name
+				return
+			}
+		}
+	}
+	fc.requestFn = func(_ context.Context, folder, name string, offset int64, size int, hash []byte, fromTemporary bool) ([]byte, error) {
+		if name != "symlink" && strings.HasPrefix(name, "symlink") {
+			badReq <- name
+		}
+		return fc.fileData[name], nil
+	}
+	fc.mut.Unlock()
+
+	fc.addFile("symlink", 0644, protocol.FileInfoTypeSymlink, []byte(".."))
+	fc.sendIndexUpdate()
+	<-done
+
+	if res, err := m.Request(device1, "default", "symlink/requests_test.go", 10, 0, nil, 0, false); err == nil || res != nil {
+		t.Error("Managed to traverse symlink for reading")
+	}
+
+	fc.addFile("symlink/testfile", 0644, protocol.FileInfoTypeFile, []byte("testdata"))
+	fc.sendIndexUpdate()
+
+	select {
+	case name := <-badReq:
+		t.Fatal("Should not have requested the data for", name)
+	case name := <-badIdx:
+		t.Fatal("Should not have sent the index entry for", name)
+	case <-time.After(3 * time.Second):
+		// Unfortunately not much else to trigger on here. The puller sleep
+		// interval is 1s so if we didn't get any requests within two
+		// iterations we should be fine.
+	}
+}
+
 func TestSymlinkTraversalWrite(t *testing.T) {
 	// Verify that a symlink can not be traversed for writing.
 
@@ -1171,3 +1239,197 @@ func TestRequestLastFileProgress(t *testing.T) {
 		t.Fatal("Timed out before file was requested")
 	}
 }
+
+func TestRequestReceiveEncrypted(t *testing.T) {
+	// Verify that a receive encrypted folder doesn't store a block that
+	// isn't the one announced by its encrypted hash.
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.Type = config.FolderTypeReceiveEncrypted
+	fcfg.EncryptionPassword = "pass"
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m, fc := setupModelWithConnectionFromWrapper(w)
+	tfs := fcfg.Filesystem()
+	defer cleanupModelAndRemoveDir(m, tfs.URI())
+
+	sub := m.evLogger.Subscribe(events.FolderErrors)
+	defer sub.Unsubscribe()
+
+	contents := make([]byte, 100)
+	fc.addFile("encfile", 0644, protocol.FileInfoTypeFile, contents)
+	fc.mut.Lock()
+	fc.files[0].Blocks[0].Hash = bytes.Repeat([]byte{0xfe}, 32)
+	fc.files[0].Blocks[0].WeakHash = 0
+	fc.mut.Unlock()
+	fc.sendIndexUpdate()
+
+	select {
+	case ev := <-sub.C():
+		errs := ev.Data.(map[string]interface{})["errors"].([]FileError)
+		if len(errs) != 1 || errs[0].Path != "encfile" {
+			t.Errorf("Unexpected folder errors %v", errs)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the pull to fail")
+	}
+	if _, err := tfs.Lstat("encfile"); !fs.IsNotExist(err) {
+		t.Error("Expected the file not to be stored, got", err)
+	}
+}
+
+// trustedModel serves the plaintext of files on a trusted device, verifying
+// the requested hashes.
+type trustedModel struct {
+	data    map[string][]byte
+	indexed chan []protocol.FileInfo
+}
+
+func (m *trustedModel) Index(_ protocol.DeviceID, _ string, files []protocol.FileInfo) error {
+	m.indexed <- files
+	return nil
+}
+
+func (m *trustedModel) IndexUpdate(_ protocol.DeviceID, _ string, files []protocol.FileInfo) error {
+	m.indexed <- files
+	return nil
+}
+
+func (m *trustedModel) Request(_ protocol.DeviceID, _, name string, size int32, offset int64, hash []byte, _ uint32, _ bool) (protocol.RequestResponse, error) {
+	data, ok := m.data[name]
+	if !ok || offset+int64(size) > int64(len(data)) {
+		return nil, protocol.ErrNoSuchFile
+	}
+	res := newRequestResponse(int(size))
+	copy(res.data, data[offset:])
+	if !scanner.Validate(res.data, hash, 0) {
+		res.Close()
+		return nil, protocol.ErrInvalid
+	}
+	return res, nil
+}
+
+func (m *trustedModel) ClusterConfig(protocol.DeviceID, protocol.ClusterConfig) error { return nil }
+func (m *trustedModel) Closed(protocol.Connection, error)                             {}
+func (m *trustedModel) DownloadProgress(protocol.DeviceID, string, []protocol.FileDownloadProgressUpdate) error {
+	return nil
+}
+func (m *trustedModel) MetadataRequest(protocol.DeviceID, string, string) ([]protocol.FileInfo, error) {
+	return nil, protocol.ErrGeneric
+}
+func (m *trustedModel) RangeRequest(protocol.DeviceID, string, string, int32, int64) (protocol.RequestResponse, error) {
+	return nil, protocol.ErrGeneric
+}
+
+func TestReceiveEncryptedRoundTrip(t *testing.T) {
+	// A trusted device sends a file over an encrypted connection to a
+	// receive encrypted folder, which must store it encrypted, without local
+	// changes, and serve it back.
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.Type = config.FolderTypeReceiveEncrypted
+	fcfg.EncryptionPassword = "pass"
+	fcfg.VerifyReassembled = true
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m := setupModel(w)
+	tfs := fcfg.Filesystem()
+	defer cleanupModelAndRemoveDir(m, tfs.URI())
+
+	// The name is long enough for the encrypted name to be split into
+	// directories.
+	name := strings.Repeat("secret/", 50) + "file"
+	contents := make([]byte, 3*protocol.MinBlockSize/2)
+	if _, err := io.ReadFull(rand.Reader, contents); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(contents), protocol.MinBlockSize, int64(len(contents)), nil, true)
+	must(t, err)
+	file := protocol.FileInfo{
+		Name:         name,
+		Type:         protocol.FileInfoTypeFile,
+		Size:         int64(len(contents)),
+		ModifiedS:    time.Now().Unix(),
+		Permissions:  0644,
+		Version:      protocol.Vector{}.Update(device1.Short()),
+		Sequence:     1,
+		RawBlockSize: protocol.MinBlockSize,
+		Blocks:       blocks,
+	}
+
+	trusted := &trustedModel{
+		data:    map[string][]byte{name: contents},
+		indexed: make(chan []protocol.FileInfo, 10),
+	}
+	keys := map[string]*[protocol.FolderKeySize]byte{
+		"default": protocol.KeyFromPassword("default", "pass"),
+	}
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+	trustedConn := protocol.NewEncryptedConnection(myID, ar, bw, trusted, "untrusted", protocol.CompressNever, func(folder string) *[protocol.FolderKeySize]byte {
+		return keys[folder]
+	})
+	trustedConn.Start()
+	defer trustedConn.Close(errStopped)
+	m.AddConnection(newFakeProtoConn(protocol.NewConnection(device1, br, aw, m, "trusted", protocol.CompressNever)), protocol.HelloResult{})
+	trustedConn.ClusterConfig(protocol.ClusterConfig{
+		Folders: []protocol.Folder{{
+			ID:      "default",
+			Devices: []protocol.Device{{ID: myID}, {ID: device1}},
+		}},
+	})
+	must(t, trustedConn.Index(context.Background(), "default", []protocol.FileInfo{file}))
+
+	m.fmut.RLock()
+	fset := m.folderFiles["default"]
+	m.fmut.RUnlock()
+	timeout := time.After(10 * time.Second)
+	for fset.LocalSize().Files != 1 {
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the file to sync")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var enc protocol.FileInfo
+	fset.WithHave(protocol.LocalDeviceID, func(f db.FileIntf) bool {
+		if fi := f.(protocol.FileInfo); fi.Type == protocol.FileInfoTypeFile {
+			enc = fi
+			return false
+		}
+		return true
+	})
+	if strings.Contains(enc.Name, "secret") {
+		t.Errorf("Stored plaintext name %q", enc.Name)
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(tfs.URI(), filepath.FromSlash(enc.Name)))
+	must(t, err)
+	if int64(len(stored)) != enc.Size || bytes.Contains(stored, contents[:64]) {
+		t.Error("File isn't stored encrypted")
+	}
+
+	// The directories of the split name were announced and are not local
+	// changes.
+	must(t, m.ScanFolder("default"))
+	if changed := fset.ReceiveOnlyChangedSize(); changed.TotalItems() != 0 {
+		t.Errorf("Unexpected local changes after scan: %+v", changed)
+	}
+
+	// Stored blocks are only served for their own encrypted hash.
+	if _, err := m.Request(device1, "default", enc.Name, enc.Blocks[0].Size, enc.Blocks[0].Offset, enc.Blocks[1].Hash, 0, false); err == nil {
+		t.Error("Served a block for the hash of another block")
+	}
+
+	for _, b := range file.Blocks {
+		data, err := trustedConn.Request(context.Background(), "default", name, b.Offset, int(b.Size), b.Hash, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, contents[b.Offset:b.Offset+int64(b.Size)]) {
+			t.Errorf("Block at %d differs after round trip", b.Offset)
+		}
+	}
+}
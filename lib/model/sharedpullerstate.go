@@ -7,7 +7,6 @@
 package model
 
 import (
-	"io"
 	"time"
 
 	"github.com/pkg/errors"
@@ -77,6 +76,22 @@ func (w *lockedWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
 	return w.fd.WriteAt(p, off)
 }
 
+// CopyRange copies size bytes from src into the file, see fs.CopyRange. Like
+// WriteAt it only needs to acquire a read-lock.
+func (w *lockedWriterAt) CopyRange(src fs.File, srcOffset, dstOffset, size int64) error {
+	w.mut.RLock()
+	defer w.mut.RUnlock()
+	return fs.CopyRange(src, w.fd, srcOffset, dstOffset, size)
+}
+
+// ReadAt reads back what was written, needing only a read-lock like
+// WriteAt.
+func (w *lockedWriterAt) ReadAt(p []byte, off int64) (n int, err error) {
+	w.mut.RLock()
+	defer w.mut.RUnlock()
+	return w.fd.ReadAt(p, off)
+}
+
 // SyncClose ensures that no more writes are happening before going ahead and
 // syncing and closing the fd, thus needs to acquire a write-lock.
 func (w *lockedWriterAt) SyncClose() error {
@@ -92,7 +107,7 @@ func (w *lockedWriterAt) SyncClose() error {
 
 // tempFile returns the fd for the temporary file, reusing an open fd
 // or creating the file as necessary.
-func (s *sharedPullerState) tempFile() (io.WriterAt, error) {
+func (s *sharedPullerState) tempFile() (*lockedWriterAt, error) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
 
@@ -42,6 +42,7 @@ func init() {
 	_, _ = defaultCfgWrapper.SetFolder(defaultFolderConfig)
 	opts := defaultCfgWrapper.Options()
 	opts.KeepTemporariesH = 1
+	opts.ScanJitterPct = 0
 	_, _ = defaultCfgWrapper.SetOptions(opts)
 
 	defaultCfg = defaultCfgWrapper.RawCopy()
@@ -0,0 +1,208 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/scanner"
+)
+
+// verifyResumeKey holds the name of the last file verified, in the folder
+// statistics namespace, while a verification is incomplete.
+const verifyResumeKey = "verifyResumeAfter"
+
+type VerifyStatus int
+
+const (
+	VerifyOK       VerifyStatus = iota
+	VerifyMismatch              // the contents don't match the hashes in the database
+	VerifyMissing               // the file doesn't exist, or isn't a regular file
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return "ok"
+	case VerifyMismatch:
+		return "mismatch"
+	case VerifyMissing:
+		return "missing"
+	default:
+		return "unknown"
+	}
+}
+
+func (s VerifyStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// VerifyResult is the outcome of verifying one file.
+type VerifyResult struct {
+	Name   string       `json:"name"`
+	Status VerifyStatus `json:"status"`
+	Err    error        `json:"-"` // Why the file couldn't be read, if it couldn't
+}
+
+// VerifyFolder hashes all local files of the folder and compares them to
+// the block hashes in the database, sending a result per file. Reading is
+// limited to the folder's verifyMaxKiBps. Cancelling the context stops the
+// verification, and the next call continues after the last file verified.
+// The channel is closed when done or cancelled.
+func (m *model) VerifyFolder(ctx context.Context, folder string) (<-chan VerifyResult, error) {
+	m.fmut.RLock()
+	cfg, cfgOk := m.folderCfgs[folder]
+	fset, fsetOk := m.folderFiles[folder]
+	m.fmut.RUnlock()
+
+	if !cfgOk || !fsetOk {
+		return nil, errFolderMissing
+	}
+	if cfg.Paused {
+		return nil, ErrFolderPaused
+	}
+
+	ns := db.NewFolderStatisticsNamespace(m.db, folder)
+	resumeAfter, _, err := ns.String(verifyResumeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	fset.WithHaveTruncated(protocol.LocalDeviceID, func(fi db.FileIntf) bool {
+		if fi.IsDirectory() || fi.IsSymlink() || fi.IsDeleted() || fi.IsInvalid() {
+			return true
+		}
+		if name := fi.FileName(); name > resumeAfter {
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+
+	limit := rate.Inf
+	if cfg.VerifyMaxKiBps > 0 {
+		limit = rate.Limit(cfg.VerifyMaxKiBps) * 1024
+	}
+	limiter := rate.NewLimiter(limit, protocol.MinBlockSize)
+
+	results := make(chan VerifyResult)
+	go func() {
+		defer close(results)
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return
+			}
+			file, ok := fset.Get(protocol.LocalDeviceID, name)
+			if !ok || file.IsDeleted() || file.IsInvalid() {
+				// Changed since we listed it.
+				continue
+			}
+			res, err := verifyFile(ctx, cfg.Filesystem(), file, limiter)
+			if err != nil {
+				return
+			}
+			if res.Status == VerifyMismatch {
+				l.Infof("Verifying %s in folder %s: contents don't match the database: %v", name, cfg.Description(), res.Err)
+				if cfg.VerifyResync {
+					m.resyncFile(folder, file)
+				}
+			}
+			select {
+			case results <- res:
+			case <-ctx.Done():
+				return
+			}
+			if err := ns.PutString(verifyResumeKey, name); err != nil {
+				l.Debugln("Storing verification progress:", err)
+			}
+		}
+		if err := ns.Delete(verifyResumeKey); err != nil {
+			l.Debugln("Clearing verification progress:", err)
+		}
+	}()
+	return results, nil
+}
+
+// verifyFile reads the file block by block and validates it against the
+// block hashes. An error is returned only if the context ends first.
+func verifyFile(ctx context.Context, filesystem fs.Filesystem, file protocol.FileInfo, limiter *rate.Limiter) (VerifyResult, error) {
+	res := VerifyResult{Name: file.Name, Status: VerifyMismatch}
+
+	info, err := filesystem.Lstat(file.Name)
+	if fs.IsNotExist(err) || err == nil && !info.IsRegular() {
+		res.Status = VerifyMissing
+		return res, nil
+	} else if err != nil {
+		res.Err = err
+		return res, nil
+	}
+	if info.Size() != file.Size {
+		res.Err = errors.Errorf("size %d differs from %d", info.Size(), file.Size)
+		return res, nil
+	}
+
+	fd, err := filesystem.Open(file.Name)
+	if err != nil {
+		res.Err = err
+		return res, nil
+	}
+	defer fd.Close()
+
+	buf := make([]byte, file.BlockSize())
+	for _, block := range file.Blocks {
+		// Blocks may be larger than the burst, wait for them in parts.
+		for left := int(block.Size); left > 0; left -= limiter.Burst() {
+			n := left
+			if n > limiter.Burst() {
+				n = limiter.Burst()
+			}
+			if err := limiter.WaitN(ctx, n); err != nil {
+				return res, err
+			}
+		}
+		bs := buf[:block.Size]
+		if _, err := fd.ReadAt(bs, block.Offset); err != nil {
+			res.Err = err
+			return res, nil
+		}
+		if !scanner.Validate(bs, block.Hash, block.WeakHash) {
+			res.Err = errors.Errorf("block at offset %d has a different hash", block.Offset)
+			return res, nil
+		}
+	}
+	res.Status = VerifyOK
+	return res, nil
+}
+
+// resyncFile discards the local version of the file which failed
+// verification, so that it's pulled again from the other devices. It's
+// not rescanned, as that would announce the corrupted contents as a new
+// version.
+func (m *model) resyncFile(folder string, file protocol.FileInfo) {
+	m.fmut.RLock()
+	runner, ok := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return
+	}
+	r, ok := runner.(interface{ revertToGlobal(string) error })
+	if !ok {
+		l.Infof("Can't resync %s in folder %s: %v", file.Name, folder, errFolderNotPulling)
+		return
+	}
+	if err := r.revertToGlobal(file.Name); err != nil {
+		l.Infof("Can't resync %s in folder %s: %v", file.Name, folder, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// setupVerify returns a model with the given files, each of size bytes of
+// random data, scanned into the database.
+func setupVerify(t *testing.T, names []string, size int, modify func(*config.FolderConfiguration)) (*model, config.FolderConfiguration) {
+	t.Helper()
+
+	w, fcfg := tmpDefaultWrapper()
+	fcfg.RescanIntervalS = 0
+	if modify != nil {
+		modify(&fcfg)
+	}
+	waiter, err := w.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+
+	ffs := fcfg.Filesystem()
+	for _, name := range names {
+		writeVerifyFile(t, ffs, name, size)
+	}
+	m := setupModel(w)
+	return m, fcfg
+}
+
+func writeVerifyFile(t *testing.T, ffs fs.Filesystem, name string, size int) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	fd, err := ffs.Create(name)
+	must(t, err)
+	_, err = fd.Write(data)
+	must(t, err)
+	must(t, fd.Close())
+}
+
+func collectVerify(t *testing.T, m *model, ctx context.Context) []VerifyResult {
+	t.Helper()
+	results, err := m.VerifyFolder(ctx, "default")
+	must(t, err)
+	var res []VerifyResult
+	for r := range results {
+		res = append(res, r)
+	}
+	return res
+}
+
+func TestVerifyFolder(t *testing.T) {
+	m, fcfg := setupVerify(t, []string{"a", "b", "c", "d"}, 3*protocol.MinBlockSize, nil)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+	ffs := fcfg.Filesystem()
+
+	// Flip a byte in the last block of b, keeping the size and mtime.
+	info, err := ffs.Lstat("b")
+	must(t, err)
+	fd, err := ffs.OpenFile("b", fs.OptReadWrite, 0644)
+	must(t, err)
+	buf := make([]byte, 1)
+	_, err = fd.ReadAt(buf, 2*protocol.MinBlockSize+10)
+	must(t, err)
+	buf[0]++
+	_, err = fd.WriteAt(buf, 2*protocol.MinBlockSize+10)
+	must(t, err)
+	must(t, fd.Close())
+	must(t, ffs.Chtimes("b", info.ModTime(), info.ModTime()))
+
+	must(t, ffs.Remove("c"))
+
+	expected := map[string]VerifyStatus{
+		"a": VerifyOK,
+		"b": VerifyMismatch,
+		"c": VerifyMissing,
+		"d": VerifyOK,
+	}
+	res := collectVerify(t, m, context.Background())
+	if len(res) != len(expected) {
+		t.Fatalf("Expected %d results, got %v", len(expected), res)
+	}
+	for _, r := range res {
+		if r.Status != expected[r.Name] {
+			t.Errorf("%v: expected %v, got %v (%v)", r.Name, expected[r.Name], r.Status, r.Err)
+		}
+	}
+
+	// Without resync the database is left as is.
+	res = collectVerify(t, m, context.Background())
+	if len(res) != 4 || res[1].Status != VerifyMismatch {
+		t.Errorf("Expected the mismatch to remain, got %v", res)
+	}
+}
+
+func TestVerifyFolderResync(t *testing.T) {
+	m, fcfg := setupVerify(t, []string{"a"}, protocol.MinBlockSize, func(fcfg *config.FolderConfiguration) {
+		fcfg.VerifyResync = true
+	})
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+	ffs := fcfg.Filesystem()
+
+	info, err := ffs.Lstat("a")
+	must(t, err)
+	writeVerifyFile(t, ffs, "a", protocol.MinBlockSize)
+	must(t, ffs.Chtimes("a", info.ModTime(), info.ModTime()))
+
+	fset := m.folderFiles["default"]
+	orig, _ := fset.Get(protocol.LocalDeviceID, "a")
+
+	// No other device has the file, so there is nothing to pull and the
+	// corrupted contents must not turn into a new version.
+	res := collectVerify(t, m, context.Background())
+	if len(res) != 1 || res[0].Status != VerifyMismatch {
+		t.Fatalf("Expected a mismatch, got %v", res)
+	}
+	if cur, _ := fset.Get(protocol.LocalDeviceID, "a"); !cur.Version.Equal(orig.Version) || !protocol.BlocksEqual(cur.Blocks, orig.Blocks) {
+		t.Fatalf("Local file changed from %v to %v", orig, cur)
+	}
+
+	// Once another device has it, the local version is discarded so that
+	// it's pulled again.
+	must(t, m.Index(device1, "default", []protocol.FileInfo{orig}))
+	res = collectVerify(t, m, context.Background())
+	if len(res) != 1 || res[0].Status != VerifyMismatch {
+		t.Fatalf("Expected a mismatch, got %v", res)
+	}
+	if cur, _ := fset.Get(protocol.LocalDeviceID, "a"); len(cur.Version.Counters) != 0 {
+		t.Errorf("Expected the local version to be discarded, got %v", cur.Version)
+	}
+	if global, _ := fset.GetGlobal("a"); !global.Version.Equal(orig.Version) {
+		t.Errorf("Global version changed from %v to %v", orig.Version, global.Version)
+	}
+}
+
+func TestVerifyFolderConfigChange(t *testing.T) {
+	m, fcfg := setupVerify(t, []string{"a"}, protocol.MinBlockSize, nil)
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	// Verification settings apply without restarting the folder.
+	fcfg.VerifyResync = true
+	waiter, err := m.cfg.SetFolder(fcfg)
+	must(t, err)
+	waiter.Wait()
+	m.fmut.RLock()
+	resync := m.folderCfgs["default"].VerifyResync
+	m.fmut.RUnlock()
+	if !resync {
+		t.Error("Folder configuration wasn't updated")
+	}
+}
+
+func TestVerifyFolderCancel(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	m, fcfg := setupVerify(t, names, protocol.MinBlockSize, func(fcfg *config.FolderConfiguration) {
+		// The first block is in the burst, then a block per 100ms.
+		fcfg.VerifyMaxKiBps = protocol.MinBlockSize / 1024 * 10
+	})
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := m.VerifyFolder(ctx, "default")
+	must(t, err)
+	var seen []string
+	for r := range results {
+		seen = append(seen, r.Name)
+		if len(seen) == 2 {
+			cancel()
+		}
+	}
+	cancel()
+	if len(seen) < 2 || len(seen) == len(names) {
+		t.Fatalf("Expected the verification to stop early, got %v", seen)
+	}
+
+	// The next verification continues where the last one stopped.
+	res := collectVerify(t, m, context.Background())
+	if len(seen)+len(res) != len(names) || res[0].Name != names[len(seen)] {
+		t.Errorf("Expected to resume after %v, got %v", seen, res)
+	}
+
+	// After completing, the next one starts over.
+	if res := collectVerify(t, m, context.Background()); len(res) != len(names) {
+		t.Errorf("Expected to verify all files, got %v", res)
+	}
+}
+
+func TestVerifyFolderRateLimit(t *testing.T) {
+	m, fcfg := setupVerify(t, []string{"a"}, 4*protocol.MinBlockSize, func(fcfg *config.FolderConfiguration) {
+		fcfg.VerifyMaxKiBps = 2 * protocol.MinBlockSize / 1024
+	})
+	defer cleanupModelAndRemoveDir(m, fcfg.Filesystem().URI())
+
+	// One block is in the burst, the remaining three take 1.5s.
+	t0 := time.Now()
+	res := collectVerify(t, m, context.Background())
+	if d := time.Since(t0); d < time.Second {
+		t.Errorf("Verification took %v, expected it to be rate limited", d)
+	}
+	if len(res) != 1 || res[0].Status != VerifyOK {
+		t.Errorf("Unexpected result %v", res)
+	}
+}
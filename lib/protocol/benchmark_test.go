@@ -193,3 +193,11 @@ func (m *fakeModel) Closed(conn Connection, err error) {
 func (m *fakeModel) DownloadProgress(deviceID DeviceID, folder string, updates []FileDownloadProgressUpdate) error {
 	return nil
 }
+
+func (m *fakeModel) MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error) {
+	return nil, nil
+}
+
+func (m *fakeModel) RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+	return &fakeRequestResponse{make([]byte, size)}, nil
+}
@@ -34,17 +34,23 @@ const (
 	messageTypeDownloadProgress MessageType = 5
 	messageTypePing             MessageType = 6
 	messageTypeClose            MessageType = 7
+	messageTypeMetadataRequest  MessageType = 8
+	messageTypeMetadataResponse MessageType = 9
+	messageTypeRangeRequest     MessageType = 10
 )
 
 var MessageType_name = map[int32]string{
-	0: "CLUSTER_CONFIG",
-	1: "INDEX",
-	2: "INDEX_UPDATE",
-	3: "REQUEST",
-	4: "RESPONSE",
-	5: "DOWNLOAD_PROGRESS",
-	6: "PING",
-	7: "CLOSE",
+	0:  "CLUSTER_CONFIG",
+	1:  "INDEX",
+	2:  "INDEX_UPDATE",
+	3:  "REQUEST",
+	4:  "RESPONSE",
+	5:  "DOWNLOAD_PROGRESS",
+	6:  "PING",
+	7:  "CLOSE",
+	8:  "METADATA_REQUEST",
+	9:  "METADATA_RESPONSE",
+	10: "RANGE_REQUEST",
 }
 
 var MessageType_value = map[string]int32{
@@ -56,6 +62,9 @@ var MessageType_value = map[string]int32{
 	"DOWNLOAD_PROGRESS": 5,
 	"PING":              6,
 	"CLOSE":             7,
+	"METADATA_REQUEST":  8,
+	"METADATA_RESPONSE": 9,
+	"RANGE_REQUEST":     10,
 }
 
 func (x MessageType) String() string {
@@ -209,10 +218,54 @@ func (FileDownloadProgressUpdateType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_e3f59eb60afbbc6e, []int{5}
 }
 
+type CloseReason int32
+
+const (
+	CloseReasonUnknown       CloseReason = 0
+	CloseReasonShutdown      CloseReason = 1
+	CloseReasonDeviceRemoved CloseReason = 2
+	CloseReasonDevicePaused  CloseReason = 3
+	CloseReasonFolderChanged CloseReason = 4
+	CloseReasonProtocolError CloseReason = 5
+	CloseReasonReplaced      CloseReason = 6
+	CloseReasonIdle          CloseReason = 7
+)
+
+var CloseReason_name = map[int32]string{
+	0: "CLOSE_UNKNOWN",
+	1: "CLOSE_SHUTDOWN",
+	2: "CLOSE_DEVICE_REMOVED",
+	3: "CLOSE_DEVICE_PAUSED",
+	4: "CLOSE_FOLDER_CHANGED",
+	5: "CLOSE_PROTOCOL_ERROR",
+	6: "CLOSE_REPLACED",
+	7: "CLOSE_IDLE",
+}
+
+var CloseReason_value = map[string]int32{
+	"CLOSE_UNKNOWN":        0,
+	"CLOSE_SHUTDOWN":       1,
+	"CLOSE_DEVICE_REMOVED": 2,
+	"CLOSE_DEVICE_PAUSED":  3,
+	"CLOSE_FOLDER_CHANGED": 4,
+	"CLOSE_PROTOCOL_ERROR": 5,
+	"CLOSE_REPLACED":       6,
+	"CLOSE_IDLE":           7,
+}
+
+func (x CloseReason) String() string {
+	return proto.EnumName(CloseReason_name, int32(x))
+}
+
+func (CloseReason) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e3f59eb60afbbc6e, []int{6}
+}
+
 type Hello struct {
 	DeviceName    string `protobuf:"bytes,1,opt,name=device_name,json=deviceName,proto3" json:"device_name,omitempty"`
 	ClientName    string `protobuf:"bytes,2,opt,name=client_name,json=clientName,proto3" json:"client_name,omitempty"`
 	ClientVersion string `protobuf:"bytes,3,opt,name=client_version,json=clientVersion,proto3" json:"client_version,omitempty"`
+	Platform      string `protobuf:"bytes,4,opt,name=platform,proto3" json:"platform,omitempty"`
 }
 
 func (m *Hello) Reset()         { *m = Hello{} }
@@ -287,7 +340,9 @@ func (m *Header) XXX_DiscardUnknown() {
 var xxx_messageInfo_Header proto.InternalMessageInfo
 
 type ClusterConfig struct {
-	Folders []Folder `protobuf:"bytes,1,rep,name=folders,proto3" json:"folders"`
+	Folders               []Folder `protobuf:"bytes,1,rep,name=folders,proto3" json:"folders"`
+	Capabilities          []string `protobuf:"bytes,2,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	MaxConcurrentRequests int32    `protobuf:"varint,3,opt,name=max_concurrent_requests,json=maxConcurrentRequests,proto3" json:"max_concurrent_requests,omitempty"`
 }
 
 func (m *ClusterConfig) Reset()         { *m = ClusterConfig{} }
@@ -489,18 +544,21 @@ func (m *IndexUpdate) XXX_DiscardUnknown() {
 var xxx_messageInfo_IndexUpdate proto.InternalMessageInfo
 
 type FileInfo struct {
-	Name          string       `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Size          int64        `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
-	ModifiedS     int64        `protobuf:"varint,5,opt,name=modified_s,json=modifiedS,proto3" json:"modified_s,omitempty"`
-	ModifiedBy    ShortID      `protobuf:"varint,12,opt,name=modified_by,json=modifiedBy,proto3,customtype=ShortID" json:"modified_by"`
-	Version       Vector       `protobuf:"bytes,9,opt,name=version,proto3" json:"version"`
-	Sequence      int64        `protobuf:"varint,10,opt,name=sequence,proto3" json:"sequence,omitempty"`
-	Blocks        []BlockInfo  `protobuf:"bytes,16,rep,name=Blocks,proto3" json:"Blocks"`
-	SymlinkTarget string       `protobuf:"bytes,17,opt,name=symlink_target,json=symlinkTarget,proto3" json:"symlink_target,omitempty"`
-	Type          FileInfoType `protobuf:"varint,2,opt,name=type,proto3,enum=protocol.FileInfoType" json:"type,omitempty"`
-	Permissions   uint32       `protobuf:"varint,4,opt,name=permissions,proto3" json:"permissions,omitempty"`
-	ModifiedNs    int32        `protobuf:"varint,11,opt,name=modified_ns,json=modifiedNs,proto3" json:"modified_ns,omitempty"`
-	RawBlockSize  int32        `protobuf:"varint,13,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	Name          string      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size          int64       `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	ModifiedS     int64       `protobuf:"varint,5,opt,name=modified_s,json=modifiedS,proto3" json:"modified_s,omitempty"`
+	ModifiedBy    ShortID     `protobuf:"varint,12,opt,name=modified_by,json=modifiedBy,proto3,customtype=ShortID" json:"modified_by"`
+	Version       Vector      `protobuf:"bytes,9,opt,name=version,proto3" json:"version"`
+	Sequence      int64       `protobuf:"varint,10,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Blocks        []BlockInfo `protobuf:"bytes,16,rep,name=Blocks,proto3" json:"Blocks"`
+	SymlinkTarget string      `protobuf:"bytes,17,opt,name=symlink_target,json=symlinkTarget,proto3" json:"symlink_target,omitempty"`
+	// The name of another file in the folder that this one is hardlinked
+	// to, if it was scanned with hardlinks preserved.
+	HardlinkTarget string       `protobuf:"bytes,18,opt,name=hardlink_target,json=hardlinkTarget,proto3" json:"hardlink_target,omitempty"`
+	Type           FileInfoType `protobuf:"varint,2,opt,name=type,proto3,enum=protocol.FileInfoType" json:"type,omitempty"`
+	Permissions    uint32       `protobuf:"varint,4,opt,name=permissions,proto3" json:"permissions,omitempty"`
+	ModifiedNs     int32        `protobuf:"varint,11,opt,name=modified_ns,json=modifiedNs,proto3" json:"modified_ns,omitempty"`
+	RawBlockSize   int32        `protobuf:"varint,13,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
 	// The local_flags fields stores flags that are relevant to the local
 	// host only. It is not part of the protocol, doesn't get sent or
 	// received (we make sure to zero it), nonetheless we need it on our
@@ -740,6 +798,125 @@ func (m *Response) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_Response proto.InternalMessageInfo
 
+type MetadataRequest struct {
+	ID     int32  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Folder string `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	Prefix string `protobuf:"bytes,3,opt,name=prefix,proto3" json:"prefix,omitempty"`
+}
+
+func (m *MetadataRequest) Reset()         { *m = MetadataRequest{} }
+func (m *MetadataRequest) String() string { return proto.CompactTextString(m) }
+func (*MetadataRequest) ProtoMessage()    {}
+func (*MetadataRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e3f59eb60afbbc6e, []int{13}
+}
+func (m *MetadataRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MetadataRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MetadataRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MetadataRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetadataRequest.Merge(m, src)
+}
+func (m *MetadataRequest) XXX_Size() int {
+	return m.ProtoSize()
+}
+func (m *MetadataRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetadataRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetadataRequest proto.InternalMessageInfo
+
+type MetadataResponse struct {
+	ID    int32      `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Files []FileInfo `protobuf:"bytes,2,rep,name=files,proto3" json:"files"`
+	Code  ErrorCode  `protobuf:"varint,3,opt,name=code,proto3,enum=protocol.ErrorCode" json:"code,omitempty"`
+}
+
+func (m *MetadataResponse) Reset()         { *m = MetadataResponse{} }
+func (m *MetadataResponse) String() string { return proto.CompactTextString(m) }
+func (*MetadataResponse) ProtoMessage()    {}
+func (*MetadataResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e3f59eb60afbbc6e, []int{14}
+}
+func (m *MetadataResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MetadataResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MetadataResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MetadataResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetadataResponse.Merge(m, src)
+}
+func (m *MetadataResponse) XXX_Size() int {
+	return m.ProtoSize()
+}
+func (m *MetadataResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetadataResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetadataResponse proto.InternalMessageInfo
+
+type RangeRequest struct {
+	ID     int32  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Folder string `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	Name   string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Offset int64  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Size   int32  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+}
+
+func (m *RangeRequest) Reset()         { *m = RangeRequest{} }
+func (m *RangeRequest) String() string { return proto.CompactTextString(m) }
+func (*RangeRequest) ProtoMessage()    {}
+func (*RangeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e3f59eb60afbbc6e, []int{15}
+}
+func (m *RangeRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RangeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RangeRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RangeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RangeRequest.Merge(m, src)
+}
+func (m *RangeRequest) XXX_Size() int {
+	return m.ProtoSize()
+}
+func (m *RangeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RangeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RangeRequest proto.InternalMessageInfo
+
 type DownloadProgress struct {
 	Folder  string                       `protobuf:"bytes,1,opt,name=folder,proto3" json:"folder,omitempty"`
 	Updates []FileDownloadProgressUpdate `protobuf:"bytes,2,rep,name=updates,proto3" json:"updates"`
@@ -749,7 +926,7 @@ func (m *DownloadProgress) Reset()         { *m = DownloadProgress{} }
 func (m *DownloadProgress) String() string { return proto.CompactTextString(m) }
 func (*DownloadProgress) ProtoMessage()    {}
 func (*DownloadProgress) Descriptor() ([]byte, []int) {
-	return fileDescriptor_e3f59eb60afbbc6e, []int{13}
+	return fileDescriptor_e3f59eb60afbbc6e, []int{16}
 }
 func (m *DownloadProgress) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -789,7 +966,7 @@ func (m *FileDownloadProgressUpdate) Reset()         { *m = FileDownloadProgress
 func (m *FileDownloadProgressUpdate) String() string { return proto.CompactTextString(m) }
 func (*FileDownloadProgressUpdate) ProtoMessage()    {}
 func (*FileDownloadProgressUpdate) Descriptor() ([]byte, []int) {
-	return fileDescriptor_e3f59eb60afbbc6e, []int{14}
+	return fileDescriptor_e3f59eb60afbbc6e, []int{17}
 }
 func (m *FileDownloadProgressUpdate) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -819,13 +996,15 @@ func (m *FileDownloadProgressUpdate) XXX_DiscardUnknown() {
 var xxx_messageInfo_FileDownloadProgressUpdate proto.InternalMessageInfo
 
 type Ping struct {
+	ID       int32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Response bool  `protobuf:"varint,2,opt,name=response,proto3" json:"response,omitempty"`
 }
 
 func (m *Ping) Reset()         { *m = Ping{} }
 func (m *Ping) String() string { return proto.CompactTextString(m) }
 func (*Ping) ProtoMessage()    {}
 func (*Ping) Descriptor() ([]byte, []int) {
-	return fileDescriptor_e3f59eb60afbbc6e, []int{15}
+	return fileDescriptor_e3f59eb60afbbc6e, []int{18}
 }
 func (m *Ping) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -855,14 +1034,15 @@ func (m *Ping) XXX_DiscardUnknown() {
 var xxx_messageInfo_Ping proto.InternalMessageInfo
 
 type Close struct {
-	Reason string `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	Reason string      `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	Code   CloseReason `protobuf:"varint,2,opt,name=code,proto3,enum=protocol.CloseReason" json:"code,omitempty"`
 }
 
 func (m *Close) Reset()         { *m = Close{} }
 func (m *Close) String() string { return proto.CompactTextString(m) }
 func (*Close) ProtoMessage()    {}
 func (*Close) Descriptor() ([]byte, []int) {
-	return fileDescriptor_e3f59eb60afbbc6e, []int{16}
+	return fileDescriptor_e3f59eb60afbbc6e, []int{19}
 }
 func (m *Close) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -898,6 +1078,7 @@ func init() {
 	proto.RegisterEnum("protocol.FileInfoType", FileInfoType_name, FileInfoType_value)
 	proto.RegisterEnum("protocol.ErrorCode", ErrorCode_name, ErrorCode_value)
 	proto.RegisterEnum("protocol.FileDownloadProgressUpdateType", FileDownloadProgressUpdateType_name, FileDownloadProgressUpdateType_value)
+	proto.RegisterEnum("protocol.CloseReason", CloseReason_name, CloseReason_value)
 	proto.RegisterType((*Hello)(nil), "protocol.Hello")
 	proto.RegisterType((*Header)(nil), "protocol.Header")
 	proto.RegisterType((*ClusterConfig)(nil), "protocol.ClusterConfig")
@@ -911,6 +1092,9 @@ func init() {
 	proto.RegisterType((*Counter)(nil), "protocol.Counter")
 	proto.RegisterType((*Request)(nil), "protocol.Request")
 	proto.RegisterType((*Response)(nil), "protocol.Response")
+	proto.RegisterType((*MetadataRequest)(nil), "protocol.MetadataRequest")
+	proto.RegisterType((*MetadataResponse)(nil), "protocol.MetadataResponse")
+	proto.RegisterType((*RangeRequest)(nil), "protocol.RangeRequest")
 	proto.RegisterType((*DownloadProgress)(nil), "protocol.DownloadProgress")
 	proto.RegisterType((*FileDownloadProgressUpdate)(nil), "protocol.FileDownloadProgressUpdate")
 	proto.RegisterType((*Ping)(nil), "protocol.Ping")
@@ -920,120 +1104,144 @@ func init() {
 func init() { proto.RegisterFile("bep.proto", fileDescriptor_e3f59eb60afbbc6e) }
 
 var fileDescriptor_e3f59eb60afbbc6e = []byte{
-	// 1803 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0xcf, 0x6f, 0xdb, 0xc8,
-	0x15, 0x16, 0x25, 0xea, 0xd7, 0x93, 0xec, 0xa5, 0x27, 0x89, 0xcb, 0x32, 0x59, 0x89, 0x51, 0x92,
-	0x8d, 0xd6, 0xd8, 0x26, 0xe9, 0xee, 0xb6, 0x45, 0x8b, 0xb6, 0x80, 0x7e, 0xd0, 0x8e, 0x50, 0x47,
-	0x72, 0x47, 0x72, 0xb6, 0xd9, 0x43, 0x09, 0x5a, 0x1c, 0xc9, 0x44, 0x28, 0x8e, 0x4a, 0x52, 0x76,
-	0xb4, 0x7f, 0x82, 0x4e, 0x3d, 0xf6, 0x22, 0x60, 0x81, 0x9e, 0xfa, 0x9f, 0xe4, 0x98, 0xf6, 0x50,
-	0x14, 0x3d, 0x18, 0x5d, 0xe7, 0xb2, 0xc7, 0xfe, 0x05, 0x45, 0x31, 0x33, 0xa4, 0x44, 0xd9, 0x9b,
-	0x45, 0x0e, 0x7b, 0xd2, 0xcc, 0x7b, 0x1f, 0xdf, 0xcc, 0x7c, 0xf3, 0xbd, 0x6f, 0x04, 0xc5, 0x13,
-	0x32, 0x7d, 0x34, 0xf5, 0x69, 0x48, 0x51, 0x81, 0xff, 0x0c, 0xa9, 0xab, 0xdd, 0xf3, 0xc9, 0x94,
-	0x06, 0x8f, 0xf9, 0xfc, 0x64, 0x36, 0x7a, 0x3c, 0xa6, 0x63, 0xca, 0x27, 0x7c, 0x24, 0xe0, 0xb5,
-	0x29, 0x64, 0x9f, 0x12, 0xd7, 0xa5, 0xa8, 0x0a, 0x25, 0x9b, 0x9c, 0x39, 0x43, 0x62, 0x7a, 0xd6,
-	0x84, 0xa8, 0x92, 0x2e, 0xd5, 0x8b, 0x18, 0x44, 0xa8, 0x6b, 0x4d, 0x08, 0x03, 0x0c, 0x5d, 0x87,
-	0x78, 0xa1, 0x00, 0xa4, 0x05, 0x40, 0x84, 0x38, 0xe0, 0x01, 0x6c, 0x47, 0x80, 0x33, 0xe2, 0x07,
-	0x0e, 0xf5, 0xd4, 0x0c, 0xc7, 0x6c, 0x89, 0xe8, 0x73, 0x11, 0xac, 0x05, 0x90, 0x7b, 0x4a, 0x2c,
-	0x9b, 0xf8, 0xe8, 0x63, 0x90, 0xc3, 0xf9, 0x54, 0xac, 0xb5, 0xfd, 0xe9, 0xad, 0x47, 0xf1, 0xce,
-	0x1f, 0x3d, 0x23, 0x41, 0x60, 0x8d, 0xc9, 0x60, 0x3e, 0x25, 0x98, 0x43, 0xd0, 0x6f, 0xa1, 0x34,
-	0xa4, 0x93, 0xa9, 0x4f, 0x02, 0x5e, 0x38, 0xcd, 0xbf, 0xb8, 0x73, 0xed, 0x8b, 0xd6, 0x1a, 0x83,
-	0x93, 0x1f, 0xd4, 0x1a, 0xb0, 0xd5, 0x72, 0x67, 0x41, 0x48, 0xfc, 0x16, 0xf5, 0x46, 0xce, 0x18,
-	0x3d, 0x81, 0xfc, 0x88, 0xba, 0x36, 0xf1, 0x03, 0x55, 0xd2, 0x33, 0xf5, 0xd2, 0xa7, 0xca, 0xba,
-	0xd8, 0x3e, 0x4f, 0x34, 0xe5, 0xd7, 0x17, 0xd5, 0x14, 0x8e, 0x61, 0xb5, 0xbf, 0xa6, 0x21, 0x27,
-	0x32, 0x68, 0x17, 0xd2, 0x8e, 0x2d, 0x28, 0x6a, 0xe6, 0x2e, 0x2f, 0xaa, 0xe9, 0x4e, 0x1b, 0xa7,
-	0x1d, 0x1b, 0xdd, 0x84, 0xac, 0x6b, 0x9d, 0x10, 0x37, 0x22, 0x47, 0x4c, 0xd0, 0x6d, 0x28, 0xfa,
-	0xc4, 0xb2, 0x4d, 0xea, 0xb9, 0x73, 0x4e, 0x49, 0x01, 0x17, 0x58, 0xa0, 0xe7, 0xb9, 0x73, 0xf4,
-	0x13, 0x40, 0xce, 0xd8, 0xa3, 0x3e, 0x31, 0xa7, 0xc4, 0x9f, 0x38, 0x7c, 0xb7, 0x81, 0x2a, 0x73,
-	0xd4, 0x8e, 0xc8, 0x1c, 0xad, 0x13, 0xe8, 0x1e, 0x6c, 0x45, 0x70, 0x9b, 0xb8, 0x24, 0x24, 0x6a,
-	0x96, 0x23, 0xcb, 0x22, 0xd8, 0xe6, 0x31, 0xf4, 0x04, 0x6e, 0xda, 0x4e, 0x60, 0x9d, 0xb8, 0xc4,
-	0x0c, 0xc9, 0x64, 0x6a, 0x3a, 0x9e, 0x4d, 0x5e, 0x91, 0x40, 0xcd, 0x71, 0x2c, 0x8a, 0x72, 0x03,
-	0x32, 0x99, 0x76, 0x44, 0x06, 0xed, 0x42, 0x6e, 0x6a, 0xcd, 0x02, 0x62, 0xab, 0x79, 0x8e, 0x89,
-	0x66, 0x8c, 0x25, 0xa1, 0x80, 0x40, 0x55, 0xae, 0xb2, 0xd4, 0xe6, 0x89, 0x98, 0xa5, 0x08, 0x56,
-	0xfb, 0x6f, 0x1a, 0x72, 0x22, 0x83, 0x3e, 0x5a, 0xb1, 0x54, 0x6e, 0xee, 0x32, 0xd4, 0xbf, 0x2f,
-	0xaa, 0x05, 0x91, 0xeb, 0xb4, 0x13, 0xac, 0x21, 0x90, 0x13, 0x8a, 0xe2, 0x63, 0x74, 0x07, 0x8a,
-	0x96, 0x6d, 0xb3, 0xdb, 0x23, 0x81, 0x9a, 0xd1, 0x33, 0xf5, 0x22, 0x5e, 0x07, 0xd0, 0x2f, 0x36,
-	0xd5, 0x20, 0x5f, 0xd5, 0xcf, 0xbb, 0x64, 0xc0, 0xae, 0x62, 0x48, 0xfc, 0x48, 0xc1, 0x59, 0xbe,
-	0x5e, 0x81, 0x05, 0xb8, 0x7e, 0xef, 0x42, 0x79, 0x62, 0xbd, 0x32, 0x03, 0xf2, 0xa7, 0x19, 0xf1,
-	0x86, 0x84, 0xd3, 0x95, 0xc1, 0xa5, 0x89, 0xf5, 0xaa, 0x1f, 0x85, 0x50, 0x05, 0xc0, 0xf1, 0x42,
-	0x9f, 0xda, 0xb3, 0x21, 0xf1, 0x23, 0xae, 0x12, 0x11, 0xf4, 0x33, 0x28, 0x70, 0xb2, 0x4d, 0xc7,
-	0x56, 0x0b, 0xba, 0x54, 0x97, 0x9b, 0x5a, 0x74, 0xf0, 0x3c, 0xa7, 0x9a, 0x9f, 0x3b, 0x1e, 0xe2,
-	0x3c, 0xc7, 0x76, 0x6c, 0xf4, 0x6b, 0xd0, 0x82, 0x97, 0x0e, 0xbb, 0x28, 0x51, 0x29, 0x74, 0xa8,
-	0x67, 0xfa, 0x64, 0x42, 0xcf, 0x2c, 0x37, 0x50, 0x8b, 0x7c, 0x19, 0x95, 0x21, 0x3a, 0x09, 0x00,
-	0x8e, 0xf2, 0xb5, 0x1e, 0x64, 0x79, 0x45, 0x76, 0x8b, 0x42, 0xac, 0x51, 0xf7, 0x46, 0x33, 0xf4,
-	0x08, 0xb2, 0x23, 0xc7, 0x25, 0x81, 0x9a, 0xe6, 0x77, 0x88, 0x12, 0x4a, 0x77, 0x5c, 0xd2, 0xf1,
-	0x46, 0x34, 0xba, 0x45, 0x01, 0xab, 0x1d, 0x43, 0x89, 0x17, 0x3c, 0x9e, 0xda, 0x56, 0x48, 0x7e,
-	0xb0, 0xb2, 0x17, 0x32, 0x14, 0xe2, 0xcc, 0xea, 0xd2, 0xa5, 0xc4, 0xa5, 0x23, 0x90, 0x03, 0xe7,
-	0x2b, 0xc2, 0x7b, 0x24, 0x83, 0xf9, 0x18, 0x7d, 0x08, 0x30, 0xa1, 0xb6, 0x33, 0x72, 0x88, 0x6d,
-	0x06, 0xfc, 0xca, 0x32, 0xb8, 0x18, 0x47, 0xfa, 0xe8, 0x09, 0x94, 0x56, 0xe9, 0x93, 0xb9, 0x5a,
-	0xe6, 0x9c, 0x7f, 0x10, 0x73, 0xde, 0x3f, 0xa5, 0x7e, 0xd8, 0x69, 0xe3, 0x55, 0x89, 0xe6, 0x9c,
-	0x49, 0x3a, 0xb6, 0x27, 0x46, 0xec, 0x86, 0xa4, 0x9f, 0x93, 0x61, 0x48, 0x57, 0x8d, 0x1f, 0xc1,
-	0x90, 0x06, 0x85, 0x95, 0x26, 0x80, 0x6f, 0x60, 0x35, 0x47, 0x3f, 0x85, 0x5c, 0xd3, 0xa5, 0xc3,
-	0x97, 0x71, 0x7f, 0xdc, 0x58, 0x17, 0xe3, 0xf1, 0x04, 0x0b, 0x11, 0x90, 0xd9, 0x64, 0x30, 0x9f,
-	0xb8, 0x8e, 0xf7, 0xd2, 0x0c, 0x2d, 0x7f, 0x4c, 0x42, 0x75, 0x47, 0xd8, 0x64, 0x14, 0x1d, 0xf0,
-	0x20, 0xda, 0x8b, 0xcc, 0x51, 0x58, 0xdd, 0xee, 0x75, 0x72, 0x13, 0xee, 0xa8, 0x43, 0xe9, 0xaa,
-	0x7b, 0x6c, 0xe1, 0x64, 0x88, 0x99, 0xf7, 0x8a, 0x27, 0x2f, 0x50, 0x4b, 0xba, 0x54, 0xcf, 0xae,
-	0x69, 0xe9, 0x06, 0xe8, 0x31, 0xc0, 0x09, 0xdb, 0x9f, 0xc9, 0x6f, 0x60, 0x8b, 0xe5, 0x9b, 0xca,
-	0xe5, 0x45, 0xb5, 0x8c, 0xad, 0x73, 0xbe, 0xf1, 0xbe, 0xf3, 0x15, 0xc1, 0xc5, 0x93, 0x78, 0xc8,
-	0xd6, 0x74, 0xe9, 0xd0, 0x72, 0xcd, 0x91, 0x6b, 0x8d, 0x03, 0xf5, 0xdb, 0x3c, 0x5f, 0x14, 0x78,
-	0x6c, 0x9f, 0x85, 0x90, 0xca, 0xcc, 0x83, 0x19, 0x92, 0x1d, 0x39, 0x4f, 0x3c, 0x45, 0x75, 0xc8,
-	0x3b, 0xde, 0x99, 0xe5, 0x3a, 0x91, 0xdf, 0x34, 0xb7, 0x2f, 0x2f, 0xaa, 0x80, 0xad, 0xf3, 0x8e,
-	0x88, 0xe2, 0x38, 0xcd, 0xc8, 0xf2, 0xe8, 0x86, 0x35, 0x16, 0x78, 0xa9, 0x2d, 0x8f, 0x26, 0x6c,
-	0xf1, 0x57, 0xf2, 0x5f, 0xbe, 0xae, 0xa6, 0x6a, 0x1e, 0x14, 0x57, 0xa4, 0x33, 0x31, 0x9d, 0x5a,
-	0xc1, 0x29, 0x17, 0x53, 0x19, 0xf3, 0x31, 0x53, 0x32, 0x1d, 0x8d, 0x02, 0x12, 0x72, 0xd9, 0x65,
-	0x70, 0x34, 0x5b, 0x09, 0x2f, 0xcd, 0x69, 0x11, 0xc2, 0xbb, 0x0d, 0xc5, 0x73, 0x62, 0xbd, 0x34,
-	0x79, 0x11, 0xc1, 0x68, 0x81, 0x05, 0x9e, 0x5a, 0xc1, 0x69, 0xb4, 0xde, 0x6f, 0x20, 0x27, 0x14,
-	0x83, 0x3e, 0x83, 0xc2, 0x90, 0xce, 0xbc, 0x70, 0xfd, 0x9c, 0xec, 0x24, 0xdd, 0x88, 0x67, 0x22,
-	0x19, 0xac, 0x80, 0xb5, 0x7d, 0xc8, 0x47, 0x29, 0xf4, 0x60, 0x65, 0x95, 0x72, 0xf3, 0xd6, 0x15,
-	0xf5, 0x6e, 0xbe, 0x2f, 0x67, 0x96, 0x3b, 0x13, 0x1b, 0x95, 0xb1, 0x98, 0xd4, 0xfe, 0x2e, 0x41,
-	0x1e, 0x33, 0x41, 0x06, 0x61, 0xe2, 0x65, 0xca, 0x6e, 0xbc, 0x4c, 0xeb, 0x1e, 0x4e, 0x6f, 0xf4,
-	0x70, 0xdc, 0x86, 0x99, 0x44, 0x1b, 0xae, 0x59, 0x92, 0xbf, 0x93, 0xa5, 0x6c, 0x82, 0xa5, 0x98,
-	0xe5, 0x5c, 0x82, 0xe5, 0x07, 0xb0, 0x3d, 0xf2, 0xe9, 0x84, 0xbf, 0x3d, 0xd4, 0xb7, 0xfc, 0x79,
-	0x64, 0x94, 0x5b, 0x2c, 0x3a, 0x88, 0x83, 0x9b, 0x04, 0x17, 0x36, 0x09, 0xae, 0x99, 0x50, 0xc0,
-	0x24, 0x98, 0x52, 0x2f, 0x20, 0xef, 0x3c, 0x13, 0x02, 0xd9, 0xb6, 0x42, 0x8b, 0x9f, 0xa8, 0x8c,
-	0xf9, 0x18, 0x3d, 0x04, 0x79, 0x48, 0x6d, 0x71, 0x9e, 0xed, 0x64, 0x37, 0x1a, 0xbe, 0x4f, 0xfd,
-	0x16, 0xb5, 0x09, 0xe6, 0x80, 0xda, 0x14, 0x94, 0x36, 0x3d, 0xf7, 0x5c, 0x6a, 0xd9, 0x47, 0x3e,
-	0x1d, 0xb3, 0x07, 0xe2, 0x9d, 0x46, 0xd7, 0x86, 0xfc, 0x8c, 0x5b, 0x61, 0x6c, 0x75, 0xf7, 0x37,
-	0xbb, 0xf1, 0x6a, 0x21, 0xe1, 0x9b, 0xb1, 0x8d, 0x44, 0x9f, 0xd6, 0xfe, 0x29, 0x81, 0xf6, 0x6e,
-	0x34, 0xea, 0x40, 0x49, 0x20, 0xcd, 0xc4, 0x7f, 0xa2, 0xfa, 0xfb, 0x2c, 0xc4, 0x8d, 0x00, 0x66,
-	0xab, 0xf1, 0x77, 0x3e, 0xa8, 0x09, 0xdb, 0xcb, 0xbc, 0x9f, 0xed, 0x3d, 0x84, 0x2d, 0xe1, 0x08,
-	0xf1, 0xdf, 0x07, 0x59, 0xcf, 0xd4, 0xb3, 0xcd, 0xb4, 0x92, 0xc2, 0xe5, 0x13, 0xd1, 0x66, 0x3c,
-	0x5e, 0xcb, 0x81, 0x7c, 0xe4, 0x78, 0xe3, 0x5a, 0x15, 0xb2, 0x2d, 0x97, 0xf2, 0x0b, 0xcb, 0xf9,
-	0xc4, 0x0a, 0xa8, 0x17, 0xf3, 0x28, 0x66, 0x7b, 0xff, 0x48, 0x43, 0x29, 0xf1, 0xd7, 0x0e, 0x3d,
-	0x81, 0xed, 0xd6, 0xe1, 0x71, 0x7f, 0x60, 0x60, 0xb3, 0xd5, 0xeb, 0xee, 0x77, 0x0e, 0x94, 0x94,
-	0x76, 0x67, 0xb1, 0xd4, 0xd5, 0xc9, 0x1a, 0xb4, 0xf9, 0xaf, 0xad, 0x0a, 0xd9, 0x4e, 0xb7, 0x6d,
-	0xfc, 0x41, 0x91, 0xb4, 0x9b, 0x8b, 0xa5, 0xae, 0x24, 0x80, 0xe2, 0x09, 0xfc, 0x04, 0xca, 0x1c,
-	0x60, 0x1e, 0x1f, 0xb5, 0x1b, 0x03, 0x43, 0x49, 0x6b, 0xda, 0x62, 0xa9, 0xef, 0x5e, 0xc5, 0x45,
-	0x9c, 0xdf, 0x83, 0x3c, 0x36, 0x7e, 0x7f, 0x6c, 0xf4, 0x07, 0x4a, 0x46, 0xdb, 0x5d, 0x2c, 0x75,
-	0x94, 0x00, 0xc6, 0x2d, 0xf5, 0x00, 0x0a, 0xd8, 0xe8, 0x1f, 0xf5, 0xba, 0x7d, 0x43, 0x91, 0xb5,
-	0x1f, 0x2d, 0x96, 0xfa, 0x8d, 0x0d, 0x54, 0xa4, 0xd2, 0x9f, 0xc3, 0x4e, 0xbb, 0xf7, 0x45, 0xf7,
-	0xb0, 0xd7, 0x68, 0x9b, 0x47, 0xb8, 0x77, 0x80, 0x8d, 0x7e, 0x5f, 0xc9, 0x6a, 0xd5, 0xc5, 0x52,
-	0xbf, 0x9d, 0xc0, 0x5f, 0x13, 0xdd, 0x87, 0x20, 0x1f, 0x75, 0xba, 0x07, 0x4a, 0x4e, 0xbb, 0xb1,
-	0x58, 0xea, 0x1f, 0x24, 0xa0, 0x8c, 0x54, 0x76, 0xe2, 0xd6, 0x61, 0xaf, 0x6f, 0x28, 0xf9, 0x6b,
-	0x27, 0xe6, 0x64, 0xef, 0xfd, 0x11, 0xd0, 0xf5, 0x3f, 0xbf, 0xe8, 0x3e, 0xc8, 0xdd, 0x5e, 0xd7,
-	0x50, 0x52, 0xe2, 0xfc, 0xd7, 0x11, 0x5d, 0xea, 0x11, 0x54, 0x83, 0xcc, 0xe1, 0x97, 0x9f, 0x2b,
-	0x92, 0xf6, 0xe3, 0xc5, 0x52, 0xbf, 0x75, 0x1d, 0x74, 0xf8, 0xe5, 0xe7, 0x7b, 0x14, 0x4a, 0xc9,
-	0xc2, 0x35, 0x28, 0x3c, 0x33, 0x06, 0x8d, 0x76, 0x63, 0xd0, 0x50, 0x52, 0x62, 0x4b, 0x71, 0xfa,
-	0x19, 0x09, 0x2d, 0xde, 0x84, 0x77, 0x20, 0xdb, 0x35, 0x9e, 0x1b, 0x58, 0x91, 0xb4, 0x9d, 0xc5,
-	0x52, 0xdf, 0x8a, 0x01, 0x5d, 0x72, 0x46, 0x7c, 0x54, 0x81, 0x5c, 0xe3, 0xf0, 0x8b, 0xc6, 0x8b,
-	0xbe, 0x92, 0xd6, 0xd0, 0x62, 0xa9, 0x6f, 0xc7, 0xe9, 0x86, 0x7b, 0x6e, 0xcd, 0x83, 0xbd, 0xff,
-	0x49, 0x50, 0x4e, 0xbe, 0x71, 0xa8, 0x02, 0xf2, 0x7e, 0xe7, 0xd0, 0x88, 0x97, 0x4b, 0xe6, 0xd8,
-	0x18, 0xd5, 0xa1, 0xd8, 0xee, 0x60, 0xa3, 0x35, 0xe8, 0xe1, 0x17, 0xf1, 0x59, 0x92, 0xa0, 0xb6,
-	0xe3, 0x73, 0x81, 0xcf, 0xd1, 0x2f, 0xa1, 0xdc, 0x7f, 0xf1, 0xec, 0xb0, 0xd3, 0xfd, 0x9d, 0xc9,
-	0x2b, 0xa6, 0xb5, 0x87, 0x8b, 0xa5, 0x7e, 0x77, 0x03, 0x4c, 0xa6, 0x3e, 0x19, 0x5a, 0x21, 0xb1,
-	0xfb, 0xe2, 0x39, 0x66, 0xc9, 0x82, 0x84, 0x5a, 0xb0, 0x13, 0x7f, 0xba, 0x5e, 0x2c, 0xa3, 0x7d,
-	0xb2, 0x58, 0xea, 0x1f, 0x7d, 0xef, 0xf7, 0xab, 0xd5, 0x0b, 0x12, 0xba, 0x0f, 0xf9, 0xa8, 0x48,
-	0xac, 0xa4, 0xe4, 0xa7, 0xd1, 0x07, 0x7b, 0x7f, 0x93, 0xa0, 0xb8, 0xb2, 0x2b, 0x46, 0x78, 0xb7,
-	0x67, 0x1a, 0x18, 0xf7, 0x70, 0xcc, 0xc0, 0x2a, 0xd9, 0xa5, 0x7c, 0x88, 0xee, 0x42, 0xfe, 0xc0,
-	0xe8, 0x1a, 0xb8, 0xd3, 0x8a, 0x1b, 0x63, 0x05, 0x39, 0x20, 0x1e, 0xf1, 0x9d, 0x21, 0xfa, 0x18,
-	0xca, 0xdd, 0x9e, 0xd9, 0x3f, 0x6e, 0x3d, 0x8d, 0x8f, 0xce, 0xd7, 0x4f, 0x94, 0xea, 0xcf, 0x86,
-	0xa7, 0x9c, 0xcf, 0x3d, 0xd6, 0x43, 0xcf, 0x1b, 0x87, 0x9d, 0xb6, 0x80, 0x66, 0x34, 0x75, 0xb1,
-	0xd4, 0x6f, 0xae, 0xa0, 0xd1, 0x23, 0xcd, 0xb0, 0x7b, 0x36, 0x54, 0xbe, 0xdf, 0x98, 0x90, 0x0e,
-	0xb9, 0xc6, 0xd1, 0x91, 0xd1, 0x6d, 0xc7, 0xbb, 0x5f, 0xe7, 0x1a, 0xd3, 0x29, 0xf1, 0x6c, 0x86,
-	0xd8, 0xef, 0xe1, 0x03, 0x63, 0x10, 0x6f, 0x7e, 0x8d, 0xd8, 0xa7, 0xec, 0xbf, 0x50, 0xb3, 0xfe,
-	0xfa, 0x9b, 0x4a, 0xea, 0xcd, 0x37, 0x95, 0xd4, 0xeb, 0xcb, 0x8a, 0xf4, 0xe6, 0xb2, 0x22, 0xfd,
-	0xe7, 0xb2, 0x92, 0xfa, 0xf6, 0xb2, 0x22, 0xfd, 0xf9, 0x6d, 0x25, 0xf5, 0xf5, 0xdb, 0x8a, 0xf4,
-	0xe6, 0x6d, 0x25, 0xf5, 0xaf, 0xb7, 0x95, 0xd4, 0x49, 0x8e, 0x9b, 0xda, 0x67, 0xff, 0x0f, 0x00,
-	0x00, 0xff, 0xff, 0xd6, 0x0e, 0x8e, 0xa4, 0x11, 0x0f, 0x00, 0x00,
+	// 2184 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x58, 0xcf, 0x6f, 0xdb, 0xc8,
+	0x15, 0x16, 0xf5, 0x5b, 0x4f, 0xb2, 0x43, 0x4f, 0x12, 0x47, 0x65, 0xb2, 0xb2, 0xa2, 0x24, 0x1b,
+	0xc7, 0xdd, 0x26, 0x69, 0x36, 0x4d, 0xd1, 0x45, 0x5b, 0x40, 0x16, 0x69, 0x5b, 0x5d, 0x45, 0x52,
+	0x47, 0xb2, 0xd3, 0xec, 0xa1, 0x04, 0x2d, 0x8e, 0x6c, 0x22, 0x14, 0x47, 0x25, 0x29, 0x3b, 0xde,
+	0x43, 0x2f, 0x3d, 0x14, 0x10, 0x7a, 0xe8, 0xa5, 0x40, 0x2f, 0x02, 0x16, 0xe8, 0xa9, 0xff, 0x49,
+	0x8e, 0xe9, 0xa5, 0x28, 0x7a, 0x08, 0xba, 0xce, 0x65, 0x8f, 0xfb, 0x17, 0x14, 0xc5, 0xcc, 0x90,
+	0x14, 0x65, 0x6d, 0xb6, 0x69, 0x51, 0xa0, 0x27, 0xcf, 0xbc, 0xf7, 0xcd, 0x8c, 0xde, 0xf7, 0xde,
+	0xfb, 0x66, 0x68, 0x28, 0x1c, 0x92, 0xf1, 0xfd, 0xb1, 0x4b, 0x7d, 0x8a, 0xf2, 0xfc, 0xcf, 0x80,
+	0xda, 0xca, 0x2d, 0x97, 0x8c, 0xa9, 0xf7, 0x80, 0xcf, 0x0f, 0x27, 0xc3, 0x07, 0x47, 0xf4, 0x88,
+	0xf2, 0x09, 0x1f, 0x09, 0x78, 0xed, 0x77, 0x12, 0x64, 0xf6, 0x88, 0x6d, 0x53, 0xb4, 0x01, 0x45,
+	0x93, 0x9c, 0x58, 0x03, 0xa2, 0x3b, 0xc6, 0x88, 0x94, 0xa5, 0xaa, 0xb4, 0x59, 0xc0, 0x20, 0x4c,
+	0x6d, 0x63, 0x44, 0x18, 0x60, 0x60, 0x5b, 0xc4, 0xf1, 0x05, 0x20, 0x29, 0x00, 0xc2, 0xc4, 0x01,
+	0x77, 0x60, 0x35, 0x00, 0x9c, 0x10, 0xd7, 0xb3, 0xa8, 0x53, 0x4e, 0x71, 0xcc, 0x8a, 0xb0, 0x1e,
+	0x08, 0x23, 0x52, 0x20, 0x3f, 0xb6, 0x0d, 0x7f, 0x48, 0xdd, 0x51, 0x39, 0xcd, 0x01, 0xd1, 0xbc,
+	0xe6, 0x41, 0x76, 0x8f, 0x18, 0x26, 0x71, 0xd1, 0x3d, 0x48, 0xfb, 0x67, 0x63, 0xf1, 0x3b, 0x56,
+	0x1f, 0x5d, 0xbd, 0x1f, 0x86, 0x75, 0xff, 0x29, 0xf1, 0x3c, 0xe3, 0x88, 0xf4, 0xcf, 0xc6, 0x04,
+	0x73, 0x08, 0xfa, 0x29, 0x14, 0x07, 0x74, 0x34, 0x76, 0x89, 0xc7, 0x0f, 0x4d, 0xf2, 0x15, 0x37,
+	0x96, 0x56, 0x34, 0xe6, 0x18, 0x1c, 0x5f, 0x50, 0x9b, 0x49, 0xb0, 0xd2, 0xb0, 0x27, 0x9e, 0x4f,
+	0xdc, 0x06, 0x75, 0x86, 0xd6, 0x11, 0x7a, 0x08, 0xb9, 0x21, 0xb5, 0x4d, 0xe2, 0x7a, 0x65, 0xa9,
+	0x9a, 0xda, 0x2c, 0x3e, 0x92, 0xe7, 0xbb, 0xed, 0x70, 0xc7, 0x76, 0xfa, 0xd5, 0x9b, 0x8d, 0x04,
+	0x0e, 0x61, 0xa8, 0x06, 0xa5, 0x81, 0x31, 0x36, 0x0e, 0x2d, 0xdb, 0xf2, 0x2d, 0xe2, 0x95, 0x93,
+	0xd5, 0xd4, 0x66, 0x01, 0x2f, 0xd8, 0xd0, 0x13, 0xb8, 0x36, 0x32, 0x5e, 0xea, 0x03, 0xea, 0x0c,
+	0x26, 0xae, 0xcb, 0x78, 0x72, 0xc9, 0xaf, 0x26, 0xc4, 0xf3, 0x3d, 0x4e, 0x54, 0x06, 0x5f, 0x1d,
+	0x19, 0x2f, 0x1b, 0x91, 0x17, 0x07, 0xce, 0xda, 0x9f, 0x92, 0x90, 0x15, 0xa7, 0xa2, 0x75, 0x48,
+	0x5a, 0xa6, 0xc8, 0xcd, 0x76, 0xf6, 0xfc, 0xcd, 0x46, 0xb2, 0xa9, 0xe2, 0xa4, 0x65, 0xa2, 0x2b,
+	0x90, 0xb1, 0x8d, 0x43, 0x62, 0x07, 0x59, 0x11, 0x13, 0x74, 0x1d, 0x0a, 0x2e, 0x31, 0x4c, 0x9d,
+	0x3a, 0xf6, 0x19, 0x3f, 0x22, 0x8f, 0xf3, 0xcc, 0xd0, 0x71, 0xec, 0x33, 0xf4, 0x3d, 0x40, 0xd6,
+	0x91, 0x43, 0x5d, 0xa2, 0x8f, 0x89, 0x3b, 0xb2, 0x38, 0x15, 0x1e, 0x4f, 0x48, 0x1e, 0xaf, 0x09,
+	0x4f, 0x77, 0xee, 0x40, 0xb7, 0x60, 0x25, 0x80, 0x9b, 0xc4, 0x26, 0x3e, 0x29, 0x67, 0x38, 0xb2,
+	0x24, 0x8c, 0x2a, 0xb7, 0xa1, 0x87, 0x70, 0xc5, 0xb4, 0x3c, 0xe3, 0xd0, 0x26, 0xba, 0x4f, 0x46,
+	0x63, 0xdd, 0x72, 0x4c, 0xf2, 0x92, 0x78, 0xe5, 0x2c, 0xc7, 0xa2, 0xc0, 0xd7, 0x27, 0xa3, 0x71,
+	0x53, 0x78, 0xd0, 0x3a, 0x64, 0xc7, 0xc6, 0xc4, 0x23, 0x66, 0x39, 0xc7, 0x31, 0xc1, 0x8c, 0x65,
+	0x40, 0x94, 0x9e, 0x57, 0x96, 0x2f, 0x66, 0x40, 0xe5, 0x8e, 0x30, 0x03, 0x01, 0xac, 0xf6, 0x75,
+	0x12, 0xb2, 0xc2, 0x83, 0x3e, 0x8c, 0x58, 0x2a, 0x6d, 0xaf, 0x33, 0xd4, 0xdf, 0xdf, 0x6c, 0xe4,
+	0x85, 0xaf, 0xa9, 0xc6, 0x58, 0x43, 0x90, 0x8e, 0x95, 0x32, 0x1f, 0xa3, 0x1b, 0x50, 0x30, 0x4c,
+	0x93, 0x95, 0x06, 0x61, 0x69, 0x61, 0x59, 0x9c, 0x1b, 0xd0, 0x0f, 0x17, 0x4b, 0x2d, 0x7d, 0xb1,
+	0x38, 0xdf, 0x55, 0x63, 0x2c, 0x15, 0x03, 0xe2, 0x06, 0xad, 0x93, 0x11, 0x55, 0xcf, 0x0c, 0xbc,
+	0x71, 0x6e, 0x42, 0x89, 0x15, 0x86, 0xc7, 0x12, 0xee, 0x0c, 0x08, 0xa7, 0x2b, 0x85, 0x8b, 0x23,
+	0xe3, 0x65, 0x2f, 0x30, 0xa1, 0x0a, 0x80, 0xe5, 0xf8, 0x2e, 0x35, 0x27, 0x03, 0xe2, 0x06, 0x5c,
+	0xc5, 0x2c, 0xe8, 0x07, 0x90, 0xe7, 0x64, 0xeb, 0x96, 0x59, 0xce, 0x57, 0xa5, 0xcd, 0xf4, 0xb6,
+	0x12, 0x04, 0x9e, 0xe3, 0x54, 0xf3, 0xb8, 0xc3, 0x21, 0xce, 0x71, 0x6c, 0xd3, 0x44, 0x3f, 0x06,
+	0xc5, 0x7b, 0x61, 0x8d, 0xf5, 0x70, 0x27, 0xdf, 0xa2, 0x8e, 0xee, 0x92, 0x11, 0x3d, 0x31, 0x6c,
+	0xaf, 0x5c, 0xe0, 0xc7, 0x94, 0x19, 0xa2, 0x19, 0x03, 0xe0, 0xc0, 0x5f, 0xeb, 0x40, 0x86, 0xef,
+	0xc8, 0xb2, 0x28, 0x1a, 0x21, 0x90, 0x8d, 0x60, 0x86, 0xee, 0x43, 0x66, 0x68, 0xd9, 0x41, 0x3b,
+	0x14, 0x1f, 0xa1, 0x58, 0x17, 0x59, 0x36, 0x69, 0x3a, 0x43, 0x1a, 0x64, 0x51, 0xc0, 0x6a, 0xfb,
+	0x50, 0xe4, 0x1b, 0xee, 0x8f, 0x4d, 0xc3, 0x27, 0xff, 0xb3, 0x6d, 0x7f, 0x9b, 0x81, 0x7c, 0xe8,
+	0x89, 0x92, 0x2e, 0xc5, 0x92, 0x8e, 0x20, 0xed, 0x59, 0x9f, 0x13, 0xde, 0x23, 0x29, 0xcc, 0xc7,
+	0xe8, 0x03, 0x80, 0x11, 0x35, 0xad, 0xa1, 0x45, 0x4c, 0xdd, 0xe3, 0x29, 0x4b, 0xe1, 0x42, 0x68,
+	0xe9, 0xa1, 0x87, 0x50, 0x8c, 0xdc, 0x87, 0x67, 0xe5, 0x12, 0xe7, 0xfc, 0x52, 0xc8, 0x79, 0xef,
+	0x98, 0xba, 0x7e, 0x53, 0xc5, 0xd1, 0x16, 0xdb, 0x67, 0xac, 0xa4, 0x43, 0x5d, 0x64, 0xc4, 0x2e,
+	0x94, 0xf4, 0x01, 0x19, 0xf8, 0x34, 0x12, 0x95, 0x93, 0xb9, 0x52, 0x46, 0x35, 0x01, 0xfc, 0x07,
+	0x44, 0x73, 0xf4, 0x7d, 0xc8, 0x6e, 0xdb, 0x74, 0xf0, 0x22, 0xec, 0x8f, 0xcb, 0xf3, 0xcd, 0xb8,
+	0x3d, 0xc6, 0x42, 0x00, 0x64, 0xfa, 0xec, 0x9d, 0x8d, 0x6c, 0xcb, 0x79, 0xa1, 0xfb, 0x86, 0x7b,
+	0x44, 0xfc, 0xf2, 0x9a, 0xd0, 0xe7, 0xc0, 0xda, 0xe7, 0x46, 0x74, 0x17, 0x2e, 0x1d, 0x1b, 0xae,
+	0x19, 0xc7, 0x21, 0x8e, 0x5b, 0x0d, 0xcd, 0x01, 0x70, 0x2b, 0x90, 0x68, 0x21, 0xb8, 0xeb, 0xcb,
+	0x59, 0x88, 0x69, 0x74, 0x15, 0x8a, 0x17, 0x65, 0x66, 0x05, 0xc7, 0x4d, 0xec, 0x7a, 0x89, 0x08,
+	0x75, 0xbc, 0x72, 0x91, 0x2b, 0x62, 0xc4, 0x5f, 0xdb, 0x43, 0x0f, 0x00, 0x0e, 0x59, 0x20, 0x3a,
+	0x4f, 0xd5, 0x0a, 0xf3, 0x6f, 0xcb, 0xe7, 0x6f, 0x36, 0x4a, 0xd8, 0x38, 0xe5, 0x11, 0xf6, 0xac,
+	0xcf, 0x09, 0x2e, 0x1c, 0x86, 0x43, 0x76, 0xa6, 0x4d, 0x07, 0x86, 0xad, 0x0f, 0x6d, 0xe3, 0xc8,
+	0x2b, 0x7f, 0x95, 0xe3, 0x87, 0x02, 0xb7, 0xed, 0x30, 0x13, 0x2a, 0x33, 0x95, 0x61, 0xca, 0x65,
+	0x06, 0x12, 0x15, 0x4e, 0xd1, 0x26, 0xe4, 0x2c, 0xe7, 0xc4, 0xb0, 0xad, 0x40, 0x98, 0xb6, 0x57,
+	0xcf, 0xdf, 0x6c, 0x00, 0x36, 0x4e, 0x9b, 0xc2, 0x8a, 0x43, 0x37, 0x63, 0xd5, 0xa1, 0x0b, 0x1a,
+	0x9a, 0xe7, 0x5b, 0xad, 0x38, 0x34, 0xa6, 0x9f, 0x9f, 0xa4, 0xff, 0xf8, 0xc5, 0x46, 0xa2, 0xe6,
+	0x40, 0x21, 0xca, 0x0e, 0xab, 0xba, 0x63, 0xc3, 0x3b, 0xe6, 0x55, 0x57, 0xc2, 0x7c, 0xcc, 0x4a,
+	0x9e, 0x0e, 0x87, 0x1e, 0xf1, 0x79, 0x7d, 0xa6, 0x70, 0x30, 0x8b, 0x2a, 0x34, 0xc9, 0x69, 0xe1,
+	0x63, 0xa6, 0x29, 0xa7, 0xc4, 0x78, 0xa1, 0xf3, 0x4d, 0x04, 0xa3, 0x79, 0x66, 0xd8, 0x33, 0xbc,
+	0xe3, 0xe0, 0xbc, 0x9f, 0x40, 0x56, 0x94, 0x16, 0xfa, 0x18, 0xf2, 0x03, 0x3a, 0x71, 0xfc, 0xf9,
+	0x9d, 0xb6, 0x16, 0x97, 0x2d, 0xee, 0x09, 0xea, 0x25, 0x02, 0xd6, 0x76, 0x20, 0x17, 0xb8, 0xd0,
+	0x9d, 0x48, 0x53, 0xd3, 0xdb, 0x57, 0x2f, 0x94, 0xf9, 0xe2, 0x45, 0x74, 0x62, 0xd8, 0x13, 0xf1,
+	0x43, 0xd3, 0x58, 0x4c, 0x6a, 0x7f, 0x91, 0x20, 0x17, 0x5c, 0x67, 0xb1, 0x2b, 0x2c, 0xb3, 0x70,
+	0x85, 0xcd, 0x9b, 0x3d, 0xb9, 0xd0, 0xec, 0x61, 0xbf, 0xa6, 0x62, 0xfd, 0x3a, 0x67, 0x29, 0xfd,
+	0x8d, 0x2c, 0x65, 0x62, 0x2c, 0x85, 0x2c, 0x67, 0x63, 0x2c, 0xdf, 0x81, 0xd5, 0xa1, 0x4b, 0x47,
+	0xfc, 0x92, 0xa2, 0xae, 0xe1, 0x9e, 0x05, 0x8a, 0xba, 0xc2, 0xac, 0xfd, 0xd0, 0xb8, 0x48, 0x70,
+	0x7e, 0x91, 0xe0, 0x9a, 0x0e, 0x79, 0x4c, 0xbc, 0x31, 0x75, 0x3c, 0xf2, 0xce, 0x98, 0x10, 0xa4,
+	0x4d, 0xc3, 0x37, 0x78, 0x44, 0x25, 0xcc, 0xc7, 0xe8, 0x2e, 0xa4, 0x07, 0xd4, 0x14, 0xf1, 0xac,
+	0xc6, 0xdb, 0x56, 0x73, 0x5d, 0xea, 0x36, 0xa8, 0x49, 0x30, 0x07, 0xd4, 0x9e, 0xc3, 0xa5, 0xa7,
+	0xc4, 0x37, 0xd8, 0xa2, 0xff, 0x96, 0x3b, 0x76, 0xbb, 0xba, 0x64, 0x68, 0xbd, 0x0c, 0xd8, 0x0b,
+	0x66, 0xb5, 0xdf, 0x48, 0x20, 0xcf, 0xf7, 0xfe, 0x37, 0x41, 0xfc, 0x87, 0x6a, 0xfb, 0xfe, 0x01,
+	0xfe, 0x1a, 0x4a, 0xd8, 0x70, 0x8e, 0xc8, 0xff, 0xa9, 0x32, 0x6a, 0x63, 0x90, 0x55, 0x7a, 0xea,
+	0xd8, 0xd4, 0x30, 0xbb, 0x2e, 0x3d, 0x62, 0x57, 0xf5, 0x3b, 0xaf, 0x1c, 0x15, 0x72, 0x13, 0x7e,
+	0x29, 0x85, 0x34, 0xdc, 0x5e, 0xa4, 0xe1, 0xe2, 0x46, 0xe2, 0x06, 0x0b, 0x05, 0x3d, 0x58, 0x5a,
+	0xfb, 0xab, 0x04, 0xca, 0xbb, 0xd1, 0xa8, 0x09, 0x45, 0x81, 0xd4, 0x63, 0x4f, 0xdf, 0xcd, 0xf7,
+	0x39, 0x88, 0x2b, 0x2d, 0x4c, 0xa2, 0xf1, 0x37, 0x3e, 0x6d, 0x62, 0x17, 0x50, 0xea, 0xfd, 0x2e,
+	0xa0, 0xbb, 0xb0, 0x22, 0x24, 0x37, 0x7c, 0xc8, 0xa5, 0xab, 0xa9, 0xcd, 0xcc, 0x76, 0x52, 0x4e,
+	0xe0, 0xd2, 0xa1, 0xd0, 0x31, 0x6e, 0xaf, 0x7d, 0x02, 0xe9, 0xae, 0xe5, 0x1c, 0xbd, 0x33, 0x85,
+	0x0a, 0xe4, 0xdd, 0xa0, 0xce, 0xca, 0xc9, 0xf0, 0x21, 0x2a, 0xe6, 0xb5, 0x9f, 0x41, 0xa6, 0x61,
+	0x53, 0x5e, 0x80, 0x59, 0x97, 0x18, 0x1e, 0x75, 0x42, 0xee, 0xc5, 0x8c, 0x7d, 0x0a, 0xf0, 0x82,
+	0x4a, 0x2e, 0xbd, 0xb6, 0xd8, 0x32, 0xcc, 0x41, 0xa2, 0xa4, 0xb6, 0xbe, 0x4e, 0x41, 0x31, 0xf6,
+	0x81, 0x80, 0x1e, 0xc2, 0x6a, 0xa3, 0xb5, 0xdf, 0xeb, 0x6b, 0x58, 0x6f, 0x74, 0xda, 0x3b, 0xcd,
+	0x5d, 0x39, 0xa1, 0xdc, 0x98, 0xce, 0xaa, 0xe5, 0xd1, 0x1c, 0xb4, 0xf8, 0xf4, 0xdf, 0x80, 0x4c,
+	0xb3, 0xad, 0x6a, 0xbf, 0x90, 0x25, 0xe5, 0xca, 0x74, 0x56, 0x95, 0x63, 0x40, 0xf1, 0xd6, 0xf9,
+	0x08, 0x4a, 0x1c, 0xa0, 0xef, 0x77, 0xd5, 0x7a, 0x5f, 0x93, 0x93, 0x8a, 0x32, 0x9d, 0x55, 0xd7,
+	0x2f, 0xe2, 0x82, 0x94, 0xde, 0x82, 0x1c, 0xd6, 0x7e, 0xbe, 0xaf, 0xf5, 0xfa, 0x72, 0x4a, 0x59,
+	0x9f, 0xce, 0xaa, 0x28, 0x06, 0x0c, 0x0b, 0xff, 0x0e, 0xe4, 0xb1, 0xd6, 0xeb, 0x76, 0xda, 0x3d,
+	0x4d, 0x4e, 0x2b, 0xd7, 0xa6, 0xb3, 0xea, 0xe5, 0x05, 0x54, 0xd0, 0xa0, 0x4f, 0x60, 0x4d, 0xed,
+	0x3c, 0x6b, 0xb7, 0x3a, 0x75, 0x55, 0xef, 0xe2, 0xce, 0x2e, 0xd6, 0x7a, 0x3d, 0x39, 0xa3, 0x6c,
+	0x4c, 0x67, 0xd5, 0xeb, 0x31, 0xfc, 0x52, 0x4d, 0x7f, 0x00, 0xe9, 0x6e, 0xb3, 0xbd, 0x2b, 0x67,
+	0x95, 0xcb, 0xd3, 0x59, 0xf5, 0x52, 0x0c, 0xca, 0x73, 0xb6, 0x01, 0x99, 0x46, 0xab, 0xd3, 0xd3,
+	0xe4, 0xdc, 0x52, 0xc4, 0x22, 0x2f, 0x8f, 0x41, 0x7e, 0xaa, 0xf5, 0xeb, 0x6a, 0xbd, 0x5f, 0xd7,
+	0xc3, 0x60, 0xf2, 0x4a, 0x65, 0x3a, 0xab, 0x2a, 0x31, 0xec, 0x45, 0xad, 0x7a, 0x02, 0x6b, 0xb1,
+	0x55, 0x41, 0x74, 0x85, 0xa5, 0x5f, 0xbb, 0x24, 0x43, 0xf7, 0x61, 0x05, 0xd7, 0xdb, 0xbb, 0x5a,
+	0x74, 0x14, 0x28, 0xd7, 0xa7, 0xb3, 0xea, 0xb5, 0x38, 0x23, 0x31, 0xd5, 0xd8, 0xfa, 0x25, 0xa0,
+	0xe5, 0x0f, 0x3c, 0x74, 0x1b, 0xd2, 0xed, 0x4e, 0x5b, 0x93, 0x13, 0x22, 0x3b, 0xcb, 0x88, 0x36,
+	0x75, 0x08, 0xaa, 0x41, 0xaa, 0xf5, 0xd9, 0x63, 0x59, 0x52, 0xbe, 0x33, 0x9d, 0x55, 0xaf, 0x2e,
+	0x83, 0x5a, 0x9f, 0x3d, 0xde, 0xa2, 0x50, 0x8c, 0x6f, 0x5c, 0x83, 0x7c, 0x18, 0x96, 0x9c, 0x10,
+	0x84, 0x85, 0xee, 0x30, 0x14, 0x74, 0x03, 0x32, 0x6d, 0xed, 0x40, 0xc3, 0xb2, 0xa4, 0xac, 0x4d,
+	0x67, 0xd5, 0x95, 0x10, 0xd0, 0x26, 0x27, 0xc4, 0x45, 0x15, 0xc8, 0xd6, 0x5b, 0xcf, 0xea, 0xcf,
+	0x7b, 0x72, 0x52, 0x41, 0xd3, 0x59, 0x75, 0x35, 0x74, 0xd7, 0xed, 0x53, 0xe3, 0xcc, 0xdb, 0xfa,
+	0xa7, 0x04, 0xa5, 0xf8, 0x0b, 0x0a, 0x55, 0x20, 0xbd, 0xd3, 0x6c, 0x69, 0xe1, 0x71, 0x71, 0x1f,
+	0x1b, 0xa3, 0x4d, 0x28, 0xa8, 0x4d, 0xac, 0x35, 0xfa, 0x1d, 0xfc, 0x3c, 0x8c, 0x25, 0x0e, 0x52,
+	0x2d, 0x97, 0x77, 0xf7, 0x19, 0xfa, 0x11, 0x94, 0x7a, 0xcf, 0x9f, 0xb6, 0x9a, 0xed, 0x4f, 0x75,
+	0xbe, 0x63, 0x52, 0xb9, 0x3b, 0x9d, 0x55, 0x6f, 0x2e, 0x80, 0xc9, 0xd8, 0x25, 0x03, 0xc3, 0x27,
+	0x66, 0x4f, 0xbc, 0x0a, 0x99, 0x33, 0x2f, 0xa1, 0x06, 0xac, 0x85, 0x4b, 0xe7, 0x87, 0xa5, 0x94,
+	0x8f, 0xa6, 0xb3, 0xea, 0x87, 0xdf, 0xba, 0x3e, 0x3a, 0x3d, 0x2f, 0xa1, 0xdb, 0x90, 0x0b, 0x36,
+	0x09, 0xeb, 0x3c, 0xbe, 0x34, 0x58, 0xb0, 0xf5, 0x67, 0x09, 0x0a, 0xd1, 0x5d, 0xc1, 0x08, 0x6f,
+	0x77, 0x74, 0x0d, 0xe3, 0x0e, 0x0e, 0x19, 0x88, 0x9c, 0x6d, 0xca, 0x87, 0xe8, 0x26, 0xe4, 0x76,
+	0xb5, 0xb6, 0x86, 0x9b, 0x8d, 0xb0, 0x6d, 0x23, 0xc8, 0x2e, 0x71, 0x88, 0x6b, 0x0d, 0xd0, 0x3d,
+	0x28, 0xb5, 0x3b, 0x7a, 0x6f, 0xbf, 0xb1, 0x17, 0x86, 0xce, 0xcf, 0x8f, 0x6d, 0xd5, 0x9b, 0x0c,
+	0x8e, 0x39, 0x9f, 0x5b, 0xac, 0xc3, 0x0f, 0xea, 0xad, 0xa6, 0x2a, 0xa0, 0x29, 0xa5, 0x3c, 0x9d,
+	0x55, 0xaf, 0x44, 0xd0, 0xe0, 0x09, 0xc8, 0xb0, 0x5b, 0x26, 0x54, 0xbe, 0x5d, 0x95, 0x51, 0x15,
+	0xb2, 0xf5, 0x6e, 0x57, 0x6b, 0xab, 0xe1, 0xaf, 0x9f, 0xfb, 0xea, 0xe3, 0x31, 0x71, 0x4c, 0x86,
+	0xd8, 0xe9, 0xe0, 0x5d, 0xad, 0x2f, 0x4b, 0x17, 0x11, 0x3b, 0x94, 0xbd, 0xb4, 0xb7, 0xfe, 0x90,
+	0x82, 0x62, 0x4c, 0xec, 0xd0, 0x3d, 0x58, 0xe1, 0x2d, 0xab, 0xef, 0xb7, 0x3f, 0x6d, 0x77, 0x9e,
+	0xb5, 0xe5, 0x84, 0xd0, 0x96, 0x18, 0x66, 0xdf, 0x79, 0xe1, 0xd0, 0x53, 0x07, 0x7d, 0x17, 0x56,
+	0x05, 0xb4, 0xb7, 0xb7, 0xdf, 0x67, 0xf2, 0x21, 0x4b, 0x22, 0xf2, 0x18, 0xb6, 0x77, 0x3c, 0xf1,
+	0x4d, 0x06, 0x7e, 0x02, 0x57, 0x04, 0x58, 0xd5, 0x0e, 0x9a, 0x0d, 0xd6, 0x82, 0x4f, 0x3b, 0x07,
+	0x9a, 0x2a, 0x27, 0x85, 0x68, 0xc6, 0x96, 0x88, 0xaf, 0x69, 0xfe, 0x25, 0x48, 0x4c, 0xf4, 0x18,
+	0x2e, 0x2f, 0xac, 0xeb, 0xd6, 0xf7, 0x7b, 0x9a, 0x2a, 0xa7, 0x44, 0xe7, 0x2e, 0x2d, 0xeb, 0x8a,
+	0x6f, 0xfc, 0xe8, 0xb4, 0x9d, 0x4e, 0x4b, 0x65, 0x0a, 0xbd, 0xc7, 0xfa, 0x5e, 0x95, 0xd3, 0x4b,
+	0xa7, 0x89, 0xff, 0x7e, 0x34, 0x8e, 0x59, 0xdf, 0xc7, 0xd6, 0x75, 0x71, 0xa7, 0xdf, 0x69, 0x74,
+	0x5a, 0x41, 0x75, 0x64, 0x96, 0xd6, 0x75, 0x83, 0x9b, 0x42, 0x54, 0x49, 0x44, 0x05, 0xd6, 0xba,
+	0xad, 0x7a, 0x43, 0x53, 0xe5, 0xec, 0x12, 0x15, 0x98, 0x8c, 0x6d, 0x63, 0x40, 0x4c, 0x74, 0x0b,
+	0x40, 0x80, 0x9b, 0x6a, 0x8b, 0x49, 0x23, 0x97, 0xce, 0x18, 0xb0, 0x69, 0xda, 0x64, 0x7b, 0xf3,
+	0xd5, 0x97, 0x95, 0xc4, 0xeb, 0x2f, 0x2b, 0x89, 0x57, 0xe7, 0x15, 0xe9, 0xf5, 0x79, 0x45, 0xfa,
+	0xc7, 0x79, 0x25, 0xf1, 0xd5, 0x79, 0x45, 0xfa, 0xfd, 0xdb, 0x4a, 0xe2, 0x8b, 0xb7, 0x15, 0xe9,
+	0xf5, 0xdb, 0x4a, 0xe2, 0x6f, 0x6f, 0x2b, 0x89, 0xc3, 0x2c, 0xbf, 0xb4, 0x3e, 0xfe, 0xd7, 0x00,
+	0x84, 0xa4, 0x80, 0x2a, 0xaa, 0x13, 0x00, 0x00,
 }
 
 func (m *Hello) Marshal() (dAtA []byte, err error) {
@@ -1056,6 +1264,13 @@ func (m *Hello) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Platform) > 0 {
+		i -= len(m.Platform)
+		copy(dAtA[i:], m.Platform)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.Platform)))
+		i--
+		dAtA[i] = 0x22
+	}
 	if len(m.ClientVersion) > 0 {
 		i -= len(m.ClientVersion)
 		copy(dAtA[i:], m.ClientVersion)
@@ -1133,6 +1348,20 @@ func (m *ClusterConfig) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.MaxConcurrentRequests != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.MaxConcurrentRequests))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Capabilities) > 0 {
+		for iNdEx := len(m.Capabilities) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Capabilities[iNdEx])
+			copy(dAtA[i:], m.Capabilities[iNdEx])
+			i = encodeVarintBep(dAtA, i, uint64(len(m.Capabilities[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
 	if len(m.Folders) > 0 {
 		for iNdEx := len(m.Folders) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1459,6 +1688,15 @@ func (m *FileInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i--
 		dAtA[i] = 0xc0
 	}
+	if len(m.HardlinkTarget) > 0 {
+		i -= len(m.HardlinkTarget)
+		copy(dAtA[i:], m.HardlinkTarget)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.HardlinkTarget)))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x92
+	}
 	if len(m.SymlinkTarget) > 0 {
 		i -= len(m.SymlinkTarget)
 		copy(dAtA[i:], m.SymlinkTarget)
@@ -1803,6 +2041,147 @@ func (m *Response) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *MetadataRequest) Marshal() (dAtA []byte, err error) {
+	size := m.ProtoSize()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetadataRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.ProtoSize()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetadataRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Prefix) > 0 {
+		i -= len(m.Prefix)
+		copy(dAtA[i:], m.Prefix)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.Prefix)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Folder) > 0 {
+		i -= len(m.Folder)
+		copy(dAtA[i:], m.Folder)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.Folder)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.ID != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.ID))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MetadataResponse) Marshal() (dAtA []byte, err error) {
+	size := m.ProtoSize()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetadataResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.ProtoSize()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetadataResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Code != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.Code))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Files) > 0 {
+		for iNdEx := len(m.Files) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Files[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintBep(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if m.ID != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.ID))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *RangeRequest) Marshal() (dAtA []byte, err error) {
+	size := m.ProtoSize()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RangeRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.ProtoSize()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RangeRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Size != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.Size))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.Offset != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.Offset))
+		i--
+		dAtA[i] = 0x20
+	}
+	if len(m.Name) > 0 {
+		i -= len(m.Name)
+		copy(dAtA[i:], m.Name)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.Name)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Folder) > 0 {
+		i -= len(m.Folder)
+		copy(dAtA[i:], m.Folder)
+		i = encodeVarintBep(dAtA, i, uint64(len(m.Folder)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.ID != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.ID))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *DownloadProgress) Marshal() (dAtA []byte, err error) {
 	size := m.ProtoSize()
 	dAtA = make([]byte, size)
@@ -1919,6 +2298,21 @@ func (m *Ping) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Response {
+		i--
+		if m.Response {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.ID != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.ID))
+		i--
+		dAtA[i] = 0x8
+	}
 	return len(dAtA) - i, nil
 }
 
@@ -1942,6 +2336,11 @@ func (m *Close) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Code != 0 {
+		i = encodeVarintBep(dAtA, i, uint64(m.Code))
+		i--
+		dAtA[i] = 0x10
+	}
 	if len(m.Reason) > 0 {
 		i -= len(m.Reason)
 		copy(dAtA[i:], m.Reason)
@@ -1981,6 +2380,10 @@ func (m *Hello) ProtoSize() (n int) {
 	if l > 0 {
 		n += 1 + l + sovBep(uint64(l))
 	}
+	l = len(m.Platform)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
 	return n
 }
 
@@ -2011,6 +2414,15 @@ func (m *ClusterConfig) ProtoSize() (n int) {
 			n += 1 + l + sovBep(uint64(l))
 		}
 	}
+	if len(m.Capabilities) > 0 {
+		for _, s := range m.Capabilities {
+			l = len(s)
+			n += 1 + l + sovBep(uint64(l))
+		}
+	}
+	if m.MaxConcurrentRequests != 0 {
+		n += 1 + sovBep(uint64(m.MaxConcurrentRequests))
+	}
 	return n
 }
 
@@ -2185,6 +2597,10 @@ func (m *FileInfo) ProtoSize() (n int) {
 	if l > 0 {
 		n += 2 + l + sovBep(uint64(l))
 	}
+	l = len(m.HardlinkTarget)
+	if l > 0 {
+		n += 2 + l + sovBep(uint64(l))
+	}
 	if m.LocalFlags != 0 {
 		n += 2 + sovBep(uint64(m.LocalFlags))
 	}
@@ -2298,13 +2714,80 @@ func (m *Response) ProtoSize() (n int) {
 	return n
 }
 
-func (m *DownloadProgress) ProtoSize() (n int) {
+func (m *MetadataRequest) ProtoSize() (n int) {
 	if m == nil {
 		return 0
 	}
 	var l int
 	_ = l
-	l = len(m.Folder)
+	if m.ID != 0 {
+		n += 1 + sovBep(uint64(m.ID))
+	}
+	l = len(m.Folder)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
+	l = len(m.Prefix)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
+	return n
+}
+
+func (m *MetadataResponse) ProtoSize() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ID != 0 {
+		n += 1 + sovBep(uint64(m.ID))
+	}
+	if len(m.Files) > 0 {
+		for _, e := range m.Files {
+			l = e.ProtoSize()
+			n += 1 + l + sovBep(uint64(l))
+		}
+	}
+	if m.Code != 0 {
+		n += 1 + sovBep(uint64(m.Code))
+	}
+	return n
+}
+
+func (m *RangeRequest) ProtoSize() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ID != 0 {
+		n += 1 + sovBep(uint64(m.ID))
+	}
+	l = len(m.Folder)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
+	if m.Offset != 0 {
+		n += 1 + sovBep(uint64(m.Offset))
+	}
+	if m.Size != 0 {
+		n += 1 + sovBep(uint64(m.Size))
+	}
+	return n
+}
+
+func (m *DownloadProgress) ProtoSize() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Folder)
 	if l > 0 {
 		n += 1 + l + sovBep(uint64(l))
 	}
@@ -2346,6 +2829,12 @@ func (m *Ping) ProtoSize() (n int) {
 	}
 	var l int
 	_ = l
+	if m.ID != 0 {
+		n += 1 + sovBep(uint64(m.ID))
+	}
+	if m.Response {
+		n += 2
+	}
 	return n
 }
 
@@ -2359,6 +2848,9 @@ func (m *Close) ProtoSize() (n int) {
 	if l > 0 {
 		n += 1 + l + sovBep(uint64(l))
 	}
+	if m.Code != 0 {
+		n += 1 + sovBep(uint64(m.Code))
+	}
 	return n
 }
 
@@ -2493,6 +2985,38 @@ func (m *Hello) Unmarshal(dAtA []byte) error {
 			}
 			m.ClientVersion = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Platform", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Platform = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
@@ -2671,6 +3195,57 @@ func (m *ClusterConfig) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Capabilities", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Capabilities = append(m.Capabilities, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxConcurrentRequests", wireType)
+			}
+			m.MaxConcurrentRequests = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxConcurrentRequests |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
@@ -3835,6 +4410,38 @@ func (m *FileInfo) Unmarshal(dAtA []byte) error {
 			}
 			m.SymlinkTarget = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 18:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HardlinkTarget", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.HardlinkTarget = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		case 1000:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field LocalFlags", wireType)
@@ -4572,7 +5179,7 @@ func (m *Response) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
+func (m *MetadataRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -4595,13 +5202,32 @@ func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: DownloadProgress: wiretype end group for non-group")
+			return fmt.Errorf("proto: MetadataRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: DownloadProgress: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: MetadataRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			}
+			m.ID = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ID |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Folder", wireType)
 			}
@@ -4633,11 +5259,11 @@ func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
 			}
 			m.Folder = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 2:
+		case 3:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Updates", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Prefix", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowBep
@@ -4647,25 +5273,23 @@ func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthBep
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthBep
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Updates = append(m.Updates, FileDownloadProgressUpdate{})
-			if err := m.Updates[len(m.Updates)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Prefix = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -4691,7 +5315,7 @@ func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
+func (m *MetadataResponse) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -4714,17 +5338,17 @@ func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: FileDownloadProgressUpdate: wiretype end group for non-group")
+			return fmt.Errorf("proto: MetadataResponse: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: FileDownloadProgressUpdate: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: MetadataResponse: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field UpdateType", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
 			}
-			m.UpdateType = 0
+			m.ID = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowBep
@@ -4734,16 +5358,16 @@ func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.UpdateType |= FileDownloadProgressUpdateType(b&0x7F) << shift
+				m.ID |= int32(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
 		case 2:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Files", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowBep
@@ -4753,29 +5377,31 @@ func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthBep
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthBep
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Name = string(dAtA[iNdEx:postIndex])
+			m.Files = append(m.Files, FileInfo{})
+			if err := m.Files[len(m.Files)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
 			iNdEx = postIndex
 		case 3:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Code", wireType)
 			}
-			var msglen int
+			m.Code = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowBep
@@ -4785,13 +5411,429 @@ func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				m.Code |= ErrorCode(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
-				return ErrInvalidLengthBep
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBep(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RangeRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBep
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RangeRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RangeRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			}
+			m.ID = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ID |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Folder", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Folder = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Offset", wireType)
+			}
+			m.Offset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Offset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Size", wireType)
+			}
+			m.Size = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Size |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBep(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DownloadProgress) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBep
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DownloadProgress: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DownloadProgress: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Folder", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Folder = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Updates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Updates = append(m.Updates, FileDownloadProgressUpdate{})
+			if err := m.Updates[len(m.Updates)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBep(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthBep
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *FileDownloadProgressUpdate) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBep
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FileDownloadProgressUpdate: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FileDownloadProgressUpdate: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UpdateType", wireType)
+			}
+			m.UpdateType = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.UpdateType |= FileDownloadProgressUpdateType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBep
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBep
 			}
 			postIndex := iNdEx + msglen
 			if postIndex < 0 {
@@ -4933,6 +5975,45 @@ func (m *Ping) Unmarshal(dAtA []byte) error {
 			return fmt.Errorf("proto: Ping: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			}
+			m.ID = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ID |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Response", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Response = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
@@ -5018,6 +6099,25 @@ func (m *Close) Unmarshal(dAtA []byte) error {
 			}
 			m.Reason = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Code", wireType)
+			}
+			m.Code = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Code |= CloseReason(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
@@ -22,6 +22,39 @@ const (
 	Version13HelloMagic    uint32 = 0x9F79BC40 // old
 )
 
+// Capabilities are advertised in the ClusterConfig message to let the other
+// side know which optional protocol features we support. Capability strings
+// we don't know about are ignored.
+const (
+	// CapabilityTempIndexes means the device can receive DownloadProgress
+	// messages for folders with temporary indexes enabled.
+	CapabilityTempIndexes = "temp-indexes"
+	// CapabilityMetadataRequests means the device answers MetadataRequest
+	// messages.
+	CapabilityMetadataRequests = "metadata-requests"
+	// CapabilityRangeRequests means the device answers RangeRequest
+	// messages.
+	CapabilityRangeRequests = "range-requests"
+)
+
+// LocalCapabilities is the list of capabilities advertised by this device.
+var LocalCapabilities = []string{
+	CapabilityTempIndexes,
+	CapabilityMetadataRequests,
+	CapabilityRangeRequests,
+}
+
+// HasCapability returns true if the given capability is advertised in the
+// cluster config.
+func (m ClusterConfig) HasCapability(name string) bool {
+	for _, c := range m.Capabilities {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (m Hello) Magic() uint32 {
 	return HelloMessageMagic
 }
@@ -0,0 +1,73 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"fmt"
+)
+
+// BlockSizeStrategy selects how the block size for a file is derived from
+// its size.
+type BlockSizeStrategy int
+
+const (
+	BlockSizeStrategyAuto  BlockSizeStrategy = iota // default is auto
+	BlockSizeStrategySmall                          // biased towards MinBlockSize
+	BlockSizeStrategyLarge                          // biased towards MaxBlockSize
+)
+
+// The number of blocks per file to aim for is scaled up or down by this
+// factor for the small and large strategies respectively.
+const blockSizeStrategyFactor = 8
+
+func (s BlockSizeStrategy) String() string {
+	switch s {
+	case BlockSizeStrategyAuto:
+		return "auto"
+	case BlockSizeStrategySmall:
+		return "small"
+	case BlockSizeStrategyLarge:
+		return "large"
+	default:
+		return "unknown"
+	}
+}
+
+func (s BlockSizeStrategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *BlockSizeStrategy) UnmarshalText(bs []byte) error {
+	switch string(bs) {
+	case "auto", "":
+		*s = BlockSizeStrategyAuto
+	case "small":
+		*s = BlockSizeStrategySmall
+	case "large":
+		*s = BlockSizeStrategyLarge
+	default:
+		return fmt.Errorf("unknown block size strategy %q", bs)
+	}
+	return nil
+}
+
+// BlockSize returns the block size to use for the given file size under
+// the strategy. The auto strategy is equivalent to BlockSize.
+func (s BlockSizeStrategy) BlockSize(fileSize int64) int {
+	desiredBlocks := int64(DesiredPerFileBlocks)
+	switch s {
+	case BlockSizeStrategySmall:
+		desiredBlocks *= blockSizeStrategyFactor
+	case BlockSizeStrategyLarge:
+		desiredBlocks /= blockSizeStrategyFactor
+	}
+
+	var blockSize int
+	for _, blockSize = range BlockSizes {
+		if fileSize < desiredBlocks*int64(blockSize) {
+			break
+		}
+	}
+
+	return blockSize
+}
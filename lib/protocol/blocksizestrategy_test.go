@@ -0,0 +1,62 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"testing"
+)
+
+func TestBlockSizeStrategy(t *testing.T) {
+	cases := []struct {
+		fileSize int64
+		strategy BlockSizeStrategy
+		expected int
+	}{
+		// Small files get the minimum block size regardless of strategy,
+		// except when biased towards large blocks.
+		{1 << 20, BlockSizeStrategyAuto, MinBlockSize},
+		{1 << 20, BlockSizeStrategySmall, MinBlockSize},
+		{1 << 20, BlockSizeStrategyLarge, MinBlockSize},
+		{100 << 20, BlockSizeStrategyAuto, MinBlockSize},
+		{100 << 20, BlockSizeStrategySmall, MinBlockSize},
+		{100 << 20, BlockSizeStrategyLarge, 512 << 10},
+		// A medium sized file.
+		{4 << 30, BlockSizeStrategyAuto, 4 << 20},
+		{4 << 30, BlockSizeStrategySmall, 512 << 10},
+		{4 << 30, BlockSizeStrategyLarge, MaxBlockSize},
+		// Huge files get the maximum block size unless biased towards
+		// small blocks.
+		{100 << 30, BlockSizeStrategyAuto, MaxBlockSize},
+		{100 << 30, BlockSizeStrategySmall, 8 << 20},
+		{100 << 30, BlockSizeStrategyLarge, MaxBlockSize},
+	}
+
+	for _, tc := range cases {
+		if res := tc.strategy.BlockSize(tc.fileSize); res != tc.expected {
+			t.Errorf("%v.BlockSize(%d) => %d, expected %d", tc.strategy, tc.fileSize, res, tc.expected)
+		}
+		if tc.strategy == BlockSizeStrategyAuto {
+			if res := BlockSize(tc.fileSize); res != tc.expected {
+				t.Errorf("BlockSize(%d) => %d, expected %d", tc.fileSize, res, tc.expected)
+			}
+		}
+	}
+}
+
+func TestBlockSizeStrategyText(t *testing.T) {
+	for _, s := range []BlockSizeStrategy{BlockSizeStrategyAuto, BlockSizeStrategySmall, BlockSizeStrategyLarge} {
+		bs, _ := s.MarshalText()
+		var res BlockSizeStrategy
+		if err := res.UnmarshalText(bs); err != nil {
+			t.Fatal(err)
+		}
+		if res != s {
+			t.Errorf("Strategy %v did not survive a round trip, got %v", s, res)
+		}
+	}
+
+	var res BlockSizeStrategy
+	if err := res.UnmarshalText([]byte("huge")); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var closeReasonMarshal = map[CloseReason]string{
+	CloseReasonUnknown:       "unknown",
+	CloseReasonShutdown:      "shutdown",
+	CloseReasonDeviceRemoved: "device-removed",
+	CloseReasonDevicePaused:  "device-paused",
+	CloseReasonFolderChanged: "folder-changed",
+	CloseReasonProtocolError: "protocol-error",
+	CloseReasonReplaced:      "replaced",
+	CloseReasonIdle:          "idle",
+}
+
+func (r CloseReason) MarshalText() ([]byte, error) {
+	if s, ok := closeReasonMarshal[r]; ok {
+		return []byte(s), nil
+	}
+	return []byte(closeReasonMarshal[CloseReasonUnknown]), nil
+}
+
+func (r *CloseReason) UnmarshalText(bs []byte) error {
+	for reason, s := range closeReasonMarshal {
+		if s == string(bs) {
+			*r = reason
+			return nil
+		}
+	}
+	*r = CloseReasonUnknown
+	return nil
+}
+
+// CloseError is an error with a machine readable reason for closing a
+// connection. When a connection is closed with a CloseError, the code is
+// sent to the other side together with the human readable reason.
+type CloseError struct {
+	Code   CloseReason
+	Reason string
+}
+
+// NewCloseError returns a CloseError with the given code and reason.
+func NewCloseError(code CloseReason, reason string) *CloseError {
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (e *CloseError) Error() string {
+	return e.Reason
+}
+
+// RemoteCloseError is the error a connection is closed with when the other
+// side closed it, carrying the code and reason it sent.
+type RemoteCloseError struct {
+	Code   CloseReason
+	Reason string
+}
+
+func (e *RemoteCloseError) Error() string {
+	return e.Reason
+}
+
+// closeMessage returns the Close message to send for the given error.
+func closeMessage(err error) *Close {
+	msg := &Close{Reason: err.Error()}
+	if ce, ok := errors.Cause(err).(*CloseError); ok {
+		msg.Code = ce.Code
+	}
+	return msg
+}
+
+// newProtocolError returns the error a connection is closed with when the
+// other side violates the protocol.
+func newProtocolError(format string, args ...interface{}) *CloseError {
+	return NewCloseError(CloseReasonProtocolError, "protocol error: "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func closeTestConns() (*rawConnection, *rawConnection, *TestModel) {
+	m1 := newTestModel()
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c1.Start()
+
+	return c0, c1, m1
+}
+
+func TestCloseReasonRoundTrip(t *testing.T) {
+	for code := range closeReasonMarshal {
+		c0, c1, m1 := closeTestConns()
+		c0.ClusterConfig(ClusterConfig{})
+		c1.ClusterConfig(ClusterConfig{})
+
+		c0.Close(NewCloseError(code, "some reason"))
+
+		rce, ok := m1.closedError().(*RemoteCloseError)
+		if !ok {
+			t.Fatalf("%v: remote didn't get a close error: %v", code, m1.closedErr)
+		}
+		if rce.Code != code || rce.Reason != "some reason" {
+			t.Errorf("%v: got code %v, reason %q", code, rce.Code, rce.Reason)
+		}
+		c1.Close(errManual)
+
+		bs, _ := code.MarshalText()
+		var unmarshalled CloseReason
+		if err := unmarshalled.UnmarshalText(bs); err != nil || unmarshalled != code {
+			t.Errorf("%v: unmarshalled %q to %v, %v", code, bs, unmarshalled, err)
+		}
+	}
+}
+
+func TestCloseReasonUnknown(t *testing.T) {
+	// Closing with an error without a code, as older versions do, is
+	// received as an unknown reason.
+	c0, c1, m1 := closeTestConns()
+	defer c1.Close(errManual)
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{})
+
+	c0.Close(errors.New("legacy reason"))
+
+	rce, ok := m1.closedError().(*RemoteCloseError)
+	if !ok {
+		t.Fatalf("remote didn't get a close error: %v", m1.closedErr)
+	}
+	if rce.Code != CloseReasonUnknown || rce.Reason != "legacy reason" {
+		t.Errorf("got code %v, reason %q", rce.Code, rce.Reason)
+	}
+}
+
+func TestCloseReasonProtocolError(t *testing.T) {
+	// A protocol violation results in a close message to the other side.
+	c0, c1, m1 := closeTestConns()
+	defer c1.Close(errManual)
+
+	c0.inbox <- &Index{}
+
+	rce, ok := m1.closedError().(*RemoteCloseError)
+	if !ok {
+		t.Fatalf("remote didn't get a close error: %v", m1.closedErr)
+	}
+	if rce.Code != CloseReasonProtocolError {
+		t.Errorf("got code %v, expected %v", rce.Code, CloseReasonProtocolError)
+	}
+}
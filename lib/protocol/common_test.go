@@ -14,6 +14,9 @@ type TestModel struct {
 	weakHash      uint32
 	fromTemporary bool
 	indexFn       func(DeviceID, string, []FileInfo)
+	requestFn     func(DeviceID, string, string, int32, int64) (RequestResponse, error)
+	metadataFn    func(DeviceID, string, string) ([]FileInfo, error)
+	rangeFn       func(DeviceID, string, string, int32, int64) (RequestResponse, error)
 	ccFn          func(DeviceID, ClusterConfig)
 	closedCh      chan struct{}
 	closedErr     error
@@ -37,6 +40,9 @@ func (t *TestModel) IndexUpdate(deviceID DeviceID, folder string, files []FileIn
 }
 
 func (t *TestModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	if t.requestFn != nil {
+		return t.requestFn(deviceID, folder, name, size, offset)
+	}
 	t.folder = folder
 	t.name = name
 	t.offset = offset
@@ -65,6 +71,20 @@ func (t *TestModel) DownloadProgress(DeviceID, string, []FileDownloadProgressUpd
 	return nil
 }
 
+func (t *TestModel) MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error) {
+	if t.metadataFn != nil {
+		return t.metadataFn(deviceID, folder, prefix)
+	}
+	return nil, nil
+}
+
+func (t *TestModel) RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+	if t.rangeFn != nil {
+		return t.rangeFn(deviceID, folder, name, size, offset)
+	}
+	return nil, ErrNoSuchFile
+}
+
 func (t *TestModel) closedError() error {
 	select {
 	case <-t.closedCh:
@@ -0,0 +1,542 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Folders can be shared with untrusted devices, which store and pass on
+// the data without being able to read it. Towards such a device, file
+// names, symlink targets, block hashes and block data are encrypted with a
+// key derived from the folder password, and folder labels are not sent.
+// The remaining metadata (sizes, timestamps, versions) is needed by the
+// untrusted device to sync and is sent as is. Folders without a key are
+// not shared with the untrusted device at all. The untrusted device stores
+// the blocks as is, in a receive encrypted folder. It can't decrypt the
+// block hashes, but each block is encrypted with a nonce derived from its
+// encrypted hash, so it verifies that the data it pulls and serves is the
+// block announced (see VerifyEncryptedBlock). Trusted devices authenticate
+// and verify the decrypted data as usual.
+//
+// Encrypted blocks are larger than the plaintext by blockOverhead. To be
+// able to translate offsets in both directions without knowing the block
+// size, each block reserves room for the overhead per MinBlockSize of
+// plaintext in the encrypted file.
+
+const (
+	nonceSize     = chacha20poly1305.NonceSizeX
+	tagSize       = 16 // Poly1305
+	blockOverhead = nonceSize + tagSize
+
+	// FolderKeySize is the size of the key returned by KeyFromPassword.
+	FolderKeySize = chacha20poly1305.KeySize
+
+	// Encrypted names are split into path components of at most this
+	// length, to stay below file name length limits.
+	maxEncryptedPathComponent = 200
+)
+
+var (
+	errEncryptedNameInvalid = errors.New("invalid encrypted name")
+	errEncryptedDataInvalid = errors.New("invalid encrypted data")
+	errEncryptedOffset      = errors.New("invalid offset for encrypted block")
+	errEncryptedBlockHash   = errors.New("encrypted block doesn't match its hash")
+
+	nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+)
+
+// KeyFromPassword returns the key used to encrypt the given folder for
+// untrusted devices. The key depends only on the folder ID and password, so
+// all trusted devices derive the same key.
+func KeyFromPassword(folderID, password string) *[FolderKeySize]byte {
+	bs, err := scrypt.Key([]byte(password), []byte("syncthing"+folderID), 32768, 8, 1, FolderKeySize)
+	if err != nil {
+		panic("key derivation failure: " + err.Error())
+	}
+	var key [FolderKeySize]byte
+	copy(key[:], bs)
+	return &key
+}
+
+// A FolderKeyFunc returns the key a folder is encrypted with towards an
+// untrusted device, or nil if the folder must not be shared with it. It's
+// called for every message, so that key changes take effect immediately.
+type FolderKeyFunc func(folder string) *[FolderKeySize]byte
+
+// encryptedModel is the receiver for a connection to an untrusted device.
+// It decrypts the indexes it receives and encrypts the data it serves.
+// Messages for folders without a key are dropped or refused.
+type encryptedModel struct {
+	Model
+	folderKey FolderKeyFunc
+}
+
+func (e encryptedModel) Index(deviceID DeviceID, folder string, files []FileInfo) error {
+	key := e.folderKey(folder)
+	if key == nil {
+		l.Debugf("Dropping index for unencrypted folder %s from untrusted device %s", folder, deviceID)
+		return nil
+	}
+	files, err := decryptFileInfos(files, key)
+	if err != nil {
+		return err
+	}
+	return e.Model.Index(deviceID, folder, files)
+}
+
+func (e encryptedModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) error {
+	key := e.folderKey(folder)
+	if key == nil {
+		l.Debugf("Dropping index update for unencrypted folder %s from untrusted device %s", folder, deviceID)
+		return nil
+	}
+	files, err := decryptFileInfos(files, key)
+	if err != nil {
+		return err
+	}
+	return e.Model.IndexUpdate(deviceID, folder, files)
+}
+
+func (e encryptedModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	key := e.folderKey(folder)
+	if key == nil {
+		return nil, ErrNoSuchFile
+	}
+
+	realName, err := decryptName(name, key)
+	if err != nil {
+		return nil, err
+	}
+	realOffset, err := plaintextOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+	realSize := size - blockOverhead
+	if realSize < 0 {
+		return nil, errEncryptedOffset
+	}
+	var realHash []byte
+	if len(hash) > 0 {
+		if realHash, err = decryptDeterministic(hash, key); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := e.Model.Request(deviceID, folder, realName, realSize, realOffset, realHash, 0, fromTemporary)
+	if err != nil {
+		return nil, err
+	}
+	enc := encryptBlock(res.Data(), hash, key)
+	res.Close()
+	return newRawResponse(enc), nil
+}
+
+func (e encryptedModel) RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+	// Data is encrypted per block, arbitrary ranges can't be served.
+	return nil, ErrGeneric
+}
+
+func (e encryptedModel) MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error) {
+	// Names are encrypted as a whole, there are no directories to browse
+	// for the untrusted device.
+	return nil, ErrGeneric
+}
+
+func (e encryptedModel) DownloadProgress(deviceID DeviceID, folder string, updates []FileDownloadProgressUpdate) error {
+	// The untrusted device doesn't know the real names and blocks.
+	return nil
+}
+
+// encryptedConnection is a connection to an untrusted device. It encrypts
+// the indexes it sends and decrypts the data it requests. Nothing is sent
+// for folders without a key.
+type encryptedConnection struct {
+	Connection
+	folderKey FolderKeyFunc
+}
+
+func (e encryptedConnection) ClusterConfig(config ClusterConfig) {
+	folders := make([]Folder, 0, len(config.Folders))
+	for _, folder := range config.Folders {
+		if e.folderKey(folder.ID) == nil {
+			l.Debugf("Not announcing unencrypted folder %s to untrusted device %s", folder.ID, e.ID())
+			continue
+		}
+		// The label is chosen by the user and may say as much about the
+		// contents as the file names.
+		folder.Label = ""
+		folders = append(folders, folder)
+	}
+	config.Folders = folders
+	e.Connection.ClusterConfig(config)
+}
+
+func (e encryptedConnection) Index(ctx context.Context, folder string, files []FileInfo) error {
+	key := e.folderKey(folder)
+	if key == nil {
+		return nil
+	}
+	return e.Connection.Index(ctx, folder, encryptFileInfos(files, key))
+}
+
+func (e encryptedConnection) IndexUpdate(ctx context.Context, folder string, files []FileInfo) error {
+	key := e.folderKey(folder)
+	if key == nil {
+		return nil
+	}
+	return e.Connection.IndexUpdate(ctx, folder, encryptFileInfos(files, key))
+}
+
+func (e encryptedConnection) Request(ctx context.Context, folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+	key := e.folderKey(folder)
+	if key == nil {
+		return nil, ErrNoSuchFile
+	}
+
+	encOffset, err := encryptedOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+	var encHash []byte
+	if len(hash) > 0 {
+		encHash = encryptDeterministic(hash, key)
+	}
+
+	bs, err := e.Connection.Request(ctx, folder, encryptName(name, key), encOffset, size+blockOverhead, encHash, 0, fromTemporary)
+	if err != nil {
+		return nil, err
+	}
+	return decryptBytes(bs, key)
+}
+
+func (e encryptedConnection) RangeRequest(ctx context.Context, folder, name string, offset int64, size int) ([]byte, error) {
+	// The untrusted device only has encrypted blocks.
+	return nil, ErrUnsupported
+}
+
+func (e encryptedConnection) MetadataRequest(ctx context.Context, folder, prefix string) ([]FileInfo, error) {
+	// The untrusted device doesn't know the real names.
+	return nil, ErrUnsupported
+}
+
+func (e encryptedConnection) DownloadProgress(ctx context.Context, folder string, updates []FileDownloadProgressUpdate) {
+	// The untrusted device doesn't need to know what we're pulling.
+}
+
+func encryptFileInfos(files []FileInfo, key *[FolderKeySize]byte) []FileInfo {
+	encFiles := make([]FileInfo, 0, len(files))
+	for _, fi := range files {
+		enc := encryptFileInfo(fi, key)
+		encFiles = append(encFiles, encryptedParents(enc)...)
+		encFiles = append(encFiles, enc)
+	}
+	return encFiles
+}
+
+// encryptedParents returns the directories the encrypted name is split
+// into, which the untrusted device has to create to store the file. As the
+// encrypted names start with a nonce derived from the plaintext name, the
+// directories belong to this file only and share its version and deletion
+// status.
+func encryptedParents(enc FileInfo) []FileInfo {
+	n := strings.Count(enc.Name, "/")
+	if n == 0 {
+		return nil
+	}
+	dirs := make([]FileInfo, 0, n)
+	for i := 1; i <= n; i++ {
+		dirs = append(dirs, FileInfo{
+			Name:        enc.Name[:i*(maxEncryptedPathComponent+1)-1],
+			Type:        FileInfoTypeDirectory,
+			ModifiedS:   enc.ModifiedS,
+			ModifiedBy:  enc.ModifiedBy,
+			Deleted:     enc.Deleted,
+			Permissions: 0755,
+			Version:     enc.Version,
+			Sequence:    enc.Sequence,
+		})
+	}
+	return dirs
+}
+
+// encryptFileInfo returns the FileInfo as announced to an untrusted device.
+func encryptFileInfo(fi FileInfo, key *[FolderKeySize]byte) FileInfo {
+	enc := fi
+	enc.Name = encryptName(fi.Name, key)
+	if fi.SymlinkTarget != "" {
+		enc.SymlinkTarget = encryptName(fi.SymlinkTarget, key)
+	}
+	if fi.HardlinkTarget != "" {
+		enc.HardlinkTarget = encryptName(fi.HardlinkTarget, key)
+	}
+
+	if len(fi.Blocks) > 0 {
+		enc.Blocks = make([]BlockInfo, len(fi.Blocks))
+		for i, b := range fi.Blocks {
+			// Offsets in indexes are always multiples of the block size
+			// and thus of MinBlockSize, so this can't fail.
+			offset, _ := encryptedOffset(b.Offset)
+			enc.Blocks[i] = BlockInfo{
+				Offset: offset,
+				Size:   b.Size + blockOverhead,
+				Hash:   encryptDeterministic(b.Hash, key),
+			}
+		}
+		last := enc.Blocks[len(enc.Blocks)-1]
+		enc.Size = last.Offset + int64(last.Size)
+	}
+
+	return enc
+}
+
+func decryptFileInfos(files []FileInfo, key *[FolderKeySize]byte) ([]FileInfo, error) {
+	decFiles := make([]FileInfo, 0, len(files))
+	for _, fi := range files {
+		dec, err := decryptFileInfo(fi, key)
+		if err == errEncryptedNameInvalid && isEncryptedParent(fi) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		decFiles = append(decFiles, dec)
+	}
+	return decFiles, nil
+}
+
+// isEncryptedParent returns true if the FileInfo may be one of the
+// directories returned by encryptedParents, which don't exist in
+// plaintext.
+func isEncryptedParent(fi FileInfo) bool {
+	if fi.Type != FileInfoTypeDirectory {
+		return false
+	}
+	for _, part := range strings.Split(fi.Name, "/") {
+		if len(part) != maxEncryptedPathComponent {
+			return false
+		}
+	}
+	return true
+}
+
+// decryptFileInfo reverses encryptFileInfo.
+func decryptFileInfo(fi FileInfo, key *[FolderKeySize]byte) (FileInfo, error) {
+	dec := fi
+	var err error
+	if dec.Name, err = decryptName(fi.Name, key); err != nil {
+		return FileInfo{}, err
+	}
+	if fi.SymlinkTarget != "" {
+		if dec.SymlinkTarget, err = decryptName(fi.SymlinkTarget, key); err != nil {
+			return FileInfo{}, err
+		}
+	}
+	if fi.HardlinkTarget != "" {
+		if dec.HardlinkTarget, err = decryptName(fi.HardlinkTarget, key); err != nil {
+			return FileInfo{}, err
+		}
+	}
+
+	if len(fi.Blocks) > 0 {
+		dec.Blocks = make([]BlockInfo, len(fi.Blocks))
+		for i, b := range fi.Blocks {
+			if b.Size < blockOverhead {
+				return FileInfo{}, errEncryptedDataInvalid
+			}
+			offset, err := plaintextOffset(b.Offset)
+			if err != nil {
+				return FileInfo{}, err
+			}
+			hash, err := decryptDeterministic(b.Hash, key)
+			if err != nil {
+				return FileInfo{}, err
+			}
+			dec.Blocks[i] = BlockInfo{
+				Offset: offset,
+				Size:   b.Size - blockOverhead,
+				Hash:   hash,
+			}
+		}
+		last := dec.Blocks[len(dec.Blocks)-1]
+		dec.Size = last.Offset + int64(last.Size)
+	}
+
+	return dec, nil
+}
+
+// encryptedOffset returns the offset of the encrypted block corresponding
+// to the block at the given plaintext offset.
+func encryptedOffset(offset int64) (int64, error) {
+	if offset%MinBlockSize != 0 {
+		return 0, errEncryptedOffset
+	}
+	return offset + offset/MinBlockSize*blockOverhead, nil
+}
+
+// plaintextOffset reverses encryptedOffset.
+func plaintextOffset(offset int64) (int64, error) {
+	if offset%(MinBlockSize+blockOverhead) != 0 {
+		return 0, errEncryptedOffset
+	}
+	return offset / (MinBlockSize + blockOverhead) * MinBlockSize, nil
+}
+
+// encryptName returns the deterministically encrypted name, encoded as a
+// path that is valid on all filesystems.
+func encryptName(name string, key *[FolderKeySize]byte) string {
+	enc := nameEncoding.EncodeToString(encryptDeterministic([]byte(name), key))
+	parts := make([]string, 0, len(enc)/maxEncryptedPathComponent+1)
+	for len(enc) > maxEncryptedPathComponent {
+		parts = append(parts, enc[:maxEncryptedPathComponent])
+		enc = enc[maxEncryptedPathComponent:]
+	}
+	parts = append(parts, enc)
+	return strings.Join(parts, "/")
+}
+
+// decryptName reverses encryptName.
+func decryptName(name string, key *[FolderKeySize]byte) (string, error) {
+	bs, err := nameEncoding.DecodeString(strings.Replace(name, "/", "", -1))
+	if err != nil {
+		return "", errEncryptedNameInvalid
+	}
+	dec, err := decryptDeterministic(bs, key)
+	if err != nil {
+		return "", errEncryptedNameInvalid
+	}
+	return string(dec), nil
+}
+
+// encryptBytes encrypts the data with a random nonce, which is prepended
+// to the result.
+func encryptBytes(data []byte, key *[FolderKeySize]byte) []byte {
+	nonce := make([]byte, nonceSize, nonceSize+len(data)+tagSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic("random source failure: " + err.Error())
+	}
+	return newAEAD(key).Seal(nonce, nonce, data, nil)
+}
+
+// decryptBytes reverses encryptBytes.
+func decryptBytes(data []byte, key *[FolderKeySize]byte) ([]byte, error) {
+	if len(data) < blockOverhead {
+		return nil, errEncryptedDataInvalid
+	}
+	dec, err := newAEAD(key).Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, errEncryptedDataInvalid
+	}
+	return dec, nil
+}
+
+// encryptBlock encrypts the block data that was requested with the given
+// encrypted hash. The nonce is derived from the encrypted hash, so the same
+// block always results in the same ciphertext and the untrusted device can
+// tell which block it got.
+func encryptBlock(data, encHash []byte, key *[FolderKeySize]byte) []byte {
+	if len(encHash) == 0 {
+		return encryptBytes(data, key)
+	}
+	nonce := make([]byte, nonceSize, nonceSize+len(data)+tagSize)
+	copy(nonce, blockNonce(encHash))
+	return newAEAD(key).Seal(nonce, nonce, data, nil)
+}
+
+// blockNonce returns the nonce of the block with the given encrypted hash.
+// The encrypted hashes are unique per block data, and not known to anyone
+// without the key in advance.
+func blockNonce(encHash []byte) []byte {
+	sum := sha256.Sum256(append([]byte("syncthing block nonce"), encHash...))
+	return sum[:nonceSize]
+}
+
+// VerifyEncryptedBlock checks, without knowing the key, that the encrypted
+// block data is the block announced with the given encrypted hash. The
+// data itself is authenticated when a trusted device decrypts it.
+func VerifyEncryptedBlock(data, encHash []byte) error {
+	if len(data) < blockOverhead {
+		return errEncryptedDataInvalid
+	}
+	if !bytes.Equal(data[:nonceSize], blockNonce(encHash)) {
+		return errEncryptedBlockHash
+	}
+	return nil
+}
+
+// encryptDeterministic encrypts the data such that the same data always
+// results in the same ciphertext, by using a nonce derived from the data
+// (a synthetic IV). This is required for names and hashes, which must be
+// stable across devices and over time.
+func encryptDeterministic(data []byte, key *[FolderKeySize]byte) []byte {
+	nonce := syntheticNonce(data, key)
+	return newAEAD(key).Seal(nonce, nonce, data, nil)
+}
+
+// decryptDeterministic reverses encryptDeterministic.
+func decryptDeterministic(data []byte, key *[FolderKeySize]byte) ([]byte, error) {
+	dec, err := decryptBytes(data, key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(syntheticNonce(dec, key), data[:nonceSize]) {
+		return nil, errEncryptedDataInvalid
+	}
+	return dec, nil
+}
+
+func syntheticNonce(data []byte, key *[FolderKeySize]byte) []byte {
+	// Use a separate key for the MAC, derived from the folder key.
+	macKey := sha256.Sum256(append([]byte("syncthing synthetic nonce"), key[:]...))
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write(data)
+	sum := mac.Sum(make([]byte, 0, sha256.Size))
+	return sum[:nonceSize]
+}
+
+func newAEAD(key *[FolderKeySize]byte) cipher.AEAD {
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		// Only happens with an invalid key size, which can't happen.
+		panic(fmt.Sprintf("creating cipher: %v", err))
+	}
+	return aead
+}
+
+// rawResponse is a RequestResponse for data that isn't backed by a
+// buffer needing to be returned.
+type rawResponse struct {
+	data   []byte
+	closed chan struct{}
+}
+
+func newRawResponse(data []byte) *rawResponse {
+	return &rawResponse{
+		data:   data,
+		closed: make(chan struct{}),
+	}
+}
+
+func (r *rawResponse) Data() []byte {
+	return r.data
+}
+
+func (r *rawResponse) Close() {
+	close(r.closed)
+}
+
+func (r *rawResponse) Wait() {
+	<-r.closed
+}
@@ -0,0 +1,441 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/rand"
+)
+
+func TestEncryptName(t *testing.T) {
+	key := KeyFromPassword("default", "secret")
+	if *key != *KeyFromPassword("default", "secret") {
+		t.Error("key derivation is not deterministic")
+	}
+	if *key == *KeyFromPassword("other", "secret") {
+		t.Error("keys for different folders should differ")
+	}
+
+	for _, name := range []string{"a", "dir/file.txt", strings.Repeat("long/name", 100)} {
+		enc := encryptName(name, key)
+		if strings.Contains(enc, "name") || strings.Contains(enc, "file") {
+			t.Errorf("encrypted name %q contains the plaintext", enc)
+		}
+		if encryptName(name, key) != enc {
+			t.Errorf("name encryption for %q is not deterministic", name)
+		}
+		for _, part := range strings.Split(enc, "/") {
+			if len(part) > maxEncryptedPathComponent {
+				t.Errorf("encrypted path component too long: %d", len(part))
+			}
+		}
+
+		dec, err := decryptName(enc, key)
+		if err != nil {
+			t.Error(err)
+		} else if dec != name {
+			t.Errorf("decrypted name %q, expected %q", dec, name)
+		}
+
+		if _, err := decryptName(enc, KeyFromPassword("default", "wrong")); err == nil {
+			t.Error("decrypting with the wrong key should fail")
+		}
+	}
+}
+
+func TestEncryptedOffsets(t *testing.T) {
+	for _, blockSize := range BlockSizes {
+		for i := int64(0); i < 5; i++ {
+			offset := i * int64(blockSize)
+			enc, err := encryptedOffset(offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The encrypted blocks must not overlap.
+			if next, _ := encryptedOffset(offset + int64(blockSize)); next < enc+int64(blockSize)+blockOverhead {
+				t.Errorf("encrypted block at %d overlaps the next one at %d", enc, next)
+			}
+			if dec, err := plaintextOffset(enc); err != nil || dec != offset {
+				t.Errorf("plaintextOffset(%d) => %d, %v, expected %d", enc, dec, err, offset)
+			}
+		}
+	}
+
+	if _, err := plaintextOffset(MinBlockSize); err == nil {
+		t.Error("unexpected nil error for invalid encrypted offset")
+	}
+}
+
+// blockModel serves requests from the given data, verifying the hashes.
+type blockModel struct {
+	*TestModel
+	data []byte
+}
+
+func (m *blockModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	if offset+int64(size) > int64(len(m.data)) {
+		return nil, ErrNoSuchFile
+	}
+	data := m.data[offset : offset+int64(size)]
+	if h := sha256.Sum256(data); !bytes.Equal(h[:], hash) {
+		return nil, ErrInvalid
+	}
+	return &fakeRequestResponse{data}, nil
+}
+
+// untrustedModel stores the indexes and data it gets, without being able
+// to decrypt them, and serves requests from what it has stored.
+type untrustedModel struct {
+	*TestModel
+	mut   sync.Mutex
+	files map[string]FileInfo
+	data  map[string][]byte
+	index chan struct{}
+}
+
+func newUntrustedModel() *untrustedModel {
+	return &untrustedModel{
+		TestModel: newTestModel(),
+		files:     make(map[string]FileInfo),
+		data:      make(map[string][]byte),
+		index:     make(chan struct{}, 1),
+	}
+}
+
+func (m *untrustedModel) Index(deviceID DeviceID, folder string, files []FileInfo) error {
+	m.mut.Lock()
+	for _, f := range files {
+		m.files[f.Name] = f
+		m.data[f.Name] = make([]byte, f.Size)
+	}
+	m.mut.Unlock()
+	m.index <- struct{}{}
+	return nil
+}
+
+// Closed is a no-op, as the model is used for several connections.
+func (m *untrustedModel) Closed(Connection, error) {}
+
+func (m *untrustedModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	data, ok := m.data[name]
+	if !ok || offset+int64(size) > int64(len(data)) {
+		return nil, ErrNoSuchFile
+	}
+	buf := make([]byte, size)
+	copy(buf, data[offset:])
+	return &fakeRequestResponse{buf}, nil
+}
+
+// keyFunc returns a FolderKeyFunc looking up the keys in the map.
+func keyFunc(keys map[string]*[FolderKeySize]byte) FolderKeyFunc {
+	return func(folder string) *[FolderKeySize]byte {
+		return keys[folder]
+	}
+}
+
+func connectionPair(trusted, untrusted Model, keys map[string]*[FolderKeySize]byte) (Connection, Connection) {
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	trustedConn := NewEncryptedConnection(c1ID, ar, bw, trusted, "untrusted", CompressAlways, keyFunc(keys))
+	trustedConn.Start()
+	untrustedConn := NewConnection(c0ID, br, aw, untrusted, "trusted", CompressAlways)
+	untrustedConn.Start()
+	trustedConn.ClusterConfig(ClusterConfig{})
+	untrustedConn.ClusterConfig(ClusterConfig{})
+
+	return trustedConn, untrustedConn
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	const secret = "secret-name"
+	keys := map[string]*[FolderKeySize]byte{
+		"default": KeyFromPassword("default", "password"),
+	}
+
+	// A file of two and a half blocks.
+
+	plain := make([]byte, 5*MinBlockSize/2)
+	if _, err := io.ReadFull(rand.Reader, plain); err != nil {
+		t.Fatal(err)
+	}
+	file := FileInfo{
+		Name:         "dir/" + secret,
+		Type:         FileInfoTypeFile,
+		Size:         int64(len(plain)),
+		ModifiedS:    1234,
+		Version:      Vector{}.Update(42),
+		Sequence:     1,
+		RawBlockSize: MinBlockSize,
+	}
+	for offset := 0; offset < len(plain); offset += MinBlockSize {
+		end := offset + MinBlockSize
+		if end > len(plain) {
+			end = len(plain)
+		}
+		hash := sha256.Sum256(plain[offset:end])
+		file.Blocks = append(file.Blocks, BlockInfo{Offset: int64(offset), Size: int32(end - offset), Hash: hash[:]})
+	}
+
+	untrusted := newUntrustedModel()
+
+	// The first trusted device sends the file to the untrusted one.
+
+	source := &blockModel{newTestModel(), plain}
+	sourceConn, untrustedToSource := connectionPair(source, untrusted, keys)
+	defer sourceConn.Close(errManual)
+	defer untrustedToSource.Close(errManual)
+
+	if err := sourceConn.Index(context.Background(), "default", []FileInfo{file}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-untrusted.index:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for index")
+	}
+
+	untrusted.mut.Lock()
+	if len(untrusted.files) != 1 {
+		t.Fatal("expected exactly one file on the untrusted device")
+	}
+	var enc FileInfo
+	for _, f := range untrusted.files {
+		enc = f
+	}
+	untrusted.mut.Unlock()
+
+	if strings.Contains(enc.Name, secret) || strings.Contains(enc.Name, "dir") {
+		t.Errorf("untrusted device sees plaintext name %q", enc.Name)
+	}
+	if len(enc.Blocks) != len(file.Blocks) {
+		t.Fatalf("untrusted device got %d blocks, expected %d", len(enc.Blocks), len(file.Blocks))
+	}
+	for i, b := range enc.Blocks {
+		if bytes.Equal(b.Hash, file.Blocks[i].Hash) {
+			t.Errorf("untrusted device sees plaintext hash for block %d", i)
+		}
+
+		// Pull the block, as the untrusted device would.
+		data, err := untrustedToSource.Request(context.Background(), "default", enc.Name, b.Offset, int(b.Size), b.Hash, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != int(b.Size) {
+			t.Fatalf("got %d bytes for block %d, expected %d", len(data), i, b.Size)
+		}
+		if bytes.Contains(data, plain[file.Blocks[i].Offset:file.Blocks[i].Offset+64]) {
+			t.Errorf("untrusted device sees plaintext data for block %d", i)
+		}
+		if err := VerifyEncryptedBlock(data, b.Hash); err != nil {
+			t.Errorf("block %d doesn't verify against its encrypted hash: %v", i, err)
+		}
+		if err := VerifyEncryptedBlock(data, enc.Blocks[(i+1)%len(enc.Blocks)].Hash); err == nil {
+			t.Errorf("block %d verifies against the hash of another block", i)
+		}
+		again, err := untrustedToSource.Request(context.Background(), "default", enc.Name, b.Offset, int(b.Size), b.Hash, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("block %d is encrypted differently when requested again", i)
+		}
+		untrusted.mut.Lock()
+		copy(untrusted.data[enc.Name][b.Offset:], data)
+		untrusted.mut.Unlock()
+	}
+
+	// The second trusted device gets the file from the untrusted one.
+
+	dest := newTestModel()
+	received := make(chan []FileInfo, 1)
+	dest.indexFn = func(_ DeviceID, _ string, fs []FileInfo) { received <- fs }
+	destConn, untrustedToDest := connectionPair(dest, untrusted, keys)
+	defer destConn.Close(errManual)
+	defer untrustedToDest.Close(errManual)
+
+	if err := untrustedToDest.Index(context.Background(), "default", []FileInfo{enc}); err != nil {
+		t.Fatal(err)
+	}
+	var files []FileInfo
+	select {
+	case files = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for index")
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %d", len(files))
+	}
+	if got := files[0]; got.Name != file.Name || got.Size != file.Size || got.ModifiedS != file.ModifiedS || !got.Version.Equal(file.Version) || !BlocksEqual(got.Blocks, file.Blocks) {
+		t.Fatalf("decrypted file %v differs from original %v", got, file)
+	}
+
+	for _, b := range files[0].Blocks {
+		data, err := destConn.Request(context.Background(), "default", files[0].Name, b.Offset, int(b.Size), b.Hash, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, plain[b.Offset:b.Offset+int64(b.Size)]) {
+			t.Errorf("block at %d differs after round trip", b.Offset)
+		}
+	}
+}
+
+func TestEncryptedParents(t *testing.T) {
+	key := KeyFromPassword("default", "secret")
+	file := FileInfo{
+		Name:      strings.Repeat("long/name", 100),
+		Type:      FileInfoTypeFile,
+		ModifiedS: 1234,
+		Version:   Vector{}.Update(42),
+	}
+
+	enc := encryptFileInfos([]FileInfo{file}, key)
+	if len(enc) < 2 {
+		t.Fatalf("expected the encrypted name to be split, got %d files", len(enc))
+	}
+
+	// Every path component must be announced before the file.
+	seen := make(map[string]bool)
+	for _, f := range enc[:len(enc)-1] {
+		if f.Type != FileInfoTypeDirectory {
+			t.Errorf("parent %q is not a directory", f.Name)
+		}
+		if !f.Version.Equal(file.Version) {
+			t.Errorf("parent %q has version %v, expected %v", f.Name, f.Version, file.Version)
+		}
+		if dir := path.Dir(f.Name); dir != "." && !seen[dir] {
+			t.Errorf("parent %q announced before its own parent", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	last := enc[len(enc)-1]
+	if !seen[path.Dir(last.Name)] {
+		t.Errorf("parent of %q wasn't announced", last.Name)
+	}
+
+	// The parents don't exist in plaintext.
+	dec, err := decryptFileInfos(enc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec) != 1 || dec[0].Name != file.Name {
+		t.Errorf("decrypted %v, expected just %q", dec, file.Name)
+	}
+}
+
+func TestEncryptedClusterConfig(t *testing.T) {
+	keys := map[string]*[FolderKeySize]byte{
+		"secret": KeyFromPassword("secret", "password"),
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+	received := make(chan ClusterConfig, 1)
+	untrusted := newTestModel()
+	untrusted.ccFn = func(_ DeviceID, cc ClusterConfig) { received <- cc }
+
+	trustedConn := NewEncryptedConnection(c1ID, ar, bw, newTestModel(), "untrusted", CompressAlways, keyFunc(keys))
+	trustedConn.Start()
+	defer trustedConn.Close(errManual)
+	untrustedConn := NewConnection(c0ID, br, aw, untrusted, "trusted", CompressAlways)
+	untrustedConn.Start()
+	defer untrustedConn.Close(errManual)
+
+	cc := ClusterConfig{Folders: []Folder{
+		{ID: "secret", Label: "Tax returns"},
+		{ID: "plain", Label: "Photos"},
+	}}
+	trustedConn.ClusterConfig(cc)
+	untrustedConn.ClusterConfig(ClusterConfig{})
+
+	select {
+	case got := <-received:
+		// The folder without a key isn't shared with the untrusted device.
+		if len(got.Folders) != 1 || got.Folders[0].ID != "secret" {
+			t.Fatalf("expected only the encrypted folder, got %v", got.Folders)
+		}
+		if got.Folders[0].Label != "" {
+			t.Errorf("untrusted device sees label %q of encrypted folder", got.Folders[0].Label)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for cluster config")
+	}
+
+	if cc.Folders[0].Label != "Tax returns" {
+		t.Error("the passed cluster config was modified")
+	}
+}
+
+func TestEncryptedKeyLookup(t *testing.T) {
+	// The key is looked up for every message, so a folder that gets a key
+	// is encrypted from then on, and nothing is sent for it before.
+
+	var mut sync.Mutex
+	keys := make(map[string]*[FolderKeySize]byte)
+	folderKey := func(folder string) *[FolderKeySize]byte {
+		mut.Lock()
+		defer mut.Unlock()
+		return keys[folder]
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+	received := make(chan []FileInfo, 2)
+	untrusted := newTestModel()
+	untrusted.indexFn = func(_ DeviceID, _ string, fs []FileInfo) { received <- fs }
+
+	trustedConn := NewEncryptedConnection(c1ID, ar, bw, newTestModel(), "untrusted", CompressAlways, folderKey)
+	trustedConn.Start()
+	defer trustedConn.Close(errManual)
+	untrustedConn := NewConnection(c0ID, br, aw, untrusted, "trusted", CompressAlways)
+	untrustedConn.Start()
+	defer untrustedConn.Close(errManual)
+	trustedConn.ClusterConfig(ClusterConfig{})
+	untrustedConn.ClusterConfig(ClusterConfig{})
+
+	hash := sha256.Sum256(nil)
+	files := []FileInfo{{
+		Name:     "secret-name",
+		Type:     FileInfoTypeFile,
+		Version:  Vector{}.Update(42),
+		Sequence: 1,
+		Blocks:   []BlockInfo{{Hash: hash[:]}},
+	}}
+	if err := trustedConn.Index(context.Background(), "default", files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trustedConn.Request(context.Background(), "default", "secret-name", 0, 10, nil, 0, false); err != ErrNoSuchFile {
+		t.Errorf("unexpected error %v requesting from a folder without key", err)
+	}
+
+	mut.Lock()
+	keys["default"] = KeyFromPassword("default", "password")
+	mut.Unlock()
+	if err := trustedConn.Index(context.Background(), "default", files); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		for _, f := range got {
+			if strings.Contains(f.Name, "secret") {
+				t.Errorf("untrusted device sees plaintext name %q", f.Name)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for index")
+	}
+}
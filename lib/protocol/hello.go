@@ -23,8 +23,13 @@ type HelloResult struct {
 	DeviceName    string
 	ClientName    string
 	ClientVersion string
+	Platform      string
 }
 
+// MaxPlatformLength is the maximum length of the platform string accepted
+// from the other side; anything longer is truncated.
+const MaxPlatformLength = 64
+
 var (
 	// ErrTooOldVersion is returned by ExchangeHello when the other side
 	// speaks an older, incompatible version of the protocol.
@@ -77,6 +82,9 @@ func readHello(c io.Reader) (HelloResult, error) {
 		if err := hello.Unmarshal(buf); err != nil {
 			return HelloResult{}, err
 		}
+		if len(hello.Platform) > MaxPlatformLength {
+			hello.Platform = hello.Platform[:MaxPlatformLength]
+		}
 		return HelloResult(hello), nil
 
 	case 0x00010001, 0x00010000, Version13HelloMagic:
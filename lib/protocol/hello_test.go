@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -55,6 +56,36 @@ func TestVersion14Hello(t *testing.T) {
 	if res.DeviceName != expected.DeviceName {
 		t.Errorf("incorrect DeviceName %q != expected %q", res.DeviceName, expected.DeviceName)
 	}
+	if res.Platform != "" {
+		t.Errorf("incorrect Platform %q for peer not sending one", res.Platform)
+	}
+}
+
+func TestHelloPlatform(t *testing.T) {
+	long := strings.Repeat("x", 10*MaxPlatformLength)
+
+	cases := []struct {
+		platform string
+		expected string
+	}{
+		{"", ""},
+		{"linux/arm64", "linux/arm64"},
+		{long, long[:MaxPlatformLength]},
+	}
+
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		if err := writeHello(buf, &Hello{ClientName: "syncthing", Platform: tc.platform}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := readHello(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Platform != tc.expected {
+			t.Errorf("incorrect Platform %q != expected %q", res.Platform, tc.expected)
+		}
+	}
 }
 
 func TestOldHelloMsgs(t *testing.T) {
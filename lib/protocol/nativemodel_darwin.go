@@ -30,3 +30,17 @@ func (m nativeModel) Request(deviceID DeviceID, folder, name string, size int32,
 	name = norm.NFD.String(name)
 	return m.Model.Request(deviceID, folder, name, size, offset, hash, weakHash, fromTemporary)
 }
+
+func (m nativeModel) RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+	name = norm.NFD.String(name)
+	return m.Model.RangeRequest(deviceID, folder, name, size, offset)
+}
+
+func (m nativeModel) MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error) {
+	prefix = norm.NFD.String(prefix)
+	files, err := m.Model.MetadataRequest(deviceID, folder, prefix)
+	for i := range files {
+		files[i].Name = norm.NFC.String(files[i].Name)
+	}
+	return files, err
+}
@@ -35,6 +35,29 @@ func (m nativeModel) Request(deviceID DeviceID, folder, name string, size int32,
 	return m.Model.Request(deviceID, folder, name, size, offset, hash, weakHash, fromTemporary)
 }
 
+func (m nativeModel) RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+	if strings.Contains(name, `\`) {
+		l.Warnf("Dropping range request for %s, contains invalid path separator", name)
+		return nil, ErrNoSuchFile
+	}
+
+	name = filepath.FromSlash(name)
+	return m.Model.RangeRequest(deviceID, folder, name, size, offset)
+}
+
+func (m nativeModel) MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error) {
+	if strings.Contains(prefix, `\`) {
+		l.Warnf("Dropping metadata request for %s, contains invalid path separator", prefix)
+		return nil, ErrNoSuchFile
+	}
+
+	files, err := m.Model.MetadataRequest(deviceID, folder, filepath.FromSlash(prefix))
+	for i := range files {
+		files[i].Name = filepath.ToSlash(files[i].Name)
+	}
+	return files, err
+}
+
 func fixupFiles(files []FileInfo) []FileInfo {
 	var out []FileInfo
 	for i := range files {
@@ -101,6 +101,7 @@ const (
 var (
 	ErrClosed             = errors.New("connection closed")
 	ErrTimeout            = errors.New("read timeout")
+	ErrUnsupported        = errors.New("not supported by the remote device")
 	errUnknownMessage     = errors.New("unknown message")
 	errInvalidFilename    = errors.New("filename is invalid")
 	errUncleanFilename    = errors.New("filename not in canonical format")
@@ -122,6 +123,10 @@ type Model interface {
 	Closed(conn Connection, err error)
 	// The peer device sent progress updates for the files it is currently downloading
 	DownloadProgress(deviceID DeviceID, folder string, updates []FileDownloadProgressUpdate) error
+	// The peer device requested the metadata of the files in a directory
+	MetadataRequest(deviceID DeviceID, folder, prefix string) ([]FileInfo, error)
+	// The peer device requested an arbitrary byte range of a file
+	RangeRequest(deviceID DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error)
 }
 
 type RequestResponse interface {
@@ -138,10 +143,14 @@ type Connection interface {
 	Index(ctx context.Context, folder string, files []FileInfo) error
 	IndexUpdate(ctx context.Context, folder string, files []FileInfo) error
 	Request(ctx context.Context, folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error)
+	MetadataRequest(ctx context.Context, folder, prefix string) ([]FileInfo, error)
+	RangeRequest(ctx context.Context, folder, name string, offset int64, size int) ([]byte, error)
 	ClusterConfig(config ClusterConfig)
+	HasCapability(name string) bool
 	DownloadProgress(ctx context.Context, folder string, updates []FileDownloadProgressUpdate)
 	Statistics() Statistics
 	Closed() bool
+	Drain(ctx context.Context, err error)
 }
 
 type rawConnection struct {
@@ -149,8 +158,9 @@ type rawConnection struct {
 	name     string
 	receiver Model
 
-	cr *countingReader
-	cw *countingWriter
+	cr  *countingReader
+	cw  *countingWriter
+	rtt *rttTracker
 
 	awaiting    map[int32]chan asyncResult
 	awaitingMut sync.Mutex
@@ -164,17 +174,28 @@ type rawConnection struct {
 	outbox                chan asyncMessage
 	closeBox              chan asyncMessage
 	clusterConfigBox      chan *ClusterConfig
+	clusterConfigSent     chan struct{}
 	dispatcherLoopStopped chan struct{}
 	preventSends          chan struct{}
 	closed                chan struct{}
 	closeOnce             sync.Once
 	sendCloseOnce         sync.Once
 	compression           Compression
+
+	remoteConfig    *ClusterConfig
+	requestSlots    chan struct{} // the peer's request window, nil if unbounded
+	remoteConfigMut sync.Mutex
+
+	drainMut         sync.Mutex
+	draining         bool
+	requestsInFlight int
+	drained          chan struct{} // closed once draining and no requests are in flight
 }
 
 type asyncResult struct {
-	val []byte
-	err error
+	val   []byte
+	files []FileInfo // for metadata requests
+	err   error
 }
 
 type message interface {
@@ -204,27 +225,43 @@ const (
 var CloseTimeout = 10 * time.Second
 
 func NewConnection(deviceID DeviceID, reader io.Reader, writer io.Writer, receiver Model, name string, compress Compression) Connection {
+	return wireFormatConnection{newRawConnection(deviceID, reader, writer, nativeModel{receiver}, name, compress)}
+}
+
+// NewEncryptedConnection returns a connection to an untrusted device.
+// Folders are encrypted using the keys returned by folderKey, see
+// KeyFromPassword; folders without a key aren't shared over it.
+func NewEncryptedConnection(deviceID DeviceID, reader io.Reader, writer io.Writer, receiver Model, name string, compress Compression, folderKey FolderKeyFunc) Connection {
+	// Names are encrypted in wire format, so the encryption happens
+	// between the wire format conversion and the raw connection.
+	em := encryptedModel{nativeModel{receiver}, folderKey}
+	c := newRawConnection(deviceID, reader, writer, em, name, compress)
+	return wireFormatConnection{encryptedConnection{c, folderKey}}
+}
+
+func newRawConnection(deviceID DeviceID, reader io.Reader, writer io.Writer, receiver Model, name string, compress Compression) *rawConnection {
 	cr := &countingReader{Reader: reader}
 	cw := &countingWriter{Writer: writer}
 
-	c := rawConnection{
+	return &rawConnection{
 		id:                    deviceID,
 		name:                  name,
-		receiver:              nativeModel{receiver},
+		receiver:              receiver,
 		cr:                    cr,
 		cw:                    cw,
+		rtt:                   newRTTTracker(),
 		awaiting:              make(map[int32]chan asyncResult),
 		inbox:                 make(chan message),
 		outbox:                make(chan asyncMessage),
 		closeBox:              make(chan asyncMessage),
 		clusterConfigBox:      make(chan *ClusterConfig),
+		clusterConfigSent:     make(chan struct{}),
 		dispatcherLoopStopped: make(chan struct{}),
 		preventSends:          make(chan struct{}),
 		closed:                make(chan struct{}),
+		drained:               make(chan struct{}),
 		compression:           compress,
 	}
-
-	return wireFormatConnection{&c}
 }
 
 // Start creates the goroutines for sending and receiving of messages. It must
@@ -233,6 +270,11 @@ func (c *rawConnection) Start() {
 	go c.readerLoop()
 	go func() {
 		err := c.dispatcherLoop()
+		if ce, ok := err.(*CloseError); ok {
+			// Let the other side know about protocol errors.
+			c.Close(ce)
+			return
+		}
 		c.internalClose(err)
 	}()
 	go c.writerLoop()
@@ -282,6 +324,11 @@ func (c *rawConnection) IndexUpdate(ctx context.Context, folder string, idx []Fi
 
 // Request returns the bytes for the specified block after fetching them from the connected peer.
 func (c *rawConnection) Request(ctx context.Context, folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+	release, err := c.acquireRequestSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	c.nextIDMut.Lock()
 	id := c.nextID
 	c.nextID++
@@ -306,17 +353,150 @@ func (c *rawConnection) Request(ctx context.Context, folder string, name string,
 		FromTemporary: fromTemporary,
 	}, nil)
 	if !ok {
+		release()
+		return nil, ErrClosed
+	}
+
+	res, err := c.awaitResponse(ctx, rc, release)
+	if err != nil {
+		return nil, err
+	}
+	return res.val, res.err
+}
+
+// MetadataRequest returns the files and directories directly in the prefix
+// directory, or in the root of the folder for an empty prefix, without
+// their blocks. It fails with ErrUnsupported if the peer doesn't support
+// metadata requests.
+func (c *rawConnection) MetadataRequest(ctx context.Context, folder, prefix string) ([]FileInfo, error) {
+	if !c.HasCapability(CapabilityMetadataRequests) {
+		return nil, ErrUnsupported
+	}
+
+	release, err := c.acquireRequestSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.nextIDMut.Lock()
+	id := c.nextID
+	c.nextID++
+	c.nextIDMut.Unlock()
+
+	c.awaitingMut.Lock()
+	if _, ok := c.awaiting[id]; ok {
+		panic("id taken")
+	}
+	rc := make(chan asyncResult, 1)
+	c.awaiting[id] = rc
+	c.awaitingMut.Unlock()
+
+	ok := c.send(ctx, &MetadataRequest{
+		ID:     id,
+		Folder: folder,
+		Prefix: prefix,
+	}, nil)
+	if !ok {
+		release()
+		return nil, ErrClosed
+	}
+
+	res, err := c.awaitResponse(ctx, rc, release)
+	if err != nil {
+		return nil, err
+	}
+	return res.files, res.err
+}
+
+// RangeRequest returns size bytes of the file at the given offset, which
+// unlike for Request needn't be aligned to blocks. The peer verifies the
+// data against the hashes of the blocks the range overlaps before sending
+// it. It fails with ErrUnsupported if the peer doesn't support range
+// requests.
+func (c *rawConnection) RangeRequest(ctx context.Context, folder, name string, offset int64, size int) ([]byte, error) {
+	if !c.HasCapability(CapabilityRangeRequests) {
+		return nil, ErrUnsupported
+	}
+
+	release, err := c.acquireRequestSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.nextIDMut.Lock()
+	id := c.nextID
+	c.nextID++
+	c.nextIDMut.Unlock()
+
+	c.awaitingMut.Lock()
+	if _, ok := c.awaiting[id]; ok {
+		panic("id taken")
+	}
+	rc := make(chan asyncResult, 1)
+	c.awaiting[id] = rc
+	c.awaitingMut.Unlock()
+
+	ok := c.send(ctx, &RangeRequest{
+		ID:     id,
+		Folder: folder,
+		Name:   name,
+		Offset: offset,
+		Size:   int32(size),
+	}, nil)
+	if !ok {
+		release()
+		return nil, ErrClosed
+	}
+
+	res, err := c.awaitResponse(ctx, rc, release)
+	if err != nil {
+		return nil, err
+	}
+	return res.val, res.err
+}
+
+// acquireRequestSlot blocks until there is room in the request window the
+// peer advertised in its cluster config. The returned function must be
+// called once the response has arrived. Peers not advertising a window get
+// unbounded requests.
+func (c *rawConnection) acquireRequestSlot(ctx context.Context) (func(), error) {
+	c.remoteConfigMut.Lock()
+	slots := c.requestSlots
+	c.remoteConfigMut.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
 		return nil, ErrClosed
 	}
+}
 
+// awaitResponse waits for the response to a request and then releases its
+// slot in the request window. If the context ends first, the slot is kept
+// until the response arrives or the connection is closed, as the peer is
+// still working on it.
+func (c *rawConnection) awaitResponse(ctx context.Context, rc chan asyncResult, release func()) (asyncResult, error) {
 	select {
 	case res, ok := <-rc:
+		release()
 		if !ok {
-			return nil, ErrClosed
+			return asyncResult{}, ErrClosed
 		}
-		return res.val, res.err
+		return res, nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		// The channel is closed on connection close if no response
+		// arrives before.
+		go func() {
+			<-rc
+			release()
+		}()
+		return asyncResult{}, ctx.Err()
 	}
 }
 
@@ -330,6 +510,15 @@ func (c *rawConnection) ClusterConfig(config ClusterConfig) {
 	}
 }
 
+// HasCapability returns true if the peer advertised the given capability in
+// its cluster config message. It returns false until that message has been
+// received.
+func (c *rawConnection) HasCapability(name string) bool {
+	c.remoteConfigMut.Lock()
+	defer c.remoteConfigMut.Unlock()
+	return c.remoteConfig != nil && c.remoteConfig.HasCapability(name)
+}
+
 func (c *rawConnection) Closed() bool {
 	select {
 	case <-c.closed:
@@ -348,7 +537,7 @@ func (c *rawConnection) DownloadProgress(ctx context.Context, folder string, upd
 }
 
 func (c *rawConnection) ping() bool {
-	return c.send(context.Background(), &Ping{}, nil)
+	return c.send(context.Background(), c.rtt.ping(), nil)
 }
 
 func (c *rawConnection) readerLoop() {
@@ -386,8 +575,14 @@ func (c *rawConnection) dispatcherLoop() (err error) {
 		case *ClusterConfig:
 			l.Debugln("read ClusterConfig message")
 			if state != stateInitial {
-				return fmt.Errorf("protocol error: cluster config message in state %d", state)
+				return newProtocolError("cluster config message in state %d", state)
 			}
+			c.remoteConfigMut.Lock()
+			c.remoteConfig = msg
+			if msg.MaxConcurrentRequests > 0 {
+				c.requestSlots = make(chan struct{}, msg.MaxConcurrentRequests)
+			}
+			c.remoteConfigMut.Unlock()
 			if err := c.receiver.ClusterConfig(c.id, *msg); err != nil {
 				return errors.Wrap(err, "receiver error")
 			}
@@ -396,10 +591,10 @@ func (c *rawConnection) dispatcherLoop() (err error) {
 		case *Index:
 			l.Debugln("read Index message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: index message in state %d", state)
+				return newProtocolError("index message in state %d", state)
 			}
 			if err := checkIndexConsistency(msg.Files); err != nil {
-				return errors.Wrap(err, "protocol error: index")
+				return newProtocolError("index: %v", err)
 			}
 			if err := c.handleIndex(*msg); err != nil {
 				return errors.Wrap(err, "receiver error")
@@ -409,10 +604,10 @@ func (c *rawConnection) dispatcherLoop() (err error) {
 		case *IndexUpdate:
 			l.Debugln("read IndexUpdate message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: index update message in state %d", state)
+				return newProtocolError("index update message in state %d", state)
 			}
 			if err := checkIndexConsistency(msg.Files); err != nil {
-				return errors.Wrap(err, "protocol error: index update")
+				return newProtocolError("index update: %v", err)
 			}
 			if err := c.handleIndexUpdate(*msg); err != nil {
 				return errors.Wrap(err, "receiver error")
@@ -422,24 +617,90 @@ func (c *rawConnection) dispatcherLoop() (err error) {
 		case *Request:
 			l.Debugln("read Request message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: request message in state %d", state)
+				return newProtocolError("request message in state %d", state)
 			}
 			if err := checkFilename(msg.Name); err != nil {
-				return errors.Wrapf(err, "protocol error: request: %q", msg.Name)
+				return newProtocolError("request: %q: %v", msg.Name, err)
+			}
+			if c.startRequest() {
+				go func(req Request) {
+					c.handleRequest(req)
+					c.finishRequest()
+				}(*msg)
+			} else {
+				// We're draining the connection, the other side will
+				// have to get the data elsewhere or after reconnecting.
+				go c.send(context.Background(), &Response{
+					ID:   msg.ID,
+					Code: ErrorCodeGeneric,
+				}, nil)
 			}
-			go c.handleRequest(*msg)
 
 		case *Response:
 			l.Debugln("read Response message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: response message in state %d", state)
+				return newProtocolError("response message in state %d", state)
 			}
 			c.handleResponse(*msg)
 
+		case *RangeRequest:
+			l.Debugln("read RangeRequest message")
+			if state != stateReady {
+				return newProtocolError("range request message in state %d", state)
+			}
+			if err := checkFilename(msg.Name); err != nil {
+				return newProtocolError("range request: %q: %v", msg.Name, err)
+			}
+			if c.startRequest() {
+				go func(req RangeRequest) {
+					c.handleRangeRequest(req)
+					c.finishRequest()
+				}(*msg)
+			} else {
+				go c.send(context.Background(), &Response{
+					ID:   msg.ID,
+					Code: ErrorCodeGeneric,
+				}, nil)
+			}
+
+		case *MetadataRequest:
+			l.Debugln("read MetadataRequest message")
+			if state != stateReady {
+				return newProtocolError("metadata request message in state %d", state)
+			}
+			if msg.Prefix != "" {
+				if err := checkFilename(msg.Prefix); err != nil {
+					return newProtocolError("metadata request: %q: %v", msg.Prefix, err)
+				}
+			}
+			if c.startRequest() {
+				go func(req MetadataRequest) {
+					c.handleMetadataRequest(req)
+					c.finishRequest()
+				}(*msg)
+			} else {
+				go c.send(context.Background(), &MetadataResponse{
+					ID:   msg.ID,
+					Code: ErrorCodeGeneric,
+				}, nil)
+			}
+
+		case *MetadataResponse:
+			l.Debugln("read MetadataResponse message")
+			if state != stateReady {
+				return newProtocolError("metadata response message in state %d", state)
+			}
+			for _, f := range msg.Files {
+				if err := checkFilename(f.Name); err != nil {
+					return newProtocolError("metadata response: %q: %v", f.Name, err)
+				}
+			}
+			c.handleMetadataResponse(*msg)
+
 		case *DownloadProgress:
 			l.Debugln("read DownloadProgress message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: response message in state %d", state)
+				return newProtocolError("response message in state %d", state)
 			}
 			if err := c.receiver.DownloadProgress(c.id, msg.Folder, msg.Updates); err != nil {
 				return errors.Wrap(err, "receiver error")
@@ -448,17 +709,23 @@ func (c *rawConnection) dispatcherLoop() (err error) {
 		case *Ping:
 			l.Debugln("read Ping message")
 			if state != stateReady {
-				return fmt.Errorf("protocol error: ping message in state %d", state)
+				return newProtocolError("ping message in state %d", state)
+			}
+			if msg.Response {
+				c.rtt.response(msg.ID, time.Now())
+			} else if msg.ID != 0 {
+				// Older clients send pings without an ID, which don't
+				// need a response.
+				go c.send(context.Background(), &Ping{ID: msg.ID, Response: true}, nil)
 			}
-			// Nothing
 
 		case *Close:
 			l.Debugln("read Close message")
-			return errors.New(msg.Reason)
+			return &RemoteCloseError{Code: msg.Code, Reason: msg.Reason}
 
 		default:
 			l.Debugf("read unknown message: %+T", msg)
-			return fmt.Errorf("protocol error: %s: unknown or empty message", c.id)
+			return newProtocolError("%s: unknown or empty message", c.id)
 		}
 	}
 }
@@ -642,11 +909,60 @@ func (c *rawConnection) handleRequest(req Request) {
 	res.Close()
 }
 
+func (c *rawConnection) handleRangeRequest(req RangeRequest) {
+	res, err := c.receiver.RangeRequest(c.id, req.Folder, req.Name, req.Size, req.Offset)
+	if err != nil {
+		c.send(context.Background(), &Response{
+			ID:   req.ID,
+			Code: errorToCode(err),
+		}, nil)
+		return
+	}
+	done := make(chan struct{})
+	c.send(context.Background(), &Response{
+		ID:   req.ID,
+		Data: res.Data(),
+		Code: errorToCode(nil),
+	}, done)
+	<-done
+	res.Close()
+}
+
 func (c *rawConnection) handleResponse(resp Response) {
 	c.awaitingMut.Lock()
 	if rc := c.awaiting[resp.ID]; rc != nil {
 		delete(c.awaiting, resp.ID)
-		rc <- asyncResult{resp.Data, codeToError(resp.Code)}
+		rc <- asyncResult{val: resp.Data, err: codeToError(resp.Code)}
+		close(rc)
+	}
+	c.awaitingMut.Unlock()
+}
+
+func (c *rawConnection) handleMetadataRequest(req MetadataRequest) {
+	files, err := c.receiver.MetadataRequest(c.id, req.Folder, req.Prefix)
+	if err != nil {
+		c.send(context.Background(), &MetadataResponse{
+			ID:   req.ID,
+			Code: errorToCode(err),
+		}, nil)
+		return
+	}
+	for i := range files {
+		// Only the metadata is sent, never the blocks.
+		files[i].Blocks = nil
+	}
+	c.send(context.Background(), &MetadataResponse{
+		ID:    req.ID,
+		Files: files,
+		Code:  errorToCode(nil),
+	}, nil)
+}
+
+func (c *rawConnection) handleMetadataResponse(resp MetadataResponse) {
+	c.awaitingMut.Lock()
+	if rc := c.awaiting[resp.ID]; rc != nil {
+		delete(c.awaiting, resp.ID)
+		rc <- asyncResult{files: resp.Files, err: codeToError(resp.Code)}
 		close(rc)
 	}
 	c.awaitingMut.Unlock()
@@ -674,6 +990,7 @@ func (c *rawConnection) writerLoop() {
 			c.internalClose(err)
 			return
 		}
+		close(c.clusterConfigSent)
 	case hm := <-c.closeBox:
 		_ = c.writeMessage(hm.msg)
 		close(hm.done)
@@ -684,6 +1001,9 @@ func (c *rawConnection) writerLoop() {
 	for {
 		select {
 		case hm := <-c.outbox:
+			if p, ok := hm.msg.(*Ping); ok && !p.Response {
+				c.rtt.written(p.ID, time.Now())
+			}
 			err := c.writeMessage(hm.msg)
 			if hm.done != nil {
 				close(hm.done)
@@ -812,6 +1132,12 @@ func (c *rawConnection) typeOf(msg message) MessageType {
 		return messageTypePing
 	case *Close:
 		return messageTypeClose
+	case *MetadataRequest:
+		return messageTypeMetadataRequest
+	case *MetadataResponse:
+		return messageTypeMetadataResponse
+	case *RangeRequest:
+		return messageTypeRangeRequest
 	default:
 		panic("bug: unknown message type")
 	}
@@ -835,6 +1161,12 @@ func (c *rawConnection) newMessage(t MessageType) (message, error) {
 		return new(Ping), nil
 	case messageTypeClose:
 		return new(Close), nil
+	case messageTypeMetadataRequest:
+		return new(MetadataRequest), nil
+	case messageTypeMetadataResponse:
+		return new(MetadataResponse), nil
+	case messageTypeRangeRequest:
+		return new(RangeRequest), nil
 	default:
 		return nil, errUnknownMessage
 	}
@@ -867,7 +1199,7 @@ func (c *rawConnection) Close(err error) {
 		done := make(chan struct{})
 		timeout := time.NewTimer(CloseTimeout)
 		select {
-		case c.closeBox <- asyncMessage{&Close{err.Error()}, done}:
+		case c.closeBox <- asyncMessage{closeMessage(err), done}:
 			select {
 			case <-done:
 			case <-timeout.C:
@@ -885,6 +1217,51 @@ func (c *rawConnection) Close(err error) {
 	go c.internalClose(err)
 }
 
+// Drain stops handling new requests from the other side and waits for the
+// requests in flight to be answered, or until the context is done, before
+// closing the connection with the given error.
+func (c *rawConnection) Drain(ctx context.Context, err error) {
+	c.drainMut.Lock()
+	if !c.draining {
+		c.draining = true
+		if c.requestsInFlight == 0 {
+			close(c.drained)
+		}
+	}
+	c.drainMut.Unlock()
+
+	select {
+	case <-c.drained:
+	case <-ctx.Done():
+		l.Debugln(c.id, "gave up waiting for requests in flight while draining")
+	case <-c.closed:
+	}
+
+	c.Close(err)
+}
+
+// startRequest registers an incoming request as being in flight. It returns
+// false if the connection is being drained and the request shouldn't be
+// handled.
+func (c *rawConnection) startRequest() bool {
+	c.drainMut.Lock()
+	defer c.drainMut.Unlock()
+	if c.draining {
+		return false
+	}
+	c.requestsInFlight++
+	return true
+}
+
+func (c *rawConnection) finishRequest() {
+	c.drainMut.Lock()
+	defer c.drainMut.Unlock()
+	c.requestsInFlight--
+	if c.draining && c.requestsInFlight == 0 {
+		close(c.drained)
+	}
+}
+
 // internalClose is called if there is an unexpected error during normal operation.
 func (c *rawConnection) internalClose(err error) {
 	c.closeOnce.Do(func() {
@@ -907,24 +1284,27 @@ func (c *rawConnection) internalClose(err error) {
 }
 
 // The pingSender makes sure that we've sent a message within the last
-// PingSendInterval. If we already have something sent in the last
-// PingSendInterval/2, we do nothing. Otherwise we send a ping message. This
-// results in an effecting ping interval of somewhere between
-// PingSendInterval/2 and PingSendInterval.
+// PingSendInterval, by sending a ping message every PingSendInterval/2.
+// Pings are sent even when other messages are being sent, as the responses
+// are used to measure the round trip time. An initial ping is sent as soon
+// as the cluster config has been sent, so that the round trip time is known
+// early.
 func (c *rawConnection) pingSender() {
 	ticker := time.NewTicker(PingSendInterval / 2)
 	defer ticker.Stop()
 
+	// Nothing but the cluster config may be sent first.
+	select {
+	case <-c.clusterConfigSent:
+	case <-c.closed:
+		return
+	}
+	c.ping()
+
 	for {
 		select {
 		case <-ticker.C:
-			d := time.Since(c.cw.Last())
-			if d < PingSendInterval/2 {
-				l.Debugln(c.id, "ping skipped after wr", d)
-				continue
-			}
-
-			l.Debugln(c.id, "ping -> after", d)
+			l.Debugln(c.id, "ping -> after", time.Since(c.cw.Last()))
 			c.ping()
 
 		case <-c.closed:
@@ -961,6 +1341,7 @@ type Statistics struct {
 	At            time.Time
 	InBytesTotal  int64
 	OutBytesTotal int64
+	RTT           time.Duration // Smoothed round trip time, zero if unknown
 }
 
 func (c *rawConnection) Statistics() Statistics {
@@ -968,6 +1349,7 @@ func (c *rawConnection) Statistics() Statistics {
 		At:            time.Now(),
 		InBytesTotal:  c.cr.Tot(),
 		OutBytesTotal: c.cw.Tot(),
+		RTT:           c.rtt.RTT(),
 	}
 }
 
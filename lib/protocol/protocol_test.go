@@ -11,8 +11,10 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/quick"
 	"time"
@@ -46,8 +48,314 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestCapabilities(t *testing.T) {
+	m0 := newTestModel()
+	m1 := newTestModel()
+	received0 := make(chan struct{})
+	received1 := make(chan struct{})
+	m0.ccFn = func(DeviceID, ClusterConfig) { close(received0) }
+	m1.ccFn = func(DeviceID, ClusterConfig) { close(received1) }
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m0, "name", CompressAlways)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressAlways)
+	c1.Start()
+
+	if c0.HasCapability(CapabilityTempIndexes) {
+		t.Error("c0 should not have capabilities before receiving a cluster config")
+	}
+
+	// c0 advertises nothing, c1 advertises a known and an unknown capability.
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{Capabilities: []string{CapabilityTempIndexes, "from-the-future"}})
+
+	for _, ch := range []chan struct{}{received0, received1} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for cluster config")
+		}
+	}
+
+	if !c0.HasCapability(CapabilityTempIndexes) {
+		t.Error("c0 should see the capability advertised by c1")
+	}
+	if !c0.HasCapability("from-the-future") {
+		t.Error("c0 should see the unknown capability advertised by c1")
+	}
+	if c1.HasCapability(CapabilityTempIndexes) {
+		t.Error("c1 should not see any capability, as c0 advertised none")
+	}
+
+	c0.Close(errManual)
+	c1.Close(errManual)
+}
+
+func TestMetadataRequest(t *testing.T) {
+	m0 := newTestModel()
+	m1 := newTestModel()
+	received0 := make(chan struct{})
+	received1 := make(chan struct{})
+	m0.ccFn = func(DeviceID, ClusterConfig) { close(received0) }
+	m1.ccFn = func(DeviceID, ClusterConfig) { close(received1) }
+
+	var requested0 bool
+	m0.metadataFn = func(DeviceID, string, string) ([]FileInfo, error) {
+		requested0 = true
+		return nil, nil
+	}
+	m1.metadataFn = func(_ DeviceID, folder, prefix string) ([]FileInfo, error) {
+		if folder != "default" {
+			return nil, ErrGeneric
+		}
+		if prefix != "dir" {
+			return nil, ErrNoSuchFile
+		}
+		return []FileInfo{
+			{Name: "dir/file", Size: 1234, Type: FileInfoTypeFile, Blocks: []BlockInfo{{Size: 1234, Hash: []byte("hash")}}},
+			{Name: "dir/sub", Type: FileInfoTypeDirectory},
+		}, nil
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m0, "name", CompressAlways)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressAlways)
+	c1.Start()
+	defer c0.Close(errManual)
+	defer c1.Close(errManual)
+
+	// Only c1 answers metadata requests.
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{Capabilities: []string{CapabilityMetadataRequests}})
+
+	for _, ch := range []chan struct{}{received0, received1} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for cluster config")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	files, err := c0.MetadataRequest(ctx, "default", "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Got %d files, expected 2", len(files))
+	}
+	for _, f := range files {
+		if len(f.Blocks) != 0 {
+			t.Errorf("Got blocks for %v", f.Name)
+		}
+	}
+	if files[0].Name != filepath.FromSlash("dir/file") || files[0].Size != 1234 || !files[1].IsDirectory() {
+		t.Errorf("Unexpected metadata: %v", files)
+	}
+
+	if _, err := c0.MetadataRequest(ctx, "default", "nonexistent"); err != ErrNoSuchFile {
+		t.Errorf("Got error %v, expected %v", err, ErrNoSuchFile)
+	}
+
+	// c0 lacks the capability, so c1 doesn't even ask.
+	if _, err := c1.MetadataRequest(ctx, "default", "dir"); err != ErrUnsupported {
+		t.Errorf("Got error %v, expected %v", err, ErrUnsupported)
+	}
+	if requested0 {
+		t.Error("Metadata request sent to a device lacking the capability")
+	}
+
+	// The connection is still fine.
+	if _, err := c0.MetadataRequest(ctx, "default", "dir"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRangeRequest(t *testing.T) {
+	m0 := newTestModel()
+	m1 := newTestModel()
+	received0 := make(chan struct{})
+	received1 := make(chan struct{})
+	m0.ccFn = func(DeviceID, ClusterConfig) { close(received0) }
+	m1.ccFn = func(DeviceID, ClusterConfig) { close(received1) }
+
+	content := []byte("0123456789")
+	m1.rangeFn = func(_ DeviceID, folder, name string, size int32, offset int64) (RequestResponse, error) {
+		if folder != "default" || name != "file" {
+			return nil, ErrNoSuchFile
+		}
+		if offset+int64(size) > int64(len(content)) {
+			return nil, ErrInvalid
+		}
+		return &fakeRequestResponse{content[offset : offset+int64(size)]}, nil
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m0, "name", CompressAlways)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressAlways)
+	c1.Start()
+	defer c0.Close(errManual)
+	defer c1.Close(errManual)
+
+	// Only c1 answers range requests.
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{Capabilities: []string{CapabilityRangeRequests}})
+
+	for _, ch := range []chan struct{}{received0, received1} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for cluster config")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := c0.RangeRequest(ctx, "default", "file", 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "3456" {
+		t.Errorf("Got %q, expected %q", data, "3456")
+	}
+
+	if _, err := c0.RangeRequest(ctx, "default", "file", 8, 4); err != ErrInvalid {
+		t.Errorf("Got error %v, expected %v", err, ErrInvalid)
+	}
+
+	// c0 lacks the capability, so c1 doesn't even ask.
+	if _, err := c1.RangeRequest(ctx, "default", "file", 0, 1); err != ErrUnsupported {
+		t.Errorf("Got error %v, expected %v", err, ErrUnsupported)
+	}
+}
+
 var errManual = errors.New("manual close")
 
+// requestWindowPair returns a connection to a peer which advertises the
+// given request window and answers requests with respond.
+func requestWindowPair(t *testing.T, window int32, respond func() (RequestResponse, error)) (Connection, func()) {
+	t.Helper()
+
+	m0 := newTestModel()
+	m1 := newTestModel()
+	received0 := make(chan struct{})
+	received1 := make(chan struct{})
+	m0.ccFn = func(DeviceID, ClusterConfig) { close(received0) }
+	m1.ccFn = func(DeviceID, ClusterConfig) { close(received1) }
+	m1.requestFn = func(DeviceID, string, string, int32, int64) (RequestResponse, error) {
+		return respond()
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m0, "name", CompressNever)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressNever)
+	c1.Start()
+
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{MaxConcurrentRequests: window})
+
+	for _, ch := range []chan struct{}{received0, received1} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for cluster config")
+		}
+	}
+
+	return c0, func() {
+		c0.Close(errManual)
+		c1.Close(errManual)
+	}
+}
+
+// requestAll sends n requests at once and waits for their responses.
+func requestAll(ctx context.Context, c Connection, n int) error {
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := c.Request(ctx, "default", "file", 0, 8, nil, 0, false)
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRequestWindow(t *testing.T) {
+	for _, tc := range []struct {
+		window  int32
+		bounded bool
+	}{
+		{4, true},
+		{0, false}, // older peers don't advertise a window
+	} {
+		var outstanding, maxOutstanding int32
+		slowRespond := func() (RequestResponse, error) {
+			cur := atomic.AddInt32(&outstanding, 1)
+			for {
+				max := atomic.LoadInt32(&maxOutstanding)
+				if cur <= max || atomic.CompareAndSwapInt32(&maxOutstanding, max, cur) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&outstanding, -1)
+			return &fakeRequestResponse{make([]byte, 8)}, nil
+		}
+
+		c0, cleanup := requestWindowPair(t, tc.window, slowRespond)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := requestAll(ctx, c0, 32)
+		cancel()
+		cleanup()
+		if err != nil {
+			t.Fatalf("window %d: %v", tc.window, err)
+		}
+
+		max := atomic.LoadInt32(&maxOutstanding)
+		if tc.bounded && (max > tc.window || max < 1) {
+			t.Errorf("window %d: %d requests were outstanding", tc.window, max)
+		}
+		if !tc.bounded && max <= 4 {
+			t.Errorf("unbounded: expected more than 4 outstanding requests, got %d", max)
+		}
+	}
+}
+
+func TestRequestWindowThroughput(t *testing.T) {
+	respond := func() (RequestResponse, error) {
+		return &fakeRequestResponse{make([]byte, 8)}, nil
+	}
+	c0, cleanup := requestWindowPair(t, 4, respond)
+	defer cleanup()
+
+	// With responses flowing, the window only paces the requests.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := requestAll(ctx, c0, 1000); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestClose(t *testing.T) {
 	m0 := newTestModel()
 	m1 := newTestModel()
@@ -331,6 +639,9 @@ func TestMarshalClusterConfigMessage(t *testing.T) {
 				m1.Folders[i].Devices = nil
 			}
 		}
+		if len(m1.Capabilities) == 0 {
+			m1.Capabilities = nil
+		}
 		return testMarshal(t, "clusterconfig", &m1, &ClusterConfig{})
 	}
 
@@ -867,3 +1178,117 @@ func TestDispatcherToCloseDeadlock(t *testing.T) {
 		t.Fatal("timed out before dispatcher loop terminated")
 	}
 }
+
+// hangingModel answers requests only once released.
+type hangingModel struct {
+	*TestModel
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *hangingModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	m.started <- struct{}{}
+	<-m.release
+	return &fakeRequestResponse{[]byte("data")}, nil
+}
+
+func drainTestConns(t *testing.T) (*rawConnection, *rawConnection, *hangingModel) {
+	t.Helper()
+	m := &hangingModel{
+		TestModel: newTestModel(),
+		started:   make(chan struct{}, 1),
+		release:   make(chan struct{}),
+	}
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m, "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c1.Start()
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{})
+
+	return c0, c1, m
+}
+
+func TestDrainWaitsForRequests(t *testing.T) {
+	c0, c1, m := drainTestConns(t)
+	defer c1.Close(errManual)
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		data, err := c1.Request(context.Background(), "default", "foo", 0, 4, nil, 0, false)
+		res <- result{data, err}
+	}()
+	select {
+	case <-m.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for request")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		c0.Drain(context.Background(), errManual)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// New requests are refused while draining.
+	if _, err := c1.Request(context.Background(), "default", "bar", 0, 4, nil, 0, false); err == nil {
+		t.Error("expected error for request while draining")
+	}
+
+	close(m.release)
+
+	select {
+	case r := <-res:
+		if r.err != nil || string(r.data) != "data" {
+			t.Errorf("request in flight failed: %q, %v", r.data, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for response")
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for drain")
+	}
+	if err := m.closedError(); err != errManual {
+		t.Errorf("connection closed with %v, expected %v", err, errManual)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	c0, c1, m := drainTestConns(t)
+	defer c1.Close(errManual)
+	defer close(m.release)
+
+	go c1.Request(context.Background(), "default", "foo", 0, 4, nil, 0, false)
+	select {
+	case <-m.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for request")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	c0.Drain(ctx, errManual)
+	if d := time.Since(t0); d < 100*time.Millisecond || d > 5*time.Second {
+		t.Errorf("drain returned after %v, expected the timeout of 100ms", d)
+	}
+	if err := m.closedError(); err != errManual {
+		t.Errorf("connection closed with %v, expected %v", err, errManual)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// maxOutstandingPings is the number of pings we keep track of while
+// waiting for the responses. Older ones are forgotten, as are responses to
+// them.
+const maxOutstandingPings = 8
+
+// rttTracker measures the round trip time of a connection. Each ping gets
+// an ID, which the other side echoes back in the response. Responses are
+// matched on the ID, so it doesn't matter if they arrive out of order or
+// not at all (older clients don't respond).
+type rttTracker struct {
+	mut    sync.Mutex
+	nextID int32
+	sent   map[int32]time.Time
+	srtt   time.Duration
+}
+
+func newRTTTracker() *rttTracker {
+	return &rttTracker{
+		sent: make(map[int32]time.Time),
+	}
+}
+
+// ping returns a new ping message to send. The time it's sent is recorded
+// by written, right before it goes out on the wire, so that time spent
+// queued behind other messages doesn't count towards the round trip time.
+func (t *rttTracker) ping() *Ping {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	// An ID of zero is what older clients send, and they don't expect a
+	// response.
+	t.nextID++
+	if t.nextID <= 0 {
+		t.nextID = 1
+	}
+	return &Ping{ID: t.nextID}
+}
+
+// written records the time the ping with the given ID was sent.
+func (t *rttTracker) written(id int32, now time.Time) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if len(t.sent) >= maxOutstandingPings {
+		var oldestID int32
+		var oldest time.Time
+		for id, sent := range t.sent {
+			if oldest.IsZero() || sent.Before(oldest) {
+				oldestID, oldest = id, sent
+			}
+		}
+		delete(t.sent, oldestID)
+	}
+	t.sent[id] = now
+}
+
+// response handles the response to the ping with the given ID, updating the
+// smoothed round trip time. Unknown IDs are ignored.
+func (t *rttTracker) response(id int32, now time.Time) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	sent, ok := t.sent[id]
+	if !ok {
+		return
+	}
+	delete(t.sent, id)
+
+	sample := now.Sub(sent)
+	if sample < 0 {
+		return
+	}
+	if t.srtt == 0 {
+		t.srtt = sample
+		return
+	}
+	// The same smoothing as TCP uses (RFC 6298), with alpha = 1/8.
+	t.srtt += (sample - t.srtt) / 8
+}
+
+// RTT returns the smoothed round trip time, or zero if it's not known yet.
+func (t *rttTracker) RTT() time.Duration {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.srtt
+}
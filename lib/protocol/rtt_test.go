@@ -0,0 +1,168 @@
+// Copyright (C) 2020 The Protocol Authors.
+
+package protocol
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRTTTracker(t *testing.T) {
+	tr := newRTTTracker()
+	now := time.Now()
+
+	if rtt := tr.RTT(); rtt != 0 {
+		t.Fatalf("RTT is %v before any ping", rtt)
+	}
+
+	p1 := tr.ping()
+	p2 := tr.ping()
+	if p1.ID == 0 || p2.ID == 0 || p1.ID == p2.ID {
+		t.Fatalf("bad ping IDs %d and %d", p1.ID, p2.ID)
+	}
+
+	// Unwritten pings aren't waited for.
+	tr.response(p1.ID, now)
+	if rtt := tr.RTT(); rtt != 0 {
+		t.Fatalf("RTT is %v for a ping that wasn't written", rtt)
+	}
+	tr.written(p1.ID, now)
+	tr.written(p2.ID, now.Add(10*time.Millisecond))
+
+	// Responses arriving out of order are matched correctly, the first
+	// sample is used as is.
+	tr.response(p2.ID, now.Add(110*time.Millisecond))
+	if rtt := tr.RTT(); rtt != 100*time.Millisecond {
+		t.Errorf("RTT is %v, expected 100ms", rtt)
+	}
+	tr.response(p1.ID, now.Add(300*time.Millisecond))
+	if rtt := tr.RTT(); rtt != 125*time.Millisecond {
+		t.Errorf("RTT is %v, expected 125ms after smoothing", rtt)
+	}
+
+	// Duplicate and unknown responses are ignored.
+	tr.response(p1.ID, now.Add(time.Second))
+	tr.response(12345, now.Add(time.Second))
+	if rtt := tr.RTT(); rtt != 125*time.Millisecond {
+		t.Errorf("RTT is %v after bogus responses, expected 125ms", rtt)
+	}
+
+	// Only a bounded number of pings are kept track of, forgetting the
+	// oldest.
+	oldest := tr.ping()
+	tr.written(oldest.ID, now)
+	for i := 0; i < 2*maxOutstandingPings; i++ {
+		tr.written(tr.ping().ID, now.Add(time.Duration(i+1)*time.Millisecond))
+	}
+	if l := len(tr.sent); l != maxOutstandingPings {
+		t.Errorf("%d outstanding pings, expected %d", l, maxOutstandingPings)
+	}
+	tr.response(oldest.ID, now.Add(time.Hour))
+	if rtt := tr.RTT(); rtt != 125*time.Millisecond {
+		t.Errorf("RTT is %v after response to forgotten ping, expected 125ms", rtt)
+	}
+}
+
+// delayedWriter delays each write by the given number of nanoseconds.
+type delayedWriter struct {
+	io.Writer
+	delay int64
+}
+
+func (w *delayedWriter) Write(bs []byte) (int, error) {
+	time.Sleep(time.Duration(atomic.LoadInt64(&w.delay)))
+	return w.Writer.Write(bs)
+}
+
+func TestRTTMeasurement(t *testing.T) {
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+	dw := &delayedWriter{Writer: aw, delay: int64(50 * time.Millisecond)}
+
+	c0 := NewConnection(c0ID, ar, bw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c0.Start()
+	defer c0.Close(errManual)
+	c1 := NewConnection(c1ID, br, dw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c1.Start()
+	defer c1.Close(errManual)
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{})
+
+	// pingAndWait sends a ping from c0 and waits for all outstanding
+	// pings to be responded to by c1, whose writes are delayed.
+	pingAndWait := func() {
+		t.Helper()
+		if !c0.ping() {
+			t.Fatal("ping failed")
+		}
+		timeout := time.Now().Add(10 * time.Second)
+		for {
+			c0.rtt.mut.Lock()
+			outstanding := len(c0.rtt.sent)
+			c0.rtt.mut.Unlock()
+			if outstanding == 0 {
+				return
+			}
+			if time.Now().After(timeout) {
+				t.Fatal("timed out waiting for ping response")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	pingAndWait()
+	if rtt := c0.Statistics().RTT; rtt < 50*time.Millisecond || rtt > time.Second {
+		t.Errorf("RTT is %v, expected about 50ms", rtt)
+	}
+
+	// The RTT follows an increased delay.
+	atomic.StoreInt64(&dw.delay, int64(200*time.Millisecond))
+	for i := 0; i < 15; i++ {
+		pingAndWait()
+	}
+	if rtt := c0.Statistics().RTT; rtt < 150*time.Millisecond || rtt > 2*time.Second {
+		t.Errorf("RTT is %v, expected about 200ms", rtt)
+	}
+}
+
+func TestRTTExcludesQueueing(t *testing.T) {
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c0.Start()
+	defer c0.Close(errManual)
+	c1 := NewConnection(c1ID, br, aw, newTestModel(), "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c1.Start()
+	defer c1.Close(errManual)
+	c1.ClusterConfig(ClusterConfig{})
+
+	// Nothing but the cluster config is sent first, so the ping waits
+	// for it. That time must not count towards the round trip time.
+	sent := make(chan bool)
+	go func() { sent <- c0.ping() }()
+	time.Sleep(200 * time.Millisecond)
+	c0.rtt.mut.Lock()
+	outstanding := len(c0.rtt.sent)
+	c0.rtt.mut.Unlock()
+	if outstanding != 0 {
+		t.Errorf("%d pings written before the cluster config", outstanding)
+	}
+	c0.ClusterConfig(ClusterConfig{})
+	if !<-sent {
+		t.Fatal("ping failed")
+	}
+
+	timeout := time.Now().Add(10 * time.Second)
+	for c0.Statistics().RTT == 0 {
+		if time.Now().After(timeout) {
+			t.Fatal("timed out waiting for ping response")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if rtt := c0.Statistics().RTT; rtt >= 200*time.Millisecond {
+		t.Errorf("RTT is %v, including the time the ping was queued", rtt)
+	}
+}
@@ -39,3 +39,17 @@ func (c wireFormatConnection) Request(ctx context.Context, folder string, name s
 	name = norm.NFC.String(filepath.ToSlash(name))
 	return c.Connection.Request(ctx, folder, name, offset, size, hash, weakHash, fromTemporary)
 }
+
+func (c wireFormatConnection) RangeRequest(ctx context.Context, folder, name string, offset int64, size int) ([]byte, error) {
+	name = norm.NFC.String(filepath.ToSlash(name))
+	return c.Connection.RangeRequest(ctx, folder, name, offset, size)
+}
+
+func (c wireFormatConnection) MetadataRequest(ctx context.Context, folder, prefix string) ([]FileInfo, error) {
+	prefix = norm.NFC.String(filepath.ToSlash(prefix))
+	files, err := c.Connection.MetadataRequest(ctx, folder, prefix)
+	for i := range files {
+		files[i].Name = filepath.FromSlash(files[i].Name)
+	}
+	return files, err
+}
@@ -64,6 +64,42 @@ func Intn(n int) int {
 	return defaultSecureRand.Intn(n)
 }
 
+// Float64 returns, as a float64, a strongly random number in [0.0,1.0).
+func Float64() float64 {
+	return defaultSecureRand.Float64()
+}
+
+// WeightedIndex returns a random index into weights, chosen with a
+// probability proportional to the weight at that index. Indexes with a zero
+// or negative weight are never chosen. It returns -1 if there is no index
+// with a positive weight.
+func WeightedIndex(weights []float64) int {
+	var total float64
+	last := -1
+	for i, w := range weights {
+		if w > 0 {
+			total += w
+			last = i
+		}
+	}
+	if last < 0 {
+		return -1
+	}
+
+	r := defaultSecureRand.Float64() * total
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	// Rounding errors may leave us here; the last candidate is a fine answer.
+	return last
+}
+
 // SeedFromBytes calculates a weak 64 bit hash from the given byte slice,
 // suitable for use a predictable random seed.
 func SeedFromBytes(bs []byte) int64 {
@@ -75,6 +111,14 @@ func SeedFromBytes(bs []byte) int64 {
 	return int64(binary.BigEndian.Uint64(s[0:]) ^ binary.BigEndian.Uint64(s[8:]))
 }
 
+// NewSeededReader returns a reader producing a predictable stream of bytes
+// for the given seed, making tests that consume randomness reproducible.
+// The stream is NOT cryptographically secure and must never be used for
+// keys, tokens or anything else security sensitive; use Reader for that.
+func NewSeededReader(seed int64) io.Reader {
+	return mathRand.New(mathRand.NewSource(seed))
+}
+
 // Shuffle the order of elements
 func Shuffle(slice interface{}) {
 	rv := reflect.ValueOf(slice)
@@ -6,7 +6,11 @@
 
 package rand
 
-import "testing"
+import (
+	"bytes"
+	"io"
+	"testing"
+)
 
 func TestSeedFromBytes(t *testing.T) {
 	// should always return the same seed for the same bytes
@@ -61,3 +65,54 @@ func TestRandomInt64(t *testing.T) {
 		}
 	}
 }
+
+func TestSeededReader(t *testing.T) {
+	read := func(r io.Reader) []byte {
+		bs := make([]byte, 1024)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			t.Fatal(err)
+		}
+		return bs
+	}
+
+	// Identically seeded readers produce identical sequences
+	r0, r1 := NewSeededReader(42), NewSeededReader(42)
+	for i := 0; i < 4; i++ {
+		if !bytes.Equal(read(r0), read(r1)) {
+			t.Fatal("Readers with the same seed differ")
+		}
+	}
+
+	if bytes.Equal(read(NewSeededReader(42)), read(NewSeededReader(43))) {
+		t.Error("Readers with different seeds are equal")
+	}
+}
+
+func TestWeightedIndex(t *testing.T) {
+	for _, weights := range [][]float64{nil, {}, {0}, {0, 0, -1}} {
+		if idx := WeightedIndex(weights); idx != -1 {
+			t.Errorf("Expected -1 for %v, got %d", weights, idx)
+		}
+	}
+
+	weights := []float64{1, 0, 3, -2, 6}
+	const iterations = 100000
+	counts := make([]int, len(weights))
+	for i := 0; i < iterations; i++ {
+		counts[WeightedIndex(weights)]++
+	}
+
+	for i, w := range weights {
+		if w <= 0 {
+			if counts[i] != 0 {
+				t.Errorf("Index %d with weight %v selected %d times", i, w, counts[i])
+			}
+			continue
+		}
+		expected := w / 10
+		actual := float64(counts[i]) / iterations
+		if actual < expected-0.01 || actual > expected+0.01 {
+			t.Errorf("Index %d selected with frequency %.3f, expected %.3f", i, actual, expected)
+		}
+	}
+}
@@ -30,6 +30,8 @@ type RelayClient interface {
 	suture.Service
 	Error() error
 	Latency() time.Duration
+	// Score rates the quality of the relay in use, lower is better.
+	Score() time.Duration
 	String() string
 	Invitations() chan protocol.SessionInvitation
 	URI() *url.URL
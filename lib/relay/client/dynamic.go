@@ -17,6 +17,26 @@ import (
 	"github.com/syncthing/syncthing/lib/relay/protocol"
 )
 
+const (
+	// How often the candidate relays are probed to see whether there is a
+	// materially better one than the one we are currently using. The
+	// interval doubles, up to the max, each time that doesn't lead to a
+	// migration.
+	relayProbeInterval    = 10 * time.Minute
+	relayMaxProbeInterval = 8 * time.Hour
+	// How many randomly chosen relays, besides the current one, are probed
+	// each time.
+	relayProbeSample = 5
+	// A candidate relay must score both relayReselectFactor times and
+	// relayReselectMargin better than the current relay before we migrate,
+	// so that we don't flap between relays of similar quality.
+	relayReselectFactor = 2
+	relayReselectMargin = 50 * time.Millisecond
+	// How long we wait for a new relay to accept us before giving up on
+	// migrating to it.
+	relayMigrateTimeout = 30 * time.Second
+)
+
 type dynamicClient struct {
 	commonClient
 
@@ -25,13 +45,27 @@ type dynamicClient struct {
 	timeout  time.Duration
 
 	client RelayClient
+	scores map[string]time.Duration
+
+	// Overridden in tests
+	probe            func(ctx context.Context, addr string) (time.Duration, error)
+	newClient        relayClientFactory
+	probeInterval    time.Duration
+	maxProbeInterval time.Duration
+	migrateTimeout   time.Duration
 }
 
 func newDynamicClient(uri *url.URL, certs []tls.Certificate, invitations chan protocol.SessionInvitation, timeout time.Duration) RelayClient {
 	c := &dynamicClient{
-		pooladdr: uri,
-		certs:    certs,
-		timeout:  timeout,
+		pooladdr:         uri,
+		certs:            certs,
+		timeout:          timeout,
+		scores:           make(map[string]time.Duration),
+		probe:            osutil.GetLatencyForURL,
+		newClient:        newStaticClient,
+		probeInterval:    relayProbeInterval,
+		maxProbeInterval: relayMaxProbeInterval,
+		migrateTimeout:   relayMigrateTimeout,
 	}
 	c.commonClient = newCommonClient(invitations, c.serve, fmt.Sprintf("dynamicClient@%p", c))
 	return c
@@ -70,7 +104,10 @@ func (c *dynamicClient) serve(ctx context.Context) error {
 		addrs = append(addrs, ruri.String())
 	}
 
-	for _, addr := range relayAddressesOrder(ctx, addrs) {
+	scoreFn := func(addr string) time.Duration {
+		return c.updateScore(ctx, addr)
+	}
+	for _, addr := range relayAddressesOrder(ctx, addrs, scoreFn) {
 		select {
 		case <-ctx.Done():
 			l.Debugln(c, "stopping")
@@ -81,29 +118,190 @@ func (c *dynamicClient) serve(ctx context.Context) error {
 				l.Debugln(c, "skipping relay", addr, err)
 				continue
 			}
-			client := newStaticClient(ruri, c.certs, c.invitations, c.timeout)
-			c.mut.Lock()
-			c.client = client
-			c.mut.Unlock()
-
-			c.client.Serve()
-
-			c.mut.Lock()
-			c.client = nil
-			c.mut.Unlock()
+			client := c.newClient(ruri, c.certs, c.invitations, c.timeout)
+			c.setClient(client)
+			c.serveRelay(ctx, client, addrs)
+			c.setClient(nil)
 		}
 	}
 	l.Debugln(c, "could not find a connectable relay")
 	return fmt.Errorf("could not find a connectable relay")
 }
 
-func (c *dynamicClient) Stop() {
-	c.mut.RLock()
-	if c.client != nil {
-		c.client.Stop()
+// serveRelay runs the given relay client until it fails or the context is
+// cancelled. In the meantime some of the other relays are probed
+// periodically, and we migrate to a materially better one if it shows up.
+// We probe less often the longer the current relay stays the best.
+func (c *dynamicClient) serveRelay(ctx context.Context, client RelayClient, addrs []string) {
+	done := serveInBackground(client)
+
+	interval := c.probeInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-timer.C:
+			next, nextDone, ok := c.maybeMigrate(ctx, client, addrs)
+			if ok {
+				client, done = next, nextDone
+			}
+			interval = nextProbeInterval(interval, ok, c.probeInterval, c.maxProbeInterval)
+			l.Debugln(c, "next relay probe in", interval)
+			timer.Reset(interval)
+
+		case <-ctx.Done():
+			client.Stop()
+			return
+		}
+	}
+}
+
+// nextProbeInterval returns the interval until the next probe: back to min
+// after a migration, otherwise double the current one up to max.
+func nextProbeInterval(cur time.Duration, migrated bool, min, max time.Duration) time.Duration {
+	if migrated {
+		return min
+	}
+	if cur *= 2; cur > max {
+		cur = max
+	}
+	return cur
+}
+
+// maybeMigrate probes the current relay and a random sample of the others
+// and, if one of them scores sufficiently better than the current one,
+// connects to it. The current relay is only stopped once the new one has
+// accepted us, so that we remain reachable throughout. Returns the new
+// client and its done channel on success.
+func (c *dynamicClient) maybeMigrate(ctx context.Context, current RelayClient, addrs []string) (RelayClient, <-chan struct{}, bool) {
+	currentAddr := current.URI().String()
+	currentScore := c.updateScore(ctx, currentAddr)
+	var best string
+	var bestScore time.Duration
+	for _, addr := range probeSample(addrs, currentAddr, relayProbeSample) {
+		score := c.updateScore(ctx, addr)
+		if best == "" || score < bestScore {
+			best, bestScore = addr, score
+		}
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+	}
+
+	if best == "" || !shouldReselect(currentScore, bestScore) {
+		return nil, nil, false
+	}
+
+	ruri, err := url.Parse(best)
+	if err != nil {
+		l.Debugln(c, "skipping relay", best, err)
+		return nil, nil, false
+	}
+
+	l.Infof("Relay %s (score %v) is better than the current relay %s (score %v), migrating", best, bestScore, currentAddr, currentScore)
+
+	next := c.newClient(ruri, c.certs, c.invitations, c.timeout)
+	nextDone := serveInBackground(next)
+	if err := waitConnected(ctx, next, nextDone, c.migrateTimeout); err != nil {
+		l.Infof("Could not migrate to relay %s: %v", best, err)
+		next.Stop()
+		return nil, nil, false
+	}
+
+	c.setClient(next)
+	current.Stop()
+	return next, nextDone, true
+}
+
+// probeSample returns up to n of the addresses, other than current, in
+// random order.
+func probeSample(addrs []string, current string, n int) []string {
+	sample := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr != current {
+			sample = append(sample, addr)
+		}
+	}
+	rand.Shuffle(sample)
+	if len(sample) > n {
+		sample = sample[:n]
+	}
+	return sample
+}
+
+// updateScore probes the given relay and returns its updated score, which
+// is the exponentially smoothed latency. Lower is better.
+func (c *dynamicClient) updateScore(ctx context.Context, addr string) time.Duration {
+	latency, err := c.probe(ctx, addr)
+	if err != nil {
+		latency = time.Hour
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	score, ok := c.scores[addr]
+	if ok {
+		score = (3*score + latency) / 4
+	} else {
+		score = latency
 	}
-	c.mut.RUnlock()
-	c.commonClient.Stop()
+	c.scores[addr] = score
+	return score
+}
+
+func (c *dynamicClient) setClient(client RelayClient) {
+	c.mut.Lock()
+	c.client = client
+	c.mut.Unlock()
+}
+
+// shouldReselect returns true if a relay with the candidate score is
+// sufficiently better than one with the current score to be worth
+// migrating to.
+func shouldReselect(current, candidate time.Duration) bool {
+	return current > relayReselectFactor*candidate && current-candidate > relayReselectMargin
+}
+
+func serveInBackground(client RelayClient) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		client.Serve()
+		close(done)
+	}()
+	return done
+}
+
+// waitConnected waits for the relay client to have joined its relay.
+func waitConnected(ctx context.Context, client RelayClient, done <-chan struct{}, timeout time.Duration) error {
+	status, ok := client.(interface{ StatusOK() bool })
+	if !ok {
+		return fmt.Errorf("cannot determine status of %v", client)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for !status.StatusOK() {
+		select {
+		case <-ticker.C:
+		case <-done:
+			if err := client.Error(); err != nil {
+				return err
+			}
+			return fmt.Errorf("stopped")
+		case <-timer.C:
+			return fmt.Errorf("timed out")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
 func (c *dynamicClient) Error() error {
@@ -124,6 +322,20 @@ func (c *dynamicClient) Latency() time.Duration {
 	return c.client.Latency()
 }
 
+// Score returns the score of the current relay, or an hour if we are not
+// connected to one. Lower is better.
+func (c *dynamicClient) Score() time.Duration {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.client == nil {
+		return time.Hour
+	}
+	if score, ok := c.scores[c.client.URI().String()]; ok {
+		return score
+	}
+	return c.client.Score()
+}
+
 func (c *dynamicClient) String() string {
 	return fmt.Sprintf("DynamicClient:%p:%s@%s", c, c.URI(), c.pooladdr)
 }
@@ -145,18 +357,15 @@ type dynamicAnnouncement struct {
 	}
 }
 
-// relayAddressesOrder checks the latency to each relay, rounds latency down to
-// the closest 50ms, and puts them in buckets of 50ms latency ranges. Then
-// shuffles each bucket, and returns all addresses starting with the ones from
-// the lowest latency bucket, ending with the highest latency buceket.
-func relayAddressesOrder(ctx context.Context, input []string) []string {
+// relayAddressesOrder scores each relay, rounds the score down to the
+// closest 50ms, and puts them in buckets of 50ms ranges. Then shuffles each
+// bucket, and returns all addresses starting with the ones from the lowest
+// score bucket, ending with the highest score bucket.
+func relayAddressesOrder(ctx context.Context, input []string, score func(addr string) time.Duration) []string {
 	buckets := make(map[int][]string)
 
 	for _, relay := range input {
-		latency, err := osutil.GetLatencyForURL(ctx, relay)
-		if err != nil {
-			latency = time.Hour
-		}
+		latency := score(relay)
 
 		id := int(latency/time.Millisecond) / 50
 
@@ -0,0 +1,203 @@
+// Copyright (C) 2016 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/relay/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+func TestShouldReselect(t *testing.T) {
+	cases := []struct {
+		current, candidate time.Duration
+		reselect           bool
+	}{
+		{100 * time.Millisecond, 100 * time.Millisecond, false},
+		{100 * time.Millisecond, 60 * time.Millisecond, false},
+		{100 * time.Millisecond, 40 * time.Millisecond, true},
+		// Twice as good, but not by a meaningful margin
+		{30 * time.Millisecond, 10 * time.Millisecond, false},
+		{time.Hour, 500 * time.Millisecond, true},
+	}
+	for _, tc := range cases {
+		if res := shouldReselect(tc.current, tc.candidate); res != tc.reselect {
+			t.Errorf("shouldReselect(%v, %v) == %v, expected %v", tc.current, tc.candidate, res, tc.reselect)
+		}
+	}
+}
+
+func TestRelayReselection(t *testing.T) {
+	uri, _ := url.Parse("dynamic+https://relays.example.com/endpoint")
+	c := newDynamicClient(uri, nil, nil, time.Second).(*dynamicClient)
+
+	latencies := map[string]time.Duration{
+		"relay://a:22067": 100 * time.Millisecond,
+		"relay://b:22067": 60 * time.Millisecond,
+	}
+	latenciesMut := sync.NewMutex()
+	setLatency := func(addr string, latency time.Duration) {
+		latenciesMut.Lock()
+		latencies[addr] = latency
+		latenciesMut.Unlock()
+	}
+	c.probe = func(_ context.Context, addr string) (time.Duration, error) {
+		latenciesMut.Lock()
+		defer latenciesMut.Unlock()
+		return latencies[addr], nil
+	}
+	c.newClient = newFakeRelayClient
+	addrs := []string{"relay://a:22067", "relay://b:22067"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	aURI, _ := url.Parse(addrs[0])
+	current := c.newClient(aURI, nil, c.invitations, c.timeout)
+	c.setClient(current)
+	done := serveInBackground(current)
+	defer func() {
+		c.Stop()
+		current.Stop()
+	}()
+	if err := waitConnected(ctx, current, done, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other relay is better, but not by enough
+	if _, _, ok := c.maybeMigrate(ctx, current, addrs); ok {
+		t.Fatal("Unexpected migration to a marginally better relay")
+	}
+
+	// Minor degradation is smoothed out
+	setLatency(addrs[0], 115*time.Millisecond)
+	if _, _, ok := c.maybeMigrate(ctx, current, addrs); ok {
+		t.Fatal("Unexpected migration after minor degradation")
+	}
+
+	// Major degradation crosses the threshold
+	setLatency(addrs[0], 400*time.Millisecond)
+	next, _, ok := c.maybeMigrate(ctx, current, addrs)
+	if !ok {
+		t.Fatal("Expected migration after major degradation")
+	}
+	if next.URI().String() != addrs[1] {
+		t.Errorf("Migrated to %v, expected %v", next.URI(), addrs[1])
+	}
+	if c.URI().String() != addrs[1] {
+		t.Errorf("Current relay is %v, expected %v", c.URI(), addrs[1])
+	}
+	if !next.(*fakeRelayClient).StatusOK() {
+		t.Error("New relay is not connected")
+	}
+	if current.(*fakeRelayClient).StatusOK() {
+		t.Error("Old relay was not stopped")
+	}
+	if score := c.Score(); score != 60*time.Millisecond {
+		t.Errorf("Score is %v, expected %v", score, 60*time.Millisecond)
+	}
+	current = next
+}
+
+func TestRelayProbeSample(t *testing.T) {
+	uri, _ := url.Parse("dynamic+https://relays.example.com/endpoint")
+	c := newDynamicClient(uri, nil, nil, time.Second).(*dynamicClient)
+
+	var addrs []string
+	for i := 0; i < 4*relayProbeSample; i++ {
+		addrs = append(addrs, fmt.Sprintf("relay://%d:22067", i))
+	}
+	probed := make(map[string]int)
+	c.probe = func(_ context.Context, addr string) (time.Duration, error) {
+		probed[addr]++
+		return 100 * time.Millisecond, nil
+	}
+	c.newClient = newFakeRelayClient
+
+	current := c.newClient(mustParseURL(addrs[0]), nil, c.invitations, c.timeout)
+	for i := 0; i < 3; i++ {
+		if _, _, ok := c.maybeMigrate(context.Background(), current, addrs); ok {
+			t.Fatal("Unexpected migration between equal relays")
+		}
+	}
+
+	// The current relay every time, and a different sample of the others.
+	if n := probed[addrs[0]]; n != 3 {
+		t.Errorf("Current relay probed %d times, expected 3", n)
+	}
+	total := 0
+	for _, n := range probed {
+		total += n
+	}
+	if total != 3*(relayProbeSample+1) {
+		t.Errorf("Probed %d times, expected %d", total, 3*(relayProbeSample+1))
+	}
+	if len(probed) <= relayProbeSample+1 {
+		t.Errorf("Only %d distinct relays probed, expected different samples", len(probed))
+	}
+}
+
+func TestNextProbeInterval(t *testing.T) {
+	min, max := 10*time.Minute, time.Hour
+	interval := min
+	for _, expected := range []time.Duration{20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour} {
+		if interval = nextProbeInterval(interval, false, min, max); interval != expected {
+			t.Errorf("Interval %v, expected %v", interval, expected)
+		}
+	}
+	if interval = nextProbeInterval(interval, true, min, max); interval != min {
+		t.Errorf("Interval %v after migration, expected %v", interval, min)
+	}
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+type fakeRelayClient struct {
+	commonClient
+	uri       *url.URL
+	connected bool
+}
+
+func newFakeRelayClient(uri *url.URL, _ []tls.Certificate, invitations chan protocol.SessionInvitation, _ time.Duration) RelayClient {
+	c := &fakeRelayClient{uri: uri}
+	c.commonClient = newCommonClient(invitations, c.serve, c.String())
+	return c
+}
+
+func (c *fakeRelayClient) serve(ctx context.Context) error {
+	c.mut.Lock()
+	c.connected = true
+	c.mut.Unlock()
+	<-ctx.Done()
+	c.mut.Lock()
+	c.connected = false
+	c.mut.Unlock()
+	return nil
+}
+
+func (c *fakeRelayClient) StatusOK() bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.connected
+}
+
+func (c *fakeRelayClient) Latency() time.Duration { return 0 }
+func (c *fakeRelayClient) Score() time.Duration   { return 0 }
+func (c *fakeRelayClient) String() string         { return "fakeRelayClient@" + c.uri.String() }
+func (c *fakeRelayClient) URI() *url.URL          { return c.uri }
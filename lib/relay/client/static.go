@@ -138,6 +138,12 @@ func (c *staticClient) Latency() time.Duration {
 	return lat
 }
 
+// Score returns the connect latency, as that is the only measure we have
+// of a single relay.
+func (c *staticClient) Score() time.Duration {
+	return c.Latency()
+}
+
 func (c *staticClient) String() string {
 	return fmt.Sprintf("StaticClient:%p@%s", c, c.URI())
 }
@@ -7,8 +7,11 @@
 package scanner
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/protocol"
@@ -17,6 +20,87 @@ import (
 
 // HashFile hashes the files and returns a list of blocks representing the file.
 func HashFile(ctx context.Context, fs fs.Filesystem, path string, blockSize int, counter Counter, useWeakHashes bool) ([]protocol.BlockInfo, error) {
+	return hashFile(ctx, fs, path, blockSize, counter, useWeakHashes, nil)
+}
+
+// HashFileParallel is like HashFile, but splits the file between the given
+// number of workers hashing it concurrently.
+func HashFileParallel(ctx context.Context, fs fs.Filesystem, path string, blockSize, workers int, counter Counter, useWeakHashes bool) ([]protocol.BlockInfo, error) {
+	fd, err := fs.Open(path)
+	if err != nil {
+		l.Debugln("open:", err)
+		return nil, err
+	}
+	defer fd.Close()
+
+	fi, err := fd.Stat()
+	if err != nil {
+		l.Debugln("stat before:", err)
+		return nil, err
+	}
+	size := fi.Size()
+	modTime := fi.ModTime()
+
+	numBlocks := int((size + int64(blockSize) - 1) / int64(blockSize))
+	if workers > numBlocks {
+		workers = numBlocks
+	}
+	if workers <= 1 {
+		return HashFile(ctx, fs, path, blockSize, counter, useWeakHashes)
+	}
+
+	// Each worker hashes a contiguous range of whole blocks.
+	perWorker := int64((numBlocks+workers-1)/workers) * int64(blockSize)
+	parts := make([][]protocol.BlockInfo, workers)
+	errs := make([]error, workers)
+	wg := sync.NewWaitGroup()
+	for i := range parts {
+		start := int64(i) * perWorker
+		length := perWorker
+		if start+length > size {
+			length = size - start
+		}
+		if length <= 0 {
+			break
+		}
+		wg.Add(1)
+		go func(i int, start, length int64) {
+			defer wg.Done()
+			r := io.NewSectionReader(fd, start, length)
+			blocks, err := Blocks(ctx, r, blockSize, length, counter, useWeakHashes)
+			for j := range blocks {
+				blocks[j].Offset += start
+			}
+			parts[i], errs[i] = blocks, err
+		}(i, start, length)
+	}
+	wg.Wait()
+
+	blocks := make([]protocol.BlockInfo, 0, numBlocks)
+	for i, part := range parts {
+		if errs[i] != nil {
+			l.Debugln("blocks:", errs[i])
+			return nil, errs[i]
+		}
+		blocks = append(blocks, part...)
+	}
+
+	fi, err = fd.Stat()
+	if err != nil {
+		l.Debugln("stat after:", err)
+		return nil, err
+	}
+	if size != fi.Size() || !modTime.Equal(fi.ModTime()) {
+		return nil, errors.New("file changed during hashing")
+	}
+
+	return blocks, nil
+}
+
+// hashFile is like HashFile, but if prevBlocks is given, the file is
+// assumed to have grown since they were hashed. Those of them that are
+// verified to be unchanged are reused.
+func hashFile(ctx context.Context, fs fs.Filesystem, path string, blockSize int, counter Counter, useWeakHashes bool, prevBlocks []protocol.BlockInfo) ([]protocol.BlockInfo, error) {
 	fd, err := fs.Open(path)
 	if err != nil {
 		l.Debugln("open:", err)
@@ -36,11 +120,21 @@ func HashFile(ctx context.Context, fs fs.Filesystem, path string, blockSize int,
 
 	// Hash the file. This may take a while for large files.
 
-	blocks, err := Blocks(ctx, fd, blockSize, size, counter, useWeakHashes)
+	blocks, ok, err := appendedBlocks(ctx, fd, blockSize, size, counter, useWeakHashes, prevBlocks)
 	if err != nil {
-		l.Debugln("blocks:", err)
+		l.Debugln("appended blocks:", err)
 		return nil, err
 	}
+	if !ok {
+		if len(prevBlocks) > 0 {
+			l.Debugln("not appended to, rehashing:", path)
+		}
+		blocks, err = Blocks(ctx, fd, blockSize, size, counter, useWeakHashes)
+		if err != nil {
+			l.Debugln("blocks:", err)
+			return nil, err
+		}
+	}
 
 	// Recheck the size and modtime again. If they differ, the file changed
 	// while we were reading it and our hash results are invalid.
@@ -57,6 +151,59 @@ func HashFile(ctx context.Context, fs fs.Filesystem, path string, blockSize int,
 	return blocks, nil
 }
 
+// appendedBlocks returns the blocks of the file, reusing those of
+// prevBlocks that are unchanged. Every reused block is verified by hashing
+// it again, so this saves the weak hashing of unchanged data but not the
+// reading of it. Returns false if the blocks can't be reused, in which case
+// the file is positioned at the start.
+func appendedBlocks(ctx context.Context, fd fs.File, blockSize int, size int64, counter Counter, useWeakHashes bool, prevBlocks []protocol.BlockInfo) ([]protocol.BlockInfo, bool, error) {
+	if len(prevBlocks) == 0 {
+		return nil, false, nil
+	}
+
+	last := prevBlocks[len(prevBlocks)-1]
+	end := last.Offset + int64(last.Size)
+	if int(last.Size) != blockSize || end >= size {
+		return nil, false, nil
+	}
+
+	curBlocks, err := Blocks(ctx, io.NewSectionReader(fd, 0, end), blockSize, end, counter, false)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(curBlocks) != len(prevBlocks) {
+		return nil, false, nil
+	}
+
+	blocks := make([]protocol.BlockInfo, 0, len(prevBlocks)+int((size-end)/int64(blockSize))+1)
+	for i, b := range curBlocks {
+		prev := prevBlocks[i]
+		if prev.Offset == b.Offset && prev.Size == b.Size && bytes.Equal(prev.Hash, b.Hash) {
+			blocks = append(blocks, prev)
+			continue
+		}
+		if useWeakHashes {
+			// The block changed; hash it again to get the weak hash too.
+			changed, err := Blocks(ctx, io.NewSectionReader(fd, b.Offset, int64(b.Size)), blockSize, int64(b.Size), counter, true)
+			if err != nil {
+				return nil, false, err
+			}
+			b.WeakHash = changed[0].WeakHash
+		}
+		blocks = append(blocks, b)
+	}
+
+	newBlocks, err := Blocks(ctx, io.NewSectionReader(fd, end, size-end), blockSize, size-end, counter, useWeakHashes)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, b := range newBlocks {
+		b.Offset += end
+		blocks = append(blocks, b)
+	}
+	return blocks, true, nil
+}
+
 // The parallel hasher reads FileInfo structures from the inbox, hashes the
 // file to populate the Blocks element and sends it to the outbox. A number of
 // workers are used in parallel. The outbox will become closed when the inbox
@@ -67,17 +214,19 @@ type parallelHasher struct {
 	outbox  chan<- ScanResult
 	inbox   <-chan protocol.FileInfo
 	counter Counter
+	stats   *Stats
 	done    chan<- struct{}
 	wg      sync.WaitGroup
 }
 
-func newParallelHasher(ctx context.Context, fs fs.Filesystem, workers int, outbox chan<- ScanResult, inbox <-chan protocol.FileInfo, counter Counter, done chan<- struct{}) {
+func newParallelHasher(ctx context.Context, fs fs.Filesystem, workers int, outbox chan<- ScanResult, inbox <-chan protocol.FileInfo, counter Counter, stats *Stats, done chan<- struct{}) {
 	ph := &parallelHasher{
 		fs:      fs,
 		workers: workers,
 		outbox:  outbox,
 		inbox:   inbox,
 		counter: counter,
+		stats:   stats,
 		done:    done,
 		wg:      sync.NewWaitGroup(),
 	}
@@ -104,7 +253,10 @@ func (ph *parallelHasher) hashFiles(ctx context.Context) {
 				panic("Bug. Asked to hash a directory or a deleted file.")
 			}
 
-			blocks, err := HashFile(ctx, ph.fs, f.Name, f.BlockSize(), ph.counter, true)
+			t0 := time.Now()
+			// Blocks set on the file to hash are from before it was
+			// appended to, and may be reused.
+			blocks, err := hashFile(ctx, ph.fs, f.Name, f.BlockSize(), ph.counter, true, f.Blocks)
 			if err != nil {
 				l.Debugln("hash error:", f.Name, err)
 				continue
@@ -121,6 +273,10 @@ func (ph *parallelHasher) hashFiles(ctx context.Context) {
 				f.Size += int64(b.Size)
 			}
 
+			if ph.stats != nil {
+				ph.stats.addHashed(f.Size, time.Since(t0))
+			}
+
 			select {
 			case ph.outbox <- ScanResult{File: f}:
 			case <-ctx.Done():
@@ -111,6 +111,9 @@ func (f fakeInfo) IsRegular() bool    { return !f.IsDir() }
 func (f fakeInfo) IsSymlink() bool    { return false }
 func (f fakeInfo) Owner() int         { return 0 }
 func (f fakeInfo) Group() int         { return 0 }
+func (f fakeInfo) HardlinkID() string { return "" }
+
+func (f fakeInfo) ReparsePoint() fs.ReparsePoint { return fs.ReparsePointNone }
 
 type fakeFile struct {
 	name       string
@@ -10,6 +10,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -23,6 +26,8 @@ import (
 	"github.com/syncthing/syncthing/lib/ignore"
 	"github.com/syncthing/syncthing/lib/osutil"
 	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
+	"github.com/syncthing/syncthing/lib/sync"
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -59,6 +64,45 @@ type Config struct {
 	ModTimeWindow time.Duration
 	// Event logger to which the scan progress events are sent
 	EventLogger events.Logger
+	// If ProgressFn is not nil, it is called with the number of bytes
+	// hashed and to hash whenever a scan progress event is sent, and once
+	// more when hashing is done.
+	ProgressFn func(current, total int64)
+	// How to select the block size for scanned files
+	BlockSizeStrategy protocol.BlockSizeStrategy
+	// If Stats is not nil, it is updated with statistics about the scan.
+	// It is complete once the result channel is closed.
+	Stats *Stats
+	// If MetadataOnly is true, files are not hashed. Changes are detected
+	// by size, modification time and permissions only, and changed files
+	// are returned without blocks and with the MustRescan flag set, so
+	// that they are hashed by the next normal scan.
+	MetadataOnly bool
+	// Fraction of files with unchanged metadata that are hashed anyway, to
+	// detect silent corruption. Files whose contents changed are returned
+	// with a version that conflicts with other devices' versions, rather
+	// than overriding them.
+	VerifyFraction float64
+	// If PreserveHardlinks is true, files with several names in the folder
+	// get the name first seen as HardlinkTarget.
+	PreserveHardlinks bool
+	// New and changed files whose contents are sniffed to be of one of
+	// these MIME types, or "type/*", are skipped like ignored files.
+	SkipContentTypes []string
+}
+
+// Stats describes where the time of a scan went.
+type Stats struct {
+	FilesHashed  int64
+	BytesHashed  int64
+	WalkDuration time.Duration // time spent walking the filesystem
+	HashDuration time.Duration // time spent hashing, summed over all hashers
+}
+
+func (s *Stats) addHashed(bytes int64, d time.Duration) {
+	atomic.AddInt64(&s.FilesHashed, 1)
+	atomic.AddInt64(&s.BytesHashed, bytes)
+	atomic.AddInt64((*int64)(&s.HashDuration), int64(d))
 }
 
 type CurrentFiler interface {
@@ -73,7 +117,14 @@ type ScanResult struct {
 }
 
 func Walk(ctx context.Context, cfg Config) chan ScanResult {
-	w := walker{cfg}
+	w := walker{
+		Config:    cfg,
+		verifying: make(map[string]protocol.FileInfo),
+		verifyMut: sync.NewMutex(),
+	}
+	if cfg.PreserveHardlinks {
+		w.hardlinks = make(map[string]string)
+	}
 
 	if w.CurrentFiler == nil {
 		w.CurrentFiler = noCurrentFiler{}
@@ -96,6 +147,18 @@ var (
 
 type walker struct {
 	Config
+
+	// Files with unchanged metadata that are being hashed for
+	// verification, by name.
+	verifying map[string]protocol.FileInfo
+	verifyMut sync.Mutex
+
+	// The first name seen of each hardlinked file, by hardlink ID.
+	hardlinks map[string]string
+
+	// Time the walk spent blocked on sending its output, only accessed by
+	// the walking routine.
+	blocked time.Duration
 }
 
 // Walk returns the list of files found in the local folder by scanning the
@@ -106,9 +169,17 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 	toHashChan := make(chan protocol.FileInfo)
 	finishedChan := make(chan ScanResult)
 
+	// Results of verifications that found no change are filtered out.
+	results := finishedChan
+	if w.VerifyFraction > 0 && !w.MetadataOnly {
+		results = make(chan ScanResult)
+		go w.filterVerified(ctx, finishedChan, results)
+	}
+
 	// A routine which walks the filesystem tree, and sends files which have
 	// been modified to the counter routine.
 	go func() {
+		t0 := time.Now()
 		hashFiles := w.walkAndHashFiles(ctx, toHashChan, finishedChan)
 		if len(w.Subs) == 0 {
 			w.Filesystem.Walk(".", hashFiles)
@@ -121,14 +192,24 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 				w.Filesystem.Walk(sub, hashFiles)
 			}
 		}
+		if w.Stats != nil {
+			w.Stats.WalkDuration = time.Since(t0) - w.blocked
+		}
 		close(toHashChan)
 	}()
 
+	// Without hashing there is no progress to report, changed files are
+	// passed on as they are found.
+	if w.MetadataOnly {
+		go w.flagChangedFiles(ctx, toHashChan, finishedChan)
+		return results
+	}
+
 	// We're not required to emit scan progress events, just kick off hashers,
 	// and feed inputs directly from the walker.
 	if w.ProgressTickIntervalS < 0 {
-		newParallelHasher(ctx, w.Filesystem, w.Hashers, finishedChan, toHashChan, nil, nil)
-		return finishedChan
+		newParallelHasher(ctx, w.Filesystem, w.Hashers, finishedChan, toHashChan, nil, w.Stats, nil)
+		return results
 	}
 
 	// Defaults to every 2 seconds.
@@ -147,18 +228,19 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 	// which it receives the files we ask it to hash.
 	go func() {
 		var filesToHash []protocol.FileInfo
-		var total int64 = 1
+		var size int64
 
 		for file := range toHashChan {
 			filesToHash = append(filesToHash, file)
-			total += file.Size
+			size += file.Size
 		}
+		total := size + 1 // never zero, as we divide by it
 
 		realToHashChan := make(chan protocol.FileInfo)
 		done := make(chan struct{})
 		progress := newByteCounter()
 
-		newParallelHasher(ctx, w.Filesystem, w.Hashers, finishedChan, realToHashChan, progress, done)
+		newParallelHasher(ctx, w.Filesystem, w.Hashers, finishedChan, realToHashChan, progress, w.Stats, done)
 
 		// A routine which actually emits the FolderScanProgress events
 		// every w.ProgressTicker ticks, until the hasher routines terminate.
@@ -170,6 +252,9 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 				case <-done:
 					l.Debugln("Walk progress done", w.Folder, w.Subs, w.Matcher)
 					ticker.Stop()
+					if w.ProgressFn != nil {
+						w.ProgressFn(size, size)
+					}
 					return
 				case <-ticker.C:
 					current := progress.Total()
@@ -181,6 +266,9 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 						"total":   total,
 						"rate":    rate, // bytes per second
 					})
+					if w.ProgressFn != nil {
+						w.ProgressFn(current, size)
+					}
 				case <-ctx.Done():
 					ticker.Stop()
 					return
@@ -200,7 +288,46 @@ func (w *walker) walk(ctx context.Context) chan ScanResult {
 		close(realToHashChan)
 	}()
 
-	return finishedChan
+	return results
+}
+
+// filterVerified passes on the results, except for files that were hashed for
+// verification and turned out to be unchanged.
+func (w *walker) filterVerified(ctx context.Context, in <-chan ScanResult, out chan<- ScanResult) {
+	defer close(out)
+	for res := range in {
+		if res.Err == nil {
+			w.verifyMut.Lock()
+			curFile, ok := w.verifying[res.File.Name]
+			delete(w.verifying, res.File.Name)
+			w.verifyMut.Unlock()
+			if ok {
+				if protocol.BlocksEqual(curFile.Blocks, res.File.Blocks) {
+					continue
+				}
+				l.Infof("Scanner (folder %s, item %q): contents changed without a change in size or modification time, possible corruption", w.Folder, res.File.Name)
+			}
+		}
+		select {
+		case out <- res:
+		case <-ctx.Done():
+			// Keep draining, so that the hashers aren't blocked.
+		}
+	}
+}
+
+// flagChangedFiles marks the files from the walker as needing a rescan
+// instead of hashing them.
+func (w *walker) flagChangedFiles(ctx context.Context, toHashChan <-chan protocol.FileInfo, finishedChan chan<- ScanResult) {
+	defer close(finishedChan)
+	for f := range toHashChan {
+		f.SetMustRescan(w.ShortID)
+		select {
+		case finishedChan <- ScanResult{File: f}:
+		case <-ctx.Done():
+			// Keep draining, so that the walker isn't blocked.
+		}
+	}
 }
 
 func (w *walker) walkAndHashFiles(ctx context.Context, toHashChan chan<- protocol.FileInfo, finishedChan chan<- ScanResult) fs.WalkFunc {
@@ -265,7 +392,7 @@ func (w *walker) walkAndHashFiles(ctx context.Context, toHashChan chan<- protoco
 
 		if ignoredParent == "" {
 			// parent isn't ignored, nothing special
-			return w.handleItem(ctx, path, toHashChan, finishedChan, skip)
+			return w.handleItem(ctx, path, info, toHashChan, finishedChan, skip)
 		}
 
 		// Part of current path below the ignored (potential) parent
@@ -274,17 +401,21 @@ func (w *walker) walkAndHashFiles(ctx context.Context, toHashChan chan<- protoco
 		// ignored path isn't actually a parent of the current path
 		if rel == path {
 			ignoredParent = ""
-			return w.handleItem(ctx, path, toHashChan, finishedChan, skip)
+			return w.handleItem(ctx, path, info, toHashChan, finishedChan, skip)
 		}
 
 		// The previously ignored parent directories of the current, not
 		// ignored path need to be handled as well.
-		if err = w.handleItem(ctx, ignoredParent, toHashChan, finishedChan, skip); err != nil {
+		if err = w.handleItem(ctx, ignoredParent, nil, toHashChan, finishedChan, skip); err != nil {
 			return err
 		}
 		for _, name := range strings.Split(rel, string(fs.PathSeparator)) {
 			ignoredParent = filepath.Join(ignoredParent, name)
-			if err = w.handleItem(ctx, ignoredParent, toHashChan, finishedChan, skip); err != nil {
+			itemInfo := info
+			if ignoredParent != path {
+				itemInfo = nil
+			}
+			if err = w.handleItem(ctx, ignoredParent, itemInfo, toHashChan, finishedChan, skip); err != nil {
 				return err
 			}
 		}
@@ -294,22 +425,34 @@ func (w *walker) walkAndHashFiles(ctx context.Context, toHashChan chan<- protoco
 	}
 }
 
-func (w *walker) handleItem(ctx context.Context, path string, toHashChan chan<- protocol.FileInfo, finishedChan chan<- ScanResult, skip error) error {
-	info, err := w.Filesystem.Lstat(path)
-	// An error here would be weird as we've already gotten to this point, but act on it nonetheless
-	if err != nil {
-		w.handleError(ctx, "scan", path, err, finishedChan)
-		return skip
+// handleItem handles the item at path. The info is as given by the walk, if
+// available, as it differs from what Lstat returns for followed symlinks.
+func (w *walker) handleItem(ctx context.Context, path string, info fs.FileInfo, toHashChan chan<- protocol.FileInfo, finishedChan chan<- ScanResult, skip error) error {
+	if info == nil {
+		var err error
+		info, err = w.Filesystem.Lstat(path)
+		// An error here would be weird as we've already gotten to this point, but act on it nonetheless
+		if err != nil {
+			w.handleError(ctx, "scan", path, err, finishedChan)
+			return skip
+		}
 	}
 
 	oldPath := path
-	path, err = w.normalizePath(path, info)
+	path, err := w.normalizePath(path, info)
 	if err != nil {
 		w.handleError(ctx, "normalizing path", oldPath, err, finishedChan)
 		return skip
 	}
 
 	switch {
+	case info.ReparsePoint() == fs.ReparsePointJunction || info.ReparsePoint() == fs.ReparsePointMountPoint:
+		// Junctions and mount points can't be synced as symlinks, and we
+		// don't descend into them by default as that may lead to loops or
+		// to another volume.
+		l.Debugf("skipping %v: %v", info.ReparsePoint(), path)
+		return skip
+
 	case info.IsSymlink():
 		if err := w.walkSymlink(ctx, path, info, finishedChan); err != nil {
 			return err
@@ -324,16 +467,16 @@ func (w *walker) handleItem(ctx context.Context, path string, toHashChan chan<-
 		err = w.walkDir(ctx, path, info, finishedChan)
 
 	case info.IsRegular():
-		err = w.walkRegular(ctx, path, info, toHashChan)
+		err = w.walkRegular(ctx, path, info, toHashChan, finishedChan)
 	}
 
 	return err
 }
 
-func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileInfo, toHashChan chan<- protocol.FileInfo) error {
+func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileInfo, toHashChan chan<- protocol.FileInfo, finishedChan chan<- ScanResult) error {
 	curFile, hasCurFile := w.CurrentFiler.CurrentFile(relPath)
 
-	blockSize := protocol.BlockSize(info.Size())
+	blockSize := w.BlockSizeStrategy.BlockSize(info.Size())
 
 	if hasCurFile {
 		// Check if we should retain current block size.
@@ -353,24 +496,69 @@ func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileIn
 	f = w.updateFileInfo(f, curFile)
 	f.NoPermissions = w.IgnorePerms
 	f.RawBlockSize = int32(blockSize)
+	if w.PreserveHardlinks {
+		f.HardlinkTarget = w.hardlinkTarget(relPath, info, curFile)
+	}
 
+	verify := false
 	if hasCurFile {
-		if curFile.IsEquivalentOptional(f, w.ModTimeWindow, w.IgnorePerms, true, w.LocalFlags) {
+		if w.MetadataOnly && curFile.MustRescan() {
+			// Already flagged, the next normal scan hashes it anyway.
 			return nil
 		}
-		if curFile.ShouldConflict() {
-			// The old file was invalid for whatever reason and probably not
-			// up to date with what was out there in the cluster. Drop all
-			// others from the version vector to indicate that we haven't
-			// taken their version into account, and possibly cause a
-			// conflict.
+		switch {
+		case !curFile.IsEquivalentOptional(f, w.ModTimeWindow, w.IgnorePerms, true, w.LocalFlags):
+			if curFile.ShouldConflict() {
+				// The old file was invalid for whatever reason and probably not
+				// up to date with what was out there in the cluster. Drop all
+				// others from the version vector to indicate that we haven't
+				// taken their version into account, and possibly cause a
+				// conflict.
+				f.Version = f.Version.DropOthers(w.ShortID)
+			}
+			l.Debugln("rescan:", curFile, info.ModTime().Unix(), info.Mode()&fs.ModePerm)
+
+			f.Blocks = appendReusableBlocks(curFile, f)
+
+		case w.shouldVerify(curFile):
+			// If the contents changed behind our back they are most likely
+			// corrupt, so don't override other devices' versions with them.
+			l.Debugln("verify:", curFile)
+			verify = true
 			f.Version = f.Version.DropOthers(w.ShortID)
+			f.RawBlockSize = int32(curFile.BlockSize())
+			w.verifyMut.Lock()
+			w.verifying[relPath] = curFile
+			w.verifyMut.Unlock()
+
+		default:
+			return nil
 		}
-		l.Debugln("rescan:", curFile, info.ModTime().Unix(), info.Mode()&fs.ModePerm)
+	}
+
+	if !verify && len(w.SkipContentTypes) > 0 && w.skipContentType(relPath) {
+		l.Debugln("skipping by content type:", relPath)
+		if !hasCurFile || curFile.IsIgnored() || curFile.IsDeleted() {
+			return nil
+		}
+		// Mark the file as ignored, as the folder does for ignored files.
+		ignored := protocol.FileInfo{
+			Name:         curFile.Name,
+			Type:         curFile.Type,
+			ModifiedS:    curFile.ModifiedS,
+			ModifiedNs:   curFile.ModifiedNs,
+			ModifiedBy:   w.ShortID,
+			Version:      curFile.Version,
+			RawBlockSize: curFile.RawBlockSize,
+			LocalFlags:   protocol.FlagLocalIgnored,
+		}
+		return w.emit(ctx, finishedChan, ScanResult{File: ignored})
 	}
 
 	l.Debugln("to hash:", relPath, f)
 
+	t0 := time.Now()
+	defer w.addBlocked(t0)
 	select {
 	case toHashChan <- f:
 	case <-ctx.Done():
@@ -380,6 +568,84 @@ func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileIn
 	return nil
 }
 
+// hardlinkTarget returns the name of the file seen earlier in this walk
+// that the file is hardlinked to, if any. A change of only the target
+// isn't considered a change of the file.
+func (w *walker) hardlinkTarget(relPath string, info fs.FileInfo, curFile protocol.FileInfo) string {
+	id := info.HardlinkID()
+	if id == "" {
+		return ""
+	}
+	if target, ok := w.hardlinks[id]; ok {
+		return target
+	}
+	w.hardlinks[id] = relPath
+	if len(w.Subs) > 0 && curFile.HardlinkTarget != relPath {
+		// The other names may be outside of what we are walking.
+		return curFile.HardlinkTarget
+	}
+	return ""
+}
+
+// skipContentType returns whether the file's contents are sniffed to be of
+// a type to skip. Files that can't be read aren't skipped, so that hashing
+// reports the error.
+func (w *walker) skipContentType(relPath string) bool {
+	fd, err := w.Filesystem.Open(relPath)
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+
+	// DetectContentType considers at most this much data.
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(fd, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return matchesContentType(w.SkipContentTypes, http.DetectContentType(buf[:n]))
+}
+
+// matchesContentType returns whether the media type of the content type,
+// without parameters, is one of the types, which may be like "type/*".
+func matchesContentType(types []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldVerify returns whether the file with unchanged metadata is selected
+// to be hashed for verification.
+func (w *walker) shouldVerify(curFile protocol.FileInfo) bool {
+	if w.VerifyFraction <= 0 || w.MetadataOnly || len(curFile.Blocks) == 0 {
+		return false
+	}
+	return rand.Float64() < w.VerifyFraction
+}
+
+// appendReusableBlocks returns the blocks of the current file that can be
+// reused if the file has only been appended to, which is possible when it
+// grew and kept its block size. Only full blocks are reused. The hasher
+// verifies each of them against the data on disk.
+func appendReusableBlocks(curFile, f protocol.FileInfo) []protocol.BlockInfo {
+	if curFile.Type != protocol.FileInfoTypeFile || curFile.IsDeleted() || curFile.IsInvalid() || curFile.BlockSize() != f.BlockSize() || f.Size <= curFile.Size {
+		return nil
+	}
+	n := int(curFile.Size / int64(f.BlockSize()))
+	if n == 0 || n > len(curFile.Blocks) {
+		return nil
+	}
+	return curFile.Blocks[:n]
+}
+
 func (w *walker) walkDir(ctx context.Context, relPath string, info fs.FileInfo, finishedChan chan<- ScanResult) error {
 	curFile, hasCurFile := w.CurrentFiler.CurrentFile(relPath)
 
@@ -403,13 +669,7 @@ func (w *walker) walkDir(ctx context.Context, relPath string, info fs.FileInfo,
 
 	l.Debugln("dir:", relPath, f)
 
-	select {
-	case finishedChan <- ScanResult{File: f}:
-	case <-ctx.Done():
-		return ctx.Err()
-	}
-
-	return nil
+	return w.emit(ctx, finishedChan, ScanResult{File: f})
 }
 
 // walkSymlink returns nil or an error, if the error is of the nature that
@@ -447,13 +707,7 @@ func (w *walker) walkSymlink(ctx context.Context, relPath string, info fs.FileIn
 
 	l.Debugln("symlink changedb:", relPath, f)
 
-	select {
-	case finishedChan <- ScanResult{File: f}:
-	case <-ctx.Done():
-		return ctx.Err()
-	}
-
-	return nil
+	return w.emit(ctx, finishedChan, ScanResult{File: f})
 }
 
 // normalizePath returns the normalized relative path (possibly after fixing
@@ -534,15 +788,30 @@ func (w *walker) handleError(ctx context.Context, context, path string, err erro
 		return
 	}
 	l.Infof("Scanner (folder %s, item %q): %s: %v", w.Folder, path, context, err)
-	select {
-	case finishedChan <- ScanResult{
+	w.emit(ctx, finishedChan, ScanResult{
 		Err:  fmt.Errorf("%s: %s", context, err.Error()),
 		Path: path,
-	}:
+	})
+}
+
+// emit passes a result on from the walk.
+func (w *walker) emit(ctx context.Context, finishedChan chan<- ScanResult, res ScanResult) error {
+	t0 := time.Now()
+	defer w.addBlocked(t0)
+	select {
+	case finishedChan <- res:
+		return nil
 	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// addBlocked accounts the time since t0 as spent waiting for the receivers
+// of the walk's output, which doesn't count towards the walk duration.
+func (w *walker) addBlocked(t0 time.Time) {
+	w.blocked += time.Since(t0)
+}
+
 // A byteCounter gets bytes added to it via Update() and then provides the
 // Total() and one minute moving average Rate() in bytes per second.
 type byteCounter struct {
@@ -14,12 +14,15 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	rdebug "runtime/debug"
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/d4l3k/messagediff"
 	"github.com/syncthing/syncthing/lib/events"
@@ -120,6 +123,205 @@ func TestWalk(t *testing.T) {
 	}
 }
 
+func TestWalkStats(t *testing.T) {
+	for _, progress := range []int{0, -1} {
+		var stats Stats
+		cfg := testConfig()
+		cfg.ProgressTickIntervalS = progress
+		cfg.Stats = &stats
+
+		t0 := time.Now()
+		var files, size int64
+		for f := range Walk(context.TODO(), cfg) {
+			if f.Err != nil {
+				t.Errorf("Error while scanning %v: %v", f.Err, f.Path)
+			}
+			if f.File.Type == protocol.FileInfoTypeFile {
+				files++
+				size += f.File.Size
+			}
+		}
+		elapsed := time.Since(t0)
+
+		if files == 0 {
+			t.Fatal("no files scanned")
+		}
+		if stats.FilesHashed != files || stats.BytesHashed != size {
+			t.Errorf("progress %d: hashed %d files, %d bytes, expected %d files, %d bytes", progress, stats.FilesHashed, stats.BytesHashed, files, size)
+		}
+		if stats.WalkDuration <= 0 || stats.WalkDuration > elapsed {
+			t.Errorf("progress %d: walk duration %v out of range (0, %v]", progress, stats.WalkDuration, elapsed)
+		}
+		if max := elapsed * time.Duration(cfg.Hashers); stats.HashDuration <= 0 || stats.HashDuration > max {
+			t.Errorf("progress %d: hash duration %v out of range (0, %v]", progress, stats.HashDuration, max)
+		}
+	}
+}
+
+func TestWalkDurationExcludesReceivers(t *testing.T) {
+	var stats Stats
+	cfg := testConfig()
+	cfg.ProgressTickIntervalS = -1
+	cfg.Stats = &stats
+
+	// A slow receiver blocks the walk, which must not be counted.
+	const delay = 20 * time.Millisecond
+	var slept time.Duration
+	for f := range Walk(context.TODO(), cfg) {
+		if f.Err != nil {
+			t.Errorf("Error while scanning %v: %v", f.Err, f.Path)
+		}
+		time.Sleep(delay)
+		slept += delay
+	}
+
+	if slept < 5*delay {
+		t.Fatalf("Too few results (%v) for a meaningful test", slept/delay)
+	}
+	if stats.WalkDuration <= 0 || stats.WalkDuration > slept/2 {
+		t.Errorf("Walk duration %v includes the time spent by the receiver (%v)", stats.WalkDuration, slept)
+	}
+}
+
+type countingCounter struct {
+	total int64
+}
+
+func (c *countingCounter) Update(bytes int64) {
+	c.total += bytes
+}
+
+func TestHashAppendedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+
+	const bs = protocol.MinBlockSize
+	data := make([]byte, 3*bs+bs/2)
+	rand.Read(data)
+	if err := ioutil.WriteFile(filepath.Join(dir, "log"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldBlocks, err := HashFile(context.TODO(), ffs, "log", bs, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curFile := protocol.FileInfo{
+		Name:         "log",
+		Type:         protocol.FileInfoTypeFile,
+		Size:         int64(len(data)),
+		RawBlockSize: bs,
+		Blocks:       oldBlocks,
+	}
+
+	appended := make([]byte, bs)
+	rand.Read(appended)
+	data = append(data, appended...)
+	if err := ioutil.WriteFile(filepath.Join(dir, "log"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := curFile
+	f.Size = int64(len(data))
+	reuse := appendReusableBlocks(curFile, f)
+	if len(reuse) != 3 {
+		t.Fatalf("expected the 3 full blocks to be reusable, got %d", len(reuse))
+	}
+
+	expected, err := HashFile(context.TODO(), ffs, "log", bs, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reused blocks are all read to verify them, in addition to the
+	// tail.
+
+	counter := new(countingCounter)
+	blocks, err := hashFile(context.TODO(), ffs, "log", bs, counter, true, reuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, equal := messagediff.PrettyDiff(expected, blocks); !equal {
+		t.Errorf("Incorrect blocks for appended file. Diff:\n%s", diff)
+	}
+	if read := int64(len(data)); counter.total != read {
+		t.Errorf("hashed %d bytes, expected %d", counter.total, read)
+	}
+
+	// The walker reuses the blocks as well.
+
+	cfg := testConfig()
+	cfg.Filesystem = ffs
+	cfg.CurrentFiler = fakeCurrentFiler{"log": curFile}
+	var res []protocol.FileInfo
+	for r := range Walk(context.TODO(), cfg) {
+		res = append(res, r.File)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected one result, got %v", res)
+	}
+	if diff, equal := messagediff.PrettyDiff(expected, res[0].Blocks); !equal {
+		t.Errorf("Incorrect blocks from walk. Diff:\n%s", diff)
+	}
+
+	// A block changed in the middle is detected and hashed again, with
+	// its weak hash.
+
+	data[bs+bs/2] ^= 0xff
+	if err := ioutil.WriteFile(filepath.Join(dir, "log"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err = HashFile(context.TODO(), ffs, "log", bs, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter = new(countingCounter)
+	blocks, err = hashFile(context.TODO(), ffs, "log", bs, counter, true, reuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, equal := messagediff.PrettyDiff(expected, blocks); !equal {
+		t.Errorf("Incorrect blocks for file changed in the middle. Diff:\n%s", diff)
+	}
+	if read := int64(len(data)) + bs; counter.total != read {
+		t.Errorf("hashed %d bytes, expected %d", counter.total, read)
+	}
+}
+
+func TestHashFileParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+
+	const bs = protocol.MinBlockSize
+	for _, size := range []int{0, bs / 2, bs, 5*bs + bs/2, 8 * bs} {
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := ioutil.WriteFile(filepath.Join(dir, "file"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected, err := HashFile(context.TODO(), ffs, "file", bs, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{1, 2, 3, 16} {
+			blocks, err := HashFileParallel(context.TODO(), ffs, "file", bs, workers, nil, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff, equal := messagediff.PrettyDiff(expected, blocks); !equal {
+				t.Errorf("Incorrect blocks for size %d with %d workers. Diff:\n%s", size, workers, diff)
+			}
+		}
+	}
+}
+
 func TestVerify(t *testing.T) {
 	blocksize := 16
 	// data should be an even multiple of blocksize long
@@ -287,6 +489,69 @@ func TestWalkSymlinkUnix(t *testing.T) {
 	}
 }
 
+func TestWalkFollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping unsupported symlink test")
+		return
+	}
+
+	// Create a folder with a symlink to a directory in it
+	os.RemoveAll("_symlinks")
+	os.MkdirAll("_symlinks/target", 0755)
+	defer os.RemoveAll("_symlinks")
+	ioutil.WriteFile("_symlinks/target/file", []byte("content"), 0644)
+	os.Mkdir("_symlinks/folder", 0755)
+	os.Symlink("../target", "_symlinks/folder/link")
+
+	fs := fs.NewFilesystem(fs.FilesystemTypeBasic, "_symlinks/folder", fs.WithFollowSymlinks(1))
+	files := walkDir(fs, ".", nil, nil, 0)
+	sort.Sort(fileList(files))
+
+	if len(files) != 2 {
+		t.Fatalf("expected the symlinked directory and its file, got %v", files)
+	}
+	if files[0].Name != "link" || !files[0].IsDirectory() {
+		t.Errorf("expected the symlink to be scanned as a directory, got %v", files[0])
+	}
+	if files[1].Name != filepath.Join("link", "file") || files[1].Size != 7 {
+		t.Errorf("expected the file in the symlinked directory, got %v", files[1])
+	}
+}
+
+func TestWalkJunctionWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("skipping junction test on non-Windows")
+		return
+	}
+
+	// Create a folder with a junction in it
+	os.RemoveAll("_junctions")
+	os.MkdirAll("_junctions/target", 0755)
+	defer os.RemoveAll("_junctions")
+	ioutil.WriteFile("_junctions/target/file", []byte("content"), 0644)
+	abs, _ := filepath.Abs("_junctions")
+	if err := exec.Command("cmd", "/c", "mklink", "/J", filepath.Join(abs, "junction"), filepath.Join(abs, "target")).Run(); err != nil {
+		t.Skip("can't create junction:", err)
+	}
+
+	cfg := testConfig()
+	cfg.Filesystem = fs.NewFilesystem(fs.FilesystemTypeBasic, "_junctions")
+	var files []string
+	for res := range Walk(context.TODO(), cfg) {
+		if res.Err != nil {
+			t.Errorf("Error while scanning %v: %v", res.Path, res.Err)
+		}
+		files = append(files, res.File.Name)
+	}
+	sort.Strings(files)
+
+	// The junction is skipped, not descended into nor scanned as a symlink
+	expected := []string{"target", filepath.Join("target", "file")}
+	if diff, equal := messagediff.PrettyDiff(expected, files); !equal {
+		t.Errorf("Walk returned unexpected files. Diff:\n%s", diff)
+	}
+}
+
 func TestWalkSymlinkWindows(t *testing.T) {
 	if runtime.GOOS != "windows" {
 		t.Skip("skipping unsupported symlink test")
@@ -432,6 +697,156 @@ func TestBlocksizeHysteresis(t *testing.T) {
 	runTest(512 << 10)
 }
 
+func TestWalkMetadataOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+	name := filepath.Join(dir, "file")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	write := func(data string) {
+		t.Helper()
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("some data")
+	current := make(fakeCurrentFiler)
+	files := walkDir(ffs, ".", current, nil, 0)
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %v", files)
+	}
+	current["file"] = files[0]
+
+	cfg := testConfig()
+	cfg.Filesystem = ffs
+	cfg.CurrentFiler = current
+	cfg.MetadataOnly = true
+	walkMetadata := func() []protocol.FileInfo {
+		var res []protocol.FileInfo
+		for r := range Walk(context.TODO(), cfg) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			res = append(res, r.File)
+		}
+		return res
+	}
+
+	// Changing only the contents goes unnoticed.
+
+	write("same size")
+	if res := walkMetadata(); len(res) != 0 {
+		t.Fatalf("content only change was detected: %v", res)
+	}
+
+	// A size change is detected, and the file is flagged for rescanning
+	// without being hashed.
+
+	write("different size")
+	res := walkMetadata()
+	if len(res) != 1 {
+		t.Fatalf("expected the size change to be detected, got %v", res)
+	}
+	if f := res[0]; !f.MustRescan() || len(f.Blocks) != 0 || f.Size != int64(len("different size")) {
+		t.Errorf("unexpected result %v", f)
+	}
+
+	// Once flagged, it isn't reported again.
+
+	current["file"] = res[0]
+	if res := walkMetadata(); len(res) != 0 {
+		t.Fatalf("flagged file was reported again: %v", res)
+	}
+}
+
+func TestWalkVerifyFraction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	const numFiles = 200
+	writeAll := func(data string) {
+		t.Helper()
+		for i := 0; i < numFiles; i++ {
+			name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+			if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeAll("original")
+	remoteVersion := protocol.Vector{}.Update(42)
+	current := make(fakeCurrentFiler)
+	for _, f := range walkDir(ffs, ".", current, nil, 0) {
+		f.Version = remoteVersion
+		current[f.Name] = f
+	}
+	if len(current) != numFiles {
+		t.Fatalf("expected %d files, got %d", numFiles, len(current))
+	}
+
+	walkVerify := func(fraction float64) []protocol.FileInfo {
+		t.Helper()
+		cfg := testConfig()
+		cfg.Filesystem = ffs
+		cfg.CurrentFiler = current
+		cfg.VerifyFraction = fraction
+		var res []protocol.FileInfo
+		for r := range Walk(context.TODO(), cfg) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			res = append(res, r.File)
+		}
+		return res
+	}
+
+	// Verifying unchanged files doesn't report them.
+
+	if res := walkVerify(1); len(res) != 0 {
+		t.Fatalf("unchanged files were reported: %v", res)
+	}
+
+	// Corrupt all files, without changing size or modification time. The
+	// number of files detected follows the fraction.
+
+	writeAll("corrupt!")
+	if res := walkVerify(0); len(res) != 0 {
+		t.Errorf("detected %d files without verification", len(res))
+	}
+	if res := walkVerify(0.25); len(res) < numFiles/10 || len(res) > numFiles*4/10 {
+		t.Errorf("detected %d files with a fraction of 0.25, expected about %d", len(res), numFiles/4)
+	}
+	res := walkVerify(1)
+	if len(res) != numFiles {
+		t.Fatalf("detected %d files with a fraction of 1, expected all %d", len(res), numFiles)
+	}
+	for _, f := range res {
+		if protocol.BlocksEqual(f.Blocks, current[f.Name].Blocks) {
+			t.Errorf("%s has the old blocks", f.Name)
+		}
+		if !f.Version.Concurrent(remoteVersion) {
+			t.Errorf("%s has version %v, expected it to conflict with %v", f.Name, f.Version, remoteVersion)
+		}
+	}
+}
+
 func TestWalkReceiveOnly(t *testing.T) {
 	sf := fs.NewWalkFilesystem(&singleFileFS{
 		name:     "testfile.dat",
@@ -482,6 +897,78 @@ func TestWalkReceiveOnly(t *testing.T) {
 	}
 }
 
+func TestWalkSkipContentTypes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ffs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+
+	// The extensions say one thing, the contents another.
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	files := map[string][]byte{
+		"journal.db": png,
+		"image.png":  []byte("just some text\n"),
+		"page.txt":   []byte("<html><body>hello</body></html>"),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(current CurrentFiler, types ...string) []string {
+		t.Helper()
+		cfg := testConfig()
+		cfg.Filesystem = ffs
+		cfg.CurrentFiler = current
+		cfg.SkipContentTypes = types
+		var names []string
+		for r := range Walk(context.TODO(), cfg) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if r.File.IsIgnored() {
+				names = append(names, "ignored:"+r.File.Name)
+			} else {
+				names = append(names, r.File.Name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	cases := []struct {
+		types    []string
+		expected []string
+	}{
+		{nil, []string{"image.png", "journal.db", "page.txt"}},
+		{[]string{"image/png"}, []string{"image.png", "page.txt"}},
+		{[]string{"text/plain"}, []string{"journal.db", "page.txt"}},
+		{[]string{"TEXT/*"}, []string{"journal.db"}},
+		{[]string{"application/pdf"}, []string{"image.png", "journal.db", "page.txt"}},
+	}
+	for _, tc := range cases {
+		if res := walk(nil, tc.types...); !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("Skipping %v: expected %v, got %v", tc.types, tc.expected, res)
+		}
+	}
+
+	// A previously scanned file whose contents change to a skipped type is
+	// marked as ignored.
+	current := make(fakeCurrentFiler)
+	for _, f := range walkDir(ffs, ".", nil, nil, 0) {
+		current[f.Name] = f
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "image.png"), png, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res := walk(current, "image/png"); !reflect.DeepEqual(res, []string{"ignored:image.png"}) {
+		t.Errorf("Expected image.png to be marked ignored, got %v", res)
+	}
+}
+
 func walkDir(fs fs.Filesystem, dir string, cfiler CurrentFiler, matcher *ignore.Matcher, localFlags uint32) []protocol.FileInfo {
 	cfg := testConfig()
 	cfg.Filesystem = fs
@@ -7,6 +7,7 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"runtime"
@@ -40,6 +41,9 @@ type WaitGroup interface {
 	Add(int)
 	Done()
 	Wait()
+	// Waiting returns the callers of Add that have not yet been matched by
+	// a call to Done. They are only tracked when debugging is enabled.
+	Waiting() []string
 }
 
 func NewMutex() Mutex {
@@ -54,6 +58,18 @@ func NewMutex() Mutex {
 	return &sync.Mutex{}
 }
 
+// NewTimeoutMutex returns a mutex that, when debugging is enabled, logs a
+// warning when acquiring the lock takes longer than the given duration.
+func NewTimeoutMutex(timeout time.Duration) Mutex {
+	if useDeadlock {
+		return &deadlock.Mutex{}
+	}
+	if debug {
+		return &timeoutMutex{timeout: timeout}
+	}
+	return &sync.Mutex{}
+}
+
 func NewRWMutex() RWMutex {
 	if useDeadlock {
 		return &deadlock.RWMutex{}
@@ -73,7 +89,51 @@ func NewWaitGroup() WaitGroup {
 	if debug {
 		return &loggedWaitGroup{}
 	}
-	return &sync.WaitGroup{}
+	return &waitGroup{}
+}
+
+// LockContext locks the mutex, unless the context is cancelled first in
+// which case the context error is returned and the mutex is not held.
+//
+// The lock is acquired by a separate goroutine. If the caller gives up,
+// that goroutine remains blocked until it gets the lock and then
+// immediately releases it again, so an abandoned attempt never leaves the
+// mutex locked, but lives as long as the mutex stays contended.
+func LockContext(ctx context.Context, m Mutex) error {
+	return lockContext(ctx, m.Lock, m.Unlock)
+}
+
+// RLockContext read locks the mutex, unless the context is cancelled first
+// in which case the context error is returned and the mutex is not held.
+// See LockContext for the semantics of abandoned attempts.
+func RLockContext(ctx context.Context, m RWMutex) error {
+	return lockContext(ctx, m.RLock, m.RUnlock)
+}
+
+func lockContext(ctx context.Context, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	acquired := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		lock()
+		select {
+		case acquired <- struct{}{}:
+			// Ownership is handed over to the caller
+		case <-abandoned:
+			unlock()
+		}
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		close(abandoned)
+		return ctx.Err()
+	}
 }
 
 type holder struct {
@@ -113,6 +173,19 @@ func (m *loggedMutex) Holders() string {
 	return m.holder.Load().(holder).String()
 }
 
+type timeoutMutex struct {
+	sync.Mutex
+	timeout time.Duration
+}
+
+func (m *timeoutMutex) Lock() {
+	start := defaultClock.Now()
+	m.Mutex.Lock()
+	if waited := defaultClock.Now().Sub(start); waited >= m.timeout {
+		l.Warnf("Mutex took %v (more than %v) to lock at %s", waited, m.timeout, getHolder().at)
+	}
+}
+
 type loggedRWMutex struct {
 	sync.RWMutex
 	holder atomic.Value
@@ -200,8 +273,73 @@ func (m *loggedRWMutex) Holders() string {
 	return output
 }
 
+// waitGroup is a plain WaitGroup that doesn't track its callers.
+type waitGroup struct {
+	sync.WaitGroup
+}
+
+func (wg *waitGroup) Waiting() []string {
+	return nil
+}
+
 type loggedWaitGroup struct {
 	sync.WaitGroup
+
+	// Outstanding Add calls. A Done can't reliably be attributed to a
+	// specific Add, so one from the same goroutine is considered done
+	// first, otherwise the oldest one.
+	waiting    []holder
+	waitingMut sync.Mutex
+}
+
+func (wg *loggedWaitGroup) Add(delta int) {
+	holder := getHolder()
+	wg.waitingMut.Lock()
+	if delta > 0 {
+		for i := 0; i < delta; i++ {
+			wg.waiting = append(wg.waiting, holder)
+		}
+	} else {
+		id := goid()
+		for i := 0; i < -delta; i++ {
+			wg.doneLocked(id)
+		}
+	}
+	wg.waitingMut.Unlock()
+	wg.WaitGroup.Add(delta)
+}
+
+func (wg *loggedWaitGroup) Done() {
+	id := goid()
+	wg.waitingMut.Lock()
+	wg.doneLocked(id)
+	wg.waitingMut.Unlock()
+	wg.WaitGroup.Done()
+}
+
+func (wg *loggedWaitGroup) doneLocked(id int) {
+	if len(wg.waiting) == 0 {
+		return
+	}
+	for i := len(wg.waiting) - 1; i >= 0; i-- {
+		if wg.waiting[i].goid == id {
+			wg.waiting = append(wg.waiting[:i], wg.waiting[i+1:]...)
+			return
+		}
+	}
+	wg.waiting = wg.waiting[1:]
+}
+
+// Waiting returns the callers of Add that have not yet been matched by a
+// call to Done.
+func (wg *loggedWaitGroup) Waiting() []string {
+	wg.waitingMut.Lock()
+	defer wg.waitingMut.Unlock()
+	res := make([]string, len(wg.waiting))
+	for i, holder := range wg.waiting {
+		res[i] = holder.String()
+	}
+	return res
 }
 
 func (wg *loggedWaitGroup) Wait() {
@@ -7,6 +7,9 @@
 package sync
 
 import (
+	"context"
+	"fmt"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -33,7 +36,11 @@ func TestTypes(t *testing.T) {
 		t.Error("Wrong type")
 	}
 
-	if _, ok := NewWaitGroup().(*sync.WaitGroup); !ok {
+	if _, ok := NewWaitGroup().(*waitGroup); !ok {
+		t.Error("Wrong type")
+	}
+
+	if _, ok := NewTimeoutMutex(time.Second).(*sync.Mutex); !ok {
 		t.Error("Wrong type")
 	}
 
@@ -52,6 +59,10 @@ func TestTypes(t *testing.T) {
 		t.Error("Wrong type")
 	}
 
+	if _, ok := NewTimeoutMutex(time.Second).(*timeoutMutex); !ok {
+		t.Error("Wrong type")
+	}
+
 	debug = false
 	l.SetDebug("sync", false)
 }
@@ -226,6 +237,149 @@ func TestWaitGroup(t *testing.T) {
 	l.SetDebug("sync", false)
 }
 
+func TestWaitGroupWaiting(t *testing.T) {
+	debug = true
+	l.SetDebug("sync", true)
+	defer func() {
+		debug = false
+		l.SetDebug("sync", false)
+	}()
+
+	wg := NewWaitGroup()
+	if waiting := wg.Waiting(); len(waiting) != 0 {
+		t.Fatal("Unexpected waiting:", waiting)
+	}
+
+	wg.Add(2)
+	wg.Done()
+	wg.Done()
+	wg.Add(1) // this one is never done
+	_, _, line, _ := runtime.Caller(0)
+	done := make(chan struct{})
+	go func() {
+		wg.Add(1)
+		wg.Done()
+		close(done)
+	}()
+	<-done
+
+	waiting := wg.Waiting()
+	if len(waiting) != 1 {
+		t.Fatalf("Expected one waiting, got %v", waiting)
+	}
+	if expected := fmt.Sprintf("sync/sync_test.go:%d ", line-1); !strings.Contains(waiting[0], expected) {
+		t.Errorf("Expected the caller of Add at %s, got %s", expected, waiting[0])
+	}
+
+	wg.Done()
+	if waiting := wg.Waiting(); len(waiting) != 0 {
+		t.Error("Unexpected waiting:", waiting)
+	}
+	wg.Wait()
+}
+
+func TestTimeoutMutex(t *testing.T) {
+	debug = true
+	l.SetDebug("sync", true)
+	defer func() {
+		debug = false
+		l.SetDebug("sync", false)
+	}()
+
+	msgmut := sync.Mutex{}
+	var messages []string
+	l.AddHandler(logger.LevelWarn, func(_ logger.LogLevel, message string) {
+		msgmut.Lock()
+		messages = append(messages, message)
+		msgmut.Unlock()
+	})
+
+	mut := NewTimeoutMutex(logThreshold)
+
+	// Uncontended, no warning
+	mut.Lock()
+	mut.Unlock()
+
+	mut.Lock()
+	locked := make(chan int)
+	go func() {
+		_, _, line, _ := runtime.Caller(0)
+		mut.Lock()
+		locked <- line + 1
+		mut.Unlock()
+	}()
+	time.Sleep(2 * logThreshold)
+	mut.Unlock()
+	line := <-locked
+
+	msgmut.Lock()
+	defer msgmut.Unlock()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one warning, got %v", messages)
+	}
+	if expected := fmt.Sprintf("sync/sync_test.go:%d", line); !strings.HasSuffix(messages[0], expected) {
+		t.Errorf("Expected warning for caller at %s, got %q", expected, messages[0])
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	mut := NewRWMutex()
+	ctx := context.Background()
+
+	// Uncontended
+	if err := LockContext(ctx, mut); err != nil {
+		t.Fatal(err)
+	}
+	mut.Unlock()
+	if err := RLockContext(ctx, mut); err != nil {
+		t.Fatal(err)
+	}
+	// Multiple readers are fine
+	if err := RLockContext(ctx, mut); err != nil {
+		t.Fatal(err)
+	}
+	mut.RUnlock()
+	mut.RUnlock()
+
+	// Already cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := LockContext(cancelled, mut); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	// Contended, times out
+	mut.Lock()
+	timeout, cancel := context.WithTimeout(ctx, shortWait)
+	defer cancel()
+	if err := RLockContext(timeout, mut); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := LockContext(timeout, mut); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// Contended, acquired once released
+	acquired := make(chan error)
+	go func() {
+		acquired <- LockContext(ctx, mut)
+	}()
+	time.Sleep(shortWait)
+	mut.Unlock()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	mut.Unlock()
+
+	// The abandoned attempts must have released the lock again
+	longTimeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := LockContext(longTimeout, mut); err != nil {
+		t.Fatal("Abandoned lock attempt was not released:", err)
+	}
+	mut.Unlock()
+}
+
 func TestTimeoutCond(t *testing.T) {
 	// WARNING this test relies heavily on threads not being stalled at particular points.
 	// As such, it's pretty unstable on the build server. It has been left in as it still
@@ -131,6 +131,10 @@ func (a *App) startup() error {
 		a.mainService.Add(newVerboseService(a.evLogger))
 	}
 
+	// Always there, so that webhooks can be added at runtime; it doesn't
+	// subscribe to any events until then.
+	a.mainService.Add(newWebhookService(a.cfg, a.evLogger))
+
 	errors := logger.NewRecorder(l, logger.LevelWarn, maxSystemErrors, 0)
 	systemLog := logger.NewRecorder(l, logger.LevelDebug, maxSystemLog, initialSystemLog)
 
@@ -190,6 +194,11 @@ func (a *App) startup() error {
 	if a.opts.ResetDeltaIdxs {
 		l.Infoln("Reinitializing delta index IDs")
 		db.DropDeltaIndexIDs(a.ll)
+	} else if backend.ClosedUncleanly(a.ll.Backend) {
+		// Writes may have been lost, and with them the sequence numbers
+		// other devices already know about.
+		l.Infoln("Database wasn't closed properly, reinitializing delta index IDs")
+		db.DropDeltaIndexIDs(a.ll)
 	}
 
 	protectedFiles := []string{
@@ -250,6 +259,7 @@ func (a *App) startup() error {
 
 	cachedDiscovery := discover.NewCachingMux()
 	a.mainService.Add(cachedDiscovery)
+	a.cfg.Subscribe(cachedDiscovery)
 
 	// The TLS configuration is used for both the listening socket and outgoing
 	// connections.
@@ -265,6 +275,7 @@ func (a *App) startup() error {
 
 	connectionsService := connections.NewService(a.cfg, a.myID, m, tlsCfg, cachedDiscovery, bepProtocolName, tlsDefaultCommonName, a.evLogger)
 	a.mainService.Add(connectionsService)
+	m.SetConnectivityTester(connectionsService)
 
 	if a.cfg.Options().GlobalAnnEnabled {
 		for _, srv := range a.cfg.Options().GlobalDiscoveryServers() {
@@ -275,10 +286,10 @@ func (a *App) startup() error {
 				continue
 			}
 
-			// Each global discovery server gets its results cached for five
-			// minutes, and is not asked again for a minute when it's returned
-			// unsuccessfully.
-			cachedDiscovery.Add(gd, 5*time.Minute, time.Minute)
+			// Each global discovery client caches its own results, for as
+			// long as the server says they are valid, and is not asked
+			// again for a minute when it's returned unsuccessfully.
+			cachedDiscovery.Add(gd, 0, 0)
 		}
 	}
 
@@ -299,6 +310,18 @@ func (a *App) startup() error {
 		}
 	}
 
+	if a.cfg.Options().LocalAnnMDNSEnabled {
+		// mDNS, enabled separately from the above
+		for _, addr := range []string{discover.MDNSAddr4, discover.MDNSAddr6} {
+			mdd, err := discover.NewMDNS(a.myID, addr, connectionsService, a.evLogger)
+			if err != nil {
+				l.Warnln("mDNS local discovery:", err)
+				continue
+			}
+			cachedDiscovery.Add(mdd, 0, 0)
+		}
+	}
+
 	// Candidate builds always run with usage reporting.
 
 	if opts := a.cfg.Options(); build.IsCandidate {
@@ -126,3 +126,13 @@ func copyFile(src, dst string) error {
 func OpenDBBackend(path string, tuning config.Tuning) (backend.Backend, error) {
 	return backend.Open(path, backend.Tuning(tuning))
 }
+
+// OpenDBObjectStore opens the database persisted to the object store at the
+// given URL, keeping a local copy in cachePath.
+func OpenDBObjectStore(storeURL, cachePath string, tuning config.Tuning) (backend.Backend, error) {
+	store, err := backend.NewS3StoreFromURL(storeURL)
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenObjectStore(store, cachePath, backend.Tuning(tuning))
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package syncthing
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/thejerf/suture"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/sync"
+	"github.com/syncthing/syncthing/lib/util"
+)
+
+const (
+	webhookQueueSize   = 1000
+	webhookMaxAttempts = 5
+	webhookTimeout     = 30 * time.Second
+
+	// The signature is the hex encoded HMAC-SHA256 of the request body,
+	// keyed with the secret of the webhook.
+	webhookSignatureHeader = "X-Syncthing-Signature"
+)
+
+var (
+	webhookRetryInterval    = time.Second
+	webhookMaxRetryInterval = time.Minute
+)
+
+// The webhookService subscribes to events and posts them in JSON format to
+// the configured webhooks. Each webhook has its own queue, so that a slow
+// receiver doesn't hold up the others. It's only subscribed to the events
+// the webhooks want, if there are any.
+type webhookService struct {
+	*suture.Supervisor
+	cfg      config.Wrapper
+	evLogger events.Logger
+	mut      sync.Mutex
+	sub      events.Subscription // nil without webhooks
+	mask     events.EventType
+	subbed   chan struct{}       // signals a new subscription
+	hooks    map[string]*webhook // URL -> webhook
+	tokens   map[string]suture.ServiceToken
+}
+
+func newWebhookService(cfg config.Wrapper, evLogger events.Logger) *webhookService {
+	s := &webhookService{
+		Supervisor: suture.New("webhookService", suture.Spec{
+			Log: func(line string) {
+				l.Debugln(line)
+			},
+			PassThroughPanics: true,
+		}),
+		cfg:      cfg,
+		evLogger: evLogger,
+		mut:      sync.NewMutex(),
+		subbed:   make(chan struct{}, 1),
+		hooks:    make(map[string]*webhook),
+		tokens:   make(map[string]suture.ServiceToken),
+	}
+	s.Add(util.AsService(s.serve, s.String()))
+	s.setWebhooks(cfg.RawCopy().Webhooks)
+	cfg.Subscribe(s)
+	return s
+}
+
+// serve hands the events to the webhooks that want them. When the
+// subscription is replaced, the old one is drained until it's closed
+// before moving on to the new one. The new one then skips the events the
+// old one already delivered, i.e. those up to the last one seen that are
+// of a type the old one was subscribed to.
+func (s *webhookService) serve(ctx context.Context) {
+	var sub events.Subscription
+	var mask, seenMask events.EventType
+	var lastID, seenID int
+	for {
+		if sub == nil {
+			s.mut.Lock()
+			if s.sub != nil {
+				sub = s.sub
+				seenMask, seenID = mask, lastID
+				mask = s.mask
+			}
+			s.mut.Unlock()
+		}
+		var evs <-chan events.Event
+		if sub != nil {
+			evs = sub.C()
+		}
+
+		select {
+		case ev, ok := <-evs:
+			if !ok {
+				sub = nil
+				continue
+			}
+			if ev.GlobalID <= seenID && ev.Type&seenMask != 0 {
+				continue
+			}
+			if ev.GlobalID > lastID {
+				lastID = ev.GlobalID
+			}
+			s.mut.Lock()
+			for _, hook := range s.hooks {
+				if hook.mask&ev.Type != 0 {
+					hook.enqueue(ev)
+				}
+			}
+			s.mut.Unlock()
+		case <-s.subbed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the webhook service.
+func (s *webhookService) Stop() {
+	s.cfg.Unsubscribe(s)
+	s.Supervisor.Stop()
+	s.mut.Lock()
+	sub := s.sub
+	s.sub = nil
+	s.mut.Unlock()
+	if sub != nil {
+		sub.Unsubscribe()
+	}
+}
+
+func (s *webhookService) VerifyConfiguration(from, to config.Configuration) error {
+	return nil
+}
+
+func (s *webhookService) CommitConfiguration(from, to config.Configuration) bool {
+	s.setWebhooks(to.Webhooks)
+	return true
+}
+
+// setWebhooks starts delivering to the given webhooks. Those that are
+// unchanged keep their queue.
+func (s *webhookService) setWebhooks(cfgs []config.WebhookConfiguration) {
+	s.mut.Lock()
+	s.setWebhooksLocked(cfgs)
+	var mask events.EventType
+	for _, hook := range s.hooks {
+		mask |= hook.mask
+	}
+	unchanged := mask == s.mask
+	s.mut.Unlock()
+
+	if !unchanged {
+		s.resubscribe(mask)
+	}
+}
+
+// resubscribe replaces the subscription with one to the given events, or
+// none if the mask is empty. Subscribing is done without holding the lock,
+// as the event logger may be waiting for us to take events meanwhile.
+func (s *webhookService) resubscribe(mask events.EventType) {
+	var sub events.Subscription
+	if mask != 0 {
+		sub = s.evLogger.Subscribe(mask)
+	}
+
+	s.mut.Lock()
+	old := s.sub
+	s.sub = sub
+	s.mask = mask
+	s.mut.Unlock()
+
+	if old != nil {
+		old.Unsubscribe()
+	}
+	select {
+	case s.subbed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *webhookService) setWebhooksLocked(cfgs []config.WebhookConfiguration) {
+	seen := make(map[string]bool, len(cfgs))
+	for _, hookCfg := range cfgs {
+		seen[hookCfg.URL] = true
+		if hook, ok := s.hooks[hookCfg.URL]; ok {
+			if reflect.DeepEqual(hook.cfg, hookCfg) {
+				continue
+			}
+			s.Remove(s.tokens[hookCfg.URL])
+		}
+		hook, err := newWebhook(hookCfg, webhookQueueSize)
+		if err != nil {
+			// Can't happen, the configuration is validated.
+			l.Infof("Webhook %s: %v", hookCfg.URL, err)
+			delete(s.hooks, hookCfg.URL)
+			continue
+		}
+		s.hooks[hookCfg.URL] = hook
+		s.tokens[hookCfg.URL] = s.Add(hook)
+	}
+
+	for url := range s.hooks {
+		if !seen[url] {
+			s.Remove(s.tokens[url])
+			delete(s.hooks, url)
+			delete(s.tokens, url)
+		}
+	}
+}
+
+func (s *webhookService) String() string {
+	return fmt.Sprintf("webhookService@%p", s)
+}
+
+// A webhook posts the events in its queue, one at a time. When the queue
+// is full, the oldest event is dropped to make room.
+type webhook struct {
+	suture.Service
+	cfg       config.WebhookConfiguration
+	mask      events.EventType
+	client    *http.Client
+	queueSize int
+
+	mut     sync.Mutex
+	queue   []events.Event
+	dropped int
+	added   chan struct{}
+}
+
+func newWebhook(cfg config.WebhookConfiguration, queueSize int) (*webhook, error) {
+	mask, err := cfg.EventMask()
+	if err != nil {
+		return nil, err
+	}
+	h := &webhook{
+		cfg:       cfg,
+		mask:      mask,
+		client:    &http.Client{Timeout: webhookTimeout},
+		queueSize: queueSize,
+		mut:       sync.NewMutex(),
+		added:     make(chan struct{}, 1),
+	}
+	h.Service = util.AsService(h.serve, h.String())
+	return h, nil
+}
+
+func (h *webhook) enqueue(ev events.Event) {
+	h.mut.Lock()
+	if len(h.queue) >= h.queueSize {
+		h.queue = h.queue[1:]
+		h.dropped++
+		l.Debugf("Webhook %s: queue full, dropped oldest event", h.cfg.URL)
+	}
+	h.queue = append(h.queue, ev)
+	h.mut.Unlock()
+
+	select {
+	case h.added <- struct{}{}:
+	default:
+	}
+}
+
+func (h *webhook) next() (events.Event, bool) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if len(h.queue) == 0 {
+		return events.Event{}, false
+	}
+	ev := h.queue[0]
+	h.queue = h.queue[1:]
+	return ev, true
+}
+
+func (h *webhook) serve(ctx context.Context) {
+	for {
+		ev, ok := h.next()
+		if !ok {
+			select {
+			case <-h.added:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := h.deliver(ctx, ev); err != nil {
+			l.Infof("Webhook %s: dropping event %d (%v): %v", h.cfg.URL, ev.GlobalID, ev.Type, err)
+		}
+	}
+}
+
+// deliver posts the event, retrying with increasing intervals on network
+// errors and server errors.
+func (h *webhook) deliver(ctx context.Context, ev events.Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	interval := webhookRetryInterval
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(ctx, body)
+		if err == nil || !retry || attempt == webhookMaxAttempts {
+			return err
+		}
+		l.Debugf("Webhook %s: attempt %d: %v", h.cfg.URL, attempt, err)
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if interval *= 2; interval > webhookMaxRetryInterval {
+			interval = webhookMaxRetryInterval
+		}
+	}
+}
+
+// post makes one request, returning whether it's worth retrying if it
+// fails.
+func (h *webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if h.cfg.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(h.cfg.Secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("server error: %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("rejected: %s", resp.Status)
+	}
+	return false, nil
+}
+
+func (h *webhook) String() string {
+	return fmt.Sprintf("webhook@%p", h)
+}
+
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
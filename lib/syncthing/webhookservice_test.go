@@ -0,0 +1,308 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package syncthing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+type webhookRequest struct {
+	body      []byte
+	signature string
+}
+
+// webhookReceiver records the requests made to it, answering with the
+// given status codes in turn and then with 200 OK.
+func webhookReceiver(statuses ...int) (*httptest.Server, chan webhookRequest, *int32) {
+	reqs := make(chan webhookRequest, 100)
+	calls := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1))
+		body, _ := ioutil.ReadAll(r.Body)
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		reqs <- webhookRequest{body, r.Header.Get(webhookSignatureHeader)}
+	}))
+	return srv, reqs, calls
+}
+
+func TestWebhookService(t *testing.T) {
+	srv, reqs, _ := webhookReceiver()
+	defer srv.Close()
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+
+	raw := config.New(protocol.LocalDeviceID)
+	raw.Webhooks = []config.WebhookConfiguration{{
+		URL:    srv.URL,
+		Events: []string{"ConfigSaved"},
+		Secret: "s3cr3t",
+	}}
+	service := newWebhookService(config.Wrap("/dev/null", raw, events.NoopLogger), evLogger)
+	go service.Serve()
+	defer service.Stop()
+
+	// Only the event type asked for is delivered.
+	evLogger.Log(events.DeviceConnected, "not delivered")
+	evLogger.Log(events.ConfigSaved, "delivered")
+
+	var req webhookRequest
+	select {
+	case req = <-reqs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the webhook")
+	}
+	var ev events.Event
+	if err := json.Unmarshal(req.body, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != events.ConfigSaved || ev.Data != "delivered" {
+		t.Errorf("Unexpected event %v", ev)
+	}
+	if req.signature != webhookSignature("s3cr3t", req.body) {
+		t.Errorf("Signature %v doesn't match the body", req.signature)
+	}
+	// Hex encoded HMAC-SHA256, independently computed
+	if sig := webhookSignature("key", []byte("The quick brown fox jumps over the lazy dog")); sig != "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Errorf("Unexpected signature %v", sig)
+	}
+
+	select {
+	case req := <-reqs:
+		t.Errorf("Unexpected request %s", req.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	defer func(interval time.Duration) { webhookRetryInterval = interval }(webhookRetryInterval)
+	webhookRetryInterval = 10 * time.Millisecond
+
+	// Server errors are retried ...
+	srv, reqs, calls := webhookReceiver(http.StatusInternalServerError, http.StatusServiceUnavailable)
+	defer srv.Close()
+	hook, err := newWebhook(config.WebhookConfiguration{URL: srv.URL}, webhookQueueSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.deliver(context.Background(), events.Event{Type: events.ConfigSaved}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(calls); n != 3 || len(reqs) != 1 {
+		t.Errorf("Expected delivery on the third of %d attempts", n)
+	}
+
+	// ... up to a limit ...
+	statuses := make([]int, webhookMaxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusBadGateway
+	}
+	srv, _, calls = webhookReceiver(statuses...)
+	defer srv.Close()
+	hook.cfg.URL = srv.URL
+	if err := hook.deliver(context.Background(), events.Event{Type: events.ConfigSaved}); err == nil {
+		t.Error("Expected delivery to fail")
+	}
+	if n := atomic.LoadInt32(calls); n != webhookMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", webhookMaxAttempts, n)
+	}
+
+	// ... while a rejection is final.
+	srv, _, calls = webhookReceiver(http.StatusBadRequest)
+	defer srv.Close()
+	hook.cfg.URL = srv.URL
+	if err := hook.deliver(context.Background(), events.Event{Type: events.ConfigSaved}); err == nil {
+		t.Error("Expected delivery to fail")
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("Expected a single attempt, got %d", n)
+	}
+}
+
+func TestWebhookQueueOverflow(t *testing.T) {
+	srv, reqs, _ := webhookReceiver()
+	defer srv.Close()
+	hook, err := newWebhook(config.WebhookConfiguration{URL: srv.URL}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is delivered yet, so the oldest events are dropped.
+	for i := 1; i <= 5; i++ {
+		hook.enqueue(events.Event{GlobalID: i, Type: events.ConfigSaved})
+	}
+	if hook.dropped != 2 || len(hook.queue) != 3 {
+		t.Fatalf("Expected 2 dropped and 3 queued events, got %d and %d", hook.dropped, len(hook.queue))
+	}
+
+	go hook.Serve()
+	defer hook.Stop()
+	for i := 3; i <= 5; i++ {
+		select {
+		case req := <-reqs:
+			var ev events.Event
+			if err := json.Unmarshal(req.body, &ev); err != nil {
+				t.Fatal(err)
+			}
+			if ev.GlobalID != i {
+				t.Errorf("Expected event %d, got %d", i, ev.GlobalID)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for the webhook")
+		}
+	}
+}
+
+func TestWebhookSubscription(t *testing.T) {
+	srv, reqs, _ := webhookReceiver()
+	defer srv.Close()
+
+	evLogger := events.NewLogger()
+	go evLogger.Serve()
+	defer evLogger.Stop()
+
+	raw := config.New(protocol.LocalDeviceID)
+	service := newWebhookService(config.Wrap("/dev/null", raw, events.NoopLogger), evLogger)
+	go service.Serve()
+	defer service.Stop()
+
+	subscribed := func() (events.Subscription, events.EventType) {
+		service.mut.Lock()
+		defer service.mut.Unlock()
+		return service.sub, service.mask
+	}
+
+	// Without webhooks, there's no subscription.
+	if sub, _ := subscribed(); sub != nil {
+		t.Fatal("Subscribed without webhooks")
+	}
+
+	// Adding webhooks subscribes to the events they want.
+	to := raw.Copy()
+	to.Webhooks = []config.WebhookConfiguration{
+		{URL: srv.URL + "/a", Events: []string{"ConfigSaved"}},
+		{URL: srv.URL + "/b", Events: []string{"DeviceConnected"}},
+	}
+	service.CommitConfiguration(raw, to)
+	if sub, mask := subscribed(); sub == nil || mask != events.ConfigSaved|events.DeviceConnected {
+		t.Fatalf("Expected subscription to the webhooks' events, got %v", mask)
+	}
+	evLogger.Log(events.ConfigSaved, "delivered")
+	select {
+	case <-reqs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the webhook")
+	}
+
+	// Changing them resubscribes, without delivering events twice.
+	from := to
+	to = from.Copy()
+	to.Webhooks = to.Webhooks[:1]
+	service.CommitConfiguration(from, to)
+	if sub, mask := subscribed(); sub == nil || mask != events.ConfigSaved {
+		t.Fatalf("Expected subscription to ConfigSaved, got %v", mask)
+	}
+	evLogger.Log(events.ConfigSaved, "delivered")
+	select {
+	case <-reqs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the webhook after resubscribing")
+	}
+	select {
+	case req := <-reqs:
+		t.Errorf("Unexpected request %s", req.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Removing them unsubscribes.
+	from = to
+	to = from.Copy()
+	to.Webhooks = nil
+	service.CommitConfiguration(from, to)
+	if sub, _ := subscribed(); sub != nil {
+		t.Error("Still subscribed without webhooks")
+	}
+}
+
+type fakeSubscription chan events.Event
+
+func (s fakeSubscription) C() <-chan events.Event { return s }
+func (s fakeSubscription) Poll(timeout time.Duration) (events.Event, error) {
+	return events.Event{}, events.ErrTimeout
+}
+func (s fakeSubscription) Unsubscribe() {}
+
+func TestWebhookResubscribeDedup(t *testing.T) {
+	raw := config.New(protocol.LocalDeviceID)
+	service := newWebhookService(config.Wrap("/dev/null", raw, events.NoopLogger), events.NoopLogger)
+	hook, err := newWebhook(config.WebhookConfiguration{URL: "http://127.0.0.1/", Events: []string{"ConfigSaved", "DeviceConnected"}}, webhookQueueSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.hooks[hook.cfg.URL] = hook
+
+	// The old subscription is only to ConfigSaved, the new one to both.
+	// Events 1 to 3 happen while both are subscribed.
+	oldSub, newSub := make(fakeSubscription, 10), make(fakeSubscription, 10)
+	oldSub <- events.Event{GlobalID: 1, Type: events.ConfigSaved}
+	oldSub <- events.Event{GlobalID: 3, Type: events.ConfigSaved}
+	newSub <- events.Event{GlobalID: 2, Type: events.DeviceConnected}
+	newSub <- events.Event{GlobalID: 3, Type: events.ConfigSaved}
+	newSub <- events.Event{GlobalID: 4, Type: events.DeviceConnected}
+
+	service.sub, service.mask = oldSub, events.ConfigSaved
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.serve(ctx)
+
+	// Resubscribe as resubscribe does, once the old one has been drained.
+	for len(oldSub) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	service.mut.Lock()
+	service.sub, service.mask = newSub, events.ConfigSaved|events.DeviceConnected
+	service.mut.Unlock()
+	close(oldSub)
+	service.subbed <- struct{}{}
+
+	// Event 3 is only delivered once, while event 2 isn't mistaken for
+	// having been seen as the old subscription didn't cover it.
+	timeout := time.Now().Add(10 * time.Second)
+	for {
+		hook.mut.Lock()
+		var ids []int
+		for _, ev := range hook.queue {
+			ids = append(ids, ev.GlobalID)
+		}
+		hook.mut.Unlock()
+		if len(ids) == 4 {
+			if ids[0] != 1 || ids[1] != 3 || ids[2] != 2 || ids[3] != 4 {
+				t.Errorf("Unexpected events delivered: %v", ids)
+			}
+			break
+		}
+		if len(ids) > 4 || time.Now().After(timeout) {
+			t.Fatalf("Expected events 1, 3, 2 and 4 to be delivered, got %v", ids)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -228,19 +228,20 @@ func (s *Service) reportData(urVersion int, preview bool) map[string]interface{}
 	res["upgradeAllowedPre"] = !(upgrade.DisabledByCompilation || s.noUpgrade) && opts.AutoUpgradeIntervalH > 0 && opts.UpgradeToPreReleases
 
 	if urVersion >= 3 {
+		defaults := config.Defaults()
 		res["uptime"] = s.UptimeS()
 		res["natType"] = s.connectionsService.NATType()
 		res["alwaysLocalNets"] = len(opts.AlwaysLocalNets) > 0
 		res["cacheIgnoredFiles"] = opts.CacheIgnoredFiles
 		res["overwriteRemoteDeviceNames"] = opts.OverwriteRemoteDevNames
 		res["progressEmitterEnabled"] = opts.ProgressUpdateIntervalS > -1
-		res["customDefaultFolderPath"] = opts.DefaultFolderPath != "~"
+		res["customDefaultFolderPath"] = opts.DefaultFolderPath != defaults.Options.DefaultFolderPath
 		res["customTrafficClass"] = opts.TrafficClass != 0
-		res["customTempIndexMinBlocks"] = opts.TempIndexMinBlocks != 10
+		res["customTempIndexMinBlocks"] = opts.TempIndexMinBlocks != defaults.Options.TempIndexMinBlocks
 		res["temporariesDisabled"] = opts.KeepTemporariesH == 0
-		res["temporariesCustom"] = opts.KeepTemporariesH != 24
+		res["temporariesCustom"] = opts.KeepTemporariesH != defaults.Options.KeepTemporariesH
 		res["limitBandwidthInLan"] = opts.LimitBandwidthInLan
-		res["customReleaseURL"] = opts.ReleasesURL != "https://upgrades.syncthing.net/meta.json"
+		res["customReleaseURL"] = opts.ReleasesURL != defaults.Options.ReleasesURL
 		res["restartOnWakeup"] = opts.RestartOnWakeup
 
 		folderUsesV3 := map[string]int{
@@ -276,7 +277,7 @@ func (s *Service) reportData(urVersion int, preview bool) map[string]interface{}
 			}
 			if cfg.WeakHashThresholdPct < 0 {
 				folderUsesV3["alwaysWeakHash"]++
-			} else if cfg.WeakHashThresholdPct != 25 {
+			} else if cfg.WeakHashThresholdPct != defaults.Folder.WeakHashThresholdPct {
 				folderUsesV3["customWeakHashThreshold"]++
 			}
 			if cfg.FSWatcherEnabled {
@@ -9,6 +9,7 @@ package util
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -176,6 +177,34 @@ func Address(network, host string) string {
 	return u.String()
 }
 
+var privateNets = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),     // RFC 1918
+	mustParseCIDR("172.16.0.0/12"),  // RFC 1918
+	mustParseCIDR("192.168.0.0/16"), // RFC 1918
+	mustParseCIDR("169.254.0.0/16"), // RFC 3927 link local
+	mustParseCIDR("fc00::/7"),       // RFC 4193 unique local
+	mustParseCIDR("fe80::/10"),      // RFC 4291 link local
+}
+
+// IsPrivateIP returns true if the given address is in one of the private
+// or link local ranges, that is, not routable on the internet.
+func IsPrivateIP(ip net.IP) bool {
+	for _, ipnet := range privateNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipnet
+}
+
 // AsService wraps the given function to implement suture.Service by calling
 // that function on serve and closing the passed channel when Stop is called.
 func AsService(fn func(ctx context.Context), creator string) suture.Service {
@@ -8,6 +8,7 @@ package util
 
 import (
 	"context"
+	"net"
 	"strings"
 	"testing"
 )
@@ -169,6 +170,32 @@ func TestAddress(t *testing.T) {
 	}
 }
 
+func TestIsPrivateIP(t *testing.T) {
+	cases := []struct {
+		ip      string
+		private bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"169.254.10.20", true},
+		{"8.8.8.8", false},
+		{"203.0.113.5", false},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"2001:db8::1", false},
+		{"::ffff:192.168.1.1", true},
+	}
+
+	for _, tc := range cases {
+		if res := IsPrivateIP(net.ParseIP(tc.ip)); res != tc.private {
+			t.Errorf("IsPrivateIP(%q) => %v, expected %v", tc.ip, res, tc.private)
+		}
+	}
+}
+
 func TestCopyMatching(t *testing.T) {
 	type Nested struct {
 		A int
@@ -102,6 +102,49 @@ func (v *staggered) clean() {
 		return
 	}
 
+	versionsPerFile, dirTracker, err := v.walkVersions()
+	if err != nil {
+		l.Warnln("Versioner: error scanning versions dir", err)
+		return
+	}
+
+	for _, versionList := range versionsPerFile {
+		v.expire(versionList)
+	}
+
+	dirTracker.deleteEmptyDirs(v.versionsFs)
+
+	l.Debugln("Cleaner: Finished cleaning", v.versionsFs)
+}
+
+// CleanupDryRun returns the version files that a cleanup would remove right
+// now, without removing them.
+func (v *staggered) CleanupDryRun() ([]string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if _, err := v.versionsFs.Stat("."); fs.IsNotExist(err) {
+		return nil, nil
+	}
+
+	versionsPerFile, _, err := v.walkVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var remove []string
+	for _, versionList := range versionsPerFile {
+		remove = append(remove, v.expirable(versionList, now)...)
+	}
+	sort.Strings(remove)
+
+	return remove, nil
+}
+
+// walkVersions returns the versions in the versions dir per file, and the
+// directories they are in.
+func (v *staggered) walkVersions() (map[string][]string, emptyDirTracker, error) {
 	versionsPerFile := make(map[string][]string)
 	dirTracker := make(emptyDirTracker)
 
@@ -129,22 +172,26 @@ func (v *staggered) clean() {
 	}
 
 	if err := v.versionsFs.Walk(".", walkFn); err != nil {
-		l.Warnln("Versioner: error scanning versions dir", err)
-		return
+		return nil, nil, err
 	}
 
-	for _, versionList := range versionsPerFile {
-		v.expire(versionList)
-	}
-
-	dirTracker.deleteEmptyDirs(v.versionsFs)
-
-	l.Debugln("Cleaner: Finished cleaning", v.versionsFs)
+	return versionsPerFile, dirTracker, nil
 }
 
 func (v *staggered) expire(versions []string) {
 	l.Debugln("Versioner: Expiring versions", versions)
-	for _, file := range v.toRemove(versions, time.Now()) {
+	for _, file := range v.expirable(versions, time.Now()) {
+		if err := v.versionsFs.Remove(file); err != nil {
+			l.Warnf("Versioner: can't remove %q: %v", file, err)
+		}
+	}
+}
+
+// expirable returns the version files among the given ones that should be
+// removed at the given time.
+func (v *staggered) expirable(versions []string, now time.Time) []string {
+	var files []string
+	for _, file := range v.toRemove(versions, now) {
 		if fi, err := v.versionsFs.Lstat(file); err != nil {
 			l.Warnln("versioner:", err)
 			continue
@@ -152,11 +199,9 @@ func (v *staggered) expire(versions []string) {
 			l.Infof("non-file %q is named like a file version", file)
 			continue
 		}
-
-		if err := v.versionsFs.Remove(file); err != nil {
-			l.Warnf("Versioner: can't remove %q: %v", file, err)
-		}
+		files = append(files, file)
 	}
+	return files
 }
 
 func (v *staggered) toRemove(versions []string, now time.Time) []string {
@@ -233,6 +278,10 @@ func (v *staggered) Restore(filepath string, versionTime time.Time) error {
 	return restoreFile(v.versionsFs, v.folderFs, filepath, versionTime, TagFilename)
 }
 
+func (v *staggered) RestoreTo(filepath string, versionTime time.Time, destPath string) error {
+	return restoreFileTo(v.versionsFs, v.folderFs, filepath, versionTime, destPath, TagFilename)
+}
+
 func (v *staggered) String() string {
 	return fmt.Sprintf("Staggered/@%p", v)
 }
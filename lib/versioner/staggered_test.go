@@ -7,6 +7,9 @@
 package versioner
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"testing"
@@ -68,6 +71,79 @@ func TestStaggeredVersioningVersionCount(t *testing.T) {
 	}
 }
 
+func TestStaggeredCleanupDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	folderFs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+	v := newStaggered(folderFs, map[string]string{
+		"maxAge": strconv.Itoa(365 * 86400),
+	}).(*staggered)
+
+	if rem, err := v.CleanupDryRun(); err != nil || len(rem) != 0 {
+		t.Fatalf("expected nothing to remove without versions, got %v, %v", rem, err)
+	}
+
+	// Versions spanning all the buckets, some of them too close to each
+	// other and one older than the max age.
+	now := time.Now()
+	agos := []time.Duration{
+		10 * time.Second,
+		12 * time.Second, // too close to the previous one
+		10 * time.Minute,
+		3 * time.Hour,
+		3*time.Hour + 10*time.Minute, // same hour
+		3 * 24 * time.Hour,
+		3*24*time.Hour + 2*time.Hour, // same day
+		60 * 24 * time.Hour,
+		60*24*time.Hour + 24*time.Hour, // same week
+		400 * 24 * time.Hour,           // too old
+	}
+	var all []string
+	for _, name := range []string{"test.txt", filepath.Join("dir", "other")} {
+		if err := v.versionsFs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, ago := range agos {
+			version := TagFilename(name, now.Add(-ago).Format(TimeFormat))
+			writeFile(t, v.versionsFs, version, "content")
+			all = append(all, version)
+		}
+	}
+
+	dryRun, err := v.CleanupDryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dryRun) != 2*5 {
+		t.Errorf("expected 10 versions to be removed, got %v", dryRun)
+	}
+
+	// The dry run must not remove anything.
+	for _, version := range all {
+		if _, err := v.versionsFs.Lstat(version); err != nil {
+			t.Errorf("dry run removed %v: %v", version, err)
+		}
+	}
+
+	v.clean()
+
+	var removed []string
+	for _, version := range all {
+		if _, err := v.versionsFs.Lstat(version); fs.IsNotExist(err) {
+			removed = append(removed, version)
+		}
+	}
+	sort.Strings(removed)
+
+	if diff, equal := messagediff.PrettyDiff(removed, dryRun); !equal {
+		t.Errorf("Dry run doesn't match cleanup; got %v, expected %v\n%v", dryRun, removed, diff)
+	}
+}
+
 func parseTime(in string) time.Time {
 	t, err := time.ParseInLocation(TimeFormat, in, time.Local)
 	if err != nil {
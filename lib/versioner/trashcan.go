@@ -151,3 +151,9 @@ func (t *trashcan) Restore(filepath string, versionTime time.Time) error {
 
 	return t.versionsFs.Rename(taggedName, filepath)
 }
+
+func (t *trashcan) RestoreTo(filepath string, versionTime time.Time, destPath string) error {
+	// Versions in the trash can are untagged, so this finds the file by
+	// its modification time instead.
+	return restoreFileTo(t.versionsFs, t.folderFs, filepath, versionTime, destPath, TagFilename)
+}
@@ -23,6 +23,7 @@ import (
 var errDirectory = fmt.Errorf("cannot restore on top of a directory")
 var errNotFound = fmt.Errorf("version not found")
 var errFileAlreadyExists = fmt.Errorf("file already exists")
+var errInvalidDestination = fmt.Errorf("invalid restore destination")
 
 // TagFilename inserts ~tag just before the extension of the filename.
 func TagFilename(name, tag string) string {
@@ -211,30 +212,9 @@ func restoreFile(src, dst fs.Filesystem, filePath string, versionTime time.Time,
 
 	filePath = osutil.NativeFilename(filePath)
 
-	// Try and find a file that has the correct mtime
-	sourceFile := ""
-	sourceMtime := time.Time{}
-	if info, err := src.Lstat(taggedFilePath); err == nil && info.IsRegular() {
-		sourceFile = taggedFilePath
-		sourceMtime = info.ModTime()
-	} else if err == nil {
-		l.Debugln("restore:", taggedFilePath, "not regular")
-	} else {
-		l.Debugln("restore:", taggedFilePath, err.Error())
-	}
-
-	// Check for untagged file
-	if sourceFile == "" {
-		info, err := src.Lstat(filePath)
-		if err == nil && info.IsRegular() && info.ModTime().Truncate(time.Second).Equal(versionTime) {
-			sourceFile = filePath
-			sourceMtime = info.ModTime()
-		}
-
-	}
-
-	if sourceFile == "" {
-		return errNotFound
+	sourceFile, sourceMtime, err := findVersion(src, filePath, taggedFilePath, versionTime)
+	if err != nil {
+		return err
 	}
 
 	// Check that the target location of where we are supposed to restore does not exist.
@@ -246,11 +226,81 @@ func restoreFile(src, dst fs.Filesystem, filePath string, versionTime time.Time,
 	}
 
 	_ = dst.MkdirAll(filepath.Dir(filePath), 0755)
-	err := osutil.RenameOrCopy(src, dst, sourceFile, filePath)
+	err = osutil.RenameOrCopy(src, dst, sourceFile, filePath)
 	_ = dst.Chtimes(filePath, sourceMtime, sourceMtime)
 	return err
 }
 
+// restoreFileTo copies a version of the file to destPath in the folder,
+// which must not exist yet. The version and any current file at filePath
+// are left untouched.
+func restoreFileTo(src, dst fs.Filesystem, filePath string, versionTime time.Time, destPath string, tagger fileTagger) error {
+	destPath, err := checkRestoreDestination(dst, destPath)
+	if err != nil {
+		return err
+	}
+
+	tag := versionTime.In(time.Local).Truncate(time.Second).Format(TimeFormat)
+	filePath = osutil.NativeFilename(filePath)
+	taggedFilePath := tagger(filePath, tag)
+
+	sourceFile, sourceMtime, err := findVersion(src, filePath, taggedFilePath, versionTime)
+	if err != nil {
+		return err
+	}
+
+	_ = dst.MkdirAll(filepath.Dir(destPath), 0755)
+	if err := osutil.Copy(src, dst, sourceFile, destPath); err != nil {
+		return err
+	}
+	_ = dst.Chtimes(destPath, sourceMtime, sourceMtime)
+	return nil
+}
+
+// checkRestoreDestination verifies that the destination of a restore is a
+// path within the folder that doesn't exist yet, and returns it in
+// canonical form.
+func checkRestoreDestination(dst fs.Filesystem, destPath string) (string, error) {
+	destPath, err := fs.Canonicalize(osutil.NativeFilename(destPath))
+	if err != nil {
+		return "", err
+	}
+	if destPath == "." || fs.IsInternal(destPath) {
+		return "", errInvalidDestination
+	}
+	if err := osutil.TraversesSymlink(dst, filepath.Dir(destPath)); err != nil {
+		return "", err
+	}
+	if _, err := dst.Lstat(destPath); err == nil {
+		return "", errFileAlreadyExists
+	} else if !fs.IsNotExist(err) {
+		return "", err
+	}
+	return destPath, nil
+}
+
+// findVersion returns the name and modification time of the version with
+// the given tagged name, or an untagged file with the right modification
+// time.
+func findVersion(src fs.Filesystem, filePath, taggedFilePath string, versionTime time.Time) (string, time.Time, error) {
+	// Try and find a file that has the correct mtime
+	if info, err := src.Lstat(taggedFilePath); err == nil && info.IsRegular() {
+		return taggedFilePath, info.ModTime(), nil
+	} else if err == nil {
+		l.Debugln("restore:", taggedFilePath, "not regular")
+	} else {
+		l.Debugln("restore:", taggedFilePath, err.Error())
+	}
+
+	// Check for untagged file
+	info, err := src.Lstat(filePath)
+	if err == nil && info.IsRegular() && info.ModTime().Truncate(time.Second).Equal(versionTime) {
+		return filePath, info.ModTime(), nil
+	}
+
+	return "", time.Time{}, errNotFound
+}
+
 func fsFromParams(folderFs fs.Filesystem, params map[string]string) (versionsFs fs.Filesystem) {
 	if params["fsType"] == "" && params["fsPath"] == "" {
 		versionsFs = fs.NewFilesystem(folderFs.Type(), filepath.Join(folderFs.URI(), ".stversions"))
@@ -0,0 +1,93 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+func TestRestoreTo(t *testing.T) {
+	for _, versionerType := range []string{"simple", "staggered", "trashcan", "zip"} {
+		t.Run(versionerType, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			folderFs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+			versioner, err := New(folderFs, config.VersioningConfiguration{
+				Type:   versionerType,
+				Params: map[string]string{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			name := filepath.Join("dir", "file")
+			if err := folderFs.MkdirAll("dir", 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, folderFs, name, "A")
+			if err := versioner.Archive(name); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, folderFs, name, "B")
+
+			versions, err := versioner.GetVersions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions[name]) != 1 {
+				t.Fatalf("unexpected number of versions: %d != 1", len(versions[name]))
+			}
+			versionTime := versions[name][0].VersionTime
+
+			// Destinations outside the folder, or already existing, are
+			// refused.
+			for _, dest := range []string{"", filepath.Join("..", "escaped"), name, ".stfolder"} {
+				if err := versioner.RestoreTo(name, versionTime, dest); err == nil {
+					t.Errorf("restoring to %q should fail", dest)
+				}
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "..", "escaped")); !os.IsNotExist(err) {
+				t.Error("version restored outside the folder")
+			}
+
+			dest := filepath.Join("other", "file.restored")
+			if err := versioner.RestoreTo(name, versionTime, dest); err != nil {
+				t.Fatal(err)
+			}
+			if content := readFile(t, folderFs, dest); content != "A" {
+				t.Errorf("expected A at destination, got %s", content)
+			}
+			if content := readFile(t, folderFs, name); content != "B" {
+				t.Errorf("expected original to be untouched, got %s", content)
+			}
+
+			// The version is still available.
+			versions, err = versioner.GetVersions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions[name]) != 1 {
+				t.Errorf("expected version to be kept, got %d versions", len(versions[name]))
+			}
+
+			if err := versioner.RestoreTo(name, versionTime.Add(-time.Hour), "another"); err != errNotFound {
+				t.Errorf("expected not found error, got %v", err)
+			}
+		})
+	}
+}
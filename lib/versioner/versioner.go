@@ -20,6 +20,13 @@ type Versioner interface {
 	Archive(filePath string) error
 	GetVersions() (map[string][]FileVersion, error)
 	Restore(filePath string, versionTime time.Time) error
+	RestoreTo(filePath string, versionTime time.Time, destPath string) error
+}
+
+// A CleanupDryRunner is a Versioner that can tell which versions its next
+// cleanup would remove.
+type CleanupDryRunner interface {
+	CleanupDryRun() ([]string, error)
 }
 
 type FileVersion struct {
@@ -0,0 +1,528 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thejerf/suture"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/osutil"
+	"github.com/syncthing/syncthing/lib/sync"
+	"github.com/syncthing/syncthing/lib/util"
+)
+
+const (
+	zipArchiveName = "versions.zip"
+	// New versions are added to this smaller archive, which is merged into
+	// the main one once it has zipPendingMaxEntries entries, so that each
+	// version doesn't mean copying all the others.
+	zipPendingName       = "versions-pending.zip"
+	zipPendingMaxEntries = 100
+)
+
+func init() {
+	// Register the constructor for this type of versioner
+	factories["zip"] = newZip
+}
+
+// zipVersioner keeps all versions of a folder as entries in a single zip
+// archive, instead of as separate files. Entries are named like the files
+// of the simple versioner, i.e. "dir/file~20060102-150405.ext".
+//
+// Archives are rewritten on change, copying the existing entries without
+// recompressing them, and atomically replaced. New versions go into a
+// pending archive, merged into the main one in batches, when versions are
+// dropped and on cleanup. Only then are the keep and cleanoutDays limits
+// applied. A small main archive is always written directly.
+type zipVersioner struct {
+	suture.Service
+	folderFs     fs.Filesystem
+	versionsFs   fs.Filesystem
+	keep         int // versions to keep per file, zero means all
+	cleanoutDays int // days to keep versions for, zero means forever
+	mut          sync.Mutex
+}
+
+func newZip(folderFs fs.Filesystem, params map[string]string) Versioner {
+	keep, _ := strconv.Atoi(params["keep"])
+	cleanoutDays, _ := strconv.Atoi(params["cleanoutDays"])
+	// On error we default to 0, "keep everything"
+
+	v := &zipVersioner{
+		folderFs:     folderFs,
+		versionsFs:   fsFromParams(folderFs, params),
+		keep:         keep,
+		cleanoutDays: cleanoutDays,
+		mut:          sync.NewMutex(),
+	}
+	v.Service = util.AsService(v.serve, v.String())
+
+	l.Debugf("instantiated %#v", v)
+	return v
+}
+
+// zipEntry is a version to be added to the archive.
+type zipEntry struct {
+	name    string // entry name, i.e. tagged and slash separated
+	source  fs.File
+	modTime time.Time
+}
+
+// Archive moves the named file into the archive. If this function returns
+// nil, the named file does not exist any more (has been archived).
+func (v *zipVersioner) Archive(filePath string) error {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+
+	filePath = osutil.NativeFilename(filePath)
+	info, err := v.folderFs.Lstat(filePath)
+	if fs.IsNotExist(err) {
+		l.Debugln("not archiving nonexistent file", filePath)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsSymlink() {
+		panic("bug: attempting to version a symlink")
+	}
+
+	if err := v.archiveLocked(filePath, info, nil); err != nil {
+		return err
+	}
+	return v.folderFs.Remove(filePath)
+}
+
+// archiveLocked adds the given file to the archive, dropping any entries
+// matching the drop function as well as those pruned by the cleanup
+// rules.
+func (v *zipVersioner) archiveLocked(filePath string, info fs.FileInfo, drop func(name string) bool) error {
+	fd, err := v.folderFs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	entry := zipEntry{
+		name:    zipEntryName(TagFilename(filePath, time.Now().Format(TimeFormat))),
+		source:  fd,
+		modTime: info.ModTime(),
+	}
+	l.Debugln("archiving", filePath, "as", entry.name)
+
+	return v.rewrite(&entry, drop)
+}
+
+func (v *zipVersioner) GetVersions() (map[string][]FileVersion, error) {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+
+	files := make(map[string][]FileVersion)
+	err := v.readArchives(func(main, pending []*zip.File) error {
+		for _, f := range mergeEntries(main, pending) {
+			name, versionTime, ok := parseZipEntryName(f.Name)
+			if !ok {
+				continue
+			}
+			name = osutil.NormalizedFilename(name)
+			files[name] = append(files[name], FileVersion{
+				VersionTime: versionTime,
+				ModTime:     f.Modified.Truncate(time.Second),
+				Size:        int64(f.UncompressedSize64),
+			})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Restore extracts the given version from the archive, archiving any
+// existing file in its place first.
+func (v *zipVersioner) Restore(filePath string, versionTime time.Time) error {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+
+	filePath = osutil.NativeFilename(filePath)
+
+	// Extract to a temporary file next to the target first, so that we
+	// don't touch the existing file if the version doesn't exist.
+	entryName, tempName, modTime, err := v.extractVersion(filePath, versionTime, filePath)
+	if err != nil {
+		return err
+	}
+	defer v.folderFs.Remove(tempName)
+
+	// If something already exists where we are restoring to, archive it
+	// (dropping the restored version from the archive in the same go),
+	// remove it if it's a symlink, or fail if it's a directory.
+	dropRestored := func(name string) bool { return name == entryName }
+	if info, err := v.folderFs.Lstat(filePath); err == nil {
+		switch {
+		case info.IsDir():
+			return errDirectory
+		case info.IsSymlink():
+			if err := v.folderFs.Remove(filePath); err != nil {
+				return errors.Wrap(err, "removing existing symlink")
+			}
+		case info.IsRegular():
+			if err := v.archiveLocked(filePath, info, dropRestored); err != nil {
+				return errors.Wrap(err, "archiving existing file")
+			}
+			dropRestored = nil
+			if err := v.folderFs.Remove(filePath); err != nil {
+				return err
+			}
+		default:
+			panic("bug: unknown item type")
+		}
+	} else if !fs.IsNotExist(err) {
+		return err
+	}
+	if dropRestored != nil {
+		if err := v.rewrite(nil, dropRestored); err != nil {
+			return err
+		}
+	}
+
+	if err := osutil.RenameOrCopy(v.folderFs, v.folderFs, tempName, filePath); err != nil {
+		return err
+	}
+	_ = v.folderFs.Chtimes(filePath, modTime, modTime)
+	return nil
+}
+
+// RestoreTo extracts the given version from the archive to destPath, which
+// must not exist yet.
+func (v *zipVersioner) RestoreTo(filePath string, versionTime time.Time, destPath string) error {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+
+	destPath, err := checkRestoreDestination(v.folderFs, destPath)
+	if err != nil {
+		return err
+	}
+
+	_, tempName, modTime, err := v.extractVersion(osutil.NativeFilename(filePath), versionTime, destPath)
+	if err != nil {
+		return err
+	}
+	defer v.folderFs.Remove(tempName)
+
+	if err := osutil.RenameOrCopy(v.folderFs, v.folderFs, tempName, destPath); err != nil {
+		return err
+	}
+	_ = v.folderFs.Chtimes(destPath, modTime, modTime)
+	return nil
+}
+
+// extractVersion extracts the given version of the file to a temporary
+// file next to destPath. It returns the entry name, the name of the
+// temporary file and the modification time of the version.
+func (v *zipVersioner) extractVersion(filePath string, versionTime time.Time, destPath string) (string, string, time.Time, error) {
+	tag := versionTime.In(time.Local).Truncate(time.Second).Format(TimeFormat)
+	entryName := zipEntryName(TagFilename(filePath, tag))
+
+	tempName := filepath.Join(filepath.Dir(destPath), fs.TempName(filepath.Base(destPath)))
+	_ = v.folderFs.MkdirAll(filepath.Dir(destPath), 0755)
+	var modTime time.Time
+	err := v.readArchives(func(main, pending []*zip.File) error {
+		for _, f := range mergeEntries(main, pending) {
+			if f.Name == entryName {
+				modTime = f.Modified
+				return v.extract(f, tempName)
+			}
+		}
+		return errNotFound
+	})
+	if fs.IsNotExist(err) {
+		err = errNotFound
+	}
+	return entryName, tempName, modTime, err
+}
+
+func (v *zipVersioner) extract(f *zip.File, dst string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fd, err := v.folderFs.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fd, src); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func (v *zipVersioner) serve(ctx context.Context) {
+	l.Debugln(v, "starting")
+	defer l.Debugln(v, "stopping")
+
+	// Do the first cleanup one minute after startup.
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-timer.C:
+			if v.cleanoutDays > 0 {
+				v.mut.Lock()
+				if err := v.rewrite(nil, nil); err != nil {
+					l.Infoln("Cleaning version archive:", err)
+				}
+				v.mut.Unlock()
+			}
+
+			// Cleanups once a day should be enough.
+			timer.Reset(24 * time.Hour)
+		}
+	}
+}
+
+func (v *zipVersioner) String() string {
+	return fmt.Sprintf("zip@%p", v)
+}
+
+// readArchives calls fn with the entries of the main and pending archives.
+// A missing archive is treated as an empty one.
+func (v *zipVersioner) readArchives(fn func(main, pending []*zip.File) error) error {
+	return v.readArchive(zipArchiveName, func(main *zip.Reader) error {
+		return v.readArchive(zipPendingName, func(pending *zip.Reader) error {
+			return fn(main.File, pending.File)
+		})
+	})
+}
+
+func (v *zipVersioner) readArchive(name string, fn func(zr *zip.Reader) error) error {
+	fd, err := v.versionsFs.Open(name)
+	if fs.IsNotExist(err) {
+		return fn(&zip.Reader{})
+	} else if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(fd, info.Size())
+	if err != nil {
+		return errors.Wrap(err, "reading version archive")
+	}
+	return fn(zr)
+}
+
+// mergeEntries returns the entries of both archives, with pending entries
+// replacing main ones of the same name.
+func mergeEntries(main, pending []*zip.File) []*zip.File {
+	if len(pending) == 0 {
+		return main
+	}
+	replaced := make(map[string]struct{}, len(pending))
+	for _, f := range pending {
+		replaced[f.Name] = struct{}{}
+	}
+	merged := make([]*zip.File, 0, len(main)+len(pending))
+	for _, f := range main {
+		if _, ok := replaced[f.Name]; !ok {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, pending...)
+}
+
+// rewrite adds the given new entry to the pending archive. When that one
+// is full or when entries are to be dropped or pruned, it instead writes a
+// new main archive with the existing entries of both, minus those dropped
+// or pruned, plus the new entry, and removes the pending one.
+func (v *zipVersioner) rewrite(add *zipEntry, drop func(name string) bool) error {
+	_, mainErr := v.versionsFs.Lstat(zipArchiveName)
+	_, pendingErr := v.versionsFs.Lstat(zipPendingName)
+	if add == nil && fs.IsNotExist(mainErr) && fs.IsNotExist(pendingErr) {
+		// Nothing to clean out
+		return nil
+	}
+	if _, err := v.versionsFs.Stat("."); fs.IsNotExist(err) {
+		l.Debugln("creating versions dir")
+		if err := v.versionsFs.MkdirAll(".", 0755); err != nil {
+			return err
+		}
+		_ = v.versionsFs.Hide(".")
+	}
+
+	target := zipArchiveName
+	var tempName string
+	err := v.readArchives(func(main, pending []*zip.File) error {
+		var files []*zip.File
+		if add != nil && drop == nil && len(main) >= zipPendingMaxEntries && len(pending)+1 < zipPendingMaxEntries {
+			target = zipPendingName
+			files = make([]*zip.File, 0, len(pending))
+			for _, f := range pending {
+				if f.Name != add.name {
+					files = append(files, f)
+				}
+			}
+		} else {
+			files = v.keepEntries(mergeEntries(main, pending), add, drop)
+		}
+		var err error
+		tempName, err = v.writeArchive(files, add)
+		return err
+	})
+	if tempName != "" {
+		defer v.versionsFs.Remove(tempName)
+	}
+	if err != nil {
+		return err
+	}
+	if err := v.versionsFs.Rename(tempName, target); err != nil {
+		return err
+	}
+	if target == zipArchiveName {
+		// Should we fail here, the pending entries are merged again next
+		// time, replacing themselves.
+		if err := v.versionsFs.Remove(zipPendingName); err != nil && !fs.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchive writes the given entries and the new one to a temporary
+// archive, returning its name.
+func (v *zipVersioner) writeArchive(files []*zip.File, add *zipEntry) (string, error) {
+	tempName := fs.TempName(zipArchiveName)
+	fd, err := v.versionsFs.Create(tempName)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	zw := zip.NewWriter(fd)
+	for _, f := range files {
+		if err := zw.Copy(f); err != nil {
+			return tempName, err
+		}
+	}
+
+	if add != nil {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     add.name,
+			Method:   zip.Deflate,
+			Modified: add.modTime,
+		})
+		if err != nil {
+			return tempName, err
+		}
+		if _, err := io.Copy(w, add.source); err != nil {
+			return tempName, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return tempName, err
+	}
+	return tempName, fd.Close()
+}
+
+// keepEntries returns the entries that should be carried over to the new
+// archive: those not replaced by the new entry, not dropped, not older than
+// cleanoutDays, and among the newest keep versions of their file.
+func (v *zipVersioner) keepEntries(files []*zip.File, add *zipEntry, drop func(name string) bool) []*zip.File {
+	var cutoff time.Time
+	if v.cleanoutDays > 0 {
+		cutoff = time.Now().Add(time.Duration(-24*v.cleanoutDays) * time.Hour)
+	}
+
+	kept := make([]*zip.File, 0, len(files))
+	versions := make(map[string][]*zip.File)
+	for _, f := range files {
+		if (add != nil && f.Name == add.name) || (drop != nil && drop(f.Name)) {
+			continue
+		}
+		name, versionTime, ok := parseZipEntryName(f.Name)
+		if !ok {
+			// Not ours, but not ours to remove either.
+			kept = append(kept, f)
+			continue
+		}
+		if !cutoff.IsZero() && versionTime.Before(cutoff) {
+			l.Debugln("cleaning out", f.Name)
+			continue
+		}
+		versions[name] = append(versions[name], f)
+	}
+
+	if add != nil {
+		if name, _, ok := parseZipEntryName(add.name); ok {
+			// Make room for the new version.
+			versions[name] = append(versions[name], nil)
+		}
+	}
+
+	for _, vs := range versions {
+		// Entry names sort by timestamp, oldest first, and the new entry
+		// is the newest.
+		sort.Slice(vs, func(a, b int) bool {
+			return vs[b] == nil || (vs[a] != nil && vs[a].Name < vs[b].Name)
+		})
+		if v.keep > 0 && len(vs) > v.keep {
+			for _, f := range vs[:len(vs)-v.keep] {
+				l.Debugln("cleaning out", f.Name)
+			}
+			vs = vs[len(vs)-v.keep:]
+		}
+		for _, f := range vs {
+			if f != nil {
+				kept = append(kept, f)
+			}
+		}
+	}
+
+	sort.Slice(kept, func(a, b int) bool {
+		return kept[a].Name < kept[b].Name
+	})
+	return kept
+}
+
+// zipEntryName returns the archive entry name for a native file path. Zip
+// entry names always use forward slashes.
+func zipEntryName(name string) string {
+	return filepath.ToSlash(name)
+}
+
+// parseZipEntryName returns the native file path and version time for an
+// archive entry, or false if it's not a version entry.
+func parseZipEntryName(entry string) (string, time.Time, bool) {
+	name, tag := UntagFilename(path.Clean(entry))
+	if name == "" || tag == "" {
+		return "", time.Time{}, false
+	}
+	versionTime, err := time.ParseInLocation(TimeFormat, tag, time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return filepath.FromSlash(name), versionTime, true
+}
@@ -0,0 +1,268 @@
+// Copyright (C) 2020 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+func setupZipVersioner(t *testing.T, params map[string]string) (*zipVersioner, fs.Filesystem, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	folderFs := fs.NewFilesystem(fs.FilesystemTypeBasic, dir)
+	return newZip(folderFs, params).(*zipVersioner), folderFs, func() { os.RemoveAll(dir) }
+}
+
+func TestZipArchiveRestore(t *testing.T) {
+	v, folderFs, cleanup := setupZipVersioner(t, nil)
+	defer cleanup()
+
+	name := filepath.Join("dir", "file.txt")
+	if err := folderFs.MkdirAll("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, folderFs, name, "A")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := folderFs.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Archive(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := folderFs.Lstat(name); !fs.IsNotExist(err) {
+		t.Fatal("archived file should have been removed")
+	}
+
+	// A single archive, no loose version files.
+	var files []string
+	v.versionsFs.Walk(".", func(path string, info fs.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if len(files) != 1 || files[0] != zipArchiveName {
+		t.Fatalf("expected only the archive in the versions dir, got %v", files)
+	}
+
+	versions, err := v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileVersions := versions[name]
+	if len(fileVersions) != 1 {
+		t.Fatalf("unexpected number of versions: %d != 1", len(fileVersions))
+	}
+	version := fileVersions[0]
+	if !version.ModTime.Equal(modTime) {
+		t.Errorf("mod time mismatch: %v != %v", version.ModTime, modTime)
+	}
+	if version.Size != 1 {
+		t.Errorf("size mismatch: %d != 1", version.Size)
+	}
+
+	// Restoring on top of a newer file archives that one.
+
+	writeFile(t, folderFs, name, "BB")
+	if err := v.Restore(name, version.VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, folderFs, name); content != "A" {
+		t.Errorf("expected A got %s", content)
+	}
+	if info, err := folderFs.Lstat(name); err != nil {
+		t.Fatal(err)
+	} else if !info.ModTime().Truncate(time.Second).Equal(modTime) {
+		t.Errorf("restored mod time mismatch: %v != %v", info.ModTime(), modTime)
+	}
+
+	versions, err = v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions[name]) != 1 || versions[name][0].Size != 2 {
+		t.Errorf("expected only the replaced version to remain, got %v", versions[name])
+	}
+
+	if err := v.Restore(name, version.VersionTime.Add(-time.Hour)); err != errNotFound {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if content := readFile(t, folderFs, name); content != "A" {
+		t.Errorf("failed restore should not touch the file, got %s", content)
+	}
+}
+
+func TestZipCleanout(t *testing.T) {
+	v, folderFs, cleanup := setupZipVersioner(t, map[string]string{"keep": "2", "cleanoutDays": "7"})
+	defer cleanup()
+
+	// Add versions directly, with fake version times.
+	addVersion := func(name string, versionTime time.Time) {
+		writeFile(t, folderFs, "source", name)
+		fd, err := folderFs.Open("source")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fd.Close()
+		err = v.rewrite(&zipEntry{
+			name:    zipEntryName(TagFilename(name, versionTime.Format(TimeFormat))),
+			source:  fd,
+			modTime: versionTime,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	for i := 4; i > 0; i-- {
+		addVersion("many", now.Add(-time.Duration(i)*time.Minute))
+	}
+	addVersion("old", now.Add(-8*24*time.Hour))
+	addVersion("recent", now.Add(-6*24*time.Hour))
+	// Once more to apply the age limit to the last one added
+	if err := v.rewrite(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions["many"]) != 2 {
+		t.Errorf("expected 2 versions to be kept, got %d", len(versions["many"]))
+	}
+	for _, ver := range versions["many"] {
+		if ver.VersionTime.Before(now.Add(-2*time.Minute - time.Second)) {
+			t.Errorf("expected the newest versions to be kept, got %v", ver.VersionTime)
+		}
+	}
+	if len(versions["old"]) != 0 {
+		t.Error("expected old version to be cleaned out")
+	}
+	if len(versions["recent"]) != 1 {
+		t.Error("expected recent version to be kept")
+	}
+}
+
+func TestZipConcurrentArchive(t *testing.T) {
+	v, folderFs, cleanup := setupZipVersioner(t, nil)
+	defer cleanup()
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		writeFile(t, folderFs, fmt.Sprintf("file%d", i), strings.Repeat("x", i))
+	}
+
+	var wg stdsync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := v.Archive(fmt.Sprintf("file%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	versions, err := v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != n {
+		t.Fatalf("expected %d archived files, got %d", n, len(versions))
+	}
+	for i := 0; i < n; i++ {
+		vers := versions[fmt.Sprintf("file%d", i)]
+		if len(vers) != 1 || vers[0].Size != int64(i) {
+			t.Errorf("unexpected versions for file%d: %v", i, vers)
+		}
+	}
+}
+
+func TestZipPendingArchive(t *testing.T) {
+	v, folderFs, cleanup := setupZipVersioner(t, nil)
+	defer cleanup()
+
+	archive := func(name string) {
+		t.Helper()
+		writeFile(t, folderFs, name, name)
+		if err := v.Archive(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := v.versionsFs.Lstat(name)
+		return err == nil
+	}
+
+	// Small archives are written directly.
+	for i := 0; i < zipPendingMaxEntries; i++ {
+		archive(fmt.Sprintf("file%d", i))
+	}
+	if exists(zipPendingName) {
+		t.Fatal("unexpected pending archive")
+	}
+	info, err := v.versionsFs.Lstat(zipArchiveName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Further versions are pending, leaving the main archive alone.
+	archive("pending")
+	if !exists(zipPendingName) {
+		t.Fatal("expected a pending archive")
+	}
+	if cur, err := v.versionsFs.Lstat(zipArchiveName); err != nil {
+		t.Fatal(err)
+	} else if cur.Size() != info.Size() || !cur.ModTime().Equal(info.ModTime()) {
+		t.Error("main archive was rewritten")
+	}
+	versions, err := v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != zipPendingMaxEntries+1 {
+		t.Fatalf("expected %d archived files, got %d", zipPendingMaxEntries+1, len(versions))
+	}
+	if err := v.Restore("pending", versions["pending"][0].VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, folderFs, "pending"); content != "pending" {
+		t.Errorf("expected pending got %s", content)
+	}
+
+	// A full pending archive is merged.
+	for i := 0; i < zipPendingMaxEntries; i++ {
+		archive(fmt.Sprintf("more%d", i))
+	}
+	if exists(zipPendingName) {
+		t.Fatal("expected the pending archive to be merged")
+	}
+	versions, err = v.GetVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2*zipPendingMaxEntries {
+		t.Errorf("expected %d archived files, got %d", 2*zipPendingMaxEntries, len(versions))
+	}
+}